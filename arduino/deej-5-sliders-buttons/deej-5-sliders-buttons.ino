@@ -0,0 +1,73 @@
+const int NUM_SLIDERS = 5;
+const int analogInputs[NUM_SLIDERS] = {A0, A1, A2, A3, A4};
+
+const int NUM_BUTTONS = 3;
+const int buttonInputs[NUM_BUTTONS] = {2, 3, 4};
+const unsigned long DEBOUNCE_MS = 30;
+
+int analogSliderValues[NUM_SLIDERS];
+
+int lastButtonStates[NUM_BUTTONS];
+unsigned long lastButtonChanges[NUM_BUTTONS];
+
+void setup() {
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    pinMode(analogInputs[i], INPUT);
+  }
+
+  // buttons connect their pin to GND when pressed
+  for (int i = 0; i < NUM_BUTTONS; i++) {
+    pinMode(buttonInputs[i], INPUT_PULLUP);
+    lastButtonStates[i] = HIGH;
+    lastButtonChanges[i] = 0;
+  }
+
+  Serial.begin(9600);
+}
+
+void loop() {
+  updateSliderValues();
+  sendSliderValues(); // Actually send data (all the time)
+  sendButtonPresses(); // Only sends data when a button is pressed
+  delay(10);
+}
+
+void updateSliderValues() {
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+     analogSliderValues[i] = analogRead(analogInputs[i]);
+  }
+}
+
+void sendSliderValues() {
+  String builtString = String("");
+
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    builtString += String((int)analogSliderValues[i]);
+
+    if (i < NUM_SLIDERS - 1) {
+      builtString += String("|");
+    }
+  }
+
+  Serial.println(builtString);
+}
+
+// Each press is sent on its own line as "b" followed by the button's index, e.g. "b0"
+void sendButtonPresses() {
+  unsigned long now = millis();
+
+  for (int i = 0; i < NUM_BUTTONS; i++) {
+    int state = digitalRead(buttonInputs[i]);
+
+    if (state == lastButtonStates[i] || now - lastButtonChanges[i] < DEBOUNCE_MS) {
+      continue;
+    }
+
+    lastButtonStates[i] = state;
+    lastButtonChanges[i] = now;
+
+    if (state == LOW) {
+      Serial.println(String("b") + String(i));
+    }
+  }
+}
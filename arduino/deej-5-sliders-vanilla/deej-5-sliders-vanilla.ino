@@ -3,6 +3,9 @@ const int analogInputs[NUM_SLIDERS] = {A0, A1, A2, A3, A4};
 
 int analogSliderValues[NUM_SLIDERS];
 
+// set to true to end each line with a checksum, so deej drops lines garbled by a noisy USB connection
+const bool SEND_CHECKSUM = false;
+
 void setup() { 
   for (int i = 0; i < NUM_SLIDERS; i++) {
     pinMode(analogInputs[i], INPUT);
@@ -34,10 +37,31 @@ void sendSliderValues() {
       builtString += String("|");
     }
   }
+
+  if (SEND_CHECKSUM) {
+    char checksum[4];
+    sprintf(checksum, "*%02X", crc8(builtString));
+    builtString += checksum;
+  }
   
   Serial.println(builtString);
 }
 
+// CRC-8 with polynomial 0x07, as deej expects after the "*" at the end of a line
+byte crc8(const String& data) {
+  byte crc = 0;
+
+  for (unsigned int i = 0; i < data.length(); i++) {
+    crc ^= data[i];
+
+    for (int bit = 0; bit < 8; bit++) {
+      crc = (crc & 0x80) ? (crc << 1) ^ 0x07 : crc << 1;
+    }
+  }
+
+  return crc;
+}
+
 void printSliderValues() {
   for (int i = 0; i < NUM_SLIDERS; i++) {
     String printedString = String("Slider #") + String(i + 1) + String(": ") + String(analogSliderValues[i]) + String(" mV");
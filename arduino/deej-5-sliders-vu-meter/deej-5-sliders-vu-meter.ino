@@ -0,0 +1,122 @@
+const int NUM_SLIDERS = 5;
+const int analogInputs[NUM_SLIDERS] = {A0, A1, A2, A3, A4};
+
+// One LED per slider, on PWM-capable pins so its brightness can follow the level
+const int ledOutputs[NUM_SLIDERS] = {3, 5, 6, 9, 10};
+
+int analogSliderValues[NUM_SLIDERS];
+
+// deej sends a line like "v87|0|12|100|5" with each slider's level (0-100) when vu_meter is enabled in its config
+String incomingLine = String("");
+
+// with keepalive enabled in its config, deej sends "deej:ping" twice a second. if the pings stop
+// (deej quit or the computer went to sleep), the LEDs are turned off instead of showing stale levels
+const unsigned long HOST_TIMEOUT_MS = 2000;
+unsigned long lastPingTime = 0;
+bool hostPinging = false;
+
+void setup() { 
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    pinMode(analogInputs[i], INPUT);
+    pinMode(ledOutputs[i], OUTPUT);
+  }
+
+  Serial.begin(9600);
+}
+
+void loop() {
+  updateSliderValues();
+  sendSliderValues(); // Actually send data (all the time)
+  readMeterValues();
+  checkHostPresent();
+  // printSliderValues(); // For debug
+  delay(10);
+}
+
+void updateSliderValues() {
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+     analogSliderValues[i] = analogRead(analogInputs[i]);
+  }
+}
+
+void sendSliderValues() {
+  String builtString = String("");
+
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    builtString += String((int)analogSliderValues[i]);
+
+    if (i < NUM_SLIDERS - 1) {
+      builtString += String("|");
+    }
+  }
+  
+  Serial.println(builtString);
+}
+
+void readMeterValues() {
+  while (Serial.available() > 0) {
+    char c = Serial.read();
+
+    if (c == '\r') {
+      continue;
+    }
+
+    if (c != '\n') {
+      incomingLine += c;
+      continue;
+    }
+
+    if (incomingLine == "deej:ping") {
+      Serial.println("deej:pong");
+      lastPingTime = millis();
+      hostPinging = true;
+    } else if (incomingLine.startsWith("v")) {
+      updateMeterLeds(incomingLine.substring(1));
+    }
+
+    incomingLine = String("");
+  }
+}
+
+void checkHostPresent() {
+  if (hostPinging && millis() - lastPingTime > HOST_TIMEOUT_MS) {
+    hostPinging = false;
+
+    for (int i = 0; i < NUM_SLIDERS; i++) {
+      analogWrite(ledOutputs[i], 0);
+    }
+  }
+}
+
+void updateMeterLeds(String values) {
+  int start = 0;
+
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    int level = 0;
+
+    if (start <= (int)values.length()) {
+      int end = values.indexOf('|', start);
+      if (end == -1) {
+        end = values.length();
+      }
+
+      level = constrain(values.substring(start, end).toInt(), 0, 100);
+      start = end + 1;
+    }
+
+    analogWrite(ledOutputs[i], map(level, 0, 100, 0, 255));
+  }
+}
+
+void printSliderValues() {
+  for (int i = 0; i < NUM_SLIDERS; i++) {
+    String printedString = String("Slider #") + String(i + 1) + String(": ") + String(analogSliderValues[i]) + String(" mV");
+    Serial.write(printedString.c_str());
+
+    if (i < NUM_SLIDERS - 1) {
+      Serial.write(" | ");
+    } else {
+      Serial.write("\n");
+    }
+  }
+}
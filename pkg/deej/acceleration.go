@@ -0,0 +1,123 @@
+package deej
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// the curves steps can grow along as an encoder turns faster
+const (
+	accelerationCurveLinear    = "linear"
+	accelerationCurveQuadratic = "quadratic"
+	accelerationCurveCubic     = "cubic"
+)
+
+// accelerationCurves map how far a turn's speed is between the slow and fast rates to how far its steps are
+// between their own size and the max multiplier, both from 0 to 1
+var accelerationCurves = map[string]func(float64) float64{
+	accelerationCurveLinear:    func(t float64) float64 { return t },
+	accelerationCurveQuadratic: func(t float64) float64 { return t * t },
+	accelerationCurveCubic:     func(t float64) float64 { return t * t * t },
+}
+
+// stepAccelerator makes the relative volume steps an encoder or jog wheel sends bigger the faster it turns,
+// so sweeping across the whole range doesn't take dozens of turns while slow turns stay precise.
+// Steps are told apart by target and direction, so two encoders (or turning back) don't speed each other up.
+type stepAccelerator struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock  sync.Mutex
+	turns map[string]*encoderTurn
+}
+
+type encoderTurn struct {
+	lastStep time.Time
+
+	// steps per second, smoothed over the last few steps so one quick detent doesn't jump to full speed
+	rate float64
+}
+
+func newStepAccelerator(deej *Deej, logger *zap.SugaredLogger) *stepAccelerator {
+	logger = logger.Named("acceleration")
+
+	a := &stepAccelerator{
+		deej:   deej,
+		logger: logger,
+		turns:  make(map[string]*encoderTurn),
+	}
+
+	logger.Debug("Created step accelerator instance")
+
+	return a
+}
+
+// accelerate returns a relative volume step for a target, scaled up by how fast steps for it come in
+// if encoder_acceleration is enabled
+func (a *stepAccelerator) accelerate(target string, step float32) float32 {
+	info := a.deej.config.Acceleration
+	if !info.Enabled || step == 0 {
+		return step
+	}
+
+	key := strings.ToLower(target) + "+"
+	if step < 0 {
+		key = strings.ToLower(target) + "-"
+	}
+
+	a.lock.Lock()
+	rate := a.measure(key, time.Now(), info.SlowRate)
+	a.lock.Unlock()
+
+	multiplier := accelerationMultiplier(info, rate)
+	if multiplier > 1 {
+		a.logger.Debugw("Accelerating step", "target", target, "rate", rate, "multiplier", multiplier)
+	}
+
+	return step * float32(multiplier)
+}
+
+// measure records a step and returns how many steps per second are coming in. A pause longer than a step at
+// the slow rate starts over, as does turning the other way.
+func (a *stepAccelerator) measure(key string, now time.Time, slowRate float64) float64 {
+	turn, ok := a.turns[key]
+	if !ok {
+		turn = &encoderTurn{}
+		a.turns[key] = turn
+	}
+
+	elapsed := now.Sub(turn.lastStep).Seconds()
+	turn.lastStep = now
+
+	if !ok || elapsed <= 0 || 1/elapsed < slowRate {
+		turn.rate = 0
+	} else {
+		turn.rate = (turn.rate + 1/elapsed) / 2
+	}
+
+	// only the latest direction per target is worth remembering
+	opposite := key[:len(key)-1] + "-"
+	if strings.HasSuffix(key, "-") {
+		opposite = key[:len(key)-1] + "+"
+	}
+
+	delete(a.turns, opposite)
+
+	return turn.rate
+}
+
+// accelerationMultiplier returns how many times bigger a step gets at a rate of steps per second
+func accelerationMultiplier(info AccelerationInfo, rate float64) float64 {
+	curve, ok := accelerationCurves[info.Curve]
+	if !ok || info.FastRate <= info.SlowRate {
+		return 1
+	}
+
+	t := math.Max(0, math.Min(1, (rate-info.SlowRate)/(info.FastRate-info.SlowRate)))
+
+	return 1 + (info.MaxMultiplier-1)*curve(t)
+}
@@ -0,0 +1,62 @@
+package deej
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAccelerationMultiplier(t *testing.T) {
+	info := AccelerationInfo{Enabled: true, MaxMultiplier: 4, SlowRate: 5, FastRate: 25}
+
+	tests := []struct {
+		name  string
+		curve string
+		rate  float64
+		want  float64
+	}{
+		{"slow turn", accelerationCurveLinear, 3, 1},
+		{"at the slow rate", accelerationCurveLinear, 5, 1},
+		{"halfway, linear", accelerationCurveLinear, 15, 2.5},
+		{"halfway, quadratic", accelerationCurveQuadratic, 15, 1.75},
+		{"halfway, cubic", accelerationCurveCubic, 15, 1.375},
+		{"at the fast rate", accelerationCurveQuadratic, 25, 4},
+		{"faster than the fast rate", accelerationCurveLinear, 100, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info.Curve = test.curve
+
+			if got := accelerationMultiplier(info, test.rate); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("accelerationMultiplier() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStepAcceleratorMeasure(t *testing.T) {
+	a := &stepAccelerator{turns: make(map[string]*encoderTurn)}
+	start := time.Now()
+
+	// a step every 50ms is 20 per second, which the smoothed rate approaches
+	var rate float64
+	for i := 0; i < 8; i++ {
+		rate = a.measure("spotify.exe+", start.Add(time.Duration(i)*50*time.Millisecond), 5)
+	}
+
+	if rate < 19 || rate > 20 {
+		t.Errorf("rate after steady steps = %v, want close to 20", rate)
+	}
+
+	// turning the other way starts over
+	if rate := a.measure("spotify.exe-", start.Add(450*time.Millisecond), 5); rate != 0 {
+		t.Errorf("rate after reversing = %v, want 0", rate)
+	}
+
+	// as does pausing for longer than a step at the slow rate
+	a.measure("spotify.exe-", start.Add(500*time.Millisecond), 5)
+	if rate := a.measure("spotify.exe-", start.Add(time.Second), 5); rate != 0 {
+		t.Errorf("rate after pausing = %v, want 0", rate)
+	}
+}
@@ -0,0 +1,169 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// Actions that can be bound to hotkeys and hardware buttons
+const (
+	actionMuteToggle = "mute.toggle"
+	actionVolumeUp   = "volume.up"
+	actionVolumeDown = "volume.down"
+	actionProfileSet = "profile.set"
+	actionExecRun    = "exec.run"
+
+	actionPresetSave    = "preset.save"
+	actionPresetRestore = "preset.restore"
+
+	actionDiscordMute   = "discord.mute"
+	actionDiscordDeafen = "discord.deafen"
+
+	actionFadeOut = "fade.out"
+
+	// default volume step for volume.up and volume.down, in percent
+	defaultActionStep = 5
+)
+
+var errActionMissingTarget = errors.New("action requires a target")
+
+// media actions synthesize the corresponding media key
+var mediaActions = map[string]util.MediaKey{
+	"media.playpause": util.MediaKeyPlayPause,
+	"media.next":      util.MediaKeyNext,
+	"media.previous":  util.MediaKeyPrevious,
+	"media.stop":      util.MediaKeyStop,
+}
+
+// media actions with a target control the playback of that target's sessions instead, where they support it
+var mediaControls = map[string]func(MediaController) error{
+	"media.playpause": MediaController.PlayPause,
+	"media.next":      MediaController.Next,
+	"media.previous":  MediaController.Previous,
+	"media.stop":      MediaController.Stop,
+}
+
+// ActionConfig describes something deej does in response to user input other than a slider, such as a hotkey or button
+type ActionConfig struct {
+	Action  string  `mapstructure:"action"`
+	Target  string  `mapstructure:"target"`
+	Profile string  `mapstructure:"profile"`
+	Preset  string  `mapstructure:"preset"`
+	Step    float32 `mapstructure:"step"`
+}
+
+// validate checks that the action is known and has the fields it needs
+func (a ActionConfig) validate() error {
+	if _, ok := mediaActions[a.Action]; ok {
+		return nil
+	}
+
+	switch a.Action {
+	case actionMuteToggle, actionVolumeUp, actionVolumeDown, actionExecRun:
+		if a.Target == "" {
+			return errActionMissingTarget
+		}
+	case actionProfileSet:
+		if a.Profile == "" {
+			return errors.New("action requires a profile")
+		}
+	case actionPresetSave, actionPresetRestore:
+		if a.Preset == "" {
+			return errors.New("action requires a preset")
+		}
+	case actionDiscordMute, actionDiscordDeafen, actionFadeOut:
+	default:
+		return fmt.Errorf("unknown action: %q", a.Action)
+	}
+
+	return nil
+}
+
+// performAction carries out a single action
+func (d *Deej) performAction(a ActionConfig) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+
+	if key, ok := mediaActions[a.Action]; ok {
+		if a.Target == "" {
+			return util.SendMediaKey(key)
+		}
+
+		controlled, err := d.sessions.controlTargetMedia(a.Target, mediaControls[a.Action])
+		if errors.Is(err, errMediaUnsupported) {
+			// the media key likely reaches the app anyway
+			return util.SendMediaKey(key)
+		}
+
+		if err == nil && len(controlled) == 0 {
+			return fmt.Errorf("no sessions match target %s", a.Target)
+		}
+
+		return err
+	}
+
+	switch a.Action {
+	case actionMuteToggle:
+		_, muted, found := d.sessions.targetState(a.Target)
+		if !found {
+			return fmt.Errorf("no sessions match target %s", a.Target)
+		}
+
+		_, err := d.sessions.setTargetMute(a.Target, !muted)
+		return err
+
+	case actionVolumeUp, actionVolumeDown:
+		volume, _, found := d.sessions.targetState(a.Target)
+		if !found {
+			return fmt.Errorf("no sessions match target %s", a.Target)
+		}
+
+		step := a.Step
+		if step <= 0 {
+			step = defaultActionStep
+		}
+
+		if a.Action == actionVolumeDown {
+			step = -step
+		}
+
+		// buttons bound to an encoder's detents send these as fast as it's turned
+		volume += d.accelerator.accelerate(a.Target, step) / 100
+		if volume < 0 {
+			volume = 0
+		} else if volume > 1 {
+			volume = 1
+		}
+
+		_, err := d.sessions.setTargetVolume(a.Target, volume)
+		return err
+
+	case actionProfileSet:
+		return d.config.ActivateProfile(a.Profile)
+
+	case actionExecRun:
+		return d.exec.trigger(a.Target)
+
+	case actionPresetSave:
+		_, err := d.savePreset(a.Preset)
+		return err
+
+	case actionPresetRestore:
+		_, err := d.restorePreset(a.Preset)
+		return err
+
+	case actionDiscordMute:
+		return d.discord.toggleMute()
+
+	case actionDiscordDeafen:
+		return d.discord.toggleDeafen()
+
+	case actionFadeOut:
+		d.fader.trigger()
+	}
+
+	return nil
+}
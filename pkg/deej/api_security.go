@@ -0,0 +1,192 @@
+package deej
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// the self-signed certificate every API serves when TLS is on without a certificate of the user's own
+	apiCertFilename = "api-cert.pem"
+	apiKeyFilename  = "api-key.pem"
+	apiCertValidity = 10 * 365 * 24 * time.Hour
+
+	apiTokenCookie = "deej_token"
+)
+
+// held while loading the self-signed certificate, since both APIs may generate it at the same time
+var apiCertLock sync.Mutex
+
+var errFingerprintMismatch = errors.New("certificate doesn't match the pinned fingerprint")
+
+// loadAPICertificate returns the certificate an API serves over TLS, along with its fingerprint
+func loadAPICertificate(info TLSInfo) (tls.Certificate, string, error) {
+	var cert tls.Certificate
+	var err error
+
+	if info.CertFile != "" || info.KeyFile != "" {
+		cert, err = tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+	} else {
+		cert, err = selfSignedAPICertificate()
+	}
+
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	return cert, CertificateFingerprint(cert.Certificate[0]), nil
+}
+
+// apiTLSConfig returns the server side TLS config for an API
+func apiTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// selfSignedAPICertificate loads the self-signed certificate, generating it the first time. It's kept next to the
+// internal config so its fingerprint stays the same, and pinned clients keep trusting it.
+func selfSignedAPICertificate() (tls.Certificate, error) {
+	apiCertLock.Lock()
+	defer apiCertLock.Unlock()
+
+	certPath := filepath.Join(internalConfigPath, apiCertFilename)
+	keyPath := filepath.Join(internalConfigPath, apiKeyFilename)
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial number: %w", err)
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil || hostName == "" {
+		hostName = "deej"
+	}
+
+	// clients are expected to pin the certificate rather than check its names, which are only there for the
+	// ones that can't help checking them
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "deej on " + hostName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(apiCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost", hostName, hostName + ".local"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("encode key: %w", err)
+	}
+
+	if err := util.EnsureDirExists(internalConfigPath); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("write key: %w", err)
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("write certificate: %w", err)
+	}
+
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of a DER-encoded certificate, in the colon-separated
+// form browsers show and deej logs when it starts serving over TLS
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(encoded); i += 2 {
+		pairs = append(pairs, encoded[i:i+2])
+	}
+
+	return strings.Join(pairs, ":")
+}
+
+// PinnedTLSConfig returns a client TLS config that trusts the one certificate with the given fingerprint and
+// nothing else, for connecting to deej's self-signed certificate. The fingerprint may be written with or without
+// colons, in either case.
+func PinnedTLSConfig(fingerprint string) *tls.Config {
+	want := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+
+	return &tls.Config{
+		// the certificate is checked against the fingerprint below instead, which is stricter
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errFingerprintMismatch
+			}
+
+			sum := sha256.Sum256(rawCerts[0])
+			if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(want)) != 1 {
+				return errFingerprintMismatch
+			}
+
+			return nil
+		},
+	}
+}
+
+// validAPIToken returns whether a client presented the token an API requires, comparing in constant time
+func validAPIToken(presented, required string) bool {
+	return presented != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(required)) == 1
+}
+
+// bearerToken returns the token from an "Authorization: Bearer <token>" header
+func bearerToken(authorization string) string {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// isLoopbackAddr returns whether a client address belongs to this computer
+func isLoopbackAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	return err == nil && net.ParseIP(host).IsLoopback()
+}
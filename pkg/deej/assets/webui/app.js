@@ -0,0 +1,364 @@
+'use strict';
+
+const POLL_INTERVAL_MS = 250;
+const DEFAULT_PROFILE = 'default';
+
+let lastState = null;
+
+// the editor keeps its own copy of the mappings, so polling doesn't overwrite unsaved changes
+let editorProfile = null;
+let editorDirty = false;
+let editorLoadedFrom = null;
+
+const $ = (id) => document.getElementById(id);
+
+function percent(value) {
+  return Math.round(value * 100);
+}
+
+function meterRow(name, value, muted, title = name, icon = '') {
+  const row = document.createElement('div');
+  row.className = 'row' + (muted ? ' muted' : '');
+
+  const label = document.createElement('span');
+  label.className = 'name';
+  label.textContent = name;
+  label.title = title;
+
+  if (icon) {
+    const image = document.createElement('img');
+    image.src = icon;
+    image.alt = '';
+    label.prepend(image);
+  }
+
+  const bar = document.createElement('div');
+  bar.className = 'bar';
+
+  const fill = document.createElement('div');
+  fill.className = 'fill';
+  fill.style.width = percent(value) + '%';
+  bar.appendChild(fill);
+
+  const text = document.createElement('span');
+  text.className = 'value';
+  text.textContent = muted ? 'muted' : percent(value) + '%';
+
+  row.append(label, bar, text);
+  return row;
+}
+
+function renderSliders(state) {
+  const mapping = state.mappings[state.activeProfile] || {};
+  const indexes = new Set([...Object.keys(state.sliders), ...Object.keys(mapping)].map(Number));
+  const sorted = [...indexes].sort((a, b) => a - b);
+
+  if (state.virtualSliders) {
+    renderVirtualSliders(state, mapping, sorted);
+    return;
+  }
+
+  virtualSliders.clear();
+
+  const rows = sorted.map((index) => {
+    const targets = mapping[index] ? mapping[index].join(', ') : 'unmapped';
+    const value = state.sliders[index];
+
+    return meterRow(`#${index}: ${targets}`, value === undefined ? 0 : value, false);
+  });
+
+  $('sliders').replaceChildren(...rows);
+}
+
+// virtual slider rows are kept between polls, since replacing one would cut off a drag in progress
+const virtualSliders = new Map();
+
+// how long after the user last moved a virtual slider polling leaves its position alone,
+// so it doesn't jump back while the move is on its way
+const VIRTUAL_SLIDER_HOLD_MS = 1000;
+
+function virtualSliderRow(index) {
+  const row = document.createElement('div');
+  row.className = 'row';
+
+  const label = document.createElement('span');
+  label.className = 'name';
+
+  const input = document.createElement('input');
+  input.type = 'range';
+  input.min = 0;
+  input.max = 100;
+
+  const text = document.createElement('span');
+  text.className = 'value';
+
+  row.append(label, input, text);
+
+  const slider = { row, label, input, text, movedAt: 0, sending: false, pending: null };
+
+  input.addEventListener('input', () => {
+    slider.movedAt = Date.now();
+    text.textContent = input.value + '%';
+    sendSliderMove(index, slider, input.value / 100);
+  });
+
+  return slider;
+}
+
+function renderVirtualSliders(state, mapping, indexes) {
+  for (const index of virtualSliders.keys()) {
+    if (!indexes.includes(index)) {
+      virtualSliders.delete(index);
+    }
+  }
+
+  for (const index of indexes) {
+    if (!virtualSliders.has(index)) {
+      virtualSliders.set(index, virtualSliderRow(index));
+    }
+
+    const slider = virtualSliders.get(index);
+    const targets = mapping[index] ? mapping[index].join(', ') : 'unmapped';
+    slider.label.textContent = slider.label.title = `#${index}: ${targets}`;
+
+    const value = state.sliders[index];
+    if (value !== undefined && Date.now() - slider.movedAt > VIRTUAL_SLIDER_HOLD_MS) {
+      slider.input.value = percent(value);
+      slider.text.textContent = percent(value) + '%';
+    }
+  }
+
+  // only rearranged when sliders come or go, for the same reason the rows are kept
+  const rows = indexes.map((index) => virtualSliders.get(index).row);
+  const container = $('sliders');
+
+  if (rows.length !== container.children.length || rows.some((row, i) => container.children[i] !== row)) {
+    container.replaceChildren(...rows);
+  }
+}
+
+// sendSliderMove sends one move at a time per slider, skipping to the newest position once the last one is through
+async function sendSliderMove(index, slider, value) {
+  if (slider.sending) {
+    slider.pending = value;
+    return;
+  }
+
+  slider.sending = true;
+
+  try {
+    await fetch(`api/sliders/${index}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ value }),
+    });
+  } catch (error) {
+    // the next poll shows deej isn't running
+  }
+
+  slider.sending = false;
+
+  if (slider.pending !== null) {
+    const next = slider.pending;
+    slider.pending = null;
+    sendSliderMove(index, slider, next);
+  }
+}
+
+function renderSessions(state) {
+  // sessions show up under their display name, with the key slider_mapping uses for them on hover
+  const rows = state.sessions.map((session) =>
+    meterRow(session.displayName, session.volume, session.muted, session.key, session.icon));
+  $('sessions').replaceChildren(...rows);
+}
+
+function renderStatus(state) {
+  const connection = $('connection');
+
+  if (state === null) {
+    connection.textContent = 'deej is not running';
+    connection.className = 'badge error';
+    return;
+  }
+
+  if (!state.connected && state.virtualSliders) {
+    connection.textContent = 'virtual sliders';
+    connection.className = 'badge ok';
+  } else {
+    connection.textContent = state.connected ? 'board connected' : 'board disconnected';
+    connection.className = 'badge ' + (state.connected ? 'ok' : 'error');
+  }
+
+  $('profile').textContent = 'profile: ' + state.activeProfile;
+}
+
+function editorRow(index, targets) {
+  const row = document.createElement('tr');
+
+  const indexInput = document.createElement('input');
+  indexInput.type = 'number';
+  indexInput.min = 0;
+  indexInput.value = index;
+
+  const targetsInput = document.createElement('input');
+  targetsInput.type = 'text';
+  targetsInput.value = targets.join(', ');
+
+  const remove = document.createElement('button');
+  remove.type = 'button';
+  remove.textContent = 'Remove';
+  remove.addEventListener('click', () => {
+    row.remove();
+    editorDirty = true;
+  });
+
+  for (const input of [indexInput, targetsInput]) {
+    input.addEventListener('input', () => {
+      editorDirty = true;
+    });
+  }
+
+  const cells = [indexInput, targetsInput, remove].map((element) => {
+    const cell = document.createElement('td');
+    cell.appendChild(element);
+    return cell;
+  });
+
+  row.append(...cells);
+  return row;
+}
+
+function loadEditor(state, profile) {
+  editorProfile = profile;
+  editorDirty = false;
+  editorLoadedFrom = JSON.stringify(state.mappings);
+
+  const select = $('editor-profile');
+  const profiles = Object.keys(state.mappings).sort((a, b) => {
+    if (a === DEFAULT_PROFILE) return -1;
+    if (b === DEFAULT_PROFILE) return 1;
+    return a.localeCompare(b);
+  });
+
+  select.replaceChildren(...profiles.map((name) => new Option(name, name, false, name === profile)));
+
+  const mapping = state.mappings[profile] || {};
+  const rows = Object.keys(mapping)
+    .map(Number)
+    .sort((a, b) => a - b)
+    .map((index) => editorRow(index, mapping[index]));
+
+  document.querySelector('#editor tbody').replaceChildren(...rows);
+}
+
+function readEditor() {
+  const mapping = {};
+
+  for (const row of document.querySelectorAll('#editor tbody tr')) {
+    const [indexInput, targetsInput] = row.querySelectorAll('input');
+    const index = parseInt(indexInput.value, 10);
+
+    const targets = targetsInput.value
+      .split(',')
+      .map((target) => target.trim())
+      .filter((target) => target !== '');
+
+    if (isNaN(index) || index < 0) {
+      throw new Error('Slider numbers must be 0 or more');
+    }
+
+    if (targets.length > 0) {
+      mapping[index] = (mapping[index] || []).concat(targets);
+    }
+  }
+
+  return mapping;
+}
+
+async function save() {
+  const status = $('editor-status');
+
+  let mapping;
+  try {
+    mapping = readEditor();
+  } catch (error) {
+    status.textContent = error.message;
+    return;
+  }
+
+  status.textContent = 'Saving...';
+
+  try {
+    const response = await fetch('api/mapping', {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ profile: editorProfile, mapping }),
+    });
+
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+
+    editorDirty = false;
+    status.textContent = 'Saved.';
+  } catch (error) {
+    status.textContent = 'Failed to save: ' + error.message;
+  }
+}
+
+async function poll() {
+  try {
+    const response = await fetch('api/state', { cache: 'no-store' });
+    lastState = await response.json();
+  } catch (error) {
+    lastState = null;
+  }
+
+  renderStatus(lastState);
+
+  if (lastState !== null) {
+    renderSliders(lastState);
+    renderSessions(lastState);
+
+    // only rebuilt when the config changed, so clicking into a field isn't undone by the next poll
+    if (editorProfile === null || (!editorDirty && JSON.stringify(lastState.mappings) !== editorLoadedFrom)) {
+      if (!(editorProfile in lastState.mappings)) {
+        editorProfile = null;
+      }
+
+      loadEditor(lastState, editorProfile || lastState.activeProfile);
+    }
+  }
+
+  setTimeout(poll, POLL_INTERVAL_MS);
+}
+
+$('editor-profile').addEventListener('change', (event) => {
+  if (lastState !== null) {
+    loadEditor(lastState, event.target.value);
+  }
+});
+
+$('editor-add').addEventListener('click', () => {
+  const rows = document.querySelectorAll('#editor tbody tr');
+  let next = 0;
+
+  for (const row of rows) {
+    next = Math.max(next, parseInt(row.querySelector('input').value, 10) + 1 || 0);
+  }
+
+  document.querySelector('#editor tbody').appendChild(editorRow(next, []));
+  editorDirty = true;
+});
+
+$('editor-reset').addEventListener('click', () => {
+  if (lastState !== null) {
+    loadEditor(lastState, editorProfile);
+  }
+
+  $('editor-status').textContent = '';
+});
+
+$('editor-save').addEventListener('click', save);
+
+poll();
@@ -0,0 +1,9 @@
+package deej
+
+const (
+	// AutostartFlagName is the command-line flag the login autostart entry starts deej with,
+	// telling it to run from the executable's directory where config.yaml is
+	AutostartFlagName = "autostart"
+
+	autostartName = "deej"
+)
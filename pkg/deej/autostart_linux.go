@@ -0,0 +1,71 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// desktop environments start the entries in ~/.config/autostart on login,
+// see https://specifications.freedesktop.org/autostart-spec/latest/
+const autostartEntryTemplate = `[Desktop Entry]
+Type=Application
+Name=deej
+Comment=%s
+Exec="%s" --%s
+Path=%s
+Terminal=false
+X-GNOME-Autostart-enabled=true
+`
+
+func autostartEnabled() (bool, error) {
+	entryPath, err := autostartEntryPath()
+	if err != nil {
+		return false, err
+	}
+
+	return util.FileExists(entryPath), nil
+}
+
+func setAutostart(enabled bool) error {
+	entryPath, err := autostartEntryPath()
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		if err := os.Remove(entryPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove autostart entry: %w", err)
+		}
+
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	if err := util.EnsureDirExists(filepath.Dir(entryPath)); err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf(autostartEntryTemplate, serviceDescription, executable, AutostartFlagName, filepath.Dir(executable))
+	if err := os.WriteFile(entryPath, []byte(entry), 0644); err != nil {
+		return fmt.Errorf("write autostart entry: %w", err)
+	}
+
+	return nil
+}
+
+func autostartEntryPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("get user config directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "autostart", autostartName+".desktop"), nil
+}
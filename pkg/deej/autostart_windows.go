@@ -0,0 +1,57 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// programs listed here start when the user logs in
+const autostartRegistryKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+func autostartEnabled() (bool, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, autostartRegistryKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false, fmt.Errorf("open autostart registry key: %w", err)
+	}
+	defer key.Close()
+
+	if _, _, err := key.GetStringValue(autostartName); err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("read autostart registry value: %w", err)
+	}
+
+	return true, nil
+}
+
+func setAutostart(enabled bool) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, autostartRegistryKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open autostart registry key: %w", err)
+	}
+	defer key.Close()
+
+	if !enabled {
+		if err := key.DeleteValue(autostartName); err != nil && !errors.Is(err, registry.ErrNotExist) {
+			return fmt.Errorf("delete autostart registry value: %w", err)
+		}
+
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	if err := key.SetStringValue(autostartName, fmt.Sprintf(`"%s" --%s`, executable, AutostartFlagName)); err != nil {
+		return fmt.Errorf("write autostart registry value: %w", err)
+	}
+
+	return nil
+}
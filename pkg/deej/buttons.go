@@ -0,0 +1,56 @@
+package deej
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// buttonActions performs the action mapped to each hardware button as it's pressed
+type buttonActions struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+}
+
+func newButtonActions(deej *Deej, logger *zap.SugaredLogger) *buttonActions {
+	logger = logger.Named("buttons")
+
+	ba := &buttonActions{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created button actions instance")
+
+	return ba
+}
+
+// initialize subscribes to button presses
+func (ba *buttonActions) initialize() {
+	buttonEventsChannel := ba.deej.events.buttonPressed.subscribe()
+
+	ba.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-buttonEventsChannel:
+				ba.handleButtonPressEvent(event)
+			}
+		}
+	})
+}
+
+func (ba *buttonActions) handleButtonPressEvent(event ButtonPressEvent) {
+	action, ok := ba.deej.config.ButtonMapping[event.ButtonID]
+	if !ok {
+		ba.logger.Debugw("Button isn't mapped to an action", "button", event.ButtonID)
+		return
+	}
+
+	ba.logger.Debugw("Performing button action", "button", event.ButtonID, "action", action.Action)
+
+	if err := ba.deej.performAction(action); err != nil {
+		ba.logger.Warnw("Failed to perform button action", "button", event.ButtonID, "action", action.Action, "error", err)
+	}
+}
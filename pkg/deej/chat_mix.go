@@ -0,0 +1,91 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const (
+	chatMixTargetName = "chatmix"
+
+	// the chat_mix section's targets are handed out as these aliases, which user aliases can't clash with
+	chatMixGameAlias = specialTargetTransformPrefix + "game"
+	chatMixChatAlias = specialTargetTransformPrefix + "chat"
+
+	// chatMixTarget is what the mix slider is mapped to
+	chatMixTarget = specialTargetTransformPrefix + chatMixTargetName + "(" + chatMixGameAlias + ", " + chatMixChatAlias + ")"
+
+	// chatMixLinePrefix starts each line telling the board where the mix is, as the mix slider's index followed
+	// by the game and chat volumes in percent, e.g. "c2|100|40"
+	chatMixLinePrefix = "c"
+)
+
+// chatMix tells the board where the game/chat mix is, so builds with LEDs next to the mix slider can show which
+// side it favors the way headset amps do. The mixing itself is done by the session map, through chatMixTarget.
+type chatMix struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lastLevels string // the game and chat levels last sent
+}
+
+func newChatMix(deej *Deej, logger *zap.SugaredLogger) *chatMix {
+	logger = logger.Named("chat_mix")
+
+	cm := &chatMix{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created chat mix instance")
+
+	return cm
+}
+
+// start begins sending the mix point to the board as the mix slider moves, until deej shuts down
+func (cm *chatMix) start() {
+	sliderMovedChannel := cm.deej.events.sliderMoved.subscribe()
+	connectionChannel := cm.deej.events.connectionChanged.subscribe()
+
+	cm.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderMovedChannel:
+				cm.send(event)
+			case <-connectionChannel:
+				// a board that just connected doesn't know the mix yet, so the next move is sent even if it's the same
+				cm.lastLevels = ""
+			}
+		}
+	})
+}
+
+func (cm *chatMix) send(event SliderMoveEvent) {
+	info := cm.deej.config.ChatMix
+	if !info.enabled() || !info.LEDs || event.SliderID != info.MixSlider || !cm.deej.serial.Connected() {
+		return
+	}
+
+	game, chat := chatMixVolumes(event.PercentValue)
+	levels := fmt.Sprintf("%d|%d", int(game*100+0.5), int(chat*100+0.5))
+
+	// the board keeps showing the last mix, so there's no need to repeat it
+	if levels == cm.lastLevels {
+		return
+	}
+
+	err := cm.deej.serial.writeToSlider(event.SliderID, func(localIdx int) string {
+		return fmt.Sprintf("%s%d|%s", chatMixLinePrefix, localIdx, levels)
+	})
+
+	if err != nil {
+		cm.logger.Debugw("Failed to send chat mix", "error", err)
+		return
+	}
+
+	cm.lastLevels = levels
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/omriharel/deej/pkg/deej"
+	"github.com/omriharel/deej/pkg/deej/deejpb"
+)
+
+const cliRequestTimeout = 5 * time.Second
+
+var errUsage = errors.New("invalid usage")
+
+// cliCommand is a subcommand that talks to a running deej instance over its gRPC control API
+type cliCommand struct {
+	name        string
+	args        string
+	description string
+	run         func(ctx context.Context, client deejpb.DeejClient, args []string) error
+}
+
+var cliCommands = []cliCommand{
+	{
+		name:        "status",
+		description: "show connection state and current slider values",
+		run:         runStatusCommand,
+	},
+	{
+		name:        "sessions",
+		description: "list audio sessions and their volumes",
+		run:         runSessionsCommand,
+	},
+	{
+		name:        "mappings",
+		description: "show the live sessions each slider's targets currently resolve to",
+		run:         runMappingsCommand,
+	},
+	{
+		name:        "set",
+		args:        "<target> <volume 0-100>",
+		description: "set the volume of a target (same syntax as slider_mapping)",
+		run:         runSetCommand,
+	},
+	{
+		name:        "preset",
+		args:        "list | save <name> | restore <name>",
+		description: "list volume presets, save the current volumes as one, or restore one",
+		run:         runPresetCommand,
+	},
+	{
+		name:        "reload",
+		description: "make the running instance reload its configuration",
+		run:         runReloadCommand,
+	},
+}
+
+// doctor runs on its own rather than talking to a running instance, which would keep the serial port busy
+const doctorCommandName = "doctor"
+
+func runDoctorCommand(args []string) int {
+	flags := flag.NewFlagSet(doctorCommandName, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: deej %s\n", doctorCommandName)
+		fmt.Fprintln(flags.Output(), "  check the config, serial ports and audio sessions, and print a report to share when asking for help")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	fmt.Println("Checking deej's setup. Quit deej first, or its serial port will show up as busy.")
+
+	if !deej.Doctor(os.Stdout, versionString()) {
+		return 1
+	}
+
+	return 0
+}
+
+// fingerprint also runs on its own, only looking at the certificate a running instance serves
+const fingerprintCommandName = "fingerprint"
+
+func runFingerprintCommand(args []string) int {
+	flags := flag.NewFlagSet(fingerprintCommandName, flag.ContinueOnError)
+	address := flags.String("address", deej.DefaultGRPCAddress, "address of the running deej instance's gRPC or HTTP API")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: deej %s [--address host:port]\n", fingerprintCommandName)
+		fmt.Fprintln(flags.Output(), "  print the fingerprint of the TLS certificate an API serves, to pin it with --fingerprint or in other clients")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// the certificate is only looked at, never trusted with anything
+	dialer := &net.Dialer{Timeout: cliRequestTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", *address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deej %s: %v\n", fingerprintCommandName, err)
+		fmt.Fprintln(os.Stderr, "Is deej running with tls enabled for that API in its config?")
+		return 1
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		fmt.Fprintf(os.Stderr, "deej %s: %s sent no certificate\n", fingerprintCommandName, *address)
+		return 1
+	}
+
+	fmt.Println(deej.CertificateFingerprint(certs[0].Raw))
+	fmt.Fprintln(os.Stderr, "Check that it matches the fingerprint deej logs on startup before pinning it.")
+
+	return 0
+}
+
+// cliToken sends grpc_api.token along with every request
+type cliToken string
+
+func (t cliToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity allows sending the token without TLS, which is up to whoever didn't enable it
+func (t cliToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func findCLICommand(name string) (cliCommand, bool) {
+	for _, command := range cliCommands {
+		if command.name == name {
+			return command, true
+		}
+	}
+
+	return cliCommand{}, false
+}
+
+// runCLICommand executes a subcommand and returns the process exit code
+func runCLICommand(command cliCommand, args []string) int {
+	flags := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	address := flags.String("address", deej.DefaultGRPCAddress, "address of the running deej instance's gRPC API")
+	token := flags.String("token", "", "the instance's grpc_api.token, needed when connecting from another machine")
+	fingerprint := flags.String("fingerprint", "", "connect over TLS, trusting only the certificate with this fingerprint (see deej fingerprint)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: deej %s [--address host:port] [--token token] [--fingerprint sha256] %s\n", command.name, command.args)
+		fmt.Fprintf(flags.Output(), "  %s\n", command.description)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	transport := insecure.NewCredentials()
+	if *fingerprint != "" {
+		transport = credentials.NewTLS(deej.PinnedTLSConfig(*fingerprint))
+	}
+
+	options := []grpc.DialOption{grpc.WithTransportCredentials(transport)}
+	if *token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(cliToken(*token)))
+	}
+
+	conn, err := grpc.NewClient(*address, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deej: failed to connect to %s: %v\n", *address, err)
+		return 1
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliRequestTimeout)
+	defer cancel()
+
+	if err := command.run(ctx, deejpb.NewDeejClient(conn), flags.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			flags.Usage()
+			return 2
+		}
+
+		fmt.Fprintf(os.Stderr, "deej %s: %v\n", command.name, err)
+		fmt.Fprintln(os.Stderr, "Is deej running with grpc_api enabled in its config?")
+		return 1
+	}
+
+	return 0
+}
+
+func printCLIUsage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintln(out, "Usage: deej [flags]")
+	fmt.Fprintln(out, "       deej <command> [--address host:port] [--token token] [--fingerprint sha256] [args]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands (require grpc_api to be enabled in the running instance's config):")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, command := range cliCommands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", command.name, command.args, command.description)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Diagnostics (run while deej is not running):")
+	fmt.Fprintf(out, "  %s  check the config, serial ports and audio sessions, and print a shareable report\n", doctorCommandName)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Security (run while deej is running):")
+	fmt.Fprintf(out, "  %s  print the fingerprint of an API's TLS certificate (see deej %s --help)\n", fingerprintCommandName, fingerprintCommandName)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Hardware (run while deej is not running):")
+	fmt.Fprintf(out, "  %s  download deej firmware and flash it onto a board (see deej %s --help)\n", flashCommandName, flashCommandName)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Development:")
+	fmt.Fprintf(out, "  %s  pretend to be a board sending slider data (see deej %s --help)\n", simulateCommandName, simulateCommandName)
+}
+
+func runStatusCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	status, err := client.GetStatus(ctx, &deejpb.GetStatusRequest{})
+	if err != nil {
+		return err
+	}
+
+	if status.Version != "" {
+		fmt.Println(status.Version)
+	}
+
+	connection := status.Connection
+	state := "disconnected"
+	if connection.Connected {
+		state = "connected"
+	}
+	fmt.Printf("Serial: %s (%s @ %d baud)\n", state, connection.ComPort, connection.BaudRate)
+
+	if len(status.SliderValues) == 0 {
+		fmt.Println("Sliders: no data received yet")
+		return nil
+	}
+
+	fmt.Println("Sliders:")
+	for idx, value := range status.SliderValues {
+		if value < 0 {
+			fmt.Printf("  %d: -\n", idx)
+		} else {
+			fmt.Printf("  %d: %d%%\n", idx, percent(value))
+		}
+	}
+
+	return nil
+}
+
+func runSessionsCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	response, err := client.ListSessions(ctx, &deejpb.ListSessionsRequest{})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tVOLUME")
+	for _, session := range response.Sessions {
+		fmt.Fprintf(w, "%s\t%d%%\n", session.Key, percent(session.Volume))
+	}
+
+	return w.Flush()
+}
+
+func runMappingsCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	response, err := client.ListMappings(ctx, &deejpb.ListMappingsRequest{})
+	if err != nil {
+		return err
+	}
+
+	return deej.WriteMappingReport(os.Stdout, response.Sliders)
+}
+
+func runSetCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSuffix(args[1], "%"), 32)
+	if err != nil || value < 0 || value > 100 {
+		return fmt.Errorf("volume must be a number between 0 and 100, got %q", args[1])
+	}
+
+	response, err := client.SetVolume(ctx, &deejpb.SetVolumeRequest{
+		Target: args[0],
+		Volume: float32(value / 100),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Set %s to %.0f%%\n", strings.Join(response.SessionKeys, ", "), value)
+
+	return nil
+}
+
+func runPresetCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	// preset names can contain spaces, so they don't need quoting
+	name := strings.Join(args[1:], " ")
+
+	switch {
+	case args[0] == "list" && name == "":
+		response, err := client.ListPresets(ctx, &deejpb.ListPresetsRequest{})
+		if err != nil {
+			return err
+		}
+
+		if len(response.Presets) == 0 {
+			fmt.Println("No presets saved")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PRESET\tVOLUMES")
+
+		for _, preset := range response.Presets {
+			fmt.Fprintf(w, "%s\t%s\n", preset.Name, formatPresetVolumes(preset.Volumes))
+		}
+
+		return w.Flush()
+
+	case args[0] == "save" && name != "":
+		response, err := client.SavePreset(ctx, &deejpb.SavePresetRequest{Name: name})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Saved %s: %s\n", response.Preset.Name, formatPresetVolumes(response.Preset.Volumes))
+
+	case args[0] == "restore" && name != "":
+		response, err := client.RestorePreset(ctx, &deejpb.RestorePresetRequest{Name: name})
+		if err != nil {
+			return err
+		}
+
+		if len(response.SessionKeys) == 0 {
+			fmt.Printf("Restored %s, though none of its targets have sessions right now\n", name)
+			return nil
+		}
+
+		fmt.Printf("Restored %s: adjusted %s\n", name, strings.Join(response.SessionKeys, ", "))
+
+	default:
+		return errUsage
+	}
+
+	return nil
+}
+
+// formatPresetVolumes lists a preset's volumes by target, e.g. "master 30%, vlc.exe 80%"
+func formatPresetVolumes(volumes map[string]float32) string {
+	targets := make([]string, 0, len(volumes))
+	for target := range volumes {
+		targets = append(targets, target)
+	}
+
+	sort.Strings(targets)
+
+	for i, target := range targets {
+		targets[i] = fmt.Sprintf("%s %d%%", target, percent(volumes[target]))
+	}
+
+	return strings.Join(targets, ", ")
+}
+
+func runReloadCommand(ctx context.Context, client deejpb.DeejClient, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	if _, err := client.ReloadConfig(ctx, &deejpb.ReloadConfigRequest{}); err != nil {
+		return err
+	}
+
+	fmt.Println("Configuration reloaded")
+
+	return nil
+}
+
+func percent(v float32) int {
+	return int(v*100 + 0.5)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/omriharel/deej/pkg/deej"
+)
+
+// flash runs on its own rather than talking to a running instance, which would keep the serial port busy
+const flashCommandName = "flash"
+
+func runFlashCommand(args []string) int {
+	var options deej.FlashOptions
+
+	flags := flag.NewFlagSet(flashCommandName, flag.ContinueOnError)
+	flags.StringVar(&options.Port, "port", "", "serial port the board is on (default: detect it)")
+	flags.StringVar(&options.Board, "board", "", "board type: "+strings.Join(deej.FlashBoards(), ", ")+" (default: detect it)")
+	flags.StringVar(&options.Variant, "variant", deej.FirmwareVariants[0], "firmware to flash: "+strings.Join(deej.FirmwareVariants, ", "))
+	flags.StringVar(&options.File, "file", "", "flash this firmware image instead of downloading one")
+	flags.StringVar(&options.Version, "version", "", "release to download firmware from (default: the latest)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: deej %s [flags]\n", flashCommandName)
+		fmt.Fprintln(flags.Output(), "  download deej firmware and flash it onto a board (needs avrdude, or esptool for ESP boards)")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Flags:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Println("Flashing deej firmware. Quit deej first, or the board's serial port will be busy.")
+
+	if err := deej.Flash(ctx, os.Stdout, options); err != nil {
+		fmt.Fprintf(os.Stderr, "deej %s: %v\n", flashCommandName, err)
+		return 1
+	}
+
+	return 0
+}
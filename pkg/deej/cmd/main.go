@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/omriharel/deej/pkg/deej"
+	"github.com/omriharel/deej/pkg/deejlib"
 )
 
 var (
@@ -12,17 +15,79 @@ var (
 	versionTag string
 	buildType  string
 
-	verbose bool
+	verbose       bool
+	headless      bool
+	dryRun        bool
+	autostart     bool
+	serviceAction string
+)
+
+const (
+	serviceActionInstall   = "install"
+	serviceActionUninstall = "uninstall"
+	serviceActionRun       = "run"
 )
 
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "show verbose logs (useful for debugging serial)")
 	flag.BoolVar(&verbose, "v", false, "shorthand for --verbose")
-	flag.Parse()
+	flag.BoolVar(&headless, "headless", false, "run without a tray icon or desktop notifications, e.g. on a server (SIGHUP reloads the config)")
+	flag.BoolVar(&dryRun, "dry-run", false, "log the volume changes deej would make without making them, to try out a config")
+	flag.BoolVar(&autostart, deej.AutostartFlagName, false, "run from the executable's directory (used when starting on login)")
+	flag.StringVar(&serviceAction, "service", "", "install or uninstall deej as a background service that starts before login (run is used by the service itself)")
+	flag.Usage = printCLIUsage
 }
 
 func main() {
 
+	// subcommands talk to an already running instance instead of starting a new one
+	if len(os.Args) > 1 {
+		if os.Args[1] == doctorCommandName {
+			os.Exit(runDoctorCommand(os.Args[2:]))
+		}
+
+		if os.Args[1] == fingerprintCommandName {
+			os.Exit(runFingerprintCommand(os.Args[2:]))
+		}
+
+		if os.Args[1] == flashCommandName {
+			os.Exit(runFlashCommand(os.Args[2:]))
+		}
+
+		if os.Args[1] == simulateCommandName {
+			os.Exit(runSimulateCommand(os.Args[2:]))
+		}
+
+		if command, ok := findCLICommand(os.Args[1]); ok {
+			os.Exit(runCLICommand(command, os.Args[2:]))
+		}
+	}
+
+	flag.Parse()
+
+	if autostart {
+		// autostart entries may start us anywhere, but config.yaml lives next to the executable
+		if err := enterExecutableDirectory(); err != nil {
+			fmt.Fprintf(os.Stderr, "deej: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch serviceAction {
+	case "":
+	case serviceActionInstall, serviceActionUninstall:
+		os.Exit(runServiceCommand(serviceAction))
+	case serviceActionRun:
+		// service managers don't start us where config.yaml is, but it lives next to the executable
+		if err := enterExecutableDirectory(); err != nil {
+			fmt.Fprintf(os.Stderr, "deej: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	// first we need a logger
 	logger, err := deej.NewLogger(buildType)
 	if err != nil {
@@ -42,25 +107,71 @@ func main() {
 		named.Debug("Verbose flag provided, all log messages will be shown")
 	}
 
-	// create the deej instance
-	d, err := deej.NewDeej(logger, verbose)
+	// create the deej instance. if injected by build process, version info shows up in the tray
+	engine, err := deejlib.New(deejlib.Options{
+		Logger:   logger,
+		Verbose:  verbose,
+		Version:  versionString(),
+		Headless: headless,
+		DryRun:   dryRun,
+	})
 	if err != nil {
 		named.Fatalw("Failed to create deej object", "error", err)
 	}
 
-	// if injected by build process, set version info to show up in the tray
-	if buildType != "" && (versionTag != "" || gitCommit != "") {
-		identifier := gitCommit
-		if versionTag != "" {
-			identifier = versionTag
+	// onwards, to glory
+	if serviceAction == serviceActionRun {
+		if err = engine.RunAsService(); err != nil {
+			named.Fatalw("Failed to run deej as a service", "error", err)
 		}
 
-		versionString := fmt.Sprintf("Version %s-%s", buildType, identifier)
-		d.SetVersion(versionString)
+		return
 	}
 
-	// onwards, to glory
-	if err = d.Initialize(); err != nil {
+	if err = engine.RunWithTray(); err != nil {
 		named.Fatalw("Failed to initialize deej", "error", err)
 	}
-}
\ No newline at end of file
+}
+
+// versionString describes the build, if the build process injected version info
+func versionString() string {
+	if buildType == "" || (versionTag == "" && gitCommit == "") {
+		return ""
+	}
+
+	identifier := gitCommit
+	if versionTag != "" {
+		identifier = versionTag
+	}
+
+	return fmt.Sprintf("Version %s-%s", buildType, identifier)
+}
+
+// runServiceCommand installs or uninstalls the service and returns the process exit code
+func runServiceCommand(action string) int {
+	manage := deej.InstallService
+	if action == serviceActionUninstall {
+		manage = deej.UninstallService
+	}
+
+	if err := manage(); err != nil {
+		fmt.Fprintf(os.Stderr, "deej: failed to %s service: %v\n", action, err)
+		return 1
+	}
+
+	fmt.Printf("deej: service %sed\n", action)
+	return 0
+}
+
+func enterExecutableDirectory() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	if err := os.Chdir(filepath.Dir(executable)); err != nil {
+		return fmt.Errorf("change to executable directory: %w", err)
+	}
+
+	return nil
+}
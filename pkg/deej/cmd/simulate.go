@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej"
+)
+
+// simulate stands in for the board, so it runs on its own next to a regular deej instance
+const simulateCommandName = "simulate"
+
+func runSimulateCommand(args []string) int {
+	var options deej.SimulatorOptions
+
+	flags := flag.NewFlagSet(simulateCommandName, flag.ContinueOnError)
+	flags.StringVar(&options.Port, "port", "", "serial port to write to (default: create a virtual port, Linux only)")
+	flags.IntVar(&options.BaudRate, "baud", 9600, "baud rate, when writing to --port")
+	flags.IntVar(&options.Sliders, "sliders", 5, "number of sliders")
+	flags.DurationVar(&options.Rate, "rate", 10*time.Millisecond, "time between lines")
+	flags.StringVar(&options.Waveform, "waveform", deej.WaveformSine, "how sliders move: "+strings.Join(deej.Waveforms, ", "))
+	flags.DurationVar(&options.Period, "period", 5*time.Second, "time for one full sweep of the waveform")
+	flags.IntVar(&options.Jitter, "jitter", 0, "most raw units (0-1023) a value randomly strays by")
+	flags.IntVar(&options.Static, "value", 512, "raw value (0-1023) the static waveform holds")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: deej %s [flags]\n", simulateCommandName)
+		fmt.Fprintln(flags.Output(), "  pretend to be a board sending slider data, for developing deej without hardware")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Flags:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := deej.Simulate(ctx, os.Stdout, options); err != nil {
+		fmt.Fprintf(os.Stderr, "deej %s: %v\n", simulateCommandName, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,108 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	ole "github.com/go-ole/go-ole"
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+var errCOMThreadStopped = errors.New("COM thread stopped")
+
+// comThread runs every WASAPI call on a single OS thread, which initializes COM once and keeps it for as long as the
+// session finder lives. COM objects are then created and used on the same thread, rather than on whichever thread
+// the calling goroutine happens to run on, with COM initialized again for every refresh.
+type comThread struct {
+	logger   *zap.SugaredLogger
+	onPanic  func(recoverValue interface{})
+	calls    chan func()
+	done     chan struct{}
+	threadID uint32
+}
+
+func newCOMThread(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) (*comThread, error) {
+	t := &comThread{
+		logger:  logger,
+		onPanic: onPanic,
+		calls:   make(chan func()),
+		done:    make(chan struct{}),
+	}
+
+	initialized := make(chan error)
+
+	util.Go(onPanic, func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		// multithreaded, since WASAPI calls back on threads of its own and this one doesn't pump messages
+		if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+			var oleErr *ole.OleError
+			if !errors.As(err, &oleErr) || oleErr.Code() != sFalse {
+				initialized <- fmt.Errorf("initialize COM: %w", err)
+				return
+			}
+		}
+		defer ole.CoUninitialize()
+
+		t.threadID = windows.GetCurrentThreadId()
+		initialized <- nil
+
+		for {
+			select {
+			case call := <-t.calls:
+				call()
+			case <-t.done:
+				return
+			}
+		}
+	})
+
+	if err := <-initialized; err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Started COM thread")
+
+	return t, nil
+}
+
+// run calls f on the COM thread and waits for it to return. Calls made from the COM thread itself, such as a
+// session's method calling another, run right away instead of waiting for the thread to be free.
+func (t *comThread) run(f func() error) error {
+	if windows.GetCurrentThreadId() == t.threadID {
+		return f()
+	}
+
+	result := make(chan error, 1)
+
+	select {
+	case t.calls <- func() { result <- f() }:
+	case <-t.done:
+		return errCOMThreadStopped
+	}
+
+	return <-result
+}
+
+// post has the COM thread call f without waiting for it, for COM callbacks, which must return quickly and
+// can't call into the objects that called them
+func (t *comThread) post(f func()) {
+	util.Go(t.onPanic, func() {
+		select {
+		case t.calls <- f:
+		case <-t.done:
+		}
+	})
+}
+
+// stop ends the COM thread once it's done with the call it's making, if any. Calls made after that fail with
+// errCOMThreadStopped.
+func (t *comThread) stop() {
+	close(t.done)
+	t.logger.Debug("Stopped COM thread")
+}
@@ -0,0 +1,820 @@
+package deej
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// See docs/companion.md for a description of the protocol
+const (
+	companionPairPath      = "/companion/pair"
+	companionConfirmPath   = "/companion/pair/confirm"
+	companionWebSocketPath = "/companion/ws"
+	companionDevicesPath   = "/companion/devices"
+
+	// advertised in the HTTP API's TXT record while companion apps are enabled, for phones to check
+	companionProtocolVersion = 1
+
+	companionPairingTimeout  = 2 * time.Minute
+	companionPairingAttempts = 3
+	companionPairingCode     = 1000000 // codes are below this, shown with leading zeros
+	companionTokenSize       = 32
+	companionMaxDeviceName   = 64
+	companionDefaultDevice   = "phone"
+
+	// how often session volumes are re-checked for changes made outside of deej
+	companionPollInterval = 2 * time.Second
+
+	// slider moves are frequent, so a slow phone gets a bit more leeway than a Stream Deck
+	companionClientBufferSize = 64
+
+	companionMaxMessageSize = 4096
+	companionWriteTimeout   = 5 * time.Second
+)
+
+// commands
+const (
+	companionCommandMoveSlider = "moveSlider"
+	companionCommandSetVolume  = "setVolume"
+	companionCommandSetMute    = "setMute"
+	companionCommandSetProfile = "setProfile"
+)
+
+// events
+const (
+	companionMessageLayout   = "layout"
+	companionMessageSlider   = "slider"
+	companionMessageSessions = "sessions"
+	companionMessageError    = "error"
+)
+
+var (
+	errCompanionDisabled      = errors.New("companion apps are disabled, set companion.enabled in config.yaml")
+	errCompanionMissingTarget = errors.New("target is required")
+	errCompanionInvalidValue  = errors.New("value between 0 and 1 is required")
+	errCompanionTargetUnknown = errors.New("no sessions match target")
+)
+
+// companionPairRequest starts pairing a phone, which the user confirms by typing in the code deej shows them
+type companionPairRequest struct {
+	Device string `json:"device"`
+}
+
+type companionPairReply struct {
+	Pairing   string `json:"pairing"`
+	ExpiresIn int    `json:"expiresIn"` // seconds
+}
+
+type companionConfirmRequest struct {
+	Pairing string `json:"pairing"`
+	Code    string `json:"code"`
+}
+
+type companionConfirmReply struct {
+	Token string `json:"token"`
+	Name  string `json:"name"` // what to list this computer as
+}
+
+type companionDevicesReply struct {
+	Devices []string `json:"devices"`
+}
+
+// companionCommand is a single request sent by a phone
+type companionCommand struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id,omitempty"`
+	Slider  *int     `json:"slider,omitempty"`
+	Value   *float32 `json:"value,omitempty"`
+	Target  string   `json:"target,omitempty"`
+	Mute    *bool    `json:"mute,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+}
+
+// companionLayout is everything a phone needs to draw deej's sliders, sent on connecting and whenever it changes
+type companionLayout struct {
+	Type          string            `json:"type"`
+	Name          string            `json:"name"`
+	Version       int               `json:"version"`
+	Connected     bool              `json:"connected"`
+	Sliders       []companionSlider `json:"sliders"`
+	ActiveProfile string            `json:"activeProfile"`
+	Profiles      []string          `json:"profiles"`
+}
+
+type companionSlider struct {
+	Index   int      `json:"index"`
+	Name    string   `json:"name,omitempty"`
+	Targets []string `json:"targets"`
+	Value   *float32 `json:"value,omitempty"` // left out until the slider first moves
+}
+
+type companionSliderMoved struct {
+	Type   string  `json:"type"`
+	Slider int     `json:"slider"`
+	Value  float32 `json:"value"`
+}
+
+type companionSessions struct {
+	Type     string         `json:"type"`
+	Sessions []webUISession `json:"sessions"`
+}
+
+type companionError struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// companionPairing is a pairing waiting for the user to type the code into their phone
+type companionPairing struct {
+	id       string
+	device   string
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+// companion lets phone apps find deej on the LAN, pair with it, and then show and move its sliders and
+// session volumes over a WebSocket on top of the HTTP server
+type companion struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	upgrader websocket.Upgrader
+
+	lock         sync.Mutex
+	clients      map[*companionClient]struct{}
+	pairing      *companionPairing
+	sliderValues map[int]float32
+}
+
+type companionClient struct {
+	conn      *websocket.Conn
+	send      chan interface{}
+	device    string
+	tokenHash string
+
+	lock         sync.Mutex
+	lastSessions string // as last sent, to skip repeating it
+}
+
+func newCompanion(deej *Deej, logger *zap.SugaredLogger) *companion {
+	logger = logger.Named("companion")
+
+	cp := &companion{
+		deej:         deej,
+		logger:       logger,
+		clients:      make(map[*companionClient]struct{}),
+		sliderValues: make(map[int]float32),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkLocalOrigin,
+		},
+	}
+
+	logger.Debug("Created companion instance")
+
+	return cp
+}
+
+// initialize registers the endpoints with the HTTP server and subscribes to the events pushed to phones
+func (cp *companion) initialize() {
+	// pairing is how phones get credentials in the first place, and the WebSocket checks them itself
+	cp.deej.http.handleOwnAuth("POST "+companionPairPath, http.HandlerFunc(cp.servePair))
+	cp.deej.http.handleOwnAuth("POST "+companionConfirmPath, http.HandlerFunc(cp.serveConfirm))
+	cp.deej.http.handleOwnAuth("GET "+companionWebSocketPath, http.HandlerFunc(cp.serveWebSocket))
+	cp.deej.http.handle("GET "+companionDevicesPath, http.HandlerFunc(cp.serveDevices))
+	cp.deej.http.handle("DELETE "+companionDevicesPath+"/{device}", http.HandlerFunc(cp.serveUnpair))
+	cp.deej.http.onShutdown(cp.disconnectAll)
+
+	cp.deej.http.describe("companion", func() string {
+		if !cp.deej.config.Companion.Enabled {
+			return ""
+		}
+
+		return strconv.Itoa(companionProtocolVersion)
+	})
+
+	cp.setupEventRelays()
+	cp.setupOnConfigReload()
+}
+
+// start warns if phones won't be able to reach the HTTP API
+func (cp *companion) start() {
+	httpInfo := cp.deej.config.HTTPInfo
+
+	if cp.deej.config.Companion.Enabled && (!httpInfo.Enabled || !httpInfo.AllowRemote) {
+		cp.logger.Warn("Companion apps need http_api enabled with allow_remote, phones won't be able to connect")
+	}
+}
+
+func (cp *companion) setupOnConfigReload() {
+	configReloadedChannel := cp.deej.events.configReloaded.subscribe()
+
+	cp.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				if !cp.deej.config.Companion.Enabled {
+					cp.disconnectAll()
+				}
+
+				cp.start()
+			}
+		}
+	})
+}
+
+func (cp *companion) setupEventRelays() {
+	sliderEventsChannel := cp.deej.events.sliderMoved.subscribe()
+	configReloadedChannel := cp.deej.events.configReloaded.subscribe()
+	connectionChannel := cp.deej.events.connectionChanged.subscribe()
+	sessionChangesChannel := cp.deej.events.sessionsChanged.subscribe()
+	volumeChangesChannel := cp.deej.events.volumeChanged.subscribe()
+
+	cp.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(companionPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case event := <-sliderEventsChannel:
+				cp.lock.Lock()
+				cp.sliderValues[event.SliderID] = event.PercentValue
+				cp.lock.Unlock()
+
+				cp.broadcast(companionSliderMoved{
+					Type:   companionMessageSlider,
+					Slider: event.SliderID,
+					Value:  event.PercentValue,
+				})
+
+			case <-configReloadedChannel:
+				cp.broadcast(cp.layout())
+
+			case <-connectionChannel:
+				cp.broadcast(cp.layout())
+
+			case <-sessionChangesChannel:
+				cp.broadcastSessions()
+
+			case <-volumeChangesChannel:
+				cp.broadcastSessions()
+
+			case <-ticker.C:
+				cp.broadcastSessions()
+			}
+		}
+	})
+}
+
+// servePair starts pairing a phone, showing the user a code to type into it
+func (cp *companion) servePair(w http.ResponseWriter, r *http.Request) {
+	var request companionPairRequest
+	if !cp.decodeRequest(w, r, &request) {
+		return
+	}
+
+	device := strings.TrimSpace(request.Device)
+	if device == "" {
+		device = companionDefaultDevice
+	}
+
+	if len(device) > companionMaxDeviceName {
+		http.Error(w, "device name is too long", http.StatusBadRequest)
+		return
+	}
+
+	code, err := rand.Int(rand.Reader, big.NewInt(companionPairingCode))
+	if err != nil {
+		http.Error(w, "failed to generate pairing code", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := companionRandomString()
+	if err != nil {
+		http.Error(w, "failed to generate pairing", http.StatusInternalServerError)
+		return
+	}
+
+	cp.lock.Lock()
+
+	// one at a time, so nobody on the network can bury the user in pairing notifications
+	if cp.pairing != nil && time.Now().Before(cp.pairing.expires) {
+		cp.lock.Unlock()
+		http.Error(w, "another pairing is in progress", http.StatusConflict)
+		return
+	}
+
+	cp.pairing = &companionPairing{
+		id:      id,
+		device:  device,
+		code:    fmt.Sprintf("%06d", code.Int64()),
+		expires: time.Now().Add(companionPairingTimeout),
+	}
+
+	pairingCode := cp.pairing.code
+	cp.lock.Unlock()
+
+	cp.logger.Infow("Phone asked to pair", "device", device, "remote", r.RemoteAddr)
+	cp.deej.notifier.Notify(tr("notify.companionPair", "device", device),
+		tr("notify.companionPairMessage", "code", pairingCode))
+
+	cp.writeJSON(w, companionPairReply{Pairing: id, ExpiresIn: int(companionPairingTimeout.Seconds())})
+}
+
+// serveConfirm finishes pairing a phone if it sent the right code, giving it a token to connect with
+func (cp *companion) serveConfirm(w http.ResponseWriter, r *http.Request) {
+	var request companionConfirmRequest
+	if !cp.decodeRequest(w, r, &request) {
+		return
+	}
+
+	cp.lock.Lock()
+
+	pairing := cp.pairing
+	if pairing == nil || pairing.id != request.Pairing {
+		cp.lock.Unlock()
+		http.Error(w, "unknown pairing", http.StatusNotFound)
+		return
+	}
+
+	if time.Now().After(pairing.expires) {
+		cp.pairing = nil
+		cp.lock.Unlock()
+		http.Error(w, "pairing expired", http.StatusGone)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pairing.code), []byte(request.Code)) != 1 {
+		pairing.attempts++
+		if pairing.attempts >= companionPairingAttempts {
+			cp.pairing = nil
+		}
+
+		cp.lock.Unlock()
+		http.Error(w, "wrong code", http.StatusForbidden)
+		return
+	}
+
+	cp.pairing = nil
+	cp.lock.Unlock()
+
+	token, err := companionRandomString()
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	// only the hash is kept, so the internal config doesn't hold anything a phone could connect with
+	devices := cp.deej.config.CompanionDevices()
+	devices[companionTokenHash(token)] = pairing.device
+
+	if err := cp.deej.config.SaveCompanionDevices(devices); err != nil {
+		cp.logger.Warnw("Failed to save paired phone", "error", err)
+		http.Error(w, "failed to save pairing", http.StatusInternalServerError)
+		return
+	}
+
+	cp.logger.Infow("Paired phone", "device", pairing.device)
+
+	cp.writeJSON(w, companionConfirmReply{Token: token, Name: cp.deej.http.instanceName()})
+}
+
+// serveDevices lists the paired phones, for this computer only
+func (cp *companion) serveDevices(w http.ResponseWriter, r *http.Request) {
+	if !requestFromLoopback(r) || !checkLocalOrigin(r) {
+		http.Error(w, "paired devices can only be listed from this computer", http.StatusForbidden)
+		return
+	}
+
+	reply := companionDevicesReply{Devices: []string{}}
+	for _, device := range cp.deej.config.CompanionDevices() {
+		reply.Devices = append(reply.Devices, device)
+	}
+
+	sort.Strings(reply.Devices)
+
+	cp.writeJSON(w, reply)
+}
+
+// serveUnpair forgets every phone paired under the given name, disconnecting them
+func (cp *companion) serveUnpair(w http.ResponseWriter, r *http.Request) {
+	if !requestFromLoopback(r) || !checkLocalOrigin(r) {
+		http.Error(w, "devices can only be unpaired from this computer", http.StatusForbidden)
+		return
+	}
+
+	device := r.PathValue("device")
+	devices := cp.deej.config.CompanionDevices()
+	removed := make(map[string]bool)
+
+	for tokenHash, name := range devices {
+		if strings.EqualFold(name, device) {
+			delete(devices, tokenHash)
+			removed[tokenHash] = true
+		}
+	}
+
+	if len(removed) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := cp.deej.config.SaveCompanionDevices(devices); err != nil {
+		cp.logger.Warnw("Failed to save paired phones", "error", err)
+		http.Error(w, "failed to unpair", http.StatusInternalServerError)
+		return
+	}
+
+	cp.logger.Infow("Unpaired phone", "device", device)
+
+	cp.lock.Lock()
+	for client := range cp.clients {
+		if removed[client.tokenHash] {
+			client.conn.Close()
+		}
+	}
+	cp.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveWebSocket checks the phone's token, upgrades the connection and handles commands until it disconnects
+func (cp *companion) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !cp.deej.config.Companion.Enabled {
+		http.Error(w, errCompanionDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	token := bearerToken(r.Header.Get("Authorization"))
+	tokenHash := companionTokenHash(token)
+
+	device, paired := cp.deej.config.CompanionDevices()[tokenHash]
+	if token == "" || !paired {
+		http.Error(w, "pair with deej first", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := cp.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		cp.logger.Debugw("Failed to upgrade companion connection", "error", err)
+		return
+	}
+
+	conn.SetReadLimit(companionMaxMessageSize)
+
+	client := &companionClient{
+		conn:      conn,
+		send:      make(chan interface{}, companionClientBufferSize),
+		device:    device,
+		tokenHash: tokenHash,
+	}
+
+	cp.lock.Lock()
+	cp.clients[client] = struct{}{}
+	cp.lock.Unlock()
+
+	cp.logger.Infow("Phone connected", "device", device, "remote", r.RemoteAddr)
+
+	util.Go(cp.deej.handlePanic, client.writeLoop)
+
+	defer func() {
+		cp.lock.Lock()
+		delete(cp.clients, client)
+		cp.lock.Unlock()
+
+		close(client.send)
+		conn.Close()
+
+		cp.logger.Infow("Phone disconnected", "device", device, "remote", r.RemoteAddr)
+	}()
+
+	client.enqueue(cp.layout())
+	client.enqueueSessionsIfChanged(cp.sessions())
+
+	for {
+		var command companionCommand
+		if err := conn.ReadJSON(&command); err != nil {
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) {
+				client.enqueue(companionError{Type: companionMessageError, Error: "invalid JSON"})
+				continue
+			}
+
+			return
+		}
+
+		// successful commands show up through the regular updates, so only errors are answered
+		if err := cp.handleCommand(command); err != nil {
+			client.enqueue(companionError{Type: companionMessageError, ID: command.ID, Error: err.Error()})
+		}
+	}
+}
+
+func (cp *companion) handleCommand(command companionCommand) error {
+	switch command.Type {
+	case companionCommandMoveSlider:
+		if command.Slider == nil || *command.Slider < 0 {
+			return errors.New("slider is required")
+		}
+
+		if command.Value == nil || *command.Value < 0 || *command.Value > 1 {
+			return errCompanionInvalidValue
+		}
+
+		// moves go through exactly like a move of one of the board's sliders
+		cp.deej.serial.notifySliderMove(SliderMoveEvent{SliderID: *command.Slider, PercentValue: cp.deej.config.normalizeSliderValue(*command.Value)})
+
+		return nil
+
+	case companionCommandSetVolume:
+		if command.Target == "" {
+			return errCompanionMissingTarget
+		}
+
+		if command.Value == nil || *command.Value < 0 || *command.Value > 1 {
+			return errCompanionInvalidValue
+		}
+
+		adjusted, err := cp.deej.sessions.setTargetVolume(command.Target, *command.Value)
+		if err != nil {
+			return err
+		}
+
+		if len(adjusted) == 0 {
+			return errCompanionTargetUnknown
+		}
+
+		cp.broadcastSessions()
+
+		return nil
+
+	case companionCommandSetMute:
+		if command.Target == "" {
+			return errCompanionMissingTarget
+		}
+
+		if command.Mute == nil {
+			return errors.New("mute is required")
+		}
+
+		adjusted, err := cp.deej.sessions.setTargetMute(command.Target, *command.Mute)
+		if err != nil {
+			return err
+		}
+
+		if len(adjusted) == 0 {
+			return errCompanionTargetUnknown
+		}
+
+		cp.broadcastSessions()
+
+		return nil
+
+	case companionCommandSetProfile:
+		if command.Profile == "" {
+			return errors.New("profile is required")
+		}
+
+		cp.logger.Debugw("Switching profile via companion app", "profile", command.Profile)
+
+		// phones are sent the new layout through the config reload that follows
+		return cp.deej.config.ActivateProfile(command.Profile)
+	}
+
+	return fmt.Errorf("unknown command: %q", command.Type)
+}
+
+// layout describes the sliders of the active profile, along with the last known position of each
+func (cp *companion) layout() companionLayout {
+	layout := companionLayout{
+		Type:          companionMessageLayout,
+		Name:          cp.deej.http.instanceName(),
+		Version:       companionProtocolVersion,
+		Connected:     cp.deej.serial.Connected(),
+		Sliders:       []companionSlider{},
+		ActiveProfile: cp.deej.config.ActiveProfile,
+		Profiles:      []string{DefaultProfileName},
+	}
+
+	for name := range cp.deej.config.Profiles {
+		layout.Profiles = append(layout.Profiles, name)
+	}
+
+	sort.Strings(layout.Profiles[1:])
+
+	targets := sliderMapContents(cp.deej.config.SliderMapping)
+
+	cp.lock.Lock()
+	indexes := make(map[int]bool)
+	for sliderIdx := range cp.sliderValues {
+		indexes[sliderIdx] = true
+	}
+	for sliderIdx := range targets {
+		indexes[sliderIdx] = true
+	}
+
+	for sliderIdx := range indexes {
+		slider := companionSlider{
+			Index:   sliderIdx,
+			Name:    cp.deej.config.SliderNames[sliderIdx],
+			Targets: targets[sliderIdx],
+		}
+
+		if slider.Targets == nil {
+			slider.Targets = []string{}
+		}
+
+		if value, ok := cp.sliderValues[sliderIdx]; ok {
+			slider.Value = &value
+		}
+
+		layout.Sliders = append(layout.Sliders, slider)
+	}
+	cp.lock.Unlock()
+
+	sort.Slice(layout.Sliders, func(i, j int) bool {
+		return layout.Sliders[i].Index < layout.Sliders[j].Index
+	})
+
+	return layout
+}
+
+// sessions encodes the session list once, since it's compared against what each phone was sent last
+func (cp *companion) sessions() json.RawMessage {
+	sessions := companionSessions{Type: companionMessageSessions, Sessions: []webUISession{}}
+
+	for _, session := range cp.deej.sessions.snapshot() {
+		sessions.Sessions = append(sessions.Sessions, webUISession{
+			Key:         session.Key(),
+			DisplayName: sessionDisplayName(session),
+			Icon:        sessionIconURL(session),
+			Volume:      session.GetVolume(),
+			Muted:       sessionIsMuted(session),
+		})
+	}
+
+	sort.Slice(sessions.Sessions, func(i, j int) bool {
+		return sessions.Sessions[i].Key < sessions.Sessions[j].Key
+	})
+
+	encoded, err := json.Marshal(sessions)
+	if err != nil {
+		cp.logger.Debugw("Failed to encode sessions", "error", err)
+		return nil
+	}
+
+	return encoded
+}
+
+func (cp *companion) broadcast(message interface{}) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	for client := range cp.clients {
+		client.enqueue(message)
+	}
+}
+
+// broadcastSessions sends the session list to every phone whose copy of it is out of date
+func (cp *companion) broadcastSessions() {
+	cp.lock.Lock()
+	connected := len(cp.clients) > 0
+	cp.lock.Unlock()
+
+	// reading every session's volume isn't free, so don't bother while no phone is listening
+	if !connected {
+		return
+	}
+
+	sessions := cp.sessions()
+
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	for client := range cp.clients {
+		client.enqueueSessionsIfChanged(sessions)
+	}
+}
+
+func (cp *companion) disconnectAll() {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	for client := range cp.clients {
+		client.conn.Close()
+	}
+}
+
+// decodeRequest reads the JSON body of a pairing request, answering it with an error if that fails
+func (cp *companion) decodeRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if !cp.deej.config.Companion.Enabled {
+		http.Error(w, errCompanionDisabled.Error(), http.StatusForbidden)
+		return false
+	}
+
+	// requiring JSON forces browsers into a CORS preflight, which we never approve
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "expected application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, companionMaxMessageSize)).Decode(request); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func (cp *companion) writeJSON(w http.ResponseWriter, reply interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		cp.logger.Debugw("Failed to write companion reply", "error", err)
+	}
+}
+
+func (c *companionClient) writeLoop() {
+	for message := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(companionWriteTimeout))
+
+		if err := c.conn.WriteJSON(message); err != nil {
+			c.conn.Close()
+
+			// keep draining until the reader notices the closed connection and closes the channel
+			for range c.send {
+			}
+
+			return
+		}
+	}
+}
+
+// enqueue queues a message for sending, dropping it if the phone has fallen too far behind
+func (c *companionClient) enqueue(message interface{}) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *companionClient) enqueueSessionsIfChanged(sessions json.RawMessage) {
+	if sessions == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if string(sessions) == c.lastSessions {
+		return
+	}
+
+	if c.enqueue(sessions) {
+		c.lastSessions = string(sessions)
+	}
+}
+
+// companionRandomString returns a random string that's hard enough to guess to serve as a token
+func companionRandomString() (string, error) {
+	buf := make([]byte, companionTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func companionTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
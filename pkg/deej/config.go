@@ -1,14 +1,23 @@
 package deej
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"github.com/thoas/go-funk"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 
 	"github.com/omriharel/deej/pkg/deej/util"
 )
@@ -16,24 +25,447 @@ import (
 // CanonicalConfig provides centralized access to configuration fields
 type CanonicalConfig struct {
 	SliderMapping       *sliderMap
-	ConnectionInfo      ConnectionInfo
+	SliderNames         map[int]string      // as written in the config, for sliders that have one
+	DisabledSliders     map[int]bool        // sliders whose data is ignored
+	Aliases             map[string][]string // friendly names for targets, by (lowercase) name
+	ConnectionInfo      ConnectionInfo      // of the first device
+	Devices             []DeviceInfo
 	InvertSliders       bool
+	BinaryProtocol      bool // whether boards that offer to send binary frames instead of text lines may do so
+	Keepalive           bool // whether boards are pinged regularly, so ones that stop answering get disconnected
+	MatchChildProcesses bool // whether helper processes can be targeted by the name of the app that started them
+	NotifyUnmapped      bool // whether to announce new apps no slider controls, offering to bind them
+	UnmappedDigest      UnmappedDigestInfo
+	RestoreSliders      bool // whether to put sliders back where they were when deej last ran, until the board says otherwise
+	FollowSliders       bool // whether apps that start are set to their slider's position right away
 	NoiseReductionLevel string
+	HighResolution      bool // whether slider values keep 0.1% steps instead of being cut down to whole percents
+	MaxUpdateRate       int  // slider updates per second, or 0 for no limit
+	SliderSafety        SliderSafetyInfo
+	SliderFilter        SliderFilterConfig
+	GRPCInfo            GRPCInfo
+	HTTPInfo            HTTPInfo
+	Companion           CompanionInfo
+	ForwardSliders      map[int]SliderForward // sliders that move another deej instance's sliders, by local index
+	OSCInfo             OSCInfo
+	OBSInfo             OBSInfo
+	DiscordInfo         DiscordInfo
+	Equalizer           EqualizerInfo
+	Hotkeys             []HotkeyConfig
+	ButtonMapping       map[int]ActionConfig
+	Ducking             DuckingInfo
+	FadeOut             FadeOutInfo
+	Acceleration        AccelerationInfo
+	ChatMix             ChatMixInfo
+	VUMeterInfo         VUMeterInfo
+	VolumeFeedback      bool
+	Idle                IdleInfo
+	Rules               []VolumeRule
+	SerialCapture       SerialCaptureInfo
+	Telemetry           TelemetryInfo
+	CrashReports        CrashReportInfo
+	TrayIcon            TrayIconInfo
+	Editor              string // to open the config and reports with, instead of the default one
+	Language            string // of the tray menu and notifications, as found among deej's translations
 
-	logger             *zap.SugaredLogger
-	notifier           Notifier
-	stopWatcherChannel chan struct{}
+	// ExecCommands holds the commands exec: targets and the exec.run action refer to, by (lowercase) name.
+	// Each command is the program followed by its arguments.
+	ExecCommands map[string][]string
 
-	reloadConsumers []chan bool
+	// ScriptPath points to an optional Starlark script with custom slider logic
+	ScriptPath string
+
+	// Plugins lists the plugin executables to start along with deej
+	Plugins []string
+
+	// Presets holds saved volumes to restore in one go, by (lowercase) preset name and then by target.
+	// Volumes are between 0 and 1, though they're written in percent.
+	Presets map[string]map[string]float32
+
+	// SystemRoles holds the media.role values of the streams the system target controls on Linux, where
+	// PulseAudio plays each system sound as a stream of its own instead of grouping them into one session
+	SystemRoles []string
+
+	// DefaultVolumes holds the volume to set newly launched apps to, by target
+	DefaultVolumes map[string]float32
+
+	// SafetyCaps holds the highest volume each target may ever be set to, by target, no matter who sets it
+	SafetyCaps map[string]float32
+
+	// MissingTargets holds what to do when a slider moves while a target has no session, by (lowercase) target.
+	// Targets without one refresh the sessions, in case the app just started.
+	MissingTargets map[string]MissingTargetPolicy
+
+	// Profiles holds alternative slider mappings by (lowercase) name. While one is active,
+	// it replaces SliderMapping entirely.
+	Profiles          map[string]*sliderMap
+	ActiveProfile     string
+	baseSliderMapping *sliderMap
+
+	logger   *zap.SugaredLogger
+	notifier Notifier
+
+	events *eventBus
 
 	userConfig     *viper.Viper
 	internalConfig *viper.Viper
+	internalLock   sync.Mutex // held while writing the internal config, which several components save to
+
+	includedFiles []string // the absolute paths of the files config.yaml includes, as of the last load
+	includeLock   sync.Mutex
 }
 
 // ConnectionInfo groups serial port settings
 type ConnectionInfo struct {
 	COMPort  string
+	DeviceID string // the board's USB vendor and product ID or serial number. if set, its port is used instead of COMPort
 	BaudRate int
+	DataBits int    // 5 to 8
+	StopBits int    // 1 or 2
+	Parity   string // "none", "odd" or "even"
+
+	// what to set the DTR and RTS lines to once the port is open. Many Arduinos reset when DTR is raised
+	DTR SerialLineState
+	RTS SerialLineState
+}
+
+// SerialLineState is what deej sets a serial control line to after opening a port
+type SerialLineState int
+
+// SerialLineDefault leaves the line as the OS left it when opening the port
+const (
+	SerialLineDefault SerialLineState = iota
+	SerialLineHigh
+	SerialLineLow
+)
+
+// rawSerialParameters are the serial settings that can be given at the top level, and overridden per device
+type rawSerialParameters struct {
+	DataBits int    `mapstructure:"data_bits"`
+	StopBits int    `mapstructure:"stop_bits"`
+	Parity   string `mapstructure:"parity"`
+	DTR      *bool  `mapstructure:"dtr"`
+	RTS      *bool  `mapstructure:"rts"`
+}
+
+// DeviceInfo groups the settings of one board, when deej is connected to several
+type DeviceInfo struct {
+	ConnectionInfo
+
+	// SliderOffset is added to the index of the board's sliders and buttons, so boards don't share slider numbers
+	SliderOffset int
+
+	// SliderMaxValue is the raw value the board sends for a slider all the way up, e.g. 100 or 4095 for
+	// firmwares that don't use the Arduino's 10-bit range. 0 means the default, 1023
+	SliderMaxValue int
+}
+
+// sliderMaxValue returns the raw value the board sends for a slider all the way up
+func (info DeviceInfo) sliderMaxValue() int {
+	if info.SliderMaxValue <= 0 {
+		return defaultSliderMaxValue
+	}
+
+	return info.SliderMaxValue
+}
+
+// SliderSafetyInfo groups settings that keep glitchy readings, e.g. from a loose wire, from jumping volumes around.
+// Both are fractions of a slider's full range, where 0 turns them off.
+type SliderSafetyInfo struct {
+	// MaxStep is the furthest a slider moves per reading, so bigger moves are spread over the next few readings
+	MaxStep float32
+
+	// SpikeThreshold is how far a slider has to jump in one reading for the jump to need confirming by the next one
+	SpikeThreshold float32
+}
+
+// SliderFilterInfo groups settings that smooth out readings from noisy potentiometers. Both are fractions of
+// a slider's full range, where 0 turns them off.
+type SliderFilterInfo struct {
+	// Smoothing is how much of the previous value each reading keeps, as an exponential moving average.
+	// Higher values are steadier but slower to follow the slider
+	Smoothing float32
+
+	// Hysteresis is how far a slider has to move from where it last settled before it counts as moving again
+	Hysteresis float32
+}
+
+func (info SliderFilterInfo) enabled() bool {
+	return info.Smoothing > 0 || info.Hysteresis > 0
+}
+
+// SliderFilterConfig holds the slider filter settings for all sliders, along with ones for specific sliders
+type SliderFilterConfig struct {
+	SliderFilterInfo
+
+	// Sliders overrides the settings above, by slider index
+	Sliders map[int]SliderFilterInfo
+}
+
+// forSlider returns the filter settings of a slider
+func (cfg SliderFilterConfig) forSlider(sliderIdx int) SliderFilterInfo {
+	if info, ok := cfg.Sliders[sliderIdx]; ok {
+		return info
+	}
+
+	return cfg.SliderFilterInfo
+}
+
+// GRPCInfo groups settings for the gRPC control API
+type GRPCInfo struct {
+	Enabled     bool
+	Address     string
+	AllowRemote bool
+	Token       string // required from clients on other machines, if set
+	TLS         TLSInfo
+}
+
+// HTTPInfo groups settings for the HTTP/WebSocket server used by integrations such as the Stream Deck plugin
+type HTTPInfo struct {
+	Enabled     bool
+	Address     string
+	AllowRemote bool
+	Token       string // required from clients on other machines, if set
+	TLS         TLSInfo
+
+	// Metrics enables the Prometheus /metrics endpoint
+	Metrics bool
+
+	// VirtualSliders turns the web UI's sliders into on-screen ones that move like the board's own
+	VirtualSliders bool
+
+	// Advertise announces the API on the LAN over mDNS, so companion apps and other machines find it without
+	// typing in an address. Name is what it's announced as, instead of the host name.
+	Advertise bool
+	Name      string
+}
+
+// TLSInfo groups the TLS settings of a network API. Without a certificate of the user's own, a self-signed one is
+// generated and shared by every API, for clients to pin by its fingerprint.
+type TLSInfo struct {
+	Enabled  bool
+	CertFile string
+	KeyFile  string
+}
+
+// SliderForward sends a slider's moves to another deej instance, e.g. so one board controls both a gaming and a
+// streaming PC. The other instance moves one of its own sliders to match, through its HTTP API.
+type SliderForward struct {
+	Address     string // host:port of the other instance's HTTP API
+	Slider      int    // the other instance's slider to move
+	Token       string // its http_api.token, if it requires one
+	Fingerprint string // its TLS certificate's fingerprint, if it's served over TLS
+}
+
+// CompanionInfo groups settings for phone companion apps, which connect through the HTTP server
+type CompanionInfo struct {
+	Enabled bool
+}
+
+// OSCInfo groups settings for the OSC bridge
+type OSCInfo struct {
+	Enabled       bool
+	ListenAddress string
+	SendAddress   string
+}
+
+// VUMeterInfo groups settings for sending level meter data to the board
+type VUMeterInfo struct {
+	Enabled bool
+
+	// Rate is how many times per second to send meter data
+	Rate int
+}
+
+// FadeOutInfo groups settings for the fade.out action, which fades every mapped app out, e.g. when the doorbell rings
+type FadeOutInfo struct {
+	// Duration is how long fading out, and back in, takes
+	Duration time.Duration
+
+	// Restore is whether triggering the action again fades the apps back in, rather than fading out anew
+	Restore bool
+}
+
+// MissingTargetPolicy says what happens when a slider moves while one of its targets has no session, such as
+// an app that isn't running yet
+type MissingTargetPolicy struct {
+	Action string // refresh, ignore, warn, buffer or launch
+
+	// Launch is the program the launch action starts, followed by its arguments
+	Launch []string
+}
+
+// UnmappedDigestInfo groups settings for the digest of apps no slider controls that have been playing audio
+type UnmappedDigestInfo struct {
+	Enabled  bool
+	Interval time.Duration // between digests
+}
+
+// AccelerationInfo groups settings for turning encoders and jog wheels faster to take bigger volume steps. It
+// applies to volume.up and volume.down actions and to Stream Deck dials.
+type AccelerationInfo struct {
+	Enabled bool
+
+	// Curve is how steps grow between SlowRate and FastRate: linear, quadratic or cubic
+	Curve string
+
+	// MaxMultiplier is how many times bigger steps get at FastRate and above
+	MaxMultiplier float64
+
+	// steps per second below which steps keep their size, and from which they're MaxMultiplier times bigger
+	SlowRate float64
+	FastRate float64
+}
+
+// IdleInfo groups settings for telling the board when no audio has played for a while, e.g. to dim its LEDs
+type IdleInfo struct {
+	Enabled bool
+
+	// Minutes is how long all sessions have to be silent before the board is put to sleep
+	Minutes int
+}
+
+// SerialCaptureInfo groups settings for recording raw serial traffic, for diagnosing protocol problems
+type SerialCaptureInfo struct {
+	Enabled bool
+
+	// Minutes is how much of the most recent traffic to export
+	Minutes int
+}
+
+// TelemetryInfo groups settings for recording slider moves and volume changes to CSV files, to analyze them later
+type TelemetryInfo struct {
+	Enabled bool
+
+	// KeepDays is how many days of recordings to keep, or 0 to keep them all
+	KeepDays int
+}
+
+// CrashReportInfo groups settings for sending crash reports to a Sentry-compatible service
+type CrashReportInfo struct {
+	// DSN identifies the project to report to, as given by the service
+	DSN string
+
+	// Upload sends reports as soon as deej crashes, instead of only when asked to from the tray
+	Upload bool
+}
+
+// TrayIconInfo groups settings for the tray icon's look
+type TrayIconInfo struct {
+	// Style is one of the trayIconStyle* values
+	Style string
+
+	// File replaces the built-in icon, whatever the OS theme
+	File string
+
+	// LightThemeFile and DarkThemeFile replace the built-in icon while the OS uses a light or dark theme.
+	// They take precedence over File.
+	LightThemeFile string
+	DarkThemeFile  string
+}
+
+// DuckingInfo groups settings for lowering some targets while another one plays audio
+type DuckingInfo struct {
+	// When lists the targets whose audio triggers ducking
+	When []string `mapstructure:"when"`
+
+	// Lower lists the targets that are lowered while ducking
+	Lower []string `mapstructure:"lower"`
+
+	// By is how much to lower by, as a fraction of the targets' volume
+	By float32 `mapstructure:"by"`
+
+	// ReleaseMS is how long it takes to restore the lowered targets, in milliseconds
+	ReleaseMS int `mapstructure:"release_ms"`
+
+	// Threshold is the peak level above which a target counts as playing audio
+	Threshold float32 `mapstructure:"threshold"`
+}
+
+func (info DuckingInfo) enabled() bool {
+	return len(info.When) > 0 && len(info.Lower) > 0
+}
+
+// ChatMixInfo groups settings for the game/chat mix, where one slider balances game audio against chat like the
+// chat mix dial on many headsets, and another optionally controls master
+type ChatMixInfo struct {
+	Game []string
+	Chat []string
+
+	// MixSlider balances the two, with game audio towards 0 and chat towards 100
+	MixSlider int
+
+	// MasterSlider controls master, or is -1 to leave the mapping of every other slider alone
+	MasterSlider int
+
+	// LEDs tells the board where the mix is, so builds with LEDs next to the mix slider can show it
+	LEDs bool
+}
+
+func (info ChatMixInfo) enabled() bool {
+	return len(info.Game) > 0 && len(info.Chat) > 0
+}
+
+// apply maps the mix and master sliders, taking over from whatever they're mapped to in mapping
+func (info ChatMixInfo) apply(mapping *sliderMap) {
+	if !info.enabled() {
+		return
+	}
+
+	mapping.set(info.MixSlider, []string{chatMixTarget})
+
+	if info.MasterSlider >= 0 {
+		mapping.set(info.MasterSlider, []string{masterSessionName})
+	}
+}
+
+// OBSInfo groups settings for the OBS Studio integration
+type OBSInfo struct {
+	Enabled  bool
+	Address  string
+	Password string
+
+	// SceneProfiles maps (lowercase) OBS scene names to the profile to activate when they go live
+	SceneProfiles map[string]string
+}
+
+func (info OBSInfo) sameConnection(other OBSInfo) bool {
+	return info.Enabled == other.Enabled && info.Address == other.Address && info.Password == other.Password
+}
+
+// DiscordInfo groups settings for the Discord integration. Discord only lets apps registered on its developer
+// portal control it, so users register their own and give deej its credentials.
+type DiscordInfo struct {
+	Enabled      bool
+	ClientID     string
+	ClientSecret string
+}
+
+func (info DiscordInfo) sameConnection(other DiscordInfo) bool {
+	return info == other
+}
+
+// DiscordToken is what Discord gave deej to act on the user's behalf, kept so they only approve deej once
+type DiscordToken struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// EqualizerInfo groups settings for controlling a system-wide equalizer through eq: targets
+type EqualizerInfo struct {
+	// ConfigFile is the Equalizer APO config file deej writes to (Windows), or empty for the default one
+	ConfigFile string
+
+	// LADSPASink is the name of the PulseAudio LADSPA sink whose controls deej sets (Linux)
+	LADSPASink string
+
+	// MinGain and MaxGain are the gains in dB at the bottom and top of a slider
+	MinGain float64
+	MaxGain float64
+
+	// Bands maps (lowercase) band names to their center frequency in Hz (Equalizer APO),
+	// or to the index of the LADSPA control they set (PulseAudio)
+	Bands map[string]float64
 }
 
 const (
@@ -46,13 +478,157 @@ const (
 
 	configType              = "yaml"
 	configKeySliderMapping  = "slider_mapping"
+	configKeySliderNames    = "sliders"
+	configKeyDisabled       = "disabled_sliders"
+	configKeyAliases        = "aliases"
 	configKeyInvertSliders  = "invert_sliders"
+	configKeyMatchChildren  = "match_child_processes"
+	configKeyBinaryProtocol = "binary_protocol"
+	configKeyKeepalive      = "keepalive"
+	configKeyNotifyUnmapped = "notify_unmapped_sessions"
+	configKeyDigestEnabled  = "unmapped_digest.enabled"
+	configKeyDigestMinutes  = "unmapped_digest.interval_minutes"
+	configKeyRestoreSliders = "restore_slider_values"
+	configKeyFollowSliders  = "new_sessions_follow_sliders"
+	configKeySystemRoles    = "system_sound_roles"
+	configKeyLastSliders    = "last_slider_values"    // in the internal config
+	configKeyDiscordAccess  = "discord_access_token"  // in the internal config
+	configKeyDiscordRefresh = "discord_refresh_token" // in the internal config
+	configKeyCompanionDevs  = "companion_devices"     // in the internal config
 	configKeyCOMPort        = "com_port"
 	configKeyBaudRate       = "baud_rate"
+	configKeyDeviceID       = "device_id"
+	configKeyDataBits       = "data_bits"
+	configKeyStopBits       = "stop_bits"
+	configKeyParity         = "parity"
+	configKeyDTR            = "dtr"
+	configKeyRTS            = "rts"
+	configKeyDevices        = "devices"
 	configKeyNoiseReduction = "noise_reduction"
+	configKeyMaxUpdateRate  = "max_update_rate_hz"
+	configKeySliderMax      = "slider_max_value"
+	configKeyHighRes        = "high_resolution_volume"
+	configKeySafetyMaxStep  = "slider_safety.max_step"
+	configKeySafetySpike    = "slider_safety.spike_threshold"
+	configKeySliderFilter   = "slider_filter"
+	configKeyGRPCEnabled    = "grpc_api.enabled"
+	configKeyGRPCAddress    = "grpc_api.address"
+	configKeyGRPCRemote     = "grpc_api.allow_remote"
+	configKeyGRPCToken      = "grpc_api.token"
+	configKeyGRPCTLS        = "grpc_api.tls"
+	configKeyGRPCTLSCert    = "grpc_api.tls_cert"
+	configKeyGRPCTLSKey     = "grpc_api.tls_key"
+	configKeyHTTPEnabled    = "http_api.enabled"
+	configKeyHTTPAddress    = "http_api.address"
+	configKeyHTTPRemote     = "http_api.allow_remote"
+	configKeyHTTPToken      = "http_api.token"
+	configKeyHTTPTLS        = "http_api.tls"
+	configKeyHTTPTLSCert    = "http_api.tls_cert"
+	configKeyHTTPTLSKey     = "http_api.tls_key"
+	configKeyHTTPMetrics    = "http_api.metrics"
+	configKeyHTTPVirtual    = "http_api.virtual_sliders"
+	configKeyHTTPAdvertise  = "http_api.advertise"
+	configKeyHTTPName       = "http_api.name"
+	configKeyCompanionOn    = "companion.enabled"
+	configKeyForwardSlider  = "forward_slider"
+	configKeyOSCEnabled     = "osc.enabled"
+	configKeyOSCListen      = "osc.listen_address"
+	configKeyOSCSend        = "osc.send_address"
+	configKeyOBSEnabled     = "obs.enabled"
+	configKeyOBSAddress     = "obs.address"
+	configKeyOBSPassword    = "obs.password"
+	configKeyOBSScenes      = "obs.scene_profiles"
+	configKeyDiscordEnabled = "discord.enabled"
+	configKeyDiscordClient  = "discord.client_id"
+	configKeyDiscordSecret  = "discord.client_secret"
+	configKeyEQConfigFile   = "equalizer.config_file"
+	configKeyEQLADSPASink   = "equalizer.ladspa_sink"
+	configKeyEQMinGain      = "equalizer.min_gain"
+	configKeyEQMaxGain      = "equalizer.max_gain"
+	configKeyEQBands        = "equalizer.bands"
+	configKeyProfiles       = "profiles"
+	configKeyPresets        = "presets"
+	configKeyDefaults       = "defaults"
+	configKeySafetyCaps     = "safety_caps"
+	configKeyMissingTargets = "missing_targets"
+	configKeyHotkeys        = "hotkeys"
+	configKeyButtonMapping  = "button_mapping"
+	configKeyDucking        = "duck"
+	configKeyFadeDuration   = "fade_out.duration_ms"
+	configKeyFadeRestore    = "fade_out.restore"
+	configKeyAccelEnabled   = "encoder_acceleration.enabled"
+	configKeyAccelCurve     = "encoder_acceleration.curve"
+	configKeyAccelMax       = "encoder_acceleration.max_multiplier"
+	configKeyAccelSlowRate  = "encoder_acceleration.slow_rate"
+	configKeyAccelFastRate  = "encoder_acceleration.fast_rate"
+	configKeyChatMix        = "chat_mix"
+	configKeyVUMeterEnabled = "vu_meter.enabled"
+	configKeyVUMeterRate    = "vu_meter.rate"
+	configKeyVolumeFeedback = "volume_feedback"
+	configKeyIdleEnabled    = "idle.enabled"
+	configKeyIdleMinutes    = "idle.minutes"
+	configKeyRules          = "rules"
+	configKeyCaptureEnabled = "serial_capture.enabled"
+	configKeyCaptureMins    = "serial_capture.minutes"
+	configKeyTelemetryOn    = "telemetry.enabled"
+	configKeyTelemetryDays  = "telemetry.keep_days"
+	configKeyCrashDSN       = "crash_reports.dsn"
+	configKeyCrashUpload    = "crash_reports.upload"
+	configKeyEditor         = "editor"
+	configKeyLanguage       = "language"
+	configKeyInclude        = "include"
+	configKeyTrayIconStyle  = "tray_icon.style"
+	configKeyTrayIconFile   = "tray_icon.file"
+	configKeyTrayIconLight  = "tray_icon.light_theme_file"
+	configKeyTrayIconDark   = "tray_icon.dark_theme_file"
+	configKeyExecCommands   = "exec_commands"
+	configKeyScript         = "script"
+	configKeyPlugins        = "plugins"
+
+	defaultCOMPort        = "COM7"
+	defaultBaudRate       = 9600
+	defaultDataBits       = 8
+	defaultStopBits       = 1
+	defaultSliderMaxValue = 1023 // the Arduino's 10-bit ADC
+	defaultParity         = "none"
+	defaultDeviceOffset   = 100 // between the slider numbers of consecutive devices, unless configured
+	defaultHTTPAddress    = "127.0.0.1:7532"
+	defaultOSCListenAddr  = "127.0.0.1:9000"
+	defaultOSCSendAddr    = "127.0.0.1:9001"
+	defaultOBSAddress     = "localhost:4455"
+	defaultEQMinGain      = -12.0
+	defaultEQMaxGain      = 12.0
+	defaultDuckBy         = 0.5
+	defaultDuckReleaseMS  = 800
+	defaultDuckThreshold  = 0.01
+	defaultFadeDurationMS = 3000
+	defaultAccelMax       = 4.0
+	defaultAccelSlowRate  = 5.0
+	defaultAccelFastRate  = 25.0
+	defaultVUMeterRate    = 10
+	defaultCaptureMins    = 5
+	defaultTelemetryDays  = 30
+	defaultIdleMinutes    = 10
+	defaultDigestMinutes  = 60
+)
+
+const (
+	// slider values are kept to whole percents
+	volumeSteps = 100
 
-	defaultCOMPort  = "COM7"
-	defaultBaudRate = 9600
+	// with high_resolution_volume, they're kept to a tenth of a percent instead
+	highResolutionSteps = 1000
+
+	// and noise_reduction's thresholds shrink by this much, so the default one lets half a percent through
+	highResolutionNoiseScale = 5
+)
+
+const (
+	// DefaultGRPCAddress is the address the gRPC control API listens on unless configured otherwise
+	DefaultGRPCAddress = "127.0.0.1:7531"
+
+	// DefaultProfileName refers to the top-level slider_mapping, as opposed to one of the named profiles
+	DefaultProfileName = "default"
 )
 
 var internalConfigPath = path.Join(".", logDirectory)
@@ -64,15 +640,15 @@ var defaultSliderMapping = func() *sliderMap {
 	return mapping
 }()
 
-// NewConfig initializes the configuration manager
-func NewConfig(logger *zap.SugaredLogger, notifier Notifier) (*CanonicalConfig, error) {
+// NewConfig initializes the configuration manager, which publishes reloads to events
+func NewConfig(logger *zap.SugaredLogger, notifier Notifier, events *eventBus) (*CanonicalConfig, error) {
 	logger = logger.Named("config")
 
 	cc := &CanonicalConfig{
-		logger:             logger,
-		notifier:           notifier,
-		reloadConsumers:    make([]chan bool, 0),
-		stopWatcherChannel: make(chan struct{}),
+		ActiveProfile: DefaultProfileName,
+		logger:        logger,
+		notifier:      notifier,
+		events:        events,
 	}
 
 	cc.initializeViperInstances()
@@ -86,8 +662,52 @@ func (cc *CanonicalConfig) initializeViperInstances() {
 	cc.userConfig = initializeViper(userConfigName, userConfigPath, map[string]interface{}{
 		configKeySliderMapping:  map[string][]string{},
 		configKeyInvertSliders:  false,
+		configKeyBinaryProtocol: false,
+		configKeyKeepalive:      false,
+		configKeyMatchChildren:  false,
+		configKeyNotifyUnmapped: false,
+		configKeyDigestEnabled:  false,
+		configKeyDigestMinutes:  defaultDigestMinutes,
+		configKeyRestoreSliders: false,
+		configKeyFollowSliders:  true,
+		configKeySystemRoles:    []string{"event", "notification"},
+		configKeyMaxUpdateRate:  0,
+		configKeySliderMax:      defaultSliderMaxValue,
+		configKeyHighRes:        false,
 		configKeyCOMPort:        defaultCOMPort,
 		configKeyBaudRate:       defaultBaudRate,
+		configKeyDataBits:       defaultDataBits,
+		configKeyStopBits:       defaultStopBits,
+		configKeyParity:         defaultParity,
+		configKeyGRPCEnabled:    false,
+		configKeyGRPCAddress:    DefaultGRPCAddress,
+		configKeyGRPCRemote:     false,
+		configKeyHTTPEnabled:    false,
+		configKeyHTTPAddress:    defaultHTTPAddress,
+		configKeyHTTPRemote:     false,
+		configKeyHTTPAdvertise:  false,
+		configKeyCompanionOn:    false,
+		configKeyOSCEnabled:     false,
+		configKeyOSCListen:      defaultOSCListenAddr,
+		configKeyOSCSend:        defaultOSCSendAddr,
+		configKeyOBSEnabled:     false,
+		configKeyOBSAddress:     defaultOBSAddress,
+		configKeyDiscordEnabled: false,
+		configKeyEQMinGain:      defaultEQMinGain,
+		configKeyEQMaxGain:      defaultEQMaxGain,
+		configKeyFadeDuration:   defaultFadeDurationMS,
+		configKeyFadeRestore:    true,
+		configKeyAccelEnabled:   false,
+		configKeyAccelCurve:     accelerationCurveLinear,
+		configKeyAccelMax:       defaultAccelMax,
+		configKeyAccelSlowRate:  defaultAccelSlowRate,
+		configKeyAccelFastRate:  defaultAccelFastRate,
+		configKeyVUMeterRate:    defaultVUMeterRate,
+		configKeyCaptureMins:    defaultCaptureMins,
+		configKeyTelemetryDays:  defaultTelemetryDays,
+		configKeyIdleMinutes:    defaultIdleMinutes,
+		configKeyTrayIconStyle:  trayIconStyleAuto,
+		configKeyLanguage:       autoLanguage,
 	})
 	cc.internalConfig = initializeViper(internalConfigName, internalConfigPath, nil)
 }
@@ -130,14 +750,13 @@ func (cc *CanonicalConfig) readUserConfig() error {
 	if err := cc.userConfig.ReadInConfig(); err != nil {
 		return cc.handleConfigError("user config", err)
 	}
-	return nil
+	return cc.mergeIncludes()
 }
 
 // handleMissingConfig notifies the user of missing configuration
 func (cc *CanonicalConfig) handleMissingConfig() {
 	cc.logger.Warnw("Configuration file not found", "path", userConfigFilepath)
-	cc.notifier.Notify("Missing configuration!", fmt.Sprintf(
-		"Ensure %s exists in the same directory as deej.", userConfigFilepath))
+	cc.notifier.Notify(tr("notify.configMissing"), tr("notify.configMissingMessage", "path", userConfigFilepath))
 }
 
 // handleConfigError processes errors during config file loading
@@ -145,36 +764,1432 @@ func (cc *CanonicalConfig) handleConfigError(configName string, err error) error
 	cc.logger.Warnw("Failed to load configuration", "config", configName, "error", err)
 
 	if strings.Contains(err.Error(), "yaml:") {
-		cc.notifier.Notify("Invalid configuration format!",
-			"Ensure the YAML file is properly formatted.")
+		cc.notifier.Notify(tr("notify.configInvalid"), tr("notify.configInvalidMessage"))
 	} else {
-		cc.notifier.Notify("Error loading configuration!", "Check logs for more details.")
+		cc.notifier.Notify(tr("notify.configError"), tr("notify.configErrorMessage"))
 	}
 	return fmt.Errorf("read %s: %w", configName, err)
 }
 
 // populateFromVipers reads configuration fields into structured fields
 func (cc *CanonicalConfig) populateFromVipers() error {
-	cc.SliderMapping = sliderMapFromConfigs(
+	cc.SliderNames = cc.readSliderNames()
+	cc.ChatMix = cc.readChatMix()
+	cc.baseSliderMapping = sliderMapFromConfigs(
 		cc.userConfig.GetStringMapStringSlice(configKeySliderMapping),
 		cc.internalConfig.GetStringMapStringSlice(configKeySliderMapping),
+		cc.sliderIdxsByName(),
 	)
-	cc.ConnectionInfo = ConnectionInfo{
-		COMPort:  cc.userConfig.GetString(configKeyCOMPort),
-		BaudRate: cc.validateBaudRate(cc.userConfig.GetInt(configKeyBaudRate)),
+	cc.ChatMix.apply(cc.baseSliderMapping)
+	cc.populateProfiles()
+	cc.Presets = cc.readPresets()
+	cc.DefaultVolumes = cc.readDefaultVolumes()
+	cc.SafetyCaps = cc.readSafetyCaps()
+	cc.MissingTargets = cc.readMissingTargets()
+	cc.DisabledSliders = cc.readDisabledSliders()
+	cc.Aliases = cc.readAliases()
+
+	if cc.ChatMix.enabled() {
+		cc.Aliases[chatMixGameAlias] = cc.ChatMix.Game
+		cc.Aliases[chatMixChatAlias] = cc.ChatMix.Chat
 	}
+	cc.Devices = cc.readDevices()
+	cc.ConnectionInfo = cc.Devices[0].ConnectionInfo
 	cc.InvertSliders = cc.userConfig.GetBool(configKeyInvertSliders)
+	cc.BinaryProtocol = cc.userConfig.GetBool(configKeyBinaryProtocol)
+	cc.Keepalive = cc.userConfig.GetBool(configKeyKeepalive)
+	cc.MatchChildProcesses = cc.userConfig.GetBool(configKeyMatchChildren)
+	cc.NotifyUnmapped = cc.userConfig.GetBool(configKeyNotifyUnmapped)
+	cc.UnmappedDigest = UnmappedDigestInfo{
+		Enabled:  cc.userConfig.GetBool(configKeyDigestEnabled),
+		Interval: cc.validateDigestInterval(cc.userConfig.GetInt(configKeyDigestMinutes)),
+	}
+	cc.RestoreSliders = cc.userConfig.GetBool(configKeyRestoreSliders)
+	cc.FollowSliders = cc.userConfig.GetBool(configKeyFollowSliders)
+	cc.SystemRoles = cc.userConfig.GetStringSlice(configKeySystemRoles)
 	cc.NoiseReductionLevel = cc.userConfig.GetString(configKeyNoiseReduction)
+	cc.HighResolution = cc.userConfig.GetBool(configKeyHighRes)
+	cc.MaxUpdateRate = cc.validateMaxUpdateRate(cc.userConfig.GetInt(configKeyMaxUpdateRate))
+	cc.SliderSafety = SliderSafetyInfo{
+		MaxStep:        cc.validateSafetyFraction(configKeySafetyMaxStep),
+		SpikeThreshold: cc.validateSafetyFraction(configKeySafetySpike),
+	}
+	cc.SliderFilter = cc.readSliderFilter()
+	cc.GRPCInfo = GRPCInfo{
+		Enabled:     cc.userConfig.GetBool(configKeyGRPCEnabled),
+		Address:     cc.userConfig.GetString(configKeyGRPCAddress),
+		AllowRemote: cc.userConfig.GetBool(configKeyGRPCRemote),
+		Token:       cc.userConfig.GetString(configKeyGRPCToken),
+		TLS: TLSInfo{
+			Enabled:  cc.userConfig.GetBool(configKeyGRPCTLS),
+			CertFile: cc.userConfig.GetString(configKeyGRPCTLSCert),
+			KeyFile:  cc.userConfig.GetString(configKeyGRPCTLSKey),
+		},
+	}
+	cc.HTTPInfo = HTTPInfo{
+		Enabled:     cc.userConfig.GetBool(configKeyHTTPEnabled),
+		Address:     cc.userConfig.GetString(configKeyHTTPAddress),
+		AllowRemote: cc.userConfig.GetBool(configKeyHTTPRemote),
+		Token:       cc.userConfig.GetString(configKeyHTTPToken),
+		TLS: TLSInfo{
+			Enabled:  cc.userConfig.GetBool(configKeyHTTPTLS),
+			CertFile: cc.userConfig.GetString(configKeyHTTPTLSCert),
+			KeyFile:  cc.userConfig.GetString(configKeyHTTPTLSKey),
+		},
+		Metrics: cc.userConfig.GetBool(configKeyHTTPMetrics),
+
+		VirtualSliders: cc.userConfig.GetBool(configKeyHTTPVirtual),
+		Advertise:      cc.userConfig.GetBool(configKeyHTTPAdvertise),
+		Name:           strings.TrimSpace(cc.userConfig.GetString(configKeyHTTPName)),
+	}
+	cc.Companion = CompanionInfo{
+		Enabled: cc.userConfig.GetBool(configKeyCompanionOn),
+	}
+	cc.ForwardSliders = cc.readForwardSliders()
+	cc.OSCInfo = OSCInfo{
+		Enabled:       cc.userConfig.GetBool(configKeyOSCEnabled),
+		ListenAddress: cc.userConfig.GetString(configKeyOSCListen),
+		SendAddress:   cc.userConfig.GetString(configKeyOSCSend),
+	}
+	cc.OBSInfo = OBSInfo{
+		Enabled:       cc.userConfig.GetBool(configKeyOBSEnabled),
+		Address:       cc.userConfig.GetString(configKeyOBSAddress),
+		Password:      cc.userConfig.GetString(configKeyOBSPassword),
+		SceneProfiles: cc.userConfig.GetStringMapString(configKeyOBSScenes),
+	}
+	cc.DiscordInfo = DiscordInfo{
+		Enabled:      cc.userConfig.GetBool(configKeyDiscordEnabled),
+		ClientID:     cc.userConfig.GetString(configKeyDiscordClient),
+		ClientSecret: cc.userConfig.GetString(configKeyDiscordSecret),
+	}
+	cc.Equalizer = cc.readEqualizer()
+
+	cc.Hotkeys = nil
+	if err := cc.userConfig.UnmarshalKey(configKeyHotkeys, &cc.Hotkeys); err != nil {
+		cc.logger.Warnw("Failed to parse hotkeys, ignoring them", "error", err)
+		cc.Hotkeys = nil
+	}
+
+	cc.ButtonMapping = cc.readButtonMapping()
+	cc.Ducking = cc.readDucking()
+	cc.FadeOut = FadeOutInfo{
+		Duration: cc.validateFadeDuration(cc.userConfig.GetInt(configKeyFadeDuration)),
+		Restore:  cc.userConfig.GetBool(configKeyFadeRestore),
+	}
+	cc.Acceleration = cc.readAcceleration()
+	cc.Rules = cc.readRules()
+	cc.VUMeterInfo = VUMeterInfo{
+		Enabled: cc.userConfig.GetBool(configKeyVUMeterEnabled),
+		Rate:    cc.validateVUMeterRate(cc.userConfig.GetInt(configKeyVUMeterRate)),
+	}
+
+	cc.VolumeFeedback = cc.userConfig.GetBool(configKeyVolumeFeedback)
+
+	cc.Idle = IdleInfo{
+		Enabled: cc.userConfig.GetBool(configKeyIdleEnabled),
+		Minutes: cc.userConfig.GetInt(configKeyIdleMinutes),
+	}
+
+	if cc.Idle.Minutes <= 0 {
+		cc.logger.Warnw("Invalid idle minutes specified, using default", "invalidValue", cc.Idle.Minutes, "defaultValue", defaultIdleMinutes)
+		cc.Idle.Minutes = defaultIdleMinutes
+	}
+
+	cc.SerialCapture = SerialCaptureInfo{
+		Enabled: cc.userConfig.GetBool(configKeyCaptureEnabled),
+		Minutes: cc.userConfig.GetInt(configKeyCaptureMins),
+	}
+
+	if cc.SerialCapture.Minutes <= 0 {
+		cc.SerialCapture.Minutes = defaultCaptureMins
+	}
+
+	cc.Telemetry = TelemetryInfo{
+		Enabled:  cc.userConfig.GetBool(configKeyTelemetryOn),
+		KeepDays: cc.userConfig.GetInt(configKeyTelemetryDays),
+	}
+
+	if cc.Telemetry.KeepDays < 0 {
+		cc.logger.Warnw("Invalid telemetry keep_days specified, using default", "invalidValue", cc.Telemetry.KeepDays, "defaultValue", defaultTelemetryDays)
+		cc.Telemetry.KeepDays = defaultTelemetryDays
+	}
+
+	cc.CrashReports = CrashReportInfo{
+		DSN:    cc.userConfig.GetString(configKeyCrashDSN),
+		Upload: cc.userConfig.GetBool(configKeyCrashUpload),
+	}
+
+	cc.TrayIcon = TrayIconInfo{
+		Style:          cc.validateTrayIconStyle(cc.userConfig.GetString(configKeyTrayIconStyle)),
+		File:           cc.userConfig.GetString(configKeyTrayIconFile),
+		LightThemeFile: cc.userConfig.GetString(configKeyTrayIconLight),
+		DarkThemeFile:  cc.userConfig.GetString(configKeyTrayIconDark),
+	}
+
+	cc.Editor = cc.userConfig.GetString(configKeyEditor)
+	cc.Language = cc.readLanguage()
+
+	cc.ExecCommands = make(map[string][]string)
+	for name := range cc.userConfig.GetStringMap(configKeyExecCommands) {
+		command := cc.userConfig.GetStringSlice(fmt.Sprintf("%s.%s", configKeyExecCommands, name))
+		if len(command) == 0 {
+			cc.logger.Warnw("Ignoring empty command", "name", name)
+			continue
+		}
+
+		cc.ExecCommands[name] = command
+	}
+
+	cc.ScriptPath = cc.userConfig.GetString(configKeyScript)
+	cc.Plugins = cc.userConfig.GetStringSlice(configKeyPlugins)
 
 	cc.logger.Debugw("Configuration populated successfully", "config", cc)
 	return nil
 }
 
-// validateBaudRate checks for a valid baud rate, returning a default if invalid
-func (cc *CanonicalConfig) validateBaudRate(baudRate int) int {
-	if baudRate > 0 {
-		return baudRate
+// readSliderNames reads the names given to sliders, skipping (and logging) ones that can't be used in slider_mapping
+func (cc *CanonicalConfig) readSliderNames() map[int]string {
+	names := make(map[int]string)
+	taken := make(map[string]bool)
+
+	for sliderKey, name := range cc.userConfig.GetStringMapString(configKeySliderNames) {
+		sliderIdx, err := strconv.Atoi(sliderKey)
+		if err != nil {
+			cc.logger.Warnw("Ignoring slider name for something that isn't a slider index", "slider", sliderKey, "name", name)
+			continue
+		}
+
+		// a name that's a number would be mistaken for another slider's index
+		if _, err := strconv.Atoi(name); err != nil && name != "" && !taken[strings.ToLower(name)] {
+			names[sliderIdx] = name
+			taken[strings.ToLower(name)] = true
+			continue
+		}
+
+		cc.logger.Warnw("Ignoring slider name that is empty, a number or already taken", "slider", sliderIdx, "name", name)
 	}
-	cc.logger.Warnw("Invalid baud rate specified, using default", "invalidValue", baudRate, "defaultValue", defaultBaudRate)
-	return defaultBaudRate
-}
\ No newline at end of file
+
+	return names
+}
+
+// sliderIdxsByName maps lowercase slider names to their index
+func (cc *CanonicalConfig) sliderIdxsByName() map[string]int {
+	sliderIdxs := make(map[string]int, len(cc.SliderNames))
+	for sliderIdx, name := range cc.SliderNames {
+		sliderIdxs[strings.ToLower(name)] = sliderIdx
+	}
+
+	return sliderIdxs
+}
+
+// readDisabledSliders reads the sliders to ignore, by index or name
+func (cc *CanonicalConfig) readDisabledSliders() map[int]bool {
+	disabled := make(map[int]bool)
+	sliderIdxs := cc.sliderIdxsByName()
+
+	for _, sliderKey := range cc.userConfig.GetStringSlice(configKeyDisabled) {
+		sliderIdx, ok := parseSliderKey(sliderKey, sliderIdxs)
+		if !ok {
+			cc.logger.Warnw("Ignoring unknown slider in disabled sliders", "slider", sliderKey)
+			continue
+		}
+
+		disabled[sliderIdx] = true
+	}
+
+	return disabled
+}
+
+// readAliases reads the friendly names targets can be referred to by. Each alias stands for one or more
+// apps or deej.* targets, but not for other aliases, external targets or crossfades.
+func (cc *CanonicalConfig) readAliases() map[string][]string {
+	rawAliases := cc.userConfig.GetStringMap(configKeyAliases)
+	aliases := make(map[string][]string, len(rawAliases))
+
+	for name, value := range rawAliases {
+		if funk.ContainsString([]string{masterSessionName, systemSessionName, inputSessionName}, name) ||
+			strings.HasPrefix(name, specialTargetTransformPrefix) || strings.Contains(name, externalTargetSeparator) {
+			cc.logger.Warnw("Ignoring alias that clashes with a built-in target", "alias", name)
+			continue
+		}
+
+		// a single target is taken as is, since it can contain spaces (e.g. a device's full name)
+		var targets []string
+		if target, ok := value.(string); ok {
+			targets = []string{target}
+		} else {
+			targets = cc.userConfig.GetStringSlice(fmt.Sprintf("%s.%s", configKeyAliases, name))
+		}
+
+		aliases[name] = funk.FilterString(targets, func(target string) bool {
+			return target != ""
+		})
+	}
+
+	for name, targets := range aliases {
+		aliases[name] = funk.FilterString(targets, func(target string) bool {
+			_, isAlias := aliases[strings.ToLower(target)]
+			usable := !isAlias && !strings.Contains(target, externalTargetSeparator) &&
+				!crossfadeTargetPattern.MatchString(target)
+
+			if !usable {
+				cc.logger.Warnw("Ignoring alias target, aliases can only stand for apps and deej.* targets",
+					"alias", name, "target", target)
+			}
+
+			return usable
+		})
+	}
+
+	return aliases
+}
+
+// readPresets reads the saved volume presets, skipping (and logging) volumes that aren't between 0 and 100
+func (cc *CanonicalConfig) readPresets() map[string]map[string]float32 {
+	presets := make(map[string]map[string]float32)
+
+	for name := range cc.userConfig.GetStringMap(configKeyPresets) {
+		volumes := make(map[string]float32)
+
+		for target, value := range cc.userConfig.GetStringMap(fmt.Sprintf("%s.%s", configKeyPresets, name)) {
+			var percent float64
+			switch value := value.(type) {
+			case int:
+				percent = float64(value)
+			case float64:
+				percent = value
+			default:
+				percent = -1
+			}
+
+			if percent < 0 || percent > 100 {
+				cc.logger.Warnw("Ignoring invalid preset volume, use a number between 0 and 100",
+					"preset", name, "target", target, "volume", value)
+				continue
+			}
+
+			volumes[target] = float32(percent / 100)
+		}
+
+		presets[name] = volumes
+	}
+
+	return presets
+}
+
+// readDefaultVolumes reads the volumes new apps start at, skipping (and logging) volumes that aren't between 0 and 1
+func (cc *CanonicalConfig) readDefaultVolumes() map[string]float32 {
+	volumes := make(map[string]float32)
+
+	for target, value := range cc.userConfig.GetStringMap(configKeyDefaults) {
+		var volume float64
+		switch value := value.(type) {
+		case int:
+			volume = float64(value)
+		case float64:
+			volume = value
+		default:
+			volume = -1
+		}
+
+		if volume < 0 || volume > 1 {
+			cc.logger.Warnw("Ignoring invalid default volume, use a number between 0 and 1",
+				"target", target, "volume", value)
+			continue
+		}
+
+		volumes[target] = float32(volume)
+	}
+
+	return volumes
+}
+
+// readSafetyCaps reads the volume caps that protect against accidental full blast, skipping (and logging) caps
+// that aren't above 0 and at most 1
+func (cc *CanonicalConfig) readSafetyCaps() map[string]float32 {
+	caps := make(map[string]float32)
+
+	for target, value := range cc.userConfig.GetStringMap(configKeySafetyCaps) {
+		var limit float64
+		switch value := value.(type) {
+		case int:
+			limit = float64(value)
+		case float64:
+			limit = value
+		default:
+			limit = -1
+		}
+
+		if limit <= 0 || limit > 1 {
+			cc.logger.Warnw("Ignoring invalid safety cap, use a number above 0 and at most 1",
+				"target", target, "cap", value)
+			continue
+		}
+
+		caps[target] = float32(limit)
+	}
+
+	return caps
+}
+
+// readMissingTargets reads the policies for targets without a session, skipping (and logging) unknown actions.
+// A policy is either an action's name, or a map with a launch command for launching something other than the
+// target itself.
+func (cc *CanonicalConfig) readMissingTargets() map[string]MissingTargetPolicy {
+	policies := make(map[string]MissingTargetPolicy)
+
+	for target, value := range cc.userConfig.GetStringMap(configKeyMissingTargets) {
+		target = strings.ToLower(target)
+
+		var policy MissingTargetPolicy
+		switch value := value.(type) {
+		case string:
+			policy.Action = strings.ToLower(strings.TrimSpace(value))
+			if policy.Action == missingTargetLaunch {
+				policy.Launch = []string{target}
+			}
+		case map[string]interface{}:
+			policy.Action = missingTargetLaunch
+			policy.Launch = launchCommand(value[missingTargetLaunch])
+		}
+
+		if !missingTargetActions[policy.Action] {
+			cc.logger.Warnw("Ignoring invalid missing target policy, use refresh, ignore, warn, buffer or launch",
+				"target", target, "policy", value)
+			continue
+		}
+
+		if policy.Action == missingTargetLaunch && len(policy.Launch) == 0 {
+			cc.logger.Warnw("Ignoring missing target policy without a program to launch", "target", target)
+			continue
+		}
+
+		policies[target] = policy
+	}
+
+	return policies
+}
+
+// launchCommand reads a launch command written either as a single program or as a list of the program and its
+// arguments, returning nil for anything else
+func launchCommand(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		if strings.TrimSpace(value) == "" {
+			return nil
+		}
+
+		return []string{value}
+	case []interface{}:
+		command := make([]string, 0, len(value))
+		for _, arg := range value {
+			command = append(command, fmt.Sprint(arg))
+		}
+
+		return command
+	}
+
+	return nil
+}
+
+// readEqualizer reads the equalizer settings, skipping (and logging) bands without a valid frequency or control
+func (cc *CanonicalConfig) readEqualizer() EqualizerInfo {
+	info := EqualizerInfo{
+		ConfigFile: cc.userConfig.GetString(configKeyEQConfigFile),
+		LADSPASink: cc.userConfig.GetString(configKeyEQLADSPASink),
+		MinGain:    cc.userConfig.GetFloat64(configKeyEQMinGain),
+		MaxGain:    cc.userConfig.GetFloat64(configKeyEQMaxGain),
+		Bands:      make(map[string]float64),
+	}
+
+	if info.MinGain >= info.MaxGain {
+		cc.logger.Warnw("Invalid equalizer gain range specified, using default",
+			"minGain", info.MinGain, "maxGain", info.MaxGain,
+			"defaultMinGain", defaultEQMinGain, "defaultMaxGain", defaultEQMaxGain)
+		info.MinGain, info.MaxGain = defaultEQMinGain, defaultEQMaxGain
+	}
+
+	for name, value := range cc.userConfig.GetStringMap(configKeyEQBands) {
+		var band float64
+		switch value := value.(type) {
+		case int:
+			band = float64(value)
+		case float64:
+			band = value
+		default:
+			band = -1
+		}
+
+		if band < 0 || name == equalizerPreampName {
+			cc.logger.Warnw("Ignoring invalid equalizer band, use a frequency in Hz or a LADSPA control index",
+				"band", name, "value", value)
+			continue
+		}
+
+		info.Bands[name] = band
+	}
+
+	return info
+}
+
+// readDevices reads the devices list, falling back to the top-level com_port and connection settings
+// when there is none. It always returns at least one device.
+func (cc *CanonicalConfig) readDevices() []DeviceInfo {
+	var rawDevices []struct {
+		COMPort             string `mapstructure:"com_port"`
+		DeviceID            string `mapstructure:"device_id"`
+		BaudRate            int    `mapstructure:"baud_rate"`
+		SliderOffset        *int   `mapstructure:"slider_offset"`
+		SliderMaxValue      int    `mapstructure:"slider_max_value"`
+		rawSerialParameters `mapstructure:",squash"`
+	}
+
+	if err := cc.userConfig.UnmarshalKey(configKeyDevices, &rawDevices); err != nil {
+		cc.logger.Warnw("Failed to parse devices, using com_port and baud_rate instead", "error", err)
+		rawDevices = nil
+	}
+
+	// devices inherit the top-level connection settings, since boards usually share a sketch
+	base := cc.applySerialParameters(ConnectionInfo{
+		COMPort:  cc.userConfig.GetString(configKeyCOMPort),
+		DeviceID: cc.validateDeviceID(cc.userConfig.GetString(configKeyDeviceID)),
+		BaudRate: cc.validateBaudRate(cc.userConfig.GetInt(configKeyBaudRate)),
+		DataBits: defaultDataBits,
+		StopBits: defaultStopBits,
+		Parity:   defaultParity,
+	}, rawSerialParameters{
+		DataBits: cc.userConfig.GetInt(configKeyDataBits),
+		StopBits: cc.userConfig.GetInt(configKeyStopBits),
+		Parity:   cc.userConfig.GetString(configKeyParity),
+		DTR:      cc.optionalBool(configKeyDTR),
+		RTS:      cc.optionalBool(configKeyRTS),
+	})
+
+	baseMaxValue := cc.validateSliderMaxValue(cc.userConfig.GetInt(configKeySliderMax), defaultSliderMaxValue)
+
+	var devices []DeviceInfo
+
+	for idx, raw := range rawDevices {
+		deviceID := cc.validateDeviceID(raw.DeviceID)
+		if raw.COMPort == "" && deviceID == "" {
+			cc.logger.Warnw("Ignoring device without a COM port or device ID", "index", idx)
+			continue
+		}
+
+		info := base
+		info.COMPort = raw.COMPort
+		info.DeviceID = deviceID
+
+		if raw.BaudRate != 0 {
+			info.BaudRate = cc.validateBaudRate(raw.BaudRate)
+		}
+
+		offset := idx * defaultDeviceOffset
+		if raw.SliderOffset != nil {
+			offset = *raw.SliderOffset
+		}
+
+		maxValue := baseMaxValue
+		if raw.SliderMaxValue != 0 {
+			maxValue = cc.validateSliderMaxValue(raw.SliderMaxValue, baseMaxValue)
+		}
+
+		devices = append(devices, DeviceInfo{
+			ConnectionInfo: cc.applySerialParameters(info, raw.rawSerialParameters),
+			SliderOffset:   offset,
+			SliderMaxValue: maxValue,
+		})
+	}
+
+	if len(devices) == 0 {
+		return []DeviceInfo{{ConnectionInfo: base, SliderMaxValue: baseMaxValue}}
+	}
+
+	return devices
+}
+
+// validateSliderMaxValue checks a slider_max_value, which has to fit the 16 bits binary frames carry values in
+func (cc *CanonicalConfig) validateSliderMaxValue(maxValue int, fallback int) int {
+	if maxValue < 1 || maxValue > math.MaxUint16 {
+		cc.logger.Warnw("Invalid slider max value specified, using default value", "invalidValue", maxValue, "default", fallback)
+		return fallback
+	}
+
+	return maxValue
+}
+
+// applySerialParameters overrides the connection's settings with the ones given, keeping the connection's own
+// where they're missing or invalid
+func (cc *CanonicalConfig) applySerialParameters(info ConnectionInfo, raw rawSerialParameters) ConnectionInfo {
+	if raw.DataBits != 0 {
+		if raw.DataBits >= 5 && raw.DataBits <= 8 {
+			info.DataBits = raw.DataBits
+		} else {
+			cc.logger.Warnw("Invalid data bits specified, ignoring", "invalidValue", raw.DataBits, "port", info.COMPort)
+		}
+	}
+
+	if raw.StopBits != 0 {
+		if raw.StopBits == 1 || raw.StopBits == 2 {
+			info.StopBits = raw.StopBits
+		} else {
+			cc.logger.Warnw("Invalid stop bits specified, ignoring", "invalidValue", raw.StopBits, "port", info.COMPort)
+		}
+	}
+
+	if raw.Parity != "" {
+		switch parity := strings.ToLower(raw.Parity); parity {
+		case "none", "odd", "even":
+			info.Parity = parity
+		default:
+			cc.logger.Warnw("Invalid parity specified, ignoring", "invalidValue", raw.Parity, "port", info.COMPort)
+		}
+	}
+
+	if raw.DTR != nil {
+		info.DTR = serialLineState(*raw.DTR)
+	}
+
+	if raw.RTS != nil {
+		info.RTS = serialLineState(*raw.RTS)
+	}
+
+	return info
+}
+
+// optionalBool returns a user config value, or nil if it isn't set
+func (cc *CanonicalConfig) optionalBool(key string) *bool {
+	if !cc.userConfig.IsSet(key) {
+		return nil
+	}
+
+	value := cc.userConfig.GetBool(key)
+	return &value
+}
+
+func serialLineState(high bool) SerialLineState {
+	if high {
+		return SerialLineHigh
+	}
+
+	return SerialLineLow
+}
+
+// readButtonMapping reads button_mapping, skipping (and logging) entries that can't be used
+func (cc *CanonicalConfig) readButtonMapping() map[int]ActionConfig {
+	var rawMapping map[string]ActionConfig
+	if err := cc.userConfig.UnmarshalKey(configKeyButtonMapping, &rawMapping); err != nil {
+		cc.logger.Warnw("Failed to parse button mapping, ignoring it", "error", err)
+		return nil
+	}
+
+	mapping := make(map[int]ActionConfig, len(rawMapping))
+	for buttonIdxString, action := range rawMapping {
+		buttonIdx, err := strconv.Atoi(buttonIdxString)
+		if err != nil {
+			cc.logger.Warnw("Ignoring button mapping with invalid index", "index", buttonIdxString)
+			continue
+		}
+
+		if err := action.validate(); err != nil {
+			cc.logger.Warnw("Ignoring invalid button mapping", "button", buttonIdx, "error", err)
+			continue
+		}
+
+		mapping[buttonIdx] = action
+	}
+
+	return mapping
+}
+
+// readLanguage switches to the configured language, or the OS's with "auto"
+func (cc *CanonicalConfig) readLanguage() string {
+	configured := cc.userConfig.GetString(configKeyLanguage)
+	language := selectLanguage(configured)
+
+	if !strings.EqualFold(configured, autoLanguage) {
+		if _, ok := matchLanguage(configured); !ok {
+			cc.logger.Warnw("Ignoring unknown language, using English", "language", configured,
+				"available", availableLanguages())
+		}
+	}
+
+	return language
+}
+
+// readForwardSliders reads forward_slider, where each slider is forwarded either to "host:port", moving the same
+// slider on the other end, to "host:port/slider", or with a section of its own for more settings
+func (cc *CanonicalConfig) readForwardSliders() map[int]SliderForward {
+	forwards := make(map[int]SliderForward)
+	sliderIdxs := cc.sliderIdxsByName()
+
+	for sliderKey, value := range cc.userConfig.GetStringMap(configKeyForwardSlider) {
+		sliderIdx, ok := parseSliderKey(sliderKey, sliderIdxs)
+		if !ok || sliderIdx < 0 {
+			cc.logger.Warnw("Ignoring slider forward with invalid slider", "slider", sliderKey)
+			continue
+		}
+
+		forward := SliderForward{Slider: sliderIdx}
+
+		if address, ok := value.(string); ok {
+			forward.Address = address
+
+			if host, remoteSlider, found := strings.Cut(address, "/"); found {
+				remoteIdx, err := strconv.Atoi(remoteSlider)
+				if err != nil || remoteIdx < 0 {
+					cc.logger.Warnw("Ignoring slider forward with invalid remote slider", "slider", sliderKey, "address", address)
+					continue
+				}
+
+				forward.Address = host
+				forward.Slider = remoteIdx
+			}
+		} else {
+			var rawForward struct {
+				Address     string `mapstructure:"address"`
+				Slider      *int   `mapstructure:"slider"`
+				Token       string `mapstructure:"token"`
+				Fingerprint string `mapstructure:"fingerprint"`
+			}
+
+			if err := cc.userConfig.UnmarshalKey(configKeyForwardSlider+"."+sliderKey, &rawForward); err != nil {
+				cc.logger.Warnw("Ignoring unreadable slider forward", "slider", sliderKey, "error", err)
+				continue
+			}
+
+			forward.Address = rawForward.Address
+			forward.Token = rawForward.Token
+			forward.Fingerprint = rawForward.Fingerprint
+
+			if rawForward.Slider != nil {
+				forward.Slider = *rawForward.Slider
+			}
+		}
+
+		if _, _, err := net.SplitHostPort(forward.Address); err != nil || forward.Slider < 0 {
+			cc.logger.Warnw("Ignoring slider forward with invalid address", "slider", sliderKey, "address", forward.Address)
+			continue
+		}
+
+		forwards[sliderIdx] = forward
+	}
+
+	return forwards
+}
+
+// readDucking reads the duck section, filling in defaults for anything left out
+func (cc *CanonicalConfig) readDucking() DuckingInfo {
+	var ducking DuckingInfo
+	if err := cc.userConfig.UnmarshalKey(configKeyDucking, &ducking); err != nil {
+		cc.logger.Warnw("Failed to parse ducking settings, ignoring them", "error", err)
+		return DuckingInfo{}
+	}
+
+	if ducking.By <= 0 || ducking.By > 1 {
+		ducking.By = defaultDuckBy
+	}
+
+	if ducking.ReleaseMS <= 0 {
+		ducking.ReleaseMS = defaultDuckReleaseMS
+	}
+
+	if ducking.Threshold <= 0 {
+		ducking.Threshold = defaultDuckThreshold
+	}
+
+	return ducking
+}
+
+// readChatMix reads the chat_mix section. Its targets go through the same checks as aliases, since they're
+// handed out as the deej.game and deej.chat aliases.
+func (cc *CanonicalConfig) readChatMix() ChatMixInfo {
+	var rawChatMix struct {
+		Game   []string `mapstructure:"game"`
+		Chat   []string `mapstructure:"chat"`
+		Mix    string   `mapstructure:"mix"`
+		Master string   `mapstructure:"master"`
+		LEDs   *bool    `mapstructure:"leds"`
+	}
+
+	if err := cc.userConfig.UnmarshalKey(configKeyChatMix, &rawChatMix); err != nil {
+		cc.logger.Warnw("Failed to parse chat mix settings, ignoring them", "error", err)
+		return ChatMixInfo{}
+	}
+
+	usable := func(target string) bool {
+		ok := target != "" && !strings.Contains(target, externalTargetSeparator) &&
+			!crossfadeTargetPattern.MatchString(target)
+
+		if !ok && target != "" {
+			cc.logger.Warnw("Ignoring chat mix target, it can only hold apps and deej.* targets", "target", target)
+		}
+
+		return ok
+	}
+
+	chatMix := ChatMixInfo{
+		Game:         funk.FilterString(rawChatMix.Game, usable),
+		Chat:         funk.FilterString(rawChatMix.Chat, usable),
+		MasterSlider: -1,
+		LEDs:         rawChatMix.LEDs == nil || *rawChatMix.LEDs,
+	}
+
+	if !chatMix.enabled() {
+		if len(rawChatMix.Game) > 0 || len(rawChatMix.Chat) > 0 {
+			cc.logger.Warnw("Ignoring chat mix, it needs both game and chat targets")
+		}
+
+		return ChatMixInfo{}
+	}
+
+	sliderIdxs := cc.sliderIdxsByName()
+
+	mixSlider, ok := parseSliderKey(rawChatMix.Mix, sliderIdxs)
+	if !ok {
+		cc.logger.Warnw("Ignoring chat mix, its mix slider is missing or unknown", "slider", rawChatMix.Mix)
+		return ChatMixInfo{}
+	}
+
+	chatMix.MixSlider = mixSlider
+
+	if rawChatMix.Master != "" {
+		masterSlider, ok := parseSliderKey(rawChatMix.Master, sliderIdxs)
+		if !ok || masterSlider == mixSlider {
+			cc.logger.Warnw("Ignoring chat mix master slider, it's unknown or the same as the mix slider", "slider", rawChatMix.Master)
+		} else {
+			chatMix.MasterSlider = masterSlider
+		}
+	}
+
+	return chatMix
+}
+
+// readRules reads the scheduled volume rules, skipping (and logging) ones that can't be used
+func (cc *CanonicalConfig) readRules() []VolumeRule {
+	var rawRules []struct {
+		Name      string   `mapstructure:"name"`
+		Target    string   `mapstructure:"target"`
+		Targets   []string `mapstructure:"targets"`
+		After     string   `mapstructure:"after"`
+		Before    string   `mapstructure:"before"`
+		Days      []string `mapstructure:"days"`
+		MaxVolume *float32 `mapstructure:"max_volume"`
+		Mute      bool     `mapstructure:"mute"`
+	}
+
+	if err := cc.userConfig.UnmarshalKey(configKeyRules, &rawRules); err != nil {
+		cc.logger.Warnw("Failed to parse rules, ignoring them", "error", err)
+		return nil
+	}
+
+	var rules []VolumeRule
+
+	for idx, raw := range rawRules {
+		rule := VolumeRule{
+			Name:      raw.Name,
+			Targets:   raw.Targets,
+			Before:    24 * time.Hour,
+			MaxVolume: 1,
+			Mute:      raw.Mute,
+		}
+
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", idx)
+		}
+
+		if raw.Target != "" {
+			rule.Targets = append(rule.Targets, raw.Target)
+		}
+
+		if raw.MaxVolume != nil {
+			rule.MaxVolume = *raw.MaxVolume / 100
+		}
+
+		var err error
+		if raw.After != "" {
+			rule.After, err = parseTimeOfDay(raw.After)
+		}
+
+		if err == nil && raw.Before != "" {
+			rule.Before, err = parseTimeOfDay(raw.Before)
+		}
+
+		if err == nil {
+			rule.Days, err = parseRuleDays(raw.Days)
+		}
+
+		switch {
+		case err != nil:
+		case len(rule.Targets) == 0:
+			err = errors.New("rule needs a target")
+		case rule.MaxVolume < 0 || rule.MaxVolume > 1:
+			err = errors.New("max_volume must be between 0 and 100")
+		case rule.MaxVolume == 1 && !rule.Mute:
+			err = errors.New("rule needs max_volume or mute")
+		}
+
+		if err != nil {
+			cc.logger.Warnw("Ignoring invalid rule", "rule", rule.Name, "error", err)
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// populateProfiles reads the profiles section and re-applies the active profile, if it still exists
+func (cc *CanonicalConfig) populateProfiles() {
+	cc.Profiles = make(map[string]*sliderMap)
+
+	for name := range cc.userConfig.GetStringMap(configKeyProfiles) {
+		mappingKey := fmt.Sprintf("%s.%s.%s", configKeyProfiles, name, configKeySliderMapping)
+		cc.Profiles[name] = sliderMapFromConfigs(cc.userConfig.GetStringMapStringSlice(mappingKey), nil, cc.sliderIdxsByName())
+		cc.ChatMix.apply(cc.Profiles[name])
+	}
+
+	if _, ok := cc.Profiles[cc.ActiveProfile]; cc.ActiveProfile != DefaultProfileName && !ok {
+		cc.logger.Warnw("Active profile no longer exists, reverting to default", "profile", cc.ActiveProfile)
+		cc.ActiveProfile = DefaultProfileName
+	}
+
+	cc.applyActiveProfile()
+}
+
+func (cc *CanonicalConfig) applyActiveProfile() {
+	if profileMapping, ok := cc.Profiles[cc.ActiveProfile]; ok {
+		cc.SliderMapping = profileMapping
+	} else {
+		cc.SliderMapping = cc.baseSliderMapping
+	}
+}
+
+// ActivateProfile replaces the slider mapping with the named profile's and notifies subscribers.
+// Use DefaultProfileName to go back to the top-level slider_mapping.
+func (cc *CanonicalConfig) ActivateProfile(name string) error {
+	name = strings.ToLower(name)
+
+	if _, ok := cc.Profiles[name]; name != DefaultProfileName && !ok {
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+
+	if name == cc.ActiveProfile {
+		return nil
+	}
+
+	cc.ActiveProfile = name
+	cc.applyActiveProfile()
+
+	cc.logger.Infow("Activated profile", "profile", name, "sliderMapping", cc.SliderMapping)
+	cc.onConfigReloaded()
+
+	return nil
+}
+
+// SaveSliderMapping writes a new slider mapping for the named profile (or the top-level one, for DefaultProfileName)
+// to the user config file. Everything else in the file, comments included, is left as is. The file watcher picks
+// up the change and reloads the config as if it were edited by hand.
+func (cc *CanonicalConfig) SaveSliderMapping(profile string, mapping map[int][]string) error {
+	profile = strings.ToLower(profile)
+
+	if _, ok := cc.Profiles[profile]; profile != DefaultProfileName && !ok {
+		return fmt.Errorf("unknown profile: %s", profile)
+	}
+
+	err := editUserConfig(func(root *yaml.Node) error {
+		parent := root
+
+		// viper lowercases keys, so the profile may be spelled differently in the file
+		if profile != DefaultProfileName {
+			parent = yamlMappingValue(yamlMappingValue(parent, configKeyProfiles), profile)
+			if parent == nil || parent.Kind != yaml.MappingNode {
+				return fmt.Errorf("profile not found in config file: %s", profile)
+			}
+		}
+
+		setYAMLMappingValue(parent, configKeySliderMapping, sliderMappingNode(mapping, cc.SliderNames))
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	cc.logger.Infow("Saved slider mapping", "profile", profile, "sliderMapping", mapping)
+
+	return nil
+}
+
+// SavePreset writes the named volume preset to the user config file, replacing any preset of the same name.
+// Like SaveSliderMapping, it leaves the rest of the file as is and lets the file watcher reload the config.
+func (cc *CanonicalConfig) SavePreset(name string, volumes map[string]float32) error {
+	if name == "" || strings.Contains(name, ".") {
+		return fmt.Errorf("invalid preset name: %q", name)
+	}
+
+	err := editUserConfig(func(root *yaml.Node) error {
+		presets := yamlMappingValue(root, configKeyPresets)
+		if presets == nil || presets.Kind != yaml.MappingNode {
+			presets = &yaml.Node{Kind: yaml.MappingNode}
+			setYAMLMappingValue(root, configKeyPresets, presets)
+		}
+
+		setYAMLMappingValue(presets, name, presetNode(volumes))
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	cc.logger.Infow("Saved volume preset", "preset", name, "volumes", volumes)
+
+	return nil
+}
+
+// editUserConfig reads the user config file, lets edit change its top-level mapping and writes it back
+func editUserConfig(edit func(root *yaml.Node) error) error {
+	contents, err := os.ReadFile(userConfigFilepath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return fmt.Errorf("parse config file: %w", err)
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return errors.New("config file doesn't contain a YAML mapping")
+	}
+
+	if err := edit(document.Content[0]); err != nil {
+		return err
+	}
+
+	// match the default config's indentation
+	var updated bytes.Buffer
+	encoder := yaml.NewEncoder(&updated)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(&document); err != nil {
+		return fmt.Errorf("encode config file: %w", err)
+	}
+
+	if err := os.WriteFile(userConfigFilepath, updated.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	return nil
+}
+
+// setYAMLMappingValue replaces the value for a key in a YAML mapping, keeping the comment above it,
+// or adds the key at the end if it's not there yet
+func setYAMLMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	if existing := yamlMappingValue(node, key); existing != nil {
+		value.HeadComment = existing.HeadComment
+		*existing = *value
+		return
+	}
+
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// yamlMappingValue returns the value for a key in a YAML mapping, matching the key case-insensitively
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// sliderMappingNode builds a slider_mapping section the way the default config writes it: a single target
+// as a plain value, several as a list. Named sliders are keyed by their name.
+func sliderMappingNode(mapping map[int][]string, names map[int]string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	sliderIdxs := make([]int, 0, len(mapping))
+	for sliderIdx := range mapping {
+		sliderIdxs = append(sliderIdxs, sliderIdx)
+	}
+
+	sort.Ints(sliderIdxs)
+
+	for _, sliderIdx := range sliderIdxs {
+		targets := mapping[sliderIdx]
+		if len(targets) == 0 {
+			continue
+		}
+
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(sliderIdx)}
+		if name, ok := names[sliderIdx]; ok {
+			key = &yaml.Node{Kind: yaml.ScalarNode, Value: name}
+		}
+
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: targets[0]}
+		if len(targets) > 1 {
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, target := range targets {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: target})
+			}
+		}
+
+		node.Content = append(node.Content, key, value)
+	}
+
+	return node
+}
+
+// presetNode builds a volume preset the way it's written by hand: targets in order, with volumes in percent
+func presetNode(volumes map[string]float32) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	targets := make([]string, 0, len(volumes))
+	for target := range volumes {
+		targets = append(targets, target)
+	}
+
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: target},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(int(volumes[target]*100 + 0.5))})
+	}
+
+	return node
+}
+
+// validateBaudRate checks for a valid baud rate, returning a default if invalid
+func (cc *CanonicalConfig) validateBaudRate(baudRate int) int {
+	if baudRate > 0 {
+		return baudRate
+	}
+	cc.logger.Warnw("Invalid baud rate specified, using default", "invalidValue", baudRate, "defaultValue", defaultBaudRate)
+	return defaultBaudRate
+}
+
+// validateDeviceID normalizes a device ID, returning an empty one (so the COM port is used) if invalid
+func (cc *CanonicalConfig) validateDeviceID(deviceID string) string {
+	normalized, err := normalizeDeviceID(deviceID)
+	if err != nil {
+		cc.logger.Warnw("Invalid device ID specified, using the COM port instead", "error", err)
+		return ""
+	}
+
+	return normalized
+}
+
+// validateTrayIconStyle falls back to following the OS theme for unknown tray icon styles
+func (cc *CanonicalConfig) validateTrayIconStyle(style string) string {
+	style = strings.ToLower(style)
+
+	for _, known := range trayIconStyles {
+		if style == known {
+			return style
+		}
+	}
+
+	cc.logger.Warnw("Invalid tray icon style specified, using default", "invalidValue", style, "defaultValue", trayIconStyleAuto)
+	return trayIconStyleAuto
+}
+
+// validateVUMeterRate keeps the VU meter rate between once per second and the rate sessions are metered at
+func (cc *CanonicalConfig) validateVUMeterRate(rate int) int {
+	maxRate := int(time.Second / meterInterval)
+
+	if rate < 1 || rate > maxRate {
+		cc.logger.Warnw("Invalid VU meter rate specified, using default", "invalidValue", rate, "defaultValue", defaultVUMeterRate, "maxValue", maxRate)
+		return defaultVUMeterRate
+	}
+
+	return rate
+}
+
+// validateFadeDuration checks fade_out.duration_ms, where 0 fades out at once
+func (cc *CanonicalConfig) validateFadeDuration(durationMS int) time.Duration {
+	if durationMS < 0 {
+		cc.logger.Warnw("Invalid fade out duration specified, using default", "invalidValue", durationMS, "defaultValue", defaultFadeDurationMS)
+		durationMS = defaultFadeDurationMS
+	}
+
+	return time.Duration(durationMS) * time.Millisecond
+}
+
+// readAcceleration reads encoder_acceleration, falling back to the defaults for values that make no sense
+func (cc *CanonicalConfig) readAcceleration() AccelerationInfo {
+	info := AccelerationInfo{
+		Enabled:       cc.userConfig.GetBool(configKeyAccelEnabled),
+		Curve:         strings.ToLower(strings.TrimSpace(cc.userConfig.GetString(configKeyAccelCurve))),
+		MaxMultiplier: cc.userConfig.GetFloat64(configKeyAccelMax),
+		SlowRate:      cc.userConfig.GetFloat64(configKeyAccelSlowRate),
+		FastRate:      cc.userConfig.GetFloat64(configKeyAccelFastRate),
+	}
+
+	if _, ok := accelerationCurves[info.Curve]; !ok {
+		cc.logger.Warnw("Invalid acceleration curve specified, using default", "invalidValue", info.Curve, "defaultValue", accelerationCurveLinear)
+		info.Curve = accelerationCurveLinear
+	}
+
+	if info.MaxMultiplier < 1 {
+		cc.logger.Warnw("Invalid acceleration max multiplier specified, using default", "invalidValue", info.MaxMultiplier, "defaultValue", defaultAccelMax)
+		info.MaxMultiplier = defaultAccelMax
+	}
+
+	if info.SlowRate <= 0 || info.FastRate <= info.SlowRate {
+		cc.logger.Warnw("Invalid acceleration rates specified, using defaults",
+			"slowRate", info.SlowRate, "fastRate", info.FastRate,
+			"defaultSlowRate", defaultAccelSlowRate, "defaultFastRate", defaultAccelFastRate)
+
+		info.SlowRate = defaultAccelSlowRate
+		info.FastRate = defaultAccelFastRate
+	}
+
+	return info
+}
+
+// validateDigestInterval checks unmapped_digest.interval_minutes, which has to be at least a minute
+func (cc *CanonicalConfig) validateDigestInterval(minutes int) time.Duration {
+	if minutes < 1 {
+		cc.logger.Warnw("Invalid unmapped digest interval specified, using default", "invalidValue", minutes, "defaultValue", defaultDigestMinutes)
+		minutes = defaultDigestMinutes
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// validateMaxUpdateRate turns a negative update rate into no limit
+func (cc *CanonicalConfig) validateMaxUpdateRate(rate int) int {
+	if rate < 0 {
+		cc.logger.Warnw("Invalid max update rate specified, not limiting updates", "invalidValue", rate)
+		return 0
+	}
+
+	return rate
+}
+
+// validateSafetyFraction reads a slider_safety setting, turning it off unless it's a fraction of the slider's range
+func (cc *CanonicalConfig) validateSafetyFraction(key string) float32 {
+	value := cc.userConfig.GetFloat64(key)
+
+	if value < 0 || value >= 1 {
+		cc.logger.Warnw("Invalid slider safety setting specified, turning it off", "key", key, "invalidValue", value)
+		return 0
+	}
+
+	return float32(value)
+}
+
+// readSliderFilter reads the slider_filter section, whose top-level settings apply to every slider
+// not listed under its sliders (by index or name)
+func (cc *CanonicalConfig) readSliderFilter() SliderFilterConfig {
+	type rawFilter struct {
+		Smoothing  *float32 `mapstructure:"smoothing"`
+		Hysteresis *float32 `mapstructure:"hysteresis"`
+	}
+
+	var rawSliderFilter struct {
+		Smoothing  *float32             `mapstructure:"smoothing"`
+		Hysteresis *float32             `mapstructure:"hysteresis"`
+		Sliders    map[string]rawFilter `mapstructure:"sliders"`
+	}
+
+	if err := cc.userConfig.UnmarshalKey(configKeySliderFilter, &rawSliderFilter); err != nil {
+		cc.logger.Warnw("Failed to parse slider filter settings, ignoring them", "error", err)
+		return SliderFilterConfig{}
+	}
+
+	// settings left out of a slider's own section are taken from base
+	validate := func(raw rawFilter, base SliderFilterInfo, slider string) SliderFilterInfo {
+		info := base
+
+		if raw.Smoothing != nil {
+			info.Smoothing = *raw.Smoothing
+		}
+
+		if raw.Hysteresis != nil {
+			info.Hysteresis = *raw.Hysteresis
+		}
+
+		if info.Smoothing < 0 || info.Smoothing >= 1 {
+			cc.logger.Warnw("Invalid slider smoothing specified, turning it off", "slider", slider, "invalidValue", info.Smoothing)
+			info.Smoothing = 0
+		}
+
+		if info.Hysteresis < 0 || info.Hysteresis >= 1 {
+			cc.logger.Warnw("Invalid slider hysteresis specified, turning it off", "slider", slider, "invalidValue", info.Hysteresis)
+			info.Hysteresis = 0
+		}
+
+		return info
+	}
+
+	sliderFilter := SliderFilterConfig{
+		SliderFilterInfo: validate(rawFilter{rawSliderFilter.Smoothing, rawSliderFilter.Hysteresis}, SliderFilterInfo{}, "all"),
+		Sliders:          make(map[int]SliderFilterInfo),
+	}
+
+	sliderIdxs := cc.sliderIdxsByName()
+
+	for sliderKey, raw := range rawSliderFilter.Sliders {
+		sliderIdx, ok := parseSliderKey(sliderKey, sliderIdxs)
+		if !ok {
+			cc.logger.Warnw("Ignoring unknown slider in slider filter", "slider", sliderKey)
+			continue
+		}
+
+		sliderFilter.Sliders[sliderIdx] = validate(raw, sliderFilter.SliderFilterInfo, sliderKey)
+	}
+
+	return sliderFilter
+}
+
+// minSliderUpdateInterval returns how long to wait between slider updates, or 0 if they aren't limited
+func (cc *CanonicalConfig) minSliderUpdateInterval() time.Duration {
+	if cc.MaxUpdateRate <= 0 {
+		return 0
+	}
+
+	return time.Second / time.Duration(cc.MaxUpdateRate)
+}
+
+// normalizeSliderValue cuts a slider value down to the precision volumes are set with: whole percents, or tenths
+// of a percent with high_resolution_volume
+func (cc *CanonicalConfig) normalizeSliderValue(v float32) float32 {
+	if cc.HighResolution {
+		return util.QuantizeScalar(v, highResolutionSteps)
+	}
+
+	return util.QuantizeScalar(v, volumeSteps)
+}
+
+// sliderMoved returns whether a slider moved far enough from its old value to count, going by noise_reduction.
+// With high_resolution_volume, the noise reduction levels allow for proportionally finer moves.
+func (cc *CanonicalConfig) sliderMoved(old, new float32) bool {
+	threshold := util.SignificantDifferenceThreshold(cc.NoiseReductionLevel)
+	if cc.HighResolution {
+		threshold /= highResolutionNoiseScale
+	}
+
+	return util.DifferentBy(old, new, threshold)
+}
+
+// readInternalConfig loads the internal preferences file, if present
+func (cc *CanonicalConfig) readInternalConfig() error {
+	if err := cc.internalConfig.ReadInConfig(); err != nil {
+		return fmt.Errorf("read internal config: %w", err)
+	}
+	return nil
+}
+
+// LastSliderValues returns where each slider was when deej last shut down, by slider index
+func (cc *CanonicalConfig) LastSliderValues() map[int]float32 {
+	values := make(map[int]float32)
+
+	for key, raw := range cc.internalConfig.GetStringMap(configKeyLastSliders) {
+		sliderIdx, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fmt.Sprint(raw), 32)
+		if err != nil || value < 0 || value > 1 {
+			cc.logger.Debugw("Ignoring invalid saved slider value", "slider", sliderIdx, "value", raw)
+			continue
+		}
+
+		values[sliderIdx] = float32(value)
+	}
+
+	return values
+}
+
+// SaveSliderValues stores where each slider is in the internal config, for LastSliderValues to return next time
+func (cc *CanonicalConfig) SaveSliderValues(values map[int]float32) error {
+	raw := make(map[string]float32, len(values))
+	for sliderIdx, value := range values {
+		raw[strconv.Itoa(sliderIdx)] = value
+	}
+
+	return cc.saveInternal(map[string]interface{}{configKeyLastSliders: raw})
+}
+
+// DiscordToken returns the token the Discord integration saved last, if any
+func (cc *CanonicalConfig) DiscordToken() DiscordToken {
+	cc.internalLock.Lock()
+	defer cc.internalLock.Unlock()
+
+	return DiscordToken{
+		AccessToken:  cc.internalConfig.GetString(configKeyDiscordAccess),
+		RefreshToken: cc.internalConfig.GetString(configKeyDiscordRefresh),
+	}
+}
+
+// SaveDiscordToken stores a token from Discord in the internal config, for DiscordToken to return next time
+func (cc *CanonicalConfig) SaveDiscordToken(token DiscordToken) error {
+	return cc.saveInternal(map[string]interface{}{
+		configKeyDiscordAccess:  token.AccessToken,
+		configKeyDiscordRefresh: token.RefreshToken,
+	})
+}
+
+// CompanionDevices returns the phones paired with deej, as device names by the hash of their token
+func (cc *CanonicalConfig) CompanionDevices() map[string]string {
+	cc.internalLock.Lock()
+	defer cc.internalLock.Unlock()
+
+	return cc.internalConfig.GetStringMapString(configKeyCompanionDevs)
+}
+
+// SaveCompanionDevices stores the phones paired with deej in the internal config, replacing the previous ones
+func (cc *CanonicalConfig) SaveCompanionDevices(devices map[string]string) error {
+	return cc.saveInternal(map[string]interface{}{configKeyCompanionDevs: devices})
+}
+
+// saveInternal sets keys in the internal config and writes it out
+func (cc *CanonicalConfig) saveInternal(values map[string]interface{}) error {
+	cc.internalLock.Lock()
+	defer cc.internalLock.Unlock()
+
+	if err := util.EnsureDirExists(internalConfigPath); err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		cc.internalConfig.Set(key, value)
+	}
+
+	if err := cc.internalConfig.WriteConfigAs(path.Join(internalConfigPath, internalConfigFilepath)); err != nil {
+		return fmt.Errorf("write internal config: %w", err)
+	}
+
+	return nil
+}
+
+// Reload re-reads the configuration files and notifies subscribers on success
+func (cc *CanonicalConfig) Reload() error {
+	if err := cc.Load(); err != nil {
+		cc.logger.Warnw("Failed to reload config file", "error", err)
+		return fmt.Errorf("reload config: %w", err)
+	}
+
+	cc.logger.Info("Reloaded config successfully")
+	cc.onConfigReloaded()
+
+	return nil
+}
+
+// onConfigReloaded notifies all subscribers that the config was reloaded
+func (cc *CanonicalConfig) onConfigReloaded() {
+	cc.logger.Debug("Notifying consumers about configuration reload")
+	cc.events.configReloaded.publish(struct{}{})
+}
@@ -0,0 +1,91 @@
+package deej
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// replaced with the computer's name in include paths, so one synced config can pull in per-machine overrides
+const includeHostnamePlaceholder = "{hostname}"
+
+// mergeIncludes merges the files listed under include into the user config, in order, so settings in later files
+// override earlier ones and all of them override config.yaml itself. Relative paths are relative to config.yaml.
+// Missing files are skipped, since a machine without overrides of its own is normal, but broken ones fail the load
+// just like a broken config.yaml. Includes in included files aren't followed.
+func (cc *CanonicalConfig) mergeIncludes() error {
+	var included []string
+
+	for _, name := range cc.userConfig.GetStringSlice(configKeyInclude) {
+		includePath, err := resolveIncludePath(name)
+		if err != nil {
+			cc.logger.Warnw("Ignoring config include", "include", name, "error", err)
+			continue
+		}
+
+		// watched even while missing, so creating it later reloads the config
+		included = append(included, includePath)
+
+		data, err := os.ReadFile(includePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			cc.logger.Debugw("Included config file not found, skipping", "path", includePath)
+			continue
+		}
+
+		if err == nil {
+			err = cc.userConfig.MergeConfig(bytes.NewReader(data))
+		}
+
+		if err != nil {
+			return cc.handleConfigError("included config "+name, err)
+		}
+
+		cc.logger.Debugw("Merged included config file", "path", includePath)
+	}
+
+	cc.includeLock.Lock()
+	cc.includedFiles = included
+	cc.includeLock.Unlock()
+
+	return nil
+}
+
+// configFilePaths returns the absolute paths of config.yaml and the files it includes, which the config watcher
+// reloads the config for
+func (cc *CanonicalConfig) configFilePaths() ([]string, error) {
+	configPath, err := filepath.Abs(userConfigFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	cc.includeLock.Lock()
+	defer cc.includeLock.Unlock()
+
+	return append([]string{configPath}, cc.includedFiles...), nil
+}
+
+// resolveIncludePath fills in the hostname placeholder of an include and makes it absolute
+func resolveIncludePath(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("empty path")
+	}
+
+	if strings.Contains(name, includeHostnamePlaceholder) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+
+		name = strings.ReplaceAll(name, includeHostnamePlaceholder, strings.ToLower(hostname))
+	}
+
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(userConfigFilepath), name)
+	}
+
+	return filepath.Abs(name)
+}
@@ -0,0 +1,334 @@
+package deej
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newTestConfigDir moves the test into an empty directory, where the config is looked up
+func newTestConfigDir(t *testing.T) {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("get working directory: %v", err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("change working directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(previous)
+	})
+}
+
+func writeUserConfig(t *testing.T, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(userConfigFilepath, []byte(contents), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	tests := []struct {
+		name         string
+		reloaded     string
+		wantErr      bool
+		wantNotified string
+		wantMapping  []string // for slider 0, after the reload
+		wantChanged  bool
+	}{
+		{
+			name:        "valid change",
+			reloaded:    "slider_mapping:\n  0: spotify.exe\n",
+			wantMapping: []string{"spotify.exe"},
+			wantChanged: true,
+		},
+		{
+			name:         "invalid yaml keeps the previous config",
+			reloaded:     "slider_mapping:\n  0: [master\n",
+			wantErr:      true,
+			wantNotified: "Invalid configuration format!",
+			wantMapping:  []string{"master"},
+		},
+		{
+			name:         "deleted file keeps the previous config",
+			wantErr:      true,
+			wantNotified: "Missing configuration!",
+			wantMapping:  []string{"master"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestConfigDir(t)
+			writeUserConfig(t, "language: en\nslider_mapping:\n  0: master\n")
+
+			notifier := &fakeNotifier{}
+
+			cc, err := NewConfig(zap.NewNop().Sugar(), notifier, newEventBus())
+			if err != nil {
+				t.Fatalf("NewConfig: %v", err)
+			}
+
+			if err := cc.Load(); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if got, _ := cc.SliderMapping.get(0); !reflect.DeepEqual(got, []string{"master"}) {
+				t.Fatalf("slider 0 after Load = %q, want master", got)
+			}
+
+			changes := cc.events.configReloaded.subscribe()
+
+			if test.reloaded != "" {
+				writeUserConfig(t, test.reloaded)
+			} else if err := os.Remove(userConfigFilepath); err != nil {
+				t.Fatalf("remove config: %v", err)
+			}
+
+			if err := cc.Reload(); (err != nil) != test.wantErr {
+				t.Fatalf("Reload error = %v, want error: %t", err, test.wantErr)
+			}
+
+			if test.wantNotified != "" && !notifier.notified(test.wantNotified) {
+				t.Errorf("expected a %q notification", test.wantNotified)
+			}
+
+			if got, _ := cc.SliderMapping.get(0); !reflect.DeepEqual(got, test.wantMapping) {
+				t.Errorf("slider 0 after Reload = %q, want %q", got, test.wantMapping)
+			}
+
+			if changed := len(drain(changes)) > 0; changed != test.wantChanged {
+				t.Errorf("subscribers notified = %t, want %t", changed, test.wantChanged)
+			}
+		})
+	}
+}
+
+func TestNamedSliders(t *testing.T) {
+	newTestConfigDir(t)
+	writeUserConfig(t, `sliders:
+  0: Main
+  1: music
+  2: "3"
+slider_mapping:
+  main: master
+  Music: spotify.exe
+  3: discord.exe
+  chat: game.exe
+`)
+
+	cc, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		sliderIdx int
+		want      []string
+	}{
+		{0, []string{"master"}},
+		{1, []string{"spotify.exe"}},
+		{2, nil}, // numeric names are ignored
+		{3, []string{"discord.exe"}},
+	}
+
+	for _, test := range tests {
+		if got, _ := cc.SliderMapping.get(test.sliderIdx); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("slider %d = %q, want %q", test.sliderIdx, got, test.want)
+		}
+	}
+
+	// unknown names don't map to anything
+	count := 0
+	cc.SliderMapping.iterate(func(int, []string) { count++ })
+	if count != 3 {
+		t.Errorf("mapped sliders = %d, want 3", count)
+	}
+
+	if !reflect.DeepEqual(cc.SliderNames, map[int]string{0: "Main", 1: "music"}) {
+		t.Errorf("slider names = %v", cc.SliderNames)
+	}
+}
+
+func TestConfigIncludes(t *testing.T) {
+	newTestConfigDir(t)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+
+	writeUserConfig(t, `com_port: COM1
+slider_mapping:
+  0: master
+include:
+  - common.yaml
+  - "{hostname}.yaml"
+  - missing.yaml
+`)
+
+	files := map[string]string{
+		"common.yaml":                       "com_port: COM2\nslider_mapping:\n  1: spotify.exe\n  2: discord.exe\n",
+		strings.ToLower(hostname) + ".yaml": "com_port: COM3\nslider_mapping:\n  2: game.exe\ninclude: [nested.yaml]\n",
+		"nested.yaml":                       "com_port: COM4\n",
+	}
+
+	for name, contents := range files {
+		if err := os.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	cc, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cc.ConnectionInfo.COMPort != "COM3" {
+		t.Errorf("COM port = %q, want COM3 from the per-machine file", cc.ConnectionInfo.COMPort)
+	}
+
+	tests := []struct {
+		sliderIdx int
+		want      []string
+	}{
+		{0, []string{"master"}},
+		{1, []string{"spotify.exe"}},
+		{2, []string{"game.exe"}},
+	}
+
+	for _, test := range tests {
+		if got, _ := cc.SliderMapping.get(test.sliderIdx); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("slider %d = %q, want %q", test.sliderIdx, got, test.want)
+		}
+	}
+
+	// a broken include fails the load like a broken config
+	if err := os.WriteFile("common.yaml", []byte("slider_mapping:\n  1: [spotify.exe\n"), 0644); err != nil {
+		t.Fatalf("write common.yaml: %v", err)
+	}
+
+	if err := cc.Reload(); err == nil {
+		t.Error("Reload with a broken include succeeded")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	newTestConfigDir(t)
+	writeUserConfig(t, `aliases:
+  Music: spotify.exe
+  browser: [chrome.exe, msedge.exe]
+  speakers: Speakers (Realtek High Definition Audio)
+  everything: [music, obs:Mic/Aux, deej.current]
+  master: vlc.exe
+`)
+
+	cc, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := map[string][]string{
+		"music":      {"spotify.exe"},
+		"browser":    {"chrome.exe", "msedge.exe"},
+		"speakers":   {"Speakers (Realtek High Definition Audio)"},
+		"everything": {"deej.current"}, // aliases and external targets are dropped
+	}
+
+	if !reflect.DeepEqual(cc.Aliases, want) {
+		t.Errorf("aliases = %q, want %q", cc.Aliases, want)
+	}
+}
+
+func TestSavePreset(t *testing.T) {
+	newTestConfigDir(t)
+	writeUserConfig(t, `# my sliders
+slider_mapping:
+  0: master
+presets:
+  quiet:
+    master: 10
+`)
+
+	cc, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if err := cc.SavePreset("Movie Night", map[string]float32{"master": 0.3, "vlc.exe": 0.8, "chrome.exe": 0}); err != nil {
+		t.Fatalf("SavePreset: %v", err)
+	}
+
+	if err := cc.SavePreset("broken.name", map[string]float32{"master": 1}); err == nil {
+		t.Error("SavePreset accepted a name with a dot")
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load after saving: %v", err)
+	}
+
+	want := map[string]map[string]float32{
+		"quiet":       {"master": 0.1},
+		"movie night": {"master": 0.3, "vlc.exe": 0.8, "chrome.exe": 0},
+	}
+
+	if !reflect.DeepEqual(cc.Presets, want) {
+		t.Errorf("presets = %v, want %v", cc.Presets, want)
+	}
+
+	if got, _ := cc.SliderMapping.get(0); !reflect.DeepEqual(got, []string{"master"}) {
+		t.Errorf("slider 0 = %q after saving a preset, want master", got)
+	}
+}
+
+func TestSaveSliderValues(t *testing.T) {
+	newTestConfigDir(t)
+	writeUserConfig(t, "slider_mapping:\n  0: master\n")
+
+	saved, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	want := map[int]float32{0: 0.25, 3: 1}
+	if err := saved.SaveSliderValues(want); err != nil {
+		t.Fatalf("SaveSliderValues: %v", err)
+	}
+
+	loaded, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if got := loaded.LastSliderValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LastSliderValues = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// editors save in bursts: truncating and then writing, or writing a temporary file and renaming it over the
+	// config. the config is only reloaded once it has been left alone for this long, so each save reloads it once
+	configReloadDebounce = 300 * time.Millisecond
+
+	// how long to wait before watching again after the watch broke, e.g. because the directory was replaced
+	configWatchRetryDelay = 5 * time.Second
+)
+
+// WatchConfigFileChanges reloads the user config whenever it's modified on disk, until ctx is done.
+// It watches the config's directory rather than the file itself, so it keeps working when the file is
+// replaced instead of written to, as many editors do to save atomically.
+func (cc *CanonicalConfig) WatchConfigFileChanges(ctx context.Context) {
+	cc.logger.Debugw("Starting to watch user config file for changes", "path", userConfigFilepath)
+
+	for {
+		err := cc.watchConfigDirectory(ctx)
+		if err == nil {
+			cc.logger.Debug("Stopping user config file watcher")
+			return
+		}
+
+		cc.logger.Warnw("Failed to watch config file, retrying", "error", err, "delay", configWatchRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			cc.logger.Debug("Stopping user config file watcher")
+			return
+		case <-time.After(configWatchRetryDelay):
+		}
+	}
+}
+
+// watchConfigDirectory reloads the config after changes to it, or to the files it includes, settle down. It returns
+// nil once ctx is done, or an error if the watch can't be set up or breaks.
+func (cc *CanonicalConfig) watchConfigDirectory(ctx context.Context) error {
+	configPaths, err := cc.configFilePaths()
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	configDir := filepath.Dir(configPaths[0])
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(configDir); err != nil {
+		return fmt.Errorf("watch %s: %w", configDir, err)
+	}
+
+	cc.watchIncludeDirectories(watcher, configPaths)
+
+	// nil while no change is pending, which leaves it out of the select
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+
+			if filepath.Clean(event.Name) == configDir && event.Has(fsnotify.Remove|fsnotify.Rename) {
+				return fmt.Errorf("%s went away", configDir)
+			}
+
+			if !configFileChanged(event, configPaths) {
+				continue
+			}
+
+			cc.logger.Debugw("Config file modified, waiting for changes to settle", "event", event)
+			settled = time.After(configReloadDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+
+			return fmt.Errorf("watch %s: %w", configDir, err)
+
+		case <-settled:
+			settled = nil
+			cc.logger.Debug("Config file changes settled, attempting reload")
+
+			if err := cc.Reload(); err == nil {
+				cc.notifier.Notify(tr("notify.configReloaded"), tr("notify.configReloadedMessage"))
+			}
+
+			// the reloaded config may include other files
+			if paths, err := cc.configFilePaths(); err == nil {
+				configPaths = paths
+				cc.watchIncludeDirectories(watcher, configPaths)
+			}
+		}
+	}
+}
+
+// watchIncludeDirectories adds the directories of included files to the watch. Ones that can't be watched (e.g.
+// because they don't exist) are skipped, leaving changes to the files in them unnoticed until the next reload.
+// Adding a directory that's already watched does nothing.
+func (cc *CanonicalConfig) watchIncludeDirectories(watcher *fsnotify.Watcher, configPaths []string) {
+	for _, includePath := range configPaths[1:] {
+		includeDir := filepath.Dir(includePath)
+
+		if err := watcher.Add(includeDir); err != nil {
+			cc.logger.Debugw("Can't watch included config file's directory", "path", includeDir, "error", err)
+		}
+	}
+}
+
+// configFileChanged reports whether an event in a watched directory means new contents for the config or a file
+// it includes. Removing or renaming the file away doesn't: an atomic save creates the new file right after, and a
+// config that's really gone is better kept than replaced with nothing.
+func configFileChanged(event fsnotify.Event, configPaths []string) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+		return false
+	}
+
+	for _, configPath := range configPaths {
+		// Windows paths aren't case sensitive, and on other systems the odd extra reload is harmless
+		if strings.EqualFold(filepath.Clean(event.Name), configPath) {
+			return true
+		}
+	}
+
+	return false
+}
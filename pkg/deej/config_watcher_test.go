@@ -0,0 +1,87 @@
+package deej
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// saveUserConfigAtomically replaces the config the way many editors save, through a temporary file
+func saveUserConfigAtomically(t *testing.T, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(userConfigFilepath+".tmp", []byte(contents), 0644); err != nil {
+		t.Fatalf("write temporary config: %v", err)
+	}
+
+	if err := os.Rename(userConfigFilepath+".tmp", userConfigFilepath); err != nil {
+		t.Fatalf("replace config: %v", err)
+	}
+}
+
+func TestWatchConfigFileChanges(t *testing.T) {
+	newTestConfigDir(t)
+	writeUserConfig(t, "slider_mapping:\n  0: master\n")
+
+	cc, err := NewConfig(zap.NewNop().Sugar(), &fakeNotifier{}, newEventBus())
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	reloads := cc.events.configReloaded.subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcherDone := make(chan struct{})
+
+	go func() {
+		defer close(watcherDone)
+		cc.WatchConfigFileChanges(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-watcherDone
+	})
+
+	// the watcher starts in the background, so keep saving until it notices
+	for attempts, noticed := 0, false; !noticed; attempts++ {
+		if attempts == 10 {
+			t.Fatal("watcher never noticed the config changing")
+		}
+
+		saveUserConfigAtomically(t, "slider_mapping:\n  0: discord.exe\n")
+
+		select {
+		case <-reloads:
+			noticed = true
+		case <-time.After(2 * configReloadDebounce):
+		case <-watcherDone:
+			t.Fatal("watcher stopped")
+		}
+	}
+
+	// a burst of saves settles into a single reload of the last one
+	for _, target := range []string{"chrome.exe", "spotify.exe", "vlc.exe"} {
+		saveUserConfigAtomically(t, "slider_mapping:\n  0: "+target+"\n")
+	}
+
+	receive(t, reloads)
+
+	if got, _ := cc.SliderMapping.get(0); !reflect.DeepEqual(got, []string{"vlc.exe"}) {
+		t.Errorf("slider 0 after reload = %q, want vlc.exe", got)
+	}
+
+	time.Sleep(2 * configReloadDebounce)
+
+	if extra := len(drain(reloads)); extra != 0 {
+		t.Errorf("got %d more reloads after a burst of saves, want 0", extra)
+	}
+}
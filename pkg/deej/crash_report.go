@@ -0,0 +1,189 @@
+package deej
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	crashReportTimeout = 5 * time.Second
+	crashReportClient  = "deej-crash-reporter/1.0"
+
+	// Sentry caps the size of individual values, so long crashlogs are trimmed from the start, keeping the stack trace
+	crashReportMaxLength = 16000
+)
+
+// sentryEvent is the subset of Sentry's event payload that crash reports use,
+// see https://develop.sentry.dev/sdk/data-model/event-payloads/
+type sentryEvent struct {
+	EventID   string                 `json:"event_id"`
+	Timestamp string                 `json:"timestamp"`
+	Platform  string                 `json:"platform"`
+	Level     string                 `json:"level"`
+	Release   string                 `json:"release,omitempty"`
+	Message   map[string]string      `json:"message"`
+	Tags      map[string]string      `json:"tags"`
+	Extra     map[string]interface{} `json:"extra"`
+}
+
+// uploadCrashReport sends a crashlog to the Sentry-compatible service the DSN points to
+func uploadCrashReport(dsn string, version string, summary string, crashlog []byte) error {
+	if dsn == "" {
+		return errors.New("no crash_reports.dsn configured")
+	}
+
+	endpoint, authHeader, err := parseSentryDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	eventID, err := newSentryEventID()
+	if err != nil {
+		return err
+	}
+
+	if len(crashlog) > crashReportMaxLength {
+		crashlog = crashlog[len(crashlog)-crashReportMaxLength:]
+	}
+
+	event := sentryEvent{
+		EventID:   eventID,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Platform:  "go",
+		Level:     "fatal",
+		Release:   version,
+		Message:   map[string]string{"formatted": summary},
+		Tags: map[string]string{
+			"os":            runtime.GOOS,
+			"arch":          runtime.GOARCH,
+			"audio_backend": audioBackendName,
+		},
+		Extra: map[string]interface{}{"crashlog": string(crashlog)},
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode crash report: %w", err)
+	}
+
+	// an envelope holds a header, then each item's header and payload, one per line
+	var envelope bytes.Buffer
+	fmt.Fprintf(&envelope, "{\"event_id\":%q}\n", eventID)
+	fmt.Fprintf(&envelope, "{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	envelope.Write(payload)
+	envelope.WriteString("\n")
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, &envelope)
+	if err != nil {
+		return fmt.Errorf("create crash report request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-sentry-envelope")
+	request.Header.Set("X-Sentry-Auth", authHeader)
+
+	client := &http.Client{Timeout: crashReportTimeout}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("send crash report: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("crash report rejected: %s", response.Status)
+	}
+
+	return nil
+}
+
+// parseSentryDSN turns a DSN (https://<key>@<host>/<project>) into the envelope endpoint and the auth header to send
+func parseSentryDSN(dsn string) (string, string, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("parse crash report DSN: %w", err)
+	}
+
+	key := parsed.User.Username()
+
+	// self-hosted instances may live under a path prefix, the project ID is always last
+	pathPrefix, projectID := splitDSNPath(parsed.Path)
+
+	if key == "" || projectID == "" || parsed.Host == "" {
+		return "", "", errors.New("invalid crash report DSN, expected https://<key>@<host>/<project>")
+	}
+
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", parsed.Scheme, parsed.Host, pathPrefix, projectID)
+	authHeader := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", crashReportClient, key)
+
+	return endpoint, authHeader, nil
+}
+
+// splitDSNPath splits a DSN path into its prefix and the project ID at the end
+func splitDSNPath(dsnPath string) (string, string) {
+	dsnPath = strings.TrimSuffix(dsnPath, "/")
+
+	idx := strings.LastIndex(dsnPath, "/")
+	if idx == -1 {
+		return "", ""
+	}
+
+	return dsnPath[:idx], dsnPath[idx+1:]
+}
+
+func newSentryEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("generate crash report ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// latestCrashlog returns the path of the most recent crashlog in the log directory
+func latestCrashlog() (string, error) {
+	paths, err := filepath.Glob(filepath.Join(LogDirectory, fmt.Sprintf(crashlogFilename, "*")))
+	if err != nil {
+		return "", fmt.Errorf("list crashlogs: %w", err)
+	}
+
+	if len(paths) == 0 {
+		return "", os.ErrNotExist
+	}
+
+	// the timestamp format sorts chronologically
+	sort.Strings(paths)
+
+	return paths[len(paths)-1], nil
+}
+
+// sendLatestCrashlog uploads the most recent crashlog, for when deej wasn't set to upload it as it crashed
+func (d *Deej) sendLatestCrashlog() (string, error) {
+	crashlogPath, err := latestCrashlog()
+	if err != nil {
+		return "", err
+	}
+
+	crashlog, err := os.ReadFile(crashlogPath)
+	if err != nil {
+		return "", fmt.Errorf("read crashlog: %w", err)
+	}
+
+	summary := fmt.Sprintf("deej crash (%s)", filepath.Base(crashlogPath))
+	if err := uploadCrashReport(d.config.CrashReports.DSN, d.version, summary, crashlog); err != nil {
+		return "", err
+	}
+
+	return crashlogPath, nil
+}
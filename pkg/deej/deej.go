@@ -3,9 +3,11 @@
 package deej
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -15,66 +17,155 @@ import (
 const (
 	// EnvNoTray disables the tray icon when set.
 	EnvNoTray = "DEEJ_NO_TRAY_ICON"
+
+	// how long shutdown waits for background goroutines to return
+	shutdownTimeout = 5 * time.Second
 )
 
 // Deej manages the main application components.
 type Deej struct {
 	logger      *zap.SugaredLogger
-	notifier    Notifier
+	notifier    *notifierGroup
+	events      *eventBus
 	config      *CanonicalConfig
 	serial      *SerialIO
 	sessions    *sessionMap
-	stopChannel chan bool
+	media       *mediaPlayers
+	grpc        *grpcServer
+	http        *httpServer
+	streamDeck  *streamDeck
+	webUI       *webUI
+	companion   *companion
+	forwarder   *sliderForwarder
+	metrics     *metrics
+	osc         *oscBridge
+	obs         *obsClient
+	discord     *discordClient
+	voicemeeter *voicemeeter
+	equalizer   *equalizer
+	hotkeys     *hotkeyManager
+	buttons     *buttonActions
+	exec        *execCommands
+	pan         *panControl
+	script      *scriptEngine
+	plugins     *pluginHost
+	meter       *sessionMeter
+	ducker      *ducker
+	fader       *fader
+	accelerator *stepAccelerator
+	chatMix     *chatMix
+	vuMeter     *vuMeter
+	feedback    *volumeFeedback
+	idle        *idleMonitor
+	rules       *ruleEngine
+	power       *powerWatcher
+	desktop     *desktopSessionWatcher
+	elevation   *elevationWatcher
+	hotplug     *hotplugWatcher
+	trayIcon    *trayIcon
+	quickBind   *quickBinder
+	unmapped    *unmappedDigest
+	missing     *missingTargets
+	sliders     *sliderMemory
+	telemetry   *telemetryRecorder
+	service     *serviceState // set while running as a service or embedded
+	embedded    bool          // set by Run, when another program owns the process
+	headless    bool          // no tray icon, and notifications only go to the log
+	trayRunning bool          // set once the tray is up, so shutdown knows to take it down
 	version     string
 	verbose     bool
+
+	routines *routineGroup // every goroutine started with spawn
 }
 
 // NewDeej creates a new Deej instance.
 func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 	logger = logger.Named("deej")
 
-	notifier, err := NewToastNotifier(logger)
+	toastNotifier, err := NewToastNotifier(logger)
 	if err != nil {
 		logger.Errorw("Failed to create notifier", "error", err)
 		return nil, fmt.Errorf("failed to create notifier: %w", err)
 	}
 
-	config, err := NewConfig(logger, notifier)
+	notifier := newNotifierGroup(toastNotifier)
+	events := newEventBus()
+
+	config, err := NewConfig(logger, notifier, events)
 	if err != nil {
 		logger.Errorw("Failed to create configuration", "error", err)
 		return nil, fmt.Errorf("failed to create configuration: %w", err)
 	}
 
-	serial, err := NewSerialIO(nil, logger)
+	d := &Deej{
+		logger:   logger,
+		notifier: notifier,
+		events:   events,
+		config:   config,
+		verbose:  verbose,
+	}
+
+	d.routines = newRoutineGroup(d.handlePanic)
+
+	serial, err := NewSerialIO(config, events, d.routines, logger)
 	if err != nil {
 		logger.Errorw("Failed to initialize serial communication", "error", err)
 		return nil, fmt.Errorf("failed to initialize serial communication: %w", err)
 	}
 
-	sessionFinder, err := newSessionFinder(logger)
+	sessionFinder, err := newSessionFinder(logger, d.handlePanic)
 	if err != nil {
 		logger.Errorw("Failed to initialize session finder", "error", err)
 		return nil, fmt.Errorf("failed to initialize session finder: %w", err)
 	}
 
-	sessions, err := newSessionMap(nil, logger, sessionFinder)
+	sessions, err := newSessionMap(config, events, d.routines, logger, sessionFinder)
 	if err != nil {
 		logger.Errorw("Failed to initialize session map", "error", err)
 		return nil, fmt.Errorf("failed to initialize session map: %w", err)
 	}
 
-	d := &Deej{
-		logger:      logger,
-		notifier:    notifier,
-		config:      config,
-		serial:      serial,
-		sessions:    sessions,
-		stopChannel: make(chan bool),
-		verbose:     verbose,
-	}
-
-	serial.SetParent(d)
-	sessions.SetParent(d)
+	d.serial = serial
+	d.sessions = sessions
+	d.media = newMediaPlayers(d, logger)
+
+	d.grpc = newGRPCServer(d, logger)
+	d.http = newHTTPServer(d, logger)
+	d.streamDeck = newStreamDeck(d, logger)
+	d.webUI = newWebUI(d, logger)
+	d.companion = newCompanion(d, logger)
+	d.forwarder = newSliderForwarder(d, logger)
+	d.metrics = newMetrics(d, logger)
+	d.osc = newOSCBridge(d, logger)
+	d.obs = newOBSClient(d, logger)
+	d.discord = newDiscordClient(d, logger)
+	d.voicemeeter = newVoicemeeter(d, logger)
+	d.equalizer = newEqualizer(d, logger)
+	d.hotkeys = newHotkeyManager(d, logger)
+	d.buttons = newButtonActions(d, logger)
+	d.exec = newExecCommands(d, logger)
+	d.pan = newPanControl(d, logger)
+	d.script = newScriptEngine(d, logger)
+	d.plugins = newPluginHost(d, logger)
+	d.meter = newSessionMeter(d, logger)
+	d.ducker = newDucker(d, logger)
+	d.fader = newFader(d, logger)
+	d.accelerator = newStepAccelerator(d, logger)
+	d.chatMix = newChatMix(d, logger)
+	d.vuMeter = newVUMeter(d, logger)
+	d.feedback = newVolumeFeedback(d, logger)
+	d.idle = newIdleMonitor(d, logger)
+	d.rules = newRuleEngine(d, logger)
+	d.power = newPowerWatcher(d, logger)
+	d.desktop = newDesktopSessionWatcher(d, logger)
+	d.elevation = newElevationWatcher(d, logger)
+	d.hotplug = newHotplugWatcher(d, logger)
+	d.trayIcon = newTrayIcon(d, logger)
+	d.quickBind = newQuickBinder(d, logger)
+	d.unmapped = newUnmappedDigest(d, logger)
+	d.missing = newMissingTargets(d, logger)
+	d.sliders = newSliderMemory(d, logger)
+	d.telemetry = newTelemetryRecorder(d, logger)
 
 	logger.Debug("Deej instance created successfully")
 	return d, nil
@@ -82,6 +173,8 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 
 // Initialize prepares components and starts running the application.
 func (d *Deej) Initialize() error {
+	defer d.recoverFromPanic()
+
 	d.logger.Debug("Initializing deej")
 
 	if err := d.config.Load(); err != nil {
@@ -94,12 +187,44 @@ func (d *Deej) Initialize() error {
 		return fmt.Errorf("failed to initialize session map: %w", err)
 	}
 
-	if os.Getenv(EnvNoTray) != "" {
+	d.media.initialize()
+
+	d.grpc.initialize()
+	d.http.initialize()
+	d.streamDeck.initialize()
+	d.webUI.initialize()
+	d.companion.initialize()
+	d.metrics.initialize()
+	d.osc.initialize()
+	d.obs.initialize()
+	d.discord.initialize()
+	d.voicemeeter.initialize()
+	d.equalizer.initialize()
+	d.hotkeys.initialize()
+	d.buttons.initialize()
+	d.exec.initialize()
+	d.pan.initialize()
+	d.script.initialize()
+	d.plugins.initialize()
+	d.sliders.initialize()
+
+	if d.headless {
+		d.logger.Debug("Running headless, notifications will only be logged")
+		d.notifier.replace(newLogNotifier(d.logger))
+	}
+
+	if d.headless || os.Getenv(EnvNoTray) != "" || d.service != nil {
 		d.logger.Debug("Running without tray icon")
-		d.setupInterruptHandler()
+
+		// the embedding program handles signals itself, and stops deej through Run's context
+		if !d.embedded {
+			d.setupInterruptHandler()
+		}
+
 		d.run()
 	} else {
 		d.setupInterruptHandler()
+		d.trayRunning = true
 		d.initializeTray(d.run)
 	}
 
@@ -111,6 +236,19 @@ func (d *Deej) SetVersion(version string) {
 	d.version = version
 }
 
+// SetHeadless runs deej without a tray icon or desktop notifications, e.g. on a server. Notifications are
+// logged instead, and signals take the place of the tray menu: SIGINT and SIGTERM quit, SIGHUP reloads the
+// config. Must be called before Initialize.
+func (d *Deej) SetHeadless(headless bool) {
+	d.headless = headless
+}
+
+// SetDryRun has deej log the volume and mute changes it would make instead of making them, to try out a config
+// against live hardware and sessions. Must be called before Initialize.
+func (d *Deej) SetDryRun(dryRun bool) {
+	d.sessions.dryRun = dryRun
+}
+
 // Verbose indicates whether the application runs in verbose mode.
 func (d *Deej) Verbose() bool {
 	return d.verbose
@@ -119,45 +257,139 @@ func (d *Deej) Verbose() bool {
 func (d *Deej) setupInterruptHandler() {
 	interruptChannel := util.SetupCloseHandler()
 
-	go func() {
-		signal := <-interruptChannel
-		d.logger.Debugw("Interrupt received", "signal", signal)
-		d.signalStop()
-	}()
+	// SIGHUP reloads the config like it does for most daemons. Besides standing in for the tray menu when
+	// headless, it works where file change notifications don't, e.g. on NFS or in some containers
+	reloadChannel := util.SetupReloadHandler()
+
+	d.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case signal := <-interruptChannel:
+				d.logger.Debugw("Interrupt received", "signal", signal)
+				d.signalStop()
+				return nil
+			case signal := <-reloadChannel:
+				d.logger.Infow("Reload signal received, reloading config", "signal", signal)
+
+				if err := d.config.Reload(); err == nil {
+					d.notifier.Notify(tr("notify.configReloaded"), tr("notify.configReloadedMessage"))
+				}
+			}
+		}
+	})
+}
+
+// spawn runs f on a background goroutine that lives until deej shuts down, see routineGroup.spawn
+func (d *Deej) spawn(f func(ctx context.Context) error) {
+	d.routines.spawn(f)
 }
 
 func (d *Deej) run() {
 	d.logger.Info("Run loop starting")
 
-	go d.config.WatchConfigFileChanges()
+	d.spawn(func(ctx context.Context) error {
+		d.config.WatchConfigFileChanges(ctx)
+		return nil
+	})
 
-	go func() {
-		if err := d.serial.Start(); err != nil {
-			d.handleSerialError(err)
-		}
-	}()
+	if err := d.grpc.start(); err != nil {
+		d.logger.Warnw("Failed to start gRPC API", "error", err)
+		d.notifier.Notify(tr("notify.grpcFailed"), tr("notify.grpcFailedMessage"))
+	}
+
+	if err := d.http.start(); err != nil {
+		d.logger.Warnw("Failed to start HTTP API", "error", err)
+		d.notifier.Notify(tr("notify.httpFailed"), tr("notify.httpFailedMessage"))
+	}
+
+	if d.sessions.dryRun {
+		d.logger.Warn("Dry run, volume and mute changes are only logged")
+		d.notifier.Notify(tr("notify.dryRun"), tr("notify.dryRunMessage"))
+	}
+
+	d.companion.start()
+	d.forwarder.start()
+
+	if err := d.osc.start(); err != nil {
+		d.logger.Warnw("Failed to start OSC bridge", "error", err)
+		d.notifier.Notify(tr("notify.oscFailed"), tr("notify.oscFailedMessage"))
+	}
+
+	d.obs.start()
+	d.discord.start()
+	d.meter.start()
+	d.ducker.start()
+	d.fader.start()
+	d.chatMix.start()
+	d.vuMeter.start()
+	d.feedback.start()
+	d.idle.start()
+	d.rules.start()
+	d.power.start()
+	d.desktop.start()
+	d.hotplug.start()
+	d.quickBind.start()
+	d.unmapped.start()
+	d.missing.start()
+	d.elevation.start()
+	d.telemetry.start()
+
+	if err := d.hotkeys.start(); err != nil {
+		d.logger.Warnw("Failed to register hotkeys", "error", err)
+		d.notifier.Notify(tr("notify.hotkeysFailed"), tr("notify.moreDetails"))
+	}
+
+	// before the board connects, so its first line has the final say
+	d.sliders.restore()
 
-	<-d.stopChannel
+	util.Go(d.handlePanic, d.startSerial)
+
+	if d.service != nil {
+		d.service.ready()
+	}
+
+	<-d.routines.ctx.Done()
 	d.logger.Debug("Stop signal received")
 
+	exitCode := 0
 	if err := d.stop(); err != nil {
 		d.logger.Warnw("Error during shutdown", "error", err)
-		os.Exit(1)
+		exitCode = 1
+	}
+
+	// the service manager needs to hear about the exit before the process goes away
+	if d.service != nil {
+		d.service.exitChannel <- exitCode
+		return
 	}
 
-	os.Exit(0)
+	os.Exit(exitCode)
+}
+
+// startSerial connects to the boards when deej starts, and stops deej if it can't
+func (d *Deej) startSerial() {
+	if err := d.serial.Start(); err != nil {
+		d.handleSerialError(err)
+	}
 }
 
 func (d *Deej) handleSerialError(err error) {
+	ports := failedSerialPorts(err)
+
 	switch {
+	case errors.Is(err, os.ErrNotExist) && d.hotplug.listening.Load():
+		// not plugged in yet, so the hotplug watcher connects it once it is
+		d.logger.Warnw("Serial port not found, waiting for the board to be plugged in", "ports", ports)
+		d.notifier.Notify(tr("notify.serialWaiting"), tr("notify.serialWaitingMessage", "port", ports))
+		return
 	case errors.Is(err, os.ErrPermission):
-		d.logger.Warnw("Serial port busy", "comPort", d.config.ConnectionInfo.COMPort)
-		d.notifier.Notify("Serial port busy!",
-			"Close other applications using the port and try again.")
+		d.logger.Warnw("Serial port busy", "ports", ports)
+		d.notifier.Notify(tr("notify.serialBusy"), tr("notify.serialBusyMessage", "port", ports))
 	case errors.Is(err, os.ErrNotExist):
-		d.logger.Warnw("Invalid serial port configuration", "comPort", d.config.ConnectionInfo.COMPort)
-		d.notifier.Notify("Invalid serial port!",
-			"Ensure the correct port is set in the configuration.")
+		d.logger.Warnw("Invalid serial port configuration", "ports", ports)
+		d.notifier.Notify(tr("notify.serialInvalid"), tr("notify.serialInvalidMessage", "port", ports))
 	default:
 		d.logger.Warnw("Unknown error during serial start", "error", err)
 	}
@@ -166,21 +398,48 @@ func (d *Deej) handleSerialError(err error) {
 
 func (d *Deej) signalStop() {
 	d.logger.Debug("Sending stop signal")
-	d.stopChannel <- true
+	d.routines.cancel()
 }
 
 func (d *Deej) stop() error {
 	d.logger.Info("Shutting down deej")
 
-	d.config.StopWatchingConfigFile()
+	if d.service != nil {
+		d.service.stopping()
+	}
+
+	d.grpc.stop()
+	d.http.stop()
+	d.osc.stop()
+	d.obs.stop()
+	d.discord.stop()
+	d.hotkeys.stop()
+	d.plugins.stop()
+	d.power.stop()
+	d.desktop.stop()
+	d.hotplug.stop()
+	d.trayIcon.stop()
 	d.serial.Stop()
 
+	// everything started with spawn returns on its own now that the context is done,
+	// including the ducker and fader restoring the volumes they lowered
+	if err := d.routines.wait(shutdownTimeout); err != nil {
+		d.logger.Warnw("Background goroutines didn't stop cleanly", "error", err)
+	}
+
+	d.sliders.save()
+
+	d.voicemeeter.release()
+
 	if err := d.sessions.release(); err != nil {
 		d.logger.Errorw("Failed to release session map", "error", err)
 		return fmt.Errorf("failed to release session map: %w", err)
 	}
 
-	d.stopTray()
+	if d.trayRunning {
+		d.stopTray()
+	}
+
 	d.logger.Sync()
 	return nil
-}
\ No newline at end of file
+}
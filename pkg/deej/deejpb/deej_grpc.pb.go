@@ -0,0 +1,549 @@
+// Control API for a running deej instance.
+//
+// The service is disabled by default and only listens on localhost unless explicitly
+// configured otherwise (see the grpc_api section in config.yaml).
+//
+// To regenerate the Go code after changing this file, run from the repository root:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//     pkg/deej/deejpb/deej.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: pkg/deej/deejpb/deej.proto
+
+package deejpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Deej_GetStatus_FullMethodName            = "/deej.v1.Deej/GetStatus"
+	Deej_ListSessions_FullMethodName         = "/deej.v1.Deej/ListSessions"
+	Deej_SetVolume_FullMethodName            = "/deej.v1.Deej/SetVolume"
+	Deej_ReloadConfig_FullMethodName         = "/deej.v1.Deej/ReloadConfig"
+	Deej_WatchSliderMoves_FullMethodName     = "/deej.v1.Deej/WatchSliderMoves"
+	Deej_WatchSessions_FullMethodName        = "/deej.v1.Deej/WatchSessions"
+	Deej_WatchConnectionState_FullMethodName = "/deej.v1.Deej/WatchConnectionState"
+	Deej_ListMappings_FullMethodName         = "/deej.v1.Deej/ListMappings"
+	Deej_ListPresets_FullMethodName          = "/deej.v1.Deej/ListPresets"
+	Deej_SavePreset_FullMethodName           = "/deej.v1.Deej/SavePreset"
+	Deej_RestorePreset_FullMethodName        = "/deej.v1.Deej/RestorePreset"
+)
+
+// DeejClient is the client API for Deej service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Deej exposes status, session control and live event feeds of a running deej instance.
+type DeejClient interface {
+	// GetStatus returns a snapshot of the instance's current state.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	// ListSessions returns all audio sessions currently known to deej.
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error)
+	// SetVolume sets the volume of every session matching the given target.
+	// Targets use the same syntax as slider_mapping entries (e.g. "spotify.exe", "master", "deej.current").
+	SetVolume(ctx context.Context, in *SetVolumeRequest, opts ...grpc.CallOption) (*SetVolumeResponse, error)
+	// ReloadConfig re-reads the configuration files, as if they were modified on disk.
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
+	// WatchSliderMoves streams slider movements as they are received from the hardware.
+	WatchSliderMoves(ctx context.Context, in *WatchSliderMovesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SliderMoveEvent], error)
+	// WatchSessions streams the full session list whenever it changes, including volume changes made outside deej.
+	WatchSessions(ctx context.Context, in *WatchSessionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SessionChanged], error)
+	// WatchConnectionState streams serial connection state changes, starting with the current state.
+	WatchConnectionState(ctx context.Context, in *WatchConnectionStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionState], error)
+	// ListMappings returns every mapped or disabled slider, along with the live sessions its targets resolve to.
+	ListMappings(ctx context.Context, in *ListMappingsRequest, opts ...grpc.CallOption) (*ListMappingsResponse, error)
+	// ListPresets returns the saved volume presets.
+	ListPresets(ctx context.Context, in *ListPresetsRequest, opts ...grpc.CallOption) (*ListPresetsResponse, error)
+	// SavePreset saves the current volume of every session as a preset, replacing any preset of the same name.
+	SavePreset(ctx context.Context, in *SavePresetRequest, opts ...grpc.CallOption) (*SavePresetResponse, error)
+	// RestorePreset sets every target in a preset to its saved volume.
+	RestorePreset(ctx context.Context, in *RestorePresetRequest, opts ...grpc.CallOption) (*RestorePresetResponse, error)
+}
+
+type deejClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeejClient(cc grpc.ClientConnInterface) DeejClient {
+	return &deejClient{cc}
+}
+
+func (c *deejClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, Deej_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSessionsResponse)
+	err := c.cc.Invoke(ctx, Deej_ListSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) SetVolume(ctx context.Context, in *SetVolumeRequest, opts ...grpc.CallOption) (*SetVolumeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetVolumeResponse)
+	err := c.cc.Invoke(ctx, Deej_SetVolume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadConfigResponse)
+	err := c.cc.Invoke(ctx, Deej_ReloadConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) WatchSliderMoves(ctx context.Context, in *WatchSliderMovesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SliderMoveEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Deej_ServiceDesc.Streams[0], Deej_WatchSliderMoves_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchSliderMovesRequest, SliderMoveEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchSliderMovesClient = grpc.ServerStreamingClient[SliderMoveEvent]
+
+func (c *deejClient) WatchSessions(ctx context.Context, in *WatchSessionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SessionChanged], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Deej_ServiceDesc.Streams[1], Deej_WatchSessions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchSessionsRequest, SessionChanged]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchSessionsClient = grpc.ServerStreamingClient[SessionChanged]
+
+func (c *deejClient) WatchConnectionState(ctx context.Context, in *WatchConnectionStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionState], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Deej_ServiceDesc.Streams[2], Deej_WatchConnectionState_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchConnectionStateRequest, ConnectionState]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchConnectionStateClient = grpc.ServerStreamingClient[ConnectionState]
+
+func (c *deejClient) ListMappings(ctx context.Context, in *ListMappingsRequest, opts ...grpc.CallOption) (*ListMappingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMappingsResponse)
+	err := c.cc.Invoke(ctx, Deej_ListMappings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) ListPresets(ctx context.Context, in *ListPresetsRequest, opts ...grpc.CallOption) (*ListPresetsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPresetsResponse)
+	err := c.cc.Invoke(ctx, Deej_ListPresets_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) SavePreset(ctx context.Context, in *SavePresetRequest, opts ...grpc.CallOption) (*SavePresetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SavePresetResponse)
+	err := c.cc.Invoke(ctx, Deej_SavePreset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deejClient) RestorePreset(ctx context.Context, in *RestorePresetRequest, opts ...grpc.CallOption) (*RestorePresetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestorePresetResponse)
+	err := c.cc.Invoke(ctx, Deej_RestorePreset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeejServer is the server API for Deej service.
+// All implementations must embed UnimplementedDeejServer
+// for forward compatibility.
+//
+// Deej exposes status, session control and live event feeds of a running deej instance.
+type DeejServer interface {
+	// GetStatus returns a snapshot of the instance's current state.
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	// ListSessions returns all audio sessions currently known to deej.
+	ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error)
+	// SetVolume sets the volume of every session matching the given target.
+	// Targets use the same syntax as slider_mapping entries (e.g. "spotify.exe", "master", "deej.current").
+	SetVolume(context.Context, *SetVolumeRequest) (*SetVolumeResponse, error)
+	// ReloadConfig re-reads the configuration files, as if they were modified on disk.
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
+	// WatchSliderMoves streams slider movements as they are received from the hardware.
+	WatchSliderMoves(*WatchSliderMovesRequest, grpc.ServerStreamingServer[SliderMoveEvent]) error
+	// WatchSessions streams the full session list whenever it changes, including volume changes made outside deej.
+	WatchSessions(*WatchSessionsRequest, grpc.ServerStreamingServer[SessionChanged]) error
+	// WatchConnectionState streams serial connection state changes, starting with the current state.
+	WatchConnectionState(*WatchConnectionStateRequest, grpc.ServerStreamingServer[ConnectionState]) error
+	// ListMappings returns every mapped or disabled slider, along with the live sessions its targets resolve to.
+	ListMappings(context.Context, *ListMappingsRequest) (*ListMappingsResponse, error)
+	// ListPresets returns the saved volume presets.
+	ListPresets(context.Context, *ListPresetsRequest) (*ListPresetsResponse, error)
+	// SavePreset saves the current volume of every session as a preset, replacing any preset of the same name.
+	SavePreset(context.Context, *SavePresetRequest) (*SavePresetResponse, error)
+	// RestorePreset sets every target in a preset to its saved volume.
+	RestorePreset(context.Context, *RestorePresetRequest) (*RestorePresetResponse, error)
+	mustEmbedUnimplementedDeejServer()
+}
+
+// UnimplementedDeejServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeejServer struct{}
+
+func (UnimplementedDeejServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedDeejServer) ListSessions(context.Context, *ListSessionsRequest) (*ListSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedDeejServer) SetVolume(context.Context, *SetVolumeRequest) (*SetVolumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetVolume not implemented")
+}
+func (UnimplementedDeejServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadConfig not implemented")
+}
+func (UnimplementedDeejServer) WatchSliderMoves(*WatchSliderMovesRequest, grpc.ServerStreamingServer[SliderMoveEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSliderMoves not implemented")
+}
+func (UnimplementedDeejServer) WatchSessions(*WatchSessionsRequest, grpc.ServerStreamingServer[SessionChanged]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSessions not implemented")
+}
+func (UnimplementedDeejServer) WatchConnectionState(*WatchConnectionStateRequest, grpc.ServerStreamingServer[ConnectionState]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchConnectionState not implemented")
+}
+func (UnimplementedDeejServer) ListMappings(context.Context, *ListMappingsRequest) (*ListMappingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMappings not implemented")
+}
+func (UnimplementedDeejServer) ListPresets(context.Context, *ListPresetsRequest) (*ListPresetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPresets not implemented")
+}
+func (UnimplementedDeejServer) SavePreset(context.Context, *SavePresetRequest) (*SavePresetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SavePreset not implemented")
+}
+func (UnimplementedDeejServer) RestorePreset(context.Context, *RestorePresetRequest) (*RestorePresetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestorePreset not implemented")
+}
+func (UnimplementedDeejServer) mustEmbedUnimplementedDeejServer() {}
+func (UnimplementedDeejServer) testEmbeddedByValue()              {}
+
+// UnsafeDeejServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeejServer will
+// result in compilation errors.
+type UnsafeDeejServer interface {
+	mustEmbedUnimplementedDeejServer()
+}
+
+func RegisterDeejServer(s grpc.ServiceRegistrar, srv DeejServer) {
+	// If the following call pancis, it indicates UnimplementedDeejServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Deej_ServiceDesc, srv)
+}
+
+func _Deej_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).ListSessions(ctx, req.(*ListSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_SetVolume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetVolumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).SetVolume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_SetVolume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).SetVolume(ctx, req.(*SetVolumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_WatchSliderMoves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSliderMovesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeejServer).WatchSliderMoves(m, &grpc.GenericServerStream[WatchSliderMovesRequest, SliderMoveEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchSliderMovesServer = grpc.ServerStreamingServer[SliderMoveEvent]
+
+func _Deej_WatchSessions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSessionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeejServer).WatchSessions(m, &grpc.GenericServerStream[WatchSessionsRequest, SessionChanged]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchSessionsServer = grpc.ServerStreamingServer[SessionChanged]
+
+func _Deej_WatchConnectionState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchConnectionStateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeejServer).WatchConnectionState(m, &grpc.GenericServerStream[WatchConnectionStateRequest, ConnectionState]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Deej_WatchConnectionStateServer = grpc.ServerStreamingServer[ConnectionState]
+
+func _Deej_ListMappings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMappingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).ListMappings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_ListMappings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).ListMappings(ctx, req.(*ListMappingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_ListPresets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPresetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).ListPresets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_ListPresets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).ListPresets(ctx, req.(*ListPresetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_SavePreset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SavePresetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).SavePreset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_SavePreset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).SavePreset(ctx, req.(*SavePresetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Deej_RestorePreset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestorePresetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeejServer).RestorePreset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Deej_RestorePreset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeejServer).RestorePreset(ctx, req.(*RestorePresetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Deej_ServiceDesc is the grpc.ServiceDesc for Deej service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Deej_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "deej.v1.Deej",
+	HandlerType: (*DeejServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _Deej_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _Deej_ListSessions_Handler,
+		},
+		{
+			MethodName: "SetVolume",
+			Handler:    _Deej_SetVolume_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _Deej_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "ListMappings",
+			Handler:    _Deej_ListMappings_Handler,
+		},
+		{
+			MethodName: "ListPresets",
+			Handler:    _Deej_ListPresets_Handler,
+		},
+		{
+			MethodName: "SavePreset",
+			Handler:    _Deej_SavePreset_Handler,
+		},
+		{
+			MethodName: "RestorePreset",
+			Handler:    _Deej_RestorePreset_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSliderMoves",
+			Handler:       _Deej_WatchSliderMoves_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchSessions",
+			Handler:       _Deej_WatchSessions_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchConnectionState",
+			Handler:       _Deej_WatchConnectionState_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/deej/deejpb/deej.proto",
+}
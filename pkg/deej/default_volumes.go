@@ -0,0 +1,58 @@
+package deej
+
+import "sort"
+
+// applyDefaultVolumes sets newly added sessions to their configured default volume, so apps start at a sane level
+// even before a slider has moved. Sessions without an ID can't be told apart from the ones they replace, so they'd
+// be reset on every refresh and are left alone.
+func (m *sessionMap) applyDefaultVolumes(sessions []Session) {
+	defaults := m.config.DefaultVolumes
+	if len(defaults) == 0 {
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID() == "" {
+			continue
+		}
+
+		v, ok := m.defaultVolume(defaults, session)
+		if !ok {
+			continue
+		}
+
+		v = m.clampVolume(session, v)
+
+		m.logger.Debugw("Setting new session to its default volume", "session", session, "volume", v)
+
+		if err := m.setSessionVolume(session, v); err != nil {
+			m.logger.Warnw("Failed to set new session to its default volume", "session", session, "error", err)
+			continue
+		}
+
+		m.cacheVolume(session, v)
+	}
+}
+
+// defaultVolume returns the default volume of the first target matching the session, going by target name
+// so the result doesn't depend on map order
+func (m *sessionMap) defaultVolume(defaults map[string]float32, session Session) (float32, bool) {
+	if v, ok := defaults[session.Key()]; ok {
+		return v, true
+	}
+
+	targets := make([]string, 0, len(defaults))
+	for target := range defaults {
+		targets = append(targets, target)
+	}
+
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		if m.targetMatches(target, session) {
+			return defaults[target], true
+		}
+	}
+
+	return 0, false
+}
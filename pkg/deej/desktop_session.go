@@ -0,0 +1,112 @@
+package deej
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type desktopSessionEvent int
+
+const (
+	desktopSessionDisconnected desktopSessionEvent = iota
+	desktopSessionConnected
+)
+
+// desktopSessionListener receives notifications about the desktop session deej runs in from the OS
+type desktopSessionListener interface {
+	// listen calls onEvent when the session is switched away from or disconnected (another user logging in with
+	// fast user switching, a remote desktop connection taking over or ending) and when it's back, until stop is
+	// called. onEvent may be called from any goroutine.
+	listen(onEvent func(desktopSessionEvent)) error
+	stop()
+}
+
+// desktopSessionWatcher stops deej from touching audio while its desktop session isn't the one in front of the
+// user, and starts over with fresh audio objects once it is again. Audio devices belong to whichever session is
+// active, so the ones acquired before switching users or connecting over remote desktop are broken by the time
+// the session comes back.
+type desktopSessionWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	events   chan desktopSessionEvent
+	listener desktopSessionListener
+}
+
+func newDesktopSessionWatcher(deej *Deej, logger *zap.SugaredLogger) *desktopSessionWatcher {
+	logger = logger.Named("desktop_session")
+
+	dw := &desktopSessionWatcher{
+		deej:   deej,
+		logger: logger,
+		events: make(chan desktopSessionEvent, 1),
+	}
+
+	logger.Debug("Created desktop session watcher instance")
+
+	return dw
+}
+
+// start listens for the desktop session being disconnected and reconnected, if the OS announces it
+func (dw *desktopSessionWatcher) start() {
+	listener := newDesktopSessionListener(dw.logger, dw.deej.handlePanic)
+
+	onEvent := func(event desktopSessionEvent) {
+		// only the latest state matters when switching back and forth quickly
+		select {
+		case dw.events <- event:
+		default:
+			select {
+			case <-dw.events:
+			default:
+			}
+
+			dw.events <- event
+		}
+	}
+
+	if err := listener.listen(onEvent); err != nil {
+		dw.logger.Debugw("Failed to listen for desktop session changes, audio may stop working after switching users",
+			"error", err)
+		return
+	}
+
+	dw.listener = listener
+	dw.logger.Debug("Listening for desktop session changes")
+
+	dw.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-dw.events:
+				switch event {
+				case desktopSessionDisconnected:
+					dw.handleDisconnect()
+				case desktopSessionConnected:
+					dw.handleReconnect()
+				}
+			}
+		}
+	})
+}
+
+func (dw *desktopSessionWatcher) stop() {
+	if dw.listener == nil {
+		return
+	}
+
+	dw.listener.stop()
+	dw.listener = nil
+}
+
+func (dw *desktopSessionWatcher) handleDisconnect() {
+	dw.logger.Info("Desktop session disconnected, pausing audio control until it's back")
+	dw.deej.sessions.suspend()
+}
+
+func (dw *desktopSessionWatcher) handleReconnect() {
+	dw.logger.Info("Desktop session reconnected, re-acquiring audio sessions")
+	dw.deej.sessions.resume()
+}
@@ -0,0 +1,103 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	logindService           = "org.freedesktop.login1"
+	logindSessionInterface  = "org.freedesktop.login1.Session"
+	dbusPropertiesInterface = "org.freedesktop.DBus.Properties"
+	dbusPropertiesChanged   = "PropertiesChanged"
+)
+
+// logindDesktopSessionListener follows the Active property of the logind session deej runs in, which turns false
+// when another user switches to their own session on the same seat
+type logindDesktopSessionListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	conn *dbus.Conn
+	done chan struct{}
+}
+
+func newDesktopSessionListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) desktopSessionListener {
+	return &logindDesktopSessionListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *logindDesktopSessionListener) listen(onEvent func(desktopSessionEvent)) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("connect to system bus: %w", err)
+	}
+
+	var sessionPath dbus.ObjectPath
+	if err := conn.Object(logindService, logindPath).
+		Call(logindInterface+".GetSessionByPID", 0, uint32(os.Getpid())).
+		Store(&sessionPath); err != nil {
+		conn.Close()
+		return fmt.Errorf("find login session: %w", err)
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(sessionPath),
+		dbus.WithMatchInterface(dbusPropertiesInterface),
+		dbus.WithMatchMember(dbusPropertiesChanged),
+	); err != nil {
+		conn.Close()
+		return fmt.Errorf("subscribe to session changes: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+
+	l.conn = conn
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+
+		// closing the connection closes the channel
+		for signal := range signals {
+			if signal.Path != sessionPath || len(signal.Body) < 2 {
+				continue
+			}
+
+			if iface, ok := signal.Body[0].(string); !ok || iface != logindSessionInterface {
+				continue
+			}
+
+			changed, ok := signal.Body[1].(map[string]dbus.Variant)
+			if !ok {
+				continue
+			}
+
+			active, ok := changed["Active"].Value().(bool)
+			if !ok {
+				continue
+			}
+
+			if active {
+				onEvent(desktopSessionConnected)
+			} else {
+				onEvent(desktopSessionDisconnected)
+			}
+		}
+	})
+
+	return nil
+}
+
+func (l *logindDesktopSessionListener) stop() {
+	if err := l.conn.Close(); err != nil {
+		l.logger.Debugw("Failed to close system bus connection", "error", err)
+	}
+
+	<-l.done
+}
@@ -0,0 +1,173 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/lxn/win"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// values from WinUser.h and WtsApi32.h, as delivered with WM_WTSSESSION_CHANGE
+const (
+	wmWTSSessionChange   = 0x02B1
+	notifyForThisSession = 0
+	wtsConsoleConnect    = 0x1
+	wtsConsoleDisconnect = 0x2
+	wtsRemoteConnect     = 0x3
+	wtsRemoteDisconnect  = 0x4
+)
+
+const desktopSessionClassName = "deejDesktopSessionWindow"
+
+var (
+	wtsapi32                             = syscall.NewLazyDLL("wtsapi32.dll")
+	procWTSRegisterSessionNotification   = wtsapi32.NewProc("WTSRegisterSessionNotification")
+	procWTSUnregisterSessionNotification = wtsapi32.NewProc("WTSUnRegisterSessionNotification")
+
+	// Windows never frees callbacks, so every listener's window shares this one and finds its handler
+	// through desktopSessionHandlers
+	desktopSessionWndProc = syscall.NewCallback(desktopSessionWindowProc)
+
+	desktopSessionHandlersLock sync.Mutex
+	desktopSessionHandlers     = make(map[win.HWND]func(desktopSessionEvent))
+
+	registerDesktopSessionClass sync.Once
+	desktopSessionClassErr      error
+)
+
+// wtsDesktopSessionListener receives WM_WTSSESSION_CHANGE, which is only sent to windows. It creates a message-only
+// window on a dedicated, locked OS thread, which also runs its message loop.
+type wtsDesktopSessionListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	threadID uint32
+	done     chan struct{}
+}
+
+func newDesktopSessionListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) desktopSessionListener {
+	return &wtsDesktopSessionListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *wtsDesktopSessionListener) listen(onEvent func(desktopSessionEvent)) error {
+	ready := make(chan error, 1)
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(l.done)
+
+		l.threadID = win.GetCurrentThreadId()
+
+		hwnd, err := createDesktopSessionWindow()
+		if err != nil {
+			ready <- err
+			return
+		}
+
+		defer win.DestroyWindow(hwnd)
+
+		desktopSessionHandlersLock.Lock()
+		desktopSessionHandlers[hwnd] = func(event desktopSessionEvent) {
+			defer util.Recover(l.onPanic)
+			onEvent(event)
+		}
+		desktopSessionHandlersLock.Unlock()
+
+		defer func() {
+			desktopSessionHandlersLock.Lock()
+			delete(desktopSessionHandlers, hwnd)
+			desktopSessionHandlersLock.Unlock()
+		}()
+
+		if result, _, err := procWTSRegisterSessionNotification.Call(uintptr(hwnd), notifyForThisSession); result == 0 {
+			ready <- fmt.Errorf("register for session notifications: %w", err)
+			return
+		}
+
+		defer procWTSUnregisterSessionNotification.Call(uintptr(hwnd))
+
+		close(ready)
+
+		var msg win.MSG
+		for win.GetMessage(&msg, 0, 0, 0) > 0 {
+			win.TranslateMessage(&msg)
+			win.DispatchMessage(&msg)
+		}
+	})
+
+	return <-ready
+}
+
+func (l *wtsDesktopSessionListener) stop() {
+	if result, _, err := procPostThreadMsg.Call(uintptr(l.threadID), win.WM_QUIT, 0, 0); result == 0 {
+		l.logger.Warnw("Failed to stop desktop session message loop", "error", err)
+		return
+	}
+
+	<-l.done
+}
+
+// createDesktopSessionWindow creates a message-only window, which can't be seen but still receives the messages
+// sent straight to it
+func createDesktopSessionWindow() (win.HWND, error) {
+	className := syscall.StringToUTF16Ptr(desktopSessionClassName)
+	instance := win.GetModuleHandle(nil)
+
+	registerDesktopSessionClass.Do(func() {
+		class := win.WNDCLASSEX{
+			LpfnWndProc:   desktopSessionWndProc,
+			HInstance:     instance,
+			LpszClassName: className,
+		}
+		class.CbSize = uint32(unsafe.Sizeof(class))
+
+		if win.RegisterClassEx(&class) == 0 {
+			desktopSessionClassErr = errors.New("register desktop session window class")
+		}
+	})
+
+	if desktopSessionClassErr != nil {
+		return 0, desktopSessionClassErr
+	}
+
+	hwnd := win.CreateWindowEx(0, className, nil, 0, 0, 0, 0, 0, win.HWND_MESSAGE, 0, instance, nil)
+	if hwnd == 0 {
+		return 0, errors.New("create desktop session window")
+	}
+
+	return hwnd, nil
+}
+
+// desktopSessionWindowProc handles the messages of every listener's window. Locking the workstation also sends
+// WM_WTSSESSION_CHANGE, but audio keeps playing to a locked session, so only connecting and disconnecting count.
+func desktopSessionWindowProc(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	if msg != wmWTSSessionChange {
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	}
+
+	desktopSessionHandlersLock.Lock()
+	onEvent := desktopSessionHandlers[hwnd]
+	desktopSessionHandlersLock.Unlock()
+
+	if onEvent == nil {
+		return 0
+	}
+
+	switch wParam {
+	case wtsConsoleDisconnect, wtsRemoteDisconnect:
+		onEvent(desktopSessionDisconnected)
+	case wtsConsoleConnect, wtsRemoteConnect:
+		onEvent(desktopSessionConnected)
+	}
+
+	return 0
+}
@@ -0,0 +1,74 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// channelTargetPrefix sets one channel of the master device relative to its volume, e.g. "channel:lfe" for a knob
+// that rides the subwoofer's level on a 5.1 or 7.1 device
+const channelTargetPrefix = "channel"
+
+// the channels channel: targets can set, besides the front left and right ones that left: and right: cover
+const (
+	deviceChannelCenter    = "center"
+	deviceChannelLFE       = "lfe"
+	deviceChannelRearLeft  = "rear_left"
+	deviceChannelRearRight = "rear_right"
+	deviceChannelSideLeft  = "side_left"
+	deviceChannelSideRight = "side_right"
+)
+
+// deviceChannelNames maps the names channel: targets accept to the channel they set
+var deviceChannelNames = map[string]string{
+	deviceChannelCenter:    deviceChannelCenter,
+	deviceChannelLFE:       deviceChannelLFE,
+	"sub":                  deviceChannelLFE,
+	"subwoofer":            deviceChannelLFE,
+	deviceChannelRearLeft:  deviceChannelRearLeft,
+	deviceChannelRearRight: deviceChannelRearRight,
+	deviceChannelSideLeft:  deviceChannelSideLeft,
+	deviceChannelSideRight: deviceChannelSideRight,
+}
+
+var errDeviceChannelMissing = errors.New("device doesn't have that channel")
+
+// deviceChannelSession is implemented by devices whose individual channels can be set apart
+type deviceChannelSession interface {
+	// setDeviceChannelGain sets how loud a channel is relative to the device's volume, from 0 to 1, returning
+	// errDeviceChannelMissing if the device doesn't have it. Later volume changes keep to the gain, which combines
+	// with the left and right gains for channels on either side.
+	setDeviceChannelGain(channel string, gain float32) error
+}
+
+// setDeviceChannel handles channel:<name> targets, where the slider sets the channel's gain from silent to the
+// device's volume
+func (pc *panControl) setDeviceChannel(name string, v float32) error {
+	channel, ok := deviceChannelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("unknown channel %q", name)
+	}
+
+	sessions, ok := pc.deej.sessions.get(masterSessionName)
+	if !ok {
+		pc.logger.Debugw("No master device to set channel of", "channel", channel)
+		return nil
+	}
+
+	var errs []error
+
+	for _, session := range sessions {
+		device, ok := session.(deviceChannelSession)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", session.Key(), errChannelsUnsupported))
+			continue
+		}
+
+		if err := device.setDeviceChannelGain(channel, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", session.Key(), channel, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
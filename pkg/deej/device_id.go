@@ -0,0 +1,79 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A device ID finds a board's serial port by the USB device behind it, since COM port numbers and tty names
+// shift between USB ports and reboots. It's either a vendor and product ID in hex, such as "2341:8036", or the
+// USB serial number of one particular board, for telling apart several boards of the same kind
+
+// parseUSBID parses a USB vendor and product ID pair in hex, such as "2341:8036"
+func parseUSBID(id string) (usbID, error) {
+	vendor, product, ok := strings.Cut(id, ":")
+	if !ok {
+		return usbID{}, fmt.Errorf("invalid USB ID %q (expected vendor:product, e.g. 2341:8036)", id)
+	}
+
+	vendorID, vendorErr := strconv.ParseUint(vendor, 16, 16)
+	productID, productErr := strconv.ParseUint(product, 16, 16)
+	if vendorErr != nil || productErr != nil {
+		return usbID{}, fmt.Errorf("invalid USB ID %q (expected vendor:product, e.g. 2341:8036)", id)
+	}
+
+	return usbID{uint16(vendorID), uint16(productID)}, nil
+}
+
+func (id usbID) String() string {
+	return fmt.Sprintf("%04x:%04x", id.vendor, id.product)
+}
+
+// normalizeDeviceID checks a device ID, returning USB IDs in their canonical form and serial numbers as they are
+func normalizeDeviceID(deviceID string) (string, error) {
+	deviceID = strings.TrimSpace(deviceID)
+
+	if !strings.Contains(deviceID, ":") {
+		return deviceID, nil
+	}
+
+	id, err := parseUSBID(deviceID)
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// matches returns whether the port belongs to the USB device with the given (normalized) ID
+func (port usbSerialPort) matches(deviceID string) bool {
+	if strings.Contains(deviceID, ":") {
+		return port.id.String() == deviceID
+	}
+
+	return port.serialNumber != "" && strings.EqualFold(port.serialNumber, deviceID)
+}
+
+// findDevicePort returns the serial port of the USB device with the given ID
+func findDevicePort(deviceID string) (string, error) {
+	deviceID, err := normalizeDeviceID(deviceID)
+	if err != nil {
+		return "", err
+	}
+
+	ports, err := listUSBSerialPorts()
+	if err != nil {
+		return "", fmt.Errorf("list serial ports: %w", err)
+	}
+
+	for _, port := range ports {
+		if port.matches(deviceID) {
+			return port.name, nil
+		}
+	}
+
+	// like a configured port that doesn't exist, so the board is connected once it's plugged in rather than given up on
+	return "", fmt.Errorf("no serial port for USB device %s (is it plugged in?): %w", deviceID, os.ErrNotExist)
+}
@@ -0,0 +1,61 @@
+package deej
+
+import "testing"
+
+func TestParseUSBID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"2341:8036", "2341:8036", false},
+		{"1A86:7523", "1a86:7523", false},
+		{"403:6001", "0403:6001", false},
+		{"2341", "", true},
+		{"2341:", "", true},
+		{"12345:8036", "", true},
+		{"vid:pid", "", true},
+	}
+
+	for _, test := range tests {
+		id, err := parseUSBID(test.id)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseUSBID(%q) error = %v, want error: %t", test.id, err, test.wantErr)
+			continue
+		}
+
+		if err == nil && id.String() != test.want {
+			t.Errorf("parseUSBID(%q) = %s, want %s", test.id, id, test.want)
+		}
+	}
+}
+
+func TestUSBSerialPortMatches(t *testing.T) {
+	port := usbSerialPort{name: "COM4", id: usbID{0x2341, 0x8036}, serialNumber: "95735353036351D0B1B1"}
+
+	tests := []struct {
+		deviceID string
+		want     bool
+	}{
+		{"2341:8036", true},
+		{"2341:0043", false},
+		{"95735353036351D0B1B1", true},
+		{"95735353036351d0b1b1", true},
+		{"OTHER", false},
+	}
+
+	for _, test := range tests {
+		deviceID, err := normalizeDeviceID(test.deviceID)
+		if err != nil {
+			t.Fatalf("normalizeDeviceID(%q): %v", test.deviceID, err)
+		}
+
+		if got := port.matches(deviceID); got != test.want {
+			t.Errorf("matches(%q) = %t, want %t", test.deviceID, got, test.want)
+		}
+	}
+
+	if (usbSerialPort{name: "COM5", id: usbID{0x1a86, 0x7523}}).matches("") {
+		t.Error("port without a serial number matches an empty device ID")
+	}
+}
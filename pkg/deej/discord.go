@@ -0,0 +1,909 @@
+package deej
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// discordTargetPrefix addresses the people in your Discord voice channel by name, e.g. "discord:alice"
+	discordTargetPrefix = "discord"
+
+	// discordSpeakingTarget can be used in duck.when, to lower other apps while someone else talks in your voice channel
+	discordSpeakingTarget = discordTargetPrefix + ":speaking"
+
+	discordReconnectInterval = 10 * time.Second
+	discordRequestTimeout    = 5 * time.Second
+
+	// the first time deej connects, Discord asks the user to approve it, which can take a while
+	discordAuthorizeTimeout = 2 * time.Minute
+
+	// Discord listens on the first free one of discord-ipc-0 to discord-ipc-9
+	discordIPCSockets = 10
+
+	// the top of a slider sets people to 100%, Discord's default. Boosting them beyond that is left to Discord
+	discordUserVolumeMax = 100
+
+	discordMaxFrameSize = 1 << 20
+
+	discordTokenURL = "https://discord.com/api/oauth2/token"
+
+	// has to be added as a redirect of the user's app on the developer portal, though nothing is ever sent to it
+	discordRedirectURI = "http://localhost"
+
+	// IPC opcodes
+	discordOpHandshake = 0
+	discordOpFrame     = 1
+	discordOpClose     = 2
+	discordOpPing      = 3
+	discordOpPong      = 4
+
+	discordRPCVersion = 1
+)
+
+// RPC commands and events
+const (
+	discordCmdDispatch        = "DISPATCH"
+	discordCmdAuthorize       = "AUTHORIZE"
+	discordCmdAuthenticate    = "AUTHENTICATE"
+	discordCmdSubscribe       = "SUBSCRIBE"
+	discordCmdUnsubscribe     = "UNSUBSCRIBE"
+	discordCmdGetChannel      = "GET_CHANNEL"
+	discordCmdSelectedChannel = "GET_SELECTED_VOICE_CHANNEL"
+	discordCmdGetVoice        = "GET_VOICE_SETTINGS"
+	discordCmdSetVoice        = "SET_VOICE_SETTINGS"
+	discordCmdSetUserVoice    = "SET_USER_VOICE_SETTINGS"
+
+	discordEvtReady         = "READY"
+	discordEvtError         = "ERROR"
+	discordEvtVoiceSettings = "VOICE_SETTINGS_UPDATE"
+	discordEvtChannelSelect = "VOICE_CHANNEL_SELECT"
+	discordEvtStateCreate   = "VOICE_STATE_CREATE"
+	discordEvtStateUpdate   = "VOICE_STATE_UPDATE"
+	discordEvtStateDelete   = "VOICE_STATE_DELETE"
+	discordEvtSpeakingStart = "SPEAKING_START"
+	discordEvtSpeakingStop  = "SPEAKING_STOP"
+)
+
+// the events deej subscribes to for the voice channel the user is in
+var discordChannelEvents = []string{
+	discordEvtStateCreate,
+	discordEvtStateUpdate,
+	discordEvtStateDelete,
+	discordEvtSpeakingStart,
+	discordEvtSpeakingStop,
+}
+
+var discordScopes = []string{"rpc", "rpc.voice.read", "rpc.voice.write"}
+
+var (
+	errDiscordNotConnected = errors.New("discord: not connected")
+	errDiscordNotRunning   = errors.New("discord isn't running")
+	errDiscordUnauthorized = errors.New("discord: not authorized")
+)
+
+// discordClient talks to the Discord desktop app over its local RPC interface, so buttons can toggle self-mute and
+// deafen, sliders can set the volume of people in the voice channel, and ducking can follow who's talking
+type discordClient struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock      sync.Mutex
+	writeLock sync.Mutex
+	conn      io.ReadWriteCloser
+	info      DiscordInfo
+	cancel    context.CancelFunc // stops the current connection loop
+
+	nonce   uint64
+	replies map[string]chan discordMessage // for requests waiting on their reply, by nonce
+
+	// Discord's voice state as far as deej knows it, kept up to date by events
+	selfID    string
+	voice     discordVoiceSettings
+	channelID string                       // empty while not in a voice channel
+	members   map[string]discordVoiceState // the people in the voice channel, by user ID
+	speaking  map[string]bool              // the user IDs of members who are talking
+}
+
+type discordMessage struct {
+	Cmd   string          `json:"cmd"`
+	Nonce string          `json:"nonce,omitempty"`
+	Evt   string          `json:"evt,omitempty"`
+	Args  interface{}     `json:"args,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+type discordError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type discordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+// discordVoiceState describes someone in a voice channel, both in channel info and in VOICE_STATE_* events
+type discordVoiceState struct {
+	Nick string      `json:"nick"`
+	User discordUser `json:"user"`
+}
+
+type discordChannel struct {
+	ID          string              `json:"id"`
+	VoiceStates []discordVoiceState `json:"voice_states"`
+}
+
+type discordVoiceSettings struct {
+	Mute bool `json:"mute"`
+	Deaf bool `json:"deaf"`
+}
+
+type discordReady struct {
+	User discordUser `json:"user"`
+}
+
+type discordChannelSelect struct {
+	ChannelID string `json:"channel_id"` // null when leaving voice
+}
+
+type discordSpeaking struct {
+	UserID string `json:"user_id"`
+}
+
+type discordAuthorization struct {
+	Code string `json:"code"`
+}
+
+type discordTokenReply struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func newDiscordClient(deej *Deej, logger *zap.SugaredLogger) *discordClient {
+	logger = logger.Named("discord")
+
+	dc := &discordClient{
+		deej:    deej,
+		logger:  logger,
+		replies: make(map[string]chan discordMessage),
+	}
+
+	logger.Debug("Created Discord client instance")
+
+	return dc
+}
+
+// initialize registers the discord: target prefix and watches for config changes
+func (dc *discordClient) initialize() {
+	dc.deej.sessions.registerExternalTarget(discordTargetPrefix, dc.setUserVolume)
+	dc.setupOnConfigReload()
+}
+
+// start keeps a connection to Discord open in the background, if enabled
+func (dc *discordClient) start() {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	info := dc.deej.config.DiscordInfo
+	if !info.Enabled {
+		dc.logger.Debug("Discord integration disabled in config, not starting")
+		return
+	}
+
+	if dc.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(dc.deej.routines.ctx)
+	dc.info = info
+	dc.cancel = cancel
+
+	dc.deej.spawn(func(context.Context) error {
+		dc.connectLoop(ctx, info)
+		return nil
+	})
+}
+
+// stop closes the connection to Discord and stops reconnecting
+func (dc *discordClient) stop() {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.cancel == nil {
+		return
+	}
+
+	dc.logger.Debug("Stopping Discord integration")
+	dc.cancel()
+	dc.cancel = nil
+
+	if dc.conn != nil {
+		dc.conn.Close()
+	}
+}
+
+func (dc *discordClient) setupOnConfigReload() {
+	configReloadedChannel := dc.deej.events.configReloaded.subscribe()
+
+	dc.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				dc.lock.Lock()
+				needsRestart := dc.cancel != nil && !dc.info.sameConnection(dc.deej.config.DiscordInfo)
+				dc.lock.Unlock()
+
+				if needsRestart {
+					dc.logger.Info("Discord settings changed, reconnecting")
+					dc.stop()
+				}
+
+				dc.start()
+			}
+		}
+	})
+}
+
+// connectLoop (re)connects to Discord until ctx is done
+func (dc *discordClient) connectLoop(ctx context.Context, info DiscordInfo) {
+	for {
+		err := dc.runConnection(ctx, info)
+
+		// asking again right away would only pop up another request in Discord for the user to dismiss
+		if errors.Is(err, errDiscordUnauthorized) {
+			dc.logger.Warnw("Discord didn't authorize deej, not retrying until its settings change", "error", err)
+			dc.deej.notifier.Notify(tr("notify.discordFailed"), tr("notify.discordFailedMessage"))
+			return
+		}
+
+		if err != nil {
+			dc.logger.Debugw("Discord connection failed, will retry", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(discordReconnectInterval):
+		}
+	}
+}
+
+// runConnection connects to Discord and follows its voice state until the connection closes or ctx is done
+func (dc *discordClient) runConnection(ctx context.Context, info DiscordInfo) error {
+	conn, selfID, err := dc.connect(info)
+	if err != nil {
+		return err
+	}
+
+	dc.lock.Lock()
+	select {
+	case <-ctx.Done():
+		dc.lock.Unlock()
+		conn.Close()
+		return nil
+	default:
+		dc.conn = conn
+		dc.selfID = selfID
+	}
+	dc.lock.Unlock()
+
+	defer dc.disconnect(conn)
+
+	channelChanges := make(chan string, 1)
+	readLoopDone := make(chan struct{})
+
+	util.Go(dc.deej.handlePanic, func() {
+		defer close(readLoopDone)
+		defer dc.disconnect(conn)
+
+		dc.readLoop(conn, channelChanges)
+	})
+
+	if err := dc.authenticate(info); err != nil {
+		return fmt.Errorf("%w: %w", errDiscordUnauthorized, err)
+	}
+
+	if err := dc.watchVoice(); err != nil {
+		return err
+	}
+
+	dc.logger.Info("Connected to Discord")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-readLoopDone:
+			dc.logger.Info("Disconnected from Discord")
+			return nil
+		case channelID := <-channelChanges:
+			dc.watchChannel(channelID)
+		}
+	}
+}
+
+// connect opens Discord's IPC socket and completes the handshake, returning the connection and the user's ID
+func (dc *discordClient) connect(info DiscordInfo) (io.ReadWriteCloser, string, error) {
+	if info.ClientID == "" || info.ClientSecret == "" {
+		return nil, "", fmt.Errorf("%w: discord.client_id and discord.client_secret have to be set", errDiscordUnauthorized)
+	}
+
+	conn, err := dialDiscord()
+	if err != nil {
+		return nil, "", fmt.Errorf("dial: %w", err)
+	}
+
+	handshake := map[string]interface{}{"v": discordRPCVersion, "client_id": info.ClientID}
+	if err := writeDiscordFrame(conn, discordOpHandshake, handshake); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("send handshake: %w", err)
+	}
+
+	// Discord answers with a READY event, or closes the connection if it doesn't like the handshake
+	op, payload, err := readDiscordFrame(conn)
+	if err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("read handshake reply: %w", err)
+	}
+
+	var message discordMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("parse handshake reply: %w", err)
+	}
+
+	if op != discordOpFrame || message.Evt != discordEvtReady {
+		conn.Close()
+		return nil, "", fmt.Errorf("handshake rejected (wrong client_id?): %s", payload)
+	}
+
+	var ready discordReady
+	if err := json.Unmarshal(message.Data, &ready); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("parse ready event: %w", err)
+	}
+
+	return conn, ready.User.ID, nil
+}
+
+// disconnect closes the connection and forgets what Discord told us over it. Requests still waiting
+// for a reply fail right away.
+func (dc *discordClient) disconnect(conn io.ReadWriteCloser) {
+	conn.Close()
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	for nonce, reply := range dc.replies {
+		close(reply)
+		delete(dc.replies, nonce)
+	}
+
+	if dc.conn != conn {
+		return
+	}
+
+	dc.conn = nil
+	dc.voice = discordVoiceSettings{}
+	dc.channelID = ""
+	dc.members = nil
+	dc.speaking = nil
+}
+
+// authenticate proves to Discord that the user lets deej control it, using the saved token if it still works.
+// Otherwise Discord asks the user to approve deej, and the new token is saved for next time.
+func (dc *discordClient) authenticate(info DiscordInfo) error {
+	token := dc.deej.config.DiscordToken()
+
+	if token.AccessToken != "" {
+		err := dc.request(discordMessage{
+			Cmd:  discordCmdAuthenticate,
+			Args: map[string]string{"access_token": token.AccessToken},
+		}, nil, discordRequestTimeout)
+		if err == nil {
+			return nil
+		}
+
+		dc.logger.Debugw("Saved Discord token was rejected", "error", err)
+
+		if token.RefreshToken != "" {
+			refreshed, err := dc.exchangeToken(info, url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {token.RefreshToken},
+			})
+			if err == nil {
+				return dc.useToken(refreshed)
+			}
+
+			dc.logger.Debugw("Failed to refresh Discord token", "error", err)
+		}
+	}
+
+	dc.logger.Info("Asking for permission to control Discord")
+	dc.deej.notifier.Notify(tr("notify.discordApprove"), tr("notify.discordApproveMessage"))
+
+	var authorization discordAuthorization
+	if err := dc.request(discordMessage{
+		Cmd:  discordCmdAuthorize,
+		Args: map[string]interface{}{"client_id": info.ClientID, "scopes": discordScopes},
+	}, &authorization, discordAuthorizeTimeout); err != nil {
+		return fmt.Errorf("authorize: %w", err)
+	}
+
+	token, err := dc.exchangeToken(info, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {authorization.Code},
+		"redirect_uri": {discordRedirectURI},
+	})
+	if err != nil {
+		return err
+	}
+
+	return dc.useToken(token)
+}
+
+// useToken saves a new token and authenticates with it
+func (dc *discordClient) useToken(token DiscordToken) error {
+	if err := dc.deej.config.SaveDiscordToken(token); err != nil {
+		dc.logger.Warnw("Failed to save Discord token, Discord will ask to approve deej again next time", "error", err)
+	}
+
+	return dc.request(discordMessage{
+		Cmd:  discordCmdAuthenticate,
+		Args: map[string]string{"access_token": token.AccessToken},
+	}, nil, discordRequestTimeout)
+}
+
+// exchangeToken asks Discord's OAuth2 endpoint for a token, with either an authorization code or a refresh token
+func (dc *discordClient) exchangeToken(info DiscordInfo, form url.Values) (DiscordToken, error) {
+	form.Set("client_id", info.ClientID)
+	form.Set("client_secret", info.ClientSecret)
+
+	ctx, cancel := context.WithTimeout(context.Background(), discordRequestTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discordTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return DiscordToken{}, fmt.Errorf("create token request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return DiscordToken{}, fmt.Errorf("request token: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return DiscordToken{}, fmt.Errorf("request token: %s (check discord.client_secret): %s", response.Status, body)
+	}
+
+	var reply discordTokenReply
+	if err := json.NewDecoder(response.Body).Decode(&reply); err != nil {
+		return DiscordToken{}, fmt.Errorf("parse token: %w", err)
+	}
+
+	return DiscordToken{AccessToken: reply.AccessToken, RefreshToken: reply.RefreshToken}, nil
+}
+
+// watchVoice learns the user's voice settings and voice channel, and subscribes to changes in both
+func (dc *discordClient) watchVoice() error {
+	var settings discordVoiceSettings
+	if err := dc.request(discordMessage{Cmd: discordCmdGetVoice}, &settings, discordRequestTimeout); err != nil {
+		return fmt.Errorf("get voice settings: %w", err)
+	}
+
+	dc.lock.Lock()
+	dc.voice = settings
+	dc.lock.Unlock()
+
+	for _, event := range []string{discordEvtVoiceSettings, discordEvtChannelSelect} {
+		if err := dc.request(discordMessage{Cmd: discordCmdSubscribe, Evt: event}, nil, discordRequestTimeout); err != nil {
+			return fmt.Errorf("subscribe to %s: %w", event, err)
+		}
+	}
+
+	// null while the user isn't in a voice channel
+	var channel *discordChannel
+	if err := dc.request(discordMessage{Cmd: discordCmdSelectedChannel}, &channel, discordRequestTimeout); err != nil {
+		return fmt.Errorf("get voice channel: %w", err)
+	}
+
+	dc.joinChannel(channel)
+
+	return nil
+}
+
+// watchChannel follows the user into another voice channel, or out of voice if channelID is empty
+func (dc *discordClient) watchChannel(channelID string) {
+	dc.lock.Lock()
+	previous := dc.channelID
+	dc.lock.Unlock()
+
+	if previous != "" {
+		for _, event := range discordChannelEvents {
+			if err := dc.request(discordMessage{
+				Cmd:  discordCmdUnsubscribe,
+				Evt:  event,
+				Args: map[string]string{"channel_id": previous},
+			}, nil, discordRequestTimeout); err != nil {
+				dc.logger.Debugw("Failed to unsubscribe from voice channel event", "event", event, "error", err)
+			}
+		}
+	}
+
+	var channel *discordChannel
+
+	if channelID != "" {
+		if err := dc.request(discordMessage{
+			Cmd:  discordCmdGetChannel,
+			Args: map[string]string{"channel_id": channelID},
+		}, &channel, discordRequestTimeout); err != nil {
+			dc.logger.Warnw("Failed to get Discord voice channel", "error", err)
+		}
+	}
+
+	dc.joinChannel(channel)
+}
+
+// joinChannel replaces what deej knows about the voice channel, and subscribes to its events
+func (dc *discordClient) joinChannel(channel *discordChannel) {
+	dc.lock.Lock()
+	dc.channelID = ""
+	dc.members = make(map[string]discordVoiceState)
+	dc.speaking = make(map[string]bool)
+
+	if channel != nil {
+		dc.channelID = channel.ID
+
+		for _, member := range channel.VoiceStates {
+			dc.members[member.User.ID] = member
+		}
+	}
+	dc.lock.Unlock()
+
+	if channel == nil {
+		dc.logger.Debug("Not in a Discord voice channel")
+		return
+	}
+
+	dc.logger.Debugw("Watching Discord voice channel", "channel", channel.ID, "members", len(channel.VoiceStates))
+
+	for _, event := range discordChannelEvents {
+		if err := dc.request(discordMessage{
+			Cmd:  discordCmdSubscribe,
+			Evt:  event,
+			Args: map[string]string{"channel_id": channel.ID},
+		}, nil, discordRequestTimeout); err != nil {
+			dc.logger.Warnw("Failed to subscribe to voice channel event", "event", event, "error", err)
+		}
+	}
+}
+
+// readLoop handles everything Discord sends until the connection closes. Channel changes are passed on to
+// channelChanges, since following them takes requests whose replies only the read loop can receive.
+func (dc *discordClient) readLoop(conn io.ReadWriteCloser, channelChanges chan string) {
+	for {
+		op, payload, err := readDiscordFrame(conn)
+		if err != nil {
+			dc.logger.Debugw("Discord connection closed", "error", err)
+			return
+		}
+
+		switch op {
+		case discordOpPing:
+			dc.writeLock.Lock()
+			err := writeDiscordFrame(conn, discordOpPong, json.RawMessage(payload))
+			dc.writeLock.Unlock()
+
+			if err != nil {
+				dc.logger.Debugw("Failed to answer Discord ping", "error", err)
+			}
+
+		case discordOpClose:
+			dc.logger.Debugw("Discord closed the connection", "reason", string(payload))
+			return
+
+		case discordOpFrame:
+			var message discordMessage
+			if err := json.Unmarshal(payload, &message); err != nil {
+				dc.logger.Debugw("Failed to parse Discord message", "error", err)
+				continue
+			}
+
+			if message.Cmd == discordCmdDispatch {
+				dc.handleEvent(message, channelChanges)
+			} else {
+				dc.handleReply(message)
+			}
+		}
+	}
+}
+
+func (dc *discordClient) handleReply(message discordMessage) {
+	dc.lock.Lock()
+	reply, ok := dc.replies[message.Nonce]
+	delete(dc.replies, message.Nonce)
+	dc.lock.Unlock()
+
+	if ok {
+		reply <- message
+	}
+}
+
+func (dc *discordClient) handleEvent(message discordMessage, channelChanges chan string) {
+	switch message.Evt {
+	case discordEvtVoiceSettings:
+		var settings discordVoiceSettings
+		if err := json.Unmarshal(message.Data, &settings); err == nil {
+			dc.lock.Lock()
+			dc.voice = settings
+			dc.lock.Unlock()
+		}
+
+	case discordEvtChannelSelect:
+		var selected discordChannelSelect
+		if err := json.Unmarshal(message.Data, &selected); err != nil {
+			return
+		}
+
+		// only the latest channel matters if the user hops around faster than deej keeps up
+		select {
+		case <-channelChanges:
+		default:
+		}
+
+		channelChanges <- selected.ChannelID
+
+	case discordEvtStateCreate, discordEvtStateUpdate, discordEvtStateDelete:
+		var member discordVoiceState
+		if err := json.Unmarshal(message.Data, &member); err != nil {
+			return
+		}
+
+		dc.lock.Lock()
+		defer dc.lock.Unlock()
+
+		if dc.members == nil {
+			return
+		}
+
+		if message.Evt == discordEvtStateDelete {
+			delete(dc.members, member.User.ID)
+			delete(dc.speaking, member.User.ID)
+		} else {
+			dc.members[member.User.ID] = member
+		}
+
+	case discordEvtSpeakingStart, discordEvtSpeakingStop:
+		var speaking discordSpeaking
+		if err := json.Unmarshal(message.Data, &speaking); err != nil {
+			return
+		}
+
+		dc.lock.Lock()
+		defer dc.lock.Unlock()
+
+		if dc.speaking == nil {
+			return
+		}
+
+		if message.Evt == discordEvtSpeakingStart {
+			dc.speaking[speaking.UserID] = true
+		} else {
+			delete(dc.speaking, speaking.UserID)
+		}
+	}
+}
+
+// request sends a command and waits for its reply, decoding the reply's data into result unless it's nil
+func (dc *discordClient) request(message discordMessage, result interface{}, timeout time.Duration) error {
+	reply := make(chan discordMessage, 1)
+
+	dc.lock.Lock()
+	conn := dc.conn
+	dc.nonce++
+	message.Nonce = strconv.FormatUint(dc.nonce, 10)
+
+	if conn != nil {
+		dc.replies[message.Nonce] = reply
+	}
+	dc.lock.Unlock()
+
+	if conn == nil {
+		return errDiscordNotConnected
+	}
+
+	dc.writeLock.Lock()
+	err := writeDiscordFrame(conn, discordOpFrame, message)
+	dc.writeLock.Unlock()
+
+	if err != nil {
+		dc.forgetRequest(message.Nonce)
+		return fmt.Errorf("send %s: %w", message.Cmd, err)
+	}
+
+	select {
+	case response, ok := <-reply:
+		if !ok {
+			return errDiscordNotConnected
+		}
+
+		message = response
+	case <-time.After(timeout):
+		dc.forgetRequest(message.Nonce)
+		return fmt.Errorf("%s timed out", message.Cmd)
+	}
+
+	if message.Evt == discordEvtError {
+		var discordErr discordError
+		json.Unmarshal(message.Data, &discordErr)
+
+		return fmt.Errorf("%s: %s (code %d)", message.Cmd, discordErr.Message, discordErr.Code)
+	}
+
+	if result != nil && len(message.Data) > 0 {
+		if err := json.Unmarshal(message.Data, result); err != nil {
+			return fmt.Errorf("parse %s reply: %w", message.Cmd, err)
+		}
+	}
+
+	return nil
+}
+
+func (dc *discordClient) forgetRequest(nonce string) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	delete(dc.replies, nonce)
+}
+
+// setUserVolume handles discord:<name> targets, where the name is someone's server nickname, display name
+// or username. Nobody by that name being in the voice channel isn't an error, since people come and go.
+func (dc *discordClient) setUserVolume(name string, v float32) error {
+	dc.lock.Lock()
+	connected := dc.conn != nil
+
+	var userIDs []string
+	for userID, member := range dc.members {
+		if userID != dc.selfID && member.matches(name) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	dc.lock.Unlock()
+
+	if !connected {
+		return errDiscordNotConnected
+	}
+
+	if len(userIDs) == 0 {
+		dc.logger.Debugw("Nobody in the voice channel by that name", "name", name)
+		return nil
+	}
+
+	var errs []error
+	for _, userID := range userIDs {
+		if err := dc.request(discordMessage{
+			Cmd:  discordCmdSetUserVoice,
+			Args: map[string]interface{}{"user_id": userID, "volume": v * discordUserVolumeMax},
+		}, nil, discordRequestTimeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// toggleMute toggles the user's self-mute
+func (dc *discordClient) toggleMute() error {
+	dc.lock.Lock()
+	muted := dc.voice.Mute
+	dc.lock.Unlock()
+
+	return dc.setVoiceSettings(map[string]bool{"mute": !muted})
+}
+
+// toggleDeafen toggles the user's self-deafen, which Discord also mutes them for
+func (dc *discordClient) toggleDeafen() error {
+	dc.lock.Lock()
+	deafened := dc.voice.Deaf
+	dc.lock.Unlock()
+
+	return dc.setVoiceSettings(map[string]bool{"deaf": !deafened})
+}
+
+func (dc *discordClient) setVoiceSettings(settings map[string]bool) error {
+	var updated discordVoiceSettings
+	if err := dc.request(discordMessage{Cmd: discordCmdSetVoice, Args: settings}, &updated, discordRequestTimeout); err != nil {
+		return err
+	}
+
+	dc.lock.Lock()
+	dc.voice = updated
+	dc.lock.Unlock()
+
+	dc.logger.Debugw("Changed Discord voice settings", "mute", updated.Mute, "deaf", updated.Deaf)
+
+	return nil
+}
+
+// othersSpeaking returns whether anyone other than the user is talking in their voice channel
+func (dc *discordClient) othersSpeaking() bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	for userID := range dc.speaking {
+		if userID != dc.selfID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (member discordVoiceState) matches(name string) bool {
+	for _, candidate := range []string{member.Nick, member.User.GlobalName, member.User.Username} {
+		if candidate != "" && strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeDiscordFrame writes an IPC frame: the opcode and payload length as little-endian 32-bit integers,
+// followed by the JSON payload
+func writeDiscordFrame(w io.Writer, op uint32, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal discord message: %w", err)
+	}
+
+	frame := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(frame[0:], op)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(data)))
+
+	_, err = w.Write(append(frame, data...))
+	return err
+}
+
+func readDiscordFrame(r io.Reader) (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	op := binary.LittleEndian.Uint32(header[0:])
+	length := binary.LittleEndian.Uint32(header[4:])
+
+	if length > discordMaxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large (%d bytes)", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return op, payload, nil
+}
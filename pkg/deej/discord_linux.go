@@ -0,0 +1,37 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// where Discord puts its IPC socket under the runtime directory, when installed natively, as a Flatpak or as a Snap
+var discordSocketSubdirs = []string{"", "app/com.discordapp.Discord", "snap.discord"}
+
+// dialDiscord connects to the IPC socket of the running Discord client
+func dialDiscord() (io.ReadWriteCloser, error) {
+	var dirs []string
+	for _, variable := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(variable); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	dirs = append(dirs, "/tmp")
+
+	for _, dir := range dirs {
+		for _, subdir := range discordSocketSubdirs {
+			for i := 0; i < discordIPCSockets; i++ {
+				conn, err := net.Dial("unix", filepath.Join(dir, subdir, fmt.Sprintf("discord-ipc-%d", i)))
+				if err == nil {
+					return conn, nil
+				}
+			}
+		}
+	}
+
+	return nil, errDiscordNotRunning
+}
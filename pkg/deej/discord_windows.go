@@ -0,0 +1,95 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procPeekNamedPipe = kernel32.NewProc("PeekNamedPipe")
+)
+
+// how often a read checks whether Discord sent anything
+const discordPipePollInterval = 20 * time.Millisecond
+
+// discordPipe is a connection to Discord's named pipe. The pipe is opened for synchronous I/O, where a read
+// that's waiting for data would hold up writes until it returns, so reads only start once data has arrived.
+type discordPipe struct {
+	handle windows.Handle
+	closed atomic.Bool
+}
+
+// dialDiscord connects to the IPC pipe of the running Discord client
+func dialDiscord() (io.ReadWriteCloser, error) {
+	for i := 0; i < discordIPCSockets; i++ {
+		name, err := windows.UTF16PtrFromString(fmt.Sprintf(`\\.\pipe\discord-ipc-%d`, i))
+		if err != nil {
+			return nil, err
+		}
+
+		handle, err := windows.CreateFile(
+			name,
+			windows.GENERIC_READ|windows.GENERIC_WRITE,
+			0,
+			nil,
+			windows.OPEN_EXISTING,
+			0,
+			0,
+		)
+		if err == nil {
+			return &discordPipe{handle: handle}, nil
+		}
+	}
+
+	return nil, errDiscordNotRunning
+}
+
+func (p *discordPipe) Read(b []byte) (int, error) {
+	for {
+		if p.closed.Load() {
+			return 0, os.ErrClosed
+		}
+
+		var available uint32
+
+		// fails with ERROR_BROKEN_PIPE once Discord closes its end
+		ok, _, err := procPeekNamedPipe.Call(uintptr(p.handle), 0, 0, 0, uintptr(unsafe.Pointer(&available)), 0)
+		if ok == 0 {
+			return 0, fmt.Errorf("peek pipe: %w", err)
+		}
+
+		if available > 0 {
+			break
+		}
+
+		time.Sleep(discordPipePollInterval)
+	}
+
+	var read uint32
+	err := windows.ReadFile(p.handle, b, &read, nil)
+
+	return int(read), err
+}
+
+func (p *discordPipe) Write(b []byte) (int, error) {
+	var written uint32
+	err := windows.WriteFile(p.handle, b, &written, nil)
+
+	return int(written), err
+}
+
+func (p *discordPipe) Close() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+
+	return windows.CloseHandle(p.handle)
+}
@@ -0,0 +1,318 @@
+package deej
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// how long to listen to a serial port for slider data. Most boards reset when the port opens,
+// which takes a second or two
+const doctorProbeTimeout = 4 * time.Second
+
+// Doctor checks the config, serial ports and audio backend the way deej would use them, and writes a report
+// meant to be attached to support requests. It returns false if any check failed.
+// deej itself shouldn't be running, since it keeps the serial port busy.
+func Doctor(w io.Writer, version string) bool {
+	report := &doctorReport{w: w, healthy: true}
+
+	report.section("Environment")
+	if version == "" {
+		version = "unknown"
+	}
+	report.info("deej version: %s", version)
+	report.info("OS: %s/%s, built with %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
+
+	if workingDir, err := os.Getwd(); err == nil {
+		report.info("Working directory: %s", workingDir)
+	}
+
+	config := doctorCheckConfig(report)
+
+	doctorCheckSerial(report, config)
+	doctorCheckAudio(report)
+
+	report.section("Result")
+	if report.healthy {
+		report.ok("No problems found")
+	} else {
+		report.fail("Some checks failed, see above")
+	}
+
+	return report.healthy
+}
+
+// crashOnPanic is the panic handler for goroutines of commands that run in the foreground without a deej instance,
+// like the doctor and the simulator. There's no crash log to write for them, so a panic crashes as usual.
+func crashOnPanic(recoverValue interface{}) {
+	panic(recoverValue)
+}
+
+type doctorReport struct {
+	w       io.Writer
+	healthy bool
+}
+
+func (r *doctorReport) section(title string) {
+	fmt.Fprintf(r.w, "\n== %s ==\n", title)
+}
+
+func (r *doctorReport) info(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "       %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[OK]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[WARN] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) fail(format string, args ...interface{}) {
+	r.healthy = false
+	fmt.Fprintf(r.w, "[FAIL] %s\n", fmt.Sprintf(format, args...))
+}
+
+// doctorNotifier collects the notifications deej would have shown while loading the config
+type doctorNotifier struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (dn *doctorNotifier) Notify(title, message string) {
+	dn.lock.Lock()
+	defer dn.lock.Unlock()
+
+	dn.messages = append(dn.messages, fmt.Sprintf("%s %s", title, message))
+}
+
+// doctorCheckConfig loads the config, returning it even if loading failed so defaults can still be checked
+func doctorCheckConfig(report *doctorReport) *CanonicalConfig {
+	report.section("Configuration")
+
+	notifier := &doctorNotifier{}
+
+	config, err := NewConfig(zap.NewNop().Sugar(), notifier, newEventBus())
+	if err != nil {
+		report.fail("Failed to create configuration: %v", err)
+		return nil
+	}
+
+	if err := config.Load(); err != nil {
+		report.fail("Failed to load %s: %v", userConfigFilepath, err)
+	} else {
+		report.ok("Loaded %s", userConfigFilepath)
+	}
+
+	for _, message := range notifier.messages {
+		report.warn("%s", message)
+	}
+
+	report.info("COM port: %s, baud rate: %d", config.ConnectionInfo.COMPort, config.ConnectionInfo.BaudRate)
+	report.info("Invert sliders: %t, noise reduction: %q", config.InvertSliders, config.NoiseReductionLevel)
+
+	mapping := sliderMapContents(config.SliderMapping)
+	if len(mapping) == 0 {
+		report.warn("No sliders are mapped")
+		return config
+	}
+
+	sliderIdxs := make([]int, 0, len(mapping))
+	for sliderIdx := range mapping {
+		sliderIdxs = append(sliderIdxs, sliderIdx)
+	}
+
+	sort.Ints(sliderIdxs)
+
+	for _, sliderIdx := range sliderIdxs {
+		report.info("Slider %d: %s", sliderIdx, strings.Join(mapping[sliderIdx], ", "))
+	}
+
+	return config
+}
+
+func doctorCheckSerial(report *doctorReport, config *CanonicalConfig) {
+	report.section("Serial ports")
+
+	ports, err := listSerialPorts()
+	if err != nil {
+		report.warn("Failed to list serial ports: %v", err)
+	} else if len(ports) == 0 {
+		report.warn("No serial ports found, is the board plugged in?")
+	} else {
+		report.info("Found: %s", strings.Join(ports, ", "))
+	}
+
+	if usbPorts, err := listUSBSerialPorts(); err == nil {
+		for _, port := range usbPorts {
+			if port.serialNumber != "" {
+				report.info("%s is USB device %s, serial number %s", port.name, port.id, port.serialNumber)
+			} else {
+				report.info("%s is USB device %s", port.name, port.id)
+			}
+		}
+	}
+
+	if config == nil {
+		return
+	}
+
+	info := config.ConnectionInfo
+
+	if info.DeviceID != "" {
+		port, err := findDevicePort(info.DeviceID)
+		if err != nil {
+			report.fail("%v", err)
+		} else {
+			report.ok("USB device %s is on %s", info.DeviceID, port)
+			info.COMPort = port
+		}
+	}
+
+	// probing every port at the configured baud rate helps when the board was assigned a different port
+	probedConfigured := false
+
+	for _, port := range ports {
+		probeInfo := info
+		probeInfo.COMPort = port
+
+		configured := strings.EqualFold(port, info.COMPort)
+		probedConfigured = probedConfigured || configured
+
+		line, err := probeSerialPort(probeInfo)
+
+		switch {
+		case configured && err != nil:
+			report.fail("%s (configured): %v", port, err)
+		case configured:
+			report.ok("%s (configured) sends slider data: %q", port, line)
+		case err != nil:
+			report.info("%s: %v", port, err)
+		default:
+			report.warn("%s sends slider data (%q), but com_port is set to %s", port, line, info.COMPort)
+		}
+	}
+
+	if probedConfigured {
+		return
+	}
+
+	if len(ports) > 0 {
+		report.warn("The configured port %s wasn't found among them", info.COMPort)
+	}
+
+	line, err := probeSerialPort(info)
+	if err != nil {
+		report.fail("%s (configured): %v", info.COMPort, err)
+		return
+	}
+
+	report.ok("%s (configured) sends slider data: %q", info.COMPort, line)
+}
+
+// probeSerialPort listens to a port until it receives a line of slider data, returning that line
+func probeSerialPort(info ConnectionInfo) (string, error) {
+	conn, err := serial.Open(serialOpenOptions(info))
+	if err != nil {
+		return "", fmt.Errorf("can't open port (in use by deej or another program?): %w", err)
+	}
+
+	// closing the port also ends the pending read below
+	defer conn.Close()
+
+	if err := setSerialLines(conn, info); err != nil {
+		return "", fmt.Errorf("can't set DTR/RTS lines: %w", err)
+	}
+
+	type readResult struct {
+		line string
+		err  error
+	}
+
+	results := make(chan readResult, 1)
+	done := make(chan bool)
+	defer close(done)
+
+	util.Go(crashOnPanic, func() {
+		reader := bufio.NewReader(conn)
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			select {
+			case results <- readResult{strings.TrimSuffix(line, "\r\n"), err}:
+			case <-done:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	timeout := time.After(doctorProbeTimeout)
+	lastLine := ""
+
+	for {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				return "", fmt.Errorf("read from port: %w", result.err)
+			}
+
+			if expectedLinePattern.MatchString(result.line) {
+				return result.line, nil
+			}
+
+			lastLine = result.line
+
+		case <-timeout:
+			if lastLine != "" {
+				return "", fmt.Errorf("no slider data within %s, last line received: %q", doctorProbeTimeout, lastLine)
+			}
+
+			return "", fmt.Errorf("nothing received within %s", doctorProbeTimeout)
+		}
+	}
+}
+
+func doctorCheckAudio(report *doctorReport) {
+	report.section("Audio sessions")
+
+	finder, err := newSessionFinder(zap.NewNop().Sugar(), crashOnPanic)
+	if err != nil {
+		report.fail("Failed to access the audio backend: %v", err)
+		return
+	}
+	defer finder.Release()
+
+	sessions, err := finder.GetAllSessions()
+	if err != nil {
+		report.fail("Failed to list audio sessions: %v", err)
+		return
+	}
+
+	report.ok("Found %d audio sessions", len(sessions))
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Key() < sessions[j].Key()
+	})
+
+	for _, session := range sessions {
+		report.info("%s", session)
+		session.Release()
+	}
+}
@@ -0,0 +1,27 @@
+package deej
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// USB serial adapters and boards with native USB (e.g. the Leonardo) show up under these names
+var serialPortPatterns = []string{"/dev/ttyUSB*", "/dev/ttyACM*"}
+
+func listSerialPorts() ([]string, error) {
+	var ports []string
+
+	for _, pattern := range serialPortPatterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", pattern, err)
+		}
+
+		ports = append(ports, matches...)
+	}
+
+	sort.Strings(ports)
+
+	return ports, nil
+}
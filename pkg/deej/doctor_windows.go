@@ -0,0 +1,41 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Windows lists the serial ports currently present here, as device name -> COM port
+const serialPortsRegistryKey = `HARDWARE\DEVICEMAP\SERIALCOMM`
+
+func listSerialPorts() ([]string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, serialPortsRegistryKey, registry.QUERY_VALUE)
+	if err != nil {
+		// the key only exists while at least one port does
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("open serial ports registry key: %w", err)
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("read serial ports registry key: %w", err)
+	}
+
+	var ports []string
+	for _, name := range names {
+		if port, _, err := key.GetStringValue(name); err == nil {
+			ports = append(ports, port)
+		}
+	}
+
+	sort.Strings(ports)
+
+	return ports, nil
+}
@@ -0,0 +1,38 @@
+package deej
+
+// The session map makes every change to a session or external target through these, so that a dry run
+// (deej --dry-run) can log each change instead of making it. Everything else in deej carries on as if the
+// changes were made, which keeps the logs showing what a config would really do.
+
+// setSessionVolume sets a session's volume, or in a dry run logs the change it would make
+func (m *sessionMap) setSessionVolume(session Session, v float32) error {
+	if m.dryRun {
+		m.logger.Infow("Dry run, not setting session volume", "session", session.Key(), "from", m.cachedVolume(session), "to", v)
+		return nil
+	}
+
+	return session.SetVolume(v)
+}
+
+// setSessionMute mutes or unmutes a session, or in a dry run logs the change it would make
+func (m *sessionMap) setSessionMute(session Session, muteController MuteController, mute bool) error {
+	if m.dryRun {
+		m.logger.Infow("Dry run, not setting session mute state", "session", session.Key(), "mute", mute)
+		return nil
+	}
+
+	return muteController.SetMute(mute)
+}
+
+// setExternalVolume passes a volume to an external target's handler, or in a dry run logs the change it would make.
+// Handlers like exec: run commands or talk to other apps, so they're skipped entirely.
+func (m *sessionMap) setExternalVolume(target string, v float32) error {
+	handler, name, _ := m.splitExternalTarget(target)
+
+	if m.dryRun {
+		m.logger.Infow("Dry run, not setting external target volume", "target", target, "to", v)
+		return nil
+	}
+
+	return handler(name, v)
+}
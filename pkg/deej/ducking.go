@@ -0,0 +1,207 @@
+package deej
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/thoas/go-funk"
+	"go.uber.org/zap"
+)
+
+const (
+	// how long it takes to lower targets once a priority target starts playing
+	duckAttack = 100 * time.Millisecond
+
+	// how long targets stay lowered after the priority target goes quiet, to ride out short pauses (e.g. between words)
+	duckHold = 300 * time.Millisecond
+
+	// volume changes smaller than this are considered our own rounding rather than the user moving a slider
+	duckVolumeTolerance = 0.01
+)
+
+// ducker lowers some targets while others play audio, e.g. music while someone talks on Discord, and restores
+// them smoothly once it's quiet again
+type ducker struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	// the gain currently applied to the lowered targets, 1 while not ducking
+	gain       float32
+	lastActive time.Time
+
+	// lowered targets, by target
+	targets map[string]*duckedTarget
+}
+
+type duckedTarget struct {
+	// the volume to restore once ducking ends
+	base float32
+
+	// the volume the ducker last set, to tell when something else (like a slider) changes it
+	lastSet float32
+}
+
+func newDucker(deej *Deej, logger *zap.SugaredLogger) *ducker {
+	logger = logger.Named("ducking")
+
+	dk := &ducker{
+		deej:    deej,
+		logger:  logger,
+		gain:    1,
+		targets: make(map[string]*duckedTarget),
+	}
+
+	logger.Debug("Created ducker instance")
+
+	return dk
+}
+
+// start begins monitoring the priority targets. Config changes are picked up as they happen.
+// Once deej shuts down, any lowered targets are restored.
+func (dk *ducker) start() {
+	configReloadedChannel := dk.deej.events.configReloaded.subscribe()
+
+	dk.deej.spawn(func(ctx context.Context) error {
+		// only subscribed while ducking is configured, so sessions aren't metered for nothing.
+		// receiving from a nil channel blocks forever, leaving that case out of the select
+		var peakLevelsChannel chan PeakLevels
+
+		for {
+			enabled := dk.deej.config.Ducking.enabled()
+
+			if enabled && peakLevelsChannel == nil {
+				peakLevelsChannel = dk.deej.meter.subscribeToPeakLevels()
+			} else if !enabled && peakLevelsChannel != nil {
+				dk.restoreAll()
+				dk.deej.meter.unsubscribeFromPeakLevels(peakLevelsChannel)
+				peakLevelsChannel = nil
+			}
+
+			select {
+			case <-ctx.Done():
+				dk.restoreAll()
+				return nil
+			case <-configReloadedChannel:
+			case levels := <-peakLevelsChannel:
+				dk.tick(levels)
+			}
+		}
+	})
+}
+
+// tick runs once per meter interval, moving the lowered targets' gain toward where it should be
+func (dk *ducker) tick(levels PeakLevels) {
+	info := dk.deej.config.Ducking
+
+	// targets that were removed from the config while lowered
+	for target := range dk.targets {
+		if !funk.ContainsString(info.Lower, target) {
+			dk.restore(target)
+		}
+	}
+
+	now := time.Now()
+	if dk.triggered(info, levels) {
+		dk.lastActive = now
+	}
+
+	targetGain := float32(1)
+	if now.Sub(dk.lastActive) < duckHold {
+		targetGain = 1 - info.By
+	}
+
+	gain := dk.gain
+	if gain > targetGain {
+		gain = float32(math.Max(float64(targetGain), float64(gain-info.By*float32(meterInterval)/float32(duckAttack))))
+	} else if gain < targetGain {
+		release := time.Duration(info.ReleaseMS) * time.Millisecond
+		gain = float32(math.Min(float64(targetGain), float64(gain+info.By*float32(meterInterval)/float32(release))))
+	}
+
+	if gain == 1 && dk.gain == 1 {
+		return
+	}
+
+	if dk.gain == 1 {
+		dk.logger.Debugw("Priority target is playing, lowering targets", "targets", info.Lower)
+	} else if gain == 1 {
+		dk.logger.Debugw("Priority target went quiet, targets restored", "targets", info.Lower)
+	}
+
+	dk.gain = gain
+
+	for _, target := range info.Lower {
+		dk.apply(target)
+	}
+
+	if gain == 1 {
+		dk.targets = make(map[string]*duckedTarget)
+	}
+}
+
+// triggered returns true if any of the priority targets is playing audio
+func (dk *ducker) triggered(info DuckingInfo, levels PeakLevels) bool {
+	for _, target := range info.When {
+		// unlike discord.exe's audio, this only counts people talking, not notification sounds
+		if strings.EqualFold(target, discordSpeakingTarget) {
+			if dk.deej.discord.othersSpeaking() {
+				return true
+			}
+
+			continue
+		}
+
+		if peak, found := dk.deej.sessions.targetPeak(target, levels); found && peak >= info.Threshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply sets a lowered target's volume according to the current gain
+func (dk *ducker) apply(target string) {
+	volume, _, found := dk.deej.sessions.targetState(target)
+	if !found {
+		return
+	}
+
+	state, ok := dk.targets[target]
+	if !ok {
+		state = &duckedTarget{base: volume, lastSet: volume}
+		dk.targets[target] = state
+	} else if math.Abs(float64(volume-state.lastSet)) > duckVolumeTolerance {
+		// something else set a new volume, which becomes the one to restore
+		state.base = volume
+	}
+
+	newVolume := state.base * dk.gain
+	state.lastSet = newVolume
+
+	if newVolume == volume {
+		return
+	}
+
+	if _, err := dk.deej.sessions.setTargetVolume(target, newVolume); err != nil {
+		dk.logger.Warnw("Failed to set ducked target volume", "target", target, "error", err)
+	}
+}
+
+func (dk *ducker) restore(target string) {
+	state := dk.targets[target]
+	delete(dk.targets, target)
+
+	if _, err := dk.deej.sessions.setTargetVolume(target, state.base); err != nil {
+		dk.logger.Warnw("Failed to restore ducked target volume", "target", target, "error", err)
+	}
+}
+
+func (dk *ducker) restoreAll() {
+	for target := range dk.targets {
+		dk.restore(target)
+	}
+
+	dk.gain = 1
+}
@@ -0,0 +1,147 @@
+package deej
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// elevationWatcher looks out for apps running as administrator while deej doesn't. Windows doesn't let a process
+// change the volume of one with more privileges than its own, so sliders mapped to such an app would otherwise
+// seem to do nothing, with nothing but failed volume changes in the log to tell why.
+type elevationWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	warned   map[string]bool // apps already announced, by key
+	found    bool            // whether any elevated app was seen yet
+	onFound  func()          // set by the tray, to offer restarting deej as administrator
+	elevated bool            // whether deej itself runs as administrator
+}
+
+func newElevationWatcher(deej *Deej, logger *zap.SugaredLogger) *elevationWatcher {
+	logger = logger.Named("elevation")
+
+	ew := &elevationWatcher{
+		deej:     deej,
+		logger:   logger,
+		warned:   make(map[string]bool),
+		elevated: selfElevated(),
+	}
+
+	logger.Debug("Created elevation watcher instance")
+
+	return ew
+}
+
+// attach sets up the tray menu's restart item, which is shown once an elevated app shows up
+func (ew *elevationWatcher) attach(onFound func()) {
+	ew.lock.Lock()
+	defer ew.lock.Unlock()
+
+	ew.onFound = onFound
+	if ew.found {
+		onFound()
+	}
+}
+
+// start checks the apps that are already running, and every app that starts from now on
+func (ew *elevationWatcher) start() {
+	if ew.elevated {
+		ew.logger.Debug("Running as administrator, every app's volume can be controlled")
+		return
+	}
+
+	sessionChangesChannel := ew.deej.events.sessionsChanged.subscribe()
+
+	ew.deej.spawn(func(ctx context.Context) error {
+		ew.check()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sessionChangesChannel:
+				if len(event.Added) > 0 {
+					ew.check()
+				}
+			}
+		}
+	})
+}
+
+// check announces apps that run elevated, once each
+func (ew *elevationWatcher) check() {
+	for _, session := range ew.deej.sessions.snapshot() {
+		withProcess, ok := session.(processSession)
+		if !ok || withProcess.processID() == 0 {
+			continue
+		}
+
+		key := session.Key()
+
+		ew.lock.Lock()
+		warned := ew.warned[key]
+		ew.lock.Unlock()
+
+		if warned {
+			continue
+		}
+
+		elevated, err := processElevated(withProcess.processID())
+		if err != nil {
+			ew.logger.Debugw("Failed to check whether app runs as administrator", "app", key, "error", err)
+			continue
+		}
+
+		if !elevated {
+			continue
+		}
+
+		ew.lock.Lock()
+		ew.warned[key] = true
+		ew.found = true
+		onFound := ew.onFound
+		ew.lock.Unlock()
+
+		ew.logger.Warnw("App runs as administrator while deej doesn't, its volume can't be controlled", "app", key)
+		ew.deej.notifier.Notify(tr("notify.elevatedApp", "app", key), tr(elevationAdvice))
+
+		if onFound != nil {
+			onFound()
+		}
+	}
+}
+
+// restart starts deej again as administrator and quits this instance. The board and API ports are let go of first,
+// so the new instance can take them over, and taken back if the user declines the prompt.
+func (ew *elevationWatcher) restart() {
+	ew.logger.Info("Restarting as administrator")
+
+	ew.deej.serial.Stop()
+	ew.deej.grpc.stop()
+	ew.deej.http.stop()
+
+	if err := restartElevated(); err != nil {
+		ew.logger.Warnw("Failed to restart as administrator", "error", err)
+		ew.deej.notifier.Notify(tr("notify.restartDeclined"), tr("notify.restartDeclinedMessage"))
+
+		if err := ew.deej.grpc.start(); err != nil {
+			ew.logger.Warnw("Failed to restart gRPC API", "error", err)
+		}
+
+		if err := ew.deej.http.start(); err != nil {
+			ew.logger.Warnw("Failed to restart HTTP API", "error", err)
+		}
+
+		if err := ew.deej.serial.Start(); err != nil {
+			ew.logger.Warnw("Failed to reconnect to board", "error", err)
+		}
+
+		return
+	}
+
+	ew.deej.signalStop()
+}
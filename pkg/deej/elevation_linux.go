@@ -0,0 +1,26 @@
+package deej
+
+import "errors"
+
+const (
+	// whether the tray offers to restart deej as administrator
+	canRestartElevated = false
+
+	elevationAdvice = "notify.elevatedAppLinux"
+)
+
+var errElevationUnsupported = errors.New("restarting elevated is only supported on Windows")
+
+// selfElevated and processElevated always return false, since PulseAudio sessions belong to the user running them
+// and don't care about privileges
+func selfElevated() bool {
+	return false
+}
+
+func processElevated(pid int) (bool, error) {
+	return false, nil
+}
+
+func restartElevated() error {
+	return errElevationUnsupported
+}
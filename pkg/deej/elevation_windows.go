@@ -0,0 +1,75 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// whether the tray offers to restart deej as administrator
+	canRestartElevated = true
+
+	elevationAdvice = "notify.elevatedAppWindows"
+)
+
+func selfElevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
+// processElevated returns whether a process runs with more privileges than deej. Processes whose token deej isn't
+// even allowed to look at are taken to be elevated, as that's what keeps deej from controlling them as well.
+func processElevated(pid int) (bool, error) {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false, fmt.Errorf("open process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token); err != nil {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return true, nil
+		}
+
+		return false, fmt.Errorf("open process token: %w", err)
+	}
+	defer token.Close()
+
+	return token.IsElevated(), nil
+}
+
+// restartElevated starts deej again with the same arguments and working directory, through the UAC prompt.
+// It returns once the user has answered it.
+func restartElevated() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+
+	args := make([]string, 0, len(os.Args)-1)
+	for _, arg := range os.Args[1:] {
+		args = append(args, windows.EscapeArg(arg))
+	}
+
+	if err := windows.ShellExecute(
+		0,
+		windows.StringToUTF16Ptr("runas"),
+		windows.StringToUTF16Ptr(executable),
+		windows.StringToUTF16Ptr(strings.Join(args, " ")),
+		windows.StringToUTF16Ptr(workingDir),
+		windows.SW_SHOWNORMAL,
+	); err != nil {
+		return fmt.Errorf("start elevated: %w", err)
+	}
+
+	return nil
+}
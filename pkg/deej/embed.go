@@ -0,0 +1,114 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// SessionState describes an audio session deej controls
+type SessionState struct {
+	Key         string
+	DisplayName string // what the OS calls the session, e.g. "Spotify", or the key if it has no better name
+	Volume      float32
+	Muted       bool
+}
+
+// Run runs deej without a tray icon or signal handling until ctx is canceled, or until deej stops on its own
+// (e.g. because the serial port is busy). Unlike Initialize, it returns instead of exiting the process, so
+// programs can embed deej (see pkg/deejlib). Like Initialize, it can only be called once.
+func (d *Deej) Run(ctx context.Context) error {
+	d.embedded = true
+	d.service = &serviceState{
+		ready:       func() {},
+		stopping:    func() {},
+		exitChannel: make(chan int, 1),
+	}
+
+	stopOnCancel := context.AfterFunc(ctx, d.signalStop)
+	defer stopOnCancel()
+
+	if err := d.Initialize(); err != nil {
+		return err
+	}
+
+	if code := <-d.service.exitChannel; code != 0 {
+		return fmt.Errorf("stopped with exit code %d", code)
+	}
+
+	return nil
+}
+
+// Sessions returns the audio sessions deej currently knows about, sorted by key
+func (d *Deej) Sessions() []SessionState {
+	var states []SessionState
+
+	for _, session := range d.sessions.snapshot() {
+		states = append(states, SessionState{
+			Key:         session.Key(),
+			DisplayName: sessionDisplayName(session),
+			Volume:      session.GetVolume(),
+			Muted:       sessionIsMuted(session),
+		})
+	}
+
+	return states
+}
+
+// SessionIcon returns the icon of the app behind the sessions with the given key as PNG data,
+// or false if none of them have one
+func (d *Deej) SessionIcon(key string) ([]byte, bool) {
+	sessions, _ := d.sessions.get(strings.ToLower(key))
+
+	for _, session := range sessions {
+		icon, err := sessionIcon(session)
+		if err == nil {
+			return icon, true
+		}
+
+		if !errors.Is(err, errNoIcon) {
+			d.logger.Debugw("Failed to get session icon", "session", session.Key(), "error", err)
+		}
+	}
+
+	return nil, false
+}
+
+// SetVolume sets the volume (between 0 and 1) of every session matching a target, which can be anything
+// slider_mapping accepts. It returns the keys of the sessions that were adjusted.
+func (d *Deej) SetVolume(target string, volume float32) ([]string, error) {
+	if volume < 0 || volume > 1 {
+		return nil, fmt.Errorf("volume %.2f is out of range [0, 1]", volume)
+	}
+
+	return d.sessions.setTargetVolume(target, volume)
+}
+
+// SetMute mutes or unmutes every session matching a target, returning the keys of the sessions that were adjusted
+func (d *Deej) SetMute(target string, mute bool) ([]string, error) {
+	return d.sessions.setTargetMute(target, mute)
+}
+
+// ReloadConfig re-reads the config file, as if it had changed on disk
+func (d *Deej) ReloadConfig() error {
+	return d.config.Reload()
+}
+
+// Go runs f on a new goroutine, handling a panic in it like one in deej's own goroutines
+func (d *Deej) Go(f func()) {
+	util.Go(d.handlePanic, f)
+}
+
+// SubscribeToSliderMoveEvents returns a channel that receives every slider move, until passed to
+// UnsubscribeFromSliderMoveEvents. Subscribers that fall too far behind miss their oldest events.
+func (d *Deej) SubscribeToSliderMoveEvents() chan SliderMoveEvent {
+	return d.events.sliderMoved.subscribe()
+}
+
+// UnsubscribeFromSliderMoveEvents stops sending events to a channel from SubscribeToSliderMoveEvents
+func (d *Deej) UnsubscribeFromSliderMoveEvents(ch chan SliderMoveEvent) {
+	d.events.sliderMoved.unsubscribe(ch)
+}
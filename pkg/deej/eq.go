@@ -0,0 +1,155 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// equalizerTargetPrefix addresses the equalizer's preamp and bands, e.g. "eq:preamp" or "eq:bass"
+	equalizerTargetPrefix = "eq"
+	equalizerPreampName   = "preamp"
+
+	// the equalizer is updated at most once per interval, since each update rewrites a file or a whole
+	// set of plugin controls. slider moves in between are coalesced into the next update
+	equalizerMinInterval = 200 * time.Millisecond
+)
+
+// equalizerBackend is the platform-specific way of applying gains to the system equalizer
+type equalizerBackend interface {
+	apply(info EqualizerInfo, settings equalizerSettings) error
+}
+
+// equalizerSettings are the gains to apply, in dB
+type equalizerSettings struct {
+	Preamp float64
+	Bands  []equalizerBand
+}
+
+type equalizerBand struct {
+	Name string
+
+	// Value is the band's frequency in Hz or its LADSPA control index, as configured
+	Value float64
+	Gain  float64
+}
+
+// equalizer controls a system-wide equalizer's preamp and bands through eq: targets
+type equalizer struct {
+	deej    *Deej
+	logger  *zap.SugaredLogger
+	backend equalizerBackend
+
+	lock sync.Mutex
+
+	// the gain each band (and the preamp) was last set to, in dB. bands that haven't moved yet are flat
+	gains map[string]float64
+
+	// scheduled is set while an update is waiting for its turn or in progress, and dirty while
+	// gains have changed since the update started
+	scheduled  bool
+	dirty      bool
+	lastUpdate time.Time
+}
+
+func newEqualizer(deej *Deej, logger *zap.SugaredLogger) *equalizer {
+	logger = logger.Named("equalizer")
+
+	eq := &equalizer{
+		deej:    deej,
+		logger:  logger,
+		backend: newEqualizerBackend(),
+		gains:   make(map[string]float64),
+	}
+
+	logger.Debug("Created equalizer instance")
+
+	return eq
+}
+
+// initialize registers the eq: target prefix. The equalizer itself is only touched once an eq: target is used.
+func (eq *equalizer) initialize() {
+	eq.deej.sessions.registerExternalTarget(equalizerTargetPrefix, eq.setGain)
+}
+
+// setGain handles eq:<preamp or band name> targets, mapping the slider onto the configured gain range
+func (eq *equalizer) setGain(name string, v float32) error {
+	name = strings.ToLower(name)
+	info := eq.deej.config.Equalizer
+
+	if _, ok := info.Bands[name]; !ok && name != equalizerPreampName {
+		return fmt.Errorf("unknown equalizer band: %s (add it to equalizer.bands)", name)
+	}
+
+	eq.lock.Lock()
+	defer eq.lock.Unlock()
+
+	eq.gains[name] = equalizerGain(info, v)
+	eq.dirty = true
+
+	if eq.scheduled {
+		return nil
+	}
+
+	eq.scheduled = true
+	time.AfterFunc(time.Until(eq.lastUpdate.Add(equalizerMinInterval)), eq.update)
+
+	return nil
+}
+
+// update applies the latest gains, and schedules another update if they changed in the meantime
+func (eq *equalizer) update() {
+	defer util.Recover(eq.deej.handlePanic)
+
+	eq.lock.Lock()
+	settings := eq.settings(eq.deej.config.Equalizer)
+	eq.dirty = false
+	eq.lock.Unlock()
+
+	if err := eq.backend.apply(eq.deej.config.Equalizer, settings); err != nil {
+		eq.logger.Warnw("Failed to update equalizer", "error", err)
+	} else {
+		eq.logger.Debugw("Updated equalizer", "settings", settings)
+	}
+
+	eq.lock.Lock()
+	defer eq.lock.Unlock()
+
+	eq.lastUpdate = time.Now()
+
+	if eq.dirty {
+		time.AfterFunc(equalizerMinInterval, eq.update)
+		return
+	}
+
+	eq.scheduled = false
+}
+
+// settings gathers the gain of every configured band, sorted by frequency or control index. Must hold lock.
+func (eq *equalizer) settings(info EqualizerInfo) equalizerSettings {
+	settings := equalizerSettings{Preamp: eq.gains[equalizerPreampName]}
+
+	for name, value := range info.Bands {
+		settings.Bands = append(settings.Bands, equalizerBand{Name: name, Value: value, Gain: eq.gains[name]})
+	}
+
+	sort.Slice(settings.Bands, func(i, j int) bool {
+		return settings.Bands[i].Value < settings.Bands[j].Value
+	})
+
+	return settings
+}
+
+// equalizerGain maps a [0, 1] slider value onto the configured gain range, in steps of 0.1 dB
+func equalizerGain(info EqualizerInfo, v float32) float64 {
+	gain := info.MinGain + float64(v)*(info.MaxGain-info.MinGain)
+	return math.Round(gain*10) / 10
+}
@@ -0,0 +1,130 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// PulseAudio's D-Bus interface (module-dbus-protocol) runs on its own server, found through the session bus
+	pulseServerLookupName      = "org.PulseAudio1"
+	pulseServerLookupPath      = "/org/pulseaudio/server_lookup1"
+	pulseServerLookupAddress   = "org.PulseAudio.ServerLookup1.Address"
+	pulseServerAddressOverride = "PULSE_DBUS_SERVER"
+
+	pulseCorePath          = "/org/pulseaudio/core1"
+	pulseGetSinkByName     = "org.PulseAudio.Core1.GetSinkByName"
+	pulseLADSPAParameters  = "org.PulseAudio.Ext.Ladspa1.AlgorithmParameters"
+	pulseDBusModuleMissing = "is module-dbus-protocol loaded?"
+)
+
+var errLADSPASinkMissing = errors.New("no LADSPA sink configured, set equalizer.ladspa_sink")
+
+// ladspaParameters mirrors the (adab) AlgorithmParameters property: the control values, and whether
+// each one is left at the plugin's default
+type ladspaParameters struct {
+	Controls []float64
+	Defaults []bool
+}
+
+// ladspaBackend sets the controls of a module-ladspa-sink equalizer (e.g. mbeq) through PulseAudio's D-Bus
+// interface. PulseAudio has no preamp for these, so the preamp gain is added to every band.
+type ladspaBackend struct {
+	lock sync.Mutex
+	conn *dbus.Conn
+}
+
+func newEqualizerBackend() equalizerBackend {
+	return &ladspaBackend{}
+}
+
+func (b *ladspaBackend) apply(info EqualizerInfo, settings equalizerSettings) error {
+	if info.LADSPASink == "" {
+		return errLADSPASinkMissing
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	if err := b.setControls(info.LADSPASink, settings); err != nil {
+		// the connection may have gone stale, e.g. after PulseAudio restarted, so the next update reconnects
+		b.conn.Close()
+		b.conn = nil
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *ladspaBackend) setControls(sinkName string, settings equalizerSettings) error {
+	var sinkPath dbus.ObjectPath
+	if err := b.conn.Object("", pulseCorePath).Call(pulseGetSinkByName, 0, sinkName).Store(&sinkPath); err != nil {
+		return fmt.Errorf("find LADSPA sink %s: %w", sinkName, err)
+	}
+
+	sink := b.conn.Object("", sinkPath)
+
+	var parameters ladspaParameters
+	if err := sink.StoreProperty(pulseLADSPAParameters, &parameters); err != nil {
+		return fmt.Errorf("get LADSPA controls of %s: %w", sinkName, err)
+	}
+
+	for _, band := range settings.Bands {
+		idx := int(band.Value)
+		if idx >= len(parameters.Controls) || idx >= len(parameters.Defaults) {
+			return fmt.Errorf("LADSPA sink %s has no control %d (band %s)", sinkName, idx, band.Name)
+		}
+
+		parameters.Controls[idx] = band.Gain + settings.Preamp
+		parameters.Defaults[idx] = false
+	}
+
+	if err := sink.SetProperty(pulseLADSPAParameters, dbus.MakeVariant(parameters)); err != nil {
+		return fmt.Errorf("set LADSPA controls of %s: %w", sinkName, err)
+	}
+
+	return nil
+}
+
+// connect opens a connection to PulseAudio's D-Bus server, unless one is already open
+func (b *ladspaBackend) connect() error {
+	if b.conn != nil {
+		return nil
+	}
+
+	address := os.Getenv(pulseServerAddressOverride)
+	if address == "" {
+		session, err := dbus.SessionBus()
+		if err != nil {
+			return fmt.Errorf("connect to session bus: %w", err)
+		}
+
+		if err := session.Object(pulseServerLookupName, pulseServerLookupPath).
+			StoreProperty(pulseServerLookupAddress, &address); err != nil {
+			return fmt.Errorf("look up pulseaudio d-bus server (%s): %w", pulseDBusModuleMissing, err)
+		}
+	}
+
+	// a peer-to-peer connection, so there's no bus to say hello to
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		return fmt.Errorf("connect to pulseaudio d-bus server (%s): %w", pulseDBusModuleMissing, err)
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("authenticate with pulseaudio d-bus server: %w", err)
+	}
+
+	b.conn = conn
+	return nil
+}
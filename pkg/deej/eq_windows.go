@@ -0,0 +1,70 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// Equalizer APO's installer records where its config files live here. Its main config.txt has to include
+	// deej's file, e.g. with the line "Include: deej.txt", for the gains to apply
+	equalizerAPOKey         = `SOFTWARE\EqualizerAPO`
+	equalizerAPODefaultDir  = `C:\Program Files\EqualizerAPO\config`
+	equalizerAPOFileName    = "deej.txt"
+	equalizerAPOBandQuality = 1.41
+)
+
+// equalizerAPOBackend writes the gains to an Equalizer APO config file, which Equalizer APO picks up by itself
+type equalizerAPOBackend struct{}
+
+func newEqualizerBackend() equalizerBackend {
+	return equalizerAPOBackend{}
+}
+
+func (equalizerAPOBackend) apply(info EqualizerInfo, settings equalizerSettings) error {
+	path := info.ConfigFile
+	if path == "" {
+		path = filepath.Join(equalizerAPOConfigDir(), equalizerAPOFileName)
+	}
+
+	var contents strings.Builder
+	contents.WriteString("# written by deej whenever an eq: slider moves, so changes made here are overwritten\n")
+	fmt.Fprintf(&contents, "Preamp: %.1f dB\n", settings.Preamp)
+
+	for _, band := range settings.Bands {
+		fmt.Fprintf(&contents, "# %s\nFilter: ON PK Fc %g Hz Gain %.1f dB Q %.2f\n",
+			band.Name, band.Value, band.Gain, equalizerAPOBandQuality)
+	}
+
+	// Equalizer APO reloads the file as soon as it changes, so it's swapped in whole rather than written in place
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, []byte(contents.String()), 0644); err != nil {
+		return fmt.Errorf("write equalizer apo config (does deej have write access to %s?): %w", filepath.Dir(path), err)
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("replace equalizer apo config: %w", err)
+	}
+
+	return nil
+}
+
+func equalizerAPOConfigDir() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, equalizerAPOKey, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return equalizerAPODefaultDir
+	}
+	defer key.Close()
+
+	configDir, _, err := key.GetStringValue("ConfigPath")
+	if err != nil || configDir == "" {
+		return equalizerAPODefaultDir
+	}
+
+	return configDir
+}
@@ -0,0 +1,51 @@
+package deej
+
+// how many events of each kind a subscriber can fall behind by before the oldest are dropped
+const (
+	serialEventBufferSize   = 64
+	volumeChangeBufferSize  = 16
+	sessionChangeBufferSize = 16
+	missingTargetBufferSize = 16
+
+	// reloads that happen while a subscriber is still busy with the previous one reach it as a single event
+	configReloadBufferSize = 1
+)
+
+// eventBus carries the events deej's components publish to each other, so they can react to each other without
+// holding on to the component that publishes. Each topic delivers to any number of subscribers as eventFanOut does,
+// and new features hook in by subscribing to the topics they care about.
+type eventBus struct {
+	sliderMoved   *eventFanOut[SliderMoveEvent]
+	buttonPressed *eventFanOut[ButtonPressEvent]
+
+	// whether any board is connected, published whenever a board connects or disconnects
+	connectionChanged *eventFanOut[bool]
+
+	sessionsChanged *eventFanOut[sessionChangeEvent]
+
+	// volume changes made outside deej, e.g. from the OS mixer
+	volumeChanged *eventFanOut[sessionVolumeChange]
+
+	// slider moves that found no session for a target with a missing_targets policy, see missing_targets.go
+	targetMissing *eventFanOut[missingTargetEvent]
+
+	configReloaded *eventFanOut[struct{}]
+}
+
+// sessionChangeEvent is published whenever the set of sessions changes, or is re-acquired without changing
+type sessionChangeEvent struct {
+	Added   []string // keys of the sessions that appeared
+	Removed []string // keys of the sessions that went away
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		sliderMoved:       newEventFanOut[SliderMoveEvent](serialEventBufferSize),
+		buttonPressed:     newEventFanOut[ButtonPressEvent](serialEventBufferSize),
+		connectionChanged: newEventFanOut[bool](serialEventBufferSize),
+		sessionsChanged:   newEventFanOut[sessionChangeEvent](sessionChangeBufferSize),
+		volumeChanged:     newEventFanOut[sessionVolumeChange](volumeChangeBufferSize),
+		targetMissing:     newEventFanOut[missingTargetEvent](missingTargetBufferSize),
+		configReloaded:    newEventFanOut[struct{}](configReloadBufferSize),
+	}
+}
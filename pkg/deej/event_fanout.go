@@ -0,0 +1,65 @@
+package deej
+
+import "sync"
+
+// eventFanOut delivers events to any number of subscribers without letting a slow one hold up the publisher,
+// or the subscribers behind it. Each subscriber reads its own buffered channel on its own goroutine; when it falls
+// a full buffer behind, its oldest pending events are dropped to make room for new ones.
+type eventFanOut[T any] struct {
+	bufferSize int
+
+	lock        sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+func newEventFanOut[T any](bufferSize int) *eventFanOut[T] {
+	return &eventFanOut[T]{
+		bufferSize:  bufferSize,
+		subscribers: make(map[chan T]struct{}),
+	}
+}
+
+// subscribe returns a channel that receives every event published from now on
+func (f *eventFanOut[T]) subscribe() chan T {
+	c := make(chan T, f.bufferSize)
+
+	f.lock.Lock()
+	f.subscribers[c] = struct{}{}
+	f.lock.Unlock()
+
+	return c
+}
+
+// unsubscribe stops publishing to a channel from subscribe. The channel isn't closed, since
+// subscribers usually select on it alongside other channels.
+func (f *eventFanOut[T]) unsubscribe(c chan T) {
+	f.lock.Lock()
+	delete(f.subscribers, c)
+	f.lock.Unlock()
+}
+
+// publish sends the event to all subscribers without blocking
+func (f *eventFanOut[T]) publish(event T) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for c := range f.subscribers {
+		select {
+		case c <- event:
+			continue
+		default:
+		}
+
+		// the buffer is full, so drop the oldest event. if the subscriber took it in the meantime there's room anyway,
+		// and since publishing holds the lock, nothing else can fill that room before the send below
+		select {
+		case <-c:
+		default:
+		}
+
+		select {
+		case c <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// execTargetPrefix addresses commands from exec_commands, e.g. "exec:lights"
+	execTargetPrefix = "exec"
+
+	// a command runs at most once per interval; slider moves in between are coalesced into a single run
+	// with the latest value once the interval has passed
+	execMinInterval = 250 * time.Millisecond
+
+	// commands still running after this long are killed
+	execTimeout = 30 * time.Second
+)
+
+// execCommands runs user-configured commands when a slider mapped to an exec: target moves,
+// or when a button or hotkey with the exec.run action is pressed
+type execCommands struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock   sync.Mutex
+	states map[string]*execCommandState
+}
+
+type execCommandState struct {
+	pendingArgs []string
+	hasPending  bool
+
+	// scheduled is set while a run is waiting for its turn or in progress
+	scheduled bool
+	lastRun   time.Time
+}
+
+func newExecCommands(deej *Deej, logger *zap.SugaredLogger) *execCommands {
+	logger = logger.Named("exec")
+
+	ec := &execCommands{
+		deej:   deej,
+		logger: logger,
+		states: make(map[string]*execCommandState),
+	}
+
+	logger.Debug("Created exec commands instance")
+
+	return ec
+}
+
+// initialize registers the exec: target prefix
+func (ec *execCommands) initialize() {
+	ec.deej.sessions.registerExternalTarget(execTargetPrefix, ec.setVolume)
+}
+
+// setVolume handles exec:<command name> targets, passing the slider's value (0-100) as the last argument
+func (ec *execCommands) setVolume(name string, v float32) error {
+	return ec.trigger(name, strconv.Itoa(int(v*100+0.5)))
+}
+
+// trigger runs the named command with the given extra arguments, subject to rate limiting
+func (ec *execCommands) trigger(name string, args ...string) error {
+	name = strings.ToLower(name)
+
+	if _, ok := ec.deej.config.ExecCommands[name]; !ok {
+		return fmt.Errorf("unknown command: %s (add it to exec_commands)", name)
+	}
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	state, ok := ec.states[name]
+	if !ok {
+		state = &execCommandState{}
+		ec.states[name] = state
+	}
+
+	state.pendingArgs = args
+	state.hasPending = true
+
+	if state.scheduled {
+		return nil
+	}
+
+	state.scheduled = true
+	time.AfterFunc(time.Until(state.lastRun.Add(execMinInterval)), func() { ec.runPending(name) })
+
+	return nil
+}
+
+func (ec *execCommands) runPending(name string) {
+	ec.lock.Lock()
+	state := ec.states[name]
+	args := state.pendingArgs
+	state.hasPending = false
+	ec.lock.Unlock()
+
+	ec.run(name, args)
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	state.lastRun = time.Now()
+
+	if state.hasPending {
+		time.AfterFunc(execMinInterval, func() { ec.runPending(name) })
+		return
+	}
+
+	state.scheduled = false
+}
+
+func (ec *execCommands) run(name string, args []string) {
+	command, ok := ec.deej.config.ExecCommands[name]
+	if !ok || len(command) == 0 {
+		ec.logger.Warnw("Command was removed from config, not running it", "name", name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	argv := append(append([]string{}, command[1:]...), args...)
+
+	cmd := exec.CommandContext(ctx, command[0], argv...)
+	util.HideCommandWindow(cmd)
+
+	ec.logger.Debugw("Running command", "name", name, "command", command[0], "args", argv)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		ec.logger.Warnw("Command failed", "name", name, "error", err, "output", strings.TrimSpace(string(output)))
+		return
+	}
+
+	ec.logger.Debugw("Command finished", "name", name, "output", strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,282 @@
+package deej
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// how often a fade adjusts volumes
+	fadeStepInterval = 25 * time.Millisecond
+
+	// fades follow an exponential curve from full volume down to this level, in dB, and then cut to silence.
+	// loudness is heard logarithmically, so this sounds even where a linear fade seems to drop off only at the end
+	fadeFloorDB = -50
+
+	// volume changes smaller than this are considered our own rounding rather than the user moving a slider
+	fadeVolumeTolerance = 0.01
+)
+
+// fader fades every app a slider controls out when the fade.out action is triggered, e.g. when the doorbell rings,
+// and with fade_out.restore, back in when it's triggered again
+type fader struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	triggers chan struct{}
+
+	lock     sync.Mutex
+	onChange func(fadedOut bool)
+
+	// only touched by the fade's goroutine: how far the fade has come, from 0 (full volume) to 1 (silent),
+	// which way it's heading (0 when it isn't), and the sessions being faded
+	position  float64
+	direction float64
+	lastStep  time.Time
+	sessions  map[Session]*fadedSession
+}
+
+type fadedSession struct {
+	// the volume to restore once fading back in
+	base float32
+
+	// the volume the fader last set, to tell when something else (like a slider) changes it
+	lastSet float32
+}
+
+func newFader(deej *Deej, logger *zap.SugaredLogger) *fader {
+	logger = logger.Named("fade")
+
+	f := &fader{
+		deej:     deej,
+		logger:   logger,
+		triggers: make(chan struct{}, 1),
+		sessions: make(map[Session]*fadedSession),
+	}
+
+	logger.Debug("Created fader instance")
+
+	return f
+}
+
+// attach sets up the tray menu's fade item, which onChange retitles depending on whether triggering the fade
+// fades back in
+func (f *fader) attach(onChange func(fadedOut bool)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.onChange = onChange
+}
+
+// start begins handling triggers. Once deej shuts down, faded apps are restored if fade_out.restore is on,
+// so quitting doesn't leave them silent.
+func (f *fader) start() {
+	f.deej.spawn(func(ctx context.Context) error {
+		// receiving from a nil channel blocks forever, leaving that case out of the select while not fading
+		var ticker *time.Ticker
+		var ticks <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				if ticker != nil {
+					ticker.Stop()
+				}
+
+				if f.deej.config.FadeOut.Restore {
+					f.restoreAll()
+				}
+
+				return nil
+			case <-f.triggers:
+				f.toggle()
+			case <-ticks:
+				f.step()
+			}
+
+			if fading := f.direction != 0; fading && ticker == nil {
+				ticker = time.NewTicker(fadeStepInterval)
+				ticks = ticker.C
+			} else if !fading && ticker != nil {
+				ticker.Stop()
+				ticker, ticks = nil, nil
+			}
+		}
+	})
+}
+
+// trigger fades out, or back in if already faded out. Triggers that come in faster than they're handled are merged.
+func (f *fader) trigger() {
+	select {
+	case f.triggers <- struct{}{}:
+	default:
+	}
+}
+
+func (f *fader) toggle() {
+	restore := f.deej.config.FadeOut.Restore
+
+	switch {
+	case f.direction > 0 && !restore:
+		return
+	case f.direction != 0:
+		f.direction = -f.direction
+	case f.position >= 1:
+		f.direction = -1
+	default:
+		if !f.begin() {
+			return
+		}
+	}
+
+	f.lastStep = time.Now()
+
+	if f.direction > 0 {
+		f.logger.Infow("Fading out", "sessions", len(f.sessions), "duration", f.deej.config.FadeOut.Duration)
+	} else {
+		f.logger.Infow("Fading back in", "sessions", len(f.sessions))
+	}
+
+	f.notify(f.direction > 0 && restore)
+}
+
+// begin starts fading out the sessions that aren't silent already, returning false if there are none
+func (f *fader) begin() bool {
+	f.sessions = make(map[Session]*fadedSession)
+
+	for _, session := range f.deej.sessions.fadeableSessions() {
+		if volume := session.GetVolume(); volume > 0 {
+			f.sessions[session] = &fadedSession{base: volume, lastSet: volume}
+		}
+	}
+
+	if len(f.sessions) == 0 {
+		f.logger.Info("No playing apps a slider controls, nothing to fade out")
+		return false
+	}
+
+	f.position = 0
+	f.direction = 1
+
+	return true
+}
+
+// step moves the fade along by the time since the last step
+func (f *fader) step() {
+	now := time.Now()
+	elapsed := now.Sub(f.lastStep)
+	f.lastStep = now
+
+	delta := 1.0
+	if duration := f.deej.config.FadeOut.Duration; duration > 0 {
+		delta = float64(elapsed) / float64(duration)
+	}
+
+	f.position = math.Max(0, math.Min(1, f.position+delta*f.direction))
+	gain := fadeGain(f.position)
+
+	for session, state := range f.sessions {
+		f.apply(session, state, gain)
+	}
+
+	switch {
+	case f.direction > 0 && f.position >= 1:
+		f.logger.Debug("Faded out")
+		f.direction = 0
+
+		// without restore, the next trigger fades out whatever's playing by then
+		if !f.deej.config.FadeOut.Restore {
+			f.reset()
+		}
+
+	case f.direction < 0 && f.position <= 0:
+		f.logger.Debug("Faded back in")
+		f.reset()
+		f.notify(false)
+	}
+}
+
+// apply sets a faded session's volume according to the fade's current gain
+func (f *fader) apply(session Session, state *fadedSession, gain float32) {
+	volume := session.GetVolume()
+	if math.Abs(float64(volume-state.lastSet)) > fadeVolumeTolerance {
+		// something else set a new volume, which takes the session out of the fade
+		f.logger.Debugw("Session volume changed during fade, leaving it be", "session", session)
+		delete(f.sessions, session)
+		return
+	}
+
+	newVolume := f.deej.sessions.clampVolume(session, state.base*gain)
+	state.lastSet = newVolume
+
+	if newVolume == volume {
+		return
+	}
+
+	if err := f.deej.sessions.setSessionVolume(session, newVolume); err != nil {
+		// most likely the app quit
+		f.logger.Debugw("Failed to set faded session volume", "session", session, "error", err)
+		delete(f.sessions, session)
+		return
+	}
+
+	f.deej.sessions.cacheVolume(session, newVolume)
+}
+
+// restoreAll puts the faded sessions back at their volumes at once
+func (f *fader) restoreAll() {
+	if f.position == 0 {
+		return
+	}
+
+	f.position = 0
+
+	for session, state := range f.sessions {
+		f.apply(session, state, 1)
+	}
+
+	f.reset()
+}
+
+func (f *fader) reset() {
+	f.position = 0
+	f.direction = 0
+	f.sessions = make(map[Session]*fadedSession)
+}
+
+func (f *fader) notify(fadedOut bool) {
+	f.lock.Lock()
+	onChange := f.onChange
+	f.lock.Unlock()
+
+	if onChange != nil {
+		onChange(fadedOut)
+	}
+}
+
+// fadeGain returns the gain at a position along a fade, on an exponential curve down to fadeFloorDB
+func fadeGain(position float64) float32 {
+	if position >= 1 {
+		return 0
+	}
+
+	return float32(math.Pow(10, fadeFloorDB*position/20))
+}
+
+// fadeableSessions returns the sessions a slider controls, which fade.out fades. The mic is left out, since
+// fading it wouldn't make anything quieter.
+func (m *sessionMap) fadeableSessions() []Session {
+	var sessions []Session
+
+	for _, session := range m.snapshot() {
+		if session.Key() != inputSessionName && m.sessionMapped(session) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions
+}
@@ -0,0 +1,304 @@
+package deej
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"go.uber.org/zap"
+)
+
+// how long tests wait for something to happen on another goroutine before giving up
+const testTimeout = time.Second
+
+// fakeSession is an in-memory Session
+type fakeSession struct {
+	key string
+	id  string
+
+	lock     sync.Mutex
+	volume   float32
+	muted    bool
+	released bool
+
+	// returned by SetVolume and SetMute, if set
+	err error
+}
+
+func newFakeSession(key string, id string, volume float32) *fakeSession {
+	return &fakeSession{key: key, id: id, volume: volume}
+}
+
+// fakeProcessSession is a fakeSession that belongs to a process
+type fakeProcessSession struct {
+	*fakeSession
+	pid int
+}
+
+func (s *fakeProcessSession) processID() int {
+	return s.pid
+}
+
+func (s *fakeSession) GetVolume() float32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.volume
+}
+
+func (s *fakeSession) SetVolume(v float32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.volume = v
+	return nil
+}
+
+func (s *fakeSession) GetMute() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.muted
+}
+
+func (s *fakeSession) SetMute(m bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.muted = m
+	return nil
+}
+
+func (s *fakeSession) GetPeak() float32 { return 0 }
+func (s *fakeSession) Key() string      { return strings.ToLower(s.key) }
+func (s *fakeSession) ID() string       { return s.id }
+
+func (s *fakeSession) Release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.released = true
+}
+
+func (s *fakeSession) wasReleased() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.released
+}
+
+// fakeSessionFinder hands out whatever sessions the test gives it
+type fakeSessionFinder struct {
+	lock     sync.Mutex
+	sessions []Session
+	err      error
+}
+
+func (f *fakeSessionFinder) GetAllSessions() ([]Session, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]Session(nil), f.sessions...), f.err
+}
+
+func (f *fakeSessionFinder) Release() error { return nil }
+
+func (f *fakeSessionFinder) setSessions(sessions ...Session) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.sessions = sessions
+}
+
+// fakeNotifier records notifications instead of showing them
+type fakeNotifier struct {
+	lock   sync.Mutex
+	titles []string
+}
+
+func (n *fakeNotifier) Notify(title string, message string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.titles = append(n.titles, title)
+}
+
+func (n *fakeNotifier) notified(title string) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, existing := range n.titles {
+		if existing == title {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scriptedPort stands in for the board's serial port, replaying lines as if the board sent them
+// and recording the lines deej sends back
+type scriptedPort struct {
+	reader *io.PipeReader
+
+	lock    sync.Mutex
+	written []string
+}
+
+func newScriptedPort(lines ...string) *scriptedPort {
+	reader, writer := io.Pipe()
+
+	// once the port is closed the write fails, so this never outlives it
+	go func() {
+		for _, line := range lines {
+			if _, err := io.WriteString(writer, line+"\r\n"); err != nil {
+				return
+			}
+		}
+	}()
+
+	return &scriptedPort{reader: reader}
+}
+
+func (p *scriptedPort) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+func (p *scriptedPort) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.written = append(p.written, strings.TrimSuffix(string(b), "\r\n"))
+	return len(b), nil
+}
+
+func (p *scriptedPort) Close() error {
+	return p.reader.Close()
+}
+
+// newTestRoutines returns a routine group that fails the test on panics, and shuts it down once the test ends
+func newTestRoutines(t *testing.T) *routineGroup {
+	t.Helper()
+
+	routines := newRoutineGroup(func(recoverValue interface{}) {
+		t.Errorf("panic on background goroutine: %v", recoverValue)
+	})
+
+	t.Cleanup(func() {
+		routines.cancel()
+		if err := routines.wait(testTimeout); err != nil {
+			t.Errorf("background goroutines didn't stop: %v", err)
+		}
+	})
+
+	return routines
+}
+
+// newTestConfig returns a config with the given slider mapping, as if it was loaded from a file
+func newTestConfig(mapping map[int][]string) *CanonicalConfig {
+	sliderMapping := newSliderMap()
+	for sliderIdx, targets := range mapping {
+		sliderMapping.set(sliderIdx, targets)
+	}
+
+	return &CanonicalConfig{
+		SliderMapping:     sliderMapping,
+		baseSliderMapping: sliderMapping,
+		Devices:           []DeviceInfo{{}},
+		ActiveProfile:     DefaultProfileName,
+		logger:            zap.NewNop().Sugar(),
+		notifier:          &fakeNotifier{},
+		events:            newEventBus(),
+	}
+}
+
+// newTestSerialIO returns a SerialIO that reads from a scripted port instead of the board, once started.
+// It publishes to the config's event bus.
+func newTestSerialIO(t *testing.T, config *CanonicalConfig, port *scriptedPort) *SerialIO {
+	t.Helper()
+
+	sio, err := NewSerialIO(config, config.events, newTestRoutines(t), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewSerialIO: %v", err)
+	}
+
+	sio.openPort = func(serial.OpenOptions) (io.ReadWriteCloser, error) {
+		return port, nil
+	}
+
+	return sio
+}
+
+// newTestSessionMap returns a session map over the finder's sessions, which have already been acquired.
+// It uses the config's event bus.
+func newTestSessionMap(t *testing.T, config *CanonicalConfig, finder *fakeSessionFinder) *sessionMap {
+	t.Helper()
+
+	m, err := newSessionMap(config, config.events, newTestRoutines(t), zap.NewNop().Sugar(), finder)
+	if err != nil {
+		t.Fatalf("newSessionMap: %v", err)
+	}
+
+	if err := m.getAndAddSessions(); err != nil {
+		t.Fatalf("getAndAddSessions: %v", err)
+	}
+
+	return m
+}
+
+// receive waits for a value from c, failing the test if none arrives in time
+func receive[T any](t *testing.T, c <-chan T) T {
+	t.Helper()
+
+	select {
+	case value := <-c:
+		return value
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	var zero T
+	return zero
+}
+
+// drain returns everything currently buffered in c
+func drain[T any](c <-chan T) []T {
+	var values []T
+
+	for {
+		select {
+		case value := <-c:
+			values = append(values, value)
+		default:
+			return values
+		}
+	}
+}
+
+// waitFor polls condition until it's true, failing the test if it takes too long
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for condition")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/thoas/go-funk"
+)
+
+const (
+	// prebuilt firmware is attached to each release as deej-firmware-<variant>-<board>.<hex or bin>
+	firmwareLatestURL  = "https://github.com/omriharel/deej/releases/latest/download/"
+	firmwareReleaseURL = "https://github.com/omriharel/deej/releases/download/%s/"
+	firmwareAssetName  = "deej-firmware-%s-%s%s"
+
+	firmwareDownloadTimeout = 2 * time.Minute
+
+	// boards with native USB (e.g. the Leonardo) jump to their bootloader when the port is opened at 1200 baud
+	// and closed again, and come back as a new port for a few seconds
+	flashTouchBaudRate     = 1200
+	flashBootloaderTimeout = 10 * time.Second
+)
+
+const (
+	flashToolAvrdude = "avrdude"
+	flashToolEsptool = "esptool"
+)
+
+// FirmwareVariants lists the firmware that can be flashed, matching the sketches in the repository's arduino folder
+var FirmwareVariants = []string{"vanilla", "buttons", "vu-meter"}
+
+// flashBoard describes how to flash one kind of board
+type flashBoard struct {
+	description string
+	tool        string
+	chip        string // avrdude part or esptool chip
+	programmer  string // avrdude only
+	baudRate    int
+	touchReset  bool
+}
+
+func (b flashBoard) imageExtension() string {
+	if b.tool == flashToolEsptool {
+		return ".bin"
+	}
+
+	return ".hex"
+}
+
+var flashBoards = map[string]flashBoard{
+	"uno":      {"Arduino Uno", flashToolAvrdude, "atmega328p", "arduino", 115200, false},
+	"nano":     {"Arduino Nano", flashToolAvrdude, "atmega328p", "arduino", 115200, false},
+	"nano-old": {"Arduino Nano (old bootloader)", flashToolAvrdude, "atmega328p", "arduino", 57600, false},
+	"leonardo": {"Arduino Leonardo or Pro Micro", flashToolAvrdude, "atmega32u4", "avr109", 57600, true},
+	"mega":     {"Arduino Mega 2560", flashToolAvrdude, "atmega2560", "wiring", 115200, false},
+	"esp32":    {"ESP32", flashToolEsptool, "esp32", "", 460800, false},
+	"esp8266":  {"ESP8266", flashToolEsptool, "esp8266", "", 460800, false},
+}
+
+// FlashBoards returns the names of the boards that can be flashed, sorted
+func FlashBoards() []string {
+	names := make([]string, 0, len(flashBoards))
+	for name := range flashBoards {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// usbBoard is what a USB vendor and product ID says about the board behind a serial port. USB-serial chips
+// like the CH340 are used by many boards, so those only make for a guess
+type usbBoard struct {
+	board   string
+	certain bool
+}
+
+var usbBoards = map[usbID]usbBoard{
+	{0x2341, 0x0043}: {"uno", true},
+	{0x2341, 0x0001}: {"uno", true},
+	{0x2341, 0x0243}: {"uno", true},
+	{0x2a03, 0x0043}: {"uno", true},
+	{0x2341, 0x8036}: {"leonardo", true},
+	{0x2341, 0x0036}: {"leonardo", true}, // bootloader
+	{0x2341, 0x8037}: {"leonardo", true}, // micro
+	{0x2341, 0x0037}: {"leonardo", true}, // micro bootloader
+	{0x1b4f, 0x9205}: {"leonardo", true}, // pro micro 5V
+	{0x1b4f, 0x9206}: {"leonardo", true}, // pro micro 3.3V
+	{0x2341, 0x0042}: {"mega", true},
+	{0x2341, 0x0010}: {"mega", true},
+	{0x1a86, 0x7523}: {"nano", false},  // CH340, on most Nano clones
+	{0x0403, 0x6001}: {"nano", false},  // FTDI, on older Nanos
+	{0x10c4, 0xea60}: {"esp32", false}, // CP210x, on most ESP32 dev boards
+}
+
+type usbID struct {
+	vendor  uint16
+	product uint16
+}
+
+// usbSerialPort is a serial port along with the USB IDs and serial number of the device behind it
+type usbSerialPort struct {
+	name         string
+	id           usbID
+	serialNumber string // empty for devices that don't have one
+}
+
+// FlashOptions configures flashing firmware onto a board
+type FlashOptions struct {
+	// the serial port the board is on. If empty, the port is detected from the connected boards
+	Port string
+
+	// one of FlashBoards. If empty, the board is detected from the port's USB IDs
+	Board string
+
+	// one of FirmwareVariants
+	Variant string
+
+	// a firmware image to flash instead of downloading Variant
+	File string
+
+	// the release to download firmware from, or empty for the latest one
+	Version string
+}
+
+// Flash writes deej firmware onto a board through avrdude or esptool, which have to be installed. It finds the
+// board and firmware to use where they aren't given, and writes its progress and the tool's output to w.
+// deej itself shouldn't be running, since it keeps the serial port busy.
+func Flash(ctx context.Context, w io.Writer, options FlashOptions) error {
+	port, boardName, err := flashTarget(w, options)
+	if err != nil {
+		return err
+	}
+
+	board := flashBoards[boardName]
+
+	tool, err := findFlashTool(board.tool)
+	if err != nil {
+		return err
+	}
+
+	image := options.File
+	if image == "" {
+		if image, err = downloadFirmware(ctx, w, options, boardName, board); err != nil {
+			return err
+		}
+		defer os.Remove(image)
+	}
+
+	if board.touchReset {
+		if port, err = enterBootloader(ctx, w, port); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "Flashing %s on %s with %s\n", filepath.Base(image), port, filepath.Base(tool))
+
+	command := exec.CommandContext(ctx, tool, flashToolArgs(board, port, image)...)
+	command.Stdout = w
+	command.Stderr = w
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("run %s: %w", board.tool, err)
+	}
+
+	fmt.Fprintln(w, "Done! Start deej and move a slider to check the board is working.")
+
+	return nil
+}
+
+// flashTarget works out which port and board to flash, detecting whichever of them isn't given
+func flashTarget(w io.Writer, options FlashOptions) (string, string, error) {
+	if options.Board != "" {
+		if _, ok := flashBoards[options.Board]; !ok {
+			return "", "", fmt.Errorf("unknown board %s (expected one of %s)", options.Board, strings.Join(FlashBoards(), ", "))
+		}
+	}
+
+	if options.Port != "" && options.Board != "" {
+		return options.Port, options.Board, nil
+	}
+
+	ports, err := listUSBSerialPorts()
+	if err != nil {
+		return "", "", fmt.Errorf("list serial ports: %w", err)
+	}
+
+	var candidates []usbSerialPort
+	for _, port := range ports {
+		if options.Port == "" || strings.EqualFold(port.name, options.Port) {
+			if _, known := usbBoards[port.id]; known || options.Board != "" {
+				candidates = append(candidates, port)
+			}
+		}
+	}
+
+	switch {
+	case len(candidates) == 0 && options.Port != "":
+		return "", "", fmt.Errorf("couldn't tell which board is on %s, use --board", options.Port)
+	case len(candidates) == 0:
+		return "", "", errors.New("no board found, plug one in or use --port and --board")
+	case len(candidates) > 1:
+		var names []string
+		for _, candidate := range candidates {
+			names = append(names, candidate.name)
+		}
+
+		return "", "", fmt.Errorf("found boards on %s, use --port to pick one", strings.Join(names, ", "))
+	}
+
+	port := candidates[0]
+	if options.Board != "" {
+		return port.name, options.Board, nil
+	}
+
+	detected := usbBoards[port.id]
+	if detected.certain {
+		fmt.Fprintf(w, "Found %s on %s\n", flashBoards[detected.board].description, port.name)
+	} else {
+		fmt.Fprintf(w, "Found what looks like %s on %s (use --board if it's something else)\n",
+			flashBoards[detected.board].description, port.name)
+	}
+
+	return port.name, detected.board, nil
+}
+
+// findFlashTool looks for the tool on the PATH, under the names it's usually installed as
+func findFlashTool(tool string) (string, error) {
+	names := []string{tool}
+	hint := "it ships with the Arduino IDE, or install it from your package manager"
+
+	if tool == flashToolEsptool {
+		names = append(names, "esptool.py")
+		hint = "install it with pip install esptool"
+	}
+
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s not found (%s) - make sure it's on your PATH", tool, hint)
+}
+
+func flashToolArgs(board flashBoard, port string, image string) []string {
+	if board.tool == flashToolEsptool {
+		return []string{
+			"--chip", board.chip,
+			"--port", port,
+			"--baud", fmt.Sprint(board.baudRate),
+			"write_flash", "0x0", image,
+		}
+	}
+
+	return []string{
+		"-p", board.chip,
+		"-c", board.programmer,
+		"-P", port,
+		"-b", fmt.Sprint(board.baudRate),
+		"-D",
+		"-U", fmt.Sprintf("flash:w:%s:i", image),
+	}
+}
+
+// downloadFirmware downloads the firmware image for the board to a temporary file, returning its path
+func downloadFirmware(ctx context.Context, w io.Writer, options FlashOptions, boardName string, board flashBoard) (string, error) {
+	variant := options.Variant
+	if !funk.ContainsString(FirmwareVariants, variant) {
+		return "", fmt.Errorf("unknown firmware variant %s (expected one of %s)", variant, strings.Join(FirmwareVariants, ", "))
+	}
+
+	baseURL := firmwareLatestURL
+	if options.Version != "" {
+		baseURL = fmt.Sprintf(firmwareReleaseURL, options.Version)
+	}
+
+	asset := fmt.Sprintf(firmwareAssetName, variant, boardName, board.imageExtension())
+	fmt.Fprintf(w, "Downloading %s\n", baseURL+asset)
+
+	ctx, cancel := context.WithTimeout(ctx, firmwareDownloadTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+asset, nil)
+	if err != nil {
+		return "", fmt.Errorf("create firmware request: %w", err)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("download firmware: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download firmware: %s (this release may not have firmware for the %s, try --file)",
+			response.Status, board.description)
+	}
+
+	file, err := os.CreateTemp("", "deej-firmware-*"+board.imageExtension())
+	if err != nil {
+		return "", fmt.Errorf("create firmware file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, response.Body); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("download firmware: %w", err)
+	}
+
+	return file.Name(), nil
+}
+
+// enterBootloader resets a native USB board into its bootloader, returning the port the bootloader shows up on
+func enterBootloader(ctx context.Context, w io.Writer, port string) (string, error) {
+	before, err := listSerialPorts()
+	if err != nil {
+		return "", fmt.Errorf("list serial ports: %w", err)
+	}
+
+	fmt.Fprintf(w, "Resetting the board on %s into its bootloader\n", port)
+
+	touch, err := serial.Open(serial.OpenOptions{
+		PortName:        port,
+		BaudRate:        flashTouchBaudRate,
+		DataBits:        8,
+		StopBits:        1,
+		MinimumReadSize: 1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("open serial port %s (is deej still running?): %w", port, err)
+	}
+	touch.Close()
+
+	deadline := time.Now().Add(flashBootloaderTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+
+		after, err := listSerialPorts()
+		if err != nil {
+			continue
+		}
+
+		for _, candidate := range after {
+			if !funk.ContainsString(before, candidate) {
+				return candidate, nil
+			}
+		}
+	}
+
+	// some systems hand the bootloader the same port name
+	return port, nil
+}
@@ -0,0 +1,59 @@
+package deej
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listUSBSerialPorts finds the USB device behind each serial port by walking up its sysfs device path
+// to the directory holding the USB IDs and serial number
+func listUSBSerialPorts() ([]usbSerialPort, error) {
+	ports, err := listSerialPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	var usbPorts []usbSerialPort
+
+	for _, port := range ports {
+		device, err := filepath.EvalSymlinks(filepath.Join("/sys/class/tty", filepath.Base(port), "device"))
+		if err != nil {
+			continue
+		}
+
+		for dir := device; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+			vendor, vendorErr := readUSBIDFile(filepath.Join(dir, "idVendor"))
+			product, productErr := readUSBIDFile(filepath.Join(dir, "idProduct"))
+
+			if vendorErr == nil && productErr == nil {
+				// the serial number is optional, and many USB-serial chips don't have one
+				serialNumber, _ := os.ReadFile(filepath.Join(dir, "serial"))
+
+				usbPorts = append(usbPorts, usbSerialPort{
+					name:         port,
+					id:           usbID{vendor, product},
+					serialNumber: strings.TrimSpace(string(serialNumber)),
+				})
+				break
+			}
+		}
+	}
+
+	return usbPorts, nil
+}
+
+func readUSBIDFile(path string) (uint16, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 16, 16)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(id), nil
+}
@@ -0,0 +1,112 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thoas/go-funk"
+	"golang.org/x/sys/windows/registry"
+)
+
+// USB devices are listed here by "VID_xxxx&PID_yyyy", with the COM port of each instance under its device parameters
+const usbDevicesRegistryKey = `SYSTEM\CurrentControlSet\Enum\USB`
+
+// listUSBSerialPorts matches the present serial ports with the USB devices that registered them
+func listUSBSerialPorts() ([]usbSerialPort, error) {
+	ports, err := listSerialPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := registry.OpenKey(registry.LOCAL_MACHINE, usbDevicesRegistryKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("open usb devices registry key: %w", err)
+	}
+	defer devices.Close()
+
+	deviceNames, err := devices.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("read usb devices registry key: %w", err)
+	}
+
+	var usbPorts []usbSerialPort
+
+	for _, deviceName := range deviceNames {
+		id, ok := parseUSBDeviceName(deviceName)
+		if !ok {
+			continue
+		}
+
+		for _, port := range usbDevicePorts(devices, deviceName) {
+			// devices that were unplugged stay in the registry, so only ports that are present count
+			if funk.ContainsString(ports, port.name) {
+				port.id = id
+				usbPorts = append(usbPorts, port)
+			}
+		}
+	}
+
+	return usbPorts, nil
+}
+
+// usbDevicePorts returns the COM ports of every instance of a USB device. Instances are named after the device's
+// serial number if it has one, and get a generated name containing "&" otherwise
+func usbDevicePorts(devices registry.Key, deviceName string) []usbSerialPort {
+	device, err := registry.OpenKey(devices, deviceName, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil
+	}
+	defer device.Close()
+
+	instances, err := device.ReadSubKeyNames(0)
+	if err != nil {
+		return nil
+	}
+
+	var ports []usbSerialPort
+
+	for _, instance := range instances {
+		parameters, err := registry.OpenKey(device, instance+`\Device Parameters`, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+
+		if port, _, err := parameters.GetStringValue("PortName"); err == nil {
+			serialNumber := instance
+			if strings.Contains(instance, "&") {
+				serialNumber = ""
+			}
+
+			ports = append(ports, usbSerialPort{name: port, serialNumber: serialNumber})
+		}
+
+		parameters.Close()
+	}
+
+	return ports
+}
+
+// parseUSBDeviceName reads the IDs from a name like "VID_2341&PID_8036&MI_00"
+func parseUSBDeviceName(name string) (usbID, bool) {
+	var id usbID
+	var foundVendor, foundProduct bool
+
+	for _, part := range strings.Split(strings.ToUpper(name), "&") {
+		switch {
+		case strings.HasPrefix(part, "VID_"):
+			value, err := strconv.ParseUint(strings.TrimPrefix(part, "VID_"), 16, 16)
+			id.vendor, foundVendor = uint16(value), err == nil
+		case strings.HasPrefix(part, "PID_"):
+			value, err := strconv.ParseUint(strings.TrimPrefix(part, "PID_"), 16, 16)
+			id.product, foundProduct = uint16(value), err == nil
+		}
+	}
+
+	return id, foundVendor && foundProduct
+}
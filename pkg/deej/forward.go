@@ -0,0 +1,184 @@
+package deej
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const sliderForwardTimeout = 2 * time.Second
+
+// sliderForwarder moves sliders on other deej instances along with the local ones set in forward_slider, through
+// their HTTP API's virtual sliders
+type sliderForwarder struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	pending  map[int]float32         // the latest value of each slider that's waiting to be sent
+	sending  map[int]bool            // sliders with a request in flight, whose next value waits in pending
+	lastSent map[int]float32         // so a value the other instance forwards right back isn't sent again
+	failing  map[string]bool         // addresses whose last request failed, to only warn once
+	clients  map[string]*http.Client // by pinned fingerprint, so connections are kept alive between moves
+}
+
+func newSliderForwarder(deej *Deej, logger *zap.SugaredLogger) *sliderForwarder {
+	logger = logger.Named("forward")
+
+	sf := &sliderForwarder{
+		deej:     deej,
+		logger:   logger,
+		pending:  make(map[int]float32),
+		sending:  make(map[int]bool),
+		lastSent: make(map[int]float32),
+		failing:  make(map[string]bool),
+		clients:  make(map[string]*http.Client),
+	}
+
+	logger.Debug("Created slider forwarder instance")
+
+	return sf
+}
+
+func (sf *sliderForwarder) start() {
+	sliderEventsChannel := sf.deej.events.sliderMoved.subscribe()
+
+	sf.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderEventsChannel:
+				sf.handleSliderMove(event)
+			}
+		}
+	})
+}
+
+func (sf *sliderForwarder) handleSliderMove(event SliderMoveEvent) {
+	if _, ok := sf.deej.config.ForwardSliders[event.SliderID]; !ok {
+		return
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	if lastSent, ok := sf.lastSent[event.SliderID]; ok && lastSent == event.PercentValue && !sf.sending[event.SliderID] {
+		return
+	}
+
+	sf.pending[event.SliderID] = event.PercentValue
+
+	// moves that come in while a request is in flight only keep the latest value, which is sent once it's done
+	if sf.sending[event.SliderID] {
+		return
+	}
+
+	sf.sending[event.SliderID] = true
+	util.Go(sf.deej.handlePanic, func() { sf.sendPending(event.SliderID) })
+}
+
+// sendPending sends a slider's latest value until no newer one is waiting
+func (sf *sliderForwarder) sendPending(sliderIdx int) {
+	for {
+		sf.lock.Lock()
+		value, ok := sf.pending[sliderIdx]
+		forward, forwarded := sf.deej.config.ForwardSliders[sliderIdx]
+
+		if !ok || !forwarded {
+			sf.sending[sliderIdx] = false
+			sf.lock.Unlock()
+			return
+		}
+
+		delete(sf.pending, sliderIdx)
+		sf.lastSent[sliderIdx] = value
+		sf.lock.Unlock()
+
+		err := sf.send(forward, value)
+		sf.reportResult(forward.Address, err)
+	}
+}
+
+func (sf *sliderForwarder) send(forward SliderForward, value float32) error {
+	body, err := json.Marshal(webUISliderMove{Value: value})
+	if err != nil {
+		return fmt.Errorf("encode slider move: %w", err)
+	}
+
+	scheme := "http"
+	if forward.Fingerprint != "" {
+		scheme = "https"
+	}
+
+	url := fmt.Sprintf("%s://%s/ui/api/sliders/%d", scheme, forward.Address, forward.Slider)
+
+	request, err := http.NewRequestWithContext(sf.deej.routines.ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if forward.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+forward.Token)
+	}
+
+	response, err := sf.client(forward.Fingerprint).Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// client returns the HTTP client for instances served over TLS with the given certificate, or without TLS
+func (sf *sliderForwarder) client(fingerprint string) *http.Client {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	if client, ok := sf.clients[fingerprint]; ok {
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if fingerprint != "" {
+		transport.TLSClientConfig = PinnedTLSConfig(fingerprint)
+	}
+
+	client := &http.Client{Timeout: sliderForwardTimeout, Transport: transport}
+	sf.clients[fingerprint] = client
+
+	return client
+}
+
+// reportResult warns when an instance stops accepting slider moves, and says when it's back
+func (sf *sliderForwarder) reportResult(address string, err error) {
+	sf.lock.Lock()
+	wasFailing := sf.failing[address]
+	sf.failing[address] = err != nil
+	sf.lock.Unlock()
+
+	if err != nil && !wasFailing && sf.deej.routines.ctx.Err() == nil {
+		sf.logger.Warnw("Failed to forward slider move, is its HTTP API enabled with virtual_sliders?",
+			"address", address, "error", err)
+	} else if err == nil && wasFailing {
+		sf.logger.Infow("Forwarding slider moves again", "address", address)
+	}
+}
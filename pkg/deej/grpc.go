@@ -0,0 +1,452 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/omriharel/deej/pkg/deej/deejpb"
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// how many events a slow gRPC client may fall behind before events are dropped for it
+const grpcWatcherBufferSize = 32
+
+var errRemoteNotAllowed = errors.New("refusing to listen on a non-loopback address without allow_remote")
+
+// grpcServer implements the deej control API on top of the running instance
+type grpcServer struct {
+	deejpb.UnimplementedDeejServer
+
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	server   *grpc.Server
+	listener net.Listener
+	address  string
+	tls      TLSInfo
+
+	sliderWatchers     *grpcWatchers[*deejpb.SliderMoveEvent]
+	sessionWatchers    *grpcWatchers[*deejpb.SessionChanged]
+	connectionWatchers *grpcWatchers[*deejpb.ConnectionState]
+}
+
+func newGRPCServer(deej *Deej, logger *zap.SugaredLogger) *grpcServer {
+	logger = logger.Named("grpc")
+
+	gs := &grpcServer{
+		deej:               deej,
+		logger:             logger,
+		sliderWatchers:     newGRPCWatchers[*deejpb.SliderMoveEvent](),
+		sessionWatchers:    newGRPCWatchers[*deejpb.SessionChanged](),
+		connectionWatchers: newGRPCWatchers[*deejpb.ConnectionState](),
+	}
+
+	logger.Debug("Created gRPC server instance")
+
+	return gs
+}
+
+// initialize subscribes to the events the server relays to its clients
+func (gs *grpcServer) initialize() {
+	gs.setupEventRelays()
+	gs.setupOnConfigReload()
+}
+
+// start begins serving if the API is enabled in the config
+func (gs *grpcServer) start() error {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	info := gs.deej.config.GRPCInfo
+	if !info.Enabled {
+		gs.logger.Debug("gRPC API disabled in config, not starting")
+		return nil
+	}
+
+	if gs.server != nil {
+		return nil
+	}
+
+	if !info.AllowRemote {
+		if err := ensureLoopbackAddress(info.Address); err != nil {
+			gs.logger.Warnw("Invalid gRPC API address", "address", info.Address, "error", err)
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", info.Address)
+	if err != nil {
+		gs.logger.Warnw("Failed to listen for gRPC API", "address", info.Address, "error", err)
+		return fmt.Errorf("listen on %s: %w", info.Address, err)
+	}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(gs.authenticateUnary),
+		grpc.ChainStreamInterceptor(gs.authenticateStream),
+	}
+
+	if info.TLS.Enabled {
+		cert, fingerprint, err := loadAPICertificate(info.TLS)
+		if err != nil {
+			listener.Close()
+			gs.logger.Warnw("Failed to load gRPC API certificate", "error", err)
+			return fmt.Errorf("load certificate: %w", err)
+		}
+
+		options = append(options, grpc.Creds(credentials.NewTLS(apiTLSConfig(cert))))
+		gs.logger.Infow("gRPC API serving over TLS", "fingerprint", fingerprint)
+	}
+
+	if info.AllowRemote && info.Token == "" {
+		gs.logger.Warn("gRPC API allows remote clients without a token, anyone on the network can control deej")
+	}
+
+	gs.server = grpc.NewServer(options...)
+	gs.listener = listener
+	gs.address = info.Address
+	gs.tls = info.TLS
+	deejpb.RegisterDeejServer(gs.server, gs)
+
+	server := gs.server
+	util.Go(gs.deej.handlePanic, func() {
+		if err := server.Serve(listener); err != nil {
+			gs.logger.Warnw("gRPC server stopped with error", "error", err)
+		}
+	})
+
+	gs.logger.Infow("gRPC API listening", "address", listener.Addr().String())
+
+	return nil
+}
+
+// stop shuts the server down, closing all open streams
+func (gs *grpcServer) stop() {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	if gs.server == nil {
+		return
+	}
+
+	gs.logger.Debug("Stopping gRPC API")
+	gs.server.Stop()
+	gs.server = nil
+	gs.listener = nil
+	gs.address = ""
+	gs.tls = TLSInfo{}
+}
+
+func (gs *grpcServer) authenticateUnary(ctx context.Context, request interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := gs.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, request)
+}
+
+func (gs *grpcServer) authenticateStream(server interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := gs.authenticate(stream.Context()); err != nil {
+		return err
+	}
+
+	return handler(server, stream)
+}
+
+// authenticate requires grpc_api.token as "authorization: Bearer <token>" metadata from clients on other machines
+func (gs *grpcServer) authenticate(ctx context.Context) error {
+	token := gs.deej.config.GRPCInfo.Token
+	if token == "" {
+		return nil
+	}
+
+	if client, ok := peer.FromContext(ctx); ok && isLoopbackAddr(client.Addr) {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		if validAPIToken(bearerToken(authorization), token) {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "a token is required, see grpc_api.token in deej's config")
+}
+
+func (gs *grpcServer) setupOnConfigReload() {
+	configReloadedChannel := gs.deej.events.configReloaded.subscribe()
+
+	gs.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				info := gs.deej.config.GRPCInfo
+
+				gs.lock.Lock()
+				running := gs.server != nil
+				needsRestart := running && (!info.Enabled || info.Address != gs.address || info.TLS != gs.tls)
+				gs.lock.Unlock()
+
+				if needsRestart {
+					gs.logger.Info("gRPC API settings changed, restarting")
+					gs.stop()
+				}
+
+				if err := gs.start(); err != nil {
+					gs.logger.Warnw("Failed to start gRPC API after config reload", "error", err)
+				}
+			}
+		}
+	})
+}
+
+// setupEventRelays forwards internal events to every connected stream
+func (gs *grpcServer) setupEventRelays() {
+	sliderEventsChannel := gs.deej.events.sliderMoved.subscribe()
+	connectionStateChannel := gs.deej.events.connectionChanged.subscribe()
+	sessionChangesChannel := gs.deej.events.sessionsChanged.subscribe()
+	volumeChangesChannel := gs.deej.events.volumeChanged.subscribe()
+
+	gs.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case event := <-sliderEventsChannel:
+				gs.sliderWatchers.broadcast(&deejpb.SliderMoveEvent{
+					SliderId:     int32(event.SliderID),
+					PercentValue: event.PercentValue,
+				})
+
+			case <-connectionStateChannel:
+				gs.connectionWatchers.broadcast(gs.connectionState())
+
+			case <-sessionChangesChannel:
+				gs.sessionWatchers.broadcast(&deejpb.SessionChanged{Sessions: gs.sessions()})
+
+			case <-volumeChangesChannel:
+				gs.sessionWatchers.broadcast(&deejpb.SessionChanged{Sessions: gs.sessions()})
+			}
+		}
+	})
+}
+
+// GetStatus implements deejpb.DeejServer
+func (gs *grpcServer) GetStatus(ctx context.Context, req *deejpb.GetStatusRequest) (*deejpb.GetStatusResponse, error) {
+	return &deejpb.GetStatusResponse{
+		Version:      gs.deej.version,
+		Connection:   gs.connectionState(),
+		SliderValues: gs.deej.serial.sliderValues(),
+	}, nil
+}
+
+// ListSessions implements deejpb.DeejServer
+func (gs *grpcServer) ListSessions(ctx context.Context, req *deejpb.ListSessionsRequest) (*deejpb.ListSessionsResponse, error) {
+	return &deejpb.ListSessionsResponse{Sessions: gs.sessions()}, nil
+}
+
+// ListMappings implements deejpb.DeejServer
+func (gs *grpcServer) ListMappings(ctx context.Context, req *deejpb.ListMappingsRequest) (*deejpb.ListMappingsResponse, error) {
+	return &deejpb.ListMappingsResponse{Sliders: mappingsToProto(gs.deej.sessions.describeMappings())}, nil
+}
+
+func (gs *grpcServer) ListPresets(ctx context.Context, req *deejpb.ListPresetsRequest) (*deejpb.ListPresetsResponse, error) {
+	response := &deejpb.ListPresetsResponse{}
+	for _, name := range gs.deej.presetNames() {
+		response.Presets = append(response.Presets, &deejpb.Preset{Name: name, Volumes: gs.deej.config.Presets[name]})
+	}
+
+	return response, nil
+}
+
+func (gs *grpcServer) SavePreset(ctx context.Context, req *deejpb.SavePresetRequest) (*deejpb.SavePresetResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must not be empty")
+	}
+
+	gs.logger.Debugw("Saving preset via gRPC", "preset", req.Name)
+
+	volumes, err := gs.deej.savePreset(req.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+
+	return &deejpb.SavePresetResponse{Preset: &deejpb.Preset{Name: strings.ToLower(req.Name), Volumes: volumes}}, nil
+}
+
+func (gs *grpcServer) RestorePreset(ctx context.Context, req *deejpb.RestorePresetRequest) (*deejpb.RestorePresetResponse, error) {
+	if _, ok := gs.deej.config.Presets[strings.ToLower(req.Name)]; !ok {
+		return nil, status.Errorf(codes.NotFound, "no preset named %q", req.Name)
+	}
+
+	gs.logger.Debugw("Restoring preset via gRPC", "preset", req.Name)
+
+	adjusted, err := gs.deej.restorePreset(req.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "restore preset: %v", err)
+	}
+
+	return &deejpb.RestorePresetResponse{SessionKeys: adjusted}, nil
+}
+
+// SetVolume implements deejpb.DeejServer
+func (gs *grpcServer) SetVolume(ctx context.Context, req *deejpb.SetVolumeRequest) (*deejpb.SetVolumeResponse, error) {
+	if req.Target == "" {
+		return nil, status.Error(codes.InvalidArgument, "target must not be empty")
+	}
+
+	if req.Volume < 0 || req.Volume > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "volume %.2f is out of range [0, 1]", req.Volume)
+	}
+
+	gs.logger.Debugw("Setting volume via gRPC", "target", req.Target, "volume", req.Volume)
+
+	adjusted, err := gs.deej.sessions.setTargetVolume(req.Target, req.Volume)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "set volume: %v", err)
+	}
+
+	if len(adjusted) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no sessions match target %q", req.Target)
+	}
+
+	return &deejpb.SetVolumeResponse{SessionKeys: adjusted}, nil
+}
+
+// ReloadConfig implements deejpb.DeejServer
+func (gs *grpcServer) ReloadConfig(ctx context.Context, req *deejpb.ReloadConfigRequest) (*deejpb.ReloadConfigResponse, error) {
+	gs.logger.Info("Config reload requested via gRPC")
+
+	if err := gs.deej.config.Reload(); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "reload config: %v", err)
+	}
+
+	return &deejpb.ReloadConfigResponse{}, nil
+}
+
+// WatchSliderMoves implements deejpb.DeejServer
+func (gs *grpcServer) WatchSliderMoves(req *deejpb.WatchSliderMovesRequest, stream deejpb.Deej_WatchSliderMovesServer) error {
+	return gs.sliderWatchers.serve(stream.Context(), stream.Send)
+}
+
+// WatchSessions implements deejpb.DeejServer
+func (gs *grpcServer) WatchSessions(req *deejpb.WatchSessionsRequest, stream deejpb.Deej_WatchSessionsServer) error {
+	initial := &deejpb.SessionChanged{Sessions: gs.sessions()}
+	return gs.sessionWatchers.serve(stream.Context(), stream.Send, initial)
+}
+
+// WatchConnectionState implements deejpb.DeejServer
+func (gs *grpcServer) WatchConnectionState(req *deejpb.WatchConnectionStateRequest, stream deejpb.Deej_WatchConnectionStateServer) error {
+	return gs.connectionWatchers.serve(stream.Context(), stream.Send, gs.connectionState())
+}
+
+func (gs *grpcServer) connectionState() *deejpb.ConnectionState {
+	return &deejpb.ConnectionState{
+		Connected: gs.deej.serial.Connected(),
+		ComPort:   gs.deej.config.ConnectionInfo.COMPort,
+		BaudRate:  uint32(gs.deej.config.ConnectionInfo.BaudRate),
+	}
+}
+
+func (gs *grpcServer) sessions() []*deejpb.Session {
+	snapshot := gs.deej.sessions.snapshot()
+
+	sessions := make([]*deejpb.Session, len(snapshot))
+	for i, session := range snapshot {
+		sessions[i] = &deejpb.Session{
+			Key:    session.Key(),
+			Volume: session.GetVolume(),
+		}
+	}
+
+	return sessions
+}
+
+// ensureLoopbackAddress returns an error unless address only binds to a loopback interface
+func ensureLoopbackAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parse address %q: %w", address, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return errRemoteNotAllowed
+}
+
+// grpcWatchers fans a single event source out to any number of streaming clients.
+// Slow clients have events dropped instead of stalling the source.
+type grpcWatchers[T any] struct {
+	lock     sync.Mutex
+	watchers map[chan T]struct{}
+}
+
+func newGRPCWatchers[T any]() *grpcWatchers[T] {
+	return &grpcWatchers[T]{watchers: make(map[chan T]struct{})}
+}
+
+func (w *grpcWatchers[T]) broadcast(event T) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for ch := range w.watchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// serve sends any initial events followed by all broadcast events, until the stream's context ends
+func (w *grpcWatchers[T]) serve(ctx context.Context, send func(T) error, initial ...T) error {
+	ch := make(chan T, grpcWatcherBufferSize)
+
+	w.lock.Lock()
+	w.watchers[ch] = struct{}{}
+	w.lock.Unlock()
+
+	defer func() {
+		w.lock.Lock()
+		delete(w.watchers, ch)
+		w.lock.Unlock()
+	}()
+
+	for _, event := range initial {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-ch:
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
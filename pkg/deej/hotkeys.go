@@ -0,0 +1,279 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// how many hotkey presses may queue up while an action is still running
+const hotkeyPressBufferSize = 16
+
+type hotkeyModifiers uint8
+
+const (
+	hotkeyModCtrl hotkeyModifiers = 1 << iota
+	hotkeyModAlt
+	hotkeyModShift
+	hotkeyModSuper
+)
+
+var hotkeyModifierNames = map[string]hotkeyModifiers{
+	"ctrl":    hotkeyModCtrl,
+	"control": hotkeyModCtrl,
+	"alt":     hotkeyModAlt,
+	"option":  hotkeyModAlt,
+	"shift":   hotkeyModShift,
+	"win":     hotkeyModSuper,
+	"super":   hotkeyModSuper,
+	"meta":    hotkeyModSuper,
+	"cmd":     hotkeyModSuper,
+}
+
+var hotkeyKeyAliases = map[string]string{
+	"esc":    "escape",
+	"return": "enter",
+	"pgup":   "pageup",
+	"pgdn":   "pagedown",
+	"del":    "delete",
+	"ins":    "insert",
+}
+
+// hotkey is a parsed key combination such as "ctrl+alt+f1"
+type hotkey struct {
+	text      string
+	modifiers hotkeyModifiers
+	key       string
+}
+
+// HotkeyConfig binds a key combination to an action
+type HotkeyConfig struct {
+	Keys         string `mapstructure:"keys"`
+	ActionConfig `mapstructure:",squash"`
+}
+
+// hotkeyListener grabs global hotkeys from the OS
+type hotkeyListener interface {
+	// listen registers the hotkeys and calls onPress with the index of each one that's pressed, until stop is called.
+	// Hotkeys that can't be registered (e.g. because another app owns them) are logged and skipped.
+	listen(hotkeys []hotkey, onPress func(int)) error
+	stop()
+}
+
+// hotkeyManager performs the configured actions when their hotkeys are pressed, no matter which app has focus
+type hotkeyManager struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	presses chan ActionConfig
+
+	lock     sync.Mutex
+	listener hotkeyListener
+	bindings []HotkeyConfig
+}
+
+func newHotkeyManager(deej *Deej, logger *zap.SugaredLogger) *hotkeyManager {
+	logger = logger.Named("hotkeys")
+
+	hm := &hotkeyManager{
+		deej:    deej,
+		logger:  logger,
+		presses: make(chan ActionConfig, hotkeyPressBufferSize),
+	}
+
+	logger.Debug("Created hotkey manager instance")
+
+	return hm
+}
+
+// initialize starts performing actions for pressed hotkeys and watches for config changes
+func (hm *hotkeyManager) initialize() {
+	hm.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case action := <-hm.presses:
+				if err := hm.deej.performAction(action); err != nil {
+					hm.logger.Warnw("Failed to perform hotkey action", "action", action.Action, "error", err)
+				}
+			}
+		}
+	})
+
+	hm.setupOnConfigReload()
+}
+
+// start registers the configured hotkeys, if there are any
+func (hm *hotkeyManager) start() error {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	if hm.listener != nil {
+		return nil
+	}
+
+	bindings := hm.deej.config.Hotkeys
+	if len(bindings) == 0 {
+		hm.logger.Debug("No hotkeys configured, not starting")
+		return nil
+	}
+
+	var hotkeys []hotkey
+	var actions []ActionConfig
+
+	for _, binding := range bindings {
+		parsed, err := parseHotkey(binding.Keys)
+		if err != nil {
+			hm.logger.Warnw("Ignoring invalid hotkey", "keys", binding.Keys, "error", err)
+			continue
+		}
+
+		if err := binding.ActionConfig.validate(); err != nil {
+			hm.logger.Warnw("Ignoring hotkey with invalid action", "keys", binding.Keys, "error", err)
+			continue
+		}
+
+		hotkeys = append(hotkeys, parsed)
+		actions = append(actions, binding.ActionConfig)
+	}
+
+	listener := newHotkeyListener(hm.logger, hm.deej.handlePanic)
+
+	onPress := func(idx int) {
+		hm.logger.Debugw("Hotkey pressed", "keys", hotkeys[idx].text, "action", actions[idx].Action)
+
+		select {
+		case hm.presses <- actions[idx]:
+		default:
+			hm.logger.Debug("Too many pending hotkey presses, dropping this one")
+		}
+	}
+
+	if err := listener.listen(hotkeys, onPress); err != nil {
+		hm.logger.Warnw("Failed to register hotkeys", "error", err)
+		return fmt.Errorf("register hotkeys: %w", err)
+	}
+
+	hm.listener = listener
+	hm.bindings = bindings
+
+	hm.logger.Infow("Hotkeys registered", "count", len(hotkeys))
+
+	return nil
+}
+
+// stop unregisters all hotkeys
+func (hm *hotkeyManager) stop() {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	if hm.listener == nil {
+		return
+	}
+
+	hm.logger.Debug("Unregistering hotkeys")
+	hm.listener.stop()
+	hm.listener = nil
+	hm.bindings = nil
+}
+
+func (hm *hotkeyManager) setupOnConfigReload() {
+	configReloadedChannel := hm.deej.events.configReloaded.subscribe()
+
+	hm.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				hm.lock.Lock()
+				needsRestart := hm.listener != nil && !hotkeyBindingsEqual(hm.bindings, hm.deej.config.Hotkeys)
+				hm.lock.Unlock()
+
+				if needsRestart {
+					hm.logger.Info("Hotkey bindings changed, re-registering")
+					hm.stop()
+				}
+
+				if err := hm.start(); err != nil {
+					hm.logger.Warnw("Failed to register hotkeys after config reload", "error", err)
+				}
+			}
+		}
+	})
+}
+
+// parseHotkey parses key combinations such as "ctrl+alt+f1" or "Shift + Win + Up".
+// Whether the key itself is supported is up to the platform's listener.
+func parseHotkey(text string) (hotkey, error) {
+	parsed := hotkey{text: text}
+
+	parts := strings.Split(strings.ToLower(text), "+")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return hotkey{}, errors.New("empty key")
+		}
+
+		if i < len(parts)-1 {
+			modifier, ok := hotkeyModifierNames[part]
+			if !ok {
+				return hotkey{}, fmt.Errorf("unknown modifier: %s", part)
+			}
+
+			parsed.modifiers |= modifier
+			continue
+		}
+
+		if alias, ok := hotkeyKeyAliases[part]; ok {
+			part = alias
+		}
+
+		parsed.key = part
+	}
+
+	return parsed, nil
+}
+
+func hotkeyBindingsEqual(a []HotkeyConfig, b []HotkeyConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hotkeyKeyCodes builds a platform's key name to key code table. Letters, digits and function keys (F1-F24)
+// have consecutive codes on every platform, so only their first code is needed; other keys are listed in named.
+func hotkeyKeyCodes(letterBase, digitBase, functionBase uint32, named map[string]uint32) map[string]uint32 {
+	codes := make(map[string]uint32, len(named)+26+10+24)
+
+	for i := uint32(0); i < 26; i++ {
+		codes[string(rune('a'+i))] = letterBase + i
+	}
+
+	for i := uint32(0); i < 10; i++ {
+		codes[string(rune('0'+i))] = digitBase + i
+	}
+
+	for i := uint32(0); i < 24; i++ {
+		codes[fmt.Sprintf("f%d", i+1)] = functionBase + i
+	}
+
+	for name, code := range named {
+		codes[name] = code
+	}
+
+	return codes
+}
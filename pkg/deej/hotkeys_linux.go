@@ -0,0 +1,187 @@
+package deej
+
+import (
+	"fmt"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// X11 keysyms for keys that aren't letters, digits or function keys
+var x11Keysyms = hotkeyKeyCodes('a', '0', 0xffbe, map[string]uint32{
+	"up":        0xff52,
+	"down":      0xff54,
+	"left":      0xff51,
+	"right":     0xff53,
+	"space":     0x0020,
+	"enter":     0xff0d,
+	"tab":       0xff09,
+	"escape":    0xff1b,
+	"backspace": 0xff08,
+	"home":      0xff50,
+	"end":       0xff57,
+	"pageup":    0xff55,
+	"pagedown":  0xff56,
+	"insert":    0xff63,
+	"delete":    0xffff,
+})
+
+// modifiers that shouldn't affect whether a hotkey matches: Caps Lock and Num Lock (Mod2 on virtually every setup)
+var x11IgnoredModifiers = []uint16{0, xproto.ModMaskLock, xproto.ModMask2, xproto.ModMaskLock | xproto.ModMask2}
+
+const x11RelevantModifiers = xproto.ModMaskShift | xproto.ModMaskControl | xproto.ModMask1 | xproto.ModMask4
+
+type x11Grab struct {
+	keycode   xproto.Keycode
+	modifiers uint16
+}
+
+// x11HotkeyListener grabs hotkeys on the X11 root window. This also covers most Wayland sessions through XWayland,
+// although compositors may decline to forward keys to X11 clients while a native window is focused.
+type x11HotkeyListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	conn *xgb.Conn
+	done chan struct{}
+}
+
+func newHotkeyListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) hotkeyListener {
+	return &x11HotkeyListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *x11HotkeyListener) listen(hotkeys []hotkey, onPress func(int)) error {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("connect to X server: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	root := setup.DefaultScreen(conn).Root
+
+	keycodes, err := x11Keycodes(conn, setup)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	grabs := make(map[x11Grab]int)
+
+	for idx, hk := range hotkeys {
+		keysym, ok := x11Keysyms[hk.key]
+		if !ok {
+			l.logger.Warnw("Ignoring hotkey with unsupported key", "keys", hk.text, "key", hk.key)
+			continue
+		}
+
+		keycode, ok := keycodes[xproto.Keysym(keysym)]
+		if !ok {
+			l.logger.Warnw("Ignoring hotkey whose key isn't on the current keyboard layout", "keys", hk.text)
+			continue
+		}
+
+		grab := x11Grab{keycode: keycode, modifiers: x11Modifiers(hk.modifiers)}
+
+		for _, ignored := range x11IgnoredModifiers {
+			err = xproto.GrabKeyChecked(conn, true, root, grab.modifiers|ignored, keycode,
+				xproto.GrabModeAsync, xproto.GrabModeAsync).Check()
+			if err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			l.logger.Warnw("Failed to grab hotkey (is it used by another app?)", "keys", hk.text, "error", err)
+			continue
+		}
+
+		grabs[grab] = idx
+	}
+
+	l.conn = conn
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+
+		for {
+			event, err := conn.WaitForEvent()
+			if event == nil && err == nil {
+				// connection closed
+				return
+			}
+
+			if err != nil {
+				l.logger.Debugw("X11 error while waiting for hotkeys", "error", err)
+				continue
+			}
+
+			keyPress, ok := event.(xproto.KeyPressEvent)
+			if !ok {
+				continue
+			}
+
+			grab := x11Grab{keycode: keyPress.Detail, modifiers: keyPress.State & x11RelevantModifiers}
+			if idx, ok := grabs[grab]; ok {
+				onPress(idx)
+			}
+		}
+	})
+
+	return nil
+}
+
+// stop closes the X connection, which releases all of its grabs
+func (l *x11HotkeyListener) stop() {
+	l.conn.Close()
+	<-l.done
+}
+
+// x11Keycodes maps each keysym on the current keyboard layout to the first keycode that produces it
+func x11Keycodes(conn *xgb.Conn, setup *xproto.SetupInfo) (map[xproto.Keysym]xproto.Keycode, error) {
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, count).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("get keyboard mapping: %w", err)
+	}
+
+	keycodes := make(map[xproto.Keysym]xproto.Keycode)
+	perKeycode := int(mapping.KeysymsPerKeycode)
+
+	for i := 0; i < int(count); i++ {
+		for j := 0; j < perKeycode; j++ {
+			keysym := mapping.Keysyms[i*perKeycode+j]
+			if _, ok := keycodes[keysym]; !ok && keysym != 0 {
+				keycodes[keysym] = setup.MinKeycode + xproto.Keycode(i)
+			}
+		}
+	}
+
+	return keycodes, nil
+}
+
+func x11Modifiers(modifiers hotkeyModifiers) uint16 {
+	var result uint16
+
+	if modifiers&hotkeyModCtrl != 0 {
+		result |= xproto.ModMaskControl
+	}
+
+	if modifiers&hotkeyModAlt != 0 {
+		result |= xproto.ModMask1
+	}
+
+	if modifiers&hotkeyModShift != 0 {
+		result |= xproto.ModMaskShift
+	}
+
+	if modifiers&hotkeyModSuper != 0 {
+		result |= xproto.ModMask4
+	}
+
+	return result
+}
@@ -0,0 +1,138 @@
+package deej
+
+import (
+	"runtime"
+	"syscall"
+
+	"github.com/lxn/win"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// RegisterHotKey modifier flags
+const (
+	winModAlt      = 0x0001
+	winModControl  = 0x0002
+	winModShift    = 0x0004
+	winModWin      = 0x0008
+	winModNoRepeat = 0x4000
+)
+
+var (
+	user32               = syscall.NewLazyDLL("user32.dll")
+	procRegisterHotKey   = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey = user32.NewProc("UnregisterHotKey")
+	procPostThreadMsg    = user32.NewProc("PostThreadMessageW")
+)
+
+var windowsVirtualKeys = hotkeyKeyCodes('A', '0', win.VK_F1, map[string]uint32{
+	"up":        win.VK_UP,
+	"down":      win.VK_DOWN,
+	"left":      win.VK_LEFT,
+	"right":     win.VK_RIGHT,
+	"space":     win.VK_SPACE,
+	"enter":     win.VK_RETURN,
+	"tab":       win.VK_TAB,
+	"escape":    win.VK_ESCAPE,
+	"backspace": win.VK_BACK,
+	"home":      win.VK_HOME,
+	"end":       win.VK_END,
+	"pageup":    win.VK_PRIOR,
+	"pagedown":  win.VK_NEXT,
+	"insert":    win.VK_INSERT,
+	"delete":    win.VK_DELETE,
+})
+
+// windowsHotkeyListener registers hotkeys with RegisterHotKey. Hotkey messages are delivered to the thread that
+// registered them, so registration and the message loop share a dedicated, locked OS thread.
+type windowsHotkeyListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	threadID uint32
+	done     chan struct{}
+}
+
+func newHotkeyListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) hotkeyListener {
+	return &windowsHotkeyListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *windowsHotkeyListener) listen(hotkeys []hotkey, onPress func(int)) error {
+	ready := make(chan struct{})
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(l.done)
+
+		l.threadID = win.GetCurrentThreadId()
+
+		// hotkey IDs are the binding's index + 1, since 0 isn't a valid ID
+		var registered []uintptr
+		for idx, hk := range hotkeys {
+			vk, ok := windowsVirtualKeys[hk.key]
+			if !ok {
+				l.logger.Warnw("Ignoring hotkey with unsupported key", "keys", hk.text, "key", hk.key)
+				continue
+			}
+
+			id := uintptr(idx + 1)
+			if result, _, err := procRegisterHotKey.Call(0, id, windowsModifiers(hk.modifiers), uintptr(vk)); result == 0 {
+				l.logger.Warnw("Failed to register hotkey (is it used by another app?)", "keys", hk.text, "error", err)
+				continue
+			}
+
+			registered = append(registered, id)
+		}
+
+		close(ready)
+
+		var msg win.MSG
+		for win.GetMessage(&msg, 0, 0, 0) > 0 {
+			if msg.Message == win.WM_HOTKEY {
+				onPress(int(msg.WParam) - 1)
+			}
+		}
+
+		for _, id := range registered {
+			procUnregisterHotKey.Call(0, id)
+		}
+	})
+
+	<-ready
+
+	return nil
+}
+
+func (l *windowsHotkeyListener) stop() {
+	if result, _, err := procPostThreadMsg.Call(uintptr(l.threadID), win.WM_QUIT, 0, 0); result == 0 {
+		l.logger.Warnw("Failed to stop hotkey message loop", "error", err)
+		return
+	}
+
+	<-l.done
+}
+
+func windowsModifiers(modifiers hotkeyModifiers) uintptr {
+	result := uintptr(winModNoRepeat)
+
+	if modifiers&hotkeyModCtrl != 0 {
+		result |= winModControl
+	}
+
+	if modifiers&hotkeyModAlt != 0 {
+		result |= winModAlt
+	}
+
+	if modifiers&hotkeyModShift != 0 {
+		result |= winModShift
+	}
+
+	if modifiers&hotkeyModSuper != 0 {
+		result |= winModWin
+	}
+
+	return result
+}
@@ -0,0 +1,118 @@
+package deej
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// how long to give a newly plugged in serial port to become usable before opening it
+const hotplugSettleDelay = 500 * time.Millisecond
+
+// hotplugListener receives serial device arrival notifications from the OS
+type hotplugListener interface {
+	// listen calls onArrival whenever a serial port appears, until stop is called.
+	// onArrival may be called from any goroutine.
+	listen(onArrival func()) error
+	stop()
+}
+
+// hotplugWatcher connects to boards as soon as they're plugged in, rather than waiting for the next
+// config reload or wake from sleep to try again
+type hotplugWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	arrivals chan struct{}
+	listener hotplugListener
+
+	// whether boards that aren't plugged in yet will be connected once they are
+	listening atomic.Bool
+
+	// the OS's listener, replaced in tests
+	newListener func(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) hotplugListener
+}
+
+func newHotplugWatcher(deej *Deej, logger *zap.SugaredLogger) *hotplugWatcher {
+	logger = logger.Named("hotplug")
+
+	hw := &hotplugWatcher{
+		deej:        deej,
+		logger:      logger,
+		arrivals:    make(chan struct{}, 1),
+		newListener: newHotplugListener,
+	}
+
+	logger.Debug("Created hotplug watcher instance")
+
+	return hw
+}
+
+// start listens for serial ports appearing, if the OS announces them
+func (hw *hotplugWatcher) start() {
+	listener := hw.newListener(hw.logger, hw.deej.handlePanic)
+
+	onArrival := func() {
+		// several ports appearing at once (e.g. a board with a composite USB device) only need one attempt
+		select {
+		case hw.arrivals <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := listener.listen(onArrival); err != nil {
+		hw.logger.Warnw("Failed to listen for plugged in devices, replugged boards won't reconnect on their own", "error", err)
+		return
+	}
+
+	hw.listener = listener
+	hw.listening.Store(true)
+	hw.logger.Debug("Listening for plugged in devices")
+
+	hw.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hw.arrivals:
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(hotplugSettleDelay):
+			}
+
+			hw.handleArrival()
+		}
+	})
+}
+
+func (hw *hotplugWatcher) stop() {
+	if hw.listener == nil {
+		return
+	}
+
+	hw.listening.Store(false)
+	hw.listener.stop()
+	hw.listener = nil
+}
+
+// handleArrival connects the boards that aren't connected, one of which may have just been plugged in
+func (hw *hotplugWatcher) handleArrival() {
+	if !hw.deej.serial.missingDevices() {
+		return
+	}
+
+	hw.logger.Debug("Serial port appeared, connecting to disconnected boards")
+
+	// the new port may well belong to something other than a board
+	if err := hw.deej.serial.Start(); err != nil {
+		hw.logger.Debugw("Failed to connect after a serial port appeared", "error", err)
+		return
+	}
+
+	hw.logger.Info("Connected to board after it was plugged in")
+}
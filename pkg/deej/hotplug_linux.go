@@ -0,0 +1,100 @@
+package deej
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// the kernel's uevent multicast group, which udev itself listens on
+const ueventKernelGroup = 1
+
+// ueventHotplugListener follows the kernel's uevents for tty devices being added. Reads time out every so
+// often, since closing the socket doesn't interrupt a pending read
+type ueventHotplugListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	fd      int
+	stopped atomic.Bool
+	done    chan struct{}
+}
+
+func newHotplugListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) hotplugListener {
+	return &ueventHotplugListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *ueventHotplugListener) listen(onArrival func()) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("create uevent socket: %w", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: ueventKernelGroup}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("bind uevent socket: %w", err)
+	}
+
+	timeout := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("set uevent socket timeout: %w", err)
+	}
+
+	l.fd = fd
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+		defer unix.Close(fd)
+
+		buf := make([]byte, 8192)
+
+		for !l.stopped.Load() {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+
+			if err != nil {
+				l.logger.Warnw("Failed to read uevent, no longer listening for plugged in devices", "error", err)
+				return
+			}
+
+			if ttyAdded(buf[:n]) {
+				onArrival()
+			}
+		}
+	})
+
+	return nil
+}
+
+func (l *ueventHotplugListener) stop() {
+	l.stopped.Store(true)
+	<-l.done
+}
+
+// ttyAdded returns whether a uevent, made of null-terminated "KEY=value" fields after its "action@devpath"
+// header, announces a new tty device
+func ttyAdded(event []byte) bool {
+	fields := bytes.Split(event, []byte{0})
+
+	var add, tty bool
+	for _, field := range fields {
+		switch string(field) {
+		case "ACTION=add":
+			add = true
+		case "SUBSYSTEM=tty":
+			tty = true
+		}
+	}
+
+	return add && tty
+}
@@ -0,0 +1,83 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jacobsa/go-serial/serial"
+	"go.uber.org/zap"
+)
+
+// fakeHotplugListener hands the test the arrival callback, so it can plug boards in at will
+type fakeHotplugListener struct {
+	onArrival func()
+}
+
+func (l *fakeHotplugListener) listen(onArrival func()) error {
+	l.onArrival = onArrival
+	return nil
+}
+
+func (l *fakeHotplugListener) stop() {}
+
+func TestHotplugConnectsBoardMissingAtStartup(t *testing.T) {
+	config := newTestConfig(nil)
+	config.Devices = []DeviceInfo{{ConnectionInfo: ConnectionInfo{COMPort: "COM7"}}}
+
+	var portLock sync.Mutex
+	var port *scriptedPort
+
+	sio := newTestSerialIO(t, config, nil)
+	sio.openPort = func(options serial.OpenOptions) (io.ReadWriteCloser, error) {
+		portLock.Lock()
+		defer portLock.Unlock()
+
+		if port == nil {
+			return nil, fmt.Errorf("open %s: %w", options.PortName, os.ErrNotExist)
+		}
+
+		return port, nil
+	}
+
+	notifier := &fakeNotifier{}
+	d := &Deej{
+		logger:   zap.NewNop().Sugar(),
+		notifier: newNotifierGroup(notifier),
+		config:   config,
+		serial:   sio,
+		routines: sio.routines,
+	}
+
+	listener := &fakeHotplugListener{}
+	d.hotplug = newHotplugWatcher(d, d.logger)
+	d.hotplug.newListener = func(*zap.SugaredLogger, func(interface{})) hotplugListener { return listener }
+	d.hotplug.start()
+	defer d.hotplug.stop()
+
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	d.startSerial()
+
+	if d.routines.ctx.Err() != nil {
+		t.Fatal("deej stopped without its board, want it to wait for the board")
+	}
+
+	if !notifier.notified(tr("notify.serialWaiting")) {
+		t.Error("no notification about waiting for the board")
+	}
+
+	portLock.Lock()
+	port = newScriptedPort("512")
+	portLock.Unlock()
+
+	listener.onArrival()
+
+	if got, want := receive(t, sliderEvents), (SliderMoveEvent{0, 0.5}); got != want {
+		t.Errorf("slider event = %v, want %v", got, want)
+	}
+
+	sio.Stop()
+}
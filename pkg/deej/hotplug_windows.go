@@ -0,0 +1,128 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// values from cfgmgr32.h
+const (
+	cmNotifyFilterTypeDeviceInterface = 0
+	cmNotifyActionInterfaceArrival    = 0
+	crSuccess                         = 0
+)
+
+var (
+	cfgmgr32                     = syscall.NewLazyDLL("cfgmgr32.dll")
+	procCMRegisterNotification   = cfgmgr32.NewProc("CM_Register_Notification")
+	procCMUnregisterNotification = cfgmgr32.NewProc("CM_Unregister_Notification")
+
+	// GUID_DEVINTERFACE_COMPORT, which serial port drivers (USB CDC, FTDI, CH340 and so on) register their ports under
+	guidDevinterfaceComport = windows.GUID{
+		Data1: 0x86e0d1e0,
+		Data2: 0x8089,
+		Data3: 0x11d0,
+		Data4: [8]byte{0x9c, 0xe4, 0x08, 0x00, 0x3e, 0x30, 0x1f, 0x73},
+	}
+
+	// Windows never frees callbacks, so every listener shares this one and finds its handler through hotplugHandlers
+	hotplugCallback = syscall.NewCallback(hotplugNotificationCallback)
+
+	hotplugHandlersLock sync.Mutex
+	hotplugHandlers     = make(map[uintptr]func())
+	nextHotplugHandler  uintptr
+)
+
+// cmNotifyFilter mirrors CM_NOTIFY_FILTER for device interface notifications. Its union is sized for the
+// largest member, a MAX_DEVICE_ID_LEN (200) character instance ID
+type cmNotifyFilter struct {
+	size       uint32
+	flags      uint32
+	filterType uint32
+	reserved   uint32
+	classGUID  windows.GUID
+	_          [400 - unsafe.Sizeof(windows.GUID{})]byte
+}
+
+// cmHotplugListener receives the same COM port arrivals as WM_DEVICECHANGE, without needing a window
+type cmHotplugListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	id           uintptr
+	registration uintptr
+}
+
+func newHotplugListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) hotplugListener {
+	return &cmHotplugListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *cmHotplugListener) listen(onArrival func()) error {
+	hotplugHandlersLock.Lock()
+	nextHotplugHandler++
+	l.id = nextHotplugHandler
+	hotplugHandlers[l.id] = func() {
+		defer util.Recover(l.onPanic)
+		onArrival()
+	}
+	hotplugHandlersLock.Unlock()
+
+	filter := cmNotifyFilter{
+		filterType: cmNotifyFilterTypeDeviceInterface,
+		classGUID:  guidDevinterfaceComport,
+	}
+	filter.size = uint32(unsafe.Sizeof(filter))
+
+	result, _, _ := procCMRegisterNotification.Call(
+		uintptr(unsafe.Pointer(&filter)),
+		l.id,
+		hotplugCallback,
+		uintptr(unsafe.Pointer(&l.registration)),
+	)
+
+	if result != crSuccess {
+		l.forget()
+		return fmt.Errorf("register for device notifications: CONFIGRET %#x", result)
+	}
+
+	return nil
+}
+
+func (l *cmHotplugListener) stop() {
+	// waits for callbacks that are already running to return
+	if result, _, _ := procCMUnregisterNotification.Call(l.registration); result != crSuccess {
+		l.logger.Debugw("Failed to unregister from device notifications", "result", result)
+	}
+
+	l.forget()
+}
+
+func (l *cmHotplugListener) forget() {
+	hotplugHandlersLock.Lock()
+	delete(hotplugHandlers, l.id)
+	hotplugHandlersLock.Unlock()
+}
+
+// hotplugNotificationCallback implements PCM_NOTIFY_CALLBACK
+func hotplugNotificationCallback(notification uintptr, context uintptr, action uintptr, eventData uintptr, eventDataSize uintptr) uintptr {
+	if action != cmNotifyActionInterfaceArrival {
+		return 0
+	}
+
+	hotplugHandlersLock.Lock()
+	onArrival := hotplugHandlers[context]
+	hotplugHandlersLock.Unlock()
+
+	if onArrival != nil {
+		onArrival()
+	}
+
+	return 0
+}
@@ -0,0 +1,482 @@
+package deej
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	httpShutdownTimeout = 2 * time.Second
+
+	// session icons are served as PNG by session key, e.g. /icons/spotify.exe
+	sessionIconPath   = "/icons/"
+	sessionIconMaxAge = time.Hour
+
+	// what the API is advertised as over mDNS
+	httpServiceType = "_deej._tcp"
+)
+
+// httpTXTEntry is a key of the TXT record the API is advertised with, whose value is looked up when advertising
+type httpTXTEntry struct {
+	key   string
+	value func() string
+}
+
+// httpServer hosts the HTTP and WebSocket endpoints of integrations such as the Stream Deck plugin.
+// Integrations register their handlers before the server starts; the server itself only manages the listener.
+type httpServer struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	mux             *http.ServeMux
+	ownAuthPatterns map[string]bool
+	shutdownHooks   []func()
+	txtEntries      []httpTXTEntry
+
+	lock       sync.Mutex
+	server     *http.Server
+	address    string
+	tls        TLSInfo
+	port       int // the one actually listened on
+	responder  *mdnsResponder
+	advertised mdnsService
+}
+
+func newHTTPServer(deej *Deej, logger *zap.SugaredLogger) *httpServer {
+	logger = logger.Named("http")
+
+	hs := &httpServer{
+		deej:            deej,
+		logger:          logger,
+		mux:             http.NewServeMux(),
+		ownAuthPatterns: make(map[string]bool),
+	}
+
+	logger.Debug("Created HTTP server instance")
+
+	return hs
+}
+
+// initialize registers the endpoints every integration shares, and watches for config changes
+func (hs *httpServer) initialize() {
+	hs.handle("GET "+sessionIconPath+"{key}", http.HandlerFunc(hs.serveSessionIcon))
+
+	hs.setupOnConfigReload()
+}
+
+// handle registers a handler for the given pattern, see http.ServeMux for pattern syntax
+func (hs *httpServer) handle(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+}
+
+// handleOwnAuth registers a handler that checks credentials of its own, so http_api.token isn't required for it
+func (hs *httpServer) handleOwnAuth(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+	hs.ownAuthPatterns[pattern] = true
+}
+
+// onShutdown registers a function to call whenever the server stops, for handlers that hijack connections
+func (hs *httpServer) onShutdown(f func()) {
+	hs.shutdownHooks = append(hs.shutdownHooks, f)
+}
+
+// describe adds an entry to the TXT record the API is advertised with, so clients can tell which integrations are
+// available before connecting. Entries whose value is empty are left out.
+func (hs *httpServer) describe(key string, value func() string) {
+	hs.txtEntries = append(hs.txtEntries, httpTXTEntry{key: key, value: value})
+}
+
+// start begins serving if the HTTP API is enabled in the config, or brings the advertisement up to date if the
+// server is already running
+func (hs *httpServer) start() error {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	info := hs.deej.config.HTTPInfo
+	if !info.Enabled {
+		hs.logger.Debug("HTTP API disabled in config, not starting")
+		return nil
+	}
+
+	if hs.server != nil {
+		hs.advertise()
+		return nil
+	}
+
+	if !info.AllowRemote {
+		if err := ensureLoopbackAddress(info.Address); err != nil {
+			hs.logger.Warnw("Invalid HTTP API address", "address", info.Address, "error", err)
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", info.Address)
+	if err != nil {
+		hs.logger.Warnw("Failed to listen for HTTP API", "address", info.Address, "error", err)
+		return fmt.Errorf("listen on %s: %w", info.Address, err)
+	}
+
+	if info.TLS.Enabled {
+		cert, fingerprint, err := loadAPICertificate(info.TLS)
+		if err != nil {
+			listener.Close()
+			hs.logger.Warnw("Failed to load HTTP API certificate", "error", err)
+			return fmt.Errorf("load certificate: %w", err)
+		}
+
+		listener = tls.NewListener(listener, apiTLSConfig(cert))
+		hs.logger.Infow("HTTP API serving over TLS", "fingerprint", fingerprint)
+	}
+
+	if info.AllowRemote && info.Token == "" {
+		hs.logger.Warn("HTTP API allows remote clients without a token, anyone on the network can control deej")
+	}
+
+	hs.server = &http.Server{Handler: hs.authenticate(hs.mux)}
+	hs.address = info.Address
+	hs.tls = info.TLS
+	hs.port = listener.Addr().(*net.TCPAddr).Port
+
+	for _, f := range hs.shutdownHooks {
+		hs.server.RegisterOnShutdown(f)
+	}
+
+	server := hs.server
+	util.Go(hs.deej.handlePanic, func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			hs.logger.Warnw("HTTP server stopped with error", "error", err)
+		}
+	})
+
+	hs.logger.Infow("HTTP API listening", "address", listener.Addr().String())
+
+	hs.advertise()
+
+	return nil
+}
+
+// stop shuts the server down, including any hijacked connections whose handlers registered with onShutdown
+func (hs *httpServer) stop() {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	if hs.server == nil {
+		return
+	}
+
+	hs.logger.Debug("Stopping HTTP API")
+
+	hs.stopAdvertising()
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+
+	if err := hs.server.Shutdown(ctx); err != nil {
+		hs.logger.Warnw("Failed to shut down HTTP API gracefully", "error", err)
+		hs.server.Close()
+	}
+
+	hs.server = nil
+	hs.address = ""
+	hs.tls = TLSInfo{}
+	hs.port = 0
+}
+
+// authenticate requires http_api.token from clients on other machines, except on endpoints that check credentials
+// of their own. Browsers on this computer only go without it for pages of its own, since a website that points
+// its domain at 127.0.0.1 sends requests from loopback too.
+func (hs *httpServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := hs.deej.config.HTTPInfo.Token
+
+		if token == "" || (requestFromLoopback(r) && checkLocalHost(r) && checkLocalOrigin(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, pattern := hs.mux.Handler(r); hs.ownAuthPatterns[pattern] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if validAPIToken(bearerToken(r.Header.Get("Authorization")), token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cookie, err := r.Cookie(apiTokenCookie); err == nil && validAPIToken(cookie.Value, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// browsers can't send headers when opening a page or a WebSocket, so the token may come in the URL once,
+		// after which a cookie carries it
+		if validAPIToken(r.URL.Query().Get("token"), token) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     apiTokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "a token is required, see http_api.token in deej's config", http.StatusUnauthorized)
+	})
+}
+
+// advertise starts, updates or stops announcing the API over mDNS to match the config. Assumes the lock is held.
+func (hs *httpServer) advertise() {
+	info := hs.deej.config.HTTPInfo
+
+	if !info.Advertise || hs.server == nil {
+		hs.stopAdvertising()
+		return
+	}
+
+	if !info.AllowRemote {
+		hs.logger.Warn("Not advertising the HTTP API, since it can only be reached from this computer without allow_remote")
+		hs.stopAdvertising()
+		return
+	}
+
+	service, err := hs.mdnsService()
+	if err != nil {
+		hs.logger.Warnw("Not advertising the HTTP API", "address", hs.address, "error", err)
+		hs.stopAdvertising()
+		return
+	}
+
+	if hs.responder != nil {
+		if hs.advertised.equal(service) {
+			return
+		}
+
+		hs.logger.Debug("Advertised details changed, restarting mDNS responder")
+		hs.stopAdvertising()
+	}
+
+	responder, err := startMDNSResponder(service, hs.logger, hs.deej.handlePanic)
+	if err != nil {
+		hs.logger.Warnw("Failed to advertise HTTP API over mDNS", "error", err)
+		return
+	}
+
+	hs.responder = responder
+	hs.advertised = service
+}
+
+// stopAdvertising assumes the lock is held
+func (hs *httpServer) stopAdvertising() {
+	if hs.responder == nil {
+		return
+	}
+
+	hs.responder.stop()
+	hs.responder = nil
+	hs.advertised = mdnsService{}
+}
+
+// mdnsService describes the running API for the mDNS responder. Assumes the lock is held.
+func (hs *httpServer) mdnsService() (mdnsService, error) {
+	host, _, err := net.SplitHostPort(hs.address)
+	if err != nil {
+		return mdnsService{}, err
+	}
+
+	// when the API only listens on one address, that's the one to advertise
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		if ip.IsLoopback() {
+			return mdnsService{}, errors.New("only listening on loopback")
+		}
+
+		ips = []net.IP{ip}
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil || hostName == "" {
+		hostName = "deej"
+	}
+
+	version := hs.deej.version
+	if version == "" {
+		version = "dev"
+	}
+
+	txt := []string{"version=" + version}
+	if hs.tls.Enabled {
+		txt = append(txt, "tls=1")
+	}
+
+	for _, entry := range hs.txtEntries {
+		if value := entry.value(); value != "" {
+			txt = append(txt, entry.key+"="+value)
+		}
+	}
+
+	// a host name of its own keeps deej's records from clashing with the ones the OS publishes for the machine
+	return newMDNSService(hs.instanceName(), httpServiceType, hostName+"-deej", uint16(hs.port), txt, ips), nil
+}
+
+// instanceName returns what the API is advertised as, which companion apps also list this computer as
+func (hs *httpServer) instanceName() string {
+	if name := hs.deej.config.HTTPInfo.Name; name != "" {
+		return name
+	}
+
+	if hostName, err := os.Hostname(); err == nil && hostName != "" {
+		return hostName
+	}
+
+	return "deej"
+}
+
+// serveSessionIcon serves the icon of a session, so integrations can show the apps they control
+func (hs *httpServer) serveSessionIcon(w http.ResponseWriter, r *http.Request) {
+	icon, ok := hs.deej.SessionIcon(r.PathValue("key"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(sessionIconMaxAge.Seconds())))
+
+	if _, err := w.Write(icon); err != nil {
+		hs.logger.Debugw("Failed to write session icon", "error", err)
+	}
+}
+
+// sessionIconURL returns the path a session's icon is served at, or "" if it has none
+func sessionIconURL(session Session) string {
+	if _, err := sessionIcon(session); err != nil {
+		return ""
+	}
+
+	return sessionIconPath + url.PathEscape(session.Key())
+}
+
+func (hs *httpServer) setupOnConfigReload() {
+	configReloadedChannel := hs.deej.events.configReloaded.subscribe()
+
+	hs.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				info := hs.deej.config.HTTPInfo
+
+				hs.lock.Lock()
+				running := hs.server != nil
+				needsRestart := running && (!info.Enabled || info.Address != hs.address || info.TLS != hs.tls)
+				hs.lock.Unlock()
+
+				if needsRestart {
+					hs.logger.Info("HTTP API settings changed, restarting")
+					hs.stop()
+				}
+
+				if err := hs.start(); err != nil {
+					hs.logger.Warnw("Failed to start HTTP API after config reload", "error", err)
+				}
+			}
+		}
+	})
+}
+
+// requestFromLoopback returns whether a request came from this computer, for endpoints that shouldn't be reachable
+// from the network even when the API is
+func requestFromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && net.ParseIP(host).IsLoopback()
+}
+
+// checkLocalOrigin accepts requests from non-browser clients (no Origin header, or the "null"/file origins used
+// by desktop plugin hosts) and from pages served under one of this computer's own names, see localHostName.
+// This keeps arbitrary websites the user visits from reaching the API through their browser, even ones that
+// point their own domain at this computer.
+func checkLocalOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if parsed.Scheme == "file" {
+		return true
+	}
+
+	return localHostName(parsed.Hostname())
+}
+
+// checkLocalHost returns whether a request was addressed to this computer under one of its own names, rather than
+// to a domain that merely resolves to it, see localHostName
+func checkLocalHost(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = strings.Trim(r.Host, "[]")
+	}
+
+	return localHostName(host)
+}
+
+// localHostName returns whether a host name or address names this computer: localhost, a loopback address,
+// the machine's host name (also under .local, and the one deej advertises over mDNS) or one of its interfaces'
+// addresses. Unlike any other domain, a website can't point these at this computer through DNS rebinding.
+func localHostName(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return true
+		}
+
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return false
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	hostName, err := os.Hostname()
+	if err != nil || hostName == "" {
+		return false
+	}
+
+	host = strings.TrimSuffix(strings.TrimSuffix(host, "."), ".local")
+
+	return strings.EqualFold(host, hostName) || strings.EqualFold(host, hostName+"-deej")
+}
@@ -0,0 +1,185 @@
+package deej
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// the language every other one falls back to, and the one the catalogs' messages are taken from
+	fallbackLanguage = "en"
+
+	// picks the language from the OS's preferences
+	autoLanguage = "auto"
+
+	localesDir = "assets/locales"
+)
+
+//go:embed assets/locales
+var localeFiles embed.FS
+
+var (
+	catalogLock sync.Mutex
+
+	// the messages of the language in use and of the fallback language, by ID. nil until first used
+	activeMessages   map[string]string
+	fallbackMessages map[string]string
+	activeLanguage   string
+)
+
+// tr returns the message with the given ID in the language in use, with its {placeholders} filled in from
+// name and value pairs, e.g. tr("notify.bound", "app", key). Messages missing from the language fall back to
+// English, and ones missing from English to their ID, so a typo shows up instead of an empty notification.
+func tr(id string, args ...interface{}) string {
+	catalogLock.Lock()
+	if activeMessages == nil {
+		selectLanguageLocked(autoLanguage)
+	}
+
+	message, ok := activeMessages[id]
+	if !ok {
+		message, ok = fallbackMessages[id]
+	}
+	catalogLock.Unlock()
+
+	if !ok {
+		message = id
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	replacements := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		replacements = append(replacements, fmt.Sprintf("{%v}", args[i]), fmt.Sprint(args[i+1]))
+	}
+
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// selectLanguage switches the messages tr returns to a language, given as a code like "de" or "pt-BR", or "auto"
+// to follow the OS. It returns the language actually used, which is English when there's no catalog for the
+// language or its base language ("pt" for "pt-BR").
+func selectLanguage(language string) string {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+
+	return selectLanguageLocked(language)
+}
+
+func selectLanguageLocked(language string) string {
+	if fallbackMessages == nil {
+		fallbackMessages, _ = loadCatalog(fallbackLanguage)
+	}
+
+	candidates := []string{language}
+	if language == "" || strings.EqualFold(language, autoLanguage) {
+		candidates = osLanguages()
+	}
+
+	activeLanguage = fallbackLanguage
+	activeMessages = fallbackMessages
+
+	for _, candidate := range candidates {
+		if found, ok := matchLanguage(candidate); ok {
+			messages, err := loadCatalog(found)
+			if err != nil {
+				continue
+			}
+
+			activeLanguage = found
+			activeMessages = messages
+			break
+		}
+	}
+
+	return activeLanguage
+}
+
+// availableLanguages returns the codes of the languages deej has a catalog for
+func availableLanguages() []string {
+	entries, err := localeFiles.ReadDir(localesDir)
+	if err != nil {
+		return []string{fallbackLanguage}
+	}
+
+	var languages []string
+	for _, entry := range entries {
+		if language, ok := strings.CutSuffix(entry.Name(), ".yaml"); ok {
+			languages = append(languages, language)
+		}
+	}
+
+	sort.Strings(languages)
+
+	return languages
+}
+
+// matchLanguage finds the catalog for a language code, ignoring case and whether it's written with a dash or an
+// underscore ("pt_BR" as in POSIX locales), and falling back to the base language
+func matchLanguage(language string) (string, bool) {
+	language = strings.ReplaceAll(strings.TrimSpace(language), "_", "-")
+
+	// POSIX locales may carry an encoding or modifier, as in "de_DE.UTF-8" or "ca_ES@valencia"
+	if idx := strings.IndexAny(language, ".@"); idx != -1 {
+		language = language[:idx]
+	}
+
+	if language == "" {
+		return "", false
+	}
+
+	base, _, _ := strings.Cut(language, "-")
+
+	available := availableLanguages()
+	for _, wanted := range []string{language, base} {
+		for _, candidate := range available {
+			if strings.EqualFold(candidate, wanted) {
+				return candidate, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// loadCatalog reads a language's messages, flattening nested sections into dotted IDs ("tray.quit")
+func loadCatalog(language string) (map[string]string, error) {
+	data, err := localeFiles.ReadFile(path.Join(localesDir, language+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("read catalog: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse catalog: %w", err)
+	}
+
+	messages := make(map[string]string)
+	flattenCatalog("", raw, messages)
+
+	return messages, nil
+}
+
+func flattenCatalog(prefix string, section map[string]interface{}, messages map[string]string) {
+	for key, value := range section {
+		id := key
+		if prefix != "" {
+			id = prefix + "." + key
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flattenCatalog(id, value, messages)
+		case string:
+			messages[id] = value
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package deej
+
+import (
+	"os"
+	"strings"
+)
+
+// osLanguages returns the user's languages from the locale environment variables, most preferred first.
+// LANGUAGE may list several, but like gettext, it's only followed when the locale isn't "C"
+func osLanguages() []string {
+	locale := ""
+	for _, variable := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale = os.Getenv(variable); locale != "" {
+			break
+		}
+	}
+
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+
+	var languages []string
+	if preferred := os.Getenv("LANGUAGE"); preferred != "" {
+		languages = strings.Split(preferred, ":")
+	}
+
+	return append(languages, locale)
+}
@@ -0,0 +1,50 @@
+package deej
+
+import "testing"
+
+func TestMatchLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+		wantOK   bool
+	}{
+		{"de", "de", true},
+		{"DE", "de", true},
+		{"de-AT", "de", true},
+		{"de_DE.UTF-8", "de", true},
+		{"en-US", "en", true},
+		{"xx", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.language, func(t *testing.T) {
+			got, ok := matchLanguage(test.language)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("matchLanguage(%q) = %q, %v, want %q, %v", test.language, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	t.Cleanup(func() { selectLanguage(fallbackLanguage) })
+
+	if got := selectLanguage("xx"); got != fallbackLanguage {
+		t.Errorf("unknown language selected %q, want %q", got, fallbackLanguage)
+	}
+
+	if got, want := tr("notify.bound", "app", "spotify.exe"), "Bound spotify.exe"; got != want {
+		t.Errorf("tr = %q, want %q", got, want)
+	}
+
+	selectLanguage("de")
+
+	if got, want := tr("notify.bound", "app", "spotify.exe"), "spotify.exe zugeordnet"; got != want {
+		t.Errorf("tr = %q, want %q", got, want)
+	}
+
+	if got, want := tr("notify.noSuchMessage"), "notify.noSuchMessage"; got != want {
+		t.Errorf("tr of a missing message = %q, want %q", got, want)
+	}
+}
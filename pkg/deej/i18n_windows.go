@@ -0,0 +1,13 @@
+package deej
+
+import "golang.org/x/sys/windows"
+
+// osLanguages returns the user's display languages, most preferred first
+func osLanguages() []string {
+	languages, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil {
+		return nil
+	}
+
+	return languages
+}
@@ -0,0 +1,146 @@
+package deej
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// sent to the board once no audio has played for the configured time, and on the next sign of activity
+	idleSleepLine = "sleep"
+	idleWakeLine  = "wake"
+
+	// peaks at or below this count as silence, so near-inaudible noise doesn't keep the board awake
+	idlePeakThreshold = 0.01
+
+	// how often to check whether it's been quiet for long enough
+	idleCheckInterval = 5 * time.Second
+)
+
+// idleMonitor puts the board to sleep when no audio has played for a while, e.g. to dim its LEDs or display,
+// and wakes it on the next sound, slider move or button press
+type idleMonitor struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lastActive time.Time
+	asleep     bool
+}
+
+func newIdleMonitor(deej *Deej, logger *zap.SugaredLogger) *idleMonitor {
+	logger = logger.Named("idle")
+
+	im := &idleMonitor{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created idle monitor instance")
+
+	return im
+}
+
+// start begins watching for silence whenever it's enabled. Config changes are picked up as they happen.
+// Once deej shuts down, a sleeping board is woken up.
+func (im *idleMonitor) start() {
+	configReloadedChannel := im.deej.events.configReloaded.subscribe()
+	sliderEventsChannel := im.deej.events.sliderMoved.subscribe()
+	buttonEventsChannel := im.deej.events.buttonPressed.subscribe()
+	connectionChannel := im.deej.events.connectionChanged.subscribe()
+
+	im.lastActive = time.Now()
+
+	im.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+
+		// only subscribed while enabled, so sessions aren't metered for nothing.
+		// receiving from a nil channel blocks forever, leaving that case out of the select
+		var peakLevelsChannel chan PeakLevels
+
+		for {
+			enabled := im.deej.config.Idle.Enabled
+
+			if enabled && peakLevelsChannel == nil {
+				peakLevelsChannel = im.deej.meter.subscribeToPeakLevels()
+				im.lastActive = time.Now()
+			} else if !enabled && peakLevelsChannel != nil {
+				im.deej.meter.unsubscribeFromPeakLevels(peakLevelsChannel)
+				peakLevelsChannel = nil
+				im.wake()
+			}
+
+			select {
+			case <-ctx.Done():
+				im.wake()
+				return nil
+
+			case <-configReloadedChannel:
+
+			case levels := <-peakLevelsChannel:
+				if audible(levels) {
+					im.activity()
+				}
+
+			case <-sliderEventsChannel:
+				im.activity()
+
+			case <-buttonEventsChannel:
+				im.activity()
+
+			case connected := <-connectionChannel:
+				// boards start out awake, so a reconnected board has to be put back to sleep
+				if connected && im.asleep {
+					im.send(idleSleepLine)
+				}
+
+			case <-ticker.C:
+				timeout := time.Duration(im.deej.config.Idle.Minutes) * time.Minute
+				if enabled && !im.asleep && time.Since(im.lastActive) >= timeout {
+					im.logger.Infow("No audio played for a while, putting the board to sleep", "minutes", im.deej.config.Idle.Minutes)
+					im.asleep = true
+					im.send(idleSleepLine)
+				}
+			}
+		}
+	})
+}
+
+// activity restarts the idle timer, waking the board if it's asleep
+func (im *idleMonitor) activity() {
+	im.lastActive = time.Now()
+	im.wake()
+}
+
+func (im *idleMonitor) wake() {
+	if !im.asleep {
+		return
+	}
+
+	im.logger.Info("Activity after being idle, waking the board")
+	im.asleep = false
+	im.send(idleWakeLine)
+}
+
+func (im *idleMonitor) send(line string) {
+	if !im.deej.serial.Connected() {
+		return
+	}
+
+	if err := im.deej.serial.WriteLine(line); err != nil {
+		im.logger.Debugw("Failed to send idle state", "line", line, "error", err)
+	}
+}
+
+// audible returns true if any session is playing something louder than the silence threshold
+func audible(levels PeakLevels) bool {
+	for _, peak := range levels {
+		if peak > idlePeakThreshold {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,6 +3,7 @@ package deej
 import (
 	"fmt"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/omriharel/deej/pkg/deej/util"
@@ -11,12 +12,12 @@ import (
 )
 
 const (
-	BuildTypeNone    = ""       // Default build type (undefined)
-	BuildTypeDev     = "dev"    // Development build type
+	BuildTypeNone    = ""        // Default build type (undefined)
+	BuildTypeDev     = "dev"     // Development build type
 	BuildTypeRelease = "release" // Release build type
 
-	LogDirectory = "logs"                 // Directory for log files
-	LogFilename  = "deej-latest-run.log"  // Default log file name
+	LogDirectory = "logs"                // Directory for log files
+	LogFilename  = "deej-latest-run.log" // Default log file name
 )
 
 // NewLogger initializes and returns a new logger instance based on the build type.
@@ -52,12 +53,56 @@ func NewLogger(buildType string) (*zap.SugaredLogger, error) {
 		enc.AppendString(fmt.Sprintf("%-27s", name))
 	}
 
+	// Keep the most recent lines around for crashlogs, without colors
+	breadcrumbEncoderConfig := loggerConfig.EncoderConfig
+	breadcrumbEncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	breadcrumbCore := zapcore.NewCore(zapcore.NewConsoleEncoder(breadcrumbEncoderConfig), zapcore.AddSync(logBreadcrumbs), loggerConfig.Level)
+
 	// Build the logger
-	logger, err := loggerConfig.Build()
+	logger, err := loggerConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, breadcrumbCore)
+	}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
 	// Return the sugared logger for ease of use
 	return logger.Sugar(), nil
-}
\ No newline at end of file
+}
+
+// how many of the most recent log lines crashlogs include
+const breadcrumbCount = 100
+
+// logBreadcrumbs holds the most recent log lines, see NewLogger
+var logBreadcrumbs = &breadcrumbs{}
+
+// breadcrumbs is a ring buffer of log lines. zap writes each entry with a single Write call.
+type breadcrumbs struct {
+	lock  sync.Mutex
+	lines []string
+	next  int
+}
+
+func (b *breadcrumbs) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	line := string(p)
+
+	if len(b.lines) < breadcrumbCount {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % breadcrumbCount
+	}
+
+	return len(p), nil
+}
+
+// recent returns the buffered lines, oldest first
+func (b *breadcrumbs) recent() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append(append([]string{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
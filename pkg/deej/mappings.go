@@ -0,0 +1,219 @@
+package deej
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/omriharel/deej/pkg/deej/deejpb"
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// the mapping report is overwritten each time, as only the current state is of interest
+const mappingReportFilename = "deej-mappings.txt"
+
+// sliderMappingInfo describes what a slider currently controls, for figuring out why a target doesn't work
+type sliderMappingInfo struct {
+	SliderID int
+	Name     string
+	Disabled bool
+	Targets  []mappedTarget
+}
+
+// mappedTarget is one of a slider's targets along with the live sessions it resolves to right now
+type mappedTarget struct {
+	Target      string
+	SessionKeys []string // once per session, so a key can repeat
+	External    bool
+	AliasOf     []string // the targets the target stands for, if it's an alias
+}
+
+// describeMappings resolves every mapped or disabled slider's targets against the current sessions,
+// ordered by slider ID
+func (m *sessionMap) describeMappings() []sliderMappingInfo {
+	targetsBySlider := make(map[int][]string)
+	m.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		targetsBySlider[sliderIdx] = targets
+	})
+
+	for sliderIdx := range m.config.DisabledSliders {
+		if _, ok := targetsBySlider[sliderIdx]; !ok {
+			targetsBySlider[sliderIdx] = nil
+		}
+	}
+
+	infos := make([]sliderMappingInfo, 0, len(targetsBySlider))
+	for sliderIdx, targets := range targetsBySlider {
+		info := sliderMappingInfo{
+			SliderID: sliderIdx,
+			Name:     m.config.SliderNames[sliderIdx],
+			Disabled: m.config.DisabledSliders[sliderIdx],
+		}
+
+		for _, target := range targets {
+			info.Targets = append(info.Targets, m.describeTarget(target))
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].SliderID < infos[j].SliderID
+	})
+
+	return infos
+}
+
+// describeTarget resolves a single slider_mapping target, including both sides of a crossfade
+func (m *sessionMap) describeTarget(target string) mappedTarget {
+	if m.isExternalTarget(target) {
+		return mappedTarget{Target: target, External: true}
+	}
+
+	described := mappedTarget{Target: target}
+	described.AliasOf, _ = m.aliasTargets(target)
+
+	sides := []string{target}
+	if targetA, targetB, ok := m.crossfadeTargets(target); ok {
+		sides = []string{targetA, targetB}
+	}
+
+	for _, side := range sides {
+		for _, resolvedTarget := range m.resolveTarget(side) {
+			sessions, _ := m.get(resolvedTarget)
+			for _, session := range sessions {
+				described.SessionKeys = append(described.SessionKeys, session.Key())
+			}
+		}
+	}
+
+	return described
+}
+
+// exportMappingReport writes the current mappings to the logs folder, returning the report's path
+func (m *sessionMap) exportMappingReport() (string, error) {
+	var contents bytes.Buffer
+	if err := WriteMappingReport(&contents, mappingsToProto(m.describeMappings())); err != nil {
+		return "", fmt.Errorf("format mapping report: %w", err)
+	}
+
+	if err := util.EnsureDirExists(LogDirectory); err != nil {
+		return "", err
+	}
+
+	reportPath := filepath.Join(LogDirectory, mappingReportFilename)
+	if err := os.WriteFile(reportPath, contents.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write mapping report: %w", err)
+	}
+
+	return reportPath, nil
+}
+
+// mappingsToProto converts slider mappings for the gRPC API and WriteMappingReport
+func mappingsToProto(infos []sliderMappingInfo) []*deejpb.SliderMapping {
+	mappings := make([]*deejpb.SliderMapping, len(infos))
+	for i, info := range infos {
+		mappings[i] = &deejpb.SliderMapping{
+			SliderId: int32(info.SliderID),
+			Name:     info.Name,
+			Disabled: info.Disabled,
+		}
+
+		for _, target := range info.Targets {
+			mappings[i].Targets = append(mappings[i].Targets, &deejpb.MappedTarget{
+				Target:      target.Target,
+				SessionKeys: target.SessionKeys,
+				External:    target.External,
+				AliasOf:     target.AliasOf,
+			})
+		}
+	}
+
+	return mappings
+}
+
+// WriteMappingReport prints slider mappings in a human-readable form, one line per target
+func WriteMappingReport(w io.Writer, mappings []*deejpb.SliderMapping) error {
+	if len(mappings) == 0 {
+		_, err := fmt.Fprintln(w, "No sliders are mapped")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLIDER\tTARGET\tSESSIONS")
+
+	for _, mapping := range mappings {
+		slider := describeSlider(mapping)
+
+		if len(mapping.Targets) == 0 {
+			fmt.Fprintf(tw, "%s\t-\t-\n", slider)
+		}
+
+		for _, target := range mapping.Targets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", slider, describeMappedTarget(target), describeSessionKeys(target))
+
+			// only name the slider on its first line
+			slider = ""
+		}
+	}
+
+	return tw.Flush()
+}
+
+// describeSlider names a slider by its index, followed by its configured name and whether it's disabled
+func describeSlider(mapping *deejpb.SliderMapping) string {
+	description := fmt.Sprint(mapping.SliderId)
+	if mapping.Name != "" {
+		description += fmt.Sprintf(" (%s)", mapping.Name)
+	}
+
+	if mapping.Disabled {
+		description += " [disabled]"
+	}
+
+	return description
+}
+
+// describeMappedTarget shows a target as written, followed by what it stands for if it's an alias
+func describeMappedTarget(target *deejpb.MappedTarget) string {
+	if len(target.AliasOf) == 0 {
+		return target.Target
+	}
+
+	return fmt.Sprintf("%s (%s)", target.Target, strings.Join(target.AliasOf, ", "))
+}
+
+// describeSessionKeys lists a target's session keys once each, with a count for keys shared by several sessions
+func describeSessionKeys(target *deejpb.MappedTarget) string {
+	if target.External {
+		return "(handled by an integration)"
+	}
+
+	if len(target.SessionKeys) == 0 {
+		return "(no live sessions)"
+	}
+
+	counts := make(map[string]int)
+	var unique []string
+
+	for _, key := range target.SessionKeys {
+		if counts[key] == 0 {
+			unique = append(unique, key)
+		}
+
+		counts[key]++
+	}
+
+	for i, key := range unique {
+		if counts[key] > 1 {
+			unique[i] = fmt.Sprintf("%s (%d)", key, counts[key])
+		}
+	}
+
+	return strings.Join(unique, ", ")
+}
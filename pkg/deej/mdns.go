@@ -0,0 +1,517 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	mdnsAddress = "224.0.0.251:5353"
+	mdnsPort    = 5353
+	mdnsDomain  = "local."
+
+	// asked by browsers that list every kind of service on the network
+	mdnsServiceEnumeration = "_services._dns-sd._udp." + mdnsDomain
+
+	// how long other machines may cache records about the host, and about the service itself (RFC 6762 section 10)
+	mdnsHostTTL    = 120
+	mdnsServiceTTL = 75 * 60
+
+	// set on the class of records only deej answers for, telling caches to replace what they have instead of adding to it
+	mdnsCacheFlush = 1 << 15
+
+	// set on the class of questions asking for a unicast reply, which a multicast one satisfies just as well
+	mdnsUnicastResponse = 1 << 15
+
+	mdnsMaxPacketSize    = 9000
+	mdnsMaxLabelLength   = 63
+	mdnsAnnouncements    = 2
+	mdnsAnnounceInterval = time.Second
+)
+
+// mdnsService describes a DNS-SD service to advertise, e.g. "Living room PC._deej._tcp.local." on port 7532
+type mdnsService struct {
+	instance string // a name for people to pick, unique on the network
+	service  string // e.g. "_deej._tcp"
+	host     string // the host name the service's addresses are published under, without ".local"
+	port     uint16
+	txt      []string
+
+	// ips are the addresses to advertise. If empty, each network interface advertises its own addresses.
+	ips []net.IP
+}
+
+// mdnsResponder advertises a single service over multicast DNS, so devices on the LAN can find it without the user
+// typing in an address. It only answers questions about its own records, which lets it share the port with Avahi
+// or Bonjour, and skips probing for name conflicts since its names come from the machine's own host name.
+type mdnsResponder struct {
+	logger  *zap.SugaredLogger
+	service mdnsService
+
+	conn  *ipv4.PacketConn
+	group *net.UDPAddr
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// newMDNSService builds a service description from user-facing names, making them valid DNS labels
+func newMDNSService(instance, service, host string, port uint16, txt []string, ips []net.IP) mdnsService {
+	// dnsmessage has no way of escaping a dot within a label
+	instance = strings.ReplaceAll(instance, ".", "-")
+
+	host = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+
+		return '-'
+	}, strings.ToLower(host))
+
+	return mdnsService{
+		instance: truncateMDNSLabel(instance),
+		service:  service,
+		host:     truncateMDNSLabel(host),
+		port:     port,
+		txt:      txt,
+		ips:      ips,
+	}
+}
+
+func truncateMDNSLabel(label string) string {
+	for len(label) > mdnsMaxLabelLength {
+		// drop whole runes, so the label stays valid UTF-8
+		_, size := utf8.DecodeLastRuneInString(label)
+		label = label[:len(label)-size]
+	}
+
+	return label
+}
+
+func (s mdnsService) equal(other mdnsService) bool {
+	if s.instance != other.instance || s.service != other.service || s.host != other.host || s.port != other.port ||
+		len(s.txt) != len(other.txt) || len(s.ips) != len(other.ips) {
+		return false
+	}
+
+	for i := range s.txt {
+		if s.txt[i] != other.txt[i] {
+			return false
+		}
+	}
+
+	for i := range s.ips {
+		if !s.ips[i].Equal(other.ips[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s mdnsService) serviceName() string {
+	return s.service + "." + mdnsDomain
+}
+
+func (s mdnsService) instanceName() string {
+	return s.instance + "." + s.serviceName()
+}
+
+func (s mdnsService) hostName() string {
+	return s.host + "." + mdnsDomain
+}
+
+// startMDNSResponder joins the mDNS group on every interface, announces the service and answers questions about
+// it until stopped
+func startMDNSResponder(service mdnsService, logger *zap.SugaredLogger, onPanic func(interface{})) (*mdnsResponder, error) {
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddress)
+	if err != nil {
+		return nil, fmt.Errorf("resolve mDNS address: %w", err)
+	}
+
+	// unlike a plain listener, this lets other responders on the machine keep using the port
+	udpConn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, fmt.Errorf("listen for mDNS: %w", err)
+	}
+
+	conn := ipv4.NewPacketConn(udpConn)
+
+	// the listener only joined the group on the default interface, which fails to join again
+	for _, ifi := range mdnsInterfaces() {
+		if err := conn.JoinGroup(&ifi, group); err != nil {
+			logger.Debugw("Didn't join mDNS group", "interface", ifi.Name, "error", err)
+		}
+	}
+
+	if err := conn.SetMulticastTTL(255); err != nil {
+		logger.Debugw("Failed to set mDNS multicast TTL", "error", err)
+	}
+
+	// not supported on Windows, where replies just go out the default interface
+	if err := conn.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+		logger.Debugw("Can't tell which interface mDNS questions arrive on", "error", err)
+	}
+
+	mr := &mdnsResponder{
+		logger:  logger.Named("mdns"),
+		service: service,
+		conn:    conn,
+		group:   group,
+		stopped: make(chan struct{}),
+	}
+
+	util.Go(onPanic, mr.serve)
+
+	util.Go(onPanic, func() {
+		for i := 0; i < mdnsAnnouncements; i++ {
+			if i > 0 {
+				select {
+				case <-mr.stopped:
+					return
+				case <-time.After(mdnsAnnounceInterval):
+				}
+			}
+
+			mr.announce(false)
+		}
+	})
+
+	mr.logger.Infow("Advertising over mDNS", "instance", service.instanceName(), "port", service.port)
+
+	return mr, nil
+}
+
+// stop says goodbye, so other machines drop the service right away instead of when their cache expires
+func (mr *mdnsResponder) stop() {
+	mr.stopOnce.Do(func() {
+		close(mr.stopped)
+
+		mr.announce(true)
+
+		if err := mr.conn.Close(); err != nil {
+			mr.logger.Debugw("Failed to close mDNS listener", "error", err)
+		}
+
+		mr.logger.Debug("Stopped advertising over mDNS")
+	})
+}
+
+func (mr *mdnsResponder) serve() {
+	buf := make([]byte, mdnsMaxPacketSize)
+
+	for {
+		n, cm, src, err := mr.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			mr.logger.Debugw("Failed to read mDNS packet", "error", err)
+			continue
+		}
+
+		srcAddr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		ifIndex := 0
+		if cm != nil {
+			ifIndex = cm.IfIndex
+		}
+
+		mr.handleQuery(buf[:n], srcAddr, ifIndex)
+	}
+}
+
+func (mr *mdnsResponder) handleQuery(packet []byte, src *net.UDPAddr, ifIndex int) {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(packet)
+	if err != nil || header.Response {
+		return
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return
+	}
+
+	// one-shot resolvers ask from a port of their own, and only understand a plain unicast DNS reply
+	legacy := src.Port != mdnsPort
+
+	reply := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	if legacy {
+		reply.Header.ID = header.ID
+	}
+
+	ips := mr.addresses(ifIndex)
+
+	for _, question := range questions {
+		class := question.Class &^ mdnsUnicastResponse
+		if class != dnsmessage.ClassINET && class != dnsmessage.ClassANY {
+			continue
+		}
+
+		answers, additionals := mr.records(question.Name.String(), question.Type, ips)
+		if len(answers) == 0 {
+			continue
+		}
+
+		if legacy {
+			question.Class = class
+			reply.Questions = append(reply.Questions, question)
+		}
+
+		reply.Answers = append(reply.Answers, answers...)
+		reply.Additionals = append(reply.Additionals, additionals...)
+	}
+
+	if len(reply.Answers) == 0 {
+		return
+	}
+
+	reply.Additionals = withoutMDNSDuplicates(reply.Additionals, reply.Answers)
+
+	dst := mr.group
+	if legacy {
+		dst = src
+
+		// cache flushing means nothing to a plain DNS resolver, and may confuse it
+		for _, records := range [][]dnsmessage.Resource{reply.Answers, reply.Additionals} {
+			for i := range records {
+				records[i].Header.Class &^= mdnsCacheFlush
+			}
+		}
+	}
+
+	mr.send(reply, dst, ifIndex)
+}
+
+// records returns the answers to a single question, along with records the asker will likely want next
+func (mr *mdnsResponder) records(name string, questionType dnsmessage.Type, ips []net.IP) (answers, additionals []dnsmessage.Resource) {
+	wants := func(recordType dnsmessage.Type) bool {
+		return questionType == recordType || questionType == dnsmessage.TypeALL
+	}
+
+	service := mr.service
+
+	switch {
+	case strings.EqualFold(name, mdnsServiceEnumeration) && wants(dnsmessage.TypePTR):
+		answers = append(answers, service.enumerationRecord())
+
+	case strings.EqualFold(name, service.serviceName()) && wants(dnsmessage.TypePTR):
+		answers = append(answers, service.pointerRecord())
+		additionals = append(additionals, service.serviceRecord(), service.textRecord())
+		additionals = append(additionals, service.addressRecords(ips)...)
+
+	case strings.EqualFold(name, service.instanceName()):
+		if wants(dnsmessage.TypeSRV) {
+			answers = append(answers, service.serviceRecord())
+			additionals = append(additionals, service.addressRecords(ips)...)
+		}
+
+		if wants(dnsmessage.TypeTXT) {
+			answers = append(answers, service.textRecord())
+		}
+
+	case strings.EqualFold(name, service.hostName()) && wants(dnsmessage.TypeA):
+		answers = append(answers, service.addressRecords(ips)...)
+	}
+
+	return answers, additionals
+}
+
+// announce sends every record out each interface unprompted, or with a TTL of 0 to say goodbye
+func (mr *mdnsResponder) announce(goodbye bool) {
+	for _, ifi := range mdnsInterfaces() {
+		ips := mr.addresses(ifi.Index)
+		if len(ips) == 0 {
+			continue
+		}
+
+		service := mr.service
+		message := dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: []dnsmessage.Resource{service.pointerRecord(), service.serviceRecord(), service.textRecord()},
+		}
+
+		message.Answers = append(message.Answers, service.addressRecords(ips)...)
+
+		if goodbye {
+			for i := range message.Answers {
+				message.Answers[i].Header.TTL = 0
+			}
+		}
+
+		mr.send(message, mr.group, ifi.Index)
+	}
+}
+
+func (mr *mdnsResponder) send(message dnsmessage.Message, dst *net.UDPAddr, ifIndex int) {
+	packet, err := message.Pack()
+	if err != nil {
+		mr.logger.Warnw("Failed to build mDNS reply", "error", err)
+		return
+	}
+
+	var cm *ipv4.ControlMessage
+	if ifIndex != 0 {
+		cm = &ipv4.ControlMessage{IfIndex: ifIndex}
+	}
+
+	if _, err := mr.conn.WriteTo(packet, cm, dst); err != nil {
+		mr.logger.Debugw("Failed to send mDNS reply", "destination", dst, "error", err)
+	}
+}
+
+// addresses returns the IPv4 addresses to advertise to the network a question came from, or to every network
+// if that isn't known
+func (mr *mdnsResponder) addresses(ifIndex int) []net.IP {
+	if len(mr.service.ips) > 0 {
+		return mr.service.ips
+	}
+
+	interfaces := mdnsInterfaces()
+	if ifIndex != 0 {
+		if ifi, err := net.InterfaceByIndex(ifIndex); err == nil {
+			interfaces = []net.Interface{*ifi}
+		}
+	}
+
+	var ips []net.IP
+
+	for _, ifi := range interfaces {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				ips = append(ips, ipNet.IP.To4())
+			}
+		}
+	}
+
+	return ips
+}
+
+// mdnsInterfaces returns the network interfaces other devices may be asking on
+func mdnsInterfaces() []net.Interface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var usable []net.Interface
+
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 && ifi.Flags&net.FlagLoopback == 0 {
+			usable = append(usable, ifi)
+		}
+	}
+
+	return usable
+}
+
+func (s mdnsService) enumerationRecord() dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: mdnsRecordHeader(mdnsServiceEnumeration, dnsmessage.TypePTR, mdnsServiceTTL, false),
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(s.serviceName())},
+	}
+}
+
+func (s mdnsService) pointerRecord() dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: mdnsRecordHeader(s.serviceName(), dnsmessage.TypePTR, mdnsServiceTTL, false),
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(s.instanceName())},
+	}
+}
+
+func (s mdnsService) serviceRecord() dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: mdnsRecordHeader(s.instanceName(), dnsmessage.TypeSRV, mdnsHostTTL, true),
+		Body:   &dnsmessage.SRVResource{Port: s.port, Target: dnsmessage.MustNewName(s.hostName())},
+	}
+}
+
+func (s mdnsService) textRecord() dnsmessage.Resource {
+	// a TXT record can't be empty
+	txt := s.txt
+	if len(txt) == 0 {
+		txt = []string{""}
+	}
+
+	return dnsmessage.Resource{
+		Header: mdnsRecordHeader(s.instanceName(), dnsmessage.TypeTXT, mdnsServiceTTL, true),
+		Body:   &dnsmessage.TXTResource{TXT: txt},
+	}
+}
+
+func (s mdnsService) addressRecords(ips []net.IP) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			continue
+		}
+
+		records = append(records, dnsmessage.Resource{
+			Header: mdnsRecordHeader(s.hostName(), dnsmessage.TypeA, mdnsHostTTL, true),
+			Body:   &dnsmessage.AResource{A: [4]byte(ip4)},
+		})
+	}
+
+	return records
+}
+
+func mdnsRecordHeader(name string, recordType dnsmessage.Type, ttl uint32, unique bool) dnsmessage.ResourceHeader {
+	class := dnsmessage.ClassINET
+	if unique {
+		class |= mdnsCacheFlush
+	}
+
+	return dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  recordType,
+		Class: class,
+		TTL:   ttl,
+	}
+}
+
+// withoutMDNSDuplicates drops additional records that are already among the answers, or listed twice
+func withoutMDNSDuplicates(additionals, answers []dnsmessage.Resource) []dnsmessage.Resource {
+	seen := make(map[string]bool)
+	key := func(record dnsmessage.Resource) string {
+		return record.Header.Type.String() + " " + record.Header.Name.String() + " " + record.Body.GoString()
+	}
+
+	for _, answer := range answers {
+		seen[key(answer)] = true
+	}
+
+	var unique []dnsmessage.Resource
+
+	for _, additional := range additionals {
+		if !seen[key(additional)] {
+			seen[key(additional)] = true
+			unique = append(unique, additional)
+		}
+	}
+
+	return unique
+}
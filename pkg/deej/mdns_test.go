@@ -0,0 +1,75 @@
+package deej
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMDNSRecords(t *testing.T) {
+	service := newMDNSService("Living room v2.0", "_deej._tcp", "Living_Room", 7532, []string{"version=1"}, nil)
+	responder := &mdnsResponder{service: service}
+	ips := []net.IP{net.ParseIP("192.168.1.20")}
+
+	tests := []struct {
+		name            string
+		question        string
+		questionType    dnsmessage.Type
+		wantAnswers     []dnsmessage.Type
+		wantAdditionals []dnsmessage.Type
+	}{
+		{"browsing for the service", "_deej._tcp.local.", dnsmessage.TypePTR,
+			[]dnsmessage.Type{dnsmessage.TypePTR},
+			[]dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA}},
+		{"resolving the instance", "Living room v2-0._deej._tcp.local.", dnsmessage.TypeSRV,
+			[]dnsmessage.Type{dnsmessage.TypeSRV},
+			[]dnsmessage.Type{dnsmessage.TypeA}},
+		{"any record of the instance", "living room v2-0._DEEJ._tcp.local.", dnsmessage.TypeALL,
+			[]dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT},
+			[]dnsmessage.Type{dnsmessage.TypeA}},
+		{"resolving the host", "living-room.local.", dnsmessage.TypeA,
+			[]dnsmessage.Type{dnsmessage.TypeA}, nil},
+		{"enumerating services", "_services._dns-sd._udp.local.", dnsmessage.TypePTR,
+			[]dnsmessage.Type{dnsmessage.TypePTR}, nil},
+		{"another service", "_http._tcp.local.", dnsmessage.TypePTR, nil, nil},
+		{"a record the host doesn't have", "living-room.local.", dnsmessage.TypeAAAA, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			answers, additionals := responder.records(test.question, test.questionType, ips)
+
+			if got := mdnsRecordTypes(answers); !equalMDNSTypes(got, test.wantAnswers) {
+				t.Errorf("answers = %v, want %v", got, test.wantAnswers)
+			}
+
+			if got := mdnsRecordTypes(additionals); !equalMDNSTypes(got, test.wantAdditionals) {
+				t.Errorf("additionals = %v, want %v", got, test.wantAdditionals)
+			}
+		})
+	}
+}
+
+func mdnsRecordTypes(records []dnsmessage.Resource) []dnsmessage.Type {
+	var types []dnsmessage.Type
+	for _, record := range records {
+		types = append(types, record.Header.Type)
+	}
+
+	return types
+}
+
+func equalMDNSTypes(a, b []dnsmessage.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,214 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// mediaPlayerTargetPrefix addresses media players by name, e.g. "mpris:spotify". The same targets work on Windows,
+	// where players are found through the system media transport controls (SMTC) rather than MPRIS
+	mediaPlayerTargetPrefix = "mpris"
+
+	// mediaPlayerActive stands for the player that's playing, or failing that the first one found
+	mediaPlayerActive = "active"
+
+	// a slider mapped to e.g. "mpris:spotify.position" seeks through the current track instead of setting the volume
+	mediaPlayerPositionSuffix = ".position"
+)
+
+var errMediaVolumeUnsupported = errors.New("player doesn't expose its volume")
+
+// mediaPlayer is a media player the OS lets deej control
+type mediaPlayer interface {
+	MediaController
+
+	// name returns the player's lowercase name, e.g. "spotify"
+	name() string
+	playing() bool
+
+	// volume and setVolume handle the player's own volume, as opposed to that of its audio session
+	volume() (float32, error)
+	setVolume(v float32) error
+
+	// position and seek handle how far into the current track the player is, between 0 and 1
+	position() (float32, error)
+	seek(position float32) error
+}
+
+// mediaPlayerBackend finds the media players on the platform
+type mediaPlayerBackend interface {
+	players() ([]mediaPlayer, error)
+}
+
+// mediaPlayers adds the running media players to the sessions deej controls, so buttons can control their playback
+// and sliders can set their volume or seek, through mpris: targets
+type mediaPlayers struct {
+	deej    *Deej
+	logger  *zap.SugaredLogger
+	backend mediaPlayerBackend
+
+	lock   sync.Mutex
+	active string // the name of the active player as of the last session refresh, if any
+}
+
+func newMediaPlayers(deej *Deej, logger *zap.SugaredLogger) *mediaPlayers {
+	logger = logger.Named("media")
+
+	mp := &mediaPlayers{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created media players instance")
+
+	return mp
+}
+
+// initialize connects to the platform's media players and registers the mpris: target prefix
+func (mp *mediaPlayers) initialize() {
+	backend, err := newMediaPlayerBackend(mp.logger, mp.deej.handlePanic)
+	if err != nil {
+		mp.logger.Warnw("Failed to connect to media players, mpris: targets won't work", "error", err)
+		return
+	}
+
+	mp.backend = backend
+
+	mp.deej.sessions.registerTargetResolver(mediaPlayerTargetPrefix, mp.resolve)
+	mp.deej.sessions.registerSessionFinder(mp)
+}
+
+// GetAllSessions returns two sessions for each media player: one for its volume, and one for its position
+func (mp *mediaPlayers) GetAllSessions() ([]Session, error) {
+	players, err := mp.backend.players()
+	if err != nil {
+		return nil, fmt.Errorf("get media players: %w", err)
+	}
+
+	var sessions []Session
+	active := ""
+	activePlaying := false
+
+	for _, player := range players {
+		if playing := player.playing(); active == "" || (playing && !activePlaying) {
+			active = player.name()
+			activePlaying = playing
+		}
+
+		sessions = append(sessions,
+			newMediaPlayerSession(mp.logger, player, false),
+			newMediaPlayerSession(mp.logger, player, true))
+	}
+
+	mp.lock.Lock()
+	mp.active = active
+	mp.lock.Unlock()
+
+	return sessions, nil
+}
+
+func (mp *mediaPlayers) Release() error {
+	return nil
+}
+
+// resolve turns the name in an mpris: target into the key of the player's session
+func (mp *mediaPlayers) resolve(name string) []string {
+	name = strings.ToLower(name)
+	playerName := strings.TrimSuffix(name, mediaPlayerPositionSuffix)
+
+	if playerName == mediaPlayerActive {
+		mp.lock.Lock()
+		playerName = mp.active
+		mp.lock.Unlock()
+
+		if playerName == "" {
+			return nil
+		}
+	}
+
+	return []string{mediaPlayerSessionKey(playerName, playerName != name && name != mediaPlayerActive)}
+}
+
+func mediaPlayerSessionKey(playerName string, seeks bool) string {
+	key := mediaPlayerTargetPrefix + externalTargetSeparator + playerName
+	if seeks {
+		key += mediaPlayerPositionSuffix
+	}
+
+	return key
+}
+
+// mediaPlayerSession is a media player's volume, or with seeks set, its position in the current track
+type mediaPlayerSession struct {
+	mediaPlayer
+
+	logger *zap.SugaredLogger
+	seeks  bool
+	value  float32 // the volume or position as of when the player was found
+}
+
+func newMediaPlayerSession(logger *zap.SugaredLogger, player mediaPlayer, seeks bool) *mediaPlayerSession {
+	s := &mediaPlayerSession{
+		mediaPlayer: player,
+		logger:      logger,
+		seeks:       seeks,
+		value:       1,
+	}
+
+	var err error
+	var value float32
+
+	if seeks {
+		value, err = player.position()
+	} else {
+		value, err = player.volume()
+	}
+
+	// players that don't tell count as being at full volume, or at the start of the track
+	if err == nil {
+		s.value = value
+	} else if seeks {
+		s.value = 0
+	}
+
+	return s
+}
+
+func (s *mediaPlayerSession) GetVolume() float32 {
+	return s.value
+}
+
+func (s *mediaPlayerSession) SetVolume(v float32) error {
+	if s.seeks {
+		if err := s.seek(v); err != nil {
+			return fmt.Errorf("seek %s: %w", s.name(), err)
+		}
+	} else if err := s.setVolume(v); err != nil {
+		return fmt.Errorf("set %s volume: %w", s.name(), err)
+	}
+
+	s.value = v
+	s.logger.Debugw("Adjusting media player", "player", s.name(), "seek", s.seeks, "to", fmt.Sprintf("%.2f", v))
+
+	return nil
+}
+
+func (s *mediaPlayerSession) Key() string {
+	return mediaPlayerSessionKey(s.name(), s.seeks)
+}
+
+// ID is always empty, so every refresh picks up the player's current volume and position
+func (s *mediaPlayerSession) ID() string {
+	return ""
+}
+
+func (s *mediaPlayerSession) Release() {}
+
+func (s *mediaPlayerSession) String() string {
+	return fmt.Sprintf(sessionStringFormat, s.Key(), s.value)
+}
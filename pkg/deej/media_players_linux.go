@@ -0,0 +1,211 @@
+package deej
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	mprisBusNamePrefix = "org.mpris.MediaPlayer2."
+	mprisPath          = "/org/mpris/MediaPlayer2"
+	mprisPlayer        = "org.mpris.MediaPlayer2.Player"
+
+	mprisPlaying = "Playing"
+
+	// players that aren't on a track report this as its ID
+	mprisNoTrack = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+)
+
+// mprisBackend finds media players through the MPRIS interface they offer on the session bus
+type mprisBackend struct {
+	logger *zap.SugaredLogger
+	conn   *dbus.Conn
+}
+
+func newMediaPlayerBackend(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) (mediaPlayerBackend, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect to session bus: %w", err)
+	}
+
+	return &mprisBackend{logger: logger, conn: conn}, nil
+}
+
+func (b *mprisBackend) players() ([]mediaPlayer, error) {
+	var names []string
+	if err := b.conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, fmt.Errorf("list bus names: %w", err)
+	}
+
+	sort.Strings(names)
+
+	var players []mediaPlayer
+	seen := map[string]bool{}
+
+	for _, busName := range names {
+		if !strings.HasPrefix(busName, mprisBusNamePrefix) {
+			continue
+		}
+
+		// players running more than once add an instance suffix, e.g. "vlc.instance1234"
+		name, _, _ := strings.Cut(strings.TrimPrefix(busName, mprisBusNamePrefix), ".")
+		name = strings.ToLower(name)
+
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		player := &mprisMediaPlayer{
+			playerName: name,
+			object:     b.conn.Object(busName, mprisPath),
+		}
+
+		if status, err := player.property("PlaybackStatus"); err == nil {
+			player.isPlaying = status.Value() == mprisPlaying
+		}
+
+		players = append(players, player)
+	}
+
+	return players, nil
+}
+
+type mprisMediaPlayer struct {
+	playerName string
+	object     dbus.BusObject
+	isPlaying  bool
+}
+
+func (p *mprisMediaPlayer) name() string {
+	return p.playerName
+}
+
+func (p *mprisMediaPlayer) playing() bool {
+	return p.isPlaying
+}
+
+func (p *mprisMediaPlayer) PlayPause() error {
+	return p.call("PlayPause")
+}
+
+func (p *mprisMediaPlayer) Next() error {
+	return p.call("Next")
+}
+
+func (p *mprisMediaPlayer) Previous() error {
+	return p.call("Previous")
+}
+
+func (p *mprisMediaPlayer) Stop() error {
+	return p.call("Stop")
+}
+
+func (p *mprisMediaPlayer) volume() (float32, error) {
+	variant, err := p.property("Volume")
+	if err != nil {
+		return 0, err
+	}
+
+	volume, ok := variant.Value().(float64)
+	if !ok {
+		return 0, errMediaVolumeUnsupported
+	}
+
+	return float32(volume), nil
+}
+
+func (p *mprisMediaPlayer) setVolume(v float32) error {
+	if err := p.object.SetProperty(mprisPlayer+".Volume", dbus.MakeVariant(float64(v))); err != nil {
+		return fmt.Errorf("set volume property: %w", err)
+	}
+
+	return nil
+}
+
+func (p *mprisMediaPlayer) position() (float32, error) {
+	_, length, err := p.track()
+	if err != nil {
+		return 0, err
+	}
+
+	variant, err := p.property("Position")
+	if err != nil {
+		return 0, err
+	}
+
+	position, ok := variant.Value().(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected position type %T", variant.Value())
+	}
+
+	return float32(position) / float32(length), nil
+}
+
+// seek goes to a point in the current track. MPRIS only takes absolute positions along with the track they're
+// for, so that a seek can't land in the next track if it changes in between
+func (p *mprisMediaPlayer) seek(position float32) error {
+	trackID, length, err := p.track()
+	if err != nil {
+		return err
+	}
+
+	return p.call("SetPosition", trackID, int64(float64(position)*float64(length)))
+}
+
+// track returns the current track's ID and its length in microseconds, which is needed to seek
+func (p *mprisMediaPlayer) track() (dbus.ObjectPath, int64, error) {
+	variant, err := p.property("Metadata")
+	if err != nil {
+		return "", 0, err
+	}
+
+	metadata, ok := variant.Value().(map[string]dbus.Variant)
+	if !ok {
+		return "", 0, fmt.Errorf("unexpected metadata type %T", variant.Value())
+	}
+
+	// some players send the track ID as a string rather than an object path
+	var trackID dbus.ObjectPath
+	switch id := metadata["mpris:trackid"].Value().(type) {
+	case dbus.ObjectPath:
+		trackID = id
+	case string:
+		trackID = dbus.ObjectPath(id)
+	}
+
+	var length int64
+	switch l := metadata["mpris:length"].Value().(type) {
+	case int64:
+		length = l
+	case uint64:
+		length = int64(l)
+	}
+
+	if trackID == "" || trackID == mprisNoTrack || length <= 0 {
+		return "", 0, fmt.Errorf("%s isn't playing a track it can seek in", p.playerName)
+	}
+
+	return trackID, length, nil
+}
+
+func (p *mprisMediaPlayer) property(name string) (dbus.Variant, error) {
+	variant, err := p.object.GetProperty(mprisPlayer + "." + name)
+	if err != nil {
+		return dbus.Variant{}, fmt.Errorf("get %s property: %w", name, err)
+	}
+
+	return variant, nil
+}
+
+func (p *mprisMediaPlayer) call(method string, args ...interface{}) error {
+	if err := p.object.Call(mprisPlayer+"."+method, 0, args...).Err; err != nil {
+		return fmt.Errorf("call %s: %w", method, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,408 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	smtcManagerClass = "Windows.Media.Control.GlobalSystemMediaTransportControlsSessionManager"
+
+	// RO_INIT_MULTITHREADED, which lets async operations complete without pumping messages
+	roInitMultithreaded = 1
+
+	// S_FALSE, which RoInitialize returns when the thread was already initialized
+	sFalse = 0x00000001
+
+	// how long to wait for the player to respond to a request
+	smtcAsyncTimeout      = 2 * time.Second
+	smtcAsyncPollInterval = 10 * time.Millisecond
+)
+
+// the WinRT interfaces used here, which go-ole doesn't wrap. Methods are called by their vtable index, counting
+// IUnknown's 3 and IInspectable's 3 methods that come first
+var (
+	iidSMTCManagerStatics = ole.NewGUID("{2050C4EE-11A0-57DE-AED7-C97C70338245}")
+	iidAsyncInfo          = ole.NewGUID("{00000036-0000-0000-C000-000000000046}")
+)
+
+const (
+	// IGlobalSystemMediaTransportControlsSessionManagerStatics
+	smtcStaticsRequestAsync = 6
+
+	// IGlobalSystemMediaTransportControlsSessionManager
+	smtcManagerGetSessions = 7
+
+	// IVectorView
+	vectorViewGetAt   = 6
+	vectorViewGetSize = 7
+
+	// IAsyncInfo and IAsyncOperation
+	asyncInfoGetStatus      = 7
+	asyncOperationGetResult = 8
+
+	// IGlobalSystemMediaTransportControlsSession
+	smtcSessionSourceAppUserModelID   = 6
+	smtcSessionGetTimelineProperties  = 8
+	smtcSessionGetPlaybackInfo        = 9
+	smtcSessionTryStop                = 12
+	smtcSessionTrySkipNext            = 16
+	smtcSessionTrySkipPrevious        = 17
+	smtcSessionTryTogglePlayPause     = 20
+	smtcSessionTryChangePlaybackPos   = 24
+	smtcTimelineEndTime               = 7
+	smtcTimelinePosition              = 10
+	smtcPlaybackInfoGetPlaybackStatus = 7
+)
+
+// AsyncStatus and GlobalSystemMediaTransportControlsSessionPlaybackStatus values
+const (
+	asyncStatusStarted   = 0
+	asyncStatusCompleted = 1
+	smtcStatusPlaying    = 4
+)
+
+var errSMTCTimeout = errors.New("timed out waiting for the player")
+
+// smtcBackend finds media players through the system media transport controls (SMTC), the same ones the media
+// flyout in the taskbar uses. WinRT objects are only touched from a single thread set up for them.
+type smtcBackend struct {
+	logger *zap.SugaredLogger
+	calls  chan func()
+
+	manager *ole.IUnknown
+	found   []*smtcMediaPlayer // from the last lookup, released on the next one
+}
+
+func newMediaPlayerBackend(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) (mediaPlayerBackend, error) {
+	b := &smtcBackend{
+		logger: logger,
+		calls:  make(chan func()),
+	}
+
+	initialized := make(chan error)
+
+	// the thread lives as long as deej does
+	util.Go(onPanic, func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		if err := ole.RoInitialize(roInitMultithreaded); err != nil {
+			var oleErr *ole.OleError
+			if !errors.As(err, &oleErr) || oleErr.Code() != sFalse {
+				initialized <- fmt.Errorf("initialize windows runtime: %w", err)
+				return
+			}
+		}
+
+		manager, err := requestSMTCManager()
+		if err != nil {
+			initialized <- err
+			return
+		}
+
+		b.manager = manager
+		initialized <- nil
+
+		for call := range b.calls {
+			call()
+		}
+	})
+
+	if err := <-initialized; err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// run calls f on the backend's WinRT thread
+func (b *smtcBackend) run(f func() error) error {
+	result := make(chan error, 1)
+	b.calls <- func() { result <- f() }
+
+	return <-result
+}
+
+func (b *smtcBackend) players() ([]mediaPlayer, error) {
+	var players []mediaPlayer
+
+	err := b.run(func() error {
+		for _, player := range b.found {
+			player.session.Release()
+		}
+		b.found = nil
+
+		var sessions *ole.IUnknown
+		if err := winrtCall(b.manager, smtcManagerGetSessions, uintptr(unsafe.Pointer(&sessions))); err != nil {
+			return fmt.Errorf("get sessions: %w", err)
+		}
+		defer sessions.Release()
+
+		var count uint32
+		if err := winrtCall(sessions, vectorViewGetSize, uintptr(unsafe.Pointer(&count))); err != nil {
+			return fmt.Errorf("get session count: %w", err)
+		}
+
+		seen := map[string]bool{}
+
+		for i := uint32(0); i < count; i++ {
+			var session *ole.IUnknown
+			if err := winrtCall(sessions, vectorViewGetAt, uintptr(i), uintptr(unsafe.Pointer(&session))); err != nil {
+				b.logger.Debugw("Failed to get media session", "index", i, "error", err)
+				continue
+			}
+
+			player, err := b.newPlayer(session)
+			if err != nil || seen[player.playerName] {
+				if err != nil {
+					b.logger.Debugw("Failed to describe media session", "error", err)
+				}
+
+				session.Release()
+				continue
+			}
+			seen[player.playerName] = true
+
+			b.found = append(b.found, player)
+			players = append(players, player)
+		}
+
+		return nil
+	})
+
+	return players, err
+}
+
+func (b *smtcBackend) newPlayer(session *ole.IUnknown) (*smtcMediaPlayer, error) {
+	var appID ole.HString
+	if err := winrtCall(session, smtcSessionSourceAppUserModelID, uintptr(unsafe.Pointer(&appID))); err != nil {
+		return nil, fmt.Errorf("get app ID: %w", err)
+	}
+	defer ole.DeleteHString(appID)
+
+	// desktop apps are identified by their executable, e.g. "Spotify.exe", and store apps by their app user model
+	// ID, e.g. "SpotifyAB.SpotifyMusic_zpdnekdrzrea0!Spotify", whose last part names the app
+	name := appID.String()
+	if separator := strings.LastIndex(name, "!"); separator != -1 {
+		name = name[separator+1:]
+	}
+
+	name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	if name == "" {
+		return nil, errors.New("session has no app ID")
+	}
+
+	player := &smtcMediaPlayer{backend: b, playerName: name, session: session}
+
+	var info *ole.IUnknown
+	if err := winrtCall(session, smtcSessionGetPlaybackInfo, uintptr(unsafe.Pointer(&info))); err == nil {
+		var status int32
+		if err := winrtCall(info, smtcPlaybackInfoGetPlaybackStatus, uintptr(unsafe.Pointer(&status))); err == nil {
+			player.isPlaying = status == smtcStatusPlaying
+		}
+
+		info.Release()
+	}
+
+	return player, nil
+}
+
+type smtcMediaPlayer struct {
+	backend    *smtcBackend
+	playerName string
+	session    *ole.IUnknown
+	isPlaying  bool
+}
+
+func (p *smtcMediaPlayer) name() string {
+	return p.playerName
+}
+
+func (p *smtcMediaPlayer) playing() bool {
+	return p.isPlaying
+}
+
+func (p *smtcMediaPlayer) PlayPause() error {
+	return p.try(smtcSessionTryTogglePlayPause)
+}
+
+func (p *smtcMediaPlayer) Next() error {
+	return p.try(smtcSessionTrySkipNext)
+}
+
+func (p *smtcMediaPlayer) Previous() error {
+	return p.try(smtcSessionTrySkipPrevious)
+}
+
+func (p *smtcMediaPlayer) Stop() error {
+	return p.try(smtcSessionTryStop)
+}
+
+// players' own volume isn't part of SMTC, only their audio session's
+func (p *smtcMediaPlayer) volume() (float32, error) {
+	return 0, errMediaVolumeUnsupported
+}
+
+func (p *smtcMediaPlayer) setVolume(v float32) error {
+	return errMediaVolumeUnsupported
+}
+
+// position is reported by the player when it last updated, so it may lag behind while the track plays
+func (p *smtcMediaPlayer) position() (float32, error) {
+	var position float32
+
+	err := p.backend.run(func() error {
+		end, current, err := p.timeline()
+		if err != nil {
+			return err
+		}
+
+		position = float32(current) / float32(end)
+		return nil
+	})
+
+	return position, err
+}
+
+func (p *smtcMediaPlayer) seek(position float32) error {
+	return p.backend.run(func() error {
+		end, _, err := p.timeline()
+		if err != nil {
+			return err
+		}
+
+		return p.tryOnThread(smtcSessionTryChangePlaybackPos, uintptr(float64(position)*float64(end)))
+	})
+}
+
+// timeline returns the current track's length and position, in 100ns ticks
+func (p *smtcMediaPlayer) timeline() (int64, int64, error) {
+	var timeline *ole.IUnknown
+	if err := winrtCall(p.session, smtcSessionGetTimelineProperties, uintptr(unsafe.Pointer(&timeline))); err != nil {
+		return 0, 0, fmt.Errorf("get timeline: %w", err)
+	}
+	defer timeline.Release()
+
+	var end, position int64
+
+	if err := winrtCall(timeline, smtcTimelineEndTime, uintptr(unsafe.Pointer(&end))); err != nil {
+		return 0, 0, fmt.Errorf("get track length: %w", err)
+	}
+
+	if err := winrtCall(timeline, smtcTimelinePosition, uintptr(unsafe.Pointer(&position))); err != nil {
+		return 0, 0, fmt.Errorf("get track position: %w", err)
+	}
+
+	if end <= 0 {
+		return 0, 0, fmt.Errorf("%s isn't playing a track it can seek in", p.playerName)
+	}
+
+	return end, position, nil
+}
+
+// try calls one of the session's Try...Async methods on the WinRT thread
+func (p *smtcMediaPlayer) try(method int, args ...uintptr) error {
+	return p.backend.run(func() error {
+		return p.tryOnThread(method, args...)
+	})
+}
+
+// tryOnThread calls one of the session's Try...Async methods, which report whether the player went along with it
+func (p *smtcMediaPlayer) tryOnThread(method int, args ...uintptr) error {
+	var operation *ole.IUnknown
+	if err := winrtCall(p.session, method, append(args, uintptr(unsafe.Pointer(&operation)))...); err != nil {
+		return err
+	}
+	defer operation.Release()
+
+	var accepted bool
+	if err := awaitAsync(operation, uintptr(unsafe.Pointer(&accepted))); err != nil {
+		return err
+	}
+
+	if !accepted {
+		return fmt.Errorf("%s refused the request", p.playerName)
+	}
+
+	return nil
+}
+
+// requestSMTCManager gets the session manager, which is only handed out asynchronously
+func requestSMTCManager() (*ole.IUnknown, error) {
+	statics, err := ole.RoGetActivationFactory(smtcManagerClass, iidSMTCManagerStatics)
+	if err != nil {
+		return nil, fmt.Errorf("get media session manager factory: %w", err)
+	}
+	defer statics.Release()
+
+	var operation *ole.IUnknown
+	if err := winrtCall(&statics.IUnknown, smtcStaticsRequestAsync, uintptr(unsafe.Pointer(&operation))); err != nil {
+		return nil, fmt.Errorf("request media session manager: %w", err)
+	}
+	defer operation.Release()
+
+	var manager *ole.IUnknown
+	if err := awaitAsync(operation, uintptr(unsafe.Pointer(&manager))); err != nil {
+		return nil, fmt.Errorf("request media session manager: %w", err)
+	}
+
+	return manager, nil
+}
+
+// awaitAsync waits for an IAsyncOperation to complete and stores its result. Polling its status is simpler than
+// implementing the completion handler interface, and these operations finish quickly.
+func awaitAsync(operation *ole.IUnknown, result uintptr) error {
+	var info *ole.IUnknown
+	if err := winrtCall(operation, 0, uintptr(unsafe.Pointer(iidAsyncInfo)), uintptr(unsafe.Pointer(&info))); err != nil {
+		return fmt.Errorf("get async info: %w", err)
+	}
+	defer info.Release()
+
+	deadline := time.Now().Add(smtcAsyncTimeout)
+
+	for {
+		var status int32
+		if err := winrtCall(info, asyncInfoGetStatus, uintptr(unsafe.Pointer(&status))); err != nil {
+			return fmt.Errorf("get async status: %w", err)
+		}
+
+		if status != asyncStatusStarted {
+			if status != asyncStatusCompleted {
+				return fmt.Errorf("async operation ended with status %d", status)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return errSMTCTimeout
+		}
+
+		time.Sleep(smtcAsyncPollInterval)
+	}
+
+	return winrtCall(operation, asyncOperationGetResult, result)
+}
+
+// winrtCall calls the method at the given vtable index on a WinRT object
+func winrtCall(object *ole.IUnknown, method int, args ...uintptr) error {
+	vtable := (*[32]uintptr)(unsafe.Pointer(object.RawVTable))
+
+	hr, _, _ := syscall.SyscallN(vtable[method], append([]uintptr{uintptr(unsafe.Pointer(object))}, args...)...)
+	if hr != ole.S_OK {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
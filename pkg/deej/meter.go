@@ -0,0 +1,112 @@
+package deej
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// how often session peak levels are read and published
+const meterInterval = 50 * time.Millisecond
+
+// PeakLevels holds the current peak level of each session between 0 and 1, by session key.
+// Sessions that share a key (e.g. several chrome.exe processes) report the highest of their peaks.
+type PeakLevels map[string]float32
+
+// sessionMeter reads the peak level of every session many times per second and publishes them to subscribers.
+// It only reads peaks while someone is subscribed.
+type sessionMeter struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock      sync.Mutex
+	consumers []chan PeakLevels
+}
+
+func newSessionMeter(deej *Deej, logger *zap.SugaredLogger) *sessionMeter {
+	logger = logger.Named("meter")
+
+	sm := &sessionMeter{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created session meter instance")
+
+	return sm
+}
+
+// subscribeToPeakLevels returns a channel that receives the peak levels of all sessions on every meter interval.
+// Subscribers that fall behind miss updates instead of holding up the meter.
+func (sm *sessionMeter) subscribeToPeakLevels() chan PeakLevels {
+	c := make(chan PeakLevels, 1)
+
+	sm.lock.Lock()
+	sm.consumers = append(sm.consumers, c)
+	sm.lock.Unlock()
+
+	return c
+}
+
+// unsubscribeFromPeakLevels stops sending peak levels to a channel from subscribeToPeakLevels
+func (sm *sessionMeter) unsubscribeFromPeakLevels(c chan PeakLevels) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	for idx, consumer := range sm.consumers {
+		if consumer == c {
+			sm.consumers = append(sm.consumers[:idx:idx], sm.consumers[idx+1:]...)
+			return
+		}
+	}
+}
+
+// start begins reading peak levels, until deej shuts down
+func (sm *sessionMeter) start() {
+	sm.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(meterInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				sm.publish()
+			}
+		}
+	})
+}
+
+func (sm *sessionMeter) publish() {
+	sm.lock.Lock()
+	consumers := sm.consumers
+	sm.lock.Unlock()
+
+	if len(consumers) == 0 {
+		return
+	}
+
+	levels := make(PeakLevels)
+	for _, session := range sm.deej.sessions.snapshot() {
+		meter, ok := session.(PeakMeter)
+		if !ok {
+			continue
+		}
+
+		peak := meter.GetPeak()
+
+		if existing, ok := levels[session.Key()]; !ok || peak > existing {
+			levels[session.Key()] = peak
+		}
+	}
+
+	for _, consumer := range consumers {
+		select {
+		case consumer <- levels:
+		default:
+		}
+	}
+}
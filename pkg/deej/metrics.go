@@ -0,0 +1,148 @@
+package deej
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+const metricsPath = "/metrics"
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metrics counts what deej does over time and serves it on the HTTP server in the Prometheus text format,
+// for graphing and alerting on long-running installs
+type metrics struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	sliderMoves atomic.Uint64
+
+	lock         sync.Mutex
+	sliderValues map[int]float32
+}
+
+func newMetrics(deej *Deej, logger *zap.SugaredLogger) *metrics {
+	logger = logger.Named("metrics")
+
+	mt := &metrics{
+		deej:         deej,
+		logger:       logger,
+		sliderValues: make(map[int]float32),
+	}
+
+	logger.Debug("Created metrics instance")
+
+	return mt
+}
+
+// initialize registers the endpoint with the HTTP server and starts tracking slider values
+func (mt *metrics) initialize() {
+	mt.deej.http.handle("GET "+metricsPath, http.HandlerFunc(mt.serve))
+
+	sliderEventsChannel := mt.deej.events.sliderMoved.subscribe()
+
+	mt.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderEventsChannel:
+				mt.sliderMoves.Add(1)
+
+				mt.lock.Lock()
+				mt.sliderValues[event.SliderID] = event.PercentValue
+				mt.lock.Unlock()
+			}
+		}
+	})
+}
+
+func (mt *metrics) serve(w http.ResponseWriter, r *http.Request) {
+	if !mt.deej.config.HTTPInfo.Metrics {
+		http.NotFound(w, r)
+		return
+	}
+
+	var out bytes.Buffer
+
+	writeMetric(&out, "deej_slider_moves_total", "counter", "Slider moves received from the board or plugins.", mt.sliderMoves.Load())
+	writeMetric(&out, "deej_serial_parse_failures_total", "counter", "Lines received from the board that deej couldn't parse.", mt.deej.serial.parseFailures.Load())
+	writeMetric(&out, "deej_serial_checksum_failures_total", "counter", "Lines received from the board that were dropped for a bad or missing checksum.", mt.deej.serial.checksumFailures.Load())
+	writeMetric(&out, "deej_serial_keepalive_timeouts_total", "counter", "Boards disconnected for not answering keepalive pings.", mt.deej.serial.keepaliveTimeouts.Load())
+	writeMetric(&out, "deej_serial_rejected_spikes_total", "counter", "Slider jumps ignored because the next reading didn't confirm them.", mt.deej.serial.rejectedSpikes.Load())
+	writeMetric(&out, "deej_session_refreshes_total", "counter", "Times the list of audio sessions was re-acquired.", mt.deej.sessions.refreshes.Load())
+	writeMetric(&out, "deej_serial_connects_total", "counter", "Times the serial connection to the board was opened.", mt.deej.serial.connects.Load())
+	writeMetric(&out, "deej_serial_disconnects_total", "counter", "Times the serial connection to the board was closed.", mt.deej.serial.disconnects.Load())
+
+	connected := 0
+	if mt.deej.serial.Connected() {
+		connected = 1
+	}
+
+	writeMetric(&out, "deej_serial_connected", "gauge", "Whether the board is currently connected.", connected)
+
+	mt.lock.Lock()
+	sliderValues := make(map[string]float32, len(mt.sliderValues))
+	for sliderIdx, value := range mt.sliderValues {
+		sliderValues[strconv.Itoa(sliderIdx)] = value
+	}
+	mt.lock.Unlock()
+
+	writeLabeledMetric(&out, "deej_slider_value", "Current slider positions, between 0 and 1.", "slider", sliderValues)
+
+	// sessions that share a key (e.g. several chrome.exe processes) would make for duplicate series,
+	// so only the first one counts, like it does for targets
+	sessionVolumes := make(map[string]float32)
+	sessionMuted := make(map[string]float32)
+
+	for _, session := range mt.deej.sessions.snapshot() {
+		if _, ok := sessionVolumes[session.Key()]; ok {
+			continue
+		}
+
+		sessionVolumes[session.Key()] = session.GetVolume()
+		sessionMuted[session.Key()] = 0
+
+		if sessionIsMuted(session) {
+			sessionMuted[session.Key()] = 1
+		}
+	}
+
+	writeLabeledMetric(&out, "deej_session_volume", "Current audio session volumes, between 0 and 1.", "session", sessionVolumes)
+	writeLabeledMetric(&out, "deej_session_muted", "Whether each audio session is muted.", "session", sessionMuted)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if _, err := w.Write(out.Bytes()); err != nil {
+		mt.logger.Debugw("Failed to write metrics", "error", err)
+	}
+}
+
+func writeMetric(out *bytes.Buffer, name string, metricType string, help string, value interface{}) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, metricType, name, value)
+}
+
+// writeLabeledMetric writes a gauge with one series per label value, sorted for stable output
+func writeLabeledMetric(out *bytes.Buffer, name string, help string, label string, values map[string]float32) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+
+	labelValues := make([]string, 0, len(values))
+	for labelValue := range values {
+		labelValues = append(labelValues, labelValue)
+	}
+
+	sort.Strings(labelValues)
+
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(out, "%s{%s=\"%s\"} %v\n", name, label, metricsLabelEscaper.Replace(labelValue), values[labelValue])
+	}
+}
@@ -0,0 +1,244 @@
+package deej
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// the ways a slider move can be handled while one of its targets has no session
+const (
+	// look for new sessions, which is what happens for targets without a policy too
+	missingTargetRefresh = "refresh"
+
+	// do nothing, for apps that are often closed on purpose
+	missingTargetIgnore = "ignore"
+
+	// tell the user, once until the app shows up
+	missingTargetWarn = "warn"
+
+	// remember the volume and set it when the app shows up, e.g. for Discord before joining a call
+	missingTargetBuffer = "buffer"
+
+	// start the app, then set the remembered volume once it shows up
+	missingTargetLaunch = "launch"
+)
+
+var missingTargetActions = map[string]bool{
+	missingTargetRefresh: true,
+	missingTargetIgnore:  true,
+	missingTargetWarn:    true,
+	missingTargetBuffer:  true,
+	missingTargetLaunch:  true,
+}
+
+// an app that was launched for a missing target isn't launched again for this long, so moving the slider while
+// it's still starting up doesn't open it a second time
+const missingTargetLaunchInterval = 30 * time.Second
+
+// missingTargetEvent is published when a slider moves while a target with a warn, buffer or launch policy
+// has no session
+type missingTargetEvent struct {
+	Target string
+	Volume float32
+	Policy MissingTargetPolicy
+}
+
+// handleMissingTarget applies a target's missing_targets policy after a slider move found no session for it,
+// publishing the ones the session map doesn't handle itself. It returns whether the sessions should be refreshed,
+// and false for ok if the target has no policy.
+func (m *sessionMap) handleMissingTarget(target string, v float32) (refresh bool, ok bool) {
+	policy, ok := m.config.MissingTargets[strings.ToLower(target)]
+	if !ok {
+		return false, false
+	}
+
+	switch policy.Action {
+	case missingTargetIgnore:
+		return false, true
+	case missingTargetRefresh:
+		return true, true
+	}
+
+	m.events.targetMissing.publish(missingTargetEvent{Target: target, Volume: v, Policy: policy})
+
+	return true, true
+}
+
+// missingTargets carries out the warn, buffer and launch policies of targets without a session, and sets
+// buffered volumes once their targets show up
+type missingTargets struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// the volume to set each buffered target to once it shows up, by (lowercase) target
+	buffered map[string]missingTargetEvent
+
+	// targets already warned about since they went missing
+	warned map[string]bool
+
+	// when each target's app was last launched
+	launched map[string]time.Time
+}
+
+func newMissingTargets(deej *Deej, logger *zap.SugaredLogger) *missingTargets {
+	logger = logger.Named("missing_targets")
+
+	mt := &missingTargets{
+		deej:     deej,
+		logger:   logger,
+		buffered: make(map[string]missingTargetEvent),
+		warned:   make(map[string]bool),
+		launched: make(map[string]time.Time),
+	}
+
+	logger.Debug("Created missing targets instance")
+
+	return mt
+}
+
+// start handles missing targets and watches for them to show up until deej shuts down
+func (mt *missingTargets) start() {
+	targetMissingChannel := mt.deej.events.targetMissing.subscribe()
+	sessionChangesChannel := mt.deej.events.sessionsChanged.subscribe()
+	configReloadedChannel := mt.deej.events.configReloaded.subscribe()
+
+	mt.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case event := <-targetMissingChannel:
+				mt.handle(event)
+
+			case event := <-sessionChangesChannel:
+				if len(event.Added) > 0 {
+					mt.targetsAppeared()
+				}
+
+			case <-configReloadedChannel:
+				mt.reset()
+			}
+		}
+	})
+}
+
+// handle carries out a missing target's policy
+func (mt *missingTargets) handle(event missingTargetEvent) {
+	key := strings.ToLower(event.Target)
+
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	switch event.Policy.Action {
+	case missingTargetWarn:
+		if mt.warned[key] {
+			return
+		}
+
+		mt.warned[key] = true
+
+		mt.logger.Warnw("Slider moved while its target isn't running", "target", event.Target)
+		mt.deej.notifier.Notify(tr("notify.targetMissing", "target", event.Target),
+			tr("notify.targetMissingMessage"))
+
+	case missingTargetLaunch:
+		mt.buffered[key] = event
+
+		if last, ok := mt.launched[key]; ok && time.Since(last) < missingTargetLaunchInterval {
+			return
+		}
+
+		mt.launched[key] = time.Now()
+		mt.launch(event.Target, event.Policy.Launch)
+
+	case missingTargetBuffer:
+		mt.logger.Debugw("Buffering volume until target shows up", "target", event.Target, "volume", event.Volume)
+		mt.buffered[key] = event
+	}
+}
+
+// launch starts a missing target's app without waiting for it to exit
+func (mt *missingTargets) launch(target string, command []string) {
+	if mt.deej.sessions.dryRun {
+		mt.logger.Infow("Dry run, not launching app for missing target", "target", target, "command", command)
+		return
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	util.HideCommandWindow(cmd)
+
+	if err := cmd.Start(); err != nil {
+		mt.logger.Warnw("Failed to launch app for missing target", "target", target, "command", command, "error", err)
+		mt.deej.notifier.Notify(tr("notify.targetLaunchFailed", "target", target), tr("notify.moreDetails"))
+		return
+	}
+
+	mt.logger.Infow("Launched app for missing target", "target", target, "command", command)
+
+	// reaped in the background, since the app usually keeps running after deej exits anyway
+	util.Go(mt.deej.handlePanic, func() { cmd.Wait() })
+}
+
+// targetsAppeared sets the buffered volumes of targets that have sessions now, and forgets about warnings and
+// launches for them so they apply again the next time the app goes away
+func (mt *missingTargets) targetsAppeared() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	for key, target := range mt.tracked() {
+		event, buffered := mt.buffered[key]
+
+		batch := newVolumeBatch()
+		if !mt.deej.sessions.addTargetToBatch(batch, target, event.Volume) {
+			continue
+		}
+
+		delete(mt.buffered, key)
+		delete(mt.warned, key)
+		delete(mt.launched, key)
+
+		if buffered {
+			mt.logger.Debugw("Setting buffered volume of target that showed up", "target", target, "volume", event.Volume)
+			mt.deej.sessions.applyVolumeBatch(batch)
+		}
+	}
+}
+
+// tracked returns the targets anything is remembered about, by (lowercase) target
+func (mt *missingTargets) tracked() map[string]string {
+	targets := make(map[string]string)
+
+	for key, event := range mt.buffered {
+		targets[key] = event.Target
+	}
+
+	for key := range mt.warned {
+		targets[key] = key
+	}
+
+	for key := range mt.launched {
+		targets[key] = key
+	}
+
+	return targets
+}
+
+// reset forgets everything about missing targets after a config reload, since their policies may have changed
+func (mt *missingTargets) reset() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	mt.buffered = make(map[string]missingTargetEvent)
+	mt.warned = make(map[string]bool)
+	mt.launched = make(map[string]time.Time)
+}
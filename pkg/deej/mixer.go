@@ -0,0 +1,28 @@
+package deej
+
+import "errors"
+
+// mixerPage is a view of the OS's volume mixer or sound settings
+type mixerPage int
+
+const (
+	mixerPageApps   mixerPage = iota // every app's volume
+	mixerPageOutput                  // output devices
+	mixerPageInput                   // input devices
+)
+
+// errMixerMissing is returned by openMixer when there's no mixer to open, e.g. because pavucontrol isn't installed
+var errMixerMissing = errors.New("no volume mixer installed")
+
+// mixerPageFor returns the mixer page that lists a session, going by its key. Device sessions could be
+// either kind of device, but are more often outputs.
+func mixerPageFor(key string) mixerPage {
+	switch {
+	case key == inputSessionName:
+		return mixerPageInput
+	case key == masterSessionName || deviceSessionKeyPattern.MatchString(key):
+		return mixerPageOutput
+	default:
+		return mixerPageApps
+	}
+}
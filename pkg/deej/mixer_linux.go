@@ -0,0 +1,41 @@
+package deej
+
+import (
+	"fmt"
+	"os/exec"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// pavucontrol works the same with PulseAudio and PipeWire, and most desktops' own sound settings can't be
+// opened at a given page
+const mixerCommand = "pavucontrol"
+
+// pavucontrol's tab for each mixer page, as taken by its --tab option
+var mixerPageTabs = map[mixerPage]int{
+	mixerPageApps:   1, // Playback
+	mixerPageOutput: 3, // Output Devices
+	mixerPageInput:  4, // Input Devices
+}
+
+// openMixer opens pavucontrol at the tab showing the given page
+func openMixer(logger *zap.SugaredLogger, onPanic func(recoverValue interface{}), page mixerPage) error {
+	path, err := exec.LookPath(mixerCommand)
+	if err != nil {
+		return errMixerMissing
+	}
+
+	command := exec.Command(path, fmt.Sprintf("--tab=%d", mixerPageTabs[page]))
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", mixerCommand, err)
+	}
+
+	logger.Debugw("Opened volume mixer", "command", command.String())
+
+	// pavucontrol runs until it's closed, so it's only reaped in the background
+	util.Go(onPanic, func() { _ = command.Wait() })
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// the Settings app's page for each mixer page. Apps are listed under "Volume mixer" on Windows 11, and under
+// "App volume and device preferences" on Windows 10
+var mixerPageURIs = map[mixerPage]string{
+	mixerPageApps:   "ms-settings:apps-volume",
+	mixerPageOutput: "ms-settings:sound",
+	mixerPageInput:  "ms-settings:sound",
+}
+
+// openMixer opens the Settings app at the given page
+func openMixer(logger *zap.SugaredLogger, _ func(recoverValue interface{}), page mixerPage) error {
+	return util.OpenExternal(logger, "explorer.exe", mixerPageURIs[page])
+}
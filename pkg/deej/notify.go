@@ -3,6 +3,7 @@ package deej
 import (
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/gen2brain/beeep"
 	"go.uber.org/zap"
@@ -16,6 +17,57 @@ type Notifier interface {
 	Notify(title string, message string)
 }
 
+// notifierGroup sends every notification through each of its notifiers, e.g. toasts and plugins
+type notifierGroup struct {
+	lock      sync.Mutex
+	notifiers []Notifier
+}
+
+func newNotifierGroup(notifiers ...Notifier) *notifierGroup {
+	return &notifierGroup{notifiers: notifiers}
+}
+
+// add includes another notifier in the group
+func (ng *notifierGroup) add(notifier Notifier) {
+	ng.lock.Lock()
+	defer ng.lock.Unlock()
+
+	ng.notifiers = append(ng.notifiers, notifier)
+}
+
+// replace swaps all notifiers in the group for the given ones
+func (ng *notifierGroup) replace(notifiers ...Notifier) {
+	ng.lock.Lock()
+	defer ng.lock.Unlock()
+
+	ng.notifiers = notifiers
+}
+
+// Notify implements Notifier
+func (ng *notifierGroup) Notify(title, message string) {
+	ng.lock.Lock()
+	notifiers := ng.notifiers
+	ng.lock.Unlock()
+
+	for _, notifier := range notifiers {
+		notifier.Notify(title, message)
+	}
+}
+
+// logNotifier writes notifications to the log, for when there's no desktop to show them on
+type logNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+func newLogNotifier(logger *zap.SugaredLogger) *logNotifier {
+	return &logNotifier{logger: logger.Named("notifier")}
+}
+
+// Notify implements Notifier
+func (ln *logNotifier) Notify(title, message string) {
+	ln.logger.Infow("Notification", "title", title, "message", message)
+}
+
 // ToastNotifier handles sending toast notifications on Windows systems.
 type ToastNotifier struct {
 	logger *zap.SugaredLogger
@@ -62,4 +114,4 @@ func (tn *ToastNotifier) ensureIconFile(path string) error {
 
 	tn.logger.Debugw("Successfully created toast notification icon", "path", path)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,408 @@
+package deej
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// obsTargetPrefix addresses OBS audio inputs, e.g. "obs:Mic/Aux"
+	obsTargetPrefix = "obs"
+
+	obsReconnectInterval = 10 * time.Second
+	obsHandshakeTimeout  = 5 * time.Second
+
+	// obs-websocket v5 opcodes
+	obsOpHello      = 0
+	obsOpIdentify   = 1
+	obsOpIdentified = 2
+	obsOpEvent      = 5
+	obsOpRequest    = 6
+	obsOpResponse   = 7
+
+	obsRPCVersion          = 1
+	obsEventSubScenes      = 1 << 2
+	obsEventSceneChanged   = "CurrentProgramSceneChanged"
+	obsRequestSetVolume    = "SetInputVolume"
+	obsRequestCurrentScene = "GetCurrentProgramScene"
+)
+
+var errOBSNotConnected = errors.New("obs: not connected")
+
+// obsClient talks to OBS Studio over obs-websocket (v5) so sliders can control OBS audio inputs,
+// and so the active profile can follow the current OBS scene
+type obsClient struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock      sync.Mutex
+	writeLock sync.Mutex
+	conn      *websocket.Conn
+	info      OBSInfo
+	cancel    context.CancelFunc // stops the current connection loop
+
+	requestID uint64
+}
+
+type obsMessage struct {
+	Op   int             `json:"op"`
+	Data json.RawMessage `json:"d"`
+}
+
+type obsHello struct {
+	Authentication *struct {
+		Challenge string `json:"challenge"`
+		Salt      string `json:"salt"`
+	} `json:"authentication"`
+}
+
+type obsIdentify struct {
+	RPCVersion         int    `json:"rpcVersion"`
+	Authentication     string `json:"authentication,omitempty"`
+	EventSubscriptions int    `json:"eventSubscriptions"`
+}
+
+type obsEvent struct {
+	EventType string          `json:"eventType"`
+	EventData json.RawMessage `json:"eventData"`
+}
+
+type obsRequest struct {
+	RequestType string      `json:"requestType"`
+	RequestID   string      `json:"requestId"`
+	RequestData interface{} `json:"requestData,omitempty"`
+}
+
+type obsResponse struct {
+	RequestType   string `json:"requestType"`
+	RequestStatus struct {
+		Result  bool   `json:"result"`
+		Code    int    `json:"code"`
+		Comment string `json:"comment"`
+	} `json:"requestStatus"`
+	ResponseData json.RawMessage `json:"responseData"`
+}
+
+type obsSceneData struct {
+	SceneName               string `json:"sceneName"`
+	CurrentProgramSceneName string `json:"currentProgramSceneName"`
+}
+
+func newOBSClient(deej *Deej, logger *zap.SugaredLogger) *obsClient {
+	logger = logger.Named("obs")
+
+	oc := &obsClient{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created OBS client instance")
+
+	return oc
+}
+
+// initialize registers the obs: target prefix and watches for config changes
+func (oc *obsClient) initialize() {
+	oc.deej.sessions.registerExternalTarget(obsTargetPrefix, oc.setInputVolume)
+	oc.setupOnConfigReload()
+}
+
+// start keeps a connection to OBS open in the background, if enabled
+func (oc *obsClient) start() {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+
+	info := oc.deej.config.OBSInfo
+	if !info.Enabled {
+		oc.logger.Debug("OBS integration disabled in config, not starting")
+		return
+	}
+
+	if oc.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(oc.deej.routines.ctx)
+	oc.info = info
+	oc.cancel = cancel
+
+	oc.deej.spawn(func(context.Context) error {
+		oc.connectLoop(ctx, info)
+		return nil
+	})
+}
+
+// stop closes the connection to OBS and stops reconnecting
+func (oc *obsClient) stop() {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+
+	if oc.cancel == nil {
+		return
+	}
+
+	oc.logger.Debug("Stopping OBS integration")
+	oc.cancel()
+	oc.cancel = nil
+
+	if oc.conn != nil {
+		oc.conn.Close()
+		oc.conn = nil
+	}
+}
+
+func (oc *obsClient) setupOnConfigReload() {
+	configReloadedChannel := oc.deej.events.configReloaded.subscribe()
+
+	oc.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				oc.lock.Lock()
+				needsRestart := oc.cancel != nil && !oc.info.sameConnection(oc.deej.config.OBSInfo)
+				oc.lock.Unlock()
+
+				if needsRestart {
+					oc.logger.Info("OBS settings changed, reconnecting")
+					oc.stop()
+				}
+
+				oc.start()
+			}
+		}
+	})
+}
+
+// connectLoop (re)connects to OBS until ctx is done
+func (oc *obsClient) connectLoop(ctx context.Context, info OBSInfo) {
+	for {
+		conn, err := oc.connect(info)
+		if err != nil {
+			oc.logger.Debugw("Failed to connect to OBS, will retry", "address", info.Address, "error", err)
+		} else {
+			oc.lock.Lock()
+			select {
+			case <-ctx.Done():
+				oc.lock.Unlock()
+				conn.Close()
+				return
+			default:
+				oc.conn = conn
+			}
+			oc.lock.Unlock()
+
+			oc.logger.Infow("Connected to OBS", "address", info.Address)
+
+			if err := oc.sendRequest(obsRequestCurrentScene, nil); err != nil {
+				oc.logger.Warnw("Failed to request current OBS scene", "error", err)
+			}
+
+			oc.readLoop(conn)
+
+			oc.lock.Lock()
+			if oc.conn == conn {
+				oc.conn = nil
+			}
+			oc.lock.Unlock()
+
+			oc.logger.Info("Disconnected from OBS")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(obsReconnectInterval):
+		}
+	}
+}
+
+// connect dials OBS and completes the Hello/Identify handshake
+func (oc *obsClient) connect(info OBSInfo) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: obsHandshakeTimeout}
+
+	conn, _, err := dialer.Dial("ws://"+info.Address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(obsHandshakeTimeout))
+
+	var message obsMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read hello: %w", err)
+	}
+
+	if message.Op != obsOpHello {
+		conn.Close()
+		return nil, fmt.Errorf("expected hello, got opcode %d", message.Op)
+	}
+
+	var hello obsHello
+	if err := json.Unmarshal(message.Data, &hello); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("parse hello: %w", err)
+	}
+
+	identify := obsIdentify{
+		RPCVersion:         obsRPCVersion,
+		EventSubscriptions: obsEventSubScenes,
+	}
+
+	if hello.Authentication != nil {
+		identify.Authentication = obsAuthenticationString(info.Password, hello.Authentication.Salt, hello.Authentication.Challenge)
+	}
+
+	if err := writeOBSMessage(conn, obsOpIdentify, identify); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send identify: %w", err)
+	}
+
+	// OBS closes the connection instead of responding if authentication fails
+	if err := conn.ReadJSON(&message); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("identify rejected (wrong password?): %w", err)
+	}
+
+	if message.Op != obsOpIdentified {
+		conn.Close()
+		return nil, fmt.Errorf("expected identified, got opcode %d", message.Op)
+	}
+
+	conn.SetReadDeadline(time.Time{})
+
+	return conn, nil
+}
+
+func (oc *obsClient) readLoop(conn *websocket.Conn) {
+	for {
+		var message obsMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			oc.logger.Debugw("OBS connection closed", "error", err)
+			return
+		}
+
+		switch message.Op {
+		case obsOpEvent:
+			oc.handleEvent(message.Data)
+		case obsOpResponse:
+			oc.handleResponse(message.Data)
+		}
+	}
+}
+
+func (oc *obsClient) handleEvent(data json.RawMessage) {
+	var event obsEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		oc.logger.Debugw("Failed to parse OBS event", "error", err)
+		return
+	}
+
+	if event.EventType != obsEventSceneChanged {
+		return
+	}
+
+	var scene obsSceneData
+	if err := json.Unmarshal(event.EventData, &scene); err != nil {
+		oc.logger.Debugw("Failed to parse OBS scene change", "error", err)
+		return
+	}
+
+	oc.onSceneChanged(scene.SceneName)
+}
+
+func (oc *obsClient) handleResponse(data json.RawMessage) {
+	var response obsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		oc.logger.Debugw("Failed to parse OBS response", "error", err)
+		return
+	}
+
+	if !response.RequestStatus.Result {
+		oc.logger.Warnw("OBS request failed",
+			"request", response.RequestType,
+			"code", response.RequestStatus.Code,
+			"comment", response.RequestStatus.Comment)
+		return
+	}
+
+	if response.RequestType == obsRequestCurrentScene {
+		var scene obsSceneData
+		if err := json.Unmarshal(response.ResponseData, &scene); err == nil {
+			oc.onSceneChanged(scene.CurrentProgramSceneName)
+		}
+	}
+}
+
+// onSceneChanged activates the profile configured for the new scene, if any
+func (oc *obsClient) onSceneChanged(sceneName string) {
+	oc.logger.Debugw("OBS program scene changed", "scene", sceneName)
+
+	profile, ok := oc.deej.config.OBSInfo.SceneProfiles[strings.ToLower(sceneName)]
+	if !ok {
+		return
+	}
+
+	if err := oc.deej.config.ActivateProfile(profile); err != nil {
+		oc.logger.Warnw("Failed to activate profile for OBS scene", "scene", sceneName, "profile", profile, "error", err)
+	}
+}
+
+// setInputVolume handles obs:<input name> targets
+func (oc *obsClient) setInputVolume(inputName string, v float32) error {
+	return oc.sendRequest(obsRequestSetVolume, map[string]interface{}{
+		"inputName":      inputName,
+		"inputVolumeMul": v,
+	})
+}
+
+func (oc *obsClient) sendRequest(requestType string, data interface{}) error {
+	oc.lock.Lock()
+	conn := oc.conn
+	oc.requestID++
+	requestID := oc.requestID
+	oc.lock.Unlock()
+
+	if conn == nil {
+		return errOBSNotConnected
+	}
+
+	oc.writeLock.Lock()
+	defer oc.writeLock.Unlock()
+
+	return writeOBSMessage(conn, obsOpRequest, obsRequest{
+		RequestType: requestType,
+		RequestID:   fmt.Sprintf("deej-%d", requestID),
+		RequestData: data,
+	})
+}
+
+func writeOBSMessage(conn *websocket.Conn, op int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal obs message: %w", err)
+	}
+
+	return conn.WriteJSON(obsMessage{Op: op, Data: payload})
+}
+
+// obsAuthenticationString computes the obs-websocket v5 authentication response
+func obsAuthenticationString(password string, salt string, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	secretString := base64.StdEncoding.EncodeToString(secret[:])
+
+	auth := sha256.Sum256([]byte(secretString + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
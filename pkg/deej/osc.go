@@ -0,0 +1,250 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hypebeast/go-osc/osc"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// outbound: /deej/slider/<index> <float 0-1>
+	oscSliderAddressFormat = "/deej/slider/%d"
+
+	// inbound: /deej/target/<target>/volume <float 0-1 or int 0-100>
+	oscTargetAddressPrefix = "/deej/target/"
+	oscVolumeAddressSuffix = "/volume"
+)
+
+// oscBridge publishes slider movements as OSC messages and accepts OSC messages that set target volumes
+type oscBridge struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock   sync.Mutex
+	conn   net.PacketConn
+	client *osc.Client
+	info   OSCInfo
+}
+
+func newOSCBridge(deej *Deej, logger *zap.SugaredLogger) *oscBridge {
+	logger = logger.Named("osc")
+
+	ob := &oscBridge{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created OSC bridge instance")
+
+	return ob
+}
+
+// initialize subscribes to the events the bridge publishes
+func (ob *oscBridge) initialize() {
+	ob.setupOnSliderMove()
+	ob.setupOnConfigReload()
+}
+
+// start opens the configured inbound and outbound endpoints if the bridge is enabled
+func (ob *oscBridge) start() error {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	info := ob.deej.config.OSCInfo
+	if !info.Enabled {
+		ob.logger.Debug("OSC bridge disabled in config, not starting")
+		return nil
+	}
+
+	if ob.running() {
+		return nil
+	}
+
+	var client *osc.Client
+	if info.SendAddress != "" {
+		var err error
+		if client, err = newOSCClient(info.SendAddress); err != nil {
+			ob.logger.Warnw("Invalid OSC send address", "address", info.SendAddress, "error", err)
+			return err
+		}
+	}
+
+	var conn net.PacketConn
+	if info.ListenAddress != "" {
+		var err error
+		if conn, err = net.ListenPacket("udp", info.ListenAddress); err != nil {
+			ob.logger.Warnw("Failed to listen for OSC messages", "address", info.ListenAddress, "error", err)
+			return fmt.Errorf("listen on %s: %w", info.ListenAddress, err)
+		}
+
+		dispatcher := osc.NewStandardDispatcher()
+		dispatcher.AddMsgHandler("*", ob.handleMessage)
+		server := &osc.Server{Dispatcher: dispatcher}
+
+		util.Go(ob.deej.handlePanic, func() {
+			if err := server.Serve(conn); err != nil {
+				ob.logger.Debugw("OSC listener stopped", "error", err)
+			}
+		})
+	}
+
+	ob.conn = conn
+	ob.client = client
+	ob.info = info
+
+	ob.logger.Infow("OSC bridge started", "listenAddress", info.ListenAddress, "sendAddress", info.SendAddress)
+
+	return nil
+}
+
+// stop closes the bridge's endpoints
+func (ob *oscBridge) stop() {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	if !ob.running() {
+		return
+	}
+
+	ob.logger.Debug("Stopping OSC bridge")
+
+	if ob.conn != nil {
+		if err := ob.conn.Close(); err != nil {
+			ob.logger.Warnw("Failed to close OSC listener", "error", err)
+		}
+	}
+
+	ob.conn = nil
+	ob.client = nil
+	ob.info = OSCInfo{}
+}
+
+// running assumes the lock is held
+func (ob *oscBridge) running() bool {
+	return ob.conn != nil || ob.client != nil
+}
+
+func (ob *oscBridge) setupOnConfigReload() {
+	configReloadedChannel := ob.deej.events.configReloaded.subscribe()
+
+	ob.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				ob.lock.Lock()
+				needsRestart := ob.running() && ob.info != ob.deej.config.OSCInfo
+				ob.lock.Unlock()
+
+				if needsRestart {
+					ob.logger.Info("OSC settings changed, restarting bridge")
+					ob.stop()
+				}
+
+				if err := ob.start(); err != nil {
+					ob.logger.Warnw("Failed to start OSC bridge after config reload", "error", err)
+				}
+			}
+		}
+	})
+}
+
+func (ob *oscBridge) setupOnSliderMove() {
+	sliderEventsChannel := ob.deej.events.sliderMoved.subscribe()
+
+	ob.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderEventsChannel:
+				ob.lock.Lock()
+				client := ob.client
+				ob.lock.Unlock()
+
+				if client == nil {
+					continue
+				}
+
+				message := osc.NewMessage(fmt.Sprintf(oscSliderAddressFormat, event.SliderID), event.PercentValue)
+				if err := client.Send(message); err != nil {
+					ob.logger.Debugw("Failed to send OSC message", "address", message.Address, "error", err)
+				}
+			}
+		}
+	})
+}
+
+// handleMessage applies inbound /deej/target/<target>/volume messages
+func (ob *oscBridge) handleMessage(message *osc.Message) {
+	if !strings.HasPrefix(message.Address, oscTargetAddressPrefix) ||
+		!strings.HasSuffix(message.Address, oscVolumeAddressSuffix) {
+		ob.logger.Debugw("Ignoring OSC message with unknown address", "address", message.Address)
+		return
+	}
+
+	target := strings.TrimSuffix(strings.TrimPrefix(message.Address, oscTargetAddressPrefix), oscVolumeAddressSuffix)
+	if target == "" || len(message.Arguments) != 1 {
+		ob.logger.Debugw("Ignoring malformed OSC message", "message", message)
+		return
+	}
+
+	volume, ok := oscArgumentToVolume(message.Arguments[0])
+	if !ok {
+		ob.logger.Debugw("Ignoring OSC message with invalid volume", "message", message)
+		return
+	}
+
+	ob.logger.Debugw("Setting volume via OSC", "target", target, "volume", volume)
+
+	if _, err := ob.deej.sessions.setTargetVolume(target, volume); err != nil {
+		ob.logger.Warnw("Failed to set volume from OSC message", "target", target, "error", err)
+	}
+}
+
+// oscArgumentToVolume accepts floats in the [0, 1] range and integers in the [0, 100] range
+func oscArgumentToVolume(argument interface{}) (float32, bool) {
+	var volume float32
+
+	switch v := argument.(type) {
+	case float32:
+		volume = v
+	case float64:
+		volume = float32(v)
+	case int32:
+		volume = float32(v) / 100
+	case int64:
+		volume = float32(v) / 100
+	default:
+		return 0, false
+	}
+
+	if volume < 0 || volume > 1 {
+		return 0, false
+	}
+
+	return volume, true
+}
+
+func newOSCClient(address string) (*osc.Client, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("parse address %q: %w", address, err)
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, fmt.Errorf("parse port %q: %w", portString, err)
+	}
+
+	return osc.NewClient(host, port), nil
+}
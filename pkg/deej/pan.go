@@ -0,0 +1,180 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// panTargetPrefix turns a slider into a balance knob for the target after it, e.g. "pan:master"
+	panTargetPrefix = "pan"
+
+	// leftTargetPrefix and rightTargetPrefix set one channel of the target after them, e.g. "left:master", so a pair
+	// of sliders can trim each side on its own
+	leftTargetPrefix  = "left"
+	rightTargetPrefix = "right"
+
+	// slider positions this close to the middle count as centered, since physical knobs rarely land exactly on it
+	panCenterDeadZone = 0.02
+)
+
+var errChannelsUnsupported = errors.New("session doesn't support setting its channels apart")
+
+// channelSession is implemented by sessions whose left and right channels can be set apart
+type channelSession interface {
+	// setChannelGains sets how loud the left and right channels are relative to the session's volume, from 0 to 1.
+	// Channels on neither side, like center and LFE, stay at the session's volume. The session's volume itself
+	// is left as it is, and later volume changes keep to the gains.
+	setChannelGains(left float32, right float32) error
+
+	// channelGains returns the gains last set, which are 1 for both channels until then
+	channelGains() (left float32, right float32)
+}
+
+// panControl handles pan: targets, which set the left/right balance of the master device or an app,
+// left: and right: targets, which set one of its sides, and channel: targets for the master device's other channels
+type panControl struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+}
+
+func newPanControl(deej *Deej, logger *zap.SugaredLogger) *panControl {
+	logger = logger.Named("pan")
+
+	pc := &panControl{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created pan control instance")
+
+	return pc
+}
+
+// initialize registers the pan:, left:, right: and channel: target prefixes
+func (pc *panControl) initialize() {
+	pc.deej.sessions.registerExternalTarget(panTargetPrefix, pc.setBalance)
+
+	pc.deej.sessions.registerExternalTarget(leftTargetPrefix, func(target string, v float32) error {
+		return pc.setChannel(target, v, true)
+	})
+
+	pc.deej.sessions.registerExternalTarget(rightTargetPrefix, func(target string, v float32) error {
+		return pc.setChannel(target, v, false)
+	})
+
+	pc.deej.sessions.registerExternalTarget(channelTargetPrefix, pc.setDeviceChannel)
+}
+
+// setBalance handles pan:<target> targets, where the middle of the slider is centered
+// and either end pans fully to that side
+func (pc *panControl) setBalance(target string, v float32) error {
+	left, right := balanceGains(sliderBalance(v))
+
+	return pc.forEachChannelSession(target, func(session Session, channels channelSession) error {
+		return channels.setChannelGains(left, right)
+	})
+}
+
+// setChannel handles left:<target> and right:<target> targets, which set one channel's volume and leave the
+// other's as it is. Since the session's volume is that of its loudest channel, it follows whichever side is
+// louder, with the quieter one's gain set to match.
+func (pc *panControl) setChannel(target string, v float32, leftSide bool) error {
+	return pc.forEachChannelSession(target, func(session Session, channels channelSession) error {
+		volume := session.GetVolume()
+		leftGain, rightGain := channels.channelGains()
+
+		leftLevel, rightLevel := volume*leftGain, volume*rightGain
+		if leftSide {
+			leftLevel = v
+		} else {
+			rightLevel = v
+		}
+
+		newVolume := pc.deej.sessions.clampVolume(session, max(leftLevel, rightLevel))
+
+		// with both channels silent, their gains are kept for when either comes back
+		if newVolume > 0 {
+			leftGain = min(1, leftLevel/newVolume)
+			rightGain = min(1, rightLevel/newVolume)
+
+			if err := channels.setChannelGains(leftGain, rightGain); err != nil {
+				return err
+			}
+		}
+
+		if newVolume == volume {
+			return nil
+		}
+
+		if err := pc.deej.sessions.setSessionVolume(session, newVolume); err != nil {
+			return err
+		}
+
+		// keeps the change from being mistaken for one made outside deej
+		pc.deej.sessions.cacheVolume(session, newVolume)
+
+		return nil
+	})
+}
+
+// forEachChannelSession calls f for each session a target resolves to, collecting errors along the way
+func (pc *panControl) forEachChannelSession(target string, f func(Session, channelSession) error) error {
+	found := false
+	var errs []error
+
+	for _, resolvedTarget := range pc.deej.sessions.resolveTarget(target) {
+		sessions, ok := pc.deej.sessions.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		for _, session := range sessions {
+			found = true
+
+			channels, ok := session.(channelSession)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: %w", session.Key(), errChannelsUnsupported))
+				continue
+			}
+
+			if err := f(session, channels); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", session.Key(), err))
+			}
+		}
+	}
+
+	if !found {
+		pc.logger.Debugw("No sessions to set channels of", "target", target)
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// sliderBalance maps a slider's value (0-1) to a balance between -1 (left) and 1 (right)
+func sliderBalance(v float32) float32 {
+	balance := v*2 - 1
+
+	if balance > -panCenterDeadZone && balance < panCenterDeadZone {
+		return 0
+	}
+
+	return balance
+}
+
+// balanceGains returns how loud the left and right channels should be, relative to the session's volume,
+// for a balance between -1 (left) and 1 (right). The side being panned towards stays at full volume.
+func balanceGains(balance float32) (left float32, right float32) {
+	left, right = 1, 1
+
+	if balance > 0 {
+		left = 1 - balance
+	} else if balance < 0 {
+		right = 1 + balance
+	}
+
+	return left, right
+}
@@ -0,0 +1,85 @@
+package deej
+
+import (
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSliderBalance(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         float32
+		wantLeft  float32
+		wantRight float32
+	}{
+		{"all the way left", 0, 1, 0},
+		{"centered", 0.5, 1, 1},
+		{"just off center", 0.505, 1, 1},
+		{"halfway right", 0.75, 0.5, 1},
+		{"all the way right", 1, 0, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			left, right := balanceGains(sliderBalance(test.v))
+
+			if left != test.wantLeft || right != test.wantRight {
+				t.Errorf("gains = %v, %v, want %v, %v", left, right, test.wantLeft, test.wantRight)
+			}
+		})
+	}
+}
+
+// fakeChannelSession is a fakeSession whose channels can be set apart
+type fakeChannelSession struct {
+	*fakeSession
+	left, right float32
+}
+
+func (s *fakeChannelSession) setChannelGains(left float32, right float32) error {
+	s.left, s.right = left, right
+	return nil
+}
+
+func (s *fakeChannelSession) channelGains() (float32, float32) {
+	return s.left, s.right
+}
+
+func TestSetChannel(t *testing.T) {
+	session := &fakeChannelSession{fakeSession: newFakeSession(masterSessionName, "1", 0.8), left: 1, right: 1}
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(session)
+
+	config := newTestConfig(map[int][]string{0: {"left:master"}, 1: {"right:master"}})
+	pc := &panControl{deej: &Deej{config: config, sessions: newTestSessionMap(t, config, finder)}, logger: zap.NewNop().Sugar()}
+
+	steps := []struct {
+		name      string
+		leftSide  bool
+		v         float32
+		wantLeft  float32
+		wantRight float32
+	}{
+		{"turning the left side down keeps the right", true, 0.4, 0.4, 0.8},
+		{"turning the right side down makes the left louder", false, 0.2, 0.4, 0.2},
+		{"turning the right side up past the left", false, 1, 0.4, 1},
+		{"left side silent", true, 0, 0, 1},
+		{"both sides silent", false, 0, 0, 0},
+	}
+
+	for _, step := range steps {
+		if err := pc.setChannel(masterSessionName, step.v, step.leftSide); err != nil {
+			t.Fatalf("%s: setChannel: %v", step.name, err)
+		}
+
+		volume := session.GetVolume()
+		left, right := volume*session.left, volume*session.right
+
+		if math.Abs(float64(left-step.wantLeft)) > 1e-6 || math.Abs(float64(right-step.wantRight)) > 1e-6 {
+			t.Errorf("%s: channels = %v, %v, want %v, %v", step.name, left, right, step.wantLeft, step.wantRight)
+		}
+	}
+}
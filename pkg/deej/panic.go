@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/omriharel/deej/pkg/deej/util"
@@ -22,11 +25,26 @@ If you've just encountered this, please contact @omriharel and attach this error
 You can also join the deej Discord server at https://discord.gg/nf88NJu.
 -----------------------------------------------------------------
 Time: %s
+Version: %s
+System: %s/%s, %s, audio backend: %s
 Panic occurred: %s
+-----------------------------------------------------------------
+Configuration:
+%s
+-----------------------------------------------------------------
+Audio sessions:
+%s
+-----------------------------------------------------------------
+Recent log lines:
+%s
+-----------------------------------------------------------------
 Stack trace:
 %s
 -----------------------------------------------------------------
 `
+
+	// gathering the crashlog's context must not hang if the crash left something locked
+	crashContextTimeout = time.Second
 )
 
 // recoverFromPanic handles application panics, logs the error, and attempts to shut down gracefully.
@@ -39,13 +57,13 @@ func (d *Deej) recoverFromPanic() {
 // handlePanic logs the panic details, writes a crash log file, and notifies the user.
 func (d *Deej) handlePanic(recoverValue interface{}) {
 	now := time.Now()
-	crashlogPath := filepath.Join(logDirectory, fmt.Sprintf(crashlogFilename, now.Format(crashlogTimestampFormat)))
+	crashlogPath := filepath.Join(LogDirectory, fmt.Sprintf(crashlogFilename, now.Format(crashlogTimestampFormat)))
 
 	// Create the crash log content.
 	crashLogContent := d.createCrashLogContent(now, recoverValue)
 
 	// Ensure the log directory exists.
-	if err := util.EnsureDirExists(logDirectory); err != nil {
+	if err := util.EnsureDirExists(LogDirectory); err != nil {
 		panic(fmt.Errorf("failed to create log directory: %w", err))
 	}
 
@@ -59,8 +77,17 @@ func (d *Deej) handlePanic(recoverValue interface{}) {
 		"crashlogPath", crashlogPath,
 		"error", recoverValue)
 
-	d.notifier.Notify("Unexpected crash occurred",
-		fmt.Sprintf("Details logged to: %s", crashlogPath))
+	d.notifier.Notify(tr("notify.crashed"), tr("notify.crashedMessage", "path", crashlogPath))
+
+	// Send the report along if the user opted in.
+	if d.config != nil && d.config.CrashReports.Upload {
+		summary := fmt.Sprintf("panic: %v", recoverValue)
+		if err := uploadCrashReport(d.config.CrashReports.DSN, d.version, summary, crashLogContent); err != nil {
+			d.logger.Warnw("Failed to upload crash report", "error", err)
+		} else {
+			d.logger.Info("Uploaded crash report")
+		}
+	}
 
 	// Attempt to shut down gracefully.
 	d.signalStop()
@@ -72,9 +99,100 @@ func (d *Deej) handlePanic(recoverValue interface{}) {
 
 // createCrashLogContent generates the formatted crash log content.
 func (d *Deej) createCrashLogContent(timestamp time.Time, recoverValue interface{}) []byte {
+	version := d.version
+	if version == "" {
+		version = "unknown"
+	}
+
 	return []byte(fmt.Sprintf(crashMessageTemplate,
 		timestamp.Format(crashlogTimestampFormat),
+		version,
+		runtime.GOOS, runtime.GOARCH, runtime.Version(), audioBackendName,
 		recoverValue,
+		d.crashConfigSummary(),
+		d.crashSessionList(),
+		strings.Join(logBreadcrumbs.recent(), ""),
 		debug.Stack(),
 	))
-}
\ No newline at end of file
+}
+
+// crashConfigSummary describes the config without anything private, like passwords or file paths
+func (d *Deej) crashConfigSummary() string {
+	if d.config == nil {
+		return "(not loaded)"
+	}
+
+	cc := d.config
+
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "COM port: %s, baud rate: %d\n", cc.ConnectionInfo.COMPort, cc.ConnectionInfo.BaudRate)
+	fmt.Fprintf(&summary, "Invert sliders: %t, noise reduction: %q\n", cc.InvertSliders, cc.NoiseReductionLevel)
+	fmt.Fprintf(&summary, "Active profile: %s (of %d)\n", cc.ActiveProfile, len(cc.Profiles)+1)
+
+	features := map[string]bool{
+		"grpc_api":       cc.GRPCInfo.Enabled,
+		"http_api":       cc.HTTPInfo.Enabled,
+		"osc":            cc.OSCInfo.Enabled,
+		"obs":            cc.OBSInfo.Enabled,
+		"duck":           cc.Ducking.enabled(),
+		"vu_meter":       cc.VUMeterInfo.Enabled,
+		"serial_capture": cc.SerialCapture.Enabled,
+		"script":         cc.ScriptPath != "",
+		"plugins":        len(cc.Plugins) > 0,
+		"hotkeys":        len(cc.Hotkeys) > 0,
+		"button_mapping": len(cc.ButtonMapping) > 0,
+	}
+
+	var enabled []string
+	for feature, on := range features {
+		if on {
+			enabled = append(enabled, feature)
+		}
+	}
+
+	sort.Strings(enabled)
+	fmt.Fprintf(&summary, "Enabled features: %s\n", strings.Join(enabled, ", "))
+
+	if cc.SliderMapping != nil {
+		mapping := sliderMapContents(cc.SliderMapping)
+
+		sliderIdxs := make([]int, 0, len(mapping))
+		for sliderIdx := range mapping {
+			sliderIdxs = append(sliderIdxs, sliderIdx)
+		}
+
+		sort.Ints(sliderIdxs)
+
+		for _, sliderIdx := range sliderIdxs {
+			fmt.Fprintf(&summary, "Slider %d: %s\n", sliderIdx, strings.Join(mapping[sliderIdx], ", "))
+		}
+	}
+
+	return strings.TrimSuffix(summary.String(), "\n")
+}
+
+// crashSessionList lists the current audio sessions, unless the crash left the session map locked
+func (d *Deej) crashSessionList() string {
+	if d.sessions == nil {
+		return "(not initialized)"
+	}
+
+	listChannel := make(chan string, 1)
+
+	// not util.Go, since a panic here can't be handed back to handlePanic while it's the one waiting on it
+	go func() {
+		var lines []string
+		for _, session := range d.sessions.snapshot() {
+			lines = append(lines, fmt.Sprint(session))
+		}
+
+		listChannel <- strings.Join(lines, "\n")
+	}()
+
+	select {
+	case list := <-listChannel:
+		return list
+	case <-time.After(crashContextTimeout):
+		return "(unavailable)"
+	}
+}
@@ -0,0 +1,135 @@
+// Package plugin defines the extension points external deej plugins can implement, along with the RPC plumbing
+// that connects them to deej.
+//
+// A plugin is a separate executable. Its main function calls Serve with the extension points it implements,
+// and deej starts it for every path listed under plugins in its config. Plugins and deej talk over RPC, so
+// a plugin crashing can't take deej down with it, and plugins don't need to be rebuilt alongside deej.
+package plugin
+
+import (
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// ProtocolVersion is bumped whenever an extension point changes incompatibly.
+// deej refuses to load plugins built for a different version.
+const ProtocolVersion = 1
+
+// Names under which each extension point is dispensed
+const (
+	InputBackendName   = "input_backend"
+	SessionBackendName = "session_backend"
+	TargetResolverName = "target_resolver"
+	NotifierName       = "notifier"
+)
+
+// Handshake is shared by deej and its plugins. The magic cookie isn't a security measure, it only keeps
+// users from running a plugin executable directly by mistake.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  ProtocolVersion,
+	MagicCookieKey:   "DEEJ_PLUGIN",
+	MagicCookieValue: "3d2c6e5a-1f0b-4f8e-9b7a-6c5d4e3f2a1b",
+}
+
+// PluginMap lists every extension point, for use by the plugin host
+var PluginMap = map[string]goplugin.Plugin{
+	InputBackendName:   &InputBackendPlugin{},
+	SessionBackendName: &SessionBackendPlugin{},
+	TargetResolverName: &TargetResolverPlugin{},
+	NotifierName:       &NotifierPlugin{},
+}
+
+// InputEventKind tells slider moves and button presses apart
+type InputEventKind int
+
+// Kinds of input events
+const (
+	SliderMove InputEventKind = iota
+	ButtonPress
+)
+
+// InputEvent is a single slider move or button press
+type InputEvent struct {
+	Kind InputEventKind
+
+	// ID is the slider or button index, as used by slider_mapping and button_mapping
+	ID int
+
+	// Value is the slider's new position between 0 and 1. It's unused for button presses.
+	Value float32
+}
+
+// InputBackend provides slider moves and button presses from hardware other than deej's serial board,
+// e.g. a MIDI controller
+type InputBackend interface {
+	// NextEvent blocks until the next slider move or button press
+	NextEvent() (InputEvent, error)
+}
+
+// SessionInfo describes an audio session provided by a SessionBackend
+type SessionInfo struct {
+	// Key is the name the session is addressed by in slider_mapping. It's case-insensitive.
+	Key    string
+	Volume float32
+	Muted  bool
+}
+
+// SessionBackend provides audio sessions that deej can't see on its own, e.g. channels of a hardware mixer
+type SessionBackend interface {
+	// Sessions lists all current sessions. deej calls it whenever it refreshes its own sessions.
+	Sessions() ([]SessionInfo, error)
+
+	// SetVolume sets the volume of the session with the given key, between 0 and 1
+	SetVolume(key string, v float32) error
+
+	// SetMute mutes or unmutes the session with the given key
+	SetMute(key string, m bool) error
+}
+
+// TargetResolver adds slider_mapping targets of the form "<prefix>:<name>", which expand to any number of sessions
+type TargetResolver interface {
+	// Prefix returns the target prefix the resolver handles, e.g. "game" for game:current
+	Prefix() (string, error)
+
+	// Resolve returns the keys of the sessions the target with the given name (the part after the prefix)
+	// currently refers to
+	Resolve(name string) ([]string, error)
+}
+
+// Notifier delivers deej's notifications somewhere other than the desktop, e.g. to a phone
+type Notifier interface {
+	Notify(title, message string) error
+}
+
+// Plugins groups the extension points a plugin implements. Leave the ones it doesn't implement nil.
+type Plugins struct {
+	InputBackend   InputBackend
+	SessionBackend SessionBackend
+	TargetResolver TargetResolver
+	Notifier       Notifier
+}
+
+// Serve runs the plugin until deej stops it. Call it from the plugin's main function.
+func Serve(plugins Plugins) {
+	pluginSet := goplugin.PluginSet{}
+
+	if plugins.InputBackend != nil {
+		pluginSet[InputBackendName] = &InputBackendPlugin{Impl: plugins.InputBackend}
+	}
+
+	if plugins.SessionBackend != nil {
+		pluginSet[SessionBackendName] = &SessionBackendPlugin{Impl: plugins.SessionBackend}
+	}
+
+	if plugins.TargetResolver != nil {
+		pluginSet[TargetResolverName] = &TargetResolverPlugin{Impl: plugins.TargetResolver}
+	}
+
+	if plugins.Notifier != nil {
+		pluginSet[NotifierName] = &NotifierPlugin{Impl: plugins.Notifier}
+	}
+
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         pluginSet,
+	})
+}
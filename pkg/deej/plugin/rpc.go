@@ -0,0 +1,193 @@
+package plugin
+
+import (
+	"net/rpc"
+
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// Each extension point has a goplugin.Plugin that hands out both sides of the connection: an RPC server
+// wrapping the plugin's implementation, and a client implementing the same interface for deej to call.
+// net/rpc methods take a single argument, so methods with several parameters get an args struct.
+
+// InputBackendPlugin connects an InputBackend to deej
+type InputBackendPlugin struct {
+	Impl InputBackend
+}
+
+// Server implements goplugin.Plugin
+func (p *InputBackendPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &inputBackendServer{impl: p.Impl}, nil
+}
+
+// Client implements goplugin.Plugin
+func (p *InputBackendPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &inputBackendClient{client: client}, nil
+}
+
+type inputBackendServer struct {
+	impl InputBackend
+}
+
+func (s *inputBackendServer) NextEvent(_ interface{}, reply *InputEvent) error {
+	event, err := s.impl.NextEvent()
+	*reply = event
+	return err
+}
+
+type inputBackendClient struct {
+	client *rpc.Client
+}
+
+func (c *inputBackendClient) NextEvent() (InputEvent, error) {
+	var event InputEvent
+	err := c.client.Call("Plugin.NextEvent", new(interface{}), &event)
+	return event, err
+}
+
+// SessionBackendPlugin connects a SessionBackend to deej
+type SessionBackendPlugin struct {
+	Impl SessionBackend
+}
+
+// Server implements goplugin.Plugin
+func (p *SessionBackendPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &sessionBackendServer{impl: p.Impl}, nil
+}
+
+// Client implements goplugin.Plugin
+func (p *SessionBackendPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &sessionBackendClient{client: client}, nil
+}
+
+// SetVolumeArgs carries the arguments of SessionBackend.SetVolume
+type SetVolumeArgs struct {
+	Key    string
+	Volume float32
+}
+
+// SetMuteArgs carries the arguments of SessionBackend.SetMute
+type SetMuteArgs struct {
+	Key   string
+	Muted bool
+}
+
+type sessionBackendServer struct {
+	impl SessionBackend
+}
+
+func (s *sessionBackendServer) Sessions(_ interface{}, reply *[]SessionInfo) error {
+	sessions, err := s.impl.Sessions()
+	*reply = sessions
+	return err
+}
+
+func (s *sessionBackendServer) SetVolume(args SetVolumeArgs, _ *interface{}) error {
+	return s.impl.SetVolume(args.Key, args.Volume)
+}
+
+func (s *sessionBackendServer) SetMute(args SetMuteArgs, _ *interface{}) error {
+	return s.impl.SetMute(args.Key, args.Muted)
+}
+
+type sessionBackendClient struct {
+	client *rpc.Client
+}
+
+func (c *sessionBackendClient) Sessions() ([]SessionInfo, error) {
+	var sessions []SessionInfo
+	err := c.client.Call("Plugin.Sessions", new(interface{}), &sessions)
+	return sessions, err
+}
+
+func (c *sessionBackendClient) SetVolume(key string, v float32) error {
+	return c.client.Call("Plugin.SetVolume", SetVolumeArgs{Key: key, Volume: v}, new(interface{}))
+}
+
+func (c *sessionBackendClient) SetMute(key string, m bool) error {
+	return c.client.Call("Plugin.SetMute", SetMuteArgs{Key: key, Muted: m}, new(interface{}))
+}
+
+// TargetResolverPlugin connects a TargetResolver to deej
+type TargetResolverPlugin struct {
+	Impl TargetResolver
+}
+
+// Server implements goplugin.Plugin
+func (p *TargetResolverPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &targetResolverServer{impl: p.Impl}, nil
+}
+
+// Client implements goplugin.Plugin
+func (p *TargetResolverPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &targetResolverClient{client: client}, nil
+}
+
+type targetResolverServer struct {
+	impl TargetResolver
+}
+
+func (s *targetResolverServer) Prefix(_ interface{}, reply *string) error {
+	prefix, err := s.impl.Prefix()
+	*reply = prefix
+	return err
+}
+
+func (s *targetResolverServer) Resolve(name string, reply *[]string) error {
+	keys, err := s.impl.Resolve(name)
+	*reply = keys
+	return err
+}
+
+type targetResolverClient struct {
+	client *rpc.Client
+}
+
+func (c *targetResolverClient) Prefix() (string, error) {
+	var prefix string
+	err := c.client.Call("Plugin.Prefix", new(interface{}), &prefix)
+	return prefix, err
+}
+
+func (c *targetResolverClient) Resolve(name string) ([]string, error) {
+	var keys []string
+	err := c.client.Call("Plugin.Resolve", name, &keys)
+	return keys, err
+}
+
+// NotifierPlugin connects a Notifier to deej
+type NotifierPlugin struct {
+	Impl Notifier
+}
+
+// Server implements goplugin.Plugin
+func (p *NotifierPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &notifierServer{impl: p.Impl}, nil
+}
+
+// Client implements goplugin.Plugin
+func (p *NotifierPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (interface{}, error) {
+	return &notifierClient{client: client}, nil
+}
+
+// NotifyArgs carries the arguments of Notifier.Notify
+type NotifyArgs struct {
+	Title   string
+	Message string
+}
+
+type notifierServer struct {
+	impl Notifier
+}
+
+func (s *notifierServer) Notify(args NotifyArgs, _ *interface{}) error {
+	return s.impl.Notify(args.Title, args.Message)
+}
+
+type notifierClient struct {
+	client *rpc.Client
+}
+
+func (c *notifierClient) Notify(title, message string) error {
+	return c.client.Call("Plugin.Notify", NotifyArgs{Title: title, Message: message}, new(interface{}))
+}
@@ -0,0 +1,306 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/plugin"
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// how long to wait before asking a plugin for input again after it failed to provide it
+const pluginInputRetryDelay = time.Second
+
+// pluginHost starts the plugin executables listed in the config and connects whichever extension points
+// each of them implements (see the plugin package). Changes to the plugin list take effect on the next start.
+type pluginHost struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	clients []*goplugin.Client
+}
+
+func newPluginHost(deej *Deej, logger *zap.SugaredLogger) *pluginHost {
+	logger = logger.Named("plugins")
+
+	ph := &pluginHost{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created plugin host instance")
+
+	return ph
+}
+
+// initialize starts all configured plugins
+func (ph *pluginHost) initialize() {
+	for _, path := range ph.deej.config.Plugins {
+		if err := ph.load(path); err != nil {
+			ph.logger.Warnw("Failed to load plugin", "path", path, "error", err)
+			ph.deej.notifier.Notify(tr("notify.pluginFailed"), tr("notify.pluginFailedMessage", "plugin", filepath.Base(path)))
+		}
+	}
+}
+
+// stop shuts down all plugin processes, which ends their input loops
+func (ph *pluginHost) stop() {
+	for _, client := range ph.clients {
+		client.Kill()
+	}
+}
+
+func (ph *pluginHost) load(path string) error {
+	if !util.FileExists(path) {
+		return fmt.Errorf("plugin not found: %s", path)
+	}
+
+	logger := ph.logger.With("plugin", filepath.Base(path))
+
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  plugin.Handshake,
+		Plugins:          plugin.PluginMap,
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolNetRPC},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   "plugin",
+			Level:  hclog.Info,
+			Output: &pluginLogWriter{logger: logger},
+		}),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("start plugin: %w", err)
+	}
+
+	ph.clients = append(ph.clients, client)
+
+	var connected []string
+
+	for name := range plugin.PluginMap {
+		raw, err := rpcClient.Dispense(name)
+		if err != nil {
+			logger.Debugw("Plugin doesn't provide extension point", "extensionPoint", name, "error", err)
+			continue
+		}
+
+		if err := ph.connect(logger, client, name, raw); err != nil {
+			logger.Warnw("Failed to connect plugin extension point", "extensionPoint", name, "error", err)
+			continue
+		}
+
+		connected = append(connected, name)
+	}
+
+	logger.Infow("Loaded plugin", "extensionPoints", connected)
+
+	return nil
+}
+
+func (ph *pluginHost) connect(logger *zap.SugaredLogger, client *goplugin.Client, name string, raw interface{}) error {
+	switch name {
+	case plugin.InputBackendName:
+		backend := raw.(plugin.InputBackend)
+		ph.deej.spawn(func(ctx context.Context) error {
+			ph.readInput(ctx, logger, client, backend)
+			return nil
+		})
+
+	case plugin.SessionBackendName:
+		ph.deej.sessions.registerSessionFinder(&pluginSessionFinder{
+			logger:  logger,
+			backend: raw.(plugin.SessionBackend),
+		})
+
+	case plugin.TargetResolverName:
+		resolver := raw.(plugin.TargetResolver)
+
+		prefix, err := resolver.Prefix()
+		if err != nil {
+			return fmt.Errorf("get target prefix: %w", err)
+		}
+
+		ph.deej.sessions.registerTargetResolver(prefix, func(name string) []string {
+			keys, err := resolver.Resolve(name)
+			if err != nil {
+				logger.Warnw("Plugin failed to resolve target", "prefix", prefix, "name", name, "error", err)
+				return nil
+			}
+
+			return keys
+		})
+
+	case plugin.NotifierName:
+		ph.deej.notifier.add(&pluginNotifier{
+			logger:   logger,
+			notifier: raw.(plugin.Notifier),
+		})
+	}
+
+	return nil
+}
+
+// readInput passes the plugin's slider moves and button presses along as if they came from the serial port
+func (ph *pluginHost) readInput(ctx context.Context, logger *zap.SugaredLogger, client *goplugin.Client, backend plugin.InputBackend) {
+	for {
+		event, err := backend.NextEvent()
+
+		// the plugin is killed on shutdown, failing whichever call was pending
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			if client.Exited() {
+				logger.Warnw("Plugin exited, no longer reading its input")
+				return
+			}
+
+			logger.Warnw("Failed to read plugin input", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pluginInputRetryDelay):
+			}
+
+			continue
+		}
+
+		switch event.Kind {
+		case plugin.SliderMove:
+			value := event.Value
+			if value < 0 {
+				value = 0
+			} else if value > 1 {
+				value = 1
+			}
+
+			ph.deej.serial.notifySliderMove(SliderMoveEvent{SliderID: event.ID, PercentValue: value})
+
+		case plugin.ButtonPress:
+			ph.deej.serial.notifyButtonPress(ButtonPressEvent{ButtonID: event.ID})
+
+		default:
+			logger.Debugw("Ignoring unknown input event", "kind", event.Kind)
+		}
+	}
+}
+
+// pluginSessionFinder adds a plugin's sessions to the session map
+type pluginSessionFinder struct {
+	logger  *zap.SugaredLogger
+	backend plugin.SessionBackend
+}
+
+func (psf *pluginSessionFinder) GetAllSessions() ([]Session, error) {
+	infos, err := psf.backend.Sessions()
+	if err != nil {
+		return nil, fmt.Errorf("get plugin sessions: %w", err)
+	}
+
+	sessions := make([]Session, len(infos))
+	for i, info := range infos {
+		sessions[i] = &pluginSession{
+			logger:  psf.logger,
+			backend: psf.backend,
+			key:     info.Key,
+			volume:  info.Volume,
+			muted:   info.Muted,
+		}
+	}
+
+	return sessions, nil
+}
+
+// Release is a no-op, the plugin host takes care of the plugin process
+func (psf *pluginSessionFinder) Release() error {
+	return nil
+}
+
+// pluginSession is a session provided by a plugin. Its volume and mute state are those reported
+// when sessions were last refreshed, or last set by deej since.
+type pluginSession struct {
+	logger  *zap.SugaredLogger
+	backend plugin.SessionBackend
+
+	// the key as reported by the plugin, which is what it expects back
+	key    string
+	volume float32
+	muted  bool
+}
+
+func (s *pluginSession) GetVolume() float32 {
+	return s.volume
+}
+
+func (s *pluginSession) SetVolume(v float32) error {
+	if err := s.backend.SetVolume(s.key, v); err != nil {
+		return fmt.Errorf("set plugin session volume: %w", err)
+	}
+
+	s.volume = v
+	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v), "session", s.key)
+
+	return nil
+}
+
+func (s *pluginSession) GetMute() bool {
+	return s.muted
+}
+
+func (s *pluginSession) SetMute(m bool) error {
+	if err := s.backend.SetMute(s.key, m); err != nil {
+		return fmt.Errorf("set plugin session mute: %w", err)
+	}
+
+	s.muted = m
+	return nil
+}
+
+func (s *pluginSession) Key() string {
+	return strings.ToLower(s.key)
+}
+
+// ID is always empty, so every refresh picks up the volume and mute state the plugin reports
+func (s *pluginSession) ID() string {
+	return ""
+}
+
+func (s *pluginSession) Release() {}
+
+func (s *pluginSession) String() string {
+	return fmt.Sprintf(sessionStringFormat, s.key, s.volume)
+}
+
+// pluginNotifier adapts a plugin's notifier, logging failures since Notifier can't return them
+type pluginNotifier struct {
+	logger   *zap.SugaredLogger
+	notifier plugin.Notifier
+}
+
+func (pn *pluginNotifier) Notify(title, message string) {
+	if err := pn.notifier.Notify(title, message); err != nil {
+		pn.logger.Warnw("Plugin failed to send notification", "title", title, "error", err)
+	}
+}
+
+// pluginLogWriter forwards the plugin's log output, and go-plugin's own, to deej's log
+type pluginLogWriter struct {
+	logger *zap.SugaredLogger
+}
+
+func (w *pluginLogWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package deej
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// how long to give USB devices to come back after waking up before reopening the serial port
+	resumeReconnectDelay = 2 * time.Second
+
+	// how many times to try reopening the serial port after waking up, resumeReconnectDelay apart
+	resumeReconnectAttempts = 5
+)
+
+type powerEvent int
+
+const (
+	powerSuspend powerEvent = iota
+	powerResume
+)
+
+// powerListener receives suspend and resume notifications from the OS
+type powerListener interface {
+	// listen calls onEvent right before the system goes to sleep and after it wakes up, until stop is called.
+	// onEvent may be called from any goroutine.
+	listen(onEvent func(powerEvent)) error
+	stop()
+}
+
+// powerWatcher closes the serial port before the system sleeps, and reopens it and re-acquires audio sessions
+// once it wakes up. Otherwise sliders stay dead after waking up, since the board and audio devices were
+// re-enumerated in the meantime.
+type powerWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	events   chan powerEvent
+	listener powerListener
+}
+
+func newPowerWatcher(deej *Deej, logger *zap.SugaredLogger) *powerWatcher {
+	logger = logger.Named("power")
+
+	pw := &powerWatcher{
+		deej:   deej,
+		logger: logger,
+		events: make(chan powerEvent, 1),
+	}
+
+	logger.Debug("Created power watcher instance")
+
+	return pw
+}
+
+// start listens for suspend and resume notifications, if the OS provides them
+func (pw *powerWatcher) start() {
+	listener := newPowerListener(pw.logger, pw.deej.handlePanic)
+
+	onEvent := func(event powerEvent) {
+		// a suspend and resume in quick succession only need the resume handled
+		select {
+		case pw.events <- event:
+		default:
+			select {
+			case <-pw.events:
+			default:
+			}
+
+			pw.events <- event
+		}
+	}
+
+	if err := listener.listen(onEvent); err != nil {
+		pw.logger.Warnw("Failed to listen for suspend and resume, sliders may stop working after sleep", "error", err)
+		return
+	}
+
+	pw.listener = listener
+	pw.logger.Debug("Listening for suspend and resume")
+
+	pw.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-pw.events:
+				switch event {
+				case powerSuspend:
+					pw.handleSuspend()
+				case powerResume:
+					pw.handleResume(ctx)
+				}
+			}
+		}
+	})
+}
+
+func (pw *powerWatcher) stop() {
+	if pw.listener == nil {
+		return
+	}
+
+	pw.listener.stop()
+	pw.listener = nil
+}
+
+func (pw *powerWatcher) handleSuspend() {
+	pw.logger.Info("System is going to sleep, closing serial connection")
+	pw.deej.serial.Stop()
+}
+
+func (pw *powerWatcher) handleResume(ctx context.Context) {
+	pw.logger.Info("System woke up, reconnecting")
+
+	// the old connection is most likely dead even if it wasn't closed before sleeping
+	pw.deej.serial.Stop()
+
+	for attempt := 1; attempt <= resumeReconnectAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resumeReconnectDelay):
+		}
+
+		err := pw.deej.serial.Start()
+		if err == nil {
+			break
+		}
+
+		pw.logger.Debugw("Failed to reopen serial connection after waking up", "attempt", attempt, "error", err)
+
+		if attempt == resumeReconnectAttempts {
+			pw.logger.Warnw("Giving up on reopening serial connection after waking up", "error", err)
+			pw.deej.notifier.Notify(tr("notify.resumeFailed"),
+				tr("notify.resumeFailedMessage", "port", failedSerialPorts(err)))
+		}
+	}
+
+	// audio devices are re-enumerated on wake, which leaves the sessions acquired before sleeping stale
+	pw.deej.sessions.refreshSessions(true)
+}
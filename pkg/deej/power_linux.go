@@ -0,0 +1,84 @@
+package deej
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	logindPath      = "/org/freedesktop/login1"
+	logindInterface = "org.freedesktop.login1.Manager"
+	logindSleep     = "PrepareForSleep"
+)
+
+// logindPowerListener follows logind's PrepareForSleep signal, which it sends with true before sleeping
+// and with false after waking up
+type logindPowerListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	conn *dbus.Conn
+	done chan struct{}
+}
+
+func newPowerListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) powerListener {
+	return &logindPowerListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *logindPowerListener) listen(onEvent func(powerEvent)) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("connect to system bus: %w", err)
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindInterface),
+		dbus.WithMatchMember(logindSleep),
+	); err != nil {
+		conn.Close()
+		return fmt.Errorf("subscribe to %s: %w", logindSleep, err)
+	}
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+
+	l.conn = conn
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+
+		// closing the connection closes the channel
+		for signal := range signals {
+			if signal.Name != logindInterface+"."+logindSleep || len(signal.Body) != 1 {
+				continue
+			}
+
+			sleeping, ok := signal.Body[0].(bool)
+			if !ok {
+				continue
+			}
+
+			if sleeping {
+				onEvent(powerSuspend)
+			} else {
+				onEvent(powerResume)
+			}
+		}
+	})
+
+	return nil
+}
+
+func (l *logindPowerListener) stop() {
+	if err := l.conn.Close(); err != nil {
+		l.logger.Debugw("Failed to close system bus connection", "error", err)
+	}
+
+	<-l.done
+}
@@ -0,0 +1,112 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// values from WinUser.h, as delivered with WM_POWERBROADCAST
+const (
+	deviceNotifyCallback  = 2
+	pbtAPMSuspend         = 0x4
+	pbtAPMResumeAutomatic = 0x12
+)
+
+var (
+	powrprof                                     = syscall.NewLazyDLL("powrprof.dll")
+	procPowerRegisterSuspendResumeNotification   = powrprof.NewProc("PowerRegisterSuspendResumeNotification")
+	procPowerUnregisterSuspendResumeNotification = powrprof.NewProc("PowerUnregisterSuspendResumeNotification")
+
+	// Windows never frees callbacks, so every listener shares this one and finds its handler through powerHandlers
+	powerCallback = syscall.NewCallback(powerNotificationCallback)
+
+	powerHandlersLock sync.Mutex
+	powerHandlers     = make(map[uintptr]func(powerEvent))
+	nextPowerHandler  uintptr
+)
+
+// deviceNotifySubscribeParameters mirrors DEVICE_NOTIFY_SUBSCRIBE_PARAMETERS
+type deviceNotifySubscribeParameters struct {
+	callback uintptr
+	context  uintptr
+}
+
+// windowsPowerListener receives the PBT_* events otherwise sent with WM_POWERBROADCAST, without needing a window
+type windowsPowerListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	params       *deviceNotifySubscribeParameters
+	registration uintptr
+}
+
+func newPowerListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) powerListener {
+	return &windowsPowerListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *windowsPowerListener) listen(onEvent func(powerEvent)) error {
+	powerHandlersLock.Lock()
+	nextPowerHandler++
+	id := nextPowerHandler
+	powerHandlers[id] = func(event powerEvent) {
+		defer util.Recover(l.onPanic)
+		onEvent(event)
+	}
+	powerHandlersLock.Unlock()
+
+	l.params = &deviceNotifySubscribeParameters{callback: powerCallback, context: id}
+
+	result, _, _ := procPowerRegisterSuspendResumeNotification.Call(
+		deviceNotifyCallback,
+		uintptr(unsafe.Pointer(l.params)),
+		uintptr(unsafe.Pointer(&l.registration)),
+	)
+
+	if result != 0 {
+		l.forget()
+		return fmt.Errorf("register for suspend and resume notifications: %w", syscall.Errno(result))
+	}
+
+	return nil
+}
+
+func (l *windowsPowerListener) stop() {
+	if result, _, _ := procPowerUnregisterSuspendResumeNotification.Call(l.registration); result != 0 {
+		l.logger.Debugw("Failed to unregister from suspend and resume notifications", "error", syscall.Errno(result))
+	}
+
+	l.forget()
+}
+
+func (l *windowsPowerListener) forget() {
+	powerHandlersLock.Lock()
+	delete(powerHandlers, l.params.context)
+	powerHandlersLock.Unlock()
+}
+
+// powerNotificationCallback implements DeviceNotifyCallbackRoutine. Windows also sends PBT_APMRESUMESUSPEND
+// when a user wakes the system up, but PBT_APMRESUMEAUTOMATIC comes with every resume.
+func powerNotificationCallback(context uintptr, eventType uintptr, setting uintptr) uintptr {
+	powerHandlersLock.Lock()
+	onEvent := powerHandlers[context]
+	powerHandlersLock.Unlock()
+
+	if onEvent == nil {
+		return 0
+	}
+
+	switch eventType {
+	case pbtAPMSuspend:
+		onEvent(powerSuspend)
+	case pbtAPMResumeAutomatic:
+		onEvent(powerResume)
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// snapshotVolumes returns the current volume of every session, by key. Sessions that share a key
+// (e.g. several chrome.exe processes) are all set to one volume by a slider, so the first one's is used.
+func (m *sessionMap) snapshotVolumes() map[string]float32 {
+	volumes := make(map[string]float32)
+
+	for _, session := range m.snapshot() {
+		if _, ok := volumes[session.Key()]; !ok {
+			volumes[session.Key()] = session.GetVolume()
+		}
+	}
+
+	return volumes
+}
+
+// savePreset saves the current volume of every session as the named preset, returning the saved volumes
+func (d *Deej) savePreset(name string) (map[string]float32, error) {
+	volumes := d.sessions.snapshotVolumes()
+	if len(volumes) == 0 {
+		return nil, errors.New("no audio sessions to save")
+	}
+
+	if err := d.config.SavePreset(name, volumes); err != nil {
+		return nil, fmt.Errorf("save preset %s: %w", name, err)
+	}
+
+	return volumes, nil
+}
+
+// restorePreset sets every target in the named preset to its saved volume, returning the keys of the sessions
+// that were adjusted. Targets without sessions right now are skipped.
+func (d *Deej) restorePreset(name string) ([]string, error) {
+	volumes, ok := d.config.Presets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset: %s", name)
+	}
+
+	var adjusted []string
+
+	for target, volume := range volumes {
+		keys, err := d.sessions.setTargetVolume(target, volume)
+		if err != nil {
+			d.logger.Warnw("Failed to restore preset volume", "preset", name, "target", target, "error", err)
+			continue
+		}
+
+		adjusted = append(adjusted, keys...)
+	}
+
+	sort.Strings(adjusted)
+
+	d.logger.Infow("Restored volume preset", "preset", name, "adjusted", adjusted)
+
+	return adjusted, nil
+}
+
+// presetNames returns the names of the saved presets, sorted
+func (d *Deej) presetNames() []string {
+	names := make([]string, 0, len(d.config.Presets))
+	for name := range d.config.Presets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
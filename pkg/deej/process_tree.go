@@ -0,0 +1,85 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// how far up the process tree to look for the app a helper process belongs to
+const maxParentProcessDepth = 8
+
+// processes everything else descends from, which no helper process belongs to in any useful sense
+var rootProcessNames = map[string]bool{
+	"system":            true,
+	"smss.exe":          true,
+	"csrss.exe":         true,
+	"wininit.exe":       true,
+	"winlogon.exe":      true,
+	"services.exe":      true,
+	"svchost.exe":       true,
+	"userinit.exe":      true,
+	"explorer.exe":      true,
+	"sihost.exe":        true,
+	"runtimebroker.exe": true,
+	"cmd.exe":           true,
+	"conhost.exe":       true,
+	"powershell.exe":    true,
+	"pwsh.exe":          true,
+}
+
+// processSession is implemented by sessions that belong to a process, so they can also be targeted by the name
+// of the app that started it (see match_child_processes)
+type processSession interface {
+	processID() int
+}
+
+// findParentKeys returns, for each session's process, the names of the processes that started it, nearest first.
+// Sessions whose process is only started by the shell, or that don't belong to a process, are left out.
+func findParentKeys(sessions []Session) (map[int][]string, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("list processes: %w", err)
+	}
+
+	byPID := make(map[int]ps.Process, len(processes))
+	for _, process := range processes {
+		byPID[process.Pid()] = process
+	}
+
+	parentKeys := make(map[int][]string)
+
+	for _, session := range sessions {
+		withProcess, ok := session.(processSession)
+		if !ok {
+			continue
+		}
+
+		pid := withProcess.processID()
+		if _, done := parentKeys[pid]; done {
+			continue
+		}
+
+		seen := map[int]bool{pid: true}
+		process := byPID[pid]
+
+		for depth := 0; process != nil && depth < maxParentProcessDepth; depth++ {
+			parent, ok := byPID[process.PPid()]
+			if !ok || seen[parent.Pid()] {
+				break
+			}
+
+			name := strings.ToLower(parent.Executable())
+			if rootProcessNames[name] {
+				break
+			}
+
+			seen[parent.Pid()] = true
+			parentKeys[pid] = append(parentKeys[pid], name)
+			process = parent
+		}
+	}
+
+	return parentKeys, nil
+}
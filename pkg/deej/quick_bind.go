@@ -0,0 +1,231 @@
+package deej
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thoas/go-funk"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// how long bind mode waits for a slider to move before giving up
+const quickBindTimeout = 15 * time.Second
+
+// quickBinder tells the user about audio apps that no slider controls yet, and lets them bind one by
+// moving the slider that should control it (see notify_unmapped_sessions)
+type quickBinder struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// unmapped session keys that were already announced (or there from the start), so each is only announced once
+	seen map[string]bool
+
+	// the most recently announced unmapped app, offered in the tray menu, and the app bind mode is capturing a
+	// slider for. either is empty when there's none
+	pending string
+	binding string
+
+	bindTimer *time.Timer
+
+	// called whenever the pending app changes, to update the tray menu
+	onPendingChange func(key string)
+}
+
+func newQuickBinder(deej *Deej, logger *zap.SugaredLogger) *quickBinder {
+	logger = logger.Named("quick_bind")
+
+	qb := &quickBinder{
+		deej:   deej,
+		logger: logger,
+		seen:   make(map[string]bool),
+	}
+
+	logger.Debug("Created quick binder instance")
+
+	return qb
+}
+
+// attach sets up the tray menu's bind item. Without one there's no way to enter bind mode, so apps aren't announced.
+func (qb *quickBinder) attach(onPendingChange func(key string)) {
+	qb.lock.Lock()
+	defer qb.lock.Unlock()
+
+	qb.onPendingChange = onPendingChange
+}
+
+// start begins watching for unmapped apps. Apps that are already running aren't announced.
+func (qb *quickBinder) start() {
+	sessionChangesChannel := qb.deej.events.sessionsChanged.subscribe()
+	qb.deej.sessions.registerSliderMoveHandler(qb.handleSliderMove)
+
+	qb.lock.Lock()
+	for _, key := range qb.deej.sessions.getUnmappedSessionKeys() {
+		qb.seen[key] = true
+	}
+	qb.lock.Unlock()
+
+	qb.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				qb.cancel()
+				return nil
+			case <-sessionChangesChannel:
+				qb.checkUnmapped()
+			}
+		}
+	})
+}
+
+// checkUnmapped announces unmapped apps that weren't seen before, and forgets the pending app once it's mapped
+func (qb *quickBinder) checkUnmapped() {
+	unmapped := qb.deej.sessions.getUnmappedSessionKeys()
+
+	qb.lock.Lock()
+
+	var added []string
+	for _, key := range unmapped {
+		if !qb.seen[key] {
+			qb.seen[key] = true
+			added = append(added, key)
+		}
+	}
+
+	if qb.pending != "" && !funk.ContainsString(unmapped, qb.pending) {
+		qb.setPending("")
+	}
+
+	announce := len(added) > 0 && qb.deej.config.NotifyUnmapped && qb.onPendingChange != nil
+	if announce {
+		// only the newest app can be offered in the tray menu, but each one is announced
+		qb.setPending(added[len(added)-1])
+	}
+
+	qb.lock.Unlock()
+
+	if !announce {
+		return
+	}
+
+	for _, key := range added {
+		qb.logger.Infow("New unmapped audio app", "key", key)
+		qb.deej.notifier.Notify(tr("notify.newApp", "app", key), tr("notify.newAppMessage", "app", key))
+	}
+}
+
+// begin enters bind mode for the pending app, so the next slider moved gets bound to it
+func (qb *quickBinder) begin() {
+	qb.lock.Lock()
+
+	if qb.pending == "" {
+		qb.lock.Unlock()
+		return
+	}
+
+	key := qb.pending
+	qb.binding = key
+
+	if qb.bindTimer != nil {
+		qb.bindTimer.Stop()
+	}
+
+	qb.bindTimer = time.AfterFunc(quickBindTimeout, func() {
+		defer util.Recover(qb.deej.handlePanic)
+
+		qb.lock.Lock()
+		expired := qb.binding == key
+		if expired {
+			qb.binding = ""
+		}
+		qb.lock.Unlock()
+
+		if expired {
+			qb.logger.Debugw("No slider moved, leaving bind mode", "key", key)
+			qb.deej.notifier.Notify(tr("notify.bindTimeout", "app", key), tr("notify.bindTimeoutMessage"))
+		}
+	})
+
+	qb.lock.Unlock()
+
+	qb.logger.Infow("Entered bind mode", "key", key)
+	qb.deej.notifier.Notify(tr("notify.bindWaiting", "app", key),
+		tr("notify.bindWaitingMessage", "seconds", int(quickBindTimeout.Seconds())))
+}
+
+// handleSliderMove captures the slider while in bind mode, instead of it changing any volumes
+func (qb *quickBinder) handleSliderMove(event SliderMoveEvent) bool {
+	qb.lock.Lock()
+	defer qb.lock.Unlock()
+
+	if qb.binding == "" {
+		return false
+	}
+
+	key := qb.binding
+	qb.binding = ""
+	qb.bindTimer.Stop()
+
+	if qb.pending == key {
+		qb.setPending("")
+	}
+
+	// the config file is written outside the slider move path
+	util.Go(qb.deej.handlePanic, func() {
+		qb.bind(key, event.SliderID)
+	})
+
+	return true
+}
+
+// bind adds an app to a slider's targets in the active profile, saving it to the config file
+func (qb *quickBinder) bind(key string, sliderIdx int) {
+	config := qb.deej.config
+
+	mapping := make(map[int][]string)
+	config.SliderMapping.iterate(func(idx int, targets []string) {
+		mapping[idx] = append([]string{}, targets...)
+	})
+
+	if !funk.ContainsString(mapping[sliderIdx], key) {
+		mapping[sliderIdx] = append(mapping[sliderIdx], key)
+	}
+
+	if err := config.SaveSliderMapping(config.ActiveProfile, mapping); err != nil {
+		qb.logger.Warnw("Failed to save slider mapping", "key", key, "slider", sliderIdx, "error", err)
+		qb.deej.notifier.Notify(tr("notify.bindFailed", "app", key), tr("notify.moreDetails"))
+		return
+	}
+
+	slider := tr("notify.slider", "index", sliderIdx)
+	if name, ok := config.SliderNames[sliderIdx]; ok {
+		slider = tr("notify.namedSlider", "index", sliderIdx, "name", name)
+	}
+
+	qb.logger.Infow("Bound app to slider", "key", key, "slider", sliderIdx)
+	qb.deej.notifier.Notify(tr("notify.bound", "app", key), tr("notify.boundMessage", "slider", slider))
+}
+
+// cancel leaves bind mode without binding anything
+func (qb *quickBinder) cancel() {
+	qb.lock.Lock()
+	defer qb.lock.Unlock()
+
+	qb.binding = ""
+	if qb.bindTimer != nil {
+		qb.bindTimer.Stop()
+	}
+}
+
+// setPending changes the app offered in the tray menu. Call with lock held.
+func (qb *quickBinder) setPending(key string) {
+	qb.pending = key
+
+	if qb.onPendingChange != nil {
+		qb.onPendingChange(key)
+	}
+}
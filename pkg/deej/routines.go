@@ -0,0 +1,56 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// routineGroup runs the goroutines that share deej's lifetime. Components that only need to start background work
+// take one of these rather than the whole Deej.
+type routineGroup struct {
+	ctx     context.Context // done once deej starts shutting down
+	cancel  context.CancelFunc
+	group   *errgroup.Group
+	onPanic func(recoverValue interface{})
+}
+
+func newRoutineGroup(onPanic func(recoverValue interface{})) *routineGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
+
+	return &routineGroup{
+		ctx:     ctx,
+		cancel:  cancel,
+		group:   group,
+		onPanic: onPanic,
+	}
+}
+
+// spawn runs f on a background goroutine that lives until deej shuts down. f must return once ctx is done,
+// since shutdown waits for it. Returning an error shuts deej down.
+func (rg *routineGroup) spawn(f func(ctx context.Context) error) {
+	rg.group.Go(func() error {
+		defer util.Recover(rg.onPanic)
+		return f(rg.ctx)
+	})
+}
+
+// wait waits for everything started with spawn to return, up to the given timeout
+func (rg *routineGroup) wait(timeout time.Duration) error {
+	done := make(chan error, 1)
+	util.Go(rg.onPanic, func() {
+		done <- rg.group.Wait()
+	})
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errors.New("timed out waiting for background goroutines")
+	}
+}
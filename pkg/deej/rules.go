@@ -0,0 +1,242 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// how often rules are checked for starting or ending
+const ruleCheckInterval = 30 * time.Second
+
+// VolumeRule caps or mutes targets during a daily time window, e.g. capping master at 40% late at night
+type VolumeRule struct {
+	Name    string
+	Targets []string
+
+	// the window, as time since midnight. windows with After later than Before span midnight
+	After  time.Duration
+	Before time.Duration
+
+	// the days the window starts on, or nil for every day
+	Days map[time.Weekday]bool
+
+	// MaxVolume is the highest volume the targets may be set to while the rule applies, or 1 for no cap
+	MaxVolume float32
+	Mute      bool
+}
+
+// day names accepted in a rule's days, besides the full ones
+var ruleDayGroups = map[string][]time.Weekday{
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// activeAt returns true if the rule applies at the given time
+func (r VolumeRule) activeAt(t time.Time) bool {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	day := t.Weekday()
+	inWindow := false
+
+	switch {
+	case r.After <= r.Before:
+		inWindow = sinceMidnight >= r.After && sinceMidnight < r.Before
+	case sinceMidnight >= r.After:
+		inWindow = true
+	case sinceMidnight < r.Before:
+		// the early hours of a window that spans midnight belong to the day it started on
+		inWindow = true
+		day = (day + 6) % 7
+	}
+
+	return inWindow && (r.Days == nil || r.Days[day])
+}
+
+// parseTimeOfDay parses a time like "23:00" into the time since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use 24-hour HH:MM", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseRuleDays parses day names like "mon", "friday" or "weekdays" into the set of days they cover
+func parseRuleDays(names []string) (map[time.Weekday]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	days := make(map[time.Weekday]bool)
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if group, ok := ruleDayGroups[name]; ok {
+			for _, day := range group {
+				days[day] = true
+			}
+
+			continue
+		}
+
+		found := false
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			full := strings.ToLower(day.String())
+			if name == full || name == full[:3] {
+				days[day] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown day %q", name)
+		}
+	}
+
+	return days, nil
+}
+
+// ruleEngine applies the scheduled volume rules: caps go through the session map's volume caps, and
+// targets of muting rules are muted while the rule applies and unmuted once it ends
+type ruleEngine struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	// names of the rules that applied at the last check, to log when they start and end
+	active map[string]bool
+
+	// targets muted by rules, to unmute once no rule mutes them anymore
+	muted map[string]bool
+}
+
+func newRuleEngine(deej *Deej, logger *zap.SugaredLogger) *ruleEngine {
+	logger = logger.Named("rules")
+
+	re := &ruleEngine{
+		deej:   deej,
+		logger: logger,
+		active: make(map[string]bool),
+		muted:  make(map[string]bool),
+	}
+
+	logger.Debug("Created rule engine instance")
+
+	return re
+}
+
+// start checks the rules periodically, and whenever the config or the sessions change, until deej shuts down.
+// Targets muted by rules are unmuted on the way out.
+func (re *ruleEngine) start() {
+	configReloadedChannel := re.deej.events.configReloaded.subscribe()
+	sessionChangesChannel := re.deej.events.sessionsChanged.subscribe()
+
+	re.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(ruleCheckInterval)
+		defer ticker.Stop()
+
+		re.apply(time.Now(), false)
+
+		for {
+			select {
+			case <-ctx.Done():
+				re.unmuteAll()
+				return nil
+
+			case <-ticker.C:
+				re.apply(time.Now(), false)
+
+			case <-configReloadedChannel:
+				re.apply(time.Now(), false)
+
+			// new sessions may match muting rules that already apply
+			case <-sessionChangesChannel:
+				re.apply(time.Now(), true)
+			}
+		}
+	})
+}
+
+// apply works out which rules apply at the given time and updates caps and mutes to match.
+// Targets are only muted as their rule starts, unless remute is set, so they can still be unmuted by hand.
+func (re *ruleEngine) apply(now time.Time, remute bool) {
+	caps := make(map[string]float32)
+	mutes := make(map[string]bool)
+	active := make(map[string]bool)
+
+	for _, rule := range re.deej.config.Rules {
+		if !rule.activeAt(now) {
+			continue
+		}
+
+		active[rule.Name] = true
+
+		for _, target := range rule.Targets {
+			if existing, ok := caps[target]; rule.MaxVolume < 1 && (!ok || rule.MaxVolume < existing) {
+				caps[target] = rule.MaxVolume
+			}
+
+			if rule.Mute {
+				mutes[target] = true
+			}
+		}
+	}
+
+	for name := range active {
+		if !re.active[name] {
+			re.logger.Infow("Rule started", "rule", name)
+		}
+	}
+
+	for name := range re.active {
+		if !active[name] {
+			re.logger.Infow("Rule ended", "rule", name)
+		}
+	}
+
+	re.active = active
+
+	re.deej.sessions.setVolumeCaps(caps)
+	re.deej.sessions.enforceVolumeCaps()
+
+	for target := range mutes {
+		if re.muted[target] && !remute {
+			continue
+		}
+
+		if _, err := re.deej.sessions.setTargetMute(target, true); err != nil {
+			re.logger.Warnw("Failed to mute rule target", "target", target, "error", err)
+		}
+
+		re.muted[target] = true
+	}
+
+	for target := range re.muted {
+		if mutes[target] {
+			continue
+		}
+
+		if _, err := re.deej.sessions.setTargetMute(target, false); err != nil {
+			re.logger.Warnw("Failed to unmute rule target", "target", target, "error", err)
+		}
+
+		delete(re.muted, target)
+	}
+}
+
+// unmuteAll unmutes every target muted by a rule, so they don't stay muted after deej quits
+func (re *ruleEngine) unmuteAll() {
+	for target := range re.muted {
+		if _, err := re.deej.sessions.setTargetMute(target, false); err != nil {
+			re.logger.Debugw("Failed to unmute rule target", "target", target, "error", err)
+		}
+	}
+
+	re.muted = make(map[string]bool)
+}
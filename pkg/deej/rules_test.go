@@ -0,0 +1,69 @@
+package deej
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVolumeRuleActiveAt(t *testing.T) {
+	weekdays, _ := parseRuleDays([]string{"weekdays"})
+
+	lateNight := VolumeRule{After: 23 * time.Hour, Before: 7 * time.Hour}
+	untilMidnight := VolumeRule{After: 23 * time.Hour, Before: 24 * time.Hour}
+	workHours := VolumeRule{After: 9 * time.Hour, Before: 17 * time.Hour, Days: weekdays}
+	fridayNight := VolumeRule{After: 22 * time.Hour, Before: 2 * time.Hour, Days: map[time.Weekday]bool{time.Friday: true}}
+
+	// 2024-01-05 was a Friday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name string
+		rule VolumeRule
+		time time.Time
+		want bool
+	}{
+		{"late night, before it starts", lateNight, at(5, 22, 59), false},
+		{"late night, as it starts", lateNight, at(5, 23, 0), true},
+		{"late night, after midnight", lateNight, at(6, 3, 0), true},
+		{"late night, as it ends", lateNight, at(6, 7, 0), false},
+		{"until midnight", untilMidnight, at(5, 23, 59), true},
+		{"until midnight, the next morning", untilMidnight, at(6, 0, 30), false},
+		{"work hours on a weekday", workHours, at(5, 12, 0), true},
+		{"work hours on a weekend", workHours, at(6, 12, 0), false},
+		{"friday night, on friday", fridayNight, at(5, 23, 0), true},
+		{"friday night, early saturday", fridayNight, at(6, 1, 0), true},
+		{"friday night, early friday", fridayNight, at(5, 1, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rule.activeAt(test.time); got != test.want {
+				t.Errorf("activeAt(%s) = %t, want %t", test.time.Format("Mon 15:04"), got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRuleDays(t *testing.T) {
+	days, err := parseRuleDays([]string{"Mon", "wednesday", "weekends"})
+	if err != nil {
+		t.Fatalf("parseRuleDays: %v", err)
+	}
+
+	want := map[time.Weekday]bool{time.Monday: true, time.Wednesday: true, time.Saturday: true, time.Sunday: true}
+	if len(days) != len(want) {
+		t.Errorf("days = %v, want %v", days, want)
+	}
+
+	for day := range want {
+		if !days[day] {
+			t.Errorf("days = %v, missing %s", days, day)
+		}
+	}
+
+	if _, err := parseRuleDays([]string{"someday"}); err == nil {
+		t.Error("parseRuleDays accepted an unknown day")
+	}
+}
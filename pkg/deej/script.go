@@ -0,0 +1,282 @@
+package deej
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// scriptSliderFunction is called with (slider, value, state) on every slider move
+	scriptSliderFunction = "on_slider"
+
+	// guards against scripts that never finish (e.g. an accidental infinite loop) blocking slider handling
+	scriptMaxExecutionSteps = 1000000
+
+	scriptThreadActionsKey = "actions"
+)
+
+// scriptEngine runs a user-provided Starlark script (a small Python dialect) on slider moves, for mapping logic
+// that slider_mapping can't express. The script defines on_slider(slider, value, state) and calls functions from
+// the predeclared deej module to adjust volumes or perform actions. Returning True from on_slider tells deej
+// the slider was fully handled, so its slider_mapping entry (if any) is skipped.
+type scriptEngine struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	onSlider starlark.Callable
+
+	// the most recent value of each slider, as seen by the script
+	sliderValues map[int]float32
+}
+
+// a function queued by the script, to be run once on_slider returns successfully
+type scriptAction func() error
+
+func newScriptEngine(deej *Deej, logger *zap.SugaredLogger) *scriptEngine {
+	logger = logger.Named("script")
+
+	se := &scriptEngine{
+		deej:         deej,
+		logger:       logger,
+		sliderValues: make(map[int]float32),
+	}
+
+	logger.Debug("Created script engine instance")
+
+	return se
+}
+
+// initialize loads the configured script, reloads it along with the config and has it look at slider moves
+// before the session map applies them
+func (se *scriptEngine) initialize() {
+	se.load()
+	se.setupOnConfigReload()
+	se.deej.sessions.registerSliderMoveHandler(se.handleSliderMoveEvent)
+}
+
+func (se *scriptEngine) setupOnConfigReload() {
+	configReloadedChannel := se.deej.events.configReloaded.subscribe()
+
+	se.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+				// always reload, since the script itself may have changed even if its path didn't
+				se.load()
+			}
+		}
+	})
+}
+
+func (se *scriptEngine) load() {
+	path := se.deej.config.ScriptPath
+
+	se.lock.Lock()
+	defer se.lock.Unlock()
+
+	se.onSlider = nil
+
+	if path == "" {
+		return
+	}
+
+	if !util.FileExists(path) {
+		se.logger.Warnw("Script file not found", "path", path)
+		se.deej.notifier.Notify(tr("notify.scriptMissing"), tr("notify.scriptMissingMessage", "path", path))
+		return
+	}
+
+	thread := se.newThread("load")
+
+	globals, err := starlark.ExecFile(thread, path, nil, starlark.StringDict{"deej": se.module()})
+	if err != nil {
+		se.logger.Warnw("Failed to load script", "path", path, "error", scriptErrorDetails(err))
+		se.deej.notifier.Notify(tr("notify.scriptFailed"), tr("notify.moreDetails"))
+		return
+	}
+
+	onSlider, ok := globals[scriptSliderFunction].(starlark.Callable)
+	if !ok {
+		se.logger.Warnw("Script doesn't define a slider function, ignoring it", "path", path, "function", scriptSliderFunction)
+		return
+	}
+
+	se.onSlider = onSlider
+	se.logger.Infow("Loaded script", "path", path)
+}
+
+// handleSliderMoveEvent passes the event to the script, if one is loaded.
+// It returns true if the script handled the slider and its regular mapping should be skipped.
+func (se *scriptEngine) handleSliderMoveEvent(event SliderMoveEvent) bool {
+	se.lock.Lock()
+	se.sliderValues[event.SliderID] = event.PercentValue
+
+	onSlider := se.onSlider
+	if onSlider == nil {
+		se.lock.Unlock()
+		return false
+	}
+
+	state := se.state()
+	se.lock.Unlock()
+
+	thread := se.newThread(scriptSliderFunction)
+
+	var actions []scriptAction
+	thread.SetLocal(scriptThreadActionsKey, &actions)
+
+	args := starlark.Tuple{starlark.MakeInt(event.SliderID), starlark.Float(event.PercentValue), state}
+
+	result, err := starlark.Call(thread, onSlider, args, nil)
+	if err != nil {
+		se.logger.Warnw("Script failed while handling slider move", "slider", event.SliderID, "error", scriptErrorDetails(err))
+		return false
+	}
+
+	for _, action := range actions {
+		if err := action(); err != nil {
+			se.logger.Warnw("Failed to perform script action", "slider", event.SliderID, "error", err)
+		}
+	}
+
+	return result == starlark.True
+}
+
+func (se *scriptEngine) newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			se.logger.Infow("Script output", "message", msg)
+		},
+	}
+
+	thread.SetMaxExecutionSteps(scriptMaxExecutionSteps)
+
+	return thread
+}
+
+// state describes sessions, sliders and the active profile, for the script to base its decisions on.
+// Assumes the lock is held.
+func (se *scriptEngine) state() starlark.Value {
+	sessions := starlark.NewDict(0)
+	for _, session := range se.deej.sessions.snapshot() {
+		sessions.SetKey(starlark.String(session.Key()), starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"volume": starlark.Float(session.GetVolume()),
+			"muted":  starlark.Bool(sessionIsMuted(session)),
+		}))
+	}
+
+	sliders := starlark.NewDict(len(se.sliderValues))
+	for sliderID, value := range se.sliderValues {
+		sliders.SetKey(starlark.MakeInt(sliderID), starlark.Float(value))
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"sessions": sessions,
+		"sliders":  sliders,
+		"profile":  starlark.String(se.deej.config.ActiveProfile),
+	})
+}
+
+// module builds the predeclared deej module. Its functions queue their effect until on_slider returns,
+// so a script that fails halfway through doesn't leave volumes half-adjusted.
+func (se *scriptEngine) module() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "deej",
+		Members: starlark.StringDict{
+			"set_volume": starlark.NewBuiltin("set_volume", se.builtinSetVolume),
+			"set_mute":   starlark.NewBuiltin("set_mute", se.builtinSetMute),
+			"action":     starlark.NewBuiltin("action", se.builtinAction),
+		},
+	}
+}
+
+// set_volume(target, volume) sets a slider_mapping-style target to a volume between 0 and 1
+func (se *scriptEngine) builtinSetVolume(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var target string
+	var volume float64
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "target", &target, "volume", &volume); err != nil {
+		return nil, err
+	}
+
+	if volume < 0 {
+		volume = 0
+	} else if volume > 1 {
+		volume = 1
+	}
+
+	return starlark.None, queueScriptAction(thread, func() error {
+		_, err := se.deej.sessions.setTargetVolume(target, float32(volume))
+		return err
+	})
+}
+
+// set_mute(target, muted) mutes or unmutes a slider_mapping-style target
+func (se *scriptEngine) builtinSetMute(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var target string
+	var muted bool
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "target", &target, "muted", &muted); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, queueScriptAction(thread, func() error {
+		_, err := se.deej.sessions.setTargetMute(target, muted)
+		return err
+	})
+}
+
+// action(action, target="", profile="", step=0) performs any action that hotkeys and buttons can
+func (se *scriptEngine) builtinAction(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var action ActionConfig
+	var step float64
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"action", &action.Action, "target?", &action.Target, "profile?", &action.Profile, "step?", &step); err != nil {
+		return nil, err
+	}
+
+	action.Step = float32(step)
+
+	// report invalid actions to the script right away, rather than after it returns
+	if err := action.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.None, queueScriptAction(thread, func() error {
+		return se.deej.performAction(action)
+	})
+}
+
+func queueScriptAction(thread *starlark.Thread, action scriptAction) error {
+	actions, ok := thread.Local(scriptThreadActionsKey).(*[]scriptAction)
+	if !ok {
+		return errors.New("deej functions can only be used from within " + scriptSliderFunction)
+	}
+
+	*actions = append(*actions, action)
+	return nil
+}
+
+// scriptErrorDetails includes the script's stack trace for evaluation errors
+func scriptErrorDetails(err error) string {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return strings.TrimSpace(evalErr.Backtrace())
+	}
+
+	return err.Error()
+}
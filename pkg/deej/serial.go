@@ -1,13 +1,15 @@
 package deej
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jacobsa/go-serial/serial"
@@ -16,23 +18,36 @@ import (
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
-// SerialIO provides a deej-aware abstraction layer for managing serial I/O
+// SerialIO provides a deej-aware abstraction layer for managing serial I/O with one or more boards,
+// merging their events into a single stream
 type SerialIO struct {
-	comPort  string
-	baudRate uint
+	config   *CanonicalConfig
+	events   *eventBus
+	routines *routineGroup
+	logger   *zap.SugaredLogger
 
-	deej   *Deej
-	logger *zap.SugaredLogger
+	lock             sync.Mutex // guards devices
+	devices          []*serialDevice
+	connectedDevices atomic.Int32
 
-	stopChannel chan bool
-	connected   bool
-	connOptions serial.OpenOptions
-	conn        io.ReadWriteCloser
+	capture *serialCapture
 
-	lastKnownNumSliders        int
-	currentSliderPercentValues []float32
+	// opens a board's port, serial.Open unless replaced (e.g. by tests replaying recorded lines)
+	openPort func(options serial.OpenOptions) (io.ReadWriteCloser, error)
 
-	sliderMoveConsumers []chan SliderMoveEvent
+	// counted for metrics
+	connects      atomic.Uint64
+	disconnects   atomic.Uint64
+	parseFailures atomic.Uint64
+
+	// lines dropped because their checksum didn't match, counted for metrics
+	checksumFailures atomic.Uint64
+
+	// boards disconnected for not answering keepalive pings, counted for metrics
+	keepaliveTimeouts atomic.Uint64
+
+	// slider jumps past slider_safety.spike_threshold that the next reading didn't confirm, counted for metrics
+	rejectedSpikes atomic.Uint64
 }
 
 // SliderMoveEvent represents a single slider movement captured by deej
@@ -41,19 +56,46 @@ type SliderMoveEvent struct {
 	PercentValue float32
 }
 
-var expectedLinePattern = regexp.MustCompile(`^\d{1,4}(\|\d{1,4})*\r\n$`)
+// ButtonPressEvent represents a single button press captured by deej
+type ButtonPressEvent struct {
+	ButtonID int
+}
+
+// how many lines in a row must agree on a new slider count before it's accepted, so a single garbled line
+// doesn't reset every slider
+const sliderCountChangeLines = 3
+
+// slider_filter's moving average is snapped to the reading once it's this close, half a percent
+const sliderFilterSnapDistance = 0.005
+
+// lines are matched after their trailing "\r\n" is removed. Values take up to 5 digits, since slider_max_value
+// goes up to 65535
+var expectedLinePattern = regexp.MustCompile(`^\d{1,5}(\|\d{1,5})*$`)
 
-// NewSerialIO creates a new SerialIO instance
-func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
+// any line can end in "*" and a CRC-8 of the rest as two hex digits, e.g. "512|1023*40",
+// so lines garbled on a noisy link are dropped instead of making volumes jump
+const lineChecksumSeparator = "*"
+
+// buttons are reported on their own line as they're pressed, e.g. "b2" for the third button
+var expectedButtonLinePattern = regexp.MustCompile(`^b(\d{1,2})$`)
+
+// NewSerialIO creates a new SerialIO instance, which follows the connection settings in config,
+// publishes what the boards send to events and runs its background work in routines
+func NewSerialIO(
+	config *CanonicalConfig,
+	events *eventBus,
+	routines *routineGroup,
+	logger *zap.SugaredLogger,
+) (*SerialIO, error) {
 	logger = logger.Named("serial")
 
 	sio := &SerialIO{
-		deej:                deej,
-		logger:              logger,
-		stopChannel:         make(chan bool),
-		connected:           false,
-		conn:                nil,
-		sliderMoveConsumers: []chan SliderMoveEvent{},
+		config:   config,
+		events:   events,
+		routines: routines,
+		logger:   logger,
+		capture:  newSerialCapture(),
+		openPort: serial.Open,
 	}
 
 	logger.Debug("Created SerialIO instance")
@@ -62,76 +104,169 @@ func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
 	return sio, nil
 }
 
-// Start attempts to establish a serial connection
+// Start attempts to establish a serial connection to every configured board. Boards that are already
+// connected are left alone, so Start can be called again to retry the ones that failed. It only fails if none of
+// the boards it tried could be connected.
 func (sio *SerialIO) Start() error {
-	if sio.connected {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	if sio.devices == nil {
+		for _, info := range sio.config.Devices {
+			sio.devices = append(sio.devices, newSerialDevice(sio, info))
+		}
+	}
+
+	var errs []error
+	opened := 0
+
+	for _, device := range sio.devices {
+		if device.connected.Load() {
+			continue
+		}
+
+		if err := device.open(); err != nil {
+			errs = append(errs, &serialDeviceError{port: device.port(), err: err})
+			continue
+		}
+
+		opened++
+	}
+
+	if opened == 0 && len(errs) == 0 {
 		sio.logger.Warn("Connection already active, cannot start a new one")
 		return errors.New("serial: connection already active")
 	}
 
+	// the boards that are missing can still be connected by the next Start, e.g. once they're plugged in
+	if opened > 0 {
+		for _, err := range errs {
+			sio.logger.Warnw("Connected without one of the boards", "error", err)
+		}
+
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// serialDeviceError is why Start couldn't connect to one of the boards
+type serialDeviceError struct {
+	port string
+	err  error
+}
+
+func (e *serialDeviceError) Error() string {
+	return e.err.Error()
+}
+
+func (e *serialDeviceError) Unwrap() error {
+	return e.err
+}
+
+// failedSerialPorts lists the ports of the boards an error from Start couldn't connect to, for messages
+func failedSerialPorts(err error) string {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var ports []string
+	for _, err := range errs {
+		var deviceErr *serialDeviceError
+		if errors.As(err, &deviceErr) {
+			ports = append(ports, deviceErr.port)
+		}
+	}
+
+	return strings.Join(ports, ", ")
+}
+
+// serialOpenOptions returns the options for opening the board's port
+func serialOpenOptions(info ConnectionInfo) serial.OpenOptions {
 	minimumReadSize := 0
 	if util.Linux() {
 		minimumReadSize = 1
 	}
 
-	sio.connOptions = serial.OpenOptions{
-		PortName:        sio.deej.config.ConnectionInfo.COMPort,
-		BaudRate:        uint(sio.deej.config.ConnectionInfo.BaudRate),
-		DataBits:        8,
-		StopBits:        1,
+	options := serial.OpenOptions{
+		PortName:        info.COMPort,
+		BaudRate:        uint(info.BaudRate),
+		DataBits:        defaultDataBits,
+		StopBits:        defaultStopBits,
 		MinimumReadSize: uint(minimumReadSize),
 	}
 
-	sio.logger.Debugw("Opening serial connection",
-		"comPort", sio.connOptions.PortName,
-		"baudRate", sio.connOptions.BaudRate,
-		"minReadSize", minimumReadSize)
+	if info.DataBits != 0 {
+		options.DataBits = uint(info.DataBits)
+	}
 
-	conn, err := serial.Open(sio.connOptions)
-	if err != nil {
-		sio.logger.Warnw("Failed to open serial connection", "error", err)
-		return fmt.Errorf("open serial connection: %w", err)
+	if info.StopBits != 0 {
+		options.StopBits = uint(info.StopBits)
 	}
 
-	sio.conn = conn
-	sio.connected = true
-	sio.logger.Infow("Serial connection established", "port", sio.connOptions.PortName)
+	switch info.Parity {
+	case "odd":
+		options.ParityMode = serial.PARITY_ODD
+	case "even":
+		options.ParityMode = serial.PARITY_EVEN
+	}
 
-	go sio.readLoop()
+	return options
+}
+
+// setSerialLines sets the port's DTR and RTS lines as configured, once it's open
+func setSerialLines(conn io.ReadWriteCloser, info ConnectionInfo) error {
+	if info.DTR == SerialLineDefault && info.RTS == SerialLineDefault {
+		return nil
+	}
 
-	return nil
+	return setModemLines(conn, info.DTR, info.RTS)
 }
 
-// Stop shuts down the serial connection if active
+// Stop shuts down all active serial connections, and waits for their read loops to return.
+// The next Start follows the configured devices again.
 func (sio *SerialIO) Stop() {
-	if sio.connected {
-		sio.logger.Debug("Closing serial connection")
-		sio.stopChannel <- true
-	} else {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	if !sio.Connected() {
 		sio.logger.Debug("No active connection to stop")
 	}
+
+	for _, device := range sio.devices {
+		device.close()
+	}
+
+	sio.devices = nil
 }
 
-// SubscribeToSliderMoveEvents allows listeners to subscribe to slider movement events
-func (sio *SerialIO) SubscribeToSliderMoveEvents() chan SliderMoveEvent {
-	ch := make(chan SliderMoveEvent)
-	sio.sliderMoveConsumers = append(sio.sliderMoveConsumers, ch)
-	return ch
+// Connected reports whether a serial connection to any of the boards is currently open
+func (sio *SerialIO) Connected() bool {
+	return sio.connectedDevices.Load() > 0
 }
 
-// setupOnConfigReload listens for configuration changes and adjusts the connection as needed
+// setupOnConfigReload listens for configuration changes and adjusts the connections as needed
 func (sio *SerialIO) setupOnConfigReload() {
-	configReloadedChannel := sio.deej.config.SubscribeToChanges()
+	configReloadedChannel := sio.events.configReloaded.subscribe()
 	const stopDelay = 50 * time.Millisecond
 
-	go func() {
+	sio.routines.spawn(func(ctx context.Context) error {
 		for {
 			select {
+			case <-ctx.Done():
+				return nil
 			case <-configReloadedChannel:
-				go func() {
+				util.Go(sio.routines.onPanic, func() {
 					time.Sleep(stopDelay)
-					sio.lastKnownNumSliders = 0
-				}()
+
+					sio.lock.Lock()
+					defer sio.lock.Unlock()
+
+					for _, device := range sio.devices {
+						device.resetSliders()
+					}
+				})
 
 				if sio.needsReconnect() {
 					sio.logger.Info("Config change detected, reconnecting")
@@ -147,89 +282,198 @@ func (sio *SerialIO) setupOnConfigReload() {
 				}
 			}
 		}
-	}()
-}
-
-// readLoop continuously reads data from the serial connection
-func (sio *SerialIO) readLoop() {
-	reader := bufio.NewReader(sio.conn)
-
-	for {
-		select {
-		case <-sio.stopChannel:
-			sio.closeConnection()
-			return
-		default:
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				sio.logger.Warnw("Failed to read from serial", "error", err)
-				sio.closeConnection()
-				return
+	})
+}
+
+// sliderValues returns a copy of the current slider values of all boards, indexed by slider ID,
+// with -1 for sliders that haven't reported yet
+func (sio *SerialIO) sliderValues() []float32 {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	var values []float32
+
+	for _, device := range sio.devices {
+		for i, value := range device.sliderValues() {
+			sliderID := device.info.SliderOffset + i
+			for len(values) <= sliderID {
+				values = append(values, -1)
 			}
-			sio.processLine(strings.TrimSuffix(line, "\r\n"))
+
+			values[sliderID] = value
 		}
 	}
+
+	return values
 }
 
-// processLine parses a line of slider data and triggers events
-func (sio *SerialIO) processLine(line string) {
-	if !expectedLinePattern.MatchString(line) {
+// notifySliderMove passes a slider move to all subscribers, whether it came from the serial port or elsewhere.
+// Moves of disabled sliders are dropped.
+func (sio *SerialIO) notifySliderMove(event SliderMoveEvent) {
+	if sio.config.DisabledSliders[event.SliderID] {
 		return
 	}
 
-	values := strings.Split(line, "|")
-	numSliders := len(values)
+	sio.events.sliderMoved.publish(event)
+}
 
-	if numSliders != sio.lastKnownNumSliders {
-		sio.logger.Infow("Slider count updated", "count", numSliders)
-		sio.lastKnownNumSliders = numSliders
-		sio.currentSliderPercentValues = make([]float32, numSliders)
-		for i := range sio.currentSliderPercentValues {
-			sio.currentSliderPercentValues[i] = -1.0
-		}
-	}
+// notifyButtonPress passes a button press to all subscribers, whether it came from the serial port or elsewhere
+func (sio *SerialIO) notifyButtonPress(event ButtonPressEvent) {
+	sio.events.buttonPressed.publish(event)
+}
 
-	var events []SliderMoveEvent
-	for i, val := range values {
-		rawValue, err := strconv.Atoi(val)
-		if err != nil || rawValue > 1023 {
-			sio.logger.Debugw("Invalid slider value", "value", val, "line", line)
-			return
+// WriteLine sends a line of data to every connected board, e.g. for LED feedback
+func (sio *SerialIO) WriteLine(line string) error {
+	return sio.writeToDevices(func(int, int) (string, bool) {
+		return line, true
+	})
+}
+
+// writeToDevices sends each connected board the line returned for its slider offset and slider count
+// (0 until the board reports it), skipping boards line returns false for
+func (sio *SerialIO) writeToDevices(line func(sliderOffset int, numSliders int) (string, bool)) error {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	var errs []error
+	connected := false
+
+	for _, device := range sio.devices {
+		if !device.connected.Load() {
+			continue
 		}
 
-		scaledValue := util.NormalizeScalar(float32(rawValue) / 1023.0)
-		if sio.deej.config.InvertSliders {
-			scaledValue = 1 - scaledValue
+		connected = true
+
+		deviceLine, ok := line(device.info.SliderOffset, device.numSliders())
+		if !ok {
+			continue
 		}
 
-		if util.SignificantlyDifferent(sio.currentSliderPercentValues[i], scaledValue, sio.deej.config.NoiseReductionLevel) {
-			sio.currentSliderPercentValues[i] = scaledValue
-			events = append(events, SliderMoveEvent{i, scaledValue})
+		if err := device.writeLine(deviceLine); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	for _, event := range events {
-		for _, ch := range sio.sliderMoveConsumers {
-			ch <- event
+	if !connected {
+		return errors.New("serial: not connected")
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeToSlider sends the line returned for a slider's index on its own board to the board that slider belongs to,
+// which is the one with the highest slider offset at or below it
+func (sio *SerialIO) writeToSlider(sliderID int, line func(localID int) string) error {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	var owner *serialDevice
+	for _, device := range sio.devices {
+		if device.connected.Load() && device.info.SliderOffset <= sliderID &&
+			(owner == nil || device.info.SliderOffset > owner.info.SliderOffset) {
+			owner = device
 		}
 	}
+
+	if owner == nil {
+		return fmt.Errorf("serial: no board connected for slider %d", sliderID)
+	}
+
+	return owner.writeLine(line(sliderID - owner.info.SliderOffset))
+}
+
+// ExportCapture writes the captured serial traffic to a file in the log directory, returning its path
+func (sio *SerialIO) ExportCapture() (string, error) {
+	info := sio.config.SerialCapture
+	if !info.Enabled {
+		return "", errors.New("serial capture is disabled")
+	}
+
+	capturePath, err := sio.capture.export(time.Duration(info.Minutes) * time.Minute)
+	if err != nil {
+		return "", fmt.Errorf("export serial capture: %w", err)
+	}
+
+	sio.logger.Infow("Exported serial capture", "path", capturePath)
+
+	return capturePath, nil
 }
 
-// closeConnection handles the safe closure of the serial connection
-func (sio *SerialIO) closeConnection() {
-	if sio.conn != nil {
-		if err := sio.conn.Close(); err != nil {
-			sio.logger.Warnw("Error closing serial connection", "error", err)
-		} else {
-			sio.logger.Debug("Serial connection closed")
+// missingDevices returns whether any configured board isn't connected
+func (sio *SerialIO) missingDevices() bool {
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	if sio.devices == nil {
+		return len(sio.config.Devices) > 0
+	}
+
+	for _, device := range sio.devices {
+		if !device.connected.Load() {
+			return true
 		}
 	}
-	sio.conn = nil
-	sio.connected = false
+
+	return false
 }
 
-// needsReconnect checks if the connection parameters have changed
+// notifyConnectionStateChange informs subscribers whether any board is connected
+func (sio *SerialIO) notifyConnectionStateChange() {
+	sio.events.connectionChanged.publish(sio.Connected())
+}
+
+// needsReconnect checks if the configured devices have changed
 func (sio *SerialIO) needsReconnect() bool {
-	return sio.deej.config.ConnectionInfo.COMPort != sio.connOptions.PortName ||
-		uint(sio.deej.config.ConnectionInfo.BaudRate) != sio.connOptions.BaudRate
-}
\ No newline at end of file
+	sio.lock.Lock()
+	defer sio.lock.Unlock()
+
+	if len(sio.devices) != len(sio.config.Devices) {
+		return true
+	}
+
+	for idx, device := range sio.devices {
+		if device.info != sio.config.Devices[idx] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitLineChecksum separates a line from its checksum. It returns the line without the checksum, whether the line
+// had one, and whether that checksum matched
+func splitLineChecksum(line string) (payload string, checksummed bool, valid bool) {
+	idx := strings.LastIndex(line, lineChecksumSeparator)
+	if idx == -1 {
+		return line, false, false
+	}
+
+	payload = line[:idx]
+
+	checksum, err := strconv.ParseUint(line[idx+1:], 16, 8)
+	if err != nil || len(line)-idx-1 != 2 {
+		return payload, true, false
+	}
+
+	return payload, true, byte(checksum) == crc8(payload)
+}
+
+// crc8 computes the CRC-8 (polynomial 0x07, as in SMBus) that boards append to their lines
+func crc8(data string) byte {
+	var crc byte
+
+	for i := 0; i < len(data); i++ {
+		crc ^= data[i]
+
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
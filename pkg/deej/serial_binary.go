@@ -0,0 +1,146 @@
+package deej
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Boards streaming many sliders at high rates can switch to binary frames, which are smaller and cheaper to
+// parse than text lines. A board that supports them sends binaryOfferLine while still in text mode; if binary
+// frames are enabled, deej answers with binaryAcceptLine, and the board sends binaryAckLine as its last text
+// line before switching. deej keeps writing text lines to the board either way.
+//
+// Each frame is COBS-encoded and ends with a zero byte. Decoded, it's a frame type byte, the payload and a
+// CRC-8 (as in text lines) of the type and payload:
+//   - binaryFrameSliders: every slider's raw value (0 to slider_max_value, 1023 by default) as a little-endian uint16
+//   - binaryFrameButton: the index of the pressed button as a single byte
+//   - binaryFramePong: no payload, the answer to a keepalive ping
+const (
+	binaryOfferLine  = "deej:binary?"
+	binaryAcceptLine = "deej:binary"
+	binaryAckLine    = "deej:binary ok"
+
+	binaryFrameDelimiter = 0x00
+
+	binaryFrameSliders byte = 0x01
+	binaryFrameButton  byte = 0x02
+	binaryFramePong    byte = 0x03
+)
+
+var errFrameChecksum = errors.New("checksum mismatch")
+
+// answerBinaryOffer lets the board switch to binary frames, unless they're disabled
+func (sd *serialDevice) answerBinaryOffer() {
+	if !sd.sio.config.BinaryProtocol {
+		sd.logger.Debug("Board offered binary frames, staying with text lines since binary_protocol is off")
+		return
+	}
+
+	if err := sd.writeLine(binaryAcceptLine); err != nil {
+		sd.logger.Warnw("Failed to accept binary frames", "error", err)
+	}
+}
+
+// readFrame processes a frame, without its delimiter. Frames are recorded in the capture as the equivalent text
+// line, so captures read (and replay) the same whichever way the board sent them
+func (sd *serialDevice) readFrame(frame []byte) {
+	line, err := sd.processFrame(frame)
+	if err == nil {
+		sd.sio.capture.record(sd.sio.config.SerialCapture, captureReceived, line)
+		return
+	}
+
+	sd.logger.Debugw("Dropping invalid binary frame", "frame", fmt.Sprintf("% x", frame), "error", err)
+
+	if errors.Is(err, errFrameChecksum) {
+		sd.sio.checksumFailures.Add(1)
+	} else {
+		sd.sio.parseFailures.Add(1)
+	}
+
+	sd.sio.capture.record(sd.sio.config.SerialCapture, captureRejected, fmt.Sprintf("% x", frame))
+}
+
+// processFrame decodes a frame and triggers events, returning the equivalent text line
+func (sd *serialDevice) processFrame(frame []byte) (string, error) {
+	decoded, err := cobsDecode(frame)
+	if err != nil {
+		return "", err
+	}
+
+	if len(decoded) < 2 {
+		return "", errors.New("frame too short")
+	}
+
+	body, checksum := decoded[:len(decoded)-1], decoded[len(decoded)-1]
+	if crc8(string(body)) != checksum {
+		return "", errFrameChecksum
+	}
+
+	frameType, payload := body[0], body[1:]
+
+	switch frameType {
+	case binaryFrameSliders:
+		if len(payload) == 0 || len(payload)%2 != 0 {
+			return "", fmt.Errorf("slider frame with %d payload bytes", len(payload))
+		}
+
+		rawValues := make([]int, len(payload)/2)
+		values := make([]string, len(rawValues))
+
+		for i := range rawValues {
+			rawValues[i] = int(binary.LittleEndian.Uint16(payload[i*2:]))
+			if rawValues[i] > sd.info.sliderMaxValue() {
+				return "", fmt.Errorf("invalid slider value %d", rawValues[i])
+			}
+
+			values[i] = strconv.Itoa(rawValues[i])
+		}
+
+		sd.processSliderValues(rawValues)
+		return strings.Join(values, "|"), nil
+
+	case binaryFrameButton:
+		if len(payload) != 1 {
+			return "", fmt.Errorf("button frame with %d payload bytes", len(payload))
+		}
+
+		sd.processButtonPress(int(payload[0]))
+		return fmt.Sprintf("b%d", payload[0]), nil
+
+	case binaryFramePong:
+		if len(payload) != 0 {
+			return "", fmt.Errorf("pong frame with %d payload bytes", len(payload))
+		}
+
+		sd.receivedPong()
+		return keepalivePongLine, nil
+	}
+
+	return "", fmt.Errorf("unknown frame type %#x", frameType)
+}
+
+// cobsDecode reverses consistent overhead byte stuffing, which frees up zero bytes to delimit frames
+func cobsDecode(frame []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(frame))
+
+	for i := 0; i < len(frame); {
+		code := int(frame[i])
+		if code == 0 || i+code > len(frame) {
+			return nil, errors.New("invalid COBS encoding")
+		}
+
+		decoded = append(decoded, frame[i+1:i+code]...)
+		i += code
+
+		// a full block of 254 bytes isn't followed by an implicit zero, and neither is the last block
+		if code < 0xff && i < len(frame) {
+			decoded = append(decoded, 0)
+		}
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,121 @@
+package deej
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// cobsEncode is cobsDecode's counterpart, which only boards need
+func cobsEncode(data []byte) []byte {
+	var encoded []byte
+	block := []byte{}
+
+	flush := func() {
+		encoded = append(encoded, byte(len(block)+1))
+		encoded = append(encoded, block...)
+		block = []byte{}
+	}
+
+	for _, b := range data {
+		if b == 0 {
+			flush()
+			continue
+		}
+
+		block = append(block, b)
+		if len(block) == 0xfe {
+			flush()
+		}
+	}
+
+	flush()
+
+	return encoded
+}
+
+// binaryFrame builds a COBS-encoded frame, without its delimiter
+func binaryFrame(frameType byte, payload ...byte) []byte {
+	body := append([]byte{frameType}, payload...)
+	return cobsEncode(append(body, crc8(string(body))))
+}
+
+func TestCOBSRoundTrip(t *testing.T) {
+	tests := [][]byte{
+		{0x01},
+		{0x00},
+		{0x01, 0x00, 0x02, 0x00},
+		bytes.Repeat([]byte{0x11}, 300),
+	}
+
+	for _, data := range tests {
+		encoded := cobsEncode(data)
+		if bytes.IndexByte(encoded, 0) != -1 {
+			t.Errorf("cobsEncode(% x) = % x, contains a zero byte", data, encoded)
+		}
+
+		decoded, err := cobsDecode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("cobsDecode(cobsEncode(% x)) = % x, %v", data, decoded, err)
+		}
+	}
+}
+
+func TestProcessFrame(t *testing.T) {
+	corrupted := binaryFrame(binaryFrameSliders, 0x00, 0x02)
+	corrupted[len(corrupted)-1] ^= 0x01
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		wantLine string
+		wantErr  bool
+	}{
+		{"sliders", binaryFrame(binaryFrameSliders, 0x00, 0x02, 0xff, 0x03), "512|1023", false},
+		{"button", binaryFrame(binaryFrameButton, 0x02), "b2", false},
+		{"bad checksum", corrupted, "", true},
+		{"slider value out of range", binaryFrame(binaryFrameSliders, 0x00, 0x04), "", true},
+		{"odd slider payload", binaryFrame(binaryFrameSliders, 0x00), "", true},
+		{"unknown type", binaryFrame(0x7f, 0x00), "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sio := newTestSerialIO(t, newTestConfig(nil), newScriptedPort())
+			device := newSerialDevice(sio, DeviceInfo{})
+
+			line, err := device.processFrame(test.frame)
+			if (err != nil) != test.wantErr || line != test.wantLine {
+				t.Errorf("processFrame = %q, %v, want %q (error: %t)", line, err, test.wantLine, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSerialIOSwitchesToBinaryFrames(t *testing.T) {
+	config := newTestConfig(nil)
+	config.BinaryProtocol = true
+
+	frame := binaryFrame(binaryFrameSliders, 0x00, 0x00, 0xff, 0x03)
+	port := newScriptedPort("0|0", binaryOfferLine, binaryAckLine, string(frame)+"\x00")
+
+	sio := newTestSerialIO(t, config, port)
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	want := []SliderMoveEvent{{0, 0}, {1, 0}, {1, 1}}
+	for _, wantEvent := range want {
+		if got := receive(t, sliderEvents); got != wantEvent {
+			t.Errorf("slider event = %v, want %v", got, wantEvent)
+		}
+	}
+
+	sio.Stop()
+
+	if !reflect.DeepEqual(port.written, []string{binaryAcceptLine}) {
+		t.Errorf("written = %q, want the accept line", port.written)
+	}
+}
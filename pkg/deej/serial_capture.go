@@ -0,0 +1,100 @@
+package deej
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	captureFilename        = "deej-serial-capture-%s.log"
+	captureTimestampFormat = "2006.01.02-15.04.05"
+	captureLineTimeFormat  = "15:04:05.000"
+
+	// the board sends about a hundred lines per second, so this holds several minutes of traffic at most
+	captureMaxEntries = 60000
+)
+
+// captureDirection tells lines received from the board from lines sent to it, and whether received lines were understood
+type captureDirection string
+
+const (
+	captureReceived captureDirection = "<-"
+	captureRejected captureDirection = "<!"
+	captureSent     captureDirection = "->"
+)
+
+type captureEntry struct {
+	time      time.Time
+	direction captureDirection
+	line      string
+}
+
+// serialCapture keeps the last few minutes of raw serial traffic in memory, including lines deej couldn't parse,
+// so protocol problems can be diagnosed from an export without attaching a serial monitor
+type serialCapture struct {
+	lock    sync.Mutex
+	entries []captureEntry
+	next    int // where the next entry goes, once entries is full
+}
+
+func newSerialCapture() *serialCapture {
+	return &serialCapture{}
+}
+
+// record adds a line if capturing is enabled, replacing the oldest one once the buffer is full
+func (sc *serialCapture) record(info SerialCaptureInfo, direction captureDirection, line string) {
+	if !info.Enabled {
+		return
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	entry := captureEntry{time: time.Now(), direction: direction, line: line}
+
+	if len(sc.entries) < captureMaxEntries {
+		sc.entries = append(sc.entries, entry)
+	} else {
+		sc.entries[sc.next] = entry
+		sc.next = (sc.next + 1) % captureMaxEntries
+	}
+}
+
+// export writes the captured lines from the last duration to a new file in the log directory, returning its path
+func (sc *serialCapture) export(duration time.Duration) (string, error) {
+	now := time.Now()
+	cutoff := now.Add(-duration)
+
+	var contents bytes.Buffer
+	fmt.Fprintf(&contents, "deej serial capture, %s (%s received, %s rejected, %s sent)\n\n",
+		now.Format(captureTimestampFormat), captureReceived, captureRejected, captureSent)
+
+	sc.lock.Lock()
+	ordered := append(append([]captureEntry{}, sc.entries[sc.next:]...), sc.entries[:sc.next]...)
+	sc.lock.Unlock()
+
+	for _, entry := range ordered {
+		if entry.time.Before(cutoff) {
+			continue
+		}
+
+		fmt.Fprintf(&contents, "%s %s %q\n", entry.time.Format(captureLineTimeFormat), entry.direction, entry.line)
+	}
+
+	if err := util.EnsureDirExists(LogDirectory); err != nil {
+		return "", err
+	}
+
+	capturePath := filepath.Join(LogDirectory, fmt.Sprintf(captureFilename, now.Format(captureTimestampFormat)))
+	if err := os.WriteFile(capturePath, contents.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write serial capture: %w", err)
+	}
+
+	return capturePath, nil
+}
@@ -0,0 +1,684 @@
+package deej
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// serialDevice is the connection to one board. Its sliders and buttons are numbered from the device's offset,
+// so several boards can share one slider_mapping.
+type serialDevice struct {
+	sio    *SerialIO
+	info   DeviceInfo
+	logger *zap.SugaredLogger
+
+	connected    atomic.Bool // closing on the read loop's side races with Start and the hotplug watcher checking it
+	connOptions  serial.OpenOptions
+	conn         io.ReadWriteCloser
+	writeLock    sync.Mutex    // guards conn against being closed mid-write
+	readLoopDone chan struct{} // closed once the current connection's read loop returns
+
+	// guards the slider state below, which throttled updates also touch from their own goroutine
+	sliderLock sync.Mutex
+
+	// set once the board has sent a line with a valid checksum, after which lines without one are dropped too,
+	// since a garbled separator would otherwise let them through. guarded by sliderLock
+	checksummed bool
+
+	// when the board last sent anything, in Unix nanoseconds, and whether it answered a keepalive ping since connecting
+	lastReceived atomic.Int64
+	answersPings atomic.Bool
+
+	lastKnownNumSliders        int
+	currentSliderPercentValues []float32
+
+	// sliders whose last reading jumped past slider_safety.spike_threshold, waiting for the next one to confirm it
+	unconfirmedJumps map[int]bool
+
+	// where sliders with a confirmed jump are headed, while slider_safety.max_step holds them back on the way there
+	confirmedJumps map[int]float32
+
+	// what slider_filter remembers about each slider between readings
+	filters map[int]*sliderFilterState
+
+	// a different slider count only sticks once enough lines in a row agree on it
+	pendingNumSliders      int
+	pendingNumSlidersLines int
+
+	// the slider_mapping entries the user was last told this board has no sliders for, so reconnects don't
+	// repeat the notification. guarded by sliderLock
+	notifiedUnreachable string
+
+	// slider lines arriving faster than max_update_rate_hz are held back, and only the newest one is applied
+	lastSliderUpdate  time.Time
+	throttledValues   []int
+	throttledUpdating bool
+}
+
+func newSerialDevice(sio *SerialIO, info DeviceInfo) *serialDevice {
+	logger := sio.logger.With("comPort", info.COMPort)
+	if info.DeviceID != "" {
+		logger = sio.logger.With("deviceID", info.DeviceID)
+	}
+
+	return &serialDevice{
+		sio:              sio,
+		info:             info,
+		logger:           logger,
+		unconfirmedJumps: make(map[int]bool),
+		confirmedJumps:   make(map[int]float32),
+		filters:          make(map[int]*sliderFilterState),
+	}
+}
+
+// open attempts to establish the device's serial connection
+func (sd *serialDevice) open() error {
+	sd.connOptions = serialOpenOptions(sd.info.ConnectionInfo)
+
+	// the board's port can change whenever it's plugged in again, so it's looked up on every connection
+	if sd.info.DeviceID != "" {
+		port, err := findDevicePort(sd.info.DeviceID)
+		if err != nil {
+			sd.logger.Warnw("Failed to find serial port", "error", err)
+			return fmt.Errorf("find serial port of %s: %w", sd.info.DeviceID, err)
+		}
+
+		sd.connOptions.PortName = port
+	}
+
+	sd.logger.Debugw("Opening serial connection",
+		"port", sd.connOptions.PortName,
+		"baudRate", sd.connOptions.BaudRate,
+		"minReadSize", sd.connOptions.MinimumReadSize)
+
+	conn, err := sd.sio.openPort(sd.connOptions)
+	if err != nil {
+		sd.logger.Warnw("Failed to open serial connection", "error", err)
+		return fmt.Errorf("open serial connection to %s: %w", sd.connOptions.PortName, err)
+	}
+
+	if err := setSerialLines(conn, sd.info.ConnectionInfo); err != nil {
+		sd.logger.Warnw("Failed to set DTR/RTS lines", "error", err)
+	}
+
+	sd.writeLock.Lock()
+	sd.conn = conn
+	sd.connected.Store(true)
+	sd.writeLock.Unlock()
+
+	// the board may have been reflashed in the meantime, with or without checksums
+	sd.sliderLock.Lock()
+	sd.checksummed = false
+	sd.sliderLock.Unlock()
+
+	sd.answersPings.Store(false)
+	sd.markReceived()
+
+	sd.sio.connects.Add(1)
+	sd.sio.connectedDevices.Add(1)
+	sd.logger.Info("Serial connection established")
+	sd.sio.notifyConnectionStateChange()
+
+	sd.readLoopDone = make(chan struct{})
+	readLoopDone := sd.readLoopDone
+
+	sd.sio.routines.spawn(func(context.Context) error {
+		defer close(readLoopDone)
+		sd.readLoop(conn)
+		return nil
+	})
+
+	sd.sio.routines.spawn(func(ctx context.Context) error {
+		sd.keepalive(ctx, readLoopDone)
+		return nil
+	})
+
+	return nil
+}
+
+// port returns where the board is looked for, for messages: its device ID if it has one, since its port can change
+func (sd *serialDevice) port() string {
+	if sd.info.DeviceID != "" {
+		return sd.info.DeviceID
+	}
+
+	return sd.info.COMPort
+}
+
+// close shuts down the connection if active, and waits for its read loop to return
+func (sd *serialDevice) close() {
+	if !sd.connected.Load() {
+		return
+	}
+
+	sd.logger.Debug("Closing serial connection")
+
+	// closing the port interrupts the read loop's pending read
+	readLoopDone := sd.readLoopDone
+	sd.closeConnection()
+	<-readLoopDone
+}
+
+// readLoop continuously reads data from the serial connection until it's closed. Boards start out sending text
+// lines, and may switch to binary frames once both sides agree to
+func (sd *serialDevice) readLoop(conn io.ReadWriteCloser) {
+	reader := bufio.NewReader(conn)
+	binary := false
+
+	for {
+		if binary {
+			frame, err := reader.ReadBytes(binaryFrameDelimiter)
+			if err != nil {
+				sd.readFailed(err)
+				return
+			}
+
+			sd.markReceived()
+			sd.readFrame(frame[:len(frame)-1])
+			continue
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			sd.readFailed(err)
+			return
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		sd.markReceived()
+
+		switch line {
+		case keepalivePongLine:
+			sd.sio.capture.record(sd.sio.config.SerialCapture, captureReceived, line)
+			sd.receivedPong()
+			continue
+
+		case binaryOfferLine:
+			sd.sio.capture.record(sd.sio.config.SerialCapture, captureReceived, line)
+			sd.answerBinaryOffer()
+			continue
+
+		case binaryAckLine:
+			sd.sio.capture.record(sd.sio.config.SerialCapture, captureReceived, line)
+			sd.logger.Info("Board switched to binary frames")
+			binary = true
+			continue
+		}
+
+		payload, ok := sd.verifyChecksum(line)
+		if !ok {
+			sd.logger.Debugw("Dropping line with a bad or missing checksum", "line", line)
+			sd.sio.checksumFailures.Add(1)
+			sd.sio.capture.record(sd.sio.config.SerialCapture, captureRejected, line)
+			continue
+		}
+
+		direction := captureReceived
+		if !sd.processLine(payload) {
+			direction = captureRejected
+			sd.sio.parseFailures.Add(1)
+		}
+
+		sd.sio.capture.record(sd.sio.config.SerialCapture, direction, line)
+	}
+}
+
+// readFailed closes the connection after a failed read
+func (sd *serialDevice) readFailed(err error) {
+	// close closes the connection to interrupt this read, which isn't worth a warning
+	if sd.closeConnection() {
+		sd.logger.Warnw("Failed to read from serial", "error", err)
+	}
+}
+
+// verifyChecksum strips a line's checksum, returning false if it doesn't match, or if the line has none
+// even though the board sent checksums before
+func (sd *serialDevice) verifyChecksum(line string) (string, bool) {
+	payload, checksummed, valid := splitLineChecksum(line)
+
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	if !checksummed {
+		return line, !sd.checksummed
+	}
+
+	if valid && !sd.checksummed {
+		sd.logger.Info("Board sends checksums, dropping lines without one from now on")
+		sd.checksummed = true
+	}
+
+	return payload, valid
+}
+
+// processLine parses a line of slider or button data and triggers events, returning false for lines it doesn't understand
+func (sd *serialDevice) processLine(line string) bool {
+	if match := expectedButtonLinePattern.FindStringSubmatch(line); match != nil {
+		buttonID, _ := strconv.Atoi(match[1])
+		sd.processButtonPress(buttonID)
+		return true
+	}
+
+	if !expectedLinePattern.MatchString(line) {
+		return false
+	}
+
+	values := strings.Split(line, "|")
+	rawValues := make([]int, len(values))
+
+	for i, val := range values {
+		rawValue, err := strconv.Atoi(val)
+		if err != nil || rawValue > sd.info.sliderMaxValue() {
+			sd.logger.Debugw("Invalid slider value", "value", val, "line", line)
+			return false
+		}
+
+		rawValues[i] = rawValue
+	}
+
+	sd.processSliderValues(rawValues)
+	return true
+}
+
+// processButtonPress triggers an event for a press of one of the board's buttons
+func (sd *serialDevice) processButtonPress(buttonID int) {
+	buttonID += sd.info.SliderOffset
+	sd.logger.Debugw("Button pressed", "button", buttonID)
+
+	sd.sio.notifyButtonPress(ButtonPressEvent{buttonID})
+}
+
+// processSliderValues applies a full set of raw slider values (0 to slider_max_value), subject to the update rate limit
+func (sd *serialDevice) processSliderValues(rawValues []int) {
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	if !sd.acceptSliderCount(len(rawValues)) {
+		return
+	}
+
+	interval := sd.sio.config.minSliderUpdateInterval()
+	if interval == 0 {
+		sd.applySliderValues(rawValues)
+		return
+	}
+
+	// too soon after the last update, so hold on to the newest values until it's time for the next one
+	if wait := interval - time.Since(sd.lastSliderUpdate); wait > 0 {
+		sd.throttledValues = rawValues
+
+		if !sd.throttledUpdating {
+			sd.throttledUpdating = true
+			time.AfterFunc(wait, sd.applyThrottledSliderValues)
+		}
+
+		return
+	}
+
+	sd.lastSliderUpdate = time.Now()
+	sd.applySliderValues(rawValues)
+}
+
+// applyThrottledSliderValues applies the newest slider values that were held back by the update rate limit
+func (sd *serialDevice) applyThrottledSliderValues() {
+	defer util.Recover(sd.sio.routines.onPanic)
+
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	rawValues := sd.throttledValues
+	sd.throttledValues = nil
+	sd.throttledUpdating = false
+
+	// the slider count may have changed since, leaving these values stale
+	if len(rawValues) != sd.lastKnownNumSliders {
+		return
+	}
+
+	sd.lastSliderUpdate = time.Now()
+	sd.applySliderValues(rawValues)
+}
+
+// applySliderValues triggers events for sliders whose raw values differ enough from their current ones.
+// sliderLock must be held.
+func (sd *serialDevice) applySliderValues(rawValues []int) {
+	config := sd.sio.config
+	maxValue := float64(sd.info.sliderMaxValue())
+
+	var events []SliderMoveEvent
+	for i, rawValue := range rawValues {
+		scaledValue := config.normalizeSliderValue(float32(float64(rawValue) / maxValue))
+		if config.InvertSliders {
+			scaledValue = 1 - scaledValue
+		}
+
+		scaledValue, ok := sd.limitSliderValue(i, scaledValue)
+		if !ok {
+			continue
+		}
+
+		scaledValue = sd.filterSliderValue(i, scaledValue)
+
+		if config.sliderMoved(sd.currentSliderPercentValues[i], scaledValue) {
+			sd.currentSliderPercentValues[i] = scaledValue
+			events = append(events, SliderMoveEvent{sd.info.SliderOffset + i, scaledValue})
+		}
+	}
+
+	for _, event := range events {
+		sd.sio.notifySliderMove(event)
+	}
+}
+
+// limitSliderValue applies slider_safety to a slider's new value, returning false if it should be ignored for now.
+// sliderLock must be held.
+func (sd *serialDevice) limitSliderValue(sliderIdx int, value float32) (float32, bool) {
+	current := sd.currentSliderPercentValues[sliderIdx]
+	safety := sd.sio.config.SliderSafety
+
+	// nothing to compare the first reading to
+	if current < 0 {
+		return value, true
+	}
+
+	// a confirmed jump keeps stepping toward where the slider is, without counting as a new jump on the way there
+	if target, ok := sd.confirmedJumps[sliderIdx]; ok {
+		if math.Abs(float64(value-target)) <= float64(safety.SpikeThreshold) {
+			return sd.stepSliderValue(sliderIdx, current, value), true
+		}
+
+		// the slider moved somewhere else in the meantime
+		delete(sd.confirmedJumps, sliderIdx)
+	}
+
+	jumped := safety.SpikeThreshold > 0 && math.Abs(float64(value-current)) > float64(safety.SpikeThreshold)
+
+	if jumped && !sd.unconfirmedJumps[sliderIdx] {
+		sd.unconfirmedJumps[sliderIdx] = true
+		sd.logger.Debugw("Ignoring slider jump until the next reading confirms it",
+			"slider", sd.info.SliderOffset+sliderIdx,
+			"from", current,
+			"to", value)
+
+		return 0, false
+	}
+
+	// the previous reading jumped, but this one went back to where the slider was
+	if !jumped && sd.unconfirmedJumps[sliderIdx] {
+		sd.sio.rejectedSpikes.Add(1)
+	}
+
+	delete(sd.unconfirmedJumps, sliderIdx)
+
+	return sd.stepSliderValue(sliderIdx, current, value), true
+}
+
+// stepSliderValue moves a slider from its current value toward a new one by at most slider_safety.max_step,
+// remembering where it's headed until it gets there.
+// sliderLock must be held.
+func (sd *serialDevice) stepSliderValue(sliderIdx int, current float32, value float32) float32 {
+	maxStep := sd.sio.config.SliderSafety.MaxStep
+	delta := value - current
+
+	if maxStep <= 0 || (delta <= maxStep && delta >= -maxStep) {
+		delete(sd.confirmedJumps, sliderIdx)
+		return value
+	}
+
+	sd.confirmedJumps[sliderIdx] = value
+
+	if delta > 0 {
+		return current + maxStep
+	}
+
+	return current - maxStep
+}
+
+// sliderFilterState is what slider_filter remembers about a slider between readings
+type sliderFilterState struct {
+	smoothed float32 // the moving average of its readings
+	settled  float32 // where it last moved past the hysteresis to
+}
+
+// filterSliderValue applies slider_filter to a slider's new value: smoothing first, then hysteresis.
+// sliderLock must be held.
+func (sd *serialDevice) filterSliderValue(sliderIdx int, value float32) float32 {
+	info := sd.sio.config.SliderFilter.forSlider(sd.info.SliderOffset + sliderIdx)
+	if !info.enabled() {
+		delete(sd.filters, sliderIdx)
+		return value
+	}
+
+	state, ok := sd.filters[sliderIdx]
+	if !ok {
+		sd.filters[sliderIdx] = &sliderFilterState{smoothed: value, settled: value}
+		return value
+	}
+
+	state.smoothed += (1 - info.Smoothing) * (value - state.smoothed)
+
+	// the average only ever approaches the reading, so it's snapped to it once the difference can't be heard
+	if math.Abs(float64(value-state.smoothed)) < sliderFilterSnapDistance {
+		state.smoothed = value
+	}
+
+	// the ends always get through, so the slider can still reach them
+	if math.Abs(float64(state.smoothed-state.settled)) >= float64(info.Hysteresis) ||
+		state.smoothed == 0 || state.smoothed == 1 {
+		state.settled = state.smoothed
+	}
+
+	return sd.sio.config.normalizeSliderValue(state.settled)
+}
+
+// sliderValues returns a copy of the current slider values, with -1 for sliders that haven't reported yet
+func (sd *serialDevice) sliderValues() []float32 {
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	values := make([]float32, len(sd.currentSliderPercentValues))
+	copy(values, sd.currentSliderPercentValues)
+
+	return values
+}
+
+// numSliders returns how many sliders the board reported last, or 0 if it hasn't yet
+func (sd *serialDevice) numSliders() int {
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	return sd.lastKnownNumSliders
+}
+
+// resetSliders makes the next line count as the first one, sending every slider's value again
+func (sd *serialDevice) resetSliders() {
+	sd.sliderLock.Lock()
+	defer sd.sliderLock.Unlock()
+
+	sd.lastKnownNumSliders = 0
+}
+
+// acceptSliderCount tracks the number of sliders the board reports, returning false while a line's slider count
+// differs from the known one and hasn't been confirmed by enough following lines yet. Once a new count is accepted,
+// sliders that existed before keep their values, so only the added ones (and any that moved) trigger events.
+// sliderLock must be held.
+func (sd *serialDevice) acceptSliderCount(numSliders int) bool {
+	if numSliders == sd.lastKnownNumSliders {
+		sd.pendingNumSliders = 0
+		sd.pendingNumSlidersLines = 0
+		return true
+	}
+
+	// the first line after connecting or a config reload is trusted right away, and sends every value
+	if sd.lastKnownNumSliders == 0 {
+		sd.logger.Infow("Slider count updated", "count", numSliders)
+		sd.lastKnownNumSliders = numSliders
+		clear(sd.unconfirmedJumps)
+		clear(sd.confirmedJumps)
+		clear(sd.filters)
+		sd.currentSliderPercentValues = make([]float32, numSliders)
+		for i := range sd.currentSliderPercentValues {
+			sd.currentSliderPercentValues[i] = -1.0
+		}
+
+		sd.checkSliderMapping(numSliders)
+
+		return true
+	}
+
+	if numSliders != sd.pendingNumSliders {
+		sd.pendingNumSliders = numSliders
+		sd.pendingNumSlidersLines = 0
+	}
+
+	sd.pendingNumSlidersLines++
+	if sd.pendingNumSlidersLines < sliderCountChangeLines {
+		sd.logger.Debugw("Ignoring line with a different slider count until it's confirmed",
+			"count", numSliders,
+			"knownCount", sd.lastKnownNumSliders)
+
+		return false
+	}
+
+	sd.logger.Infow("Slider count updated", "count", numSliders, "previousCount", sd.lastKnownNumSliders)
+
+	values := make([]float32, numSliders)
+	for i := range values {
+		values[i] = -1.0
+		if i < len(sd.currentSliderPercentValues) {
+			values[i] = sd.currentSliderPercentValues[i]
+		}
+	}
+
+	sd.lastKnownNumSliders = numSliders
+	sd.currentSliderPercentValues = values
+	sd.pendingNumSliders = 0
+	sd.pendingNumSlidersLines = 0
+
+	sd.checkSliderMapping(numSliders)
+
+	return true
+}
+
+// checkSliderMapping warns about slider_mapping entries meant for this board that it has no sliders for, which
+// never fire. Usually the mapping counts from 1 instead of 0, or sliders were added to it but not to the board.
+// sliderLock must be held.
+func (sd *serialDevice) checkSliderMapping(numSliders int) {
+	unreachable := unreachableSliders(sd.sio.config, sd.info.SliderOffset, numSliders)
+	if len(unreachable) == 0 {
+		sd.notifiedUnreachable = ""
+		return
+	}
+
+	sd.logger.Warnw("Board has fewer sliders than slider_mapping uses, some mappings will never fire",
+		"count", numSliders,
+		"unreachable", unreachable)
+
+	described := fmt.Sprint(unreachable)
+	if described == sd.notifiedUnreachable {
+		return
+	}
+	sd.notifiedUnreachable = described
+
+	first, last := sd.info.SliderOffset, sd.info.SliderOffset+numSliders-1
+	message := tr("notify.unreachableSlidersMessage",
+		"count", numSliders, "first", first, "last", last, "sliders", describeSliderIdxs(unreachable))
+
+	// notifications can take a moment, and lines keep coming in
+	util.Go(sd.sio.routines.onPanic, func() {
+		sd.sio.config.notifier.Notify(tr("notify.unreachableSliders"), message)
+	})
+}
+
+// unreachableSliders returns the mapped sliders, in order, that fall between a board's last slider and the first
+// slider of the next board, if any
+func unreachableSliders(config *CanonicalConfig, sliderOffset int, numSliders int) []int {
+	nextOffset := math.MaxInt
+	for _, device := range config.Devices {
+		if device.SliderOffset > sliderOffset && device.SliderOffset < nextOffset {
+			nextOffset = device.SliderOffset
+		}
+	}
+
+	var unreachable []int
+	config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		if sliderIdx >= sliderOffset+numSliders && sliderIdx < nextOffset && len(targets) > 0 && !config.DisabledSliders[sliderIdx] {
+			unreachable = append(unreachable, sliderIdx)
+		}
+	})
+
+	sort.Ints(unreachable)
+
+	return unreachable
+}
+
+// describeSliderIdxs lists slider indices for a notification, e.g. "slider 4" or "sliders 4, 5 and 7"
+func describeSliderIdxs(sliderIdxs []int) string {
+	if len(sliderIdxs) == 1 {
+		return fmt.Sprintf("slider %d", sliderIdxs[0])
+	}
+
+	words := make([]string, len(sliderIdxs))
+	for i, sliderIdx := range sliderIdxs {
+		words[i] = strconv.Itoa(sliderIdx)
+	}
+
+	return fmt.Sprintf("sliders %s and %s", strings.Join(words[:len(words)-1], ", "), words[len(words)-1])
+}
+
+// writeLine sends a line of data to the board
+func (sd *serialDevice) writeLine(line string) error {
+	sd.writeLock.Lock()
+	defer sd.writeLock.Unlock()
+
+	if sd.conn == nil {
+		return errors.New("serial: not connected")
+	}
+
+	if _, err := io.WriteString(sd.conn, line+"\r\n"); err != nil {
+		return fmt.Errorf("write to serial: %w", err)
+	}
+
+	sd.sio.capture.record(sd.sio.config.SerialCapture, captureSent, line)
+
+	return nil
+}
+
+// closeConnection handles the safe closure of the serial connection, returning false if it was already closed
+func (sd *serialDevice) closeConnection() bool {
+	sd.writeLock.Lock()
+	if sd.conn == nil {
+		sd.writeLock.Unlock()
+		return false
+	}
+
+	if err := sd.conn.Close(); err != nil {
+		sd.logger.Warnw("Error closing serial connection", "error", err)
+	} else {
+		sd.logger.Debug("Serial connection closed")
+	}
+
+	sd.conn = nil
+	sd.connected.Store(false)
+	sd.writeLock.Unlock()
+
+	sd.sio.disconnects.Add(1)
+	sd.sio.connectedDevices.Add(-1)
+	sd.sio.notifyConnectionStateChange()
+
+	return true
+}
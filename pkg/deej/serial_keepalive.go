@@ -0,0 +1,67 @@
+package deej
+
+import (
+	"context"
+	"time"
+)
+
+// With keepalive enabled, deej sends keepalivePingLine to each board every keepaliveInterval, and boards that
+// support it answer with keepalivePongLine (or a binaryFramePong in binary mode). Once a board has answered, it
+// has to keep sending something, be it slider data or pongs, or it's disconnected after keepaliveTimeout.
+// Reads on a wedged or unplugged board can otherwise block forever on some platforms.
+// Boards that never answer are only pinged, since older firmware has no reason to.
+const (
+	keepalivePingLine = "deej:ping"
+	keepalivePongLine = "deej:pong"
+
+	keepaliveInterval = 500 * time.Millisecond
+	keepaliveTimeout  = 2 * time.Second
+)
+
+// markReceived notes that the board just sent something
+func (sd *serialDevice) markReceived() {
+	sd.lastReceived.Store(time.Now().UnixNano())
+}
+
+// keepalive pings the board until the connection's read loop returns, closing the connection
+// if a board that answered pings before stops sending anything
+func (sd *serialDevice) keepalive(ctx context.Context, readLoopDone <-chan struct{}) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-readLoopDone:
+			return
+		case <-ticker.C:
+		}
+
+		if !sd.sio.config.Keepalive {
+			continue
+		}
+
+		if sd.answersPings.Load() {
+			silence := time.Since(time.Unix(0, sd.lastReceived.Load()))
+
+			if silence > keepaliveTimeout {
+				sd.logger.Warnw("Board stopped responding, closing serial connection", "silence", silence.Round(time.Millisecond))
+				sd.sio.keepaliveTimeouts.Add(1)
+				sd.closeConnection()
+				return
+			}
+		}
+
+		if err := sd.writeLine(keepalivePingLine); err != nil {
+			sd.logger.Debugw("Failed to send keepalive ping", "error", err)
+		}
+	}
+}
+
+// receivedPong handles the board's answer to a ping
+func (sd *serialDevice) receivedPong() {
+	if !sd.answersPings.Swap(true) {
+		sd.logger.Debug("Board answers keepalive pings, disconnecting it if it goes quiet from now on")
+	}
+}
@@ -0,0 +1,45 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setModemLines raises or lowers the DTR and RTS lines of an open serial port. Opening a tty raises both,
+// so a board that resets on DTR still resets once as the port opens
+func setModemLines(conn io.ReadWriteCloser, dtr SerialLineState, rts SerialLineState) error {
+	file, ok := conn.(*os.File)
+	if !ok {
+		return errors.New("not a serial port")
+	}
+
+	fd := int(file.Fd())
+
+	for _, line := range []struct {
+		name  string
+		state SerialLineState
+		bit   int
+	}{
+		{"DTR", dtr, unix.TIOCM_DTR},
+		{"RTS", rts, unix.TIOCM_RTS},
+	} {
+		var err error
+
+		switch line.state {
+		case SerialLineHigh:
+			err = unix.IoctlSetPointerInt(fd, unix.TIOCMBIS, line.bit)
+		case SerialLineLow:
+			err = unix.IoctlSetPointerInt(fd, unix.TIOCMBIC, line.bit)
+		}
+
+		if err != nil {
+			return fmt.Errorf("set %s: %w", line.name, err)
+		}
+	}
+
+	return nil
+}
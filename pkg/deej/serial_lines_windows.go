@@ -0,0 +1,59 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"golang.org/x/sys/windows"
+)
+
+// setModemLines raises or lowers the DTR and RTS lines of an open serial port. go-serial raises DTR while
+// opening the port, so a board that resets on DTR still resets once as the port opens
+func setModemLines(conn io.ReadWriteCloser, dtr SerialLineState, rts SerialLineState) error {
+	handle, err := serialPortHandle(conn)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range []struct {
+		name  string
+		state SerialLineState
+		set   uint32
+		clear uint32
+	}{
+		{"DTR", dtr, windows.SETDTR, windows.CLRDTR},
+		{"RTS", rts, windows.SETRTS, windows.CLRRTS},
+	} {
+		var err error
+
+		switch line.state {
+		case SerialLineHigh:
+			err = windows.EscapeCommFunction(handle, line.set)
+		case SerialLineLow:
+			err = windows.EscapeCommFunction(handle, line.clear)
+		}
+
+		if err != nil {
+			return fmt.Errorf("set %s: %w", line.name, err)
+		}
+	}
+
+	return nil
+}
+
+// serialPortHandle digs the handle out of a port opened by go-serial, which doesn't expose it
+func serialPortHandle(conn io.ReadWriteCloser) (windows.Handle, error) {
+	value := reflect.ValueOf(conn)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return 0, errors.New("not a serial port")
+	}
+
+	field := value.Elem().FieldByName("fd")
+	if field.Kind() != reflect.Uintptr {
+		return 0, errors.New("not a serial port")
+	}
+
+	return windows.Handle(field.Uint()), nil
+}
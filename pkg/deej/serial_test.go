@@ -0,0 +1,518 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+func TestProcessLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		invert   bool
+		offset   int
+		maxValue int
+		highRes  bool
+		disabled map[int]bool
+		lines    []string
+		wantOK   bool // for the last line
+		want     []SliderMoveEvent
+		buttons  []ButtonPressEvent
+	}{
+		{
+			name:   "first line moves every slider",
+			lines:  []string{"0|1023|512"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0}, {1, 1}, {2, 0.5}},
+		},
+		{
+			name:   "unchanged sliders stay quiet",
+			lines:  []string{"0|1023", "0|512"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0}, {1, 1}, {1, 0.5}},
+		},
+		{
+			name:   "noise is filtered out",
+			lines:  []string{"512", "520"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0.5}},
+		},
+		{
+			name:   "inverted sliders",
+			invert: true,
+			lines:  []string{"0|1023"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 1}, {1, 0}},
+		},
+		{
+			name:   "slider count change keeps known values",
+			lines:  []string{"512", "512|512", "512|512", "512|512"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0.5}, {1, 0.5}},
+		},
+		{
+			name:   "single line with a different slider count is ignored",
+			lines:  []string{"0|0", "1023", "0|1023"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0}, {1, 0}, {1, 1}},
+		},
+		{
+			name:   "slider count change needs lines in a row",
+			lines:  []string{"0|0", "1023", "1023", "0|0", "1023"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{0, 0}, {1, 0}},
+		},
+		{
+			name:   "out of range value",
+			lines:  []string{"1024"},
+			wantOK: false,
+		},
+		{
+			name:   "garbage",
+			lines:  []string{"hello|world"},
+			wantOK: false,
+		},
+		{
+			name:   "empty line",
+			lines:  []string{""},
+			wantOK: false,
+		},
+		{
+			name:    "button press",
+			lines:   []string{"b3"},
+			wantOK:  true,
+			buttons: []ButtonPressEvent{{3}},
+		},
+		{
+			name:   "sliders of a device with an offset",
+			offset: 100,
+			lines:  []string{"0|1023"},
+			wantOK: true,
+			want:   []SliderMoveEvent{{100, 0}, {101, 1}},
+		},
+		{
+			name:    "buttons of a device with an offset",
+			offset:  100,
+			lines:   []string{"b3"},
+			wantOK:  true,
+			buttons: []ButtonPressEvent{{103}},
+		},
+		{
+			name:     "disabled sliders are ignored",
+			disabled: map[int]bool{1: true},
+			lines:    []string{"0|1023|512"},
+			wantOK:   true,
+			want:     []SliderMoveEvent{{0, 0}, {2, 0.5}},
+		},
+		{
+			name:     "firmware sending percents",
+			maxValue: 100,
+			lines:    []string{"0|100|50"},
+			wantOK:   true,
+			want:     []SliderMoveEvent{{0, 0}, {1, 1}, {2, 0.5}},
+		},
+		{
+			name:     "out of range for the slider max value",
+			maxValue: 100,
+			lines:    []string{"101"},
+			wantOK:   false,
+		},
+		{
+			name:     "high resolution keeps small moves",
+			maxValue: 4095,
+			highRes:  true,
+			lines:    []string{"2048", "2070"},
+			wantOK:   true,
+			want:     []SliderMoveEvent{{0, 0.5}, {0, 0.505}},
+		},
+		{
+			name:     "five digit values for a 16-bit slider max value",
+			maxValue: 65535,
+			lines:    []string{"0|65535|32768"},
+			wantOK:   true,
+			want:     []SliderMoveEvent{{0, 0}, {1, 1}, {2, 0.5}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newTestConfig(nil)
+			config.InvertSliders = test.invert
+			config.DisabledSliders = test.disabled
+			config.HighResolution = test.highRes
+
+			sio := newTestSerialIO(t, config, newScriptedPort())
+			device := newSerialDevice(sio, DeviceInfo{SliderOffset: test.offset, SliderMaxValue: test.maxValue})
+			sliderEvents := sio.events.sliderMoved.subscribe()
+			buttonEvents := sio.events.buttonPressed.subscribe()
+
+			var ok bool
+			for _, line := range test.lines {
+				ok = device.processLine(line)
+			}
+
+			if ok != test.wantOK {
+				t.Errorf("processLine(%q) = %t, want %t", test.lines[len(test.lines)-1], ok, test.wantOK)
+			}
+
+			if got := drain(sliderEvents); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("slider events = %v, want %v", got, test.want)
+			}
+
+			if got := drain(buttonEvents); !reflect.DeepEqual(got, test.buttons) {
+				t.Errorf("button events = %v, want %v", got, test.buttons)
+			}
+		})
+	}
+}
+
+func TestSerialIOReplaysPort(t *testing.T) {
+	port := newScriptedPort("0|0", "not a slider line", "1023|0", "b1")
+
+	sio := newTestSerialIO(t, newTestConfig(nil), port)
+	sliderEvents := sio.events.sliderMoved.subscribe()
+	buttonEvents := sio.events.buttonPressed.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	want := []SliderMoveEvent{{0, 0}, {1, 0}, {0, 1}}
+	for _, wantEvent := range want {
+		if got := receive(t, sliderEvents); got != wantEvent {
+			t.Errorf("slider event = %v, want %v", got, wantEvent)
+		}
+	}
+
+	if got := receive(t, buttonEvents); got.ButtonID != 1 {
+		t.Errorf("button event = %v, want button 1", got)
+	}
+
+	if got := sio.parseFailures.Load(); got != 1 {
+		t.Errorf("parse failures = %d, want 1", got)
+	}
+
+	if err := sio.WriteLine("v10|20"); err != nil {
+		t.Errorf("WriteLine: %v", err)
+	}
+
+	sio.Stop()
+
+	if sio.Connected() {
+		t.Error("still connected after Stop")
+	}
+
+	if !reflect.DeepEqual(port.written, []string{"v10|20"}) {
+		t.Errorf("written = %q, want the meter line", port.written)
+	}
+}
+
+func TestSerialIOSliderSafety(t *testing.T) {
+	// a lone jump is ignored, a confirmed one plays out a step at a time
+	port := newScriptedPort("0", "1023", "0", "1023", "1023", "1023")
+
+	config := newTestConfig(nil)
+	config.SliderSafety = SliderSafetyInfo{MaxStep: 0.25, SpikeThreshold: 0.6}
+
+	sio := newTestSerialIO(t, config, port)
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	want := []SliderMoveEvent{{0, 0}, {0, 0.25}, {0, 0.5}}
+	for _, wantEvent := range want {
+		if got := receive(t, sliderEvents); got != wantEvent {
+			t.Errorf("slider event = %v, want %v", got, wantEvent)
+		}
+	}
+
+	if got := sio.rejectedSpikes.Load(); got != 1 {
+		t.Errorf("rejected spikes = %d, want 1", got)
+	}
+
+	sio.Stop()
+}
+
+func TestSerialIOSliderFilter(t *testing.T) {
+	// smoothing eases into a jump, and hysteresis holds back the small wobble that's left
+	port := newScriptedPort("0", "1023", "1023", "1023", "1023", "1023", "1023", "1023", "1023")
+
+	config := newTestConfig(nil)
+	config.SliderFilter = SliderFilterConfig{SliderFilterInfo: SliderFilterInfo{Smoothing: 0.5, Hysteresis: 0.1}}
+
+	sio := newTestSerialIO(t, config, port)
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	want := []SliderMoveEvent{{0, 0}, {0, 0.5}, {0, 0.75}, {0, 0.88}, {0, 0.98}, {0, 1}}
+	for _, wantEvent := range want {
+		if got := receive(t, sliderEvents); got != wantEvent {
+			t.Errorf("slider event = %v, want %v", got, wantEvent)
+		}
+	}
+
+	sio.Stop()
+}
+
+func TestSplitLineChecksum(t *testing.T) {
+	tests := []struct {
+		line            string
+		wantPayload     string
+		wantChecksummed bool
+		wantValid       bool
+	}{
+		{"512|1023", "512|1023", false, false},
+		{"512|1023*40", "512|1023", true, true},
+		{"b1*48", "b1", true, true},
+		{"512|1028*40", "512|1028", true, false},
+		{"512|1023*4", "512|1023", true, false},
+		{"512|1023*zz", "512|1023", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			payload, checksummed, valid := splitLineChecksum(test.line)
+
+			if payload != test.wantPayload || checksummed != test.wantChecksummed || valid != test.wantValid {
+				t.Errorf("splitLineChecksum = %q, %t, %t, want %q, %t, %t",
+					payload, checksummed, valid, test.wantPayload, test.wantChecksummed, test.wantValid)
+			}
+		})
+	}
+}
+
+func TestSerialIODropsBadChecksums(t *testing.T) {
+	// the plain line before the first checksummed one is fine, but once the board sends checksums,
+	// lines without one are as suspect as lines with a bad one
+	port := newScriptedPort("0|0", "1023|0*CD", "0|1023*CD", "0|1023", "b1*48")
+
+	sio := newTestSerialIO(t, newTestConfig(nil), port)
+	sliderEvents := sio.events.sliderMoved.subscribe()
+	buttonEvents := sio.events.buttonPressed.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	want := []SliderMoveEvent{{0, 0}, {1, 0}, {0, 1}}
+	for _, wantEvent := range want {
+		if got := receive(t, sliderEvents); got != wantEvent {
+			t.Errorf("slider event = %v, want %v", got, wantEvent)
+		}
+	}
+
+	if got := receive(t, buttonEvents); got.ButtonID != 1 {
+		t.Errorf("button event = %v, want button 1", got)
+	}
+
+	sio.Stop()
+
+	if got := drain(sliderEvents); len(got) != 0 {
+		t.Errorf("unexpected slider events from dropped lines: %v", got)
+	}
+
+	if got := sio.checksumFailures.Load(); got != 2 {
+		t.Errorf("checksum failures = %d, want 2", got)
+	}
+}
+
+func TestProcessLineThrottlesUpdates(t *testing.T) {
+	config := newTestConfig(nil)
+	config.MaxUpdateRate = 20
+
+	sio := newTestSerialIO(t, config, newScriptedPort())
+	device := newSerialDevice(sio, DeviceInfo{})
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	for _, line := range []string{"0", "512", "1023"} {
+		if !device.processLine(line) {
+			t.Fatalf("processLine(%q) = false", line)
+		}
+	}
+
+	if got := drain(sliderEvents); !reflect.DeepEqual(got, []SliderMoveEvent{{0, 0}}) {
+		t.Errorf("events before the interval passed = %v, want only the first line's", got)
+	}
+
+	if got := receive(t, sliderEvents); got != (SliderMoveEvent{0, 1}) {
+		t.Errorf("throttled event = %v, want the newest value", got)
+	}
+
+	if got := drain(sliderEvents); len(got) != 0 {
+		t.Errorf("unexpected events after the throttled one: %v", got)
+	}
+}
+
+func TestSerialIOMergesDevices(t *testing.T) {
+	config := newTestConfig(nil)
+	config.Devices = []DeviceInfo{
+		{ConnectionInfo: ConnectionInfo{COMPort: "COM7"}},
+		{ConnectionInfo: ConnectionInfo{COMPort: "COM9"}, SliderOffset: 2},
+	}
+
+	ports := map[string]*scriptedPort{
+		"COM7": newScriptedPort("0|0"),
+		"COM9": newScriptedPort("1023"),
+	}
+
+	sio := newTestSerialIO(t, config, nil)
+	sio.openPort = func(options serial.OpenOptions) (io.ReadWriteCloser, error) {
+		return ports[options.PortName], nil
+	}
+
+	sliderEvents := sio.events.sliderMoved.subscribe()
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	got := make(map[SliderMoveEvent]bool)
+	for range 3 {
+		got[receive(t, sliderEvents)] = true
+	}
+
+	want := map[SliderMoveEvent]bool{{0, 0}: true, {1, 0}: true, {2, 1}: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("slider events = %v, want %v", got, want)
+	}
+
+	if err := sio.writeToSlider(2, func(localID int) string { return fmt.Sprintf("f%d|50", localID) }); err != nil {
+		t.Errorf("writeToSlider: %v", err)
+	}
+
+	sio.Stop()
+
+	if written := ports["COM9"].written; !reflect.DeepEqual(written, []string{"f0|50"}) {
+		t.Errorf("written to the second device = %q, want its own slider index", written)
+	}
+
+	if written := ports["COM7"].written; len(written) != 0 {
+		t.Errorf("written to the first device = %q, want nothing", written)
+	}
+}
+
+func TestSerialIOStartsWithoutMissingBoard(t *testing.T) {
+	config := newTestConfig(nil)
+	config.Devices = []DeviceInfo{
+		{ConnectionInfo: ConnectionInfo{COMPort: "COM7"}},
+		{ConnectionInfo: ConnectionInfo{COMPort: "COM9"}, SliderOffset: 2},
+	}
+
+	ports := map[string]*scriptedPort{"COM7": newScriptedPort("0|0")}
+
+	sio := newTestSerialIO(t, config, nil)
+	sio.openPort = func(options serial.OpenOptions) (io.ReadWriteCloser, error) {
+		if port, ok := ports[options.PortName]; ok {
+			return port, nil
+		}
+
+		return nil, fmt.Errorf("open %s: %w", options.PortName, os.ErrNotExist)
+	}
+
+	// one board missing out of two doesn't fail the others
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if !sio.Connected() || !sio.missingDevices() {
+		t.Errorf("connected = %t, missing devices = %t, want both", sio.Connected(), sio.missingDevices())
+	}
+
+	sio.Stop()
+
+	// with every board missing, the error names all of them
+	delete(ports, "COM7")
+
+	err := sio.Start()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Start = %v, want os.ErrNotExist", err)
+	}
+
+	if got, want := failedSerialPorts(err), "COM7, COM9"; got != want {
+		t.Errorf("failed ports = %q, want %q", got, want)
+	}
+}
+
+func TestSerialIODisconnectsQuietBoard(t *testing.T) {
+	config := newTestConfig(nil)
+	config.Keepalive = true
+
+	port := newScriptedPort("0|0", keepalivePongLine)
+	sio := newTestSerialIO(t, config, port)
+
+	if err := sio.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// the board answered once, then went quiet
+	time.Sleep(keepaliveTimeout)
+	waitFor(t, func() bool { return !sio.Connected() })
+
+	if got := sio.keepaliveTimeouts.Load(); got != 1 {
+		t.Errorf("keepalive timeouts = %d, want 1", got)
+	}
+
+	port.lock.Lock()
+	defer port.lock.Unlock()
+
+	if len(port.written) == 0 || port.written[0] != keepalivePingLine {
+		t.Errorf("written = %q, want pings", port.written)
+	}
+}
+
+func TestSerialOpenOptions(t *testing.T) {
+	options := serialOpenOptions(ConnectionInfo{COMPort: "COM7", BaudRate: 9600})
+	if options.DataBits != 8 || options.StopBits != 1 || options.ParityMode != serial.PARITY_NONE {
+		t.Errorf("default options = %d data bits, %d stop bits, parity %d, want 8N1",
+			options.DataBits, options.StopBits, options.ParityMode)
+	}
+
+	options = serialOpenOptions(ConnectionInfo{COMPort: "COM7", BaudRate: 9600, DataBits: 7, StopBits: 2, Parity: "even"})
+	if options.DataBits != 7 || options.StopBits != 2 || options.ParityMode != serial.PARITY_EVEN {
+		t.Errorf("options = %d data bits, %d stop bits, parity %d, want 7E2",
+			options.DataBits, options.StopBits, options.ParityMode)
+	}
+}
+
+func TestUnreachableSliders(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0:   {"master"},
+		3:   {"discord.exe"},
+		4:   {"spotify.exe"},
+		5:   {"chrome.exe"},
+		100: {"mic"},
+		104: {"game.exe"},
+	})
+	config.Devices = []DeviceInfo{{SliderOffset: 0}, {SliderOffset: 100}}
+	config.DisabledSliders = map[int]bool{5: true}
+
+	tests := []struct {
+		name         string
+		sliderOffset int
+		numSliders   int
+		want         []int
+	}{
+		{"first board has every mapped slider", 0, 6, nil},
+		{"first board is short of sliders", 0, 3, []int{3, 4}},
+		{"second board is short of sliders", 100, 4, []int{104}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unreachableSliders(config, test.sliderOffset, test.numSliders); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unreachableSliders = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
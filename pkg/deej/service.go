@@ -0,0 +1,36 @@
+package deej
+
+import (
+	"fmt"
+)
+
+const (
+	// ServiceName identifies deej to the system's service manager
+	ServiceName = "deej"
+
+	serviceDisplayName = "deej"
+	serviceDescription = "Controls audio session volumes with deej's physical sliders"
+)
+
+// serviceState ties the run loop to the service manager while running as a service
+type serviceState struct {
+	// ready and stopping report progress to the service manager
+	ready    func()
+	stopping func()
+
+	// exitChannel receives the exit code once deej stops, instead of exiting the process
+	exitChannel chan int
+}
+
+// RunAsService runs deej under the system's service manager: the Windows service control manager,
+// or systemd on Linux (see InstallService). There's no tray icon in this mode. It returns once deej stops.
+func (d *Deej) RunAsService() error {
+	d.logger.Info("Running as a service")
+
+	if err := d.runAsService(); err != nil {
+		d.logger.Errorw("Service stopped with error", "error", err)
+		return fmt.Errorf("run as service: %w", err)
+	}
+
+	return nil
+}
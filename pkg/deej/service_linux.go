@@ -0,0 +1,151 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const serviceUnitFilename = ServiceName + ".service"
+
+// deej needs the user's audio server, so it runs as a systemd user unit. Type=notify lets systemd know
+// when deej is actually up, see sdNotify, and systemctl reload sends the SIGHUP that reloads the config.
+const serviceUnitTemplate = `[Unit]
+Description=%s
+After=pipewire-pulse.service pulseaudio.service
+
+[Service]
+Type=notify
+WorkingDirectory=%s
+ExecStart=%s --service run
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`
+
+// InstallService installs deej as a systemd user unit and starts it. It runs from the executable's
+// directory, which needs to hold config.yaml. To have it start before logging in, the user also
+// needs lingering enabled (loginctl enable-linger).
+func InstallService() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	unitPath, err := serviceUnitPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return fmt.Errorf("create unit directory: %w", err)
+	}
+
+	unit := fmt.Sprintf(serviceUnitTemplate, serviceDescription, filepath.Dir(executable), executable)
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("write unit file: %w", err)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	return systemctl("enable", "--now", serviceUnitFilename)
+}
+
+// UninstallService stops deej's systemd user unit and removes it
+func UninstallService() error {
+	unitPath, err := serviceUnitPath()
+	if err != nil {
+		return err
+	}
+
+	if err := systemctl("disable", "--now", serviceUnitFilename); err != nil {
+		return err
+	}
+
+	if err := os.Remove(unitPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove unit file: %w", err)
+	}
+
+	return systemctl("daemon-reload")
+}
+
+// runAsService runs normally, with notifications still going to the desktop since user units share the
+// session bus, and keeps systemd posted through sd_notify
+func (d *Deej) runAsService() error {
+	d.service = &serviceState{
+		ready: func() {
+			if err := sdNotify("READY=1"); err != nil {
+				d.logger.Warnw("Failed to notify systemd of startup", "error", err)
+			}
+		},
+		stopping: func() {
+			if err := sdNotify("STOPPING=1"); err != nil {
+				d.logger.Debugw("Failed to notify systemd of shutdown", "error", err)
+			}
+		},
+		exitChannel: make(chan int, 1),
+	}
+
+	if err := d.Initialize(); err != nil {
+		return err
+	}
+
+	if code := <-d.service.exitChannel; code != 0 {
+		return fmt.Errorf("exited with code %d", code)
+	}
+
+	return nil
+}
+
+func serviceUnitPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("get user config directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "systemd", "user", serviceUnitFilename), nil
+}
+
+func systemctl(args ...string) error {
+	args = append([]string{"--user"}, args...)
+
+	if output, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// sdNotify sends a state update to systemd, if it's waiting for one (see sd_notify(3))
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	// abstract socket
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("write to notify socket: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// how long Windows waits before restarting deej after it crashes
+	serviceRestartDelay = 5 * time.Second
+
+	// event IDs don't mean anything for sources installed with eventlog.InstallAsEventCreate
+	serviceEventID = 1
+)
+
+// InstallService registers deej as a Windows service that starts automatically with Windows, and starts it.
+// It runs from the executable's directory, which needs to hold config.yaml. Requires administrator rights.
+func InstallService() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager (try running as administrator): %w", err)
+	}
+	defer manager.Disconnect()
+
+	if service, err := manager.OpenService(ServiceName); err == nil {
+		service.Close()
+		return fmt.Errorf("service %s is already installed", ServiceName)
+	}
+
+	service, err := manager.CreateService(ServiceName, executable, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, "--service", "run")
+	if err != nil {
+		return fmt.Errorf("create service: %w", err)
+	}
+	defer service.Close()
+
+	if err := service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: serviceRestartDelay},
+	}, 0); err != nil {
+		return fmt.Errorf("set service recovery actions: %w", err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(ServiceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		service.Delete()
+		return fmt.Errorf("register event log source: %w", err)
+	}
+
+	if err := service.Start(); err != nil {
+		return fmt.Errorf("start service: %w", err)
+	}
+
+	return nil
+}
+
+// UninstallService stops deej's Windows service and removes it. Requires administrator rights.
+func UninstallService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager (try running as administrator): %w", err)
+	}
+	defer manager.Disconnect()
+
+	service, err := manager.OpenService(ServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", ServiceName)
+	}
+	defer service.Close()
+
+	// the service may well be stopped already
+	service.Control(svc.Stop)
+
+	if err := service.Delete(); err != nil {
+		return fmt.Errorf("delete service: %w", err)
+	}
+
+	if err := eventlog.Remove(ServiceName); err != nil {
+		return fmt.Errorf("remove event log source: %w", err)
+	}
+
+	return nil
+}
+
+// runAsService hands control to the service control manager. Services run outside of the user's desktop,
+// so notifications go to the Windows event log instead of toasts.
+func (d *Deej) runAsService() error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("detect service environment: %w", err)
+	}
+
+	if !isService {
+		return errors.New("not started by the service control manager, use --service install instead")
+	}
+
+	notifier, err := newEventLogNotifier(d.logger)
+	if err != nil {
+		return err
+	}
+	defer notifier.close()
+
+	d.notifier.replace(notifier)
+
+	return svc.Run(ServiceName, &windowsService{deej: d})
+}
+
+// windowsService implements svc.Handler
+type windowsService struct {
+	deej *Deej
+}
+
+func (ws *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, statuses chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	statuses <- svc.Status{State: svc.StartPending}
+
+	ws.deej.service = &serviceState{
+		ready: func() {
+			statuses <- svc.Status{State: svc.Running, Accepts: accepted}
+		},
+		stopping: func() {
+			statuses <- svc.Status{State: svc.StopPending}
+		},
+		exitChannel: make(chan int, 1),
+	}
+
+	initializeErrorChannel := make(chan error, 1)
+	util.Go(ws.deej.handlePanic, func() {
+		if err := ws.deej.Initialize(); err != nil {
+			initializeErrorChannel <- err
+		}
+	})
+
+	for {
+		select {
+		case err := <-initializeErrorChannel:
+			ws.deej.logger.Errorw("Failed to start service", "error", err)
+			return false, 1
+
+		case code := <-ws.deej.service.exitChannel:
+			return false, uint32(code)
+
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				statuses <- request.CurrentStatus
+
+			case svc.Stop, svc.Shutdown:
+				ws.deej.logger.Infow("Service stop requested", "command", request.Cmd)
+				ws.deej.signalStop()
+			}
+		}
+	}
+}
+
+// eventLogNotifier writes notifications to the Windows event log, where services are expected to report problems
+type eventLogNotifier struct {
+	logger *zap.SugaredLogger
+	log    *eventlog.Log
+}
+
+func newEventLogNotifier(logger *zap.SugaredLogger) (*eventLogNotifier, error) {
+	log, err := eventlog.Open(ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+
+	return &eventLogNotifier{logger: logger.Named("notifier"), log: log}, nil
+}
+
+func (en *eventLogNotifier) Notify(title, message string) {
+	if err := en.log.Warning(serviceEventID, fmt.Sprintf("%s %s", title, message)); err != nil {
+		en.logger.Warnw("Failed to write notification to event log", "title", title, "error", err)
+	}
+}
+
+func (en *eventLogNotifier) close() {
+	en.log.Close()
+}
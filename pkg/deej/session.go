@@ -1,28 +1,114 @@
 package deej
 
 import (
+	"errors"
 	"strings"
 
 	"go.uber.org/zap"
 )
 
-// Session represents a single addressable audio session
+// Session represents a single addressable audio session. Anything beyond its volume depends on what the backend
+// supports, so it's left to optional interfaces sessions can implement as well: MuteController, MediaController,
+// PeakMeter, SessionDescriber and IconProvider, along with channelSession for panning and processSession for sessions
+// that belong to a process.
+// Callers type-assert for these instead of sessions faking what they can't do.
 type Session interface {
+	VolumeController
+
+	// Key returns a unique identifier for the session.
+	Key() string
+
+	// ID returns an identifier the backend keeps for as long as the session exists, which unlike the key tells apart
+	// sessions of the same app. Refreshes keep sessions whose ID they find again; an empty ID is never kept.
+	ID() string
+
+	// Release releases any resources associated with the session.
+	Release()
+}
+
+// VolumeController is implemented by every session
+type VolumeController interface {
 	// GetVolume returns the current volume of the session.
 	GetVolume() float32
 
 	// SetVolume adjusts the session's volume to the specified value.
 	SetVolume(v float32) error
+}
 
-	// TODO: future mute support
-	// GetMute() bool
-	// SetMute(m bool) error
+// MuteController is implemented by sessions that can be muted
+type MuteController interface {
+	// GetMute returns whether the session is currently muted.
+	GetMute() bool
 
-	// Key returns a unique identifier for the session.
-	Key() string
+	// SetMute mutes or unmutes the session, leaving its volume untouched.
+	SetMute(m bool) error
+}
 
-	// Release releases any resources associated with the session.
-	Release()
+// MediaController is implemented by sessions whose app's playback can be controlled
+type MediaController interface {
+	PlayPause() error
+	Next() error
+	Previous() error
+	Stop() error
+}
+
+// PeakMeter is implemented by sessions whose audio level can be metered
+type PeakMeter interface {
+	// GetPeak returns the session's current peak audio level between 0 and 1.
+	GetPeak() float32
+}
+
+// SessionDescriber is implemented by sessions that can describe themselves better than their key does,
+// for UIs to show e.g. "Spotify" instead of "spotify.exe"
+type SessionDescriber interface {
+	// DisplayName returns the session's name as the OS would show it, or "" if it has none.
+	DisplayName() string
+
+	// IconPath returns where the session's icon can be found, such as "C:\path\to\app.exe,0" (an executable
+	// and the icon's index in it) on Windows, or "" if it has none.
+	IconPath() string
+}
+
+// IconProvider is implemented by sessions that can show the icon of the app behind them
+type IconProvider interface {
+	// Icon returns the app's icon as PNG data, or errNoIcon if it has none.
+	Icon() ([]byte, error)
+}
+
+var (
+	errMuteUnsupported  = errors.New("session can't be muted")
+	errMediaUnsupported = errors.New("session's playback can't be controlled")
+	errNoIcon           = errors.New("session has no icon")
+)
+
+// sessionIconSize is the size of session icons in pixels, where the OS lets us pick one
+const sessionIconSize = 64
+
+// sessionDisplayName returns the session's display name, or its key if it has none
+func sessionDisplayName(session Session) string {
+	if describer, ok := session.(SessionDescriber); ok {
+		if displayName := describer.DisplayName(); displayName != "" {
+			return displayName
+		}
+	}
+
+	return session.Key()
+}
+
+// sessionIcon returns the session's icon as PNG data, or errNoIcon if it has none
+func sessionIcon(session Session) ([]byte, error) {
+	iconProvider, ok := session.(IconProvider)
+	if !ok {
+		return nil, errNoIcon
+	}
+
+	return iconProvider.Icon()
+}
+
+// sessionIsMuted returns whether the session is muted, which sessions that can't be muted never are
+func sessionIsMuted(session Session) bool {
+	muteController, ok := session.(MuteController)
+	return ok && muteController.GetMute()
 }
 
 const (
@@ -64,4 +150,4 @@ func (s *baseSession) Release() {
 	// Base session might not require specific cleanup, but this ensures that child sessions
 	// can override and add their cleanup logic.
 	s.logger.Debug("Releasing base session")
-}
\ No newline at end of file
+}
@@ -0,0 +1,167 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	shlwapi                  = syscall.NewLazyDLL("shlwapi.dll")
+	procSHLoadIndirectString = shlwapi.NewProc("SHLoadIndirectString")
+)
+
+// how long a resolved indirect string can be, in UTF-16 code units
+const indirectStringMaxLength = 512
+
+// describe looks up the session's display name and icon the way the volume mixer does: what the app set on the
+// session if anything, and otherwise its executable's description and icon
+func (s *wcaSession) describe() {
+	vtable := s.control.VTable()
+
+	if displayName, err := s.controlString(vtable.GetDisplayName); err != nil {
+		s.logger.Debugw("Failed to get session display name", "error", err)
+	} else {
+		s.displayName = loadIndirectString(displayName)
+	}
+
+	if iconPath, err := s.controlString(vtable.GetIconPath); err != nil {
+		s.logger.Debugw("Failed to get session icon path", "error", err)
+	} else {
+		s.iconPath = iconPath
+	}
+
+	if s.system {
+		if s.displayName == "" {
+			s.displayName = s.humanReadableDesc
+		}
+
+		return
+	}
+
+	if s.displayName != "" && s.iconPath != "" {
+		return
+	}
+
+	executable, err := processImagePath(s.pid)
+	if err != nil {
+		s.logger.Debugw("Failed to get process executable path", "error", err)
+		return
+	}
+
+	if s.displayName == "" {
+		s.displayName = fileDescription(executable)
+	}
+
+	// the executable's first icon, in the "path,index" form apps give icon paths in
+	if s.iconPath == "" {
+		s.iconPath = executable + ",0"
+	}
+}
+
+// controlString calls one of IAudioSessionControl's string getters, which return a string the caller frees.
+// go-wca's own getters neither free it nor handle failures.
+func (s *wcaSession) controlString(method uintptr) (string, error) {
+	var value *uint16
+
+	hr, _, _ := syscall.SyscallN(method, uintptr(unsafe.Pointer(s.control)), uintptr(unsafe.Pointer(&value)))
+	if hr != ole.S_OK {
+		return "", ole.NewError(hr)
+	}
+
+	if value == nil {
+		return "", nil
+	}
+	defer windows.CoTaskMemFree(unsafe.Pointer(value))
+
+	return windows.UTF16PtrToString(value), nil
+}
+
+// loadIndirectString resolves strings that refer to a resource, like "@%SystemRoot%\System32\AudioSrv.Dll,-202",
+// leaving other strings as they are. Strings that can't be resolved are dropped.
+func loadIndirectString(value string) string {
+	if !strings.HasPrefix(value, "@") {
+		return value
+	}
+
+	source, err := windows.UTF16PtrFromString(value)
+	if err != nil {
+		return ""
+	}
+
+	resolved := make([]uint16, indirectStringMaxLength)
+
+	hr, _, _ := procSHLoadIndirectString.Call(
+		uintptr(unsafe.Pointer(source)),
+		uintptr(unsafe.Pointer(&resolved[0])),
+		uintptr(len(resolved)),
+		0,
+	)
+	if hr != ole.S_OK {
+		return ""
+	}
+
+	return windows.UTF16ToString(resolved)
+}
+
+// processImagePath returns the full path of a process's executable
+func processImagePath(pid uint32) (string, error) {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("open process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	path := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(path))
+
+	if err := windows.QueryFullProcessImageName(process, 0, &path[0], &size); err != nil {
+		return "", fmt.Errorf("query process image name: %w", err)
+	}
+
+	return windows.UTF16ToString(path[:size]), nil
+}
+
+// fileDescription returns the description in an executable's version info, which is usually the app's name
+// (e.g. "Spotify" for Spotify.exe), or "" if it has none
+func fileDescription(path string) string {
+	size, err := windows.GetFileVersionInfoSize(path, nil)
+	if err != nil || size == 0 {
+		return ""
+	}
+
+	info := make([]byte, size)
+	if err := windows.GetFileVersionInfo(path, 0, size, unsafe.Pointer(&info[0])); err != nil {
+		return ""
+	}
+
+	// the version info's strings are stored per language and code page, listed as pairs of 16-bit values
+	var translations unsafe.Pointer
+	var translationsSize uint32
+
+	err = windows.VerQueryValue(unsafe.Pointer(&info[0]), `\VarFileInfo\Translation`, unsafe.Pointer(&translations), &translationsSize)
+	if err != nil || translationsSize < 4 {
+		return ""
+	}
+
+	language := *(*uint16)(translations)
+	codePage := *(*uint16)(unsafe.Add(translations, 2))
+
+	var description *uint16
+	var descriptionSize uint32
+
+	subBlock := fmt.Sprintf(`\StringFileInfo\%04x%04x\FileDescription`, language, codePage)
+	if err := windows.VerQueryValue(unsafe.Pointer(&info[0]), subBlock, unsafe.Pointer(&description), &descriptionSize); err != nil {
+		return ""
+	}
+
+	if description == nil || descriptionSize == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(windows.UTF16PtrToString(description))
+}
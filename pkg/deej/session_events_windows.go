@@ -0,0 +1,165 @@
+package deej
+
+import (
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	wca "github.com/moutend/go-wca"
+)
+
+// volumeEvents is a COM object that WASAPI calls whenever a session's volume changes, implementing
+// IAudioSessionEvents for process sessions or IAudioEndpointVolumeCallback for master sessions.
+// Process sessions also report through it when they expire.
+// Its vtable pointer comes first, so COM can use a pointer to it as an interface pointer.
+type volumeEvents struct {
+	vtable   unsafe.Pointer
+	refCount int32
+	iid      *ole.GUID
+
+	// changes made with this event context come from deej itself
+	eventCtx *ole.GUID
+	onChange func()
+
+	// nil for master sessions, which go stale instead when the default device changes
+	onExpired func()
+}
+
+// endpointVolumeCallbackVtbl is the vtable of IAudioEndpointVolumeCallback, which go-wca doesn't define
+type endpointVolumeCallbackVtbl struct {
+	ole.IUnknownVtbl
+	OnNotify uintptr
+}
+
+// audioVolumeNotificationData mirrors the start of AUDIO_VOLUME_NOTIFICATION_DATA
+type audioVolumeNotificationData struct {
+	eventContext ole.GUID
+	muted        int32
+	masterVolume float32
+}
+
+// Windows never frees callbacks and only allows a couple thousand of them, so every session shares these
+var (
+	sessionEventsVtbl = &wca.IAudioSessionEventsVtbl{
+		QueryInterface:         syscall.NewCallback(volumeEventsQueryInterface),
+		AddRef:                 syscall.NewCallback(volumeEventsAddRef),
+		Release:                syscall.NewCallback(volumeEventsRelease),
+		OnDisplayNameChanged:   syscall.NewCallback(sessionEventsIgnore2),
+		OnIconPathChanged:      syscall.NewCallback(sessionEventsIgnore2),
+		OnSimpleVolumeChanged:  syscall.NewCallback(sessionEventsOnSimpleVolumeChanged),
+		OnChannelVolumeChanged: syscall.NewCallback(sessionEventsIgnore4),
+		OnGroupingParamChanged: syscall.NewCallback(sessionEventsIgnore2),
+		OnStateChanged:         syscall.NewCallback(sessionEventsOnStateChanged),
+		OnSessionDisconnected:  syscall.NewCallback(sessionEventsOnSessionDisconnected),
+	}
+
+	endpointVolumeEventsVtbl = &endpointVolumeCallbackVtbl{
+		IUnknownVtbl: ole.IUnknownVtbl{
+			QueryInterface: syscall.NewCallback(volumeEventsQueryInterface),
+			AddRef:         syscall.NewCallback(volumeEventsAddRef),
+			Release:        syscall.NewCallback(volumeEventsRelease),
+		},
+		OnNotify: syscall.NewCallback(endpointVolumeEventsOnNotify),
+	}
+)
+
+func newSessionEvents(eventCtx *ole.GUID, onChange func(), onExpired func()) *volumeEvents {
+	return &volumeEvents{
+		vtable:    unsafe.Pointer(sessionEventsVtbl),
+		refCount:  1,
+		iid:       wca.IID_IAudioSessionEvents,
+		eventCtx:  eventCtx,
+		onChange:  onChange,
+		onExpired: onExpired,
+	}
+}
+
+func newEndpointVolumeEvents(eventCtx *ole.GUID, onChange func()) *volumeEvents {
+	return &volumeEvents{
+		vtable:   unsafe.Pointer(endpointVolumeEventsVtbl),
+		refCount: 1,
+		iid:      wca.IID_IAudioEndpointVolumeCallback,
+		eventCtx: eventCtx,
+		onChange: onChange,
+	}
+}
+
+// asSessionEvents returns the object as the interface pointer RegisterAudioSessionNotification expects
+func (e *volumeEvents) asSessionEvents() *wca.IAudioSessionEvents {
+	return (*wca.IAudioSessionEvents)(unsafe.Pointer(e))
+}
+
+func (e *volumeEvents) changed(eventContext *ole.GUID) {
+	if e.onChange == nil || (eventContext != nil && ole.IsEqualGUID(eventContext, e.eventCtx)) {
+		return
+	}
+
+	e.onChange()
+}
+
+func (e *volumeEvents) expired() {
+	if e.onExpired != nil {
+		e.onExpired()
+	}
+}
+
+func volumeEventsQueryInterface(this uintptr, riid *ole.GUID, object *uintptr) uintptr {
+	e := (*volumeEvents)(unsafe.Pointer(this))
+
+	if !ole.IsEqualGUID(riid, ole.IID_IUnknown) && !ole.IsEqualGUID(riid, e.iid) {
+		*object = 0
+		return ole.E_NOINTERFACE
+	}
+
+	volumeEventsAddRef(this)
+	*object = this
+
+	return ole.S_OK
+}
+
+func volumeEventsAddRef(this uintptr) uintptr {
+	e := (*volumeEvents)(unsafe.Pointer(this))
+	return uintptr(atomic.AddInt32(&e.refCount, 1))
+}
+
+// volumeEventsRelease only counts references, since the object is owned by the Go session that created it
+func volumeEventsRelease(this uintptr) uintptr {
+	e := (*volumeEvents)(unsafe.Pointer(this))
+	return uintptr(atomic.AddInt32(&e.refCount, -1))
+}
+
+// sessionEventsOnSimpleVolumeChanged receives the new volume in a floating point register, which Go callbacks
+// can't read, so onChange reads the volume back from the session instead
+func sessionEventsOnSimpleVolumeChanged(this uintptr, newVolume uintptr, newMute uintptr, eventContext *ole.GUID) uintptr {
+	(*volumeEvents)(unsafe.Pointer(this)).changed(eventContext)
+	return ole.S_OK
+}
+
+// sessionEventsOnStateChanged reports sessions that expired, which happens once their process
+// closes its audio streams or exits
+func sessionEventsOnStateChanged(this uintptr, newState uintptr) uintptr {
+	if uint32(newState) == wca.AudioSessionStateExpired {
+		(*volumeEvents)(unsafe.Pointer(this)).expired()
+	}
+
+	return ole.S_OK
+}
+
+// sessionEventsOnSessionDisconnected reports sessions that Windows tore down, e.g. because their device was removed
+func sessionEventsOnSessionDisconnected(this uintptr, reason uintptr) uintptr {
+	(*volumeEvents)(unsafe.Pointer(this)).expired()
+	return ole.S_OK
+}
+
+func endpointVolumeEventsOnNotify(this uintptr, data *audioVolumeNotificationData) uintptr {
+	if data != nil {
+		(*volumeEvents)(unsafe.Pointer(this)).changed(&data.eventContext)
+	}
+
+	return ole.S_OK
+}
+
+// the remaining IAudioSessionEvents methods, by how many arguments they take besides this
+func sessionEventsIgnore2(this uintptr, a, b uintptr) uintptr       { return ole.S_OK }
+func sessionEventsIgnore4(this uintptr, a, b, c, d uintptr) uintptr { return ole.S_OK }
@@ -3,21 +3,43 @@ package deej
 import (
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 
 	"github.com/jfreymuth/pulse/proto"
 	"go.uber.org/zap"
 )
 
+// audioBackendName describes where sessions come from, for crash reports
+const audioBackendName = "PulseAudio"
+
 // paSessionFinder interacts with PulseAudio to discover and manage audio sessions.
 type paSessionFinder struct {
 	logger        *zap.SugaredLogger
 	sessionLogger *zap.SugaredLogger
 	client        *proto.Client
 	conn          net.Conn
+	peaks         *paPeakMonitor
+
+	// the sessions from the last GetAllSessions, by what PulseAudio's events refer to them as
+	lock           sync.Mutex
+	sessionRefs    map[paSessionRef]Session
+	onVolumeChange func(session Session)
+	onNewSession   func()
+
+	// the media.role values of sink inputs that make up the system target, see setSystemRoles. guarded by lock
+	systemRoles map[string]bool
 }
 
-// newSessionFinder initializes a new PulseAudio session finder.
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
+// paSessionRef identifies a session in PulseAudio's subscription events
+type paSessionRef struct {
+	facility proto.SubscriptionEventType
+	index    uint32
+}
+
+// newSessionFinder initializes a new PulseAudio session finder. PulseAudio can be called from any goroutine,
+// so onPanic goes unused.
+func newSessionFinder(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) (SessionFinder, error) {
 	client, conn, err := proto.Connect("")
 	if err != nil {
 		return nil, logAndWrapError(logger, "Failed to establish PulseAudio connection", err)
@@ -37,8 +59,14 @@ func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
 		sessionLogger: logger.Named("sessions"),
 		client:        client,
 		conn:          conn,
+		peaks:         newPAPeakMonitor(logger, client),
+		sessionRefs:   make(map[paSessionRef]Session),
+		systemRoles:   make(map[string]bool),
 	}
 
+	// the client hands everything PulseAudio sends without being asked to a single callback
+	client.Callback = sf.dispatch
+
 	sf.logger.Debug("Initialized PA session finder instance")
 	return sf, nil
 }
@@ -64,6 +92,8 @@ func (sf *paSessionFinder) GetAllSessions() ([]Session, error) {
 		errors = append(errors, logAndWrapError(sf.logger, "Failed to enumerate audio sessions", err))
 	}
 
+	sf.updateSessionRefs(sessions)
+
 	if len(errors) > 0 {
 		return sessions, fmt.Errorf("encountered errors: %v", errors)
 	}
@@ -76,6 +106,97 @@ func (sf *paSessionFinder) Release() error {
 	return logAndWrapError(sf.logger, "Failed to close PulseAudio connection", sf.conn.Close())
 }
 
+// notifyVolumeChanges subscribes to PulseAudio's change events for sinks, sources and sink inputs,
+// passing the sessions they refer to on to onChange
+func (sf *paSessionFinder) notifyVolumeChanges(onChange func(session Session)) {
+	sf.lock.Lock()
+	sf.onVolumeChange = onChange
+	sf.lock.Unlock()
+
+	request := proto.Subscribe{Mask: proto.SubscriptionMaskSink | proto.SubscriptionMaskSource | proto.SubscriptionMaskSinkInput}
+	if err := sf.client.Request(&request, nil); err != nil {
+		sf.logger.Warnw("Failed to subscribe to PulseAudio events, volume changes made elsewhere won't be noticed", "error", err)
+	}
+}
+
+// notifyNewSessions passes sink inputs being created on to onNew, using the subscription notifyVolumeChanges
+// makes, so system sounds can be picked up while they're still playing
+func (sf *paSessionFinder) notifyNewSessions(onNew func()) {
+	sf.lock.Lock()
+	sf.onNewSession = onNew
+	sf.lock.Unlock()
+}
+
+// setSystemRoles sets which media.role values make a sink input part of the system target rather than its app's,
+// since PulseAudio plays each event sound as a stream of its own instead of grouping them like Windows does
+func (sf *paSessionFinder) setSystemRoles(roles []string) {
+	systemRoles := make(map[string]bool)
+	for _, role := range roles {
+		systemRoles[strings.ToLower(role)] = true
+	}
+
+	sf.lock.Lock()
+	sf.systemRoles = systemRoles
+	sf.lock.Unlock()
+}
+
+// dispatch receives everything PulseAudio sends without being asked. It runs on the client's read loop,
+// so it can't make requests of its own; change events are passed on, and everything else goes to the peak monitor.
+func (sf *paSessionFinder) dispatch(message interface{}) {
+	event, ok := message.(*proto.SubscribeEvent)
+	if !ok {
+		sf.peaks.dispatch(message)
+		return
+	}
+
+	if event.Event.GetType() == proto.EventNew && event.Event.GetFacility() == proto.EventSinkSinkInput {
+		sf.lock.Lock()
+		onNew := sf.onNewSession
+		sf.lock.Unlock()
+
+		if onNew != nil {
+			onNew()
+		}
+
+		return
+	}
+
+	if event.Event.GetType() != proto.EventChange {
+		return
+	}
+
+	sf.lock.Lock()
+	session, found := sf.sessionRefs[paSessionRef{facility: event.Event.GetFacility(), index: event.Index}]
+	onChange := sf.onVolumeChange
+	sf.lock.Unlock()
+
+	// a change event doesn't say what changed, so it's up to onChange to check the volume
+	if found && onChange != nil {
+		onChange(session)
+	}
+}
+
+func (sf *paSessionFinder) updateSessionRefs(sessions []Session) {
+	refs := make(map[paSessionRef]Session)
+
+	for _, session := range sessions {
+		switch s := session.(type) {
+		case *paSession:
+			refs[paSessionRef{facility: proto.EventSinkSinkInput, index: s.sinkInputIndex}] = s
+		case *masterSession:
+			facility := proto.EventSource
+			if s.isOutput {
+				facility = proto.EventSink
+			}
+			refs[paSessionRef{facility: facility, index: s.streamIndex}] = s
+		}
+	}
+
+	sf.lock.Lock()
+	sf.sessionRefs = refs
+	sf.lock.Unlock()
+}
+
 // getMasterSinkSession fetches the master sink session.
 func (sf *paSessionFinder) getMasterSinkSession() (Session, error) {
 	return sf.getMasterSession(proto.GetSinkInfo{}, proto.GetSinkInfoReply{}, true)
@@ -94,7 +215,7 @@ func (sf *paSessionFinder) getMasterSession(req, reply proto.Request, isSink boo
 
 	index := getReplyIndex(reply)
 	channels := getReplyChannels(reply)
-	return newMasterSession(sf.sessionLogger, sf.client, index, channels, isSink), nil
+	return newMasterSession(sf.sessionLogger, sf.client, sf.peaks, index, channels, isSink), nil
 }
 
 // enumerateAndAddSessions adds all sink input sessions to the provided slice.
@@ -106,13 +227,42 @@ func (sf *paSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 		return fmt.Errorf("get sink input list: %w", err)
 	}
 
+	sf.lock.Lock()
+	systemRoles := sf.systemRoles
+	sf.lock.Unlock()
+
 	for _, info := range reply {
+		system := false
+		if role, exists := info.Properties["media.role"]; exists {
+			system = systemRoles[strings.ToLower(role.String())]
+		}
+
 		name, exists := info.Properties["application.process.binary"]
+		if !exists && system {
+			// event sounds played from the sample cache don't always say who played them
+			name, exists = info.Properties["application.name"]
+		}
+
 		if !exists {
 			sf.logger.Warnw("Missing process name for sink input", "index", info.SinkInputIndex)
 			continue
 		}
-		*sessions = append(*sessions, newPASession(sf.sessionLogger, sf.client, info.SinkInputIndex, info.Channels, name.String()))
+
+		iconName := ""
+		if icon, exists := info.Properties["application.icon_name"]; exists {
+			iconName = icon.String()
+		}
+
+		*sessions = append(*sessions, newPASession(
+			sf.sessionLogger,
+			sf.client,
+			sf.peaks,
+			info.SinkInputIndex,
+			info.Channels,
+			name.String(),
+			iconName,
+			system,
+		))
 	}
 	return nil
 }
@@ -141,4 +291,4 @@ func getReplyIndex(reply proto.Request) uint32 {
 func getReplyChannels(reply proto.Request) uint8 {
 	// Implement logic for fetching channels from reply
 	return 0
-}
\ No newline at end of file
+}
@@ -17,6 +17,9 @@ type wcaSessionFinder struct {
 	logger        *zap.SugaredLogger
 	sessionLogger *zap.SugaredLogger
 
+	// everything below, and every session the finder creates, is only used on this thread
+	com *comThread
+
 	eventCtx *ole.GUID // Context for audio session notifications
 
 	// Device change notifications
@@ -27,9 +30,17 @@ type wcaSessionFinder struct {
 	// Master input and output sessions
 	masterOut *masterSession
 	masterIn  *masterSession
+
+	// called with sessions whose volume was changed outside deej, or that expired.
+	// see notifyVolumeChanges and notifyExpiredSessions
+	onVolumeChange   func(session Session)
+	onSessionExpired func(session Session)
 }
 
 const (
+	// audioBackendName describes where sessions come from, for crash reports
+	audioBackendName = "WASAPI"
+
 	// Unique GUID for the event context
 	mysteriousGUID = "{1ec920a1-7db8-44ba-9779-e5d28ed9f330}"
 
@@ -40,10 +51,17 @@ const (
 	deviceSessionFormat = "device.%s"
 )
 
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
+func newSessionFinder(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) (SessionFinder, error) {
+	com, err := newCOMThread(logger.Named("com"), onPanic)
+	if err != nil {
+		logger.Warnw("Failed to start COM thread", "error", err)
+		return nil, fmt.Errorf("start COM thread: %w", err)
+	}
+
 	sf := &wcaSessionFinder{
 		logger:        logger.Named("session_finder"),
 		sessionLogger: logger.Named("sessions"),
+		com:           com,
 		eventCtx:      ole.NewGUID(mysteriousGUID),
 	}
 
@@ -53,20 +71,20 @@ func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
 }
 
 func (sf *wcaSessionFinder) GetAllSessions() ([]Session, error) {
-	sessions := []Session{}
+	var sessions []Session
 
-	// Initialize COM
-	err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED)
-	if err != nil {
-		// Handle redundant initialization gracefully
-		if oleErr, ok := err.(*ole.OleError); ok && oleErr.Code() == 1 {
-			sf.logger.Warn("CoInitializeEx called redundantly")
-		} else {
-			sf.logger.Warnw("Failed to initialize COM library", "error", err)
-			return nil, fmt.Errorf("initialize COM: %w", err)
-		}
-	}
-	defer ole.CoUninitialize()
+	err := sf.com.run(func() error {
+		var err error
+		sessions, err = sf.getAllSessions()
+		return err
+	})
+
+	return sessions, err
+}
+
+// getAllSessions does GetAllSessions' work on the COM thread
+func (sf *wcaSessionFinder) getAllSessions() ([]Session, error) {
+	sessions := []Session{}
 
 	// Ensure device enumerator is available
 	if err := sf.getDeviceEnumerator(); err != nil {
@@ -118,17 +136,88 @@ func (sf *wcaSessionFinder) GetAllSessions() ([]Session, error) {
 		return nil, fmt.Errorf("enumerate sessions: %w", err)
 	}
 
+	sf.watchSessions(sessions)
+
 	return sessions, nil
 }
 
-func (sf *wcaSessionFinder) Release() error {
-	if sf.mmDeviceEnumerator != nil {
-		sf.mmDeviceEnumerator.Release()
+// notifyVolumeChanges has sessions acquired from now on report volume changes made outside deej to onChange
+func (sf *wcaSessionFinder) notifyVolumeChanges(onChange func(session Session)) {
+	sf.onVolumeChange = onChange
+}
+
+// notifyExpiredSessions has sessions acquired from now on report to onExpired once their process is done with them
+func (sf *wcaSessionFinder) notifyExpiredSessions(onExpired func(session Session)) {
+	sf.onSessionExpired = onExpired
+}
+
+func (sf *wcaSessionFinder) watchSessions(sessions []Session) {
+	if sf.onVolumeChange == nil && sf.onSessionExpired == nil {
+		return
 	}
+
+	for _, session := range sessions {
+		var onChange, onExpired func()
+		if sf.onVolumeChange != nil {
+			onChange = func() { sf.onVolumeChange(session) }
+		}
+		if sf.onSessionExpired != nil {
+			onExpired = func() { sf.onSessionExpired(session) }
+		}
+
+		var err error
+		switch s := session.(type) {
+		case *wcaSession:
+			err = s.watch(onChange, onExpired)
+		case *masterSession:
+			if onChange != nil {
+				err = s.watchVolume(onChange)
+			}
+		}
+
+		if err != nil {
+			sf.logger.Debugw("Failed to watch session, changes made elsewhere won't be noticed", "session", session, "error", err)
+		}
+	}
+}
+
+func (sf *wcaSessionFinder) Release() error {
+	sf.com.run(func() error {
+		if sf.mmDeviceEnumerator != nil {
+			sf.mmDeviceEnumerator.Release()
+		}
+		return nil
+	})
+
+	sf.com.stop()
+
 	sf.logger.Debug("Released WCA session finder instance")
 	return nil
 }
 
+// reset releases the device enumerator, which is created again the next time sessions are acquired. The one
+// created before the desktop session was disconnected doesn't see the devices of the session after.
+func (sf *wcaSessionFinder) reset() {
+	sf.com.run(func() error {
+		if sf.mmDeviceEnumerator != nil {
+			if sf.mmNotificationClient != nil {
+				sf.mmDeviceEnumerator.UnregisterEndpointNotificationCallback(sf.mmNotificationClient)
+			}
+
+			sf.mmDeviceEnumerator.Release()
+		}
+
+		sf.mmDeviceEnumerator = nil
+		sf.mmNotificationClient = nil
+		sf.masterOut = nil
+		sf.masterIn = nil
+
+		return nil
+	})
+
+	sf.logger.Debug("Reset WCA session finder")
+}
+
 func (sf *wcaSessionFinder) getDeviceEnumerator() error {
 	if sf.mmDeviceEnumerator == nil {
 		if err := wca.CoCreateInstance(
@@ -151,17 +240,23 @@ func (sf *wcaSessionFinder) defaultDeviceChangedCallback(
 	lpcwstr uintptr,
 ) uintptr {
 	now := time.Now()
-	if now.Sub(sf.lastDefaultDeviceChange) < minDefaultDeviceChangeThreshold {
-		return 0
-	}
-	sf.lastDefaultDeviceChange = now
 
-	sf.logger.Debug("Default audio device changed. Marking master sessions as stale.")
-	if sf.masterOut != nil {
-		sf.masterOut.markAsStale()
-	}
-	if sf.masterIn != nil {
-		sf.masterIn.markAsStale()
-	}
+	// Windows calls this on a thread of its own, so the master sessions are marked on the COM thread like everything
+	// else that touches them
+	sf.com.post(func() {
+		if now.Sub(sf.lastDefaultDeviceChange) < minDefaultDeviceChangeThreshold {
+			return
+		}
+		sf.lastDefaultDeviceChange = now
+
+		sf.logger.Debug("Default audio device changed. Marking master sessions as stale.")
+		if sf.masterOut != nil {
+			sf.masterOut.markAsStale()
+		}
+		if sf.masterIn != nil {
+			sf.masterIn.markAsStale()
+		}
+	})
+
 	return 0
-}
\ No newline at end of file
+}
@@ -0,0 +1,79 @@
+package deej
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the icon theme sizes to look in, closest to sessionIconSize first
+var themeIconSizes = []string{"64x64", "48x48", "96x96", "128x128", "256x256", "32x32"}
+
+// Icon looks up the icon the app named for its stream, or failing that, one named after its executable
+func (s *paSession) Icon() ([]byte, error) {
+	s.iconOnce.Do(func() {
+		s.icon, s.iconErr = findThemeIcon(s.iconName, s.processName)
+	})
+
+	return s.icon, s.iconErr
+}
+
+// findThemeIcon reads the first of the named icons it finds as a PNG in the hicolor theme, which every app
+// installs its icons into, or in the older pixmaps directory. Names can also be absolute paths to a PNG.
+func findThemeIcon(names ...string) ([]byte, error) {
+	dataDirs := xdgDataDirs()
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		var candidates []string
+
+		if filepath.IsAbs(name) {
+			if strings.EqualFold(filepath.Ext(name), ".png") {
+				candidates = append(candidates, name)
+			}
+		} else if !strings.ContainsRune(name, filepath.Separator) {
+			for _, dataDir := range dataDirs {
+				for _, size := range themeIconSizes {
+					candidates = append(candidates, filepath.Join(dataDir, "icons", "hicolor", size, "apps", name+".png"))
+				}
+
+				candidates = append(candidates, filepath.Join(dataDir, "pixmaps", name+".png"))
+			}
+		}
+
+		for _, candidate := range candidates {
+			if icon, err := os.ReadFile(candidate); err == nil {
+				return icon, nil
+			}
+		}
+	}
+
+	return nil, errNoIcon
+}
+
+// xdgDataDirs returns the directories apps install their data (including icons) into, most specific first
+func xdgDataDirs() []string {
+	var dirs []string
+
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		dirs = append(dirs, dataHome)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "share"))
+	}
+
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	for _, dir := range filepath.SplitList(dataDirs) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
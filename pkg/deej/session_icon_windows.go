@@ -0,0 +1,268 @@
+package deej
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	shell32               = syscall.NewLazyDLL("shell32.dll")
+	procSHDefExtractIconW = shell32.NewProc("SHDefExtractIconW")
+
+	procGetIconInfo = user32.NewProc("GetIconInfo")
+	procDestroyIcon = user32.NewProc("DestroyIcon")
+
+	gdi32                  = syscall.NewLazyDLL("gdi32.dll")
+	procCreateCompatibleDC = gdi32.NewProc("CreateCompatibleDC")
+	procDeleteDC           = gdi32.NewProc("DeleteDC")
+	procDeleteObject       = gdi32.NewProc("DeleteObject")
+	procGetObjectW         = gdi32.NewProc("GetObjectW")
+	procGetDIBits          = gdi32.NewProc("GetDIBits")
+)
+
+const (
+	biRGB        = 0
+	dibRGBColors = 0
+)
+
+// ICONINFO
+type iconInfo struct {
+	fIcon    int32
+	xHotspot uint32
+	yHotspot uint32
+	hbmMask  windows.Handle
+	hbmColor windows.Handle
+}
+
+// BITMAP
+type bitmap struct {
+	bmType       int32
+	bmWidth      int32
+	bmHeight     int32
+	bmWidthBytes int32
+	bmPlanes     uint16
+	bmBitsPixel  uint16
+	bmBits       uintptr
+}
+
+// BITMAPINFO. 32-bit pixels don't use a color table, so it only has the one entry it's declared with
+type bitmapInfo struct {
+	biSize          uint32
+	biWidth         int32
+	biHeight        int32
+	biPlanes        uint16
+	biBitCount      uint16
+	biCompression   uint32
+	biSizeImage     uint32
+	biXPelsPerMeter int32
+	biYPelsPerMeter int32
+	biClrUsed       uint32
+	biClrImportant  uint32
+	bmiColors       [1]uint32
+}
+
+// Icon extracts the session's icon from its icon path, which usually points into the app's executable
+func (s *wcaSession) Icon() ([]byte, error) {
+	s.iconOnce.Do(func() {
+		if s.iconPath == "" {
+			s.iconErr = errNoIcon
+			return
+		}
+
+		s.icon, s.iconErr = extractIcon(s.iconPath, sessionIconSize)
+	})
+
+	return s.icon, s.iconErr
+}
+
+// extractIcon loads an icon from a "path,index" icon location and encodes it as PNG. Like in other icon
+// locations, a negative index is a resource ID rather than a position, and the path may hold environment variables.
+func extractIcon(location string, size int) ([]byte, error) {
+	path, index := parseIconLocation(location)
+
+	expanded, err := expandEnvironmentStrings(path)
+	if err != nil {
+		return nil, fmt.Errorf("expand icon path: %w", err)
+	}
+
+	pathPtr, err := windows.UTF16PtrFromString(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("convert icon path: %w", err)
+	}
+
+	var icon windows.Handle
+
+	// the large icon's size goes in the low word, and the small one (which we don't ask for) in the high word
+	hr, _, _ := procSHDefExtractIconW.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(index),
+		0,
+		uintptr(unsafe.Pointer(&icon)),
+		0,
+		uintptr(size),
+	)
+	if hr != ole.S_OK || icon == 0 {
+		return nil, errNoIcon
+	}
+	defer procDestroyIcon.Call(uintptr(icon))
+
+	img, err := iconImage(icon)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return nil, fmt.Errorf("encode icon: %w", err)
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// parseIconLocation splits "C:\path\to\app.exe,-101" into its path and index, dropping the "@" indirect strings
+// start with. Locations without an index point at the file's first icon.
+func parseIconLocation(location string) (string, int) {
+	location = strings.TrimPrefix(location, "@")
+
+	separator := strings.LastIndex(location, ",")
+	if separator == -1 {
+		return location, 0
+	}
+
+	index, err := strconv.Atoi(strings.TrimSpace(location[separator+1:]))
+	if err != nil {
+		return location, 0
+	}
+
+	return location[:separator], index
+}
+
+func expandEnvironmentStrings(value string) (string, error) {
+	source, err := windows.UTF16PtrFromString(value)
+	if err != nil {
+		return "", err
+	}
+
+	expanded := make([]uint16, windows.MAX_LONG_PATH)
+
+	n, err := windows.ExpandEnvironmentStrings(source, &expanded[0], uint32(len(expanded)))
+	if err != nil {
+		return "", err
+	}
+
+	if int(n) > len(expanded) {
+		return "", fmt.Errorf("expanded path is too long (%d characters)", n)
+	}
+
+	return windows.UTF16ToString(expanded), nil
+}
+
+// iconImage reads an icon's pixels. Older icons have no alpha channel and mark their transparent pixels
+// in a separate mask instead.
+func iconImage(icon windows.Handle) (image.Image, error) {
+	var info iconInfo
+	if ok, _, err := procGetIconInfo.Call(uintptr(icon), uintptr(unsafe.Pointer(&info))); ok == 0 {
+		return nil, fmt.Errorf("get icon info: %w", err)
+	}
+	defer procDeleteObject.Call(uintptr(info.hbmMask))
+
+	// monochrome icons only have a mask, and look out of place next to anything else
+	if info.hbmColor == 0 {
+		return nil, errNoIcon
+	}
+	defer procDeleteObject.Call(uintptr(info.hbmColor))
+
+	var colorBitmap bitmap
+	if n, _, err := procGetObjectW.Call(
+		uintptr(info.hbmColor),
+		unsafe.Sizeof(colorBitmap),
+		uintptr(unsafe.Pointer(&colorBitmap)),
+	); n == 0 {
+		return nil, fmt.Errorf("get icon bitmap: %w", err)
+	}
+
+	width, height := int(colorBitmap.bmWidth), int(colorBitmap.bmHeight)
+	if width <= 0 || height <= 0 {
+		return nil, errNoIcon
+	}
+
+	dc, _, err := procCreateCompatibleDC.Call(0)
+	if dc == 0 {
+		return nil, fmt.Errorf("create device context: %w", err)
+	}
+	defer procDeleteDC.Call(dc)
+
+	color, err := bitmapPixels(dc, info.hbmColor, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("read icon colors: %w", err)
+	}
+
+	mask, err := bitmapPixels(dc, info.hbmMask, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("read icon mask: %w", err)
+	}
+
+	hasAlpha := false
+	for i := 3; i < len(color); i += 4 {
+		if color[i] != 0 {
+			hasAlpha = true
+			break
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	// pixels come as BGRA, and the mask is white wherever the icon is transparent
+	for i := 0; i < len(color); i += 4 {
+		img.Pix[i] = color[i+2]
+		img.Pix[i+1] = color[i+1]
+		img.Pix[i+2] = color[i]
+
+		switch {
+		case hasAlpha:
+			img.Pix[i+3] = color[i+3]
+		case mask[i] == 0:
+			img.Pix[i+3] = 0xff
+		}
+	}
+
+	return img, nil
+}
+
+// bitmapPixels reads a bitmap as top-down rows of 32-bit BGRA pixels
+func bitmapPixels(dc uintptr, handle windows.Handle, width int, height int) ([]byte, error) {
+	info := bitmapInfo{
+		biWidth:       int32(width),
+		biHeight:      -int32(height),
+		biPlanes:      1,
+		biBitCount:    32,
+		biCompression: biRGB,
+	}
+	info.biSize = uint32(unsafe.Offsetof(info.bmiColors))
+
+	pixels := make([]byte, width*height*4)
+
+	lines, _, err := procGetDIBits.Call(
+		dc,
+		uintptr(handle),
+		0,
+		uintptr(height),
+		uintptr(unsafe.Pointer(&pixels[0])),
+		uintptr(unsafe.Pointer(&info)),
+		dibRGBColors,
+	)
+	if int(lines) != height {
+		return nil, fmt.Errorf("get bitmap bits: %w", err)
+	}
+
+	return pixels, nil
+}
@@ -3,14 +3,14 @@ package deej
 import (
 	"errors"
 	"fmt"
+	"sync"
 
-	"go.uber.org/zap"
 	"github.com/jfreymuth/pulse/proto"
+	"go.uber.org/zap"
 )
 
 // Constants
 const maxVolume = 0x10000
-const sessionCreationLogMessage = "Creating audio session"
 
 // Predefined error
 var errNoSuchProcess = errors.New("no such process")
@@ -19,35 +19,66 @@ var errNoSuchProcess = errors.New("no such process")
 type paSession struct {
 	baseSession
 	processName       string
-	client           *proto.Client
-	sinkInputIndex   uint32
+	client            *proto.Client
+	sinkInputIndex    uint32
 	sinkInputChannels byte
+	channelMap        proto.ChannelMap // set once the session's channel gains have been set
+	leftGain          float32
+	rightGain         float32
+	peaks             *paPeakMonitor
+	peakStream        uint32
+	peakStreamOpen    bool
+
+	iconName string    // application.icon_name, if the app set it
+	iconOnce sync.Once // the icon is only looked up once something asks for it
+	icon     []byte
+	iconErr  error
 }
 
 // masterSession represents a master audio session (either input or output).
 type masterSession struct {
 	baseSession
-	client          *proto.Client
-	streamIndex     uint32
-	streamChannels  byte
-	isOutput        bool
+	client         *proto.Client
+	streamIndex    uint32
+	streamChannels byte
+	channelMap     proto.ChannelMap // set once the session's channel gains have been set
+	leftGain       float32
+	rightGain      float32
+	deviceGains    map[string]float32 // set by channel: targets, by channel name
+	isOutput       bool
+	peaks          *paPeakMonitor
+	peakStream     uint32
+	peakStreamOpen bool
 }
 
 func newPASession(
 	logger *zap.SugaredLogger,
 	client *proto.Client,
+	peaks *paPeakMonitor,
 	sinkInputIndex uint32,
 	sinkInputChannels byte,
 	processName string,
+	iconName string,
+	system bool,
 ) *paSession {
 	s := &paSession{
+		iconName:          iconName,
 		client:            client,
+		peaks:             peaks,
 		sinkInputIndex:    sinkInputIndex,
 		sinkInputChannels: sinkInputChannels,
 		processName:       processName,
+		leftGain:          1,
+		rightGain:         1,
 		name:              processName,
 		humanReadableDesc: processName,
 	}
+
+	// event sounds and the like, which PulseAudio plays as streams of their own rather than one session
+	if system {
+		s.system = true
+		s.humanReadableDesc = fmt.Sprintf("System Sounds (%s)", processName)
+	}
 	s.logger = logger.Named(s.Key())
 	s.logger.Debugw(sessionCreationLogMessage, "session", s)
 	return s
@@ -56,6 +87,7 @@ func newPASession(
 func newMasterSession(
 	logger *zap.SugaredLogger,
 	client *proto.Client,
+	peaks *paPeakMonitor,
 	streamIndex uint32,
 	streamChannels byte,
 	isOutput bool,
@@ -66,11 +98,15 @@ func newMasterSession(
 	}
 
 	s := &masterSession{
-		client:         client,
-		streamIndex:    streamIndex,
-		streamChannels: streamChannels,
-		isOutput:       isOutput,
-		name:           key,
+		client:            client,
+		peaks:             peaks,
+		streamIndex:       streamIndex,
+		streamChannels:    streamChannels,
+		isOutput:          isOutput,
+		leftGain:          1,
+		rightGain:         1,
+		deviceGains:       make(map[string]float32),
+		name:              key,
 		humanReadableDesc: key,
 	}
 
@@ -87,6 +123,10 @@ func (s *paSession) GetVolume() float32 {
 // SetVolume sets the volume for the session.
 func (s *paSession) SetVolume(v float32) error {
 	volumes := createChannelVolumes(s.sinkInputChannels, v)
+	if s.channelMap != nil {
+		volumes = balancedChannelVolumes(s.channelMap, v, s.leftGain, s.rightGain, nil)
+	}
+
 	request := proto.SetSinkInputVolume{
 		SinkInputIndex: s.sinkInputIndex,
 		ChannelVolumes: volumes,
@@ -98,9 +138,96 @@ func (s *paSession) SetVolume(v float32) error {
 	return nil
 }
 
+// setChannelGains spreads the session's volume over its channels, which later volume changes keep to.
+func (s *paSession) setChannelGains(left float32, right float32) error {
+	var info proto.GetSinkInputInfoReply
+	if err := s.client.Request(&proto.GetSinkInputInfo{SinkInputIndex: s.sinkInputIndex}, &info); err != nil {
+		return fmt.Errorf("get session channels: %w", err)
+	}
+
+	s.channelMap = info.ChannelMap
+	s.leftGain, s.rightGain = left, right
+
+	request := proto.SetSinkInputVolume{
+		SinkInputIndex: s.sinkInputIndex,
+		ChannelVolumes: balancedChannelVolumes(s.channelMap, parseChannelVolumes(info.ChannelVolumes), left, right, nil),
+	}
+	if err := s.client.Request(&request, nil); err != nil {
+		return fmt.Errorf("adjust session channel gains: %w", err)
+	}
+	s.logger.Debugw("Adjusting session channel gains", "left", fmt.Sprintf("%.2f", left), "right", fmt.Sprintf("%.2f", right))
+	return nil
+}
+
+// channelGains returns the session's channel gains, which are 1 until set
+func (s *paSession) channelGains() (float32, float32) {
+	return s.leftGain, s.rightGain
+}
+
+// GetMute retrieves the current mute state of the session.
+func (s *paSession) GetMute() bool {
+	var reply proto.GetSinkInputInfoReply
+	if err := s.client.Request(&proto.GetSinkInputInfo{SinkInputIndex: s.sinkInputIndex}, &reply); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+	return reply.Muted
+}
+
+// SetMute mutes or unmutes the session.
+func (s *paSession) SetMute(m bool) error {
+	request := proto.SetSinkInputMute{
+		SinkInputIndex: s.sinkInputIndex,
+		Mute:           m,
+	}
+	if err := s.client.Request(&request, nil); err != nil {
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+	return nil
+}
+
+// GetPeak retrieves the current peak level of the session, starting to meter it on first use.
+func (s *paSession) GetPeak() float32 {
+	if !s.peakStreamOpen {
+		var info proto.GetSinkInputInfoReply
+		if err := s.client.Request(&proto.GetSinkInputInfo{SinkInputIndex: s.sinkInputIndex}, &info); err != nil {
+			s.logger.Debugw("Failed to get session sink for metering", "error", err)
+			return 0
+		}
+
+		monitorSourceIndex, err := s.peaks.monitorSourceIndex(info.SinkIndex)
+		if err != nil {
+			s.logger.Debugw("Failed to get monitor source for metering", "error", err)
+			return 0
+		}
+
+		if s.peakStream, err = s.peaks.open(monitorSourceIndex, s.sinkInputIndex); err != nil {
+			s.logger.Debugw("Failed to start metering session", "error", err)
+			return 0
+		}
+		s.peakStreamOpen = true
+	}
+
+	return s.peaks.peak(s.peakStream)
+}
+
 // Release releases the audio session resources.
+// ID returns the sink input's index, which PulseAudio doesn't reuse for a long while
+func (s *paSession) ID() string {
+	// told apart from the app's own streams, so changing system_sound_roles makes the stream a new session
+	if s.system {
+		return fmt.Sprintf("system.sink-input.%d", s.sinkInputIndex)
+	}
+
+	return fmt.Sprintf("sink-input.%d", s.sinkInputIndex)
+}
+
 func (s *paSession) Release() {
 	s.logger.Debug("Releasing audio session")
+	if s.peakStreamOpen {
+		s.peaks.close(s.peakStream)
+	}
 }
 
 // String provides a string representation of the session.
@@ -117,6 +244,9 @@ func (s *masterSession) GetVolume() float32 {
 func (s *masterSession) SetVolume(v float32) error {
 	var request proto.RequestArgs
 	volumes := createChannelVolumes(s.streamChannels, v)
+	if s.channelMap != nil {
+		volumes = balancedChannelVolumes(s.channelMap, v, s.leftGain, s.rightGain, s.deviceGains)
+	}
 	if s.isOutput {
 		request = &proto.SetSinkVolume{
 			SinkIndex:      s.streamIndex,
@@ -135,9 +265,153 @@ func (s *masterSession) SetVolume(v float32) error {
 	return nil
 }
 
+// setChannelGains spreads the master session's volume over its channels, which later volume changes keep to.
+func (s *masterSession) setChannelGains(left float32, right float32) error {
+	channelMap, channelVolumes, err := s.channelInfo()
+	if err != nil {
+		return err
+	}
+
+	s.channelMap = channelMap
+	s.leftGain, s.rightGain = left, right
+
+	// SetVolume picks up the gains, and the volume stays where it was
+	if err := s.SetVolume(parseChannelVolumes(channelVolumes)); err != nil {
+		return fmt.Errorf("adjust session channel gains: %w", err)
+	}
+	s.logger.Debugw("Adjusting session channel gains", "left", fmt.Sprintf("%.2f", left), "right", fmt.Sprintf("%.2f", right))
+	return nil
+}
+
+// channelGains returns the master session's channel gains, which are 1 until set
+func (s *masterSession) channelGains() (float32, float32) {
+	return s.leftGain, s.rightGain
+}
+
+// setDeviceChannelGain sets one of the device's channels relative to its volume, going by its channel map
+func (s *masterSession) setDeviceChannelGain(channel string, gain float32) error {
+	channelMap, channelVolumes, err := s.channelInfo()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, position := range channelMap {
+		if paDeviceChannels[position] == channel {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return errDeviceChannelMissing
+	}
+
+	s.channelMap = channelMap
+	s.deviceGains[channel] = gain
+
+	if err := s.SetVolume(parseChannelVolumes(channelVolumes)); err != nil {
+		return fmt.Errorf("adjust device channel gain: %w", err)
+	}
+	s.logger.Debugw("Adjusting device channel gain", "channel", channel, "to", fmt.Sprintf("%.2f", gain))
+	return nil
+}
+
+// channelInfo gets the master session's channel map and its current channel volumes
+func (s *masterSession) channelInfo() (proto.ChannelMap, proto.ChannelVolumes, error) {
+	if s.isOutput {
+		var info proto.GetSinkInfoReply
+		if err := s.client.Request(&proto.GetSinkInfo{SinkIndex: s.streamIndex}, &info); err != nil {
+			return nil, nil, fmt.Errorf("get session channels: %w", err)
+		}
+		return info.ChannelMap, info.ChannelVolumes, nil
+	}
+
+	var info proto.GetSourceInfoReply
+	if err := s.client.Request(&proto.GetSourceInfo{SourceIndex: s.streamIndex}, &info); err != nil {
+		return nil, nil, fmt.Errorf("get session channels: %w", err)
+	}
+	return info.ChannelMap, info.ChannelVolumes, nil
+}
+
+// GetMute retrieves the current mute state of the master session.
+func (s *masterSession) GetMute() bool {
+	if s.isOutput {
+		var reply proto.GetSinkInfoReply
+		if err := s.client.Request(&proto.GetSinkInfo{SinkIndex: s.streamIndex}, &reply); err != nil {
+			s.logger.Warnw("Failed to get session mute state", "error", err)
+			return false
+		}
+		return reply.Mute
+	}
+
+	var reply proto.GetSourceInfoReply
+	if err := s.client.Request(&proto.GetSourceInfo{SourceIndex: s.streamIndex}, &reply); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+	return reply.Mute
+}
+
+// SetMute mutes or unmutes the master session.
+func (s *masterSession) SetMute(m bool) error {
+	var request proto.RequestArgs
+	if s.isOutput {
+		request = &proto.SetSinkMute{
+			SinkIndex: s.streamIndex,
+			Mute:      m,
+		}
+	} else {
+		request = &proto.SetSourceMute{
+			SourceIndex: s.streamIndex,
+			Mute:        m,
+		}
+	}
+	if err := s.client.Request(request, nil); err != nil {
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+	return nil
+}
+
+// GetPeak retrieves the current peak level of the master session, starting to meter it on first use.
+func (s *masterSession) GetPeak() float32 {
+	if !s.peakStreamOpen {
+		sourceIndex := s.streamIndex
+		if s.isOutput {
+			var err error
+			if sourceIndex, err = s.peaks.monitorSourceIndex(s.streamIndex); err != nil {
+				s.logger.Debugw("Failed to get monitor source for metering", "error", err)
+				return 0
+			}
+		}
+
+		var err error
+		if s.peakStream, err = s.peaks.open(sourceIndex, proto.Undefined); err != nil {
+			s.logger.Debugw("Failed to start metering session", "error", err)
+			return 0
+		}
+		s.peakStreamOpen = true
+	}
+
+	return s.peaks.peak(s.peakStream)
+}
+
 // Release releases the master session resources.
+// ID returns the device's index, so the session is replaced once another device becomes the default
+func (s *masterSession) ID() string {
+	if s.isOutput {
+		return fmt.Sprintf("sink.%d", s.streamIndex)
+	}
+
+	return fmt.Sprintf("source.%d", s.streamIndex)
+}
+
 func (s *masterSession) Release() {
 	s.logger.Debug("Releasing audio session")
+	if s.peakStreamOpen {
+		s.peaks.close(s.peakStream)
+	}
 }
 
 // String provides a string representation of the master session.
@@ -171,21 +445,63 @@ func getVolumeFromClient(client *proto.Client, index uint32, channels byte, logg
 }
 
 // Helper function to create channel volumes based on the volume level
-func createChannelVolumes(channels byte, volume float32) []uint32 {
-	volumes := make([]uint32, channels)
+func createChannelVolumes(channels byte, volume float32) proto.ChannelVolumes {
+	volumes := make(proto.ChannelVolumes, channels)
 	for i := range volumes {
-		volumes[i] = uint32(volume * maxVolume)
+		volumes[i] = proto.Volume(volume * maxVolume)
+	}
+	return volumes
+}
+
+// paDeviceChannels maps the channel positions channel: targets can set to their names
+var paDeviceChannels = map[byte]string{
+	proto.ChannelFrontCenter: deviceChannelCenter,
+	proto.ChannelLFE:         deviceChannelLFE,
+	proto.ChannelRearLeft:    deviceChannelRearLeft,
+	proto.ChannelRearRight:   deviceChannelRearRight,
+	proto.ChannelLeftSide:    deviceChannelSideLeft,
+	proto.ChannelRightSide:   deviceChannelSideRight,
+}
+
+// balancedChannelVolumes creates channel volumes for a channel map, turning down the left or right channels
+// by their gains. Channels on neither side, like center and LFE, stay at the volume level unless deviceGains
+// (by channel name, and nil for none) turns them down too.
+func balancedChannelVolumes(
+	channelMap proto.ChannelMap,
+	volume float32,
+	left float32,
+	right float32,
+	deviceGains map[string]float32,
+) proto.ChannelVolumes {
+	volumes := make(proto.ChannelVolumes, len(channelMap))
+	for i, position := range channelMap {
+		gain := float32(1)
+		if deviceGain, ok := deviceGains[paDeviceChannels[position]]; ok {
+			gain = deviceGain
+		}
+		switch position {
+		case proto.ChannelFrontLeft, proto.ChannelRearLeft, proto.ChannelLeftCenter, proto.ChannelLeftSide,
+			proto.ChannelTopFrontLeft, proto.ChannelTopRearLeft:
+			gain *= left
+		case proto.ChannelFrontRight, proto.ChannelRearRight, proto.ChannelRightCenter, proto.ChannelRightSide,
+			proto.ChannelTopFrontRight, proto.ChannelTopRearRight:
+			gain *= right
+		}
+		volumes[i] = proto.Volume(volume * gain * maxVolume)
 	}
 	return volumes
 }
 
-// Helper function to parse channel volumes into a float value
-func parseChannelVolumes(volumes []uint32) float32 {
-	var total uint32
+// Helper function to parse channel volumes into a float value. Like PulseAudio itself, this goes by
+// the loudest channel, so a panned session still reads as the volume it was set to.
+func parseChannelVolumes(volumes proto.ChannelVolumes) float32 {
+	var loudest proto.Volume
 	for _, volume := range volumes {
-		total += volume
+		if volume > loudest {
+			loudest = volume
+		}
 	}
-	return float32(total) / float32(len(volumes)) / float32(maxVolume)
+	return float32(loudest) / float32(maxVolume)
 }
 
 // Utility functions for index validation (to differentiate sinks and sources)
@@ -197,4 +513,4 @@ func isSinkIndex(index uint32) bool {
 func isSourceIndex(index uint32) bool {
 	// Implement logic to identify source index
 	return true
-}
\ No newline at end of file
+}
@@ -1,10 +1,14 @@
 package deej
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/omriharel/deej/pkg/deej/util"
@@ -13,38 +17,178 @@ import (
 )
 
 const (
-	masterSessionName           = "master"           // master device volume
-	systemSessionName           = "system"           // system sounds volume
-	inputSessionName            = "mic"              // microphone input level
-	specialTargetTransformPrefix = "deej."
-	specialTargetCurrentWindow  = "current"
-	specialTargetAllUnmapped   = "unmapped"
+	masterSessionName              = "master" // master device volume
+	systemSessionName              = "system" // system sounds volume
+	inputSessionName               = "mic"    // microphone input level
+	specialTargetTransformPrefix   = "deej."
+	specialTargetCurrentWindow     = "current"
+	specialTargetAllUnmapped       = "unmapped"
+	externalTargetSeparator        = ":"
 	minTimeBetweenSessionRefreshes = time.Second * 5
 	maxTimeBetweenSessionRefreshes = time.Second * 45
+
+	// how long slider moves are gathered before being applied together. a line that moves several sliders
+	// arrives as back-to-back events, so they all make it into one batch along with any lines right behind it
+	volumeBatchWindow = 5 * time.Millisecond
+
+	// volume changes reported by the backend within this much of the cached volume are taken to be our own
+	externalVolumeTolerance = 0.005
 )
 
 // this matches friendly device names (on Windows), e.g. "Headphones (Realtek Audio)"
 var deviceSessionKeyPattern = regexp.MustCompile(`^.+ \(.+\)$`)
 
+// this matches crossfade targets, which balance a slider between two other targets, e.g. "deej.crossfade(a.exe, b.exe)".
+// "deej.chatmix(game.exe, chat.exe)" works the same way, but keeps both sides at full volume around the middle
+// like a headset's chat mix dial does
+var crossfadeTargetPattern = regexp.MustCompile(`(?i)^deej\.(crossfade|chatmix)\(\s*([^,]+?)\s*,\s*([^,]+?)\s*\)$`)
+
 type sessionMap struct {
-	deej              *Deej
-	logger            *zap.SugaredLogger
-	m                 map[string][]Session
-	lock              sync.Locker
-	sessionFinder     SessionFinder
-	lastSessionRefresh time.Time
-	unmappedSessions  []Session
+	config             *CanonicalConfig
+	events             *eventBus
+	routines           *routineGroup
+	logger             *zap.SugaredLogger
+	m                  map[string][]Session
+	lock               sync.Locker
+	sessionFinder      SessionFinder
+	lastSessionRefresh time.Time // guarded by lock, like unmappedSessions
+	unmappedSessions   []Session
+
+	// times sessions were (re-)acquired, counted for metrics
+	refreshes atomic.Uint64
+
+	// get a first look at each slider move, such as the script engine. guarded by lock
+	sliderMoveHandlers []sliderMoveHandler
+
+	// targets of the form "<prefix>:<name>" are routed to these instead of audio sessions
+	externalTargets map[string]externalTargetHandler
+
+	// targets of the form "<prefix>:<name>" that expand to audio sessions, like deej.* special targets do
+	targetResolvers map[string]targetResolver
+
+	// session finders besides the built-in one, such as plugins. guarded by lock
+	extraSessionFinders []SessionFinder
+
+	// the volume each session was last set to or read at, so slider moves don't query the backend
+	// every time. guarded by lock, and dropped along with the session when a refresh finds it gone
+	volumes map[Session]float32
+
+	// sessions the finder reported a volume change for, waiting to be compared against the cache. guarded by lock
+	volumeChecks       map[Session]struct{}
+	volumeChecksQueued chan struct{}
+
+	// sessions the finder reported as expired, waiting to be dropped. guarded by lock
+	expiredSessions       map[Session]struct{}
+	expiredSessionsQueued chan struct{}
+
+	// set when the finder reports a new session, which is picked up by a refresh
+	newSessionsQueued chan struct{}
+
+	// names of the apps that started each session's process, which can also be used to target it when
+	// match_child_processes is on. guarded by lock
+	parentKeys map[Session][]string
+
+	// the highest volume each target may be set to, such as from scheduled rules, on top of the config's
+	// safety_caps. guarded by lock
+	volumeCaps map[string]float32
+
+	// set while the desktop session deej runs in is disconnected, see suspend
+	suspended atomic.Bool
+
+	// the latest position of each slider the slider mapping was applied for, which new sessions are set to when
+	// new_sessions_follow_sliders is on. guarded by lock
+	sliderPositions map[int]float32
+
+	// the latest move of each slider while suspended, applied on resume. guarded by lock
+	suspendedMoves map[int]SliderMoveEvent
+
+	// set while resume acquires sessions from scratch, which aren't new apps getting default volumes
+	reacquiring atomic.Bool
+
+	// set for deej --dry-run, see dry_run.go
+	dryRun bool
+}
+
+// sessionVolumeChange is published when a session's volume is changed outside deej
+type sessionVolumeChange struct {
+	Key    string
+	Volume float32
+}
+
+// externalVolumeNotifier is implemented by session finders that can tell when a session's volume may have changed,
+// e.g. from the OS mixer. onChange can be called from any goroutine or thread, and must not block.
+type externalVolumeNotifier interface {
+	notifyVolumeChanges(onChange func(session Session))
+}
+
+// resettableSessionFinder is implemented by session finders that hold on to OS objects besides the sessions they
+// return, which stop working when the desktop session is disconnected and need to be created again
+type resettableSessionFinder interface {
+	reset()
+}
+
+// expiredSessionNotifier is implemented by session finders that can tell when a session ends, e.g. because its
+// process exited. onExpired can be called from any goroutine or thread, and must not block.
+type expiredSessionNotifier interface {
+	notifyExpiredSessions(onExpired func(session Session))
+}
+
+// newSessionNotifier is implemented by session finders that can tell when a session appears. onNew can be called
+// from any goroutine or thread, and must not block.
+type newSessionNotifier interface {
+	notifyNewSessions(onNew func())
 }
 
-func newSessionMap(deej *Deej, logger *zap.SugaredLogger, sessionFinder SessionFinder) (*sessionMap, error) {
+// systemRoleFinder is implemented by session finders that pick out system sounds by their stream's role, where
+// the OS doesn't group them into a session of its own
+type systemRoleFinder interface {
+	setSystemRoles(roles []string)
+}
+
+// sliderMoveHandler handles a slider move before the session map does, returning true
+// if it took care of the slider so its slider_mapping entry should be skipped
+type sliderMoveHandler func(event SliderMoveEvent) bool
+
+// externalTargetHandler sets the volume of a target that isn't an audio session, such as "obs:Mic/Aux".
+// It receives the part of the target after the prefix, in its original case.
+type externalTargetHandler func(name string, v float32) error
+
+// targetResolver returns the keys of the sessions a target refers to.
+// It receives the part of the target after the prefix, in its original case.
+type targetResolver func(name string) []string
+
+func newSessionMap(
+	config *CanonicalConfig,
+	events *eventBus,
+	routines *routineGroup,
+	logger *zap.SugaredLogger,
+	sessionFinder SessionFinder,
+) (*sessionMap, error) {
 	logger = logger.Named("sessions")
 
 	m := &sessionMap{
-		deej:          deej,
+		config:        config,
+		events:        events,
+		routines:      routines,
 		logger:        logger,
 		m:             make(map[string][]Session),
 		lock:          &sync.Mutex{},
 		sessionFinder: sessionFinder,
+
+		externalTargets: make(map[string]externalTargetHandler),
+		targetResolvers: make(map[string]targetResolver),
+		volumes:         make(map[Session]float32),
+
+		volumeChecks:       make(map[Session]struct{}),
+		volumeChecksQueued: make(chan struct{}, 1),
+
+		expiredSessions:       make(map[Session]struct{}),
+		expiredSessionsQueued: make(chan struct{}, 1),
+
+		newSessionsQueued: make(chan struct{}, 1),
+
+		parentKeys:      make(map[Session][]string),
+		sliderPositions: make(map[int]float32),
 	}
 
 	logger.Debug("Created session map instance")
@@ -53,6 +197,24 @@ func newSessionMap(deej *Deej, logger *zap.SugaredLogger, sessionFinder SessionF
 }
 
 func (m *sessionMap) initialize() error {
+	m.applySystemRoles()
+
+	// set up before the first sessions are acquired, so the finder watches them from the start
+	if notifier, ok := m.sessionFinder.(externalVolumeNotifier); ok {
+		notifier.notifyVolumeChanges(m.queueVolumeCheck)
+		m.setupOnVolumeCheck()
+	}
+
+	if notifier, ok := m.sessionFinder.(expiredSessionNotifier); ok {
+		notifier.notifyExpiredSessions(m.queueExpiredSession)
+		m.setupOnSessionExpiry()
+	}
+
+	if notifier, ok := m.sessionFinder.(newSessionNotifier); ok {
+		notifier.notifyNewSessions(m.queueNewSessions)
+		m.setupOnNewSession()
+	}
+
 	if err := m.getAndAddSessions(); err != nil {
 		m.logger.Warnw("Failed to get all sessions during session map initialization", "error", err)
 		return fmt.Errorf("get all sessions during init: %w", err)
@@ -73,12 +235,12 @@ func (m *sessionMap) release() error {
 	return nil
 }
 
-// assumes the session map is clean!
-// only call on a new session map or as part of refreshSessions which calls reset
+// getAndAddSessions acquires all sessions from the session finders and merges them into the session map
 func (m *sessionMap) getAndAddSessions() error {
 	// mark that we're refreshing before anything else
+	m.lock.Lock()
 	m.lastSessionRefresh = time.Now()
-	m.unmappedSessions = nil
+	m.lock.Unlock()
 
 	sessions, err := m.sessionFinder.GetAllSessions()
 	if err != nil {
@@ -86,54 +248,337 @@ func (m *sessionMap) getAndAddSessions() error {
 		return fmt.Errorf("get sessions from SessionFinder: %w", err)
 	}
 
-	for _, session := range sessions {
-		m.add(session)
+	m.lock.Lock()
+	extraSessionFinders := m.extraSessionFinders
+	m.lock.Unlock()
+
+	for _, finder := range extraSessionFinders {
+		extraSessions, err := finder.GetAllSessions()
+		if err != nil {
+			m.logger.Warnw("Failed to get sessions from additional session finder, skipping it", "error", err)
+			continue
+		}
+
+		sessions = append(sessions, extraSessions...)
+	}
+
+	var parentKeys map[int][]string
+	if m.config.MatchChildProcesses {
+		if parentKeys, err = findParentKeys(sessions); err != nil {
+			m.logger.Warnw("Failed to look up parent processes, sessions can only be targeted by their own name", "error", err)
+		}
+	}
+
+	sessions, added, removed := m.merge(sessions, parentKeys)
+
+	// apps already running when deej starts aren't new, so they keep the volume they had.
+	// new ones start at their default volume, unless a slider that controls them says otherwise
+	if m.refreshes.Load() > 0 && !m.reacquiring.Load() {
+		m.applyDefaultVolumes(added)
+		m.applySliderPositions(added)
+	}
+
+	// ...unless it's above their cap
+	if len(added) > 0 {
+		m.enforceVolumeCaps()
+	}
 
+	var unmappedSessions []Session
+	for _, session := range sessions {
 		if !m.sessionMapped(session) {
 			m.logger.Debugw("Tracking unmapped session", "session", session)
-			m.unmappedSessions = append(m.unmappedSessions, session)
+			unmappedSessions = append(unmappedSessions, session)
 		}
 	}
 
-	m.logger.Infow("Got all audio sessions successfully", "sessionMap", m)
+	m.lock.Lock()
+	m.unmappedSessions = unmappedSessions
+	m.lock.Unlock()
+
+	m.logger.Infow("Got all audio sessions successfully", "sessionMap", m, "added", len(added), "removed", len(removed))
+	m.refreshes.Add(1)
+
+	event := sessionChangeEvent{Removed: removed}
+	for _, session := range added {
+		event.Added = append(event.Added, session.Key())
+	}
+	m.events.sessionsChanged.publish(event)
 
 	return nil
 }
 
+// merge swaps the tracked sessions for freshly acquired ones in one go, so targets never go missing in between.
+// Sessions that were already tracked, going by their ID, are kept along with their cached volume, and their fresh
+// copies are released instead. Tracked sessions that weren't acquired again are released and dropped.
+// parentKeys holds the names of the processes that started each session's process, by PID.
+// It returns the sessions tracked from now on, the ones among them that are new, and the keys of the ones dropped.
+func (m *sessionMap) merge(fresh []Session, parentKeys map[int][]string) (sessions []Session, added []Session, removed []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing := make(map[string]Session)
+	for _, keySessions := range m.m {
+		for _, session := range keySessions {
+			if id := session.ID(); id != "" {
+				existing[id] = session
+			}
+		}
+	}
+
+	kept := make(map[Session]bool)
+	next := make(map[string][]Session)
+
+	for _, session := range fresh {
+		if old, ok := existing[session.ID()]; ok && !kept[old] {
+			session.Release()
+			session = old
+			kept[old] = true
+		} else {
+			added = append(added, session)
+		}
+
+		next[session.Key()] = append(next[session.Key()], session)
+		sessions = append(sessions, session)
+	}
+
+	for _, keySessions := range m.m {
+		for _, session := range keySessions {
+			if kept[session] {
+				continue
+			}
+
+			removed = append(removed, session.Key())
+			session.Release()
+			delete(m.volumes, session)
+		}
+	}
+
+	m.m = next
+
+	m.parentKeys = make(map[Session][]string)
+	for _, session := range sessions {
+		withProcess, ok := session.(processSession)
+		if !ok {
+			continue
+		}
+
+		for _, parentKey := range parentKeys[withProcess.processID()] {
+			// e.g. chrome.exe started by chrome.exe, which the session's own key already covers
+			if parentKey != session.Key() {
+				m.parentKeys[session] = append(m.parentKeys[session], parentKey)
+			}
+		}
+	}
+
+	return sessions, added, removed
+}
+
+// queueVolumeCheck marks a session's volume as possibly changed. The finder calls it on its own thread,
+// so the backend is only queried later, from setupOnVolumeCheck's goroutine.
+func (m *sessionMap) queueVolumeCheck(session Session) {
+	m.lock.Lock()
+	m.volumeChecks[session] = struct{}{}
+	m.lock.Unlock()
+
+	select {
+	case m.volumeChecksQueued <- struct{}{}:
+	default:
+	}
+}
+
+func (m *sessionMap) setupOnVolumeCheck() {
+	m.routines.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-m.volumeChecksQueued:
+				m.checkVolumes()
+			}
+		}
+	})
+}
+
+// checkVolumes reads back the volumes of the queued sessions. Those that no longer match the cache
+// were changed outside deej, so the cache takes their new volume and subscribers are told about it.
+func (m *sessionMap) checkVolumes() {
+	m.lock.Lock()
+	sessions := m.volumeChecks
+	m.volumeChecks = make(map[Session]struct{})
+	m.lock.Unlock()
+
+	for reported := range sessions {
+		// finders report the copy they acquired, which may have been released in favor of an equal tracked session
+		session, ok := m.tracked(reported)
+		if !ok {
+			continue
+		}
+
+		v := session.GetVolume()
+
+		// volumes raised outside deej, e.g. in the OS mixer, are brought back down to their cap
+		if clamped := m.clampVolume(session, v); clamped < v {
+			m.logger.Debugw("Lowering session raised outside deej to its volume cap", "session", session.Key(), "from", v, "to", clamped)
+
+			if err := m.setSessionVolume(session, clamped); err != nil {
+				m.logger.Warnw("Failed to lower session to its volume cap", "session", session.Key(), "error", err)
+			} else {
+				v = clamped
+			}
+		}
+
+		m.lock.Lock()
+		cached, ok := m.volumes[session]
+		m.volumes[session] = v
+		m.lock.Unlock()
+
+		if ok && math.Abs(float64(v-cached)) < externalVolumeTolerance {
+			continue
+		}
+
+		m.logger.Debugw("Session volume changed outside deej", "session", session.Key(), "volume", v)
+		m.events.volumeChanged.publish(sessionVolumeChange{Key: session.Key(), Volume: v})
+	}
+}
+
+// queueExpiredSession marks a session for removal. The finder calls it on its own thread,
+// where the session can't be released yet, so that happens later on setupOnSessionExpiry's goroutine.
+func (m *sessionMap) queueExpiredSession(session Session) {
+	m.lock.Lock()
+	m.expiredSessions[session] = struct{}{}
+	m.lock.Unlock()
+
+	select {
+	case m.expiredSessionsQueued <- struct{}{}:
+	default:
+	}
+}
+
+func (m *sessionMap) setupOnSessionExpiry() {
+	m.routines.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-m.expiredSessionsQueued:
+				m.pruneExpiredSessions()
+			}
+		}
+	})
+}
+
+// pruneExpiredSessions drops and releases the queued sessions, so slider moves stop reaching for them
+// instead of failing and forcing a full refresh
+func (m *sessionMap) pruneExpiredSessions() {
+	m.lock.Lock()
+	expired := m.expiredSessions
+	m.expiredSessions = make(map[Session]struct{})
+	m.lock.Unlock()
+
+	var removed []string
+
+	for reported := range expired {
+		session, ok := m.tracked(reported)
+		if !ok {
+			continue
+		}
+
+		m.remove(session)
+		m.logger.Debugw("Dropped expired audio session", "session", session.Key())
+		removed = append(removed, session.Key())
+	}
+
+	if len(removed) > 0 {
+		m.events.sessionsChanged.publish(sessionChangeEvent{Removed: removed})
+	}
+}
+
+// queueNewSessions marks that the finder has a new session. The finder calls it on its own thread, so the refresh
+// that picks it up happens later, on setupOnNewSession's goroutine.
+func (m *sessionMap) queueNewSessions() {
+	select {
+	case m.newSessionsQueued <- struct{}{}:
+	default:
+	}
+}
+
+// setupOnNewSession refreshes as soon as a session appears, rather than waiting for a slider to move, so short ones
+// like system sounds are found while they still play
+func (m *sessionMap) setupOnNewSession() {
+	m.routines.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-m.newSessionsQueued:
+				m.refreshSessions(true)
+			}
+		}
+	})
+}
+
+// applySystemRoles tells finders that pick out system sounds by role which roles system_sound_roles lists
+func (m *sessionMap) applySystemRoles() {
+	if finder, ok := m.sessionFinder.(systemRoleFinder); ok {
+		finder.setSystemRoles(m.config.SystemRoles)
+	}
+}
+
 func (m *sessionMap) setupOnConfigReload() {
-	configReloadedChannel := m.deej.config.SubscribeToChanges()
+	configReloadedChannel := m.events.configReloaded.subscribe()
 
-	go func() {
+	m.routines.spawn(func(ctx context.Context) error {
 		for {
 			select {
+			case <-ctx.Done():
+				return nil
 			case <-configReloadedChannel:
 				m.logger.Info("Detected config reload, attempting to re-acquire all audio sessions")
+				m.applySystemRoles()
 				m.refreshSessions(false)
+				m.enforceVolumeCaps()
 			}
 		}
-	}()
+	})
 }
 
 func (m *sessionMap) setupOnSliderMove() {
-	sliderEventsChannel := m.deej.serial.SubscribeToSliderMoveEvents()
+	sliderEventsChannel := m.events.sliderMoved.subscribe()
+
+	m.routines.spawn(func(ctx context.Context) error {
+		var pending []SliderMoveEvent
+
+		// nil while nothing is pending, which leaves it out of the select
+		var flush <-chan time.Time
 
-	go func() {
 		for {
 			select {
+			case <-ctx.Done():
+				return nil
 			case event := <-sliderEventsChannel:
-				m.handleSliderMoveEvent(event)
+				if pending == nil {
+					flush = time.After(volumeBatchWindow)
+				}
+				pending = append(pending, event)
+			case <-flush:
+				m.handleSliderMoveEvents(pending)
+				pending = nil
+				flush = nil
 			}
 		}
-	}()
+	})
 }
 
 // refreshes sessions with a forced refresh flag
 func (m *sessionMap) refreshSessions(force bool) {
-	if !force && m.lastSessionRefresh.Add(minTimeBetweenSessionRefreshes).After(time.Now()) {
+	// sessions can't be acquired while the desktop session is disconnected, resume does it once it's back
+	if m.suspended.Load() {
 		return
 	}
 
-	m.clear()
+	if !force && m.lastRefresh().Add(minTimeBetweenSessionRefreshes).After(time.Now()) {
+		return
+	}
 
 	if err := m.getAndAddSessions(); err != nil {
 		m.logger.Warnw("Failed to re-acquire all audio sessions", "error", err)
@@ -142,6 +587,68 @@ func (m *sessionMap) refreshSessions(force bool) {
 	}
 }
 
+// lastRefresh returns when sessions were last acquired
+func (m *sessionMap) lastRefresh() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.lastSessionRefresh
+}
+
+// suspend stops slider moves from being applied and sessions from being acquired, for while the desktop session
+// is disconnected. Moves made in the meantime are applied by resume.
+func (m *sessionMap) suspend() {
+	m.lock.Lock()
+	m.suspendedMoves = make(map[int]SliderMoveEvent)
+	m.lock.Unlock()
+
+	m.suspended.Store(true)
+}
+
+// resume undoes suspend. The sessions acquired before suspending are released rather than kept, since they (and
+// the finder's own OS objects) belonged to the desktop session as it was before, and everything is acquired anew
+// before applying the slider moves made in the meantime.
+func (m *sessionMap) resume() {
+	if !m.suspended.Load() {
+		return
+	}
+
+	m.lock.Lock()
+	stale := m.m
+	moves := m.suspendedMoves
+	m.m = make(map[string][]Session)
+	m.volumes = make(map[Session]float32)
+	m.suspendedMoves = nil
+	m.lock.Unlock()
+
+	for _, keySessions := range stale {
+		for _, session := range keySessions {
+			session.Release()
+		}
+	}
+
+	if finder, ok := m.sessionFinder.(resettableSessionFinder); ok {
+		finder.reset()
+	}
+
+	m.suspended.Store(false)
+
+	m.reacquiring.Store(true)
+	m.refreshSessions(true)
+	m.reacquiring.Store(false)
+
+	if len(moves) == 0 {
+		return
+	}
+
+	pending := make([]SliderMoveEvent, 0, len(moves))
+	for _, event := range moves {
+		pending = append(pending, event)
+	}
+
+	m.handleSliderMoveEvents(pending)
+}
+
 // returns true if a session is not currently mapped to any slider
 func (m *sessionMap) sessionMapped(session Session) bool {
 	// count master/system/mic as mapped
@@ -154,18 +661,48 @@ func (m *sessionMap) sessionMapped(session Session) bool {
 		return true
 	}
 
+	// count sessions that only show up through target prefixes (like media players) as mapped
+	if m.isResolvedTarget(session.Key()) {
+		return true
+	}
+
+	var parentKeys []string
+	if m.config.MatchChildProcesses {
+		m.lock.Lock()
+		parentKeys = m.parentKeys[session]
+		m.lock.Unlock()
+	}
+
 	matchFound := false
-	m.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+	m.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
 		for _, target := range targets {
-			if m.targetHasSpecialTransform(target) {
-				continue
+			// both sides of a crossfade count as mapped
+			sides := []string{target}
+			if targetA, targetB, ok := m.crossfadeTargets(target); ok {
+				sides = []string{targetA, targetB}
 			}
 
-			// resolve the target and compare it
-			resolvedTarget := m.resolveTarget(target)[0]
-			if resolvedTarget == session.Key() {
-				matchFound = true
-				return
+			// an alias counts as all of the targets it stands for
+			var expanded []string
+			for _, side := range sides {
+				if aliasTargets, ok := m.aliasTargets(side); ok {
+					expanded = append(expanded, aliasTargets...)
+				} else {
+					expanded = append(expanded, side)
+				}
+			}
+
+			for _, side := range expanded {
+				if m.targetHasSpecialTransform(side) || m.isExternalTarget(side) || m.isResolvedTarget(side) {
+					continue
+				}
+
+				// resolve the target and compare it, along with the apps that started the session's process
+				resolvedTarget := m.resolveTarget(side)[0]
+				if resolvedTarget == session.Key() || funk.ContainsString(parentKeys, resolvedTarget) {
+					matchFound = true
+					return
+				}
 			}
 		}
 	})
@@ -173,48 +710,492 @@ func (m *sessionMap) sessionMapped(session Session) bool {
 	return matchFound
 }
 
-// handles the slider move events and updates volumes accordingly
-func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
-	if m.lastSessionRefresh.Add(maxTimeBetweenSessionRefreshes).Before(time.Now()) {
+// volumeBatch holds the volumes a batch of slider moves sets, so that each session and external target
+// is set once per batch no matter how many events touched it
+type volumeBatch struct {
+	sessions      map[Session]float32
+	sessionOrder  []Session
+	external      map[string]float32
+	externalOrder []string
+}
+
+func newVolumeBatch() *volumeBatch {
+	return &volumeBatch{
+		sessions: make(map[Session]float32),
+		external: make(map[string]float32),
+	}
+}
+
+func (b *volumeBatch) setSession(session Session, v float32) {
+	if _, ok := b.sessions[session]; !ok {
+		b.sessionOrder = append(b.sessionOrder, session)
+	}
+
+	b.sessions[session] = v
+}
+
+func (b *volumeBatch) setExternal(target string, v float32) {
+	if _, ok := b.external[target]; !ok {
+		b.externalOrder = append(b.externalOrder, target)
+	}
+
+	b.external[target] = v
+}
+
+// handles a batch of slider move events and updates volumes accordingly, setting each target only once
+func (m *sessionMap) handleSliderMoveEvents(events []SliderMoveEvent) {
+	if m.suspended.Load() {
+		m.lock.Lock()
+		for _, event := range events {
+			m.suspendedMoves[event.SliderID] = event
+		}
+		m.lock.Unlock()
+
+		return
+	}
+
+	if m.lastRefresh().Add(maxTimeBetweenSessionRefreshes).Before(time.Now()) {
 		m.logger.Debug("Stale session map detected on slider move, refreshing")
 		m.refreshSessions(true)
 	}
 
-	targets, ok := m.deej.config.SliderMapping.get(event.SliderID)
-	if !ok {
-		return
+	batch := newVolumeBatch()
+	targetMissing := false
+
+	m.lock.Lock()
+	handlers := m.sliderMoveHandlers
+	m.lock.Unlock()
+
+	for _, event := range coalesceSliderMoves(events) {
+		if handledBy(handlers, event) {
+			continue
+		}
+
+		targets, ok := m.config.SliderMapping.get(event.SliderID)
+		if !ok {
+			continue
+		}
+
+		m.lock.Lock()
+		m.sliderPositions[event.SliderID] = event.PercentValue
+		m.lock.Unlock()
+
+		targetFound := false
+
+		// set if a target that's missing has no missing_targets policy, which leaves it to the slider as a whole
+		unhandledMissing := false
+
+		for _, target := range targets {
+			if targetA, targetB, ok := m.crossfadeTargets(target); ok {
+				volumeA, volumeB := m.mixVolumes(target, event.PercentValue)
+				foundA := m.addTargetToBatch(batch, targetA, volumeA)
+				foundB := m.addTargetToBatch(batch, targetB, volumeB)
+
+				targetFound = targetFound || foundA || foundB
+				unhandledMissing = unhandledMissing || !(foundA || foundB)
+				continue
+			}
+
+			if m.addTargetToBatch(batch, target, event.PercentValue) {
+				targetFound = true
+				continue
+			}
+
+			if refresh, ok := m.handleMissingTarget(target, event.PercentValue); ok {
+				targetMissing = targetMissing || refresh
+				continue
+			}
+
+			unhandledMissing = true
+		}
+
+		targetMissing = targetMissing || (!targetFound && unhandledMissing)
+	}
+
+	adjustmentFailed := m.applyVolumeBatch(batch)
+
+	if adjustmentFailed {
+		m.refreshSessions(true)
+	} else if targetMissing {
+		m.refreshSessions(false)
+	}
+}
+
+// addTargetToBatch adds the sessions matching a slider_mapping-style target to the batch,
+// returning false if none match
+func (m *sessionMap) addTargetToBatch(batch *volumeBatch, target string, v float32) bool {
+	if m.isExternalTarget(target) {
+		batch.setExternal(target, m.clampExternalVolume(target, v))
+		return true
+	}
+
+	found := false
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		for _, session := range sessions {
+			batch.setSession(session, v)
+		}
 	}
 
-	targetFound := false
+	return found
+}
+
+// applyVolumeBatch sets the batch's volumes in one pass over the sessions, followed by the external targets.
+// It returns true if a session failed to adjust, which usually means the session map is out of date.
+func (m *sessionMap) applyVolumeBatch(batch *volumeBatch) bool {
 	adjustmentFailed := false
 
-	for _, target := range targets {
-		resolvedTargets := m.resolveTarget(target)
+	for _, session := range batch.sessionOrder {
+		v := m.clampVolume(session, batch.sessions[session])
+		if m.cachedVolume(session) == v {
+			continue
+		}
+
+		if err := m.setSessionVolume(session, v); err != nil {
+			m.logger.Warnw("Failed to set target session volume", "error", err)
+			adjustmentFailed = true
+			continue
+		}
+
+		m.cacheVolume(session, v)
+	}
+
+	for _, target := range batch.externalOrder {
+		if err := m.setExternalVolume(target, batch.external[target]); err != nil {
+			m.logger.Warnw("Failed to set external target volume", "target", target, "error", err)
+		}
+	}
+
+	return adjustmentFailed
+}
+
+// handledBy returns true if one of the handlers took care of the slider move
+func handledBy(handlers []sliderMoveHandler, event SliderMoveEvent) bool {
+	for _, handler := range handlers {
+		if handler(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coalesceSliderMoves keeps only the latest move of each slider, in the order the sliders first moved
+func coalesceSliderMoves(events []SliderMoveEvent) []SliderMoveEvent {
+	indices := make(map[int]int)
+	var coalesced []SliderMoveEvent
+
+	for _, event := range events {
+		if idx, ok := indices[event.SliderID]; ok {
+			coalesced[idx] = event
+			continue
+		}
+
+		indices[event.SliderID] = len(coalesced)
+		coalesced = append(coalesced, event)
+	}
+
+	return coalesced
+}
 
-		for _, resolvedTarget := range resolvedTargets {
-			sessions, ok := m.get(resolvedTarget)
+// setTargetVolume resolves a slider_mapping-style target and sets the volume of all matching sessions,
+// returning the keys of the sessions that were adjusted
+func (m *sessionMap) setTargetVolume(target string, v float32) ([]string, error) {
+	if targetA, targetB, ok := m.crossfadeTargets(target); ok {
+		volumeA, volumeB := m.mixVolumes(target, v)
+		return m.setCrossfadeVolume(targetA, targetB, volumeA, volumeB)
+	}
+
+	if m.isExternalTarget(target) {
+		if err := m.setExternalVolume(target, m.clampExternalVolume(target, v)); err != nil {
+			return nil, fmt.Errorf("set volume for %s: %w", target, err)
+		}
+
+		return []string{target}, nil
+	}
+
+	var adjusted []string
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		for _, session := range sessions {
+			clamped := m.clampVolume(session, v)
+			if err := m.setSessionVolume(session, clamped); err != nil {
+				m.logger.Warnw("Failed to set target session volume", "target", target, "error", err)
+				m.refreshSessions(true)
+				return adjusted, fmt.Errorf("set volume for %s: %w", session.Key(), err)
+			}
+
+			m.cacheVolume(session, clamped)
+			adjusted = append(adjusted, session.Key())
+		}
+	}
+
+	if len(adjusted) == 0 {
+		m.refreshSessions(false)
+	}
+
+	return adjusted, nil
+}
+
+// setCrossfadeVolume sets both sides of a crossfade or chat mix to the volumes its position maps them to
+func (m *sessionMap) setCrossfadeVolume(targetA string, targetB string, volumeA float32, volumeB float32) ([]string, error) {
+	adjustedA, err := m.setTargetVolume(targetA, volumeA)
+	if err != nil {
+		return adjustedA, err
+	}
+
+	adjustedB, err := m.setTargetVolume(targetB, volumeB)
+	return append(adjustedA, adjustedB...), err
+}
+
+// mixVolumes returns the volumes of both sides of a crossfade or chat mix target at the given position,
+// at the same precision as slider values
+func (m *sessionMap) mixVolumes(target string, position float32) (float32, float32) {
+	volumeA, volumeB := crossfadeVolumes(position)
+	if match := crossfadeTargetPattern.FindStringSubmatch(target); match != nil && strings.EqualFold(match[1], chatMixTargetName) {
+		volumeA, volumeB = chatMixVolumes(position)
+	}
+
+	return m.config.normalizeSliderValue(volumeA), m.config.normalizeSliderValue(volumeB)
+}
+
+// crossfadeVolumes returns the volumes of both sides of a crossfade at the given position: at 0 only the first
+// side is audible, at 1 only the second is. An equal-power curve keeps the combined loudness steady in between.
+func crossfadeVolumes(position float32) (float32, float32) {
+	angle := float64(position) * math.Pi / 2
+	return float32(math.Cos(angle)), float32(math.Sin(angle))
+}
+
+// chatMixVolumes returns the volumes of both sides of a chat mix at the given position. Both are at full volume
+// in the middle, and moving towards either end only lowers the other side, until it's silent at the end.
+func chatMixVolumes(position float32) (float32, float32) {
+	volumeA, volumeB := 2*(1-position), 2*position
+	if volumeA > 1 {
+		volumeA = 1
+	}
+
+	if volumeB > 1 {
+		volumeB = 1
+	}
+
+	return volumeA, volumeB
+}
+
+// crossfadeTargets returns the two targets a crossfade target balances between
+func (m *sessionMap) crossfadeTargets(target string) (string, string, bool) {
+	match := crossfadeTargetPattern.FindStringSubmatch(target)
+	if match == nil {
+		return "", "", false
+	}
+
+	return match[2], match[3], true
+}
+
+// setTargetMute mutes or unmutes all sessions matching a target, returning the keys of the sessions that were adjusted.
+// Sessions that can't be muted are skipped
+func (m *sessionMap) setTargetMute(target string, mute bool) ([]string, error) {
+	if m.isExternalTarget(target) {
+		return nil, fmt.Errorf("mute is not supported for %s", target)
+	}
+
+	var adjusted []string
+	unsupported := false
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		for _, session := range sessions {
+			muteController, ok := session.(MuteController)
 			if !ok {
+				unsupported = true
 				continue
 			}
 
-			targetFound = true
-
-			for _, session := range sessions {
-				if session.GetVolume() != event.PercentValue {
-					if err := session.SetVolume(event.PercentValue); err != nil {
-						m.logger.Warnw("Failed to set target session volume", "error", err)
-						adjustmentFailed = true
-					}
-				}
+			if err := m.setSessionMute(session, muteController, mute); err != nil {
+				m.logger.Warnw("Failed to set target session mute state", "target", target, "error", err)
+				m.refreshSessions(true)
+				return adjusted, fmt.Errorf("set mute for %s: %w", session.Key(), err)
 			}
+
+			adjusted = append(adjusted, session.Key())
 		}
 	}
 
-	if !targetFound {
+	if len(adjusted) == 0 {
+		if unsupported {
+			return nil, fmt.Errorf("%s: %w", target, errMuteUnsupported)
+		}
+
 		m.refreshSessions(false)
-	} else if adjustmentFailed {
-		m.refreshSessions(true)
 	}
+
+	return adjusted, nil
+}
+
+// controlTargetMedia controls the playback of all sessions matching a target, returning the keys of the sessions
+// that were controlled. Sessions whose playback can't be controlled are skipped
+func (m *sessionMap) controlTargetMedia(target string, control func(MediaController) error) ([]string, error) {
+	if m.isExternalTarget(target) {
+		return nil, fmt.Errorf("media control is not supported for %s", target)
+	}
+
+	var controlled []string
+	unsupported := false
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		for _, session := range sessions {
+			mediaController, ok := session.(MediaController)
+			if !ok {
+				unsupported = true
+				continue
+			}
+
+			if err := control(mediaController); err != nil {
+				return controlled, fmt.Errorf("control playback of %s: %w", session.Key(), err)
+			}
+
+			controlled = append(controlled, session.Key())
+		}
+	}
+
+	if len(controlled) == 0 && unsupported {
+		return nil, fmt.Errorf("%s: %w", target, errMediaUnsupported)
+	}
+
+	return controlled, nil
+}
+
+// targetState reports the volume of the first session matching a target, and whether all matching sessions
+// are muted. found is false if no session matches (external targets never do, as their state isn't known).
+func (m *sessionMap) targetState(target string) (volume float32, muted bool, found bool) {
+	if m.isExternalTarget(target) {
+		return 0, false, false
+	}
+
+	muted = true
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.get(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		for _, session := range sessions {
+			if !found {
+				volume = session.GetVolume()
+				found = true
+			}
+
+			muted = muted && sessionIsMuted(session)
+		}
+	}
+
+	return volume, muted && found, found
+}
+
+// targetPeak returns the highest of the given peak levels among sessions matching a target.
+// found is false if no session matches.
+func (m *sessionMap) targetPeak(target string, levels PeakLevels) (peak float32, found bool) {
+	if m.isExternalTarget(target) {
+		return 0, false
+	}
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessionPeak, ok := levels[resolvedTarget]
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		if sessionPeak > peak {
+			peak = sessionPeak
+		}
+	}
+
+	return peak, found
+}
+
+// registerExternalTarget routes all targets starting with "<prefix>:" to the given handler
+func (m *sessionMap) registerExternalTarget(prefix string, handler externalTargetHandler) {
+	m.externalTargets[strings.ToLower(prefix)] = handler
+}
+
+func (m *sessionMap) splitExternalTarget(target string) (externalTargetHandler, string, bool) {
+	prefix, name, found := strings.Cut(target, externalTargetSeparator)
+	if !found {
+		return nil, "", false
+	}
+
+	handler, ok := m.externalTargets[strings.ToLower(prefix)]
+	return handler, name, ok
+}
+
+func (m *sessionMap) isExternalTarget(target string) bool {
+	_, _, ok := m.splitExternalTarget(target)
+	return ok
+}
+
+// registerTargetResolver expands all targets starting with "<prefix>:" using the given resolver
+func (m *sessionMap) registerTargetResolver(prefix string, resolver targetResolver) {
+	m.targetResolvers[strings.ToLower(prefix)] = resolver
+}
+
+func (m *sessionMap) splitResolvedTarget(target string) (targetResolver, string, bool) {
+	prefix, name, found := strings.Cut(target, externalTargetSeparator)
+	if !found {
+		return nil, "", false
+	}
+
+	resolver, ok := m.targetResolvers[strings.ToLower(prefix)]
+	return resolver, name, ok
+}
+
+func (m *sessionMap) isResolvedTarget(target string) bool {
+	_, _, ok := m.splitResolvedTarget(target)
+	return ok
+}
+
+// registerSliderMoveHandler has handler look at every slider move before the session map applies it
+func (m *sessionMap) registerSliderMoveHandler(handler sliderMoveHandler) {
+	m.lock.Lock()
+	m.sliderMoveHandlers = append(m.sliderMoveHandlers, handler)
+	m.lock.Unlock()
+}
+
+// registerSessionFinder adds sessions from another source the next time sessions are refreshed
+func (m *sessionMap) registerSessionFinder(finder SessionFinder) {
+	m.lock.Lock()
+	m.extraSessionFinders = append(m.extraSessionFinders, finder)
+	m.lock.Unlock()
+
+	m.refreshSessions(true)
+}
+
+// aliasTargets returns the targets an alias from the aliases section stands for
+func (m *sessionMap) aliasTargets(target string) ([]string, bool) {
+	aliasTargets, ok := m.config.Aliases[strings.ToLower(target)]
+	return aliasTargets, ok
 }
 
 func (m *sessionMap) targetHasSpecialTransform(target string) bool {
@@ -222,6 +1203,24 @@ func (m *sessionMap) targetHasSpecialTransform(target string) bool {
 }
 
 func (m *sessionMap) resolveTarget(target string) []string {
+	if aliasTargets, ok := m.aliasTargets(target); ok {
+		var resolvedTargets []string
+		for _, aliasTarget := range aliasTargets {
+			resolvedTargets = append(resolvedTargets, m.resolveTarget(aliasTarget)...)
+		}
+
+		return resolvedTargets
+	}
+
+	if resolver, name, ok := m.splitResolvedTarget(target); ok {
+		resolvedTargets := resolver(name)
+		for i := range resolvedTargets {
+			resolvedTargets[i] = strings.ToLower(resolvedTargets[i])
+		}
+
+		return resolvedTargets
+	}
+
 	target = strings.ToLower(target)
 
 	if m.targetHasSpecialTransform(target) {
@@ -257,6 +1256,9 @@ func (m *sessionMap) getCurrentWindowProcessNames() []string {
 }
 
 func (m *sessionMap) getUnmappedSessionKeys() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	targetKeys := make([]string, len(m.unmappedSessions))
 	for i, session := range m.unmappedSessions {
 		targetKeys[i] = session.Key()
@@ -265,41 +1267,110 @@ func (m *sessionMap) getUnmappedSessionKeys() []string {
 	return targetKeys
 }
 
-func (m *sessionMap) add(value Session) {
+// cachedVolume returns the volume a session was last set to or read at,
+// only asking the backend if neither happened since sessions were last acquired
+func (m *sessionMap) cachedVolume(session Session) float32 {
+	m.lock.Lock()
+	v, ok := m.volumes[session]
+	m.lock.Unlock()
+
+	if ok {
+		return v
+	}
+
+	v = session.GetVolume()
+	m.cacheVolume(session, v)
+
+	return v
+}
+
+func (m *sessionMap) cacheVolume(session Session, v float32) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	key := value.Key()
+	m.volumes[session] = v
+}
 
-	if _, ok := m.m[key]; !ok {
-		m.m[key] = []Session{value}
-	} else {
-		m.m[key] = append(m.m[key], value)
+// tracked returns the tracked session that is, or has the same ID as, the given one
+func (m *sessionMap) tracked(session Session) (Session, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, existing := range m.m[session.Key()] {
+		if existing == session || (existing.ID() != "" && existing.ID() == session.ID()) {
+			return existing, true
+		}
 	}
+
+	return nil, false
 }
 
-func (m *sessionMap) get(key string) ([]Session, bool) {
+// remove drops a tracked session and releases it
+func (m *sessionMap) remove(session Session) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	value, ok := m.m[key]
-	return value, ok
+	key := session.Key()
+	for idx, existing := range m.m[key] {
+		if existing != session {
+			continue
+		}
+
+		m.m[key] = append(m.m[key][:idx:idx], m.m[key][idx+1:]...)
+		if len(m.m[key]) == 0 {
+			delete(m.m, key)
+		}
+
+		delete(m.volumes, session)
+		delete(m.parentKeys, session)
+		session.Release()
+
+		return
+	}
 }
 
-func (m *sessionMap) clear() {
+// get returns the sessions with the given key, along with those started by an app with that name
+// if match_child_processes is on
+func (m *sessionMap) get(key string) ([]Session, bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.logger.Debug("Releasing and clearing all audio sessions")
+	value, ok := m.m[key]
+	if !m.config.MatchChildProcesses || len(m.parentKeys) == 0 {
+		return value, ok
+	}
 
-	for key, sessions := range m.m {
-		for _, session := range sessions {
-			session.Release()
+	var children []Session
+	for session, parentKeys := range m.parentKeys {
+		if funk.ContainsString(parentKeys, key) {
+			children = append(children, session)
 		}
-		delete(m.m, key)
 	}
 
-	m.logger.Debug("Session map cleared")
+	if len(children) == 0 {
+		return value, ok
+	}
+
+	// don't append to the tracked slice itself
+	sessions := append(append([]Session{}, value...), children...)
+	return sessions, true
+}
+
+// snapshot returns all currently tracked sessions, sorted by key
+func (m *sessionMap) snapshot() []Session {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var sessions []Session
+	for _, keySessions := range m.m {
+		sessions = append(sessions, keySessions...)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Key() < sessions[j].Key()
+	})
+
+	return sessions
 }
 
 func (m *sessionMap) String() string {
@@ -312,4 +1383,4 @@ func (m *sessionMap) String() string {
 	}
 
 	return fmt.Sprintf("<%d audio sessions>", sessionCount)
-}
\ No newline at end of file
+}
@@ -0,0 +1,648 @@
+package deej
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolveTarget(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"master"},
+		1: {"spotify.exe"},
+	})
+	config.Aliases = map[string][]string{
+		"chat":       {"Discord.exe"},
+		"everything": {"spotify.exe", "deej.unmapped"},
+	}
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(
+		newFakeSession("master", "master", 1),
+		newFakeSession("spotify.exe", "1", 1),
+		newFakeSession("discord.exe", "2", 1),
+		newFakeSession("Game.exe", "3", 1),
+	)
+
+	m := newTestSessionMap(t, config, finder)
+	m.registerTargetResolver("group", func(name string) []string {
+		if name == "Music" {
+			return []string{"Spotify.exe", "VLC.exe"}
+		}
+
+		return nil
+	})
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"spotify.exe", []string{"spotify.exe"}},
+		{"Spotify.EXE", []string{"spotify.exe"}},
+		{"master", []string{"master"}},
+		{"deej.unmapped", []string{"discord.exe", "game.exe"}},
+		{"deej.nonexistent", nil},
+		{"group:Music", []string{"spotify.exe", "vlc.exe"}},
+		{"GROUP:Music", []string{"spotify.exe", "vlc.exe"}},
+		{"group:Podcasts", []string{}},
+		{"Chat", []string{"discord.exe"}},
+		{"everything", []string{"discord.exe", "game.exe", "spotify.exe"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			got := m.resolveTarget(test.target)
+			sort.Strings(got)
+
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("resolveTarget(%q) = %q, want %q", test.target, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetTargetVolume(t *testing.T) {
+	// both sides of a crossfade in the middle, at the precision volumes are set with
+	config := newTestConfig(nil)
+	halfA, halfB := crossfadeVolumes(0.5)
+	halfA, halfB = config.normalizeSliderValue(halfA), config.normalizeSliderValue(halfB)
+
+	tests := []struct {
+		name         string
+		target       string
+		volume       float32
+		wantAdjusted []string
+		wantVolumes  map[string]float32 // by session ID
+		wantExternal map[string]float32
+		wantErr      bool
+	}{
+		{
+			name:         "single session",
+			target:       "spotify.exe",
+			volume:       0.3,
+			wantAdjusted: []string{"spotify.exe"},
+			wantVolumes:  map[string]float32{"spotify": 0.3, "chrome-1": 1, "chrome-2": 1},
+		},
+		{
+			name:         "every session with the key",
+			target:       "chrome.exe",
+			volume:       0.4,
+			wantAdjusted: []string{"chrome.exe", "chrome.exe"},
+			wantVolumes:  map[string]float32{"spotify": 1, "chrome-1": 0.4, "chrome-2": 0.4},
+		},
+		{
+			name:        "missing session",
+			target:      "vlc.exe",
+			volume:      0.5,
+			wantVolumes: map[string]float32{"spotify": 1, "chrome-1": 1, "chrome-2": 1},
+		},
+		{
+			name:         "crossfade",
+			target:       "deej.crossfade(spotify.exe, chrome.exe)",
+			volume:       0.5,
+			wantAdjusted: []string{"chrome.exe", "chrome.exe", "spotify.exe"},
+			wantVolumes:  map[string]float32{"spotify": halfA, "chrome-1": halfB, "chrome-2": halfB},
+		},
+		{
+			name:         "chat mix",
+			target:       "deej.chatmix(spotify.exe, chrome.exe)",
+			volume:       0.75,
+			wantAdjusted: []string{"chrome.exe", "chrome.exe", "spotify.exe"},
+			wantVolumes:  map[string]float32{"spotify": 0.5, "chrome-1": 1, "chrome-2": 1},
+		},
+		{
+			name:         "external target",
+			target:       "obs:Mic/Aux",
+			volume:       0.6,
+			wantAdjusted: []string{"obs:Mic/Aux"},
+			wantVolumes:  map[string]float32{"spotify": 1, "chrome-1": 1, "chrome-2": 1},
+			wantExternal: map[string]float32{"Mic/Aux": 0.6},
+		},
+		{
+			name:        "failing external target",
+			target:      "obs:broken",
+			volume:      0.6,
+			wantVolumes: map[string]float32{"spotify": 1, "chrome-1": 1, "chrome-2": 1},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessions := map[string]*fakeSession{
+				"spotify":  newFakeSession("spotify.exe", "spotify", 1),
+				"chrome-1": newFakeSession("chrome.exe", "chrome-1", 1),
+				"chrome-2": newFakeSession("chrome.exe", "chrome-2", 1),
+			}
+
+			finder := &fakeSessionFinder{}
+			finder.setSessions(sessions["spotify"], sessions["chrome-1"], sessions["chrome-2"])
+
+			m := newTestSessionMap(t, newTestConfig(nil), finder)
+
+			external := make(map[string]float32)
+			m.registerExternalTarget("obs", func(name string, v float32) error {
+				if name == "broken" {
+					return errors.New("not connected")
+				}
+
+				external[name] = v
+				return nil
+			})
+
+			adjusted, err := m.setTargetVolume(test.target, test.volume)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("setTargetVolume error = %v, want error: %t", err, test.wantErr)
+			}
+
+			sort.Strings(adjusted)
+			if len(adjusted) > 0 || len(test.wantAdjusted) > 0 {
+				if !reflect.DeepEqual(adjusted, test.wantAdjusted) {
+					t.Errorf("adjusted = %q, want %q", adjusted, test.wantAdjusted)
+				}
+			}
+
+			for id, want := range test.wantVolumes {
+				if got := sessions[id].GetVolume(); got != want {
+					t.Errorf("volume of %s = %.3f, want %.3f", id, got, want)
+				}
+			}
+
+			if len(external) > 0 || len(test.wantExternal) > 0 {
+				if !reflect.DeepEqual(external, test.wantExternal) {
+					t.Errorf("external targets = %v, want %v", external, test.wantExternal)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSliderMoveEvents(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"master"},
+		1: {"spotify.exe", "discord.exe"},
+		2: {"game.exe"},
+	})
+
+	master := newFakeSession("master", "master", 1)
+	spotify := newFakeSession("spotify.exe", "1", 1)
+	discord := newFakeSession("discord.exe", "2", 1)
+	game := newFakeSession("game.exe", "3", 1)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(master, spotify, discord, game)
+
+	m := newTestSessionMap(t, config, finder)
+
+	// like a script taking over slider 2
+	m.registerSliderMoveHandler(func(event SliderMoveEvent) bool {
+		return event.SliderID == 2
+	})
+
+	m.handleSliderMoveEvents([]SliderMoveEvent{
+		{SliderID: 0, PercentValue: 0.2},
+		{SliderID: 1, PercentValue: 0.9},
+		{SliderID: 0, PercentValue: 0.25}, // only the latest move of a slider counts
+		{SliderID: 2, PercentValue: 0.1},
+	})
+
+	tests := []struct {
+		session *fakeSession
+		want    float32
+	}{
+		{master, 0.25},
+		{spotify, 0.9},
+		{discord, 0.9},
+		{game, 1},
+	}
+
+	for _, test := range tests {
+		if got := test.session.GetVolume(); got != test.want {
+			t.Errorf("volume of %s = %.2f, want %.2f", test.session.Key(), got, test.want)
+		}
+	}
+}
+
+func TestMissingTargetPolicies(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"discord.exe"},
+		1: {"chrome.exe"},
+		2: {"spotify.exe", "steam.exe"},
+	})
+
+	config.MissingTargets = map[string]MissingTargetPolicy{
+		"discord.exe": {Action: missingTargetBuffer},
+		"chrome.exe":  {Action: missingTargetIgnore},
+		"steam.exe":   {Action: missingTargetWarn},
+	}
+
+	spotify := newFakeSession("spotify.exe", "1", 1)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(spotify)
+
+	m := newTestSessionMap(t, config, finder)
+	missing := m.events.targetMissing.subscribe()
+
+	m.handleSliderMoveEvents([]SliderMoveEvent{
+		{SliderID: 0, PercentValue: 0.3},
+		{SliderID: 1, PercentValue: 0.4},
+		{SliderID: 2, PercentValue: 0.5},
+	})
+
+	// ignored targets aren't published, and the others in the order their sliders moved
+	want := []missingTargetEvent{
+		{Target: "discord.exe", Volume: 0.3, Policy: config.MissingTargets["discord.exe"]},
+		{Target: "steam.exe", Volume: 0.5, Policy: config.MissingTargets["steam.exe"]},
+	}
+
+	for _, wantEvent := range want {
+		if event := receive(t, missing); !reflect.DeepEqual(event, wantEvent) {
+			t.Errorf("published missing target = %+v, want %+v", event, wantEvent)
+		}
+	}
+
+	select {
+	case event := <-missing:
+		t.Errorf("unexpected missing target published: %+v", event)
+	default:
+	}
+
+	if got := spotify.GetVolume(); got != 0.5 {
+		t.Errorf("volume of spotify.exe = %.2f, want 0.50", got)
+	}
+}
+
+func TestRefreshKeepsKnownSessions(t *testing.T) {
+	kept := newFakeSession("spotify.exe", "1", 0.5)
+	gone := newFakeSession("discord.exe", "2", 0.5)
+	anonymous := newFakeSession("plugin", "", 0.5)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(kept, gone, anonymous)
+
+	m := newTestSessionMap(t, newTestConfig(nil), finder)
+
+	keptCopy := newFakeSession("spotify.exe", "1", 0.5)
+	anonymousCopy := newFakeSession("plugin", "", 0.5)
+	added := newFakeSession("vlc.exe", "3", 0.5)
+	finder.setSessions(keptCopy, anonymousCopy, added)
+
+	changes := m.events.sessionsChanged.subscribe()
+	m.refreshSessions(true)
+
+	change := receive(t, changes)
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+
+	if want := []string{"plugin", "vlc.exe"}; !reflect.DeepEqual(change.Added, want) {
+		t.Errorf("published added sessions = %q, want %q", change.Added, want)
+	}
+
+	if want := []string{"discord.exe", "plugin"}; !reflect.DeepEqual(change.Removed, want) {
+		t.Errorf("published removed sessions = %q, want %q", change.Removed, want)
+	}
+
+	tests := []struct {
+		name         string
+		session      *fakeSession
+		wantTracked  bool
+		wantReleased bool
+	}{
+		{"known session", kept, true, false},
+		{"fresh copy of a known session", keptCopy, false, true},
+		{"session that's gone", gone, false, true},
+		{"session without an ID", anonymous, false, true},
+		{"fresh copy of a session without an ID", anonymousCopy, true, false},
+		{"new session", added, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracked := false
+			for _, session := range m.snapshot() {
+				if session == Session(test.session) {
+					tracked = true
+				}
+			}
+
+			if tracked != test.wantTracked {
+				t.Errorf("tracked = %t, want %t", tracked, test.wantTracked)
+			}
+
+			if released := test.session.wasReleased(); released != test.wantReleased {
+				t.Errorf("released = %t, want %t", released, test.wantReleased)
+			}
+		})
+	}
+}
+
+func TestDefaultVolumes(t *testing.T) {
+	running := newFakeSession("discord.exe", "1", 0.9)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(running)
+
+	config := newTestConfig(nil)
+	config.DefaultVolumes = map[string]float32{"discord.exe": 0.5, "music": 0.3}
+	config.Aliases = map[string][]string{"music": {"spotify.exe"}}
+
+	m := newTestSessionMap(t, config, finder)
+
+	launched := newFakeSession("discord.exe", "2", 1)
+	aliased := newFakeSession("spotify.exe", "3", 1)
+	other := newFakeSession("vlc.exe", "4", 1)
+	anonymous := newFakeSession("discord.exe", "", 1)
+	finder.setSessions(running, launched, aliased, other, anonymous)
+
+	m.refreshSessions(true)
+
+	tests := []struct {
+		name    string
+		session *fakeSession
+		want    float32
+	}{
+		{"app running before deej started", running, 0.9},
+		{"newly launched app", launched, 0.5},
+		{"newly launched app, by alias", aliased, 0.3},
+		{"app without a default", other, 1},
+		{"session without an ID", anonymous, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.session.GetVolume(); got != test.want {
+				t.Errorf("volume = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewSessionsFollowSliders(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"game.exe"},
+		1: {"discord.exe"},
+		2: {"chat.exe"},
+	})
+
+	config.FollowSliders = true
+	config.DefaultVolumes = map[string]float32{"discord.exe": 0.5, "vlc.exe": 0.4}
+
+	finder := &fakeSessionFinder{}
+	m := newTestSessionMap(t, config, finder)
+
+	// like a script taking over slider 2
+	m.registerSliderMoveHandler(func(event SliderMoveEvent) bool {
+		return event.SliderID == 2
+	})
+
+	m.handleSliderMoveEvents([]SliderMoveEvent{
+		{SliderID: 0, PercentValue: 0.2},
+		{SliderID: 1, PercentValue: 0.6},
+		{SliderID: 2, PercentValue: 0.1},
+	})
+
+	game := newFakeSession("game.exe", "1", 1)
+	discord := newFakeSession("discord.exe", "2", 1)
+	chat := newFakeSession("chat.exe", "3", 1)
+	vlc := newFakeSession("vlc.exe", "4", 1)
+	finder.setSessions(game, discord, chat, vlc)
+
+	m.refreshSessions(true)
+
+	tests := []struct {
+		name    string
+		session *fakeSession
+		want    float32
+	}{
+		{"app on a slider", game, 0.2},
+		{"app on a slider, with a default", discord, 0.6},
+		{"app on a slider a script took over", chat, 1},
+		{"app on no slider, with a default", vlc, 0.4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.session.GetVolume(); got != test.want {
+				t.Errorf("volume = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSafetyCaps(t *testing.T) {
+	master := newFakeSession("master", "master", 1)
+	spotify := newFakeSession("spotify.exe", "1", 1)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(master, spotify)
+
+	config := newTestConfig(nil)
+	config.SafetyCaps = map[string]float32{"master": 0.8, "obs:mic": 0.5}
+
+	m := newTestSessionMap(t, config, finder)
+
+	var external float32
+	m.registerExternalTarget("obs", func(name string, v float32) error {
+		external = v
+		return nil
+	})
+
+	if got := master.GetVolume(); got != 0.8 {
+		t.Errorf("master volume once acquired = %v, want 0.8", got)
+	}
+
+	if got := spotify.GetVolume(); got != 1 {
+		t.Errorf("uncapped volume once acquired = %v, want 1", got)
+	}
+
+	if _, err := m.setTargetVolume("master", 1); err != nil {
+		t.Fatalf("setTargetVolume: %v", err)
+	}
+
+	if got := master.GetVolume(); got != 0.8 {
+		t.Errorf("master volume after setting it to 1 = %v, want 0.8", got)
+	}
+
+	if _, err := m.setTargetVolume("obs:Mic", 0.9); err != nil {
+		t.Fatalf("setTargetVolume: %v", err)
+	}
+
+	if external != 0.5 {
+		t.Errorf("external target volume = %v, want 0.5", external)
+	}
+
+	// raised in the OS mixer
+	master.SetVolume(0.95)
+	m.queueVolumeCheck(master)
+	m.checkVolumes()
+
+	if got := master.GetVolume(); got != 0.8 {
+		t.Errorf("master volume after raising it outside deej = %v, want 0.8", got)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	spotify := newFakeSession("spotify.exe", "1", 1)
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(spotify)
+
+	config := newTestConfig(map[int][]string{0: {"spotify.exe", "obs:Mic"}})
+	m := newTestSessionMap(t, config, finder)
+	m.dryRun = true
+
+	externalSet := false
+	m.registerExternalTarget("obs", func(name string, v float32) error {
+		externalSet = true
+		return nil
+	})
+
+	m.handleSliderMoveEvents([]SliderMoveEvent{{0, 0.25}})
+
+	if _, err := m.setTargetMute("spotify.exe", true); err != nil {
+		t.Fatalf("setTargetMute: %v", err)
+	}
+
+	if got := spotify.GetVolume(); got != 1 {
+		t.Errorf("volume = %v, want it untouched at 1", got)
+	}
+
+	if spotify.GetMute() {
+		t.Error("session was muted")
+	}
+
+	if externalSet {
+		t.Error("external target was set")
+	}
+
+	// deej carries on as if the volume was set
+	if got := m.cachedVolume(spotify); got != 0.25 {
+		t.Errorf("cached volume = %v, want 0.25", got)
+	}
+}
+
+func TestDescribeMappings(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"master"},
+		1: {"chrome.exe", "vlc.exe"},
+		3: {"deej.crossfade(spotify.exe, discord.exe)", "obs:Mic/Aux"},
+	})
+	config.SliderNames = map[int]string{1: "browser"}
+	config.DisabledSliders = map[int]bool{3: true, 5: true}
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(
+		newFakeSession("master", "master", 1),
+		newFakeSession("chrome.exe", "chrome-1", 1),
+		newFakeSession("chrome.exe", "chrome-2", 1),
+		newFakeSession("spotify.exe", "spotify", 1),
+	)
+
+	m := newTestSessionMap(t, config, finder)
+	m.registerExternalTarget("obs", func(string, float32) error { return nil })
+
+	want := []sliderMappingInfo{
+		{SliderID: 0, Targets: []mappedTarget{{Target: "master", SessionKeys: []string{"master"}}}},
+		{SliderID: 1, Name: "browser", Targets: []mappedTarget{
+			{Target: "chrome.exe", SessionKeys: []string{"chrome.exe", "chrome.exe"}},
+			{Target: "vlc.exe"},
+		}},
+		{SliderID: 3, Disabled: true, Targets: []mappedTarget{
+			{Target: "deej.crossfade(spotify.exe, discord.exe)", SessionKeys: []string{"spotify.exe"}},
+			{Target: "obs:Mic/Aux", External: true},
+		}},
+		{SliderID: 5, Disabled: true},
+	}
+
+	if got := m.describeMappings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("describeMappings() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChildProcessSessions(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"steam.exe"},
+		1: {"chrome.exe"},
+	})
+
+	m := newTestSessionMap(t, config, &fakeSessionFinder{})
+
+	steam := &fakeProcessSession{newFakeSession("steam.exe", "steam", 1), 10}
+	webHelper := &fakeProcessSession{newFakeSession("steamwebhelper.exe", "webhelper", 1), 11}
+	chrome := &fakeProcessSession{newFakeSession("chrome.exe", "chrome", 1), 20}
+	chromeAudio := &fakeProcessSession{newFakeSession("chrome.exe", "chrome-audio", 1), 21}
+
+	m.merge([]Session{steam, webHelper, chrome, chromeAudio}, map[int][]string{
+		11: {"steam.exe"},
+		21: {"chrome.exe"},
+	})
+
+	tests := []struct {
+		enabled   bool
+		wantSteam int
+	}{
+		{false, 1},
+		{true, 2},
+	}
+
+	for _, test := range tests {
+		enabled := test.enabled
+		config.MatchChildProcesses = enabled
+
+		if got, _ := m.get("steam.exe"); len(got) != test.wantSteam {
+			t.Errorf("with match_child_processes %t, get(steam.exe) = %v", enabled, got)
+		}
+
+		// chrome's audio service is already covered by its own key
+		if got, _ := m.get("chrome.exe"); len(got) != 2 {
+			t.Errorf("with match_child_processes %t, get(chrome.exe) = %v", enabled, got)
+		}
+
+		if mapped := m.sessionMapped(webHelper); mapped != enabled {
+			t.Errorf("with match_child_processes %t, sessionMapped(steamwebhelper.exe) = %t", enabled, mapped)
+		}
+	}
+}
+
+// volumeOnlySession is a session that can't be muted or metered
+type volumeOnlySession struct {
+	fake *fakeSession
+}
+
+func (s *volumeOnlySession) GetVolume() float32        { return s.fake.GetVolume() }
+func (s *volumeOnlySession) SetVolume(v float32) error { return s.fake.SetVolume(v) }
+func (s *volumeOnlySession) Key() string               { return s.fake.Key() }
+func (s *volumeOnlySession) ID() string                { return s.fake.ID() }
+func (s *volumeOnlySession) Release()                  { s.fake.Release() }
+
+func TestSetTargetMuteSkipsUnsupportedSessions(t *testing.T) {
+	spotify := newFakeSession("spotify.exe", "spotify", 1)
+	plugin := &volumeOnlySession{newFakeSession("plugin", "plugin", 1)}
+
+	finder := &fakeSessionFinder{}
+	finder.setSessions(spotify, plugin)
+	m := newTestSessionMap(t, newTestConfig(nil), finder)
+
+	adjusted, err := m.setTargetMute("spotify.exe", true)
+	if err != nil || !reflect.DeepEqual(adjusted, []string{"spotify.exe"}) {
+		t.Errorf("setTargetMute(spotify.exe) = %v, %v, want [spotify.exe]", adjusted, err)
+	}
+
+	if _, err := m.setTargetMute("plugin", true); !errors.Is(err, errMuteUnsupported) {
+		t.Errorf("setTargetMute(plugin) error = %v, want %v", err, errMuteUnsupported)
+	}
+
+	if _, muted, found := m.targetState("plugin"); !found || muted {
+		t.Errorf("targetState(plugin) = muted %t, found %t, want an unmuted session", muted, found)
+	}
+
+	if _, err := m.controlTargetMedia("spotify.exe", MediaController.PlayPause); !errors.Is(err, errMediaUnsupported) {
+		t.Errorf("controlTargetMedia(spotify.exe) error = %v, want %v", err, errMediaUnsupported)
+	}
+}
@@ -0,0 +1,133 @@
+package deej
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	// how many peak values PulseAudio sends per second for each metered session
+	paPeakRate = 25
+
+	// peaks older than this are considered silence, since PulseAudio stops sending them for paused streams
+	paPeakMaxAge = 500 * time.Millisecond
+)
+
+// paPeakMonitor meters sessions the way pavucontrol does, through peak-detecting record streams.
+// PulseAudio pushes the peaks to the shared client, which the session finder hands to dispatch.
+type paPeakMonitor struct {
+	logger *zap.SugaredLogger
+	client *proto.Client
+
+	lock  sync.Mutex
+	peaks map[uint32]paPeak // by record stream index
+}
+
+type paPeak struct {
+	value   float32
+	updated time.Time
+}
+
+func newPAPeakMonitor(logger *zap.SugaredLogger, client *proto.Client) *paPeakMonitor {
+	pm := &paPeakMonitor{
+		logger: logger.Named("peaks"),
+		client: client,
+		peaks:  make(map[uint32]paPeak),
+	}
+
+	return pm
+}
+
+// dispatch receives what PulseAudio sends without being asked, keeping only data from the meter streams
+func (pm *paPeakMonitor) dispatch(message interface{}) {
+	packet, ok := message.(*proto.DataPacket)
+	if !ok {
+		return
+	}
+
+	// each sample is the peak since the previous one
+	var peak float32
+	for i := 0; i+4 <= len(packet.Data); i += 4 {
+		sample := math.Float32frombits(binary.LittleEndian.Uint32(packet.Data[i:]))
+		if sample > peak {
+			peak = sample
+		}
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if _, ok := pm.peaks[packet.StreamIndex]; ok {
+		pm.peaks[packet.StreamIndex] = paPeak{value: peak, updated: time.Now()}
+	}
+}
+
+// open starts metering a source, returning the meter's stream index. To meter a single sink input instead
+// of everything on the source, pass its sink's monitor source and the sink input's index, or proto.Undefined otherwise.
+func (pm *paPeakMonitor) open(sourceIndex uint32, sinkInputIndex uint32) (uint32, error) {
+	request := proto.CreateRecordStream{
+		SampleSpec:             proto.SampleSpec{Format: proto.FormatFloat32LE, Channels: 1, Rate: paPeakRate},
+		ChannelMap:             proto.ChannelMap{proto.ChannelMono},
+		SourceIndex:            sourceIndex,
+		BufferMaxLength:        proto.Undefined,
+		BufferFragSize:         4,
+		PeakDetect:             true,
+		AdjustLatency:          true,
+		DontInhibitAutoSuspend: true,
+		DirectOnInputIndex:     sinkInputIndex,
+		Properties: proto.PropList{
+			"media.name": proto.PropListString("deej peak meter"),
+		},
+	}
+
+	var reply proto.CreateRecordStreamReply
+	if err := pm.client.Request(&request, &reply); err != nil {
+		return 0, fmt.Errorf("create peak record stream: %w", err)
+	}
+
+	pm.lock.Lock()
+	pm.peaks[reply.StreamIndex] = paPeak{}
+	pm.lock.Unlock()
+
+	return reply.StreamIndex, nil
+}
+
+// peak returns the latest peak of a meter stream
+func (pm *paPeakMonitor) peak(streamIndex uint32) float32 {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	peak := pm.peaks[streamIndex]
+	if time.Since(peak.updated) > paPeakMaxAge {
+		return 0
+	}
+
+	return peak.value
+}
+
+// close stops metering
+func (pm *paPeakMonitor) close(streamIndex uint32) {
+	pm.lock.Lock()
+	delete(pm.peaks, streamIndex)
+	pm.lock.Unlock()
+
+	if err := pm.client.Request(&proto.DeleteRecordStream{StreamIndex: streamIndex}, nil); err != nil {
+		pm.logger.Debugw("Failed to delete peak record stream", "stream", streamIndex, "error", err)
+	}
+}
+
+// monitorSourceIndex returns the index of the source that carries everything played on a sink
+func (pm *paPeakMonitor) monitorSourceIndex(sinkIndex uint32) (uint32, error) {
+	var reply proto.GetSinkInfoReply
+	if err := pm.client.Request(&proto.GetSinkInfo{SinkIndex: sinkIndex}, &reply); err != nil {
+		return 0, fmt.Errorf("get sink info: %w", err)
+	}
+
+	return reply.MonitorSourceIndex, nil
+}
@@ -3,7 +3,11 @@ package deej
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
 
 	ole "github.com/go-ole/go-ole"
 	ps "github.com/mitchellh/go-ps"
@@ -12,41 +16,64 @@ import (
 )
 
 var (
-	errNoSuchProcess      = errors.New("no such process")
-	errRefreshSessions    = errors.New("trigger session refresh")
-	sessionCreationLogMsg = "Creating new audio session"
-	systemSessionName     = "System Sounds"
-	sessionStringFormat   = "%s (Volume: %.2f)"
+	errNoSuchProcess   = errors.New("no such process")
+	errRefreshSessions = errors.New("trigger session refresh")
 )
 
+// wcaSession and masterSession call into WASAPI on their finder's COM thread, see comThread. Their fields are
+// only used on it too, other than the ones set when they're created.
 type wcaSession struct {
 	baseSession
+	com         *comThread
 	pid         uint32
 	processName string
 	control     *wca.IAudioSessionControl2
 	volume      *wca.ISimpleAudioVolume
+	meter       *wca.IAudioMeterInformation // queried from control on first use
+	channels    *iChannelAudioVolume        // queried from control on first use
+	leftGain    float32
+	rightGain   float32
 	eventCtx    *ole.GUID
+	events      *volumeEvents // nil unless watch succeeded
+	instanceID  string        // queried from control on first use
+	displayName string
+	iconPath    string
+
+	iconOnce sync.Once // the icon is only extracted once something asks for it
+	icon     []byte
+	iconErr  error
 }
 
 type masterSession struct {
 	baseSession
-	volume    *wca.IAudioEndpointVolume
-	eventCtx  *ole.GUID
-	stale     bool // Flag indicating if the session needs to be refreshed
+	com      *comThread
+	volume   *wca.IAudioEndpointVolume
+	meter    *wca.IAudioMeterInformation // nil if the device can't be metered
+	eventCtx *ole.GUID
+	events   *volumeEvents // nil unless watchVolume succeeded
+	stale    bool          // Flag indicating if the session needs to be refreshed
+
+	leftGain    float32
+	rightGain   float32
+	deviceGains map[string]float32 // set by channel: targets, by channel name
 }
 
 func newWCASession(
 	logger *zap.SugaredLogger,
+	com *comThread,
 	control *wca.IAudioSessionControl2,
 	volume *wca.ISimpleAudioVolume,
 	pid uint32,
 	eventCtx *ole.GUID,
 ) (*wcaSession, error) {
 	s := &wcaSession{
-		control:  control,
-		volume:   volume,
-		pid:      pid,
-		eventCtx: eventCtx,
+		com:       com,
+		control:   control,
+		volume:    volume,
+		pid:       pid,
+		eventCtx:  eventCtx,
+		leftGain:  1,
+		rightGain: 1,
 	}
 
 	// Special treatment for system sounds session
@@ -73,21 +100,29 @@ func newWCASession(
 	}
 
 	s.logger = logger.Named(strings.TrimSuffix(s.Key(), ".exe"))
-	s.logger.Debugw(sessionCreationLogMsg, "session", s)
+	s.describe()
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
 
 	return s, nil
 }
 
 func newMasterSession(
 	logger *zap.SugaredLogger,
+	com *comThread,
 	volume *wca.IAudioEndpointVolume,
+	meter *wca.IAudioMeterInformation,
 	eventCtx *ole.GUID,
 	key string,
 	loggerKey string,
 ) (*masterSession, error) {
 	s := &masterSession{
-		volume:   volume,
-		eventCtx: eventCtx,
+		com:         com,
+		volume:      volume,
+		meter:       meter,
+		eventCtx:    eventCtx,
+		leftGain:    1,
+		rightGain:   1,
+		deviceGains: make(map[string]float32),
 	}
 
 	s.logger = logger.Named(loggerKey)
@@ -95,14 +130,14 @@ func newMasterSession(
 	s.name = key
 	s.humanReadableDesc = key
 
-	s.logger.Debugw(sessionCreationLogMsg, "session", s)
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
 
 	return s, nil
 }
 
 func (s *wcaSession) GetVolume() float32 {
 	var level float32
-	if err := s.volume.GetMasterVolume(&level); err != nil {
+	if err := s.com.run(func() error { return s.volume.GetMasterVolume(&level) }); err != nil {
 		s.logger.Warnw("Failed to get session volume", "error", err)
 		return 0.0
 	}
@@ -110,14 +145,14 @@ func (s *wcaSession) GetVolume() float32 {
 }
 
 func (s *wcaSession) SetVolume(v float32) error {
-	if err := s.volume.SetMasterVolume(v, s.eventCtx); err != nil {
+	if err := s.com.run(func() error { return s.volume.SetMasterVolume(v, s.eventCtx) }); err != nil {
 		s.logger.Warnw("Failed to set session volume", "error", err)
 		return fmt.Errorf("adjust session volume: %w", err)
 	}
 
 	// Check if the session has expired after adjusting the volume
 	var state uint32
-	if err := s.control.GetState(&state); err != nil {
+	if err := s.com.run(func() error { return s.control.GetState(&state) }); err != nil {
 		s.logger.Warnw("Failed to get session state while setting volume", "error", err)
 		return fmt.Errorf("get session state: %w", err)
 	}
@@ -131,11 +166,156 @@ func (s *wcaSession) SetVolume(v float32) error {
 	return nil
 }
 
+func (s *wcaSession) GetMute() bool {
+	var muted bool
+	if err := s.com.run(func() error { return s.volume.GetMute(&muted) }); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+	return muted
+}
+
+func (s *wcaSession) SetMute(m bool) error {
+	if err := s.com.run(func() error { return s.volume.SetMute(m, s.eventCtx) }); err != nil {
+		s.logger.Warnw("Failed to set session mute state", "error", err)
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+	return nil
+}
+
+func (s *wcaSession) GetPeak() float32 {
+	var peak float32
+
+	err := s.com.run(func() error {
+		if s.meter == nil {
+			if err := s.control.PutQueryInterface(wca.IID_IAudioMeterInformation, &s.meter); err != nil {
+				return fmt.Errorf("get session meter: %w", err)
+			}
+		}
+
+		return s.meter.GetPeakValue(&peak)
+	})
+	if err != nil {
+		s.logger.Debugw("Failed to get session peak", "error", err)
+		return 0.0
+	}
+	return peak
+}
+
+// ID returns the session's instance identifier, which Windows assigns to each session of a process
+func (s *wcaSession) ID() string {
+	var id string
+
+	s.com.run(func() error {
+		if s.instanceID == "" {
+			if err := s.control.GetSessionInstanceIdentifier(&s.instanceID); err != nil {
+				s.logger.Debugw("Failed to get session instance identifier", "error", err)
+				s.instanceID = ""
+			}
+		}
+
+		id = s.instanceID
+		return nil
+	})
+
+	return id
+}
+
+// DisplayName returns the name the app gave its session, or failing that, its executable's description
+func (s *wcaSession) DisplayName() string {
+	return s.displayName
+}
+
+// IconPath returns the icon the app gave its session, or failing that, its executable's icon
+func (s *wcaSession) IconPath() string {
+	return s.iconPath
+}
+
+// processID returns the PID of the process playing the session's audio, or 0 for system sounds
+func (s *wcaSession) processID() int {
+	return int(s.pid)
+}
+
+// setChannelGains sets the session's channel volumes, which Windows applies on top of its volume
+func (s *wcaSession) setChannelGains(left float32, right float32) error {
+	return s.com.run(func() error { return s.applyChannelGains(left, right) })
+}
+
+// applyChannelGains does setChannelGains' work on the COM thread
+func (s *wcaSession) applyChannelGains(left float32, right float32) error {
+	if s.channels == nil {
+		if err := s.control.PutQueryInterface(wca.IID_IChannelAudioVolume, &s.channels); err != nil {
+			return fmt.Errorf("get session channel volume: %w", err)
+		}
+	}
+
+	count, err := s.channels.getChannelCount()
+	if err != nil {
+		return fmt.Errorf("get session channel count: %w", err)
+	}
+
+	for channel := uint32(0); channel < count; channel++ {
+		if err := s.channels.setChannelVolume(channel, channelGain(channel, count, left, right), s.eventCtx); err != nil {
+			return fmt.Errorf("adjust session channel %d volume: %w", channel, err)
+		}
+	}
+
+	s.leftGain, s.rightGain = left, right
+
+	s.logger.Debugw("Adjusting session channel gains", "left", fmt.Sprintf("%.2f", left), "right", fmt.Sprintf("%.2f", right))
+	return nil
+}
+
+// channelGains returns the session's channel gains, which are 1 until set
+func (s *wcaSession) channelGains() (left float32, right float32) {
+	s.com.run(func() error {
+		left, right = s.leftGain, s.rightGain
+		return nil
+	})
+
+	return left, right
+}
+
+// watch calls onChange whenever the session's volume is changed by anything but deej,
+// and onExpired once the session expires. Either can be nil.
+func (s *wcaSession) watch(onChange func(), onExpired func()) error {
+	return s.com.run(func() error {
+		events := newSessionEvents(s.eventCtx, onChange, onExpired)
+		if err := s.control.RegisterAudioSessionNotification(events.asSessionEvents()); err != nil {
+			return fmt.Errorf("register audio session notification: %w", err)
+		}
+
+		s.events = events
+		return nil
+	})
+}
+
 func (s *wcaSession) Release() {
 	s.logger.Debug("Releasing audio session")
+	s.com.run(func() error {
+		s.release()
+		return nil
+	})
+}
+
+// release does Release's work on the COM thread
+func (s *wcaSession) release() {
+	if s.events != nil {
+		if err := s.control.UnregisterAudioSessionNotification(s.events.asSessionEvents()); err != nil {
+			s.logger.Debugw("Failed to unregister audio session notification", "error", err)
+		}
+	}
 	if s.volume != nil {
 		s.volume.Release()
 	}
+	if s.meter != nil {
+		s.meter.Release()
+	}
+	if s.channels != nil {
+		s.channels.Release()
+	}
 	if s.control != nil {
 		s.control.Release()
 	}
@@ -147,7 +327,7 @@ func (s *wcaSession) String() string {
 
 func (s *masterSession) GetVolume() float32 {
 	var level float32
-	if err := s.volume.GetMasterVolumeLevelScalar(&level); err != nil {
+	if err := s.com.run(func() error { return s.volume.GetMasterVolumeLevelScalar(&level) }); err != nil {
 		s.logger.Warnw("Failed to get session volume", "error", err)
 		return 0.0
 	}
@@ -155,31 +335,317 @@ func (s *masterSession) GetVolume() float32 {
 }
 
 func (s *masterSession) SetVolume(v float32) error {
+	return s.com.run(func() error {
+		if s.stale {
+			s.logger.Warnw("Session expired because default device has changed, triggering session refresh")
+			return errRefreshSessions
+		}
+
+		if err := s.volume.SetMasterVolumeLevelScalar(v, s.eventCtx); err != nil {
+			s.logger.Warnw("Failed to set session volume", "error", err, "volume", v)
+			return fmt.Errorf("adjust session volume: %w", err)
+		}
+
+		s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+		return nil
+	})
+}
+
+func (s *masterSession) GetMute() bool {
+	var muted bool
+	if err := s.com.run(func() error { return s.volume.GetMute(&muted) }); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+	return muted
+}
+
+func (s *masterSession) SetMute(m bool) error {
+	return s.com.run(func() error {
+		if s.stale {
+			s.logger.Warnw("Session expired because default device has changed, triggering session refresh")
+			return errRefreshSessions
+		}
+
+		if err := s.volume.SetMute(m, s.eventCtx); err != nil {
+			s.logger.Warnw("Failed to set session mute state", "error", err, "mute", m)
+			return fmt.Errorf("adjust session mute state: %w", err)
+		}
+
+		s.logger.Debugw("Adjusting session mute state", "to", m)
+		return nil
+	})
+}
+
+func (s *masterSession) GetPeak() float32 {
+	var peak float32
+
+	err := s.com.run(func() error {
+		if s.meter == nil || s.stale {
+			return nil
+		}
+
+		return s.meter.GetPeakValue(&peak)
+	})
+	if err != nil {
+		s.logger.Debugw("Failed to get session peak", "error", err)
+		return 0.0
+	}
+	return peak
+}
+
+// setChannelGains sets the device's channel volumes relative to its volume. Windows keeps them in proportion as the
+// device's volume changes, with the loudest one at the device's volume.
+func (s *masterSession) setChannelGains(left float32, right float32) error {
+	return s.com.run(func() error {
+		previousLeft, previousRight := s.leftGain, s.rightGain
+		s.leftGain, s.rightGain = left, right
+
+		if err := s.applyChannelGains(); err != nil {
+			s.leftGain, s.rightGain = previousLeft, previousRight
+			return err
+		}
+
+		s.logger.Debugw("Adjusting session channel gains", "left", fmt.Sprintf("%.2f", left), "right", fmt.Sprintf("%.2f", right))
+		return nil
+	})
+}
+
+// channelGains returns the device's channel gains, which are 1 until set
+func (s *masterSession) channelGains() (left float32, right float32) {
+	s.com.run(func() error {
+		left, right = s.leftGain, s.rightGain
+		return nil
+	})
+
+	return left, right
+}
+
+// setDeviceChannelGain sets one of the device's channels relative to its volume
+func (s *masterSession) setDeviceChannelGain(channel string, gain float32) error {
+	return s.com.run(func() error {
+		var count uint32
+		if err := s.volume.GetChannelCount(&count); err != nil {
+			return fmt.Errorf("get device channel count: %w", err)
+		}
+
+		if _, ok := deviceChannelIndex(channel, count); !ok {
+			return errDeviceChannelMissing
+		}
+
+		previous, wasSet := s.deviceGains[channel]
+		s.deviceGains[channel] = gain
+
+		if err := s.applyChannelGains(); err != nil {
+			if wasSet {
+				s.deviceGains[channel] = previous
+			} else {
+				delete(s.deviceGains, channel)
+			}
+
+			return err
+		}
+
+		s.logger.Debugw("Adjusting device channel gain", "channel", channel, "to", fmt.Sprintf("%.2f", gain))
+		return nil
+	})
+}
+
+// applyChannelGains sets each of the device's channels to its share of the device's volume. It runs on the COM thread.
+func (s *masterSession) applyChannelGains() error {
 	if s.stale {
 		s.logger.Warnw("Session expired because default device has changed, triggering session refresh")
 		return errRefreshSessions
 	}
 
-	if err := s.volume.SetMasterVolumeLevelScalar(v, s.eventCtx); err != nil {
-		s.logger.Warnw("Failed to set session volume", "error", err, "volume", v)
-		return fmt.Errorf("adjust session volume: %w", err)
+	var count uint32
+	if err := s.volume.GetChannelCount(&count); err != nil {
+		return fmt.Errorf("get device channel count: %w", err)
+	}
+
+	v := s.GetVolume()
+
+	for channel := uint32(0); channel < count; channel++ {
+		gain := channelGain(channel, count, s.leftGain, s.rightGain)
+
+		for name, deviceGain := range s.deviceGains {
+			if idx, ok := deviceChannelIndex(name, count); ok && idx == channel {
+				gain *= deviceGain
+			}
+		}
+
+		if err := s.volume.SetChannelVolumeLevelScalar(channel, v*gain, s.eventCtx); err != nil {
+			return fmt.Errorf("adjust device channel %d volume: %w", channel, err)
+		}
 	}
 
-	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
 	return nil
 }
 
+// ID is empty once the default device has changed, so the next refresh replaces the session
+func (s *masterSession) ID() string {
+	stale := false
+	s.com.run(func() error {
+		stale = s.stale
+		return nil
+	})
+
+	if stale {
+		return ""
+	}
+
+	return s.name
+}
+
+// watchVolume calls onChange whenever the device's volume is changed by anything but deej.
+// go-wca leaves (Un)RegisterControlChangeNotify unimplemented, so they're called through the vtable.
+func (s *masterSession) watchVolume(onChange func()) error {
+	return s.com.run(func() error {
+		events := newEndpointVolumeEvents(s.eventCtx, onChange)
+
+		hr, _, _ := syscall.SyscallN(
+			s.volume.VTable().RegisterControlChangeNotify,
+			uintptr(unsafe.Pointer(s.volume)),
+			uintptr(unsafe.Pointer(events)),
+		)
+		if hr != ole.S_OK {
+			return fmt.Errorf("register control change notification: %w", ole.NewError(hr))
+		}
+
+		s.events = events
+		return nil
+	})
+}
+
 func (s *masterSession) Release() {
 	s.logger.Debug("Releasing audio session")
+	s.com.run(func() error {
+		s.release()
+		return nil
+	})
+}
+
+// release does Release's work on the COM thread
+func (s *masterSession) release() {
+	if s.events != nil {
+		hr, _, _ := syscall.SyscallN(
+			s.volume.VTable().UnregisterControlChangeNotify,
+			uintptr(unsafe.Pointer(s.volume)),
+			uintptr(unsafe.Pointer(s.events)),
+		)
+		if hr != ole.S_OK {
+			s.logger.Debugw("Failed to unregister control change notification", "error", ole.NewError(hr))
+		}
+	}
 	if s.volume != nil {
 		s.volume.Release()
 	}
+	if s.meter != nil {
+		s.meter.Release()
+	}
 }
 
 func (s *masterSession) String() string {
 	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
 }
 
+// markAsStale runs on the COM thread, see defaultDeviceChangedCallback
 func (s *masterSession) markAsStale() {
 	s.stale = true
-}
\ No newline at end of file
+}
+
+// deviceChannelIndex finds a channel: target's channel among a device's channels, going by the usual Windows speaker
+// order for the channel count: front left and right, then LFE on 2.1; rear left and right on quadraphonic; center,
+// LFE and rear (or side) left and right on 5.1; and center, LFE, rear left and right and side left and right on 7.1
+func deviceChannelIndex(channel string, count uint32) (uint32, bool) {
+	var layout []string
+
+	switch count {
+	case 3:
+		layout = []string{"", "", deviceChannelLFE}
+	case 4:
+		layout = []string{"", "", deviceChannelRearLeft, deviceChannelRearRight}
+	case 6:
+		layout = []string{"", "", deviceChannelCenter, deviceChannelLFE, deviceChannelRearLeft, deviceChannelRearRight}
+	case 8:
+		layout = []string{"", "", deviceChannelCenter, deviceChannelLFE, deviceChannelRearLeft, deviceChannelRearRight,
+			deviceChannelSideLeft, deviceChannelSideRight}
+	}
+
+	for idx, name := range layout {
+		if name == channel {
+			return uint32(idx), true
+		}
+	}
+
+	// 5.1 devices may call their back channels side channels
+	if count == 6 && (channel == deviceChannelSideLeft || channel == deviceChannelSideRight) {
+		return deviceChannelIndex(strings.Replace(channel, "side", "rear", 1), count)
+	}
+
+	return 0, false
+}
+
+// channelGain picks the left or right gain for a channel, going by the usual Windows channel order: front left
+// and right first, then center and LFE on surround layouts, then pairs of left and right channels
+func channelGain(channel uint32, count uint32, left float32, right float32) float32 {
+	switch {
+	case count < 2:
+		return 1
+	case count > 2 && (channel == 2 || channel == 3):
+		return 1
+	case channel%2 == 0:
+		return left
+	default:
+		return right
+	}
+}
+
+// iChannelAudioVolume controls a session's per-channel volumes. go-wca only defines its IID, so its methods
+// are called through the vtable.
+type iChannelAudioVolume struct {
+	ole.IUnknown
+}
+
+type iChannelAudioVolumeVtbl struct {
+	ole.IUnknownVtbl
+	GetChannelCount  uintptr
+	SetChannelVolume uintptr
+	GetChannelVolume uintptr
+	SetAllVolumes    uintptr
+	GetAllVolumes    uintptr
+}
+
+func (v *iChannelAudioVolume) vtable() *iChannelAudioVolumeVtbl {
+	return (*iChannelAudioVolumeVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+func (v *iChannelAudioVolume) getChannelCount() (uint32, error) {
+	var count uint32
+
+	hr, _, _ := syscall.SyscallN(
+		v.vtable().GetChannelCount,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if hr != ole.S_OK {
+		return 0, ole.NewError(hr)
+	}
+
+	return count, nil
+}
+
+func (v *iChannelAudioVolume) setChannelVolume(channel uint32, level float32, eventCtx *ole.GUID) error {
+	hr, _, _ := syscall.SyscallN(
+		v.vtable().SetChannelVolume,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(channel),
+		uintptr(math.Float32bits(level)),
+		uintptr(unsafe.Pointer(eventCtx)),
+	)
+	if hr != ole.S_OK {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
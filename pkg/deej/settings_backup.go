@@ -0,0 +1,193 @@
+package deej
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	settingsBackupFilename        = "deej-settings-%s.zip"
+	settingsBackupTimestampFormat = "2006.01.02-15.04.05"
+
+	// a settings backup is only a few kilobytes, so anything much bigger isn't one
+	settingsBackupMaxFileSize = 1 << 20
+)
+
+// errNoSettingsBackup is returned by importSettings when there's no backup to import
+var errNoSettingsBackup = errors.New("no settings backup found")
+
+// settingsBackupFiles returns where each file in a settings backup lives, by its name in the backup
+func settingsBackupFiles() map[string]string {
+	return map[string]string{
+		userConfigFilepath:     userConfigFilepath,
+		internalConfigFilepath: path.Join(internalConfigPath, internalConfigFilepath),
+	}
+}
+
+// exportSettings zips up the config and the preferences deej saves on its own (such as slider positions and paired
+// phones), for moving them to another computer. Unlike a support bundle, nothing is redacted. The backup is saved to
+// the desktop if there is one, or to the logs folder otherwise, and its path is returned.
+func (d *Deej) exportSettings() (string, error) {
+	return writeSettingsBackup(supportBundleDirectory())
+}
+
+// importSettings restores the newest settings backup on the desktop (or in the logs folder), replacing the config and
+// preferences and reloading them. The settings it replaces are backed up to the logs folder first, in case the wrong
+// backup was imported. It returns the paths of the imported backup and of the one made first.
+func (d *Deej) importSettings() (string, string, error) {
+	backupPath, err := latestSettingsBackup(supportBundleDirectory())
+	if err != nil {
+		return "", "", err
+	}
+
+	files, err := readSettingsBackup(backupPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	previousPath, err := writeSettingsBackup(LogDirectory)
+	if err != nil {
+		return "", "", fmt.Errorf("back up current settings: %w", err)
+	}
+
+	targets := settingsBackupFiles()
+	for name, data := range files {
+		target := targets[name]
+		if err := util.EnsureDirExists(filepath.Dir(target)); err != nil {
+			return "", "", err
+		}
+
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return "", "", fmt.Errorf("write %s: %w", target, err)
+		}
+	}
+
+	d.logger.Infow("Imported settings", "path", backupPath, "previousSettings", previousPath)
+
+	// the config watcher would notice the new config.yaml on its own, but not the preferences
+	if err := d.config.Reload(); err != nil {
+		return "", "", err
+	}
+
+	return backupPath, previousPath, nil
+}
+
+// writeSettingsBackup saves the current settings to a new backup in the given directory, returning its path
+func writeSettingsBackup(directory string) (string, error) {
+	var contents bytes.Buffer
+	archive := zip.NewWriter(&contents)
+
+	for name, source := range settingsBackupFiles() {
+		data, err := os.ReadFile(source)
+		if errors.Is(err, fs.ErrNotExist) {
+			// preferences only exist once deej saved something
+			continue
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", source, err)
+		}
+
+		w, err := archive.Create(name)
+		if err != nil {
+			return "", fmt.Errorf("add %s to settings backup: %w", name, err)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return "", fmt.Errorf("add %s to settings backup: %w", name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", fmt.Errorf("finish settings backup: %w", err)
+	}
+
+	if err := util.EnsureDirExists(directory); err != nil {
+		return "", err
+	}
+
+	backupPath := filepath.Join(directory, fmt.Sprintf(settingsBackupFilename, time.Now().Format(settingsBackupTimestampFormat)))
+	if err := os.WriteFile(backupPath, contents.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write settings backup: %w", err)
+	}
+
+	return backupPath, nil
+}
+
+// latestSettingsBackup finds the newest settings backup in a directory. Their names sort by when they were made.
+func latestSettingsBackup(directory string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(directory, fmt.Sprintf(settingsBackupFilename, "*")))
+	if err != nil {
+		return "", fmt.Errorf("find settings backups: %w", err)
+	}
+
+	if len(paths) == 0 {
+		return "", errNoSettingsBackup
+	}
+
+	sort.Strings(paths)
+
+	return paths[len(paths)-1], nil
+}
+
+// readSettingsBackup reads the files in a settings backup, by name, checking that it has a config that parses.
+// Files other than the config and preferences are ignored.
+func readSettingsBackup(backupPath string) (map[string][]byte, error) {
+	archive, err := zip.OpenReader(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("open settings backup: %w", err)
+	}
+
+	defer archive.Close()
+
+	known := settingsBackupFiles()
+	files := make(map[string][]byte)
+
+	for _, file := range archive.File {
+		if _, ok := known[file.Name]; !ok {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s in settings backup: %w", file.Name, err)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(reader, settingsBackupMaxFileSize+1))
+		reader.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("read %s in settings backup: %w", file.Name, err)
+		}
+
+		if len(data) > settingsBackupMaxFileSize {
+			return nil, fmt.Errorf("%s in settings backup is too big", file.Name)
+		}
+
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("parse %s in settings backup: %w", file.Name, err)
+		}
+
+		files[file.Name] = data
+	}
+
+	if _, ok := files[userConfigFilepath]; !ok {
+		return nil, fmt.Errorf("settings backup has no %s", userConfigFilepath)
+	}
+
+	return files, nil
+}
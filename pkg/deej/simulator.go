@@ -0,0 +1,218 @@
+package deej
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// the highest raw value a board sends for a slider, matching the Arduino's 10-bit ADC
+const simulatorMaxValue = 1023
+
+// the waveforms a simulated slider can follow
+const (
+	WaveformSine     = "sine"
+	WaveformTriangle = "triangle"
+	WaveformSawtooth = "saw"
+	WaveformSquare   = "square"
+	WaveformRandom   = "random"
+	WaveformStatic   = "static"
+)
+
+// Waveforms lists every waveform the simulator supports
+var Waveforms = []string{WaveformSine, WaveformTriangle, WaveformSawtooth, WaveformSquare, WaveformRandom, WaveformStatic}
+
+// SimulatorOptions configures a simulated board
+type SimulatorOptions struct {
+	// the serial port to write to. If empty, a virtual port is created where the platform supports it
+	Port     string
+	BaudRate int
+
+	Sliders  int
+	Rate     time.Duration // between lines, like the delay in the Arduino sketch's loop
+	Waveform string
+	Period   time.Duration // of one full sweep of the waveform
+	Jitter   int           // the most raw units a value randomly strays by, like a noisy potentiometer
+	Static   int           // the raw value the static waveform holds
+}
+
+// Simulate pretends to be a board running the deej sketch, writing synthetic slider data to a serial port until
+// ctx is done, so deej can be developed and tested without hardware. Lines deej sends back (VU meter levels and
+// volume feedback) are written to w along with status messages.
+func Simulate(ctx context.Context, w io.Writer, options SimulatorOptions) error {
+	waveform, err := newWaveform(options)
+	if err != nil {
+		return err
+	}
+
+	if options.Sliders < 1 {
+		return fmt.Errorf("need at least one slider, got %d", options.Sliders)
+	}
+
+	if options.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %s", options.Rate)
+	}
+
+	var port io.ReadWriteCloser
+
+	if options.Port == "" {
+		var name string
+
+		port, name, err = openVirtualPort()
+		if err != nil {
+			return fmt.Errorf("create virtual serial port: %w", err)
+		}
+
+		fmt.Fprintf(w, "Created virtual serial port %s, set com_port: %s in config.yaml to use it\n", name, name)
+	} else {
+		port, err = serial.Open(serial.OpenOptions{
+			PortName:        options.Port,
+			BaudRate:        uint(options.BaudRate),
+			DataBits:        8,
+			StopBits:        1,
+			MinimumReadSize: 1,
+		})
+		if err != nil {
+			return fmt.Errorf("open serial port %s: %w", options.Port, err)
+		}
+
+		fmt.Fprintf(w, "Writing to %s @ %d baud, point deej at the other end of the pair\n", options.Port, options.BaudRate)
+	}
+
+	// closing the port also ends the read loop below
+	util.Go(crashOnPanic, func() {
+		<-ctx.Done()
+		port.Close()
+	})
+
+	util.Go(crashOnPanic, func() { echoSimulatorInput(port, w) })
+
+	fmt.Fprintf(w, "Simulating %d sliders (%s, period %s, jitter %d), press Ctrl+C to stop\n",
+		options.Sliders, options.Waveform, options.Period, options.Jitter)
+
+	ticker := time.NewTicker(options.Rate)
+	defer ticker.Stop()
+
+	start := time.Now()
+	values := make([]string, options.Sliders)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			elapsed := now.Sub(start)
+
+			for slider := range values {
+				// spread the sliders out so they don't all move in lockstep
+				phase := float64(slider) / float64(options.Sliders)
+				value := waveform(slider, elapsed, phase)
+
+				if options.Jitter > 0 {
+					value += rand.Intn(2*options.Jitter+1) - options.Jitter
+				}
+
+				values[slider] = strconv.Itoa(clampRawValue(value))
+			}
+
+			if _, err := io.WriteString(port, strings.Join(values, "|")+"\r\n"); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				return fmt.Errorf("write to serial port: %w", err)
+			}
+		}
+	}
+}
+
+// waveform returns a slider's raw value after elapsed time, with phase (0-1) offsetting it within the period
+type waveform func(slider int, elapsed time.Duration, phase float64) int
+
+func newWaveform(options SimulatorOptions) (waveform, error) {
+	if options.Period <= 0 && options.Waveform != WaveformStatic {
+		return nil, fmt.Errorf("period must be positive, got %s", options.Period)
+	}
+
+	position := func(elapsed time.Duration, phase float64) float64 {
+		_, fraction := math.Modf(elapsed.Seconds()/options.Period.Seconds() + phase)
+		return fraction
+	}
+
+	switch options.Waveform {
+	case WaveformSine:
+		return func(_ int, elapsed time.Duration, phase float64) int {
+			return int(math.Round((1 - math.Cos(2*math.Pi*position(elapsed, phase))) / 2 * simulatorMaxValue))
+		}, nil
+
+	case WaveformTriangle:
+		return func(_ int, elapsed time.Duration, phase float64) int {
+			return int(math.Round((1 - math.Abs(2*position(elapsed, phase)-1)) * simulatorMaxValue))
+		}, nil
+
+	case WaveformSawtooth:
+		return func(_ int, elapsed time.Duration, phase float64) int {
+			return int(math.Round(position(elapsed, phase) * simulatorMaxValue))
+		}, nil
+
+	case WaveformSquare:
+		return func(_ int, elapsed time.Duration, phase float64) int {
+			if position(elapsed, phase) < 0.5 {
+				return 0
+			}
+
+			return simulatorMaxValue
+		}, nil
+
+	case WaveformRandom:
+		// each slider wanders on its own, covering about its full range once per period
+		var values []float64
+		lastElapsed := make(map[int]time.Duration)
+
+		return func(slider int, elapsed time.Duration, _ float64) int {
+			for len(values) <= slider {
+				values = append(values, rand.Float64()*simulatorMaxValue)
+			}
+
+			step := (elapsed - lastElapsed[slider]).Seconds() / options.Period.Seconds() * simulatorMaxValue
+			lastElapsed[slider] = elapsed
+
+			values[slider] += (rand.Float64()*2 - 1) * step * 2
+			values[slider] = math.Max(0, math.Min(simulatorMaxValue, values[slider]))
+
+			return int(math.Round(values[slider]))
+		}, nil
+
+	case WaveformStatic:
+		return func(int, time.Duration, float64) int {
+			return options.Static
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown waveform %q (expected one of %s)", options.Waveform, strings.Join(Waveforms, ", "))
+}
+
+func clampRawValue(value int) int {
+	return max(0, min(simulatorMaxValue, value))
+}
+
+// echoSimulatorInput prints the lines deej sends to the board until the port is closed
+func echoSimulatorInput(port io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(port)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fmt.Fprintf(w, "<- %s\n", line)
+		}
+	}
+}
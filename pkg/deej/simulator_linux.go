@@ -0,0 +1,68 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// virtualPort is the controlling end of a pseudo-terminal. deej opens the other end as if it was a board's serial port.
+type virtualPort struct {
+	*os.File
+
+	// held open so writes don't fail while deej isn't connected
+	peer *os.File
+}
+
+func (p *virtualPort) Close() error {
+	p.peer.Close()
+	return p.File.Close()
+}
+
+// openVirtualPort creates a pseudo-terminal pair, returning its controlling end and the name of the end deej opens
+func openVirtualPort() (io.ReadWriteCloser, string, error) {
+	controller, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("open /dev/ptmx: %w", err)
+	}
+
+	fd := int(controller.Fd())
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		controller.Close()
+		return nil, "", fmt.Errorf("unlock pseudo-terminal: %w", err)
+	}
+
+	number, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		controller.Close()
+		return nil, "", fmt.Errorf("get pseudo-terminal number: %w", err)
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", number)
+
+	peer, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		controller.Close()
+		return nil, "", fmt.Errorf("open %s: %w", name, err)
+	}
+
+	// a terminal echoes what it receives and mangles line endings, which a serial port doesn't
+	termios, err := unix.IoctlGetTermios(int(peer.Fd()), unix.TCGETS)
+	if err == nil {
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		err = unix.IoctlSetTermios(int(peer.Fd()), unix.TCSETS, termios)
+	}
+
+	if err != nil {
+		peer.Close()
+		controller.Close()
+		return nil, "", fmt.Errorf("configure %s: %w", name, err)
+	}
+
+	return &virtualPort{File: controller, peer: peer}, name, nil
+}
@@ -0,0 +1,12 @@
+package deej
+
+import (
+	"errors"
+	"io"
+)
+
+// openVirtualPort can't create a port on Windows, which needs a driver for that
+func openVirtualPort() (io.ReadWriteCloser, string, error) {
+	return nil, "", errors.New("windows needs a virtual COM port pair, e.g. from com0com: " +
+		"pass one end of the pair with --port and set com_port in config.yaml to the other")
+}
@@ -3,6 +3,7 @@ package deej
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/thoas/go-funk"
@@ -21,13 +22,14 @@ func newSliderMap() *sliderMap {
 }
 
 // sliderMapFromConfigs initializes a new sliderMap from user and internal mappings.
-func sliderMapFromConfigs(userMapping map[string][]string, internalMapping map[string][]string) *sliderMap {
+// Sliders are referred to by index or by one of the names in sliderIdxs.
+func sliderMapFromConfigs(userMapping map[string][]string, internalMapping map[string][]string, sliderIdxs map[string]int) *sliderMap {
 	resultMap := newSliderMap()
 
 	// Copy targets from user config, ignoring empty values
-	for sliderIdxString, targets := range userMapping {
-		sliderIdx, err := strconv.Atoi(sliderIdxString)
-		if err != nil {
+	for sliderKey, targets := range userMapping {
+		sliderIdx, ok := parseSliderKey(sliderKey, sliderIdxs)
+		if !ok {
 			// Log error or handle gracefully
 			continue
 		}
@@ -38,9 +40,9 @@ func sliderMapFromConfigs(userMapping map[string][]string, internalMapping map[s
 	}
 
 	// Add targets from internal configs, ignoring duplicate or empty values
-	for sliderIdxString, targets := range internalMapping {
-		sliderIdx, err := strconv.Atoi(sliderIdxString)
-		if err != nil {
+	for sliderKey, targets := range internalMapping {
+		sliderIdx, ok := parseSliderKey(sliderKey, sliderIdxs)
+		if !ok {
 			// Log error or handle gracefully
 			continue
 		}
@@ -57,6 +59,16 @@ func sliderMapFromConfigs(userMapping map[string][]string, internalMapping map[s
 	return resultMap
 }
 
+// parseSliderKey turns a slider_mapping key into a slider index, looking names up (case-insensitively) in sliderIdxs
+func parseSliderKey(key string, sliderIdxs map[string]int) (int, bool) {
+	if sliderIdx, err := strconv.Atoi(key); err == nil {
+		return sliderIdx, true
+	}
+
+	sliderIdx, ok := sliderIdxs[strings.ToLower(key)]
+	return sliderIdx, ok
+}
+
 // iterate runs the provided function on each slider in the map.
 func (m *sliderMap) iterate(f func(int, []string)) {
 	m.lock.RLock() // Use RLock for read-only access
@@ -97,4 +109,4 @@ func (m *sliderMap) String() string {
 	}
 
 	return fmt.Sprintf("<%d sliders mapped to %d targets>", sliderCount, targetCount)
-}
\ No newline at end of file
+}
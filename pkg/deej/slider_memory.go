@@ -0,0 +1,92 @@
+package deej
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// sliderMemory remembers where each slider last was, and saves that on shutdown so restore_slider_values
+// can put volumes back the way they were the next time deej starts, even without the board
+type sliderMemory struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock   sync.Mutex
+	values map[int]float32
+}
+
+func newSliderMemory(deej *Deej, logger *zap.SugaredLogger) *sliderMemory {
+	logger = logger.Named("slider_memory")
+
+	sm := &sliderMemory{
+		deej:   deej,
+		logger: logger,
+		values: make(map[int]float32),
+	}
+
+	logger.Debug("Created slider memory instance")
+
+	return sm
+}
+
+// initialize starts keeping track of slider moves
+func (sm *sliderMemory) initialize() {
+	sliderEventsChannel := sm.deej.events.sliderMoved.subscribe()
+
+	sm.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderEventsChannel:
+				sm.lock.Lock()
+				sm.values[event.SliderID] = event.PercentValue
+				sm.lock.Unlock()
+			}
+		}
+	})
+}
+
+// restore moves every slider back to where it was when deej last shut down, if restore_slider_values is on.
+// It runs before the board is connected, whose first line then moves the sliders to where they really are.
+func (sm *sliderMemory) restore() {
+	if !sm.deej.config.RestoreSliders {
+		return
+	}
+
+	values := sm.deej.config.LastSliderValues()
+	if len(values) == 0 {
+		sm.logger.Debug("No saved slider values to restore")
+		return
+	}
+
+	sm.logger.Infow("Restoring saved slider values", "values", values)
+
+	for sliderIdx, value := range values {
+		sm.deej.serial.notifySliderMove(SliderMoveEvent{SliderID: sliderIdx, PercentValue: value})
+	}
+}
+
+// save stores the sliders' last values. Sliders that didn't move this time keep their previously saved value.
+func (sm *sliderMemory) save() {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	if len(sm.values) == 0 {
+		return
+	}
+
+	values := sm.deej.config.LastSliderValues()
+	for sliderIdx, value := range sm.values {
+		values[sliderIdx] = value
+	}
+
+	if err := sm.deej.config.SaveSliderValues(values); err != nil {
+		sm.logger.Warnw("Failed to save slider values", "error", err)
+		return
+	}
+
+	sm.logger.Debugw("Saved slider values", "values", values)
+}
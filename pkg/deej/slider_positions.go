@@ -0,0 +1,63 @@
+package deej
+
+import "sort"
+
+// applySliderPositions sets newly added sessions to the position of the sliders mapped to them, so a game that
+// starts obeys its slider right away instead of playing at full volume until the slider moves. Only positions
+// the slider mapping was applied for count, leaving sliders a script took over alone, and sessions without an ID
+// are skipped like they are for default volumes.
+func (m *sessionMap) applySliderPositions(sessions []Session) {
+	if !m.config.FollowSliders || len(sessions) == 0 {
+		return
+	}
+
+	m.lock.Lock()
+	positions := make(map[int]float32, len(m.sliderPositions))
+	for sliderID, v := range m.sliderPositions {
+		positions[sliderID] = v
+	}
+	m.lock.Unlock()
+
+	// in slider order, so a session on more than one slider goes by the same one every time
+	sliderIDs := make([]int, 0, len(positions))
+	for sliderID := range positions {
+		sliderIDs = append(sliderIDs, sliderID)
+	}
+
+	sort.Ints(sliderIDs)
+
+	mapped := newVolumeBatch()
+	for _, sliderID := range sliderIDs {
+		targets, ok := m.config.SliderMapping.get(sliderID)
+		if !ok {
+			continue
+		}
+
+		v := positions[sliderID]
+
+		for _, target := range targets {
+			if targetA, targetB, ok := m.crossfadeTargets(target); ok {
+				volumeA, volumeB := m.mixVolumes(target, v)
+				m.addTargetToBatch(mapped, targetA, volumeA)
+				m.addTargetToBatch(mapped, targetB, volumeB)
+				continue
+			}
+
+			m.addTargetToBatch(mapped, target, v)
+		}
+	}
+
+	batch := newVolumeBatch()
+	for _, session := range sessions {
+		if session.ID() == "" {
+			continue
+		}
+
+		if v, ok := mapped.sessions[session]; ok {
+			m.logger.Debugw("Setting new session to its slider's position", "session", session, "volume", v)
+			batch.setSession(session, v)
+		}
+	}
+
+	m.applyVolumeBatch(batch)
+}
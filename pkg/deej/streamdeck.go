@@ -0,0 +1,577 @@
+package deej
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// See docs/streamdeck.md for a description of the protocol
+const (
+	streamDeckWebSocketPath = "/streamdeck/ws"
+	streamDeckCommandPath   = "/streamdeck/command"
+
+	// how often subscribed targets are re-checked for changes made outside of deej (e.g. muting in the OS mixer)
+	streamDeckPollInterval = 2 * time.Second
+
+	// how many messages a slow client may fall behind before messages are dropped for it
+	streamDeckClientBufferSize = 32
+
+	streamDeckMaxMessageSize = 4096
+	streamDeckWriteTimeout   = 5 * time.Second
+)
+
+// commands
+const (
+	streamDeckCommandSubscribe    = "subscribe"
+	streamDeckCommandGetState     = "getState"
+	streamDeckCommandSetVolume    = "setVolume"
+	streamDeckCommandAdjustVolume = "adjustVolume"
+	streamDeckCommandSetMute      = "setMute"
+	streamDeckCommandToggleMute   = "toggleMute"
+	streamDeckCommandGetProfiles  = "getProfiles"
+	streamDeckCommandSetProfile   = "setProfile"
+)
+
+// replies and events
+const (
+	streamDeckMessageState    = "state"
+	streamDeckMessageProfiles = "profiles"
+	streamDeckMessageError    = "error"
+)
+
+var (
+	errStreamDeckMissingTarget = errors.New("target is required")
+	errStreamDeckTargetUnknown = errors.New("no sessions match target")
+)
+
+// streamDeckCommand is a single request sent by a Stream Deck plugin
+type streamDeckCommand struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id,omitempty"`
+	Target  string   `json:"target,omitempty"`
+	Targets []string `json:"targets,omitempty"`
+	Volume  *float32 `json:"volume,omitempty"`
+	Delta   *float32 `json:"delta,omitempty"`
+	Mute    *bool    `json:"mute,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+}
+
+// streamDeckState describes a single target, as needed to render a button or dial
+type streamDeckState struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id,omitempty"`
+	Target    string  `json:"target"`
+	Available bool    `json:"available"`
+	Volume    float32 `json:"volume"`
+	Muted     bool    `json:"muted"`
+}
+
+type streamDeckProfiles struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"`
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+type streamDeckError struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// streamDeck implements the server side of the Stream Deck plugin protocol on top of the HTTP server
+type streamDeck struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	upgrader websocket.Upgrader
+
+	lock    sync.Mutex
+	clients map[*streamDeckClient]struct{}
+}
+
+type streamDeckClient struct {
+	conn *websocket.Conn
+	send chan interface{}
+
+	lock      sync.Mutex
+	targets   []string
+	lastState map[string]streamDeckState
+}
+
+func newStreamDeck(deej *Deej, logger *zap.SugaredLogger) *streamDeck {
+	logger = logger.Named("streamdeck")
+
+	sd := &streamDeck{
+		deej:    deej,
+		logger:  logger,
+		clients: make(map[*streamDeckClient]struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkLocalOrigin,
+		},
+	}
+
+	logger.Debug("Created Stream Deck endpoint instance")
+
+	return sd
+}
+
+// initialize registers the endpoints with the HTTP server and subscribes to the events pushed to clients
+func (sd *streamDeck) initialize() {
+	sd.deej.http.handle(streamDeckWebSocketPath, http.HandlerFunc(sd.serveWebSocket))
+	sd.deej.http.handle("POST "+streamDeckCommandPath, http.HandlerFunc(sd.serveCommand))
+	sd.deej.http.onShutdown(sd.disconnectAll)
+	sd.deej.http.describe("streamdeck", func() string { return streamDeckWebSocketPath })
+
+	sd.setupEventRelays()
+}
+
+func (sd *streamDeck) setupEventRelays() {
+	sliderEventsChannel := sd.deej.events.sliderMoved.subscribe()
+	configReloadedChannel := sd.deej.events.configReloaded.subscribe()
+	sessionChangesChannel := sd.deej.events.sessionsChanged.subscribe()
+	volumeChangesChannel := sd.deej.events.volumeChanged.subscribe()
+
+	sd.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(streamDeckPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case event := <-sliderEventsChannel:
+				targets, ok := sd.deej.config.SliderMapping.get(event.SliderID)
+				if !ok {
+					continue
+				}
+
+				// the session map applies this event concurrently, so don't read the volume back from the session
+				for _, target := range targets {
+					state := sd.targetState(target)
+					state.Volume = event.PercentValue
+					state.Available = true
+					sd.broadcastState(state)
+				}
+
+			case <-configReloadedChannel:
+				sd.broadcast(sd.profiles(""))
+				sd.broadcastAllStates()
+
+			case <-sessionChangesChannel:
+				sd.broadcastAllStates()
+
+			case <-volumeChangesChannel:
+				sd.broadcastAllStates()
+
+			case <-ticker.C:
+				sd.broadcastAllStates()
+			}
+		}
+	})
+}
+
+// serveWebSocket upgrades the connection and handles commands until the client disconnects
+func (sd *streamDeck) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := sd.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		sd.logger.Debugw("Failed to upgrade Stream Deck connection", "error", err)
+		return
+	}
+
+	conn.SetReadLimit(streamDeckMaxMessageSize)
+
+	client := &streamDeckClient{
+		conn:      conn,
+		send:      make(chan interface{}, streamDeckClientBufferSize),
+		lastState: make(map[string]streamDeckState),
+	}
+
+	sd.lock.Lock()
+	sd.clients[client] = struct{}{}
+	sd.lock.Unlock()
+
+	sd.logger.Infow("Stream Deck client connected", "remote", r.RemoteAddr)
+
+	util.Go(sd.deej.handlePanic, client.writeLoop)
+
+	defer func() {
+		sd.lock.Lock()
+		delete(sd.clients, client)
+		sd.lock.Unlock()
+
+		close(client.send)
+		conn.Close()
+
+		sd.logger.Infow("Stream Deck client disconnected", "remote", r.RemoteAddr)
+	}()
+
+	for {
+		var command streamDeckCommand
+		if err := conn.ReadJSON(&command); err != nil {
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) {
+				client.enqueue(streamDeckError{Type: streamDeckMessageError, Error: "invalid JSON"})
+				continue
+			}
+
+			return
+		}
+
+		if command.Type == streamDeckCommandSubscribe {
+			sd.subscribe(client, command)
+			continue
+		}
+
+		reply, err := sd.handleCommand(command)
+		if err != nil {
+			reply = streamDeckError{Type: streamDeckMessageError, ID: command.ID, Error: err.Error()}
+		}
+
+		client.enqueue(reply)
+	}
+}
+
+// serveCommand runs a single command over plain HTTP, for plugins that don't need live updates
+func (sd *streamDeck) serveCommand(w http.ResponseWriter, r *http.Request) {
+	// requiring JSON forces browsers into a CORS preflight, which we never approve. Pages that get around it by
+	// pointing their own domain at this computer are turned away by their origin
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" || !checkLocalOrigin(r) {
+		http.Error(w, "expected application/json from a local page", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var command streamDeckCommand
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, streamDeckMaxMessageSize)).Decode(&command); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+
+	reply, err := sd.handleCommand(command)
+	if err != nil {
+		reply = streamDeckError{Type: streamDeckMessageError, ID: command.ID, Error: err.Error()}
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		sd.logger.Debugw("Failed to write Stream Deck reply", "error", err)
+	}
+}
+
+// handleCommand runs any command except subscribe, returning the reply to send to the requesting client
+func (sd *streamDeck) handleCommand(command streamDeckCommand) (interface{}, error) {
+	switch command.Type {
+	case streamDeckCommandGetState:
+		if command.Target == "" {
+			return nil, errStreamDeckMissingTarget
+		}
+
+		return sd.reply(command, sd.targetState(command.Target)), nil
+
+	case streamDeckCommandSetVolume, streamDeckCommandAdjustVolume:
+		return sd.handleVolumeCommand(command)
+
+	case streamDeckCommandSetMute, streamDeckCommandToggleMute:
+		return sd.handleMuteCommand(command)
+
+	case streamDeckCommandGetProfiles:
+		return sd.profiles(command.ID), nil
+
+	case streamDeckCommandSetProfile:
+		if command.Profile == "" {
+			return nil, errors.New("profile is required")
+		}
+
+		sd.logger.Debugw("Switching profile via Stream Deck", "profile", command.Profile)
+
+		// subscribers are notified through the config reload that follows
+		if err := sd.deej.config.ActivateProfile(command.Profile); err != nil {
+			return nil, err
+		}
+
+		return sd.profiles(command.ID), nil
+
+	case streamDeckCommandSubscribe:
+		return nil, errors.New("subscribe is only available over WebSocket")
+	}
+
+	return nil, fmt.Errorf("unknown command: %q", command.Type)
+}
+
+func (sd *streamDeck) handleVolumeCommand(command streamDeckCommand) (interface{}, error) {
+	if command.Target == "" {
+		return nil, errStreamDeckMissingTarget
+	}
+
+	var volume float32
+
+	if command.Type == streamDeckCommandSetVolume {
+		if command.Volume == nil {
+			return nil, errors.New("volume is required")
+		}
+
+		volume = *command.Volume
+	} else {
+		if command.Delta == nil {
+			return nil, errors.New("delta is required")
+		}
+
+		current := sd.targetState(command.Target)
+		if !current.Available {
+			return nil, errStreamDeckTargetUnknown
+		}
+
+		volume = current.Volume + sd.deej.accelerator.accelerate(command.Target, *command.Delta)
+	}
+
+	if volume < 0 {
+		volume = 0
+	} else if volume > 1 {
+		volume = 1
+	}
+
+	sd.logger.Debugw("Setting volume via Stream Deck", "target", command.Target, "volume", volume)
+
+	adjusted, err := sd.deej.sessions.setTargetVolume(command.Target, volume)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(adjusted) == 0 {
+		return nil, errStreamDeckTargetUnknown
+	}
+
+	state := sd.targetState(command.Target)
+	if sd.deej.sessions.isExternalTarget(command.Target) {
+		state.Volume = volume
+		state.Available = true
+	}
+
+	sd.broadcastState(state)
+
+	return sd.reply(command, state), nil
+}
+
+func (sd *streamDeck) handleMuteCommand(command streamDeckCommand) (interface{}, error) {
+	if command.Target == "" {
+		return nil, errStreamDeckMissingTarget
+	}
+
+	var mute bool
+
+	if command.Type == streamDeckCommandSetMute {
+		if command.Mute == nil {
+			return nil, errors.New("mute is required")
+		}
+
+		mute = *command.Mute
+	} else {
+		current := sd.targetState(command.Target)
+		if !current.Available {
+			return nil, errStreamDeckTargetUnknown
+		}
+
+		mute = !current.Muted
+	}
+
+	sd.logger.Debugw("Setting mute via Stream Deck", "target", command.Target, "mute", mute)
+
+	adjusted, err := sd.deej.sessions.setTargetMute(command.Target, mute)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(adjusted) == 0 {
+		return nil, errStreamDeckTargetUnknown
+	}
+
+	state := sd.targetState(command.Target)
+	sd.broadcastState(state)
+
+	return sd.reply(command, state), nil
+}
+
+// subscribe replaces the set of targets a client receives state updates for, and sends their current state
+func (sd *streamDeck) subscribe(client *streamDeckClient, command streamDeckCommand) {
+	client.lock.Lock()
+	client.targets = command.Targets
+	client.lastState = make(map[string]streamDeckState)
+	client.lock.Unlock()
+
+	client.enqueue(sd.profiles(command.ID))
+
+	for _, target := range command.Targets {
+		client.enqueueStateIfChanged(sd.targetState(target))
+	}
+}
+
+func (sd *streamDeck) targetState(target string) streamDeckState {
+	volume, muted, found := sd.deej.sessions.targetState(target)
+
+	return streamDeckState{
+		Type:      streamDeckMessageState,
+		Target:    target,
+		Available: found,
+		Volume:    volume,
+		Muted:     muted,
+	}
+}
+
+func (sd *streamDeck) profiles(id string) streamDeckProfiles {
+	profiles := []string{DefaultProfileName}
+	for name := range sd.deej.config.Profiles {
+		profiles = append(profiles, name)
+	}
+
+	sort.Strings(profiles[1:])
+
+	return streamDeckProfiles{
+		Type:     streamDeckMessageProfiles,
+		ID:       id,
+		Active:   sd.deej.config.ActiveProfile,
+		Profiles: profiles,
+	}
+}
+
+// reply tags a state with the ID of the command it answers
+func (sd *streamDeck) reply(command streamDeckCommand, state streamDeckState) streamDeckState {
+	state.ID = command.ID
+	return state
+}
+
+func (sd *streamDeck) broadcast(message interface{}) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	for client := range sd.clients {
+		client.enqueue(message)
+	}
+}
+
+// broadcastState sends a state to every client subscribed to its target, unless it hasn't changed
+func (sd *streamDeck) broadcastState(state streamDeckState) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	for client := range sd.clients {
+		if target, ok := client.subscribedTarget(state.Target); ok {
+			state.Target = target
+			client.enqueueStateIfChanged(state)
+		}
+	}
+}
+
+// broadcastAllStates re-checks every subscribed target, looking up each target only once.
+// External targets are skipped since their state can't be read back; they're only updated when deej changes them.
+func (sd *streamDeck) broadcastAllStates() {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	states := make(map[string]streamDeckState)
+
+	for client := range sd.clients {
+		client.lock.Lock()
+		targets := client.targets
+		client.lock.Unlock()
+
+		for _, target := range targets {
+			if sd.deej.sessions.isExternalTarget(target) {
+				continue
+			}
+
+			key := strings.ToLower(target)
+
+			state, ok := states[key]
+			if !ok {
+				state = sd.targetState(target)
+				states[key] = state
+			}
+
+			state.Target = target
+			client.enqueueStateIfChanged(state)
+		}
+	}
+}
+
+func (sd *streamDeck) disconnectAll() {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	for client := range sd.clients {
+		client.conn.Close()
+	}
+}
+
+func (c *streamDeckClient) writeLoop() {
+	for message := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(streamDeckWriteTimeout))
+
+		if err := c.conn.WriteJSON(message); err != nil {
+			c.conn.Close()
+
+			// keep draining until the reader notices the closed connection and closes the channel
+			for range c.send {
+			}
+
+			return
+		}
+	}
+}
+
+// enqueue queues a message for sending, dropping it if the client has fallen too far behind
+func (c *streamDeckClient) enqueue(message interface{}) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *streamDeckClient) enqueueStateIfChanged(state streamDeckState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := strings.ToLower(state.Target)
+
+	if last, ok := c.lastState[key]; ok && last == state {
+		return
+	}
+
+	if c.enqueue(state) {
+		c.lastState[key] = state
+	}
+}
+
+// subscribedTarget returns the target as the client spelled it when subscribing, if it did
+func (c *streamDeckClient) subscribedTarget(target string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, subscribed := range c.targets {
+		if strings.EqualFold(subscribed, target) {
+			return subscribed, true
+		}
+	}
+
+	return "", false
+}
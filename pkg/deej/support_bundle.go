@@ -0,0 +1,142 @@
+package deej
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	supportBundleFilename        = "deej-support-%s.zip"
+	supportBundleTimestampFormat = "2006.01.02-15.04.05"
+	supportBundleRedacted        = "<redacted>"
+)
+
+// matches config lines whose value is a secret, such as obs.password or crash_reports.dsn, keeping the key and indentation
+var secretConfigLinePattern = regexp.MustCompile(`(?im)^([ \t]*-?[ \t]*[\w.-]*(?:password|secret|token|dsn)[\w.-]*[ \t]*:)[ \t]*\S[^\r\n]*`)
+
+// exportSupportBundle zips up what's usually needed to look into a bug report: the latest log and crashlog,
+// the config with secrets redacted, and the current sessions and mappings. The bundle is saved to the desktop
+// if there is one, or to the logs folder otherwise, and its path is returned.
+func (d *Deej) exportSupportBundle() (string, error) {
+	var contents bytes.Buffer
+	archive := zip.NewWriter(&contents)
+
+	add := func(name string, data []byte) error {
+		w, err := archive.Create(name)
+		if err != nil {
+			return fmt.Errorf("add %s to support bundle: %w", name, err)
+		}
+
+		_, err = w.Write(data)
+		return err
+	}
+
+	version := d.version
+	if version == "" {
+		version = "unknown"
+	}
+
+	info := fmt.Sprintf("Version: %s\nOS: %s/%s (%s), audio backend: %s\nSerial connected: %t\n\n%s\n",
+		version, runtime.GOOS, runtime.GOARCH, runtime.Version(), audioBackendName,
+		d.serial.Connected(), d.crashConfigSummary())
+
+	if err := add("info.txt", []byte(info)); err != nil {
+		return "", err
+	}
+
+	var sessions bytes.Buffer
+	for _, session := range d.sessions.snapshot() {
+		fmt.Fprintln(&sessions, session)
+	}
+
+	fmt.Fprintln(&sessions)
+	if err := WriteMappingReport(&sessions, mappingsToProto(d.sessions.describeMappings())); err != nil {
+		return "", fmt.Errorf("format mapping report: %w", err)
+	}
+
+	if err := add("sessions.txt", sessions.Bytes()); err != nil {
+		return "", err
+	}
+
+	files := map[string]func() ([]byte, error){
+		userConfigFilepath: func() ([]byte, error) {
+			config, err := os.ReadFile(userConfigFilepath)
+			return redactConfig(config), err
+		},
+		LogFilename: func() ([]byte, error) {
+			return os.ReadFile(filepath.Join(LogDirectory, LogFilename))
+		},
+		"latest-crash.log": func() ([]byte, error) {
+			crashlogPath, err := latestCrashlog()
+			if err != nil {
+				return nil, err
+			}
+
+			return os.ReadFile(crashlogPath)
+		},
+	}
+
+	for name, read := range files {
+		data, err := read()
+		if errors.Is(err, fs.ErrNotExist) {
+			// dev builds don't log to a file, and hopefully there was no crash
+			continue
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("read %s: %w", name, err)
+		}
+
+		if err := add(name, data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", fmt.Errorf("finish support bundle: %w", err)
+	}
+
+	directory := supportBundleDirectory()
+	if err := util.EnsureDirExists(directory); err != nil {
+		return "", err
+	}
+
+	bundlePath := filepath.Join(directory, fmt.Sprintf(supportBundleFilename, time.Now().Format(supportBundleTimestampFormat)))
+	if err := os.WriteFile(bundlePath, contents.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write support bundle: %w", err)
+	}
+
+	d.logger.Infow("Exported support bundle", "path", bundlePath)
+
+	return bundlePath, nil
+}
+
+// supportBundleDirectory returns the user's desktop, where the bundle is easy to find and attach, or the logs folder
+func supportBundleDirectory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return LogDirectory
+	}
+
+	desktop := filepath.Join(home, "Desktop")
+	if stat, err := os.Stat(desktop); err != nil || !stat.IsDir() {
+		return LogDirectory
+	}
+
+	return desktop
+}
+
+// redactConfig blanks out passwords, tokens and the like, leaving the rest of the config (including comments) as is
+func redactConfig(config []byte) []byte {
+	return secretConfigLinePattern.ReplaceAll(config, []byte("$1 "+supportBundleRedacted))
+}
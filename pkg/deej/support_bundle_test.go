@@ -0,0 +1,40 @@
+package deej
+
+import "testing"
+
+func TestRedactConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name:   "nested password",
+			config: "obs:\n  enabled: true\n  password: hunter2\n",
+			want:   "obs:\n  enabled: true\n  password: <redacted>\n",
+		},
+		{
+			name:   "dsn with windows line endings",
+			config: "crash_reports:\r\n  dsn: https://abc@example.com/1\r\n  upload: true\r\n",
+			want:   "crash_reports:\r\n  dsn: <redacted>\r\n  upload: true\r\n",
+		},
+		{
+			name:   "empty values are kept",
+			config: "obs:\n  password:\n  api_token: \"\"\n",
+			want:   "obs:\n  password:\n  api_token: <redacted>\n",
+		},
+		{
+			name:   "everything else is untouched",
+			config: "slider_mapping:\n  0: master # password: not really\ncom_port: COM4\n",
+			want:   "slider_mapping:\n  0: master # password: not really\ncom_port: COM4\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(redactConfig([]byte(test.config))); got != test.want {
+				t.Errorf("redactConfig() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
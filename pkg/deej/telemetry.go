@@ -0,0 +1,243 @@
+package deej
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// one file per day, so they're easy to pick from and old ones can be cleaned up
+	telemetryFilename   = "deej-telemetry-%s.csv"
+	telemetryDateFormat = "2006-01-02"
+	telemetryTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+	// rows are buffered and written out this often, rather than touching the disk on every slider move
+	telemetryFlushInterval = 2 * time.Second
+)
+
+// the kinds of rows in a telemetry file
+const (
+	telemetrySliderMoved    = "slider"
+	telemetryVolumeChanged  = "volume"
+	telemetrySessionAdded   = "session_added"
+	telemetrySessionRemoved = "session_removed"
+	telemetryConnected      = "connected"
+	telemetryDisconnected   = "disconnected"
+)
+
+var telemetryHeader = []string{"time", "event", "slider", "targets", "value"}
+
+// telemetryRecorder writes slider moves, volume changes made outside deej and sessions coming and going to CSV files
+// in the logs folder while telemetry is enabled, for analyzing mixing habits or tracking down drift over long sessions
+type telemetryRecorder struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	// only touched by the recorder's goroutine
+	file   *os.File
+	writer *csv.Writer
+	date   string // of the open file
+	failed bool   // set once writing fails, so the warning isn't repeated until the config is reloaded
+}
+
+func newTelemetryRecorder(deej *Deej, logger *zap.SugaredLogger) *telemetryRecorder {
+	logger = logger.Named("telemetry")
+
+	rec := &telemetryRecorder{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created telemetry recorder instance")
+
+	return rec
+}
+
+// start records events while telemetry is enabled, picking up config changes as they happen, until deej shuts down
+func (rec *telemetryRecorder) start() {
+	sliderEventsChannel := rec.deej.events.sliderMoved.subscribe()
+	volumeChangesChannel := rec.deej.events.volumeChanged.subscribe()
+	sessionChangesChannel := rec.deej.events.sessionsChanged.subscribe()
+	connectionChangesChannel := rec.deej.events.connectionChanged.subscribe()
+	configReloadedChannel := rec.deej.events.configReloaded.subscribe()
+
+	rec.deej.spawn(func(ctx context.Context) error {
+		ticker := time.NewTicker(telemetryFlushInterval)
+		defer ticker.Stop()
+		defer rec.close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case event := <-sliderEventsChannel:
+				targets, _ := rec.deej.config.SliderMapping.get(event.SliderID)
+				rec.record(telemetrySliderMoved, strconv.Itoa(event.SliderID), strings.Join(targets, ";"), formatTelemetryValue(event.PercentValue))
+
+			case change := <-volumeChangesChannel:
+				rec.record(telemetryVolumeChanged, "", change.Key, formatTelemetryValue(change.Volume))
+
+			case event := <-sessionChangesChannel:
+				for _, key := range event.Added {
+					rec.record(telemetrySessionAdded, "", key, "")
+				}
+
+				for _, key := range event.Removed {
+					rec.record(telemetrySessionRemoved, "", key, "")
+				}
+
+			case connected := <-connectionChangesChannel:
+				if connected {
+					rec.record(telemetryConnected, "", "", "")
+				} else {
+					rec.record(telemetryDisconnected, "", "", "")
+				}
+
+			case <-configReloadedChannel:
+				rec.failed = false
+
+				if !rec.deej.config.Telemetry.Enabled {
+					rec.close()
+				}
+
+			case <-ticker.C:
+				rec.flush()
+			}
+		}
+	})
+}
+
+// record adds a row, if telemetry is enabled
+func (rec *telemetryRecorder) record(event string, slider string, targets string, value string) {
+	if !rec.deej.config.Telemetry.Enabled || rec.failed {
+		return
+	}
+
+	now := time.Now()
+	if err := rec.open(now); err != nil {
+		rec.fail("Failed to open telemetry file, not recording", err)
+		return
+	}
+
+	if err := rec.writer.Write([]string{now.Format(telemetryTimeFormat), event, slider, targets, value}); err != nil {
+		rec.fail("Failed to write telemetry, not recording", err)
+	}
+}
+
+// open makes sure the file for the given day is open, starting a new one (and cleaning up old ones) once the day
+// changes. Recordings from earlier in the day are added to rather than replaced.
+func (rec *telemetryRecorder) open(now time.Time) error {
+	date := now.Format(telemetryDateFormat)
+	if rec.file != nil && rec.date == date {
+		return nil
+	}
+
+	rec.close()
+
+	if err := util.EnsureDirExists(LogDirectory); err != nil {
+		return err
+	}
+
+	telemetryPath := filepath.Join(LogDirectory, fmt.Sprintf(telemetryFilename, date))
+
+	file, err := os.OpenFile(telemetryPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open telemetry file: %w", err)
+	}
+
+	rec.file = file
+	rec.writer = csv.NewWriter(file)
+	rec.date = date
+
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		if err := rec.writer.Write(telemetryHeader); err != nil {
+			return fmt.Errorf("write telemetry header: %w", err)
+		}
+	}
+
+	rec.logger.Infow("Recording telemetry", "path", telemetryPath)
+	rec.removeOldFiles(now)
+
+	return nil
+}
+
+// removeOldFiles deletes the files of days past telemetry.keep_days
+func (rec *telemetryRecorder) removeOldFiles(now time.Time) {
+	keepDays := rec.deej.config.Telemetry.KeepDays
+	if keepDays == 0 {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(LogDirectory, fmt.Sprintf(telemetryFilename, "*")))
+	if err != nil {
+		return
+	}
+
+	cutoff := now.AddDate(0, 0, -keepDays).Format(telemetryDateFormat)
+	prefix, suffix, _ := strings.Cut(telemetryFilename, "%s")
+
+	for _, path := range paths {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), suffix)
+
+		// dates in this format sort the same as text
+		if date >= cutoff {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			rec.logger.Warnw("Failed to remove old telemetry file", "path", path, "error", err)
+			continue
+		}
+
+		rec.logger.Debugw("Removed old telemetry file", "path", path)
+	}
+}
+
+func (rec *telemetryRecorder) flush() {
+	if rec.writer == nil {
+		return
+	}
+
+	rec.writer.Flush()
+	if err := rec.writer.Error(); err != nil {
+		rec.fail("Failed to write telemetry, not recording", err)
+	}
+}
+
+func (rec *telemetryRecorder) close() {
+	if rec.file == nil {
+		return
+	}
+
+	rec.writer.Flush()
+	if err := rec.file.Close(); err != nil {
+		rec.logger.Warnw("Failed to close telemetry file", "error", err)
+	}
+
+	rec.file = nil
+	rec.writer = nil
+	rec.date = ""
+}
+
+// fail stops recording until the config is reloaded, so a full disk doesn't fill the log with warnings too
+func (rec *telemetryRecorder) fail(message string, err error) {
+	rec.logger.Warnw(message, "error", err)
+	rec.failed = true
+	rec.close()
+}
+
+// formatTelemetryValue writes a slider value or volume with enough precision for high_resolution_volume
+func formatTelemetryValue(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 4, 32)
+}
@@ -0,0 +1,116 @@
+package deej
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	portalDestination      = "org.freedesktop.portal.Desktop"
+	portalPath             = "/org/freedesktop/portal/desktop"
+	portalSettings         = "org.freedesktop.portal.Settings"
+	portalSettingChanged   = "SettingChanged"
+	appearanceNamespace    = "org.freedesktop.appearance"
+	appearanceColorScheme  = "color-scheme"
+	colorSchemePreferDark  = 1
+	colorSchemePreferLight = 2
+)
+
+// portalThemeListener follows the desktop's color-scheme setting through the XDG desktop portal,
+// which GNOME, KDE and most other desktops provide
+type portalThemeListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	conn *dbus.Conn
+	done chan struct{}
+}
+
+func newThemeListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) themeListener {
+	return &portalThemeListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *portalThemeListener) listen(onChange func(osTheme)) (osTheme, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return osThemeUnknown, fmt.Errorf("connect to session bus: %w", err)
+	}
+
+	var value dbus.Variant
+	if err := conn.Object(portalDestination, portalPath).
+		Call(portalSettings+".Read", 0, appearanceNamespace, appearanceColorScheme).
+		Store(&value); err != nil {
+		conn.Close()
+		return osThemeUnknown, fmt.Errorf("read %s: %w", appearanceColorScheme, err)
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(portalPath),
+		dbus.WithMatchInterface(portalSettings),
+		dbus.WithMatchMember(portalSettingChanged),
+		dbus.WithMatchArg(0, appearanceNamespace),
+	); err != nil {
+		conn.Close()
+		return osThemeUnknown, fmt.Errorf("subscribe to %s: %w", portalSettingChanged, err)
+	}
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+
+	l.conn = conn
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+
+		// closing the connection closes the channel
+		for signal := range signals {
+			if signal.Name != portalSettings+"."+portalSettingChanged || len(signal.Body) != 3 {
+				continue
+			}
+
+			if key, _ := signal.Body[1].(string); key != appearanceColorScheme {
+				continue
+			}
+
+			value, ok := signal.Body[2].(dbus.Variant)
+			if !ok {
+				continue
+			}
+
+			onChange(colorSchemeTheme(value))
+		}
+	})
+
+	return colorSchemeTheme(value), nil
+}
+
+func (l *portalThemeListener) stop() {
+	if err := l.conn.Close(); err != nil {
+		l.logger.Debugw("Failed to close session bus connection", "error", err)
+	}
+
+	<-l.done
+}
+
+// colorSchemeTheme interprets the portal's color-scheme value. Read wraps it in an extra variant, which is unwrapped
+func colorSchemeTheme(value dbus.Variant) osTheme {
+	if inner, ok := value.Value().(dbus.Variant); ok {
+		value = inner
+	}
+
+	scheme, _ := value.Value().(uint32)
+
+	switch scheme {
+	case colorSchemePreferDark:
+		return osThemeDark
+	case colorSchemePreferLight:
+		return osThemeLight
+	}
+
+	return osThemeUnknown
+}
@@ -0,0 +1,132 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	personalizeRegistryKey = `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
+
+	// the taskbar follows the system theme, while AppsUseLightTheme only applies to app windows
+	systemLightThemeValue = "SystemUsesLightTheme"
+)
+
+// registryThemeListener watches the personalization registry key Windows updates when the theme changes
+type registryThemeListener struct {
+	logger  *zap.SugaredLogger
+	onPanic func(recoverValue interface{})
+
+	key     registry.Key
+	stopped windows.Handle // signaled to end the watch loop
+	done    chan struct{}
+}
+
+func newThemeListener(logger *zap.SugaredLogger, onPanic func(recoverValue interface{})) themeListener {
+	return &registryThemeListener{logger: logger, onPanic: onPanic}
+}
+
+func (l *registryThemeListener) listen(onChange func(osTheme)) (osTheme, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, personalizeRegistryKey, registry.QUERY_VALUE|registry.NOTIFY)
+	if err != nil {
+		return osThemeUnknown, fmt.Errorf("open personalization registry key: %w", err)
+	}
+
+	theme, err := readRegistryTheme(key)
+	if err != nil {
+		key.Close()
+		return osThemeUnknown, err
+	}
+
+	stopped, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		key.Close()
+		return osThemeUnknown, fmt.Errorf("create stop event: %w", err)
+	}
+
+	l.key = key
+	l.stopped = stopped
+	l.done = make(chan struct{})
+
+	util.Go(l.onPanic, func() {
+		defer close(l.done)
+
+		// Windows drops the notification if the thread that asked for it exits
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		l.watch(theme, onChange)
+	})
+
+	return theme, nil
+}
+
+// watch waits for changes to the registry key until stopped is signaled, reporting the theme when it changes
+func (l *registryThemeListener) watch(theme osTheme, onChange func(osTheme)) {
+	changed, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		l.logger.Warnw("Failed to create registry change event, not following the theme", "error", err)
+		return
+	}
+	defer windows.CloseHandle(changed)
+
+	for {
+		if err := windows.RegNotifyChangeKeyValue(windows.Handle(l.key), false,
+			windows.REG_NOTIFY_CHANGE_LAST_SET, changed, true); err != nil {
+			l.logger.Warnw("Failed to watch personalization registry key, not following the theme", "error", err)
+			return
+		}
+
+		event, err := windows.WaitForMultipleObjects([]windows.Handle{changed, l.stopped}, false, windows.INFINITE)
+		if err != nil || event != windows.WAIT_OBJECT_0 {
+			return
+		}
+
+		current, err := readRegistryTheme(l.key)
+		if err != nil {
+			l.logger.Debugw("Failed to read theme after registry change", "error", err)
+			continue
+		}
+
+		if current != theme {
+			theme = current
+			onChange(theme)
+		}
+	}
+}
+
+func (l *registryThemeListener) stop() {
+	if err := windows.SetEvent(l.stopped); err != nil {
+		l.logger.Debugw("Failed to signal theme watch to stop", "error", err)
+	}
+
+	<-l.done
+
+	windows.CloseHandle(l.stopped)
+	l.key.Close()
+}
+
+func readRegistryTheme(key registry.Key) (osTheme, error) {
+	light, _, err := key.GetIntegerValue(systemLightThemeValue)
+	if errors.Is(err, registry.ErrNotExist) {
+		// versions before Windows 10 1903 only have a dark taskbar
+		return osThemeDark, nil
+	}
+
+	if err != nil {
+		return osThemeUnknown, fmt.Errorf("read %s: %w", systemLightThemeValue, err)
+	}
+
+	if light != 0 {
+		return osThemeLight, nil
+	}
+
+	return osThemeDark, nil
+}
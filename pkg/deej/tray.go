@@ -1,18 +1,64 @@
 package deej
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
 	"github.com/getlantern/systray"
 	"github.com/omriharel/deej/pkg/deej/icon"
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
+// IDs of the tray menu's text in the message catalogs, see i18n.go
 const (
-	editConfigTitle       = "Edit configuration"
-	editConfigTooltip     = "Open config file with notepad"
-	refreshSessionsTitle  = "Re-scan audio sessions"
-	refreshSessionsTooltip = "Manually refresh audio sessions if something's stuck"
-	quitTitle             = "Quit"
-	quitTooltip           = "Stop deej and quit"
+	editConfigTitle         = "tray.editConfig"
+	editConfigTooltip       = "tray.editConfigTooltip"
+	openConfigFolderTitle   = "tray.openConfigFolder"
+	openConfigFolderTooltip = "tray.openConfigFolderTooltip"
+	refreshSessionsTitle    = "tray.refreshSessions"
+	refreshSessionsTooltip  = "tray.refreshSessionsTooltip"
+	showMappingsTitle       = "tray.showMappings"
+	showMappingsTooltip     = "tray.showMappingsTooltip"
+	showUnmappedTitle       = "tray.showUnmapped"
+	showUnmappedTooltip     = "tray.showUnmappedTooltip"
+	quickBindTitle          = "tray.quickBind"
+	quickBindAppTitle       = "tray.quickBindApp"
+	quickBindTooltip        = "tray.quickBindTooltip"
+	presetsTitle            = "tray.presets"
+	presetsTooltip          = "tray.presetsTooltip"
+	savePresetTitle         = "tray.savePreset"
+	savePresetTooltip       = "tray.savePresetTooltip"
+	mixerTitle              = "tray.mixer"
+	mixerTooltip            = "tray.mixerTooltip"
+	openMixerTitle          = "tray.openMixer"
+	openMixerTooltip        = "tray.openMixerTooltip"
+	soundSettingsTitle      = "tray.soundSettings"
+	soundSettingsTooltip    = "tray.soundSettingsTooltip"
+	mixerAppTooltip         = "tray.mixerAppTooltip"
+	fadeOutTitle            = "tray.fadeOut"
+	fadeInTitle             = "tray.fadeIn"
+	fadeOutTooltip          = "tray.fadeOutTooltip"
+	restartElevatedTitle    = "tray.restartElevated"
+	restartElevatedTooltip  = "tray.restartElevatedTooltip"
+	openWebUITitle          = "tray.openWebUI"
+	openWebUITooltip        = "tray.openWebUITooltip"
+	autostartTooltip        = "tray.autostartTooltip"
+	openLogsTitle           = "tray.openLogs"
+	openLogsTooltip         = "tray.openLogsTooltip"
+	exportSettingsTitle     = "tray.exportSettings"
+	exportSettingsTooltip   = "tray.exportSettingsTooltip"
+	importSettingsTitle     = "tray.importSettings"
+	importSettingsTooltip   = "tray.importSettingsTooltip"
+	exportBundleTitle       = "tray.exportBundle"
+	exportBundleTooltip     = "tray.exportBundleTooltip"
+	exportCaptureTitle      = "tray.exportCapture"
+	exportCaptureTooltip    = "tray.exportCaptureTooltip"
+	sendCrashReportTitle    = "tray.sendCrashReport"
+	sendCrashReportTooltip  = "tray.sendCrashReportTooltip"
+	quitTitle               = "tray.quit"
+	quitTooltip             = "tray.quitTooltip"
 )
 
 func (d *Deej) initializeTray(onDone func()) {
@@ -20,20 +66,80 @@ func (d *Deej) initializeTray(onDone func()) {
 
 	// Define the onReady callback to handle systray actions
 	onReady := func() {
+		// systray calls this on a goroutine of its own
+		defer util.Recover(d.handlePanic)
+
 		logger.Debug("Tray instance ready")
 
 		// Set tray icon, title, and tooltip
-		systray.SetTemplateIcon(icon.DeejLogo, icon.DeejLogo)
+		d.trayIcon.start()
 		systray.SetTitle("deej")
 		systray.SetTooltip("deej")
 
 		// Create menu items
-		editConfig := systray.AddMenuItem(editConfigTitle, editConfigTooltip)
+		editConfig := systray.AddMenuItem(tr(editConfigTitle), tr(editConfigTooltip))
 		editConfig.SetIcon(icon.EditConfig)
 
-		refreshSessions := systray.AddMenuItem(refreshSessionsTitle, refreshSessionsTooltip)
+		openConfigFolder := systray.AddMenuItem(tr(openConfigFolderTitle), tr(openConfigFolderTooltip))
+
+		refreshSessions := systray.AddMenuItem(tr(refreshSessionsTitle), tr(refreshSessionsTooltip))
 		refreshSessions.SetIcon(icon.RefreshSessions)
 
+		showMappings := systray.AddMenuItem(tr(showMappingsTitle), tr(showMappingsTooltip))
+		showUnmapped := systray.AddMenuItem(tr(showUnmappedTitle), tr(showUnmappedTooltip))
+
+		quickBind := systray.AddMenuItem(tr(quickBindTitle), tr(quickBindTooltip))
+		quickBind.Disable()
+
+		d.quickBind.attach(func(key string) {
+			if key == "" {
+				quickBind.SetTitle(tr(quickBindTitle))
+				quickBind.Disable()
+				return
+			}
+
+			quickBind.SetTitle(tr(quickBindAppTitle, "app", key))
+			quickBind.Enable()
+		})
+
+		newPresetMenu(d, logger).start()
+		newMixerMenu(d, logger).start()
+
+		fadeOut := systray.AddMenuItem(tr(fadeOutTitle), tr(fadeOutTooltip))
+
+		d.fader.attach(func(fadedOut bool) {
+			if fadedOut {
+				fadeOut.SetTitle(tr(fadeInTitle))
+			} else {
+				fadeOut.SetTitle(tr(fadeOutTitle))
+			}
+		})
+
+		// only shown once an app deej can't control for running as administrator shows up
+		restartElevated := systray.AddMenuItem(tr(restartElevatedTitle), tr(restartElevatedTooltip))
+		restartElevated.Hide()
+
+		if canRestartElevated {
+			d.elevation.attach(restartElevated.Show)
+		}
+
+		openWebUI := systray.AddMenuItem(tr(openWebUITitle), tr(openWebUITooltip))
+
+		startsOnLogin, err := autostartEnabled()
+		if err != nil {
+			logger.Warnw("Failed to check autostart state", "error", err)
+		}
+
+		autostart := systray.AddMenuItemCheckbox(getAutostartTitle(), tr(autostartTooltip), startsOnLogin)
+
+		exportSettings := systray.AddMenuItem(tr(exportSettingsTitle), tr(exportSettingsTooltip))
+		importSettings := systray.AddMenuItem(tr(importSettingsTitle), tr(importSettingsTooltip))
+
+		openLogs := systray.AddMenuItem(tr(openLogsTitle), tr(openLogsTooltip))
+		exportBundle := systray.AddMenuItem(tr(exportBundleTitle), tr(exportBundleTooltip))
+		exportCapture := systray.AddMenuItem(tr(exportCaptureTitle), tr(exportCaptureTooltip))
+		sendCrashReport := systray.AddMenuItem(tr(sendCrashReportTitle), tr(sendCrashReportTooltip))
+
 		if d.version != "" {
 			systray.AddSeparator()
 			versionInfo := systray.AddMenuItem(d.version, "")
@@ -41,10 +147,13 @@ func (d *Deej) initializeTray(onDone func()) {
 		}
 
 		systray.AddSeparator()
-		quit := systray.AddMenuItem(quitTitle, quitTooltip)
+		quit := systray.AddMenuItem(tr(quitTitle), tr(quitTooltip))
 
 		// Wait for actions in a separate goroutine
-		go d.handleTrayActions(logger, editConfig, refreshSessions, quit)
+		d.spawn(func(ctx context.Context) error {
+			d.handleTrayActions(ctx, logger, editConfig, openConfigFolder, refreshSessions, showMappings, showUnmapped, quickBind, fadeOut, restartElevated, openWebUI, autostart, exportSettings, importSettings, openLogs, exportBundle, exportCapture, sendCrashReport, quit)
+			return nil
+		})
 
 		// Notify that tray setup is complete
 		onDone()
@@ -60,9 +169,12 @@ func (d *Deej) initializeTray(onDone func()) {
 	systray.Run(onReady, onExit)
 }
 
-func (d *Deej) handleTrayActions(logger *zap.SugaredLogger, editConfig, refreshSessions, quit *systray.MenuItem) {
+func (d *Deej) handleTrayActions(ctx context.Context, logger *zap.SugaredLogger, editConfig, openConfigFolder, refreshSessions, showMappings, showUnmapped, quickBind, fadeOut, restartElevated, openWebUI, autostart, exportSettings, importSettings, openLogs, exportBundle, exportCapture, sendCrashReport, quit *systray.MenuItem) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
 		// Quit the application
 		case <-quit.ClickedCh:
 			logger.Info("Quit menu item clicked, stopping")
@@ -71,30 +183,251 @@ func (d *Deej) handleTrayActions(logger *zap.SugaredLogger, editConfig, refreshS
 		// Open the configuration file for editing
 		case <-editConfig.ClickedCh:
 			logger.Info("Edit config menu item clicked, opening config for editing")
-			editor := getEditor()
+			editor := getEditor(d.config.Editor)
 
 			if err := util.OpenExternal(logger, editor, userConfigFilepath); err != nil {
 				logger.Warnw("Failed to open config file for editing", "error", err)
+				d.notifier.Notify(tr("notify.editorFailed"), tr("notify.editorFailedMessage"))
+			}
+
+		// Open the folder holding the config, logs and so on
+		case <-openConfigFolder.ClickedCh:
+			logger.Info("Open config folder menu item clicked, opening file manager")
+
+			folder, err := filepath.Abs(userConfigPath)
+			if err != nil {
+				logger.Warnw("Failed to resolve config folder", "error", err)
+				continue
+			}
+
+			if err := util.OpenExternal(logger, getFileManager(), folder); err != nil {
+				logger.Warnw("Failed to open config folder", "error", err)
 			}
 
 		// Refresh the audio sessions
 		case <-refreshSessions.ClickedCh:
 			logger.Info("Refresh sessions menu item clicked, triggering session map refresh")
 			d.sessions.refreshSessions(true)
+
+		// List the apps no slider controls, which deej.unmapped catches
+		case <-showUnmapped.ClickedCh:
+			logger.Info("Show unmapped apps menu item clicked, listing unmapped apps")
+			d.unmapped.show()
+
+		// Show which sessions each slider controls
+		case <-showMappings.ClickedCh:
+			logger.Info("Show mappings menu item clicked, opening mapping report")
+
+			reportPath, err := d.sessions.exportMappingReport()
+			if err != nil {
+				logger.Warnw("Failed to export mapping report", "error", err)
+				d.notifier.Notify(tr("notify.mappingsFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			if err := util.OpenExternal(logger, getEditor(d.config.Editor), reportPath); err != nil {
+				logger.Warnw("Failed to open mapping report", "error", err)
+			}
+
+		// Bind the most recent unmapped app to the next slider moved
+		case <-quickBind.ClickedCh:
+			logger.Info("Quick bind menu item clicked, entering bind mode")
+			d.quickBind.begin()
+
+		// Fade every app out, or back in
+		case <-fadeOut.ClickedCh:
+			logger.Info("Fade out menu item clicked, fading")
+			d.fader.trigger()
+
+		// Start over as administrator, to control apps running as administrator
+		case <-restartElevated.ClickedCh:
+			logger.Info("Restart as administrator menu item clicked, restarting")
+			d.elevation.restart()
+
+		// Open the web UI in the default browser
+		case <-openWebUI.ClickedCh:
+			logger.Info("Open web UI menu item clicked, opening browser")
+
+			url, ok := d.webUI.url()
+			if !ok {
+				d.notifier.Notify(tr("notify.webUIUnavailable"), tr("notify.webUIUnavailableMessage"))
+				continue
+			}
+
+			if err := util.OpenExternal(logger, getBrowser(), url); err != nil {
+				logger.Warnw("Failed to open web UI", "error", err)
+			}
+
+		// Toggle starting deej on login
+		case <-autostart.ClickedCh:
+			enable := !autostart.Checked()
+			logger.Infow("Autostart menu item clicked, toggling autostart", "enable", enable)
+
+			if err := setAutostart(enable); err != nil {
+				logger.Warnw("Failed to toggle autostart", "error", err)
+				d.notifier.Notify(tr("notify.autostartFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			if enable {
+				autostart.Check()
+			} else {
+				autostart.Uncheck()
+			}
+
+		// Open the folder holding the logs
+		case <-openLogs.ClickedCh:
+			logger.Info("Open logs menu item clicked, opening file manager")
+
+			if err := util.EnsureDirExists(LogDirectory); err != nil {
+				logger.Warnw("Failed to create logs folder", "error", err)
+				continue
+			}
+
+			folder, err := filepath.Abs(LogDirectory)
+			if err != nil {
+				logger.Warnw("Failed to resolve logs folder", "error", err)
+				continue
+			}
+
+			if err := util.OpenExternal(logger, getFileManager(), folder); err != nil {
+				logger.Warnw("Failed to open logs folder", "error", err)
+			}
+
+		// Save the config and preferences to one file, for moving to another computer
+		case <-exportSettings.ClickedCh:
+			logger.Info("Export settings menu item clicked, exporting")
+
+			backupPath, err := d.exportSettings()
+			if err != nil {
+				logger.Warnw("Failed to export settings", "error", err)
+				d.notifier.Notify(tr("notify.settingsExportFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			d.notifier.Notify(tr("notify.settingsExported"), tr("notify.savedTo", "path", backupPath))
+
+		// Restore the config and preferences from the newest exported settings
+		case <-importSettings.ClickedCh:
+			logger.Info("Import settings menu item clicked, importing")
+
+			backupPath, previousPath, err := d.importSettings()
+			if errors.Is(err, errNoSettingsBackup) {
+				d.notifier.Notify(tr("notify.noSettingsBackup"), tr("notify.noSettingsBackupMessage", "path", supportBundleDirectory()))
+				continue
+			}
+
+			if err != nil {
+				logger.Warnw("Failed to import settings", "error", err)
+				d.notifier.Notify(tr("notify.settingsImportFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			d.notifier.Notify(tr("notify.settingsImported", "file", filepath.Base(backupPath)),
+				tr("notify.settingsImportedMessage", "path", previousPath))
+
+		// Gather everything needed for a bug report into one file
+		case <-exportBundle.ClickedCh:
+			logger.Info("Export support bundle menu item clicked, exporting")
+
+			bundlePath, err := d.exportSupportBundle()
+			if err != nil {
+				logger.Warnw("Failed to export support bundle", "error", err)
+				d.notifier.Notify(tr("notify.bundleFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			d.notifier.Notify(tr("notify.bundleExported"), tr("notify.savedTo", "path", bundlePath))
+
+		// Save the recent serial traffic for troubleshooting
+		case <-exportCapture.ClickedCh:
+			logger.Info("Export serial capture menu item clicked, exporting")
+
+			if !d.config.SerialCapture.Enabled {
+				d.notifier.Notify(tr("notify.captureOff"), tr("notify.captureOffMessage"))
+				continue
+			}
+
+			capturePath, err := d.serial.ExportCapture()
+			if err != nil {
+				logger.Warnw("Failed to export serial capture", "error", err)
+				d.notifier.Notify(tr("notify.captureFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			d.notifier.Notify(tr("notify.captureExported"), tr("notify.savedTo", "path", capturePath))
+
+		// Upload the most recent crashlog
+		case <-sendCrashReport.ClickedCh:
+			logger.Info("Send crash report menu item clicked, uploading latest crashlog")
+
+			if d.config.CrashReports.DSN == "" {
+				d.notifier.Notify(tr("notify.crashReportsOff"), tr("notify.crashReportsOffMessage"))
+				continue
+			}
+
+			crashlogPath, err := d.sendLatestCrashlog()
+			if errors.Is(err, os.ErrNotExist) {
+				d.notifier.Notify(tr("notify.noCrashReports"), tr("notify.noCrashReportsMessage"))
+				continue
+			}
+
+			if err != nil {
+				logger.Warnw("Failed to send crash report", "error", err)
+				d.notifier.Notify(tr("notify.crashReportFailed"), tr("notify.moreDetails"))
+				continue
+			}
+
+			d.notifier.Notify(tr("notify.crashReportSent"), tr("notify.crashReportSentMessage", "file", filepath.Base(crashlogPath)))
 		}
 	}
 }
 
-func getEditor() string {
-	// Determine the appropriate editor based on the operating system
+// getEditor picks the program to open text files with: the one set in the config,
+// then the user's preferred editor, then whatever the desktop associates with the file
+func getEditor(configured string) string {
+	if configured != "" {
+		return configured
+	}
+
+	for _, variable := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(variable); editor != "" {
+			return editor
+		}
+	}
+
 	if util.Linux() {
-		return "gedit"
+		return "xdg-open"
 	}
-	// Default to notepad.exe for Windows and other OS
+
+	// .yaml files usually aren't associated with anything on Windows, so start would only ask what to open them with
 	return "notepad.exe"
 }
 
+func getAutostartTitle() string {
+	if util.Linux() {
+		return tr("tray.autostartLinux")
+	}
+	return tr("tray.autostartWindows")
+}
+
+func getFileManager() string {
+	// Hand the folder to the desktop's file manager
+	if util.Linux() {
+		return "xdg-open"
+	}
+	return "explorer.exe"
+}
+
+func getBrowser() string {
+	// Hand the URL to the desktop's default browser
+	if util.Linux() {
+		return "xdg-open"
+	}
+	return "explorer.exe"
+}
+
 func (d *Deej) stopTray() {
 	d.logger.Debug("Quitting tray")
 	systray.Quit()
-}
\ No newline at end of file
+}
@@ -0,0 +1,197 @@
+package deej
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/getlantern/systray"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/icon"
+)
+
+// tray icon styles, as set in the config
+const (
+	trayIconStyleAuto  = "auto"  // white or black, whichever stands out against the OS theme
+	trayIconStyleColor = "color" // the original logo
+	trayIconStyleWhite = "white"
+	trayIconStyleBlack = "black"
+)
+
+var trayIconStyles = []string{trayIconStyleAuto, trayIconStyleColor, trayIconStyleWhite, trayIconStyleBlack}
+
+type osTheme int
+
+const (
+	osThemeUnknown osTheme = iota
+	osThemeLight
+	osThemeDark
+)
+
+func (t osTheme) String() string {
+	switch t {
+	case osThemeLight:
+		return "light"
+	case osThemeDark:
+		return "dark"
+	}
+
+	return "unknown"
+}
+
+// themeListener reports the OS theme, as it applies to the taskbar or panel the tray icon sits in
+type themeListener interface {
+	// listen returns the current theme and calls onChange whenever it changes, until stop is called.
+	// onChange may be called from any goroutine.
+	listen(onChange func(osTheme)) (osTheme, error)
+	stop()
+}
+
+// trayIcon sets the tray icon according to the config and the OS theme, following both as they change
+type trayIcon struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	theme    osTheme
+	listener themeListener
+
+	themeChanges   chan osTheme
+	failedIconPath string // of the custom icon that last failed to load, so it's only reported once
+}
+
+func newTrayIcon(deej *Deej, logger *zap.SugaredLogger) *trayIcon {
+	logger = logger.Named("tray_icon")
+
+	ti := &trayIcon{
+		deej:         deej,
+		logger:       logger,
+		themeChanges: make(chan osTheme, 1),
+	}
+
+	logger.Debug("Created tray icon instance")
+
+	return ti
+}
+
+// start shows the icon and keeps it up to date. It must only be called once the tray is ready
+func (ti *trayIcon) start() {
+	listener := newThemeListener(ti.logger, ti.deej.handlePanic)
+
+	theme, err := listener.listen(func(theme osTheme) {
+		// only the latest theme matters
+		select {
+		case <-ti.themeChanges:
+		default:
+		}
+
+		ti.themeChanges <- theme
+	})
+
+	if err != nil {
+		ti.logger.Infow("Can't follow the OS theme, the auto tray icon style uses the color logo", "error", err)
+	} else {
+		ti.lock.Lock()
+		ti.listener = listener
+		ti.theme = theme
+		ti.lock.Unlock()
+
+		ti.logger.Debugw("Following the OS theme", "theme", theme)
+	}
+
+	ti.apply()
+
+	configReloadedChannel := ti.deej.events.configReloaded.subscribe()
+
+	ti.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case theme := <-ti.themeChanges:
+				ti.logger.Debugw("OS theme changed", "theme", theme)
+
+				ti.lock.Lock()
+				ti.theme = theme
+				ti.lock.Unlock()
+
+				ti.apply()
+
+			case <-configReloadedChannel:
+				ti.apply()
+			}
+		}
+	})
+}
+
+func (ti *trayIcon) stop() {
+	ti.lock.Lock()
+	defer ti.lock.Unlock()
+
+	if ti.listener == nil {
+		return
+	}
+
+	ti.listener.stop()
+	ti.listener = nil
+}
+
+// apply sets the icon that fits the current config and theme, falling back to a built-in one
+// if a custom icon can't be read
+func (ti *trayIcon) apply() {
+	ti.lock.Lock()
+	theme := ti.theme
+	ti.lock.Unlock()
+
+	info := ti.deej.config.TrayIcon
+	data := trayIconData(info.Style, theme)
+
+	if path := customTrayIconPath(info, theme); path != "" {
+		custom, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			data = custom
+			ti.failedIconPath = ""
+		case path != ti.failedIconPath:
+			ti.logger.Warnw("Failed to read custom tray icon, using the built-in one", "path", path, "error", err)
+			ti.deej.notifier.Notify(tr("notify.trayIconFailed"), tr("notify.trayIconFailedMessage"))
+			ti.failedIconPath = path
+		}
+	}
+
+	systray.SetTemplateIcon(data, data)
+}
+
+// trayIconData returns the built-in icon for a style under the given theme
+func trayIconData(style string, theme osTheme) []byte {
+	switch style {
+	case trayIconStyleWhite:
+		return icon.DeejLogoLight
+	case trayIconStyleBlack:
+		return icon.DeejLogoDark
+	case trayIconStyleAuto:
+		switch theme {
+		case osThemeDark:
+			return icon.DeejLogoLight
+		case osThemeLight:
+			return icon.DeejLogoDark
+		}
+	}
+
+	return icon.DeejLogo
+}
+
+// customTrayIconPath returns the custom icon file configured for the given theme, if any
+func customTrayIconPath(info TrayIconInfo, theme osTheme) string {
+	if theme == osThemeLight && info.LightThemeFile != "" {
+		return info.LightThemeFile
+	}
+
+	if theme == osThemeDark && info.DarkThemeFile != "" {
+		return info.DarkThemeFile
+	}
+
+	return info.File
+}
@@ -0,0 +1,48 @@
+package deej
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/omriharel/deej/pkg/deej/icon"
+)
+
+func TestTrayIconData(t *testing.T) {
+	tests := []struct {
+		style string
+		theme osTheme
+		want  []byte
+	}{
+		{trayIconStyleAuto, osThemeDark, icon.DeejLogoLight},
+		{trayIconStyleAuto, osThemeLight, icon.DeejLogoDark},
+		{trayIconStyleAuto, osThemeUnknown, icon.DeejLogo},
+		{trayIconStyleColor, osThemeDark, icon.DeejLogo},
+		{trayIconStyleWhite, osThemeLight, icon.DeejLogoLight},
+		{trayIconStyleBlack, osThemeUnknown, icon.DeejLogoDark},
+	}
+
+	for _, test := range tests {
+		if got := trayIconData(test.style, test.theme); !bytes.Equal(got, test.want) {
+			t.Errorf("trayIconData(%s, %s) picked the wrong icon", test.style, test.theme)
+		}
+	}
+}
+
+func TestCustomTrayIconPath(t *testing.T) {
+	info := TrayIconInfo{File: "any.ico", DarkThemeFile: "white.ico"}
+
+	tests := []struct {
+		theme osTheme
+		want  string
+	}{
+		{osThemeDark, "white.ico"},
+		{osThemeLight, "any.ico"},
+		{osThemeUnknown, "any.ico"},
+	}
+
+	for _, test := range tests {
+		if got := customTrayIconPath(info, test.theme); got != test.want {
+			t.Errorf("customTrayIconPath(%s) = %q, want %q", test.theme, got, test.want)
+		}
+	}
+}
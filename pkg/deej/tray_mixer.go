@@ -0,0 +1,137 @@
+package deej
+
+import (
+	"context"
+	"errors"
+
+	"github.com/getlantern/systray"
+	"go.uber.org/zap"
+)
+
+// mixerMenu offers shortcuts to the OS's volume mixer and sound settings, along with one item per app that opens
+// the mixer where that app is listed. Like the preset items, the app items are reused as apps come and go.
+type mixerMenu struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	menu          *systray.MenuItem
+	openMixer     *systray.MenuItem
+	soundSettings *systray.MenuItem
+
+	// one item per app, and the session key each visible one opens the mixer for
+	items []*systray.MenuItem
+	keys  []string
+
+	// receives the index of a clicked app item
+	clicks chan int
+}
+
+func newMixerMenu(deej *Deej, logger *zap.SugaredLogger) *mixerMenu {
+	menu := systray.AddMenuItem(tr(mixerTitle), tr(mixerTooltip))
+
+	mm := &mixerMenu{
+		deej:          deej,
+		logger:        logger,
+		menu:          menu,
+		openMixer:     menu.AddSubMenuItem(tr(openMixerTitle), tr(openMixerTooltip)),
+		soundSettings: menu.AddSubMenuItem(tr(soundSettingsTitle), tr(soundSettingsTooltip)),
+		clicks:        make(chan int),
+	}
+
+	return mm
+}
+
+// start lists the current apps and handles clicks, until deej shuts down
+func (mm *mixerMenu) start() {
+	sessionChangesChannel := mm.deej.events.sessionsChanged.subscribe()
+
+	mm.deej.spawn(func(ctx context.Context) error {
+		mm.sync()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case <-sessionChangesChannel:
+				mm.sync()
+
+			case <-mm.openMixer.ClickedCh:
+				mm.logger.Info("Open volume mixer menu item clicked, opening mixer")
+				mm.open(mixerPageApps)
+
+			case <-mm.soundSettings.ClickedCh:
+				mm.logger.Info("Sound settings menu item clicked, opening sound settings")
+				mm.open(mixerPageOutput)
+
+			case idx := <-mm.clicks:
+				if idx >= len(mm.keys) {
+					continue
+				}
+
+				key := mm.keys[idx]
+				mm.logger.Infow("App mixer menu item clicked, opening mixer", "session", key)
+				mm.open(mixerPageFor(key))
+			}
+		}
+	})
+}
+
+func (mm *mixerMenu) open(page mixerPage) {
+	err := openMixer(mm.logger, mm.deej.handlePanic, page)
+	if errors.Is(err, errMixerMissing) {
+		mm.deej.notifier.Notify(tr("notify.mixerMissing"), tr("notify.mixerMissingMessage"))
+		return
+	}
+
+	if err != nil {
+		mm.logger.Warnw("Failed to open volume mixer", "error", err)
+		mm.deej.notifier.Notify(tr("notify.mixerFailed"), tr("notify.moreDetails"))
+	}
+}
+
+// sync shows an item for each app, adding items as needed and hiding the ones left over. Sessions sharing a key
+// (e.g. several chrome.exe processes) get one item, since they share a slider too.
+func (mm *mixerMenu) sync() {
+	var titles []string
+	mm.keys = nil
+
+	for _, session := range mm.deej.sessions.snapshot() {
+		if len(mm.keys) > 0 && mm.keys[len(mm.keys)-1] == session.Key() {
+			continue
+		}
+
+		mm.keys = append(mm.keys, session.Key())
+		titles = append(titles, sessionDisplayName(session))
+	}
+
+	for len(mm.items) < len(mm.keys) {
+		item := mm.menu.AddSubMenuItem("", tr(mixerAppTooltip))
+		idx := len(mm.items)
+		mm.items = append(mm.items, item)
+
+		mm.deej.spawn(func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-item.ClickedCh:
+					select {
+					case mm.clicks <- idx:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			}
+		})
+	}
+
+	for idx, item := range mm.items {
+		if idx < len(mm.keys) {
+			item.SetTitle(titles[idx])
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package deej
+
+import (
+	"context"
+	"time"
+
+	"github.com/getlantern/systray"
+	"go.uber.org/zap"
+)
+
+// presets saved from the tray are named after when they were saved, and can be renamed in the config file
+const trayPresetNameFormat = "snapshot 2006-01-02 15:04"
+
+// presetMenu keeps the tray's volume presets submenu in sync with the config. Menu items can't be removed,
+// only hidden, so the items are reused as presets come and go.
+type presetMenu struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	save  *systray.MenuItem
+	empty *systray.MenuItem
+	menu  *systray.MenuItem
+
+	// one item per preset, and the preset each visible one restores
+	items []*systray.MenuItem
+	names []string
+
+	// receives the index of a clicked preset item
+	clicks chan int
+}
+
+func newPresetMenu(deej *Deej, logger *zap.SugaredLogger) *presetMenu {
+	menu := systray.AddMenuItem(tr(presetsTitle), tr(presetsTooltip))
+
+	pm := &presetMenu{
+		deej:   deej,
+		logger: logger,
+		menu:   menu,
+		save:   menu.AddSubMenuItem(tr(savePresetTitle), tr(savePresetTooltip)),
+		empty:  menu.AddSubMenuItem(tr("tray.noPresets"), ""),
+		clicks: make(chan int),
+	}
+
+	pm.empty.Disable()
+
+	return pm
+}
+
+// start shows the current presets and handles clicks, until deej shuts down
+func (pm *presetMenu) start() {
+	configReloadedChannel := pm.deej.events.configReloaded.subscribe()
+
+	pm.deej.spawn(func(ctx context.Context) error {
+		pm.sync()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case <-configReloadedChannel:
+				pm.sync()
+
+			case <-pm.save.ClickedCh:
+				name := time.Now().Format(trayPresetNameFormat)
+				pm.logger.Infow("Save preset menu item clicked, saving current volumes", "preset", name)
+
+				if _, err := pm.deej.savePreset(name); err != nil {
+					pm.logger.Warnw("Failed to save preset", "error", err)
+					pm.deej.notifier.Notify(tr("notify.presetFailed"), tr("notify.moreDetails"))
+					continue
+				}
+
+				pm.deej.notifier.Notify(tr("notify.presetSaved"), tr("notify.presetSavedMessage", "preset", name))
+
+			case idx := <-pm.clicks:
+				if idx >= len(pm.names) {
+					continue
+				}
+
+				name := pm.names[idx]
+				pm.logger.Infow("Preset menu item clicked, restoring preset", "preset", name)
+
+				if _, err := pm.deej.restorePreset(name); err != nil {
+					pm.logger.Warnw("Failed to restore preset", "preset", name, "error", err)
+					pm.deej.notifier.Notify(tr("notify.presetRestoreFailed", "preset", name), tr("notify.moreDetails"))
+				}
+			}
+		}
+	})
+}
+
+// sync shows an item for each preset, adding items as needed and hiding the ones left over
+func (pm *presetMenu) sync() {
+	pm.names = pm.deej.presetNames()
+
+	for len(pm.items) < len(pm.names) {
+		item := pm.menu.AddSubMenuItem("", tr("tray.restorePresetTooltip"))
+		idx := len(pm.items)
+		pm.items = append(pm.items, item)
+
+		pm.deej.spawn(func(ctx context.Context) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-item.ClickedCh:
+					select {
+					case pm.clicks <- idx:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			}
+		})
+	}
+
+	for idx, item := range pm.items {
+		if idx < len(pm.names) {
+			item.SetTitle(pm.names[idx])
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+
+	if len(pm.names) == 0 {
+		pm.empty.Show()
+	} else {
+		pm.empty.Hide()
+	}
+}
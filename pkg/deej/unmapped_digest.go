@@ -0,0 +1,237 @@
+package deej
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// how often unmapped apps are checked for playing audio while the digest is enabled
+	unmappedSampleInterval = 2 * time.Second
+
+	// peaks above this count as playing, the same as for ducking
+	unmappedPeakThreshold = defaultDuckThreshold
+)
+
+// unmappedDigest tells the user which apps no slider controls have been playing audio, which is what deej.unmapped
+// catches. With unmapped_digest enabled it notifies of newly heard ones every so often, and "Show unmapped apps"
+// in the tray lists them on demand.
+type unmappedDigest struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// unmapped apps heard playing since the last digest, by session key
+	heard map[string]bool
+
+	// apps already included in a digest, so each is only announced once
+	reported map[string]bool
+}
+
+func newUnmappedDigest(deej *Deej, logger *zap.SugaredLogger) *unmappedDigest {
+	logger = logger.Named("unmapped_digest")
+
+	ud := &unmappedDigest{
+		deej:     deej,
+		logger:   logger,
+		heard:    make(map[string]bool),
+		reported: make(map[string]bool),
+	}
+
+	logger.Debug("Created unmapped digest instance")
+
+	return ud
+}
+
+// start samples unmapped apps and sends digests while enabled, picking up config changes, until deej shuts down
+func (ud *unmappedDigest) start() {
+	configReloadedChannel := ud.deej.events.configReloaded.subscribe()
+
+	ud.deej.spawn(func(ctx context.Context) error {
+		// receiving from a nil channel blocks forever, leaving those cases out of the select while disabled
+		var sampler, digester *time.Ticker
+		var samples, digests <-chan time.Time
+
+		stop := func() {
+			if sampler != nil {
+				sampler.Stop()
+				digester.Stop()
+				sampler, digester = nil, nil
+				samples, digests = nil, nil
+			}
+		}
+
+		defer stop()
+
+		apply := func() {
+			stop()
+
+			info := ud.deej.config.UnmappedDigest
+			if !info.Enabled {
+				return
+			}
+
+			ud.logger.Debugw("Watching for unmapped apps playing audio", "interval", info.Interval)
+
+			sampler = time.NewTicker(unmappedSampleInterval)
+			digester = time.NewTicker(info.Interval)
+			samples, digests = sampler.C, digester.C
+		}
+
+		apply()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case <-configReloadedChannel:
+				apply()
+
+			case <-samples:
+				ud.sample()
+
+			case <-digests:
+				ud.sendDigest()
+			}
+		}
+	})
+}
+
+// sample records which unmapped apps are playing right now
+func (ud *unmappedDigest) sample() {
+	playing := ud.playing()
+
+	ud.lock.Lock()
+	defer ud.lock.Unlock()
+
+	for _, key := range playing {
+		ud.heard[key] = true
+	}
+}
+
+// playing returns the keys of the unmapped sessions playing audio right now
+func (ud *unmappedDigest) playing() []string {
+	var keys []string
+
+	for _, session := range ud.deej.sessions.snapshot() {
+		meter, ok := session.(PeakMeter)
+		if !ok || ud.deej.sessions.sessionMapped(session) {
+			continue
+		}
+
+		if meter.GetPeak() > unmappedPeakThreshold {
+			keys = append(keys, session.Key())
+		}
+	}
+
+	return uniqueSorted(keys)
+}
+
+// sendDigest notifies of the unmapped apps heard since the last digest that weren't reported yet. Apps that
+// quit in the meantime are still included, but not ones a slider controls by now.
+func (ud *unmappedDigest) sendDigest() {
+	var keys []string
+
+	ud.lock.Lock()
+	for key := range ud.heard {
+		if !ud.reported[key] && !ud.mappedNow(key) {
+			ud.reported[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	ud.heard = make(map[string]bool)
+	ud.lock.Unlock()
+
+	if len(keys) == 0 {
+		ud.logger.Debug("No new unmapped apps played audio, skipping digest")
+		return
+	}
+
+	sort.Strings(keys)
+
+	ud.logger.Infow("Unmapped apps played audio", "apps", keys)
+	ud.deej.notifier.Notify(tr("notify.unmappedDigest", "count", len(keys)),
+		tr("notify.unmappedDigestMessage", "apps", strings.Join(keys, ", ")))
+}
+
+// show notifies of every unmapped app that's running, telling apart the ones playing now (or heard since the
+// last digest) from the ones that are merely running
+func (ud *unmappedDigest) show() {
+	isPlaying := make(map[string]bool)
+	for _, key := range ud.playing() {
+		isPlaying[key] = true
+	}
+
+	ud.lock.Lock()
+	for key := range ud.heard {
+		isPlaying[key] = true
+	}
+	ud.lock.Unlock()
+
+	var playing, running []string
+	for _, key := range uniqueSorted(ud.deej.sessions.getUnmappedSessionKeys()) {
+		if isPlaying[key] {
+			playing = append(playing, key)
+		} else {
+			running = append(running, key)
+		}
+	}
+
+	ud.logger.Infow("Unmapped apps", "playing", playing, "running", running)
+
+	switch {
+	case len(playing) == 0 && len(running) == 0:
+		ud.deej.notifier.Notify(tr("notify.noUnmappedApps"), tr("notify.noUnmappedAppsMessage"))
+
+	case len(playing) == 0:
+		ud.deej.notifier.Notify(tr("notify.unmappedApps", "count", len(running)),
+			tr("notify.unmappedAppsSilent", "apps", strings.Join(running, ", ")))
+
+	case len(running) == 0:
+		ud.deej.notifier.Notify(tr("notify.unmappedApps", "count", len(playing)),
+			tr("notify.unmappedAppsPlaying", "apps", strings.Join(playing, ", ")))
+
+	default:
+		ud.deej.notifier.Notify(tr("notify.unmappedApps", "count", len(playing)+len(running)),
+			tr("notify.unmappedAppsBoth", "playing", strings.Join(playing, ", "), "running", strings.Join(running, ", ")))
+	}
+}
+
+// mappedNow reports whether a slider controls an app heard earlier by now. Apps that aren't running anymore
+// count as unmapped, since they were when they were heard.
+func (ud *unmappedDigest) mappedNow(key string) bool {
+	sessions, ok := ud.deej.sessions.get(key)
+	if !ok {
+		return false
+	}
+
+	for _, session := range sessions {
+		if !ud.deej.sessions.sessionMapped(session) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// uniqueSorted sorts keys, dropping repeats like those of an app with several sessions
+func uniqueSorted(keys []string) []string {
+	sort.Strings(keys)
+
+	var unique []string
+	for _, key := range keys {
+		if len(unique) == 0 || unique[len(unique)-1] != key {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
@@ -39,6 +39,30 @@ func SetupCloseHandler() chan os.Signal {
 	return c
 }
 
+// SetupReloadHandler returns a channel that receives SIGHUP, which asks daemons to reload their config.
+// Windows never sends it.
+func SetupReloadHandler() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c
+}
+
+// Go runs f on a new goroutine. If f panics, the panic is passed to onPanic instead of
+// crashing the process, since a deferred recover only covers the goroutine it runs on.
+func Go(onPanic func(recoverValue interface{}), f func()) {
+	go func() {
+		defer Recover(onPanic)
+		f()
+	}()
+}
+
+// Recover passes an ongoing panic to onPanic. It must be deferred directly, e.g. defer util.Recover(onPanic).
+func Recover(onPanic func(recoverValue interface{})) {
+	if r := recover(); r != nil {
+		onPanic(r)
+	}
+}
+
 // GetCurrentWindowProcessNames returns the process names of the current foreground window,
 // including child processes. Currently only implemented for Windows.
 func GetCurrentWindowProcessNames() ([]string, error) {
@@ -55,17 +79,52 @@ func OpenExternal(logger *zap.SugaredLogger, cmd string, arg string) error {
 	return nil
 }
 
-// NormalizeScalar trims the given float32 to 2 decimal places of precision (e.g., 0.15442 -> 0.15).
-// Used for normalizing audio volume levels and slider values.
-func NormalizeScalar(v float32) float32 {
-	return float32(math.Floor(float64(v)*100) / 100.0)
+// HideCommandWindow keeps the given command from opening a console window while it runs (Windows only).
+func HideCommandWindow(cmd *exec.Cmd) {
+	hideCommandWindow(cmd)
+}
+
+// MediaKey identifies a media control key that can be synthesized with SendMediaKey.
+type MediaKey int
+
+// Supported media keys.
+const (
+	MediaKeyPlayPause MediaKey = iota
+	MediaKeyNext
+	MediaKeyPrevious
+	MediaKeyStop
+)
+
+// SendMediaKey simulates a press and release of the given media key, as if it came from a keyboard,
+// so whichever media player the OS considers active will react to it.
+func SendMediaKey(key MediaKey) error {
+	return sendMediaKey(key)
+}
+
+// QuantizeScalar rounds the given float32 to the nearest of the given number of steps between 0 and 1
+// (e.g., 0.15462 -> 0.155 with 1000 steps). It rounds instead of truncating, and does its math in float64,
+// so values that are exactly on a step in decimal don't end up on the one below.
+func QuantizeScalar(v float32, steps int) float32 {
+	return float32(math.Round(float64(v)*float64(steps)) / float64(steps))
 }
 
 // SignificantlyDifferent returns true if there's a significant enough volume difference between two values,
 // considering a specified noise reduction level.
 func SignificantlyDifferent(old float32, new float32, noiseReductionLevel string) bool {
-	threshold := getSignificantDifferenceThreshold(noiseReductionLevel)
-	if math.Abs(float64(old-new)) >= threshold {
+	return DifferentBy(old, new, getSignificantDifferenceThreshold(noiseReductionLevel))
+}
+
+// SignificantDifferenceThreshold returns the smallest volume difference SignificantlyDifferent considers
+// significant at a noise reduction level
+func SignificantDifferenceThreshold(noiseReductionLevel string) float64 {
+	return getSignificantDifferenceThreshold(noiseReductionLevel)
+}
+
+// DifferentBy returns true if two values are at least threshold apart, or if the new one reaches 0.0 or 1.0
+// while the old one doesn't. Values exactly threshold apart count even when float32 rounding puts them a hair
+// short of it, e.g. 0.5 and 0.505 with a threshold of 0.005.
+func DifferentBy(old float32, new float32, threshold float64) bool {
+	if math.Abs(float64(old)-float64(new)) >= threshold-differenceEpsilon {
 		return true
 	}
 	// Special behavior around edges of 0.0 and 1.0.
@@ -75,9 +134,12 @@ func SignificantlyDifferent(old float32, new float32, noiseReductionLevel string
 	return false
 }
 
+// differenceEpsilon is how far off float32 rounding can put values that are really the same
+const differenceEpsilon = 0.000001
+
 // almostEquals checks if two float32 values are very close to each other.
 func almostEquals(a float32, b float32) bool {
-	return math.Abs(float64(a-b)) < 0.000001
+	return math.Abs(float64(a-b)) < differenceEpsilon
 }
 
 // createExternalCommand prepares the appropriate command for launching an external process depending on the OS.
@@ -105,4 +167,4 @@ func getSignificantDifferenceThreshold(noiseReductionLevel string) float64 {
 	default:
 		return 0.025
 	}
-}
\ No newline at end of file
+}
@@ -1,22 +1,75 @@
 package util
 
 import (
-	"errors"
 	"fmt"
-	"runtime"
+	"os/exec"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
 )
 
-// getCurrentWindowProcessNames returns the process names of the current foreground window,
-// including child processes. This function is platform-dependent and currently implemented only for Windows.
-func getCurrentWindowProcessNames() ([]string, error) {
-	// Check if the current operating system is Windows
-	if runtime.GOOS != "windows" {
-		return nil, fmt.Errorf("getCurrentWindowProcessNames is only supported on Windows, current OS: %s", runtime.GOOS)
+// hideCommandWindow does nothing, since commands don't get their own window on Linux.
+func hideCommandWindow(cmd *exec.Cmd) {}
+
+// mediaKeysyms maps media keys to their X11 keysyms (XF86AudioPlay and friends).
+var mediaKeysyms = map[MediaKey]xproto.Keysym{
+	MediaKeyPlayPause: 0x1008ff14,
+	MediaKeyStop:      0x1008ff15,
+	MediaKeyPrevious:  0x1008ff16,
+	MediaKeyNext:      0x1008ff17,
+}
+
+// sendMediaKey injects a key press and release for the given media key through the XTEST extension.
+// Desktop environments forward these to the active MPRIS player, just like a real keyboard's media keys.
+func sendMediaKey(key MediaKey) error {
+	keysym, ok := mediaKeysyms[key]
+	if !ok {
+		return fmt.Errorf("unknown media key: %d", key)
+	}
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("connect to X server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := xtest.Init(conn); err != nil {
+		return fmt.Errorf("init XTEST extension: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	root := setup.DefaultScreen(conn).Root
+
+	keycode, err := findKeycode(conn, setup, keysym)
+	if err != nil {
+		return err
+	}
+
+	for _, eventType := range []byte{xproto.KeyPress, xproto.KeyRelease} {
+		if err := xtest.FakeInputChecked(conn, eventType, byte(keycode), 0, root, 0, 0, 0).Check(); err != nil {
+			return fmt.Errorf("fake key event: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// findKeycode returns the first keycode that produces the given keysym on the current keyboard layout.
+func findKeycode(conn *xgb.Conn, setup *xproto.SetupInfo, keysym xproto.Keysym) (xproto.Keycode, error) {
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, count).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("get keyboard mapping: %w", err)
+	}
+
+	perKeycode := int(mapping.KeysymsPerKeycode)
+	for i, candidate := range mapping.Keysyms {
+		if candidate == keysym {
+			return setup.MinKeycode + xproto.Keycode(i/perKeycode), nil
+		}
 	}
 
-	// Placeholder: Implement the actual functionality here
-	// You would use platform-specific APIs like `GetForegroundWindow` (Windows) to fetch this data.
-	
-	// Since the actual implementation is not available yet, return an unimplemented error.
-	return nil, errors.New("getCurrentWindowProcessNames: not implemented yet")
-}
\ No newline at end of file
+	return 0, fmt.Errorf("no key produces keysym %#x on the current keyboard layout", keysym)
+}
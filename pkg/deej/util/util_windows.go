@@ -1,7 +1,9 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"os/exec"
 	"syscall"
 	"time"
 	"unsafe"
@@ -89,4 +91,49 @@ func getProcessNameByPID(pid uint32) (string, error) {
 		return "", fmt.Errorf("failed to find process for PID %d: %w", pid, err)
 	}
 	return process.Executable(), nil
-}
\ No newline at end of file
+}
+
+// createNoWindow is the CREATE_NO_WINDOW process creation flag.
+const createNoWindow = 0x08000000
+
+// hideCommandWindow keeps console programs (scripts, interpreters) from flashing a console window.
+func hideCommandWindow(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: createNoWindow,
+	}
+}
+
+// mediaVirtualKeys maps media keys to their Windows virtual key codes.
+var mediaVirtualKeys = map[MediaKey]uint16{
+	MediaKeyPlayPause: win.VK_MEDIA_PLAY_PAUSE,
+	MediaKeyNext:      win.VK_MEDIA_NEXT_TRACK,
+	MediaKeyPrevious:  win.VK_MEDIA_PREV_TRACK,
+	MediaKeyStop:      win.VK_MEDIA_STOP,
+}
+
+// sendMediaKey injects a key down and key up event for the given media key with SendInput.
+func sendMediaKey(key MediaKey) error {
+	vk, ok := mediaVirtualKeys[key]
+	if !ok {
+		return fmt.Errorf("unknown media key: %d", key)
+	}
+
+	inputs := []win.KEYBD_INPUT{
+		{
+			Type: win.INPUT_KEYBOARD,
+			Ki:   win.KEYBDINPUT{WVk: vk, DwFlags: win.KEYEVENTF_EXTENDEDKEY},
+		},
+		{
+			Type: win.INPUT_KEYBOARD,
+			Ki:   win.KEYBDINPUT{WVk: vk, DwFlags: win.KEYEVENTF_EXTENDEDKEY | win.KEYEVENTF_KEYUP},
+		},
+	}
+
+	sent := win.SendInput(uint32(len(inputs)), unsafe.Pointer(&inputs[0]), int32(unsafe.Sizeof(inputs[0])))
+	if sent != uint32(len(inputs)) {
+		return errors.New("SendInput was blocked (is a higher-privileged app focused?)")
+	}
+
+	return nil
+}
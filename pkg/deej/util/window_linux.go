@@ -0,0 +1,248 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// Cooldown duration to avoid frequent calls to GetCurrentWindowProcessNames.
+const getCurrentWindowInternalCooldown = time.Millisecond * 350
+
+var (
+	// Cache the result and the last call timestamp to avoid frequent lookups.
+	lastGetCurrentWindowResult []string
+	lastGetCurrentWindowCall   = time.Now()
+
+	// returned by window sources that don't apply to the current session, e.g. sway's IPC while running under GNOME
+	errWindowSourceUnavailable = errors.New("not available in this session")
+)
+
+// windowSource returns the PID of the process owning the focused window, or 0 if no window is focused
+type windowSource struct {
+	name      string
+	activePID func() (int, error)
+}
+
+var x11WindowSources = []windowSource{
+	{"x11", x11ActivePID},
+}
+
+// Wayland doesn't let clients see other clients' windows, and the desktop portal has no interface for the
+// focused window either, so only compositors with IPC of their own can tell. X11 comes last as it only sees
+// XWayland apps, which is still better than nothing under GNOME and KDE.
+var waylandWindowSources = []windowSource{
+	{"sway", swayActivePID},
+	{"hyprland", hyprlandActivePID},
+	{"niri", niriActivePID},
+	{"xwayland", x11ActivePID},
+}
+
+// currentWindowSources picks the window sources for the session deej runs in
+func currentWindowSources() []windowSource {
+	if waylandSession() {
+		return waylandWindowSources
+	}
+
+	return x11WindowSources
+}
+
+func waylandSession() bool {
+	switch os.Getenv("XDG_SESSION_TYPE") {
+	case "wayland":
+		return true
+	case "x11":
+		return false
+	}
+
+	// started outside a login session (e.g. from a systemd user unit), so guess from what's reachable
+	return os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// getCurrentWindowProcessNames returns the process names of the focused window's process and its descendants,
+// since apps such as browsers and game launchers often play audio from a child process.
+func getCurrentWindowProcessNames() ([]string, error) {
+	// Apply an internal cooldown to avoid excessive lookups.
+	now := time.Now()
+	if lastGetCurrentWindowCall.Add(getCurrentWindowInternalCooldown).After(now) {
+		return lastGetCurrentWindowResult, nil
+	}
+
+	lastGetCurrentWindowCall = now
+
+	var errs []error
+
+	for _, source := range currentWindowSources() {
+		pid, err := source.activePID()
+		if errors.Is(err, errWindowSourceUnavailable) {
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.name, err))
+			continue
+		}
+
+		if pid == 0 {
+			lastGetCurrentWindowResult = nil
+			return nil, nil
+		}
+
+		lastGetCurrentWindowResult = processTreeNames(pid)
+		return lastGetCurrentWindowResult, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no supported way to find the focused window (needs X11/XWayland, sway, Hyprland or niri)")
+	}
+
+	return nil, fmt.Errorf("find focused window: %w", errors.Join(errs...))
+}
+
+// x11ActivePID reads the focused window from the root window's _NET_ACTIVE_WINDOW property,
+// which every EWMH-compliant window manager maintains
+func x11ActivePID() (int, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return 0, errWindowSourceUnavailable
+	}
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return 0, fmt.Errorf("connect to X server: %w", err)
+	}
+	defer conn.Close()
+
+	activeWindowAtom, err := internAtom(conn, "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return 0, err
+	}
+
+	pidAtom, err := internAtom(conn, "_NET_WM_PID")
+	if err != nil {
+		return 0, err
+	}
+
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+
+	window, err := getCardinalProperty(conn, root, activeWindowAtom, xproto.AtomWindow)
+	if err != nil || window == 0 {
+		return 0, err
+	}
+
+	pid, err := getCardinalProperty(conn, xproto.Window(window), pidAtom, xproto.AtomCardinal)
+	if err != nil {
+		return 0, err
+	}
+
+	if pid == 0 {
+		return 0, errors.New("focused window doesn't report its PID")
+	}
+
+	return int(pid), nil
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, true, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("intern atom %s: %w", name, err)
+	}
+
+	return reply.Atom, nil
+}
+
+// getCardinalProperty reads a single 32-bit property value, returning 0 if the window doesn't have the property
+func getCardinalProperty(conn *xgb.Conn, window xproto.Window, property xproto.Atom, propertyType xproto.Atom) (uint32, error) {
+	if property == xproto.AtomNone {
+		return 0, nil
+	}
+
+	reply, err := xproto.GetProperty(conn, false, window, property, propertyType, 0, 1).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("get window property: %w", err)
+	}
+
+	if reply.Format != 32 || len(reply.Value) < 4 {
+		return 0, nil
+	}
+
+	return xgb.Get32(reply.Value), nil
+}
+
+// processTreeNames returns the names of a process and all of its descendants, as audio sessions know them
+func processTreeNames(pid int) []string {
+	children := make(map[int][]int)
+
+	entries, _ := os.ReadDir("/proc")
+	for _, entry := range entries {
+		childPID, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if parentPID, ok := parentProcessID(childPID); ok {
+			children[parentPID] = append(children[parentPID], childPID)
+		}
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+
+	queue := []int{pid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if name := processName(current); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+
+		queue = append(queue, children[current]...)
+	}
+
+	return names
+}
+
+func parentProcessID(pid int) (int, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, false
+	}
+
+	// the process name in parentheses may itself contain spaces and parentheses, so fields start after the last one
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return 0, false
+	}
+
+	// after the name come the state and the parent PID
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 2 {
+		return 0, false
+	}
+
+	parentPID, err := strconv.Atoi(fields[1])
+	return parentPID, err == nil
+}
+
+// processName returns the name of a process's executable, which PulseAudio reports as application.process.binary.
+// comm is used for processes whose executable can't be read, but it's cut off after 15 characters.
+func processName(pid int) string {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)"))
+	}
+
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(comm))
+}
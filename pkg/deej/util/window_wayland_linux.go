@@ -0,0 +1,178 @@
+package util
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// how long to wait for a compositor to answer
+	windowIPCTimeout = time.Second
+
+	// i3-ipc message type that returns the whole layout tree, including which window is focused
+	swayGetTree = 4
+)
+
+// swayNode is the part of a sway layout tree node needed to find the focused window
+type swayNode struct {
+	Focused       bool       `json:"focused"`
+	PID           int        `json:"pid"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+func (n swayNode) focusedPID() int {
+	if n.Focused {
+		return n.PID
+	}
+
+	for _, children := range [][]swayNode{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			if pid := child.focusedPID(); pid != 0 {
+				return pid
+			}
+		}
+	}
+
+	return 0
+}
+
+// swayActivePID asks sway (or i3) for its layout tree over the i3-ipc socket
+func swayActivePID() (int, error) {
+	socketPath := os.Getenv("SWAYSOCK")
+	if socketPath == "" {
+		return 0, errWindowSourceUnavailable
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, windowIPCTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("connect to sway: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(windowIPCTimeout))
+
+	// messages are "i3-ipc", followed by the payload length and the message type, then the payload
+	header := make([]byte, 14)
+	copy(header, "i3-ipc")
+	binary.LittleEndian.PutUint32(header[6:], 0)
+	binary.LittleEndian.PutUint32(header[10:], swayGetTree)
+
+	if _, err := conn.Write(header); err != nil {
+		return 0, fmt.Errorf("send sway request: %w", err)
+	}
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, fmt.Errorf("read sway reply: %w", err)
+	}
+
+	payload := make([]byte, binary.LittleEndian.Uint32(header[6:]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return 0, fmt.Errorf("read sway reply: %w", err)
+	}
+
+	var tree swayNode
+	if err := json.Unmarshal(payload, &tree); err != nil {
+		return 0, fmt.Errorf("parse sway layout tree: %w", err)
+	}
+
+	return tree.focusedPID(), nil
+}
+
+// hyprlandActivePID asks Hyprland for the active window over its request socket
+func hyprlandActivePID() (int, error) {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature == "" {
+		return 0, errWindowSourceUnavailable
+	}
+
+	// the socket moved from /tmp to the runtime directory in Hyprland 0.40
+	socketPath := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "hypr", signature, ".socket.sock")
+	if _, err := os.Stat(socketPath); err != nil {
+		socketPath = filepath.Join(os.TempDir(), "hypr", signature, ".socket.sock")
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, windowIPCTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("connect to Hyprland: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(windowIPCTimeout))
+
+	if _, err := io.WriteString(conn, "j/activewindow"); err != nil {
+		return 0, fmt.Errorf("send Hyprland request: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return 0, fmt.Errorf("read Hyprland reply: %w", err)
+	}
+
+	// with no window focused, the reply is an empty object
+	var window struct {
+		PID int `json:"pid"`
+	}
+
+	if err := json.Unmarshal(reply, &window); err != nil {
+		return 0, fmt.Errorf("parse Hyprland reply: %w", err)
+	}
+
+	return max(window.PID, 0), nil
+}
+
+// niriActivePID asks niri for the focused window over its JSON socket
+func niriActivePID() (int, error) {
+	socketPath := os.Getenv("NIRI_SOCKET")
+	if socketPath == "" {
+		return 0, errWindowSourceUnavailable
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, windowIPCTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("connect to niri: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(windowIPCTimeout))
+
+	// requests and replies are one JSON value per line
+	if _, err := io.WriteString(conn, "\"FocusedWindow\"\n"); err != nil {
+		return 0, fmt.Errorf("send niri request: %w", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return 0, fmt.Errorf("read niri reply: %w", err)
+	}
+
+	var reply struct {
+		Ok *struct {
+			FocusedWindow *struct {
+				PID int `json:"pid"`
+			}
+		}
+		Err string
+	}
+
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return 0, fmt.Errorf("parse niri reply: %w", err)
+	}
+
+	if reply.Ok == nil {
+		return 0, fmt.Errorf("niri refused the request: %s", reply.Err)
+	}
+
+	if reply.Ok.FocusedWindow == nil {
+		return 0, nil
+	}
+
+	return max(reply.Ok.FocusedWindow.PID, 0), nil
+}
@@ -0,0 +1,185 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// voicemeeterTargetPrefix addresses Voicemeeter strips and buses, e.g. "vm:strip0" or "vm:bus.A1"
+	voicemeeterTargetPrefix = "vm"
+
+	// Voicemeeter gains are expressed in dB; this is the bottom of its fader range
+	voicemeeterMinGain = -60.0
+)
+
+// Voicemeeter editions, as reported by the Remote API
+const (
+	voicemeeterTypeStandard = 1
+	voicemeeterTypeBanana   = 2
+	voicemeeterTypePotato   = 3
+)
+
+// voicemeeterRemote is the platform-specific connection to Voicemeeter's Remote API
+type voicemeeterRemote interface {
+	login() error
+	logout() error
+	edition() (int, error)
+	setParameterFloat(name string, value float32) error
+}
+
+// voicemeeter controls Voicemeeter strip and bus gains through vm: targets
+type voicemeeter struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	remote   voicemeeterRemote
+	loggedIn bool
+}
+
+func newVoicemeeter(deej *Deej, logger *zap.SugaredLogger) *voicemeeter {
+	logger = logger.Named("voicemeeter")
+
+	vm := &voicemeeter{
+		deej:   deej,
+		logger: logger,
+		remote: newVoicemeeterRemote(),
+	}
+
+	logger.Debug("Created Voicemeeter instance")
+
+	return vm
+}
+
+// initialize registers the vm: target prefix. Voicemeeter itself is only contacted once a vm: target is used.
+func (vm *voicemeeter) initialize() {
+	vm.deej.sessions.registerExternalTarget(voicemeeterTargetPrefix, vm.setGain)
+}
+
+// release logs out of the Remote API, if we logged in
+func (vm *voicemeeter) release() {
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	if !vm.loggedIn {
+		return
+	}
+
+	if err := vm.remote.logout(); err != nil {
+		vm.logger.Warnw("Failed to log out of Voicemeeter Remote API", "error", err)
+	}
+
+	vm.loggedIn = false
+}
+
+// setGain handles vm:<strip or bus> targets
+func (vm *voicemeeter) setGain(name string, v float32) error {
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+
+	if !vm.loggedIn {
+		if err := vm.remote.login(); err != nil {
+			return fmt.Errorf("log in to voicemeeter: %w", err)
+		}
+
+		vm.loggedIn = true
+		vm.logger.Info("Logged in to Voicemeeter Remote API")
+	}
+
+	edition, err := vm.remote.edition()
+	if err != nil {
+		return fmt.Errorf("get voicemeeter edition: %w", err)
+	}
+
+	parameter, err := voicemeeterGainParameter(name, edition)
+	if err != nil {
+		return err
+	}
+
+	return vm.remote.setParameterFloat(parameter, voicemeeterGain(v))
+}
+
+// voicemeeterGainParameter translates a target name such as "strip0", "strip.2", "bus.A1" or "bus3"
+// into the Remote API parameter holding its gain, e.g. "Strip[0].Gain"
+func voicemeeterGainParameter(name string, edition int) (string, error) {
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.HasPrefix(name, "strip"):
+		index, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(name, "strip"), "."))
+		if err != nil || index < 0 {
+			return "", fmt.Errorf("invalid voicemeeter strip: %s", name)
+		}
+
+		return fmt.Sprintf("Strip[%d].Gain", index), nil
+
+	case strings.HasPrefix(name, "bus"):
+		index, err := voicemeeterBusIndex(strings.TrimPrefix(strings.TrimPrefix(name, "bus"), "."), edition)
+		if err != nil {
+			return "", fmt.Errorf("invalid voicemeeter bus %s: %w", name, err)
+		}
+
+		return fmt.Sprintf("Bus[%d].Gain", index), nil
+	}
+
+	return "", fmt.Errorf("unknown voicemeeter target: %s (expected strip<N> or bus.<A1|B1|N>)", name)
+}
+
+// voicemeeterBusIndex accepts either a raw bus index or a bus label as shown in Voicemeeter's UI (A1, B2...).
+// Physical (A) buses come before virtual (B) buses, and how many of each exist depends on the edition.
+func voicemeeterBusIndex(bus string, edition int) (int, error) {
+	if index, err := strconv.Atoi(bus); err == nil && index >= 0 {
+		return index, nil
+	}
+
+	if len(bus) < 2 {
+		return 0, fmt.Errorf("expected a bus index or label")
+	}
+
+	number, err := strconv.Atoi(bus[1:])
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("expected a bus index or label")
+	}
+
+	var physical, virtual int
+	switch edition {
+	case voicemeeterTypeStandard:
+		physical, virtual = 1, 1
+	case voicemeeterTypeBanana:
+		physical, virtual = 3, 2
+	case voicemeeterTypePotato:
+		physical, virtual = 5, 3
+	default:
+		return 0, fmt.Errorf("unknown voicemeeter edition %d", edition)
+	}
+
+	switch bus[0] {
+	case 'a':
+		if number <= physical {
+			return number - 1, nil
+		}
+	case 'b':
+		if number <= virtual {
+			return physical + number - 1, nil
+		}
+	default:
+		return 0, fmt.Errorf("expected a bus index or label")
+	}
+
+	return 0, fmt.Errorf("this edition of voicemeeter has no such bus")
+}
+
+// voicemeeterGain maps a [0, 1] slider value onto Voicemeeter's dB fader, so the slider feels like any other volume
+func voicemeeterGain(v float32) float32 {
+	if v <= 0 {
+		return voicemeeterMinGain
+	}
+
+	return float32(math.Max(voicemeeterMinGain, 20*math.Log10(float64(v))))
+}
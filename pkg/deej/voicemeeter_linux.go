@@ -0,0 +1,27 @@
+package deej
+
+import "errors"
+
+var errVoicemeeterUnsupported = errors.New("voicemeeter is only available on Windows")
+
+type unsupportedVoicemeeterRemote struct{}
+
+func newVoicemeeterRemote() voicemeeterRemote {
+	return unsupportedVoicemeeterRemote{}
+}
+
+func (unsupportedVoicemeeterRemote) login() error {
+	return errVoicemeeterUnsupported
+}
+
+func (unsupportedVoicemeeterRemote) logout() error {
+	return nil
+}
+
+func (unsupportedVoicemeeterRemote) edition() (int, error) {
+	return 0, errVoicemeeterUnsupported
+}
+
+func (unsupportedVoicemeeterRemote) setParameterFloat(name string, value float32) error {
+	return errVoicemeeterUnsupported
+}
@@ -0,0 +1,94 @@
+package deej
+
+import "strings"
+
+// setVolumeCaps replaces the highest volume each target may be set to, by target, such as from scheduled rules.
+// The config's safety_caps apply on top of these. Sessions matching several capped targets get the lowest of their
+// caps. Volumes already above a new cap aren't lowered until enforceVolumeCaps is called.
+func (m *sessionMap) setVolumeCaps(caps map[string]float32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.volumeCaps = caps
+}
+
+// currentVolumeCaps returns every set of caps that applies right now
+func (m *sessionMap) currentVolumeCaps() []map[string]float32 {
+	m.lock.Lock()
+	caps := m.volumeCaps
+	m.lock.Unlock()
+
+	return []map[string]float32{caps, m.config.SafetyCaps}
+}
+
+// clampVolume returns the volume a session can be set to, given the caps that apply to it
+func (m *sessionMap) clampVolume(session Session, v float32) float32 {
+	for _, caps := range m.currentVolumeCaps() {
+		for target, limit := range caps {
+			if v > limit && m.targetMatches(target, session) {
+				v = limit
+			}
+		}
+	}
+
+	return v
+}
+
+// clampExternalVolume returns the volume an external target (like obs:Mic/Aux) can be set to, given the caps
+// set for it by name
+func (m *sessionMap) clampExternalVolume(target string, v float32) float32 {
+	for _, caps := range m.currentVolumeCaps() {
+		for capped, limit := range caps {
+			if v > limit && strings.EqualFold(capped, target) {
+				v = limit
+			}
+		}
+	}
+
+	return v
+}
+
+// enforceVolumeCaps lowers every session that's above one of its caps, e.g. once a cap starts applying
+// or after new sessions show up
+func (m *sessionMap) enforceVolumeCaps() {
+	empty := true
+	for _, caps := range m.currentVolumeCaps() {
+		empty = empty && len(caps) == 0
+	}
+
+	if empty {
+		return
+	}
+
+	for _, session := range m.snapshot() {
+		current := session.GetVolume()
+
+		clamped := m.clampVolume(session, current)
+		if clamped >= current {
+			continue
+		}
+
+		m.logger.Debugw("Lowering session to its volume cap", "session", session, "from", current, "to", clamped)
+
+		if err := m.setSessionVolume(session, clamped); err != nil {
+			m.logger.Warnw("Failed to lower session to its volume cap", "session", session, "error", err)
+			continue
+		}
+
+		m.cacheVolume(session, clamped)
+	}
+}
+
+// targetMatches returns true if a slider_mapping-style target currently resolves to the session
+func (m *sessionMap) targetMatches(target string, session Session) bool {
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, _ := m.get(resolvedTarget)
+		for _, candidate := range sessions {
+			if candidate == session {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/thoas/go-funk"
+	"go.uber.org/zap"
+)
+
+const (
+	// volumeFeedbackLinePrefix starts each line telling the board where a slider should be, e.g. "f2|35"
+	volumeFeedbackLinePrefix = "f"
+
+	// sliderLabelLinePrefix starts each line telling the board what a slider controls, e.g. "n1|music"
+	sliderLabelLinePrefix = "n"
+)
+
+// volumeFeedback tells the board when a slider's targets are changed outside deej, e.g. from the OS mixer,
+// so builds with motor faders or displays can follow along
+type volumeFeedback struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+}
+
+func newVolumeFeedback(deej *Deej, logger *zap.SugaredLogger) *volumeFeedback {
+	logger = logger.Named("feedback")
+
+	vf := &volumeFeedback{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created volume feedback instance")
+
+	return vf
+}
+
+// start begins passing volume changes and slider labels on to the board whenever it's enabled and connected,
+// until deej shuts down
+func (vf *volumeFeedback) start() {
+	volumeChangesChannel := vf.deej.events.volumeChanged.subscribe()
+	connectionChannel := vf.deej.events.connectionChanged.subscribe()
+	configReloadedChannel := vf.deej.events.configReloaded.subscribe()
+
+	vf.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case change := <-volumeChangesChannel:
+				vf.send(change)
+			case connected := <-connectionChannel:
+				if connected {
+					vf.sendLabels()
+				}
+			case <-configReloadedChannel:
+				vf.sendLabels()
+			}
+		}
+	})
+}
+
+// sendLabels tells the board what each mapped slider controls, so builds with displays can show it
+func (vf *volumeFeedback) sendLabels() {
+	if !vf.deej.config.VolumeFeedback || !vf.deej.serial.Connected() {
+		return
+	}
+
+	vf.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		label := sliderLabel(vf.deej.config.SliderNames[sliderIdx], targets)
+
+		err := vf.deej.serial.writeToSlider(sliderIdx, func(localIdx int) string {
+			return fmt.Sprintf("%s%d|%s", sliderLabelLinePrefix, localIdx, label)
+		})
+
+		if err != nil {
+			vf.logger.Debugw("Failed to send slider label", "slider", sliderIdx, "error", err)
+		}
+	})
+}
+
+func (vf *volumeFeedback) send(change sessionVolumeChange) {
+	if !vf.deej.config.VolumeFeedback || !vf.deej.serial.Connected() {
+		return
+	}
+
+	position := change.Volume
+	if vf.deej.config.InvertSliders {
+		position = 1 - position
+	}
+
+	for _, sliderIdx := range vf.sliders(change.Key) {
+		// boards number their sliders from 0, no matter their slider offset
+		err := vf.deej.serial.writeToSlider(sliderIdx, func(localIdx int) string {
+			return fmt.Sprintf("%s%d|%d", volumeFeedbackLinePrefix, localIdx, int(position*100+0.5))
+		})
+
+		if err != nil {
+			vf.logger.Debugw("Failed to send volume feedback", "error", err)
+			return
+		}
+	}
+}
+
+// sliders returns the sliders a session is mapped to. Crossfades are left out, since their position
+// can't be told from the volume of one side.
+func (vf *volumeFeedback) sliders(key string) []int {
+	var sliders []int
+
+	vf.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		for _, target := range targets {
+			if _, _, ok := vf.deej.sessions.crossfadeTargets(target); ok {
+				continue
+			}
+
+			if funk.ContainsString(vf.deej.sessions.resolveTarget(target), key) {
+				sliders = append(sliders, sliderIdx)
+				return
+			}
+		}
+	})
+
+	return sliders
+}
+
+// sliderLabel names a slider by its configured name, or by its first target otherwise (which reads best
+// when it's an alias). Separators and line breaks are replaced, as they'd break the line up.
+func sliderLabel(name string, targets []string) string {
+	label := name
+	if label == "" && len(targets) > 0 {
+		label = targets[0]
+	}
+
+	return strings.NewReplacer("|", "/", "\r", " ", "\n", " ").Replace(label)
+}
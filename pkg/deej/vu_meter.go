@@ -0,0 +1,148 @@
+package deej
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// vuMeterLinePrefix starts each line of meter data sent to the board, e.g. "v87|0|12" for three sliders
+const vuMeterLinePrefix = "v"
+
+// vuMeter sends the peak level of each slider's targets to the board, so builds with LEDs next to their
+// sliders can show level meters
+type vuMeter struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lastSent  time.Time
+	lastLines map[int]string // by the slider offset of the board they were sent to
+}
+
+func newVUMeter(deej *Deej, logger *zap.SugaredLogger) *vuMeter {
+	logger = logger.Named("vu_meter")
+
+	vm := &vuMeter{
+		deej:      deej,
+		logger:    logger,
+		lastLines: make(map[int]string),
+	}
+
+	logger.Debug("Created VU meter instance")
+
+	return vm
+}
+
+// start begins sending meter data whenever it's enabled and the board is connected.
+// Config changes are picked up as they happen, until deej shuts down.
+func (vm *vuMeter) start() {
+	configReloadedChannel := vm.deej.events.configReloaded.subscribe()
+
+	vm.deej.spawn(func(ctx context.Context) error {
+		// only subscribed while enabled, so sessions aren't metered for nothing.
+		// receiving from a nil channel blocks forever, leaving that case out of the select
+		var peakLevelsChannel chan PeakLevels
+
+		for {
+			enabled := vm.deej.config.VUMeterInfo.Enabled
+
+			if enabled && peakLevelsChannel == nil {
+				peakLevelsChannel = vm.deej.meter.subscribeToPeakLevels()
+			} else if !enabled && peakLevelsChannel != nil {
+				vm.deej.meter.unsubscribeFromPeakLevels(peakLevelsChannel)
+				peakLevelsChannel = nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-configReloadedChannel:
+			case levels := <-peakLevelsChannel:
+				vm.send(levels)
+			}
+		}
+	})
+}
+
+func (vm *vuMeter) send(levels PeakLevels) {
+	if !vm.deej.serial.Connected() {
+		return
+	}
+
+	interval := time.Second / time.Duration(vm.deej.config.VUMeterInfo.Rate)
+	if time.Since(vm.lastSent) < interval {
+		return
+	}
+
+	sliderPeaks, numMappedSliders := vm.peaks(levels)
+
+	err := vm.deej.serial.writeToDevices(func(sliderOffset int, numSliders int) (string, bool) {
+		// boards only get their own sliders, up to the highest mapped one
+		count := numMappedSliders - sliderOffset
+		if numSliders > 0 && numSliders < count {
+			count = numSliders
+		}
+
+		if count <= 0 {
+			return "", false
+		}
+
+		line := vm.line(sliderPeaks, sliderOffset, count)
+
+		// the board keeps showing the last values, so there's no need to repeat them
+		if line == vm.lastLines[sliderOffset] {
+			return "", false
+		}
+
+		vm.lastLines[sliderOffset] = line
+		return line, true
+	})
+
+	if err != nil {
+		vm.logger.Debugw("Failed to send meter data", "error", err)
+		return
+	}
+
+	vm.lastSent = time.Now()
+}
+
+// peaks returns the peak of each mapped slider's targets, along with the number of sliders up to the highest mapped one
+func (vm *vuMeter) peaks(levels PeakLevels) (map[int]float32, int) {
+	sliderPeaks := make(map[int]float32)
+	numSliders := 0
+
+	vm.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		if sliderIdx+1 > numSliders {
+			numSliders = sliderIdx + 1
+		}
+
+		for _, target := range targets {
+			// a crossfade is as loud as the louder of its sides
+			sides := []string{target}
+			if targetA, targetB, ok := vm.deej.sessions.crossfadeTargets(target); ok {
+				sides = []string{targetA, targetB}
+			}
+
+			for _, side := range sides {
+				if peak, found := vm.deej.sessions.targetPeak(side, levels); found && peak > sliderPeaks[sliderIdx] {
+					sliderPeaks[sliderIdx] = peak
+				}
+			}
+		}
+	})
+
+	return sliderPeaks, numSliders
+}
+
+// line formats the peaks of count sliders starting at sliderOffset as percentages
+func (vm *vuMeter) line(sliderPeaks map[int]float32, sliderOffset int, count int) string {
+	values := make([]string, count)
+	for i := range values {
+		values[i] = fmt.Sprintf("%d", int(sliderPeaks[sliderOffset+i]*100+0.5))
+	}
+
+	return vuMeterLinePrefix + strings.Join(values, "|")
+}
@@ -0,0 +1,255 @@
+package deej
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	webUIPath         = "/ui/"
+	webUIStatePath    = "/ui/api/state"
+	webUIMappingPath  = "/ui/api/mapping"
+	webUISliderPath   = "/ui/api/sliders/"
+	webUIMaxBodySize  = 64 * 1024
+	webUIAssetsSubdir = "assets/webui"
+)
+
+//go:embed assets/webui
+var webUIAssets embed.FS
+
+// webUIState is everything the web UI shows, polled by the page a few times per second
+type webUIState struct {
+	Connected      bool                        `json:"connected"`
+	VirtualSliders bool                        `json:"virtualSliders"`
+	Sliders        map[int]float32             `json:"sliders"`
+	Sessions       []webUISession              `json:"sessions"`
+	ActiveProfile  string                      `json:"activeProfile"`
+	Mappings       map[string]map[int][]string `json:"mappings"`
+}
+
+type webUISession struct {
+	Key         string  `json:"key"`
+	DisplayName string  `json:"displayName"`
+	Icon        string  `json:"icon,omitempty"` // where to get the session's icon, if it has one
+	Volume      float32 `json:"volume"`
+	Muted       bool    `json:"muted"`
+}
+
+// webUISliderMove is a virtual slider's new position, between 0 and 1
+type webUISliderMove struct {
+	Value float32 `json:"value"`
+}
+
+// webUIMapping is a slider mapping sent back by the mapping editor
+type webUIMapping struct {
+	Profile string           `json:"profile"`
+	Mapping map[int][]string `json:"mapping"`
+}
+
+// webUI serves a small page for monitoring deej and editing the slider mapping, on top of the HTTP server.
+// With virtual sliders enabled, its sliders can also be moved on screen, e.g. from a tablet or without a board at all
+type webUI struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock         sync.Mutex
+	sliderValues map[int]float32
+}
+
+func newWebUI(deej *Deej, logger *zap.SugaredLogger) *webUI {
+	logger = logger.Named("webui")
+
+	ui := &webUI{
+		deej:         deej,
+		logger:       logger,
+		sliderValues: make(map[int]float32),
+	}
+
+	logger.Debug("Created web UI instance")
+
+	return ui
+}
+
+// initialize registers the page and its endpoints with the HTTP server, and starts tracking slider values
+func (ui *webUI) initialize() {
+	assets, err := fs.Sub(webUIAssets, webUIAssetsSubdir)
+	if err != nil {
+		ui.logger.Warnw("Failed to load web UI assets", "error", err)
+		return
+	}
+
+	ui.deej.http.handle("GET /{$}", http.RedirectHandler(webUIPath, http.StatusFound))
+	ui.deej.http.handle("GET "+webUIPath, http.StripPrefix(webUIPath, http.FileServer(http.FS(assets))))
+	ui.deej.http.handle("GET "+webUIStatePath, http.HandlerFunc(ui.serveState))
+	ui.deej.http.handle("PUT "+webUIMappingPath, http.HandlerFunc(ui.serveMapping))
+	ui.deej.http.handle("PUT "+webUISliderPath+"{slider}", http.HandlerFunc(ui.serveSliderMove))
+	ui.deej.http.describe("ui", func() string { return webUIPath })
+
+	sliderEventsChannel := ui.deej.events.sliderMoved.subscribe()
+
+	ui.deej.spawn(func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-sliderEventsChannel:
+				ui.lock.Lock()
+				ui.sliderValues[event.SliderID] = event.PercentValue
+				ui.lock.Unlock()
+			}
+		}
+	})
+}
+
+func (ui *webUI) serveState(w http.ResponseWriter, r *http.Request) {
+	state := webUIState{
+		Connected:      ui.deej.serial.Connected(),
+		VirtualSliders: ui.deej.config.HTTPInfo.VirtualSliders,
+		Sliders:        make(map[int]float32),
+		Sessions:       []webUISession{},
+		ActiveProfile:  ui.deej.config.ActiveProfile,
+		Mappings:       map[string]map[int][]string{DefaultProfileName: sliderMapContents(ui.deej.config.baseSliderMapping)},
+	}
+
+	ui.lock.Lock()
+	for sliderIdx, value := range ui.sliderValues {
+		state.Sliders[sliderIdx] = value
+	}
+	ui.lock.Unlock()
+
+	for _, session := range ui.deej.sessions.snapshot() {
+		state.Sessions = append(state.Sessions, webUISession{
+			Key:         session.Key(),
+			DisplayName: sessionDisplayName(session),
+			Icon:        sessionIconURL(session),
+			Volume:      session.GetVolume(),
+			Muted:       sessionIsMuted(session),
+		})
+	}
+
+	for name, mapping := range ui.deej.config.Profiles {
+		state.Mappings[name] = sliderMapContents(mapping)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		ui.logger.Debugw("Failed to write web UI state", "error", err)
+	}
+}
+
+// serveMapping saves the mapping editor's changes to the config file
+func (ui *webUI) serveMapping(w http.ResponseWriter, r *http.Request) {
+	// the config file is only editable from this machine, even if the API is open to the network
+	if !requestFromLoopback(r) {
+		http.Error(w, "the mapping can only be changed from this computer", http.StatusForbidden)
+		return
+	}
+
+	// requiring JSON forces browsers into a CORS preflight, which we never approve
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" || !checkLocalOrigin(r) {
+		http.Error(w, "expected application/json from a local page", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var request webUIMapping
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webUIMaxBodySize)).Decode(&request); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if request.Profile == "" {
+		request.Profile = DefaultProfileName
+	}
+
+	ui.logger.Debugw("Saving slider mapping via web UI", "profile", request.Profile, "mapping", request.Mapping)
+
+	if err := ui.deej.config.SaveSliderMapping(request.Profile, request.Mapping); err != nil {
+		ui.logger.Warnw("Failed to save slider mapping", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveSliderMove moves a virtual slider, which goes through exactly like a move of one of the board's sliders.
+// Unlike the mapping, sliders can be moved from other devices on the network if the API is open to them.
+func (ui *webUI) serveSliderMove(w http.ResponseWriter, r *http.Request) {
+	if !ui.deej.config.HTTPInfo.VirtualSliders {
+		http.Error(w, "virtual sliders are disabled, set http_api.virtual_sliders in config.yaml", http.StatusForbidden)
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" || !checkLocalOrigin(r) {
+		http.Error(w, "expected application/json from the web UI", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	sliderIdx, err := strconv.Atoi(r.PathValue("slider"))
+	if err != nil || sliderIdx < 0 {
+		http.Error(w, "invalid slider", http.StatusBadRequest)
+		return
+	}
+
+	var move webUISliderMove
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webUIMaxBodySize)).Decode(&move); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if move.Value < 0 || move.Value > 1 {
+		http.Error(w, "value must be between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	ui.deej.serial.notifySliderMove(SliderMoveEvent{SliderID: sliderIdx, PercentValue: ui.deej.config.normalizeSliderValue(move.Value)})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// url returns the address to open the web UI at, if the HTTP API is enabled
+func (ui *webUI) url() (string, bool) {
+	info := ui.deej.config.HTTPInfo
+	if !info.Enabled {
+		return "", false
+	}
+
+	host, port, err := net.SplitHostPort(info.Address)
+	if err != nil {
+		return "", false
+	}
+
+	// listening on all interfaces includes loopback
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if info.TLS.Enabled {
+		scheme = "https"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port) + webUIPath, true
+}
+
+// sliderMapContents copies a slider map's targets
+func sliderMapContents(mapping *sliderMap) map[int][]string {
+	contents := make(map[int][]string)
+
+	mapping.iterate(func(sliderIdx int, targets []string) {
+		contents[sliderIdx] = append([]string(nil), targets...)
+	})
+
+	return contents
+}
@@ -0,0 +1,182 @@
+// Package deejlib embeds deej in other Go programs, such as a custom GUI. It wraps package deej behind a small API
+// that stays the same as deej's internals change: create an Engine, run it, and control and observe it while it runs.
+//
+// Like the deej executable, an Engine reads config.yaml from the working directory and follows changes to it.
+package deejlib
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej"
+)
+
+// Options configures a new Engine
+type Options struct {
+	// Logger receives deej's logs. If nil, they're discarded
+	Logger *zap.SugaredLogger
+
+	// Verbose logs every serial line and session change, as deej --verbose does
+	Verbose bool
+
+	// Version is shown in the tray menu, if the Engine runs with one
+	Version string
+
+	// Headless runs without a tray icon even under RunWithTray, logs notifications instead of showing them, and
+	// reloads the config on SIGHUP. Run never shows a tray icon or handles signals either way.
+	Headless bool
+
+	// DryRun logs the volume and mute changes deej would make instead of making them, as deej --dry-run does
+	DryRun bool
+}
+
+// Session is an audio session deej controls
+type Session struct {
+	// Key is what slider_mapping refers to the session by, e.g. "chrome.exe" or "master"
+	Key string
+
+	// DisplayName is what the OS calls the session, e.g. "Spotify", or Key if it has no better name
+	DisplayName string
+
+	Volume float32 // between 0 and 1
+	Muted  bool
+}
+
+// SliderMove is a slider moving to a new position
+type SliderMove struct {
+	Slider int     // numbered as in slider_mapping
+	Value  float32 // between 0 and 1
+}
+
+// ErrNotFound is returned when no session matches a target
+var ErrNotFound = errors.New("no sessions match target")
+
+// Engine is a deej instance. Engines can only run once
+type Engine struct {
+	deej *deej.Deej
+}
+
+// New creates an Engine, which doesn't do anything until it runs
+func New(options Options) (*Engine, error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+
+	d, err := deej.NewDeej(logger, options.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Version != "" {
+		d.SetVersion(options.Version)
+	}
+
+	d.SetHeadless(options.Headless)
+	d.SetDryRun(options.DryRun)
+
+	return &Engine{deej: d}, nil
+}
+
+// Run runs the engine without a tray icon until ctx is canceled or the engine stops on its own,
+// e.g. because the board's serial port is busy
+func (e *Engine) Run(ctx context.Context) error {
+	return e.deej.Run(ctx)
+}
+
+// RunWithTray runs the engine with its tray icon, the way the deej executable does. It takes over the main
+// thread (where the tray has to run on some platforms), handles interrupt signals, and exits the process
+// once the engine stops.
+func (e *Engine) RunWithTray() error {
+	return e.deej.Initialize()
+}
+
+// RunAsService runs the engine under the system's service manager, see deej.InstallService.
+// It returns once the engine stops.
+func (e *Engine) RunAsService() error {
+	return e.deej.RunAsService()
+}
+
+// Sessions returns the audio sessions the engine currently knows about, sorted by key
+func (e *Engine) Sessions() []Session {
+	var sessions []Session
+
+	for _, state := range e.deej.Sessions() {
+		sessions = append(sessions, Session{
+			Key:         state.Key,
+			DisplayName: state.DisplayName,
+			Volume:      state.Volume,
+			Muted:       state.Muted,
+		})
+	}
+
+	return sessions
+}
+
+// SessionIcon returns the icon of the app behind a session key as PNG data, or ErrNotFound if no session
+// with that key has one
+func (e *Engine) SessionIcon(key string) ([]byte, error) {
+	icon, ok := e.deej.SessionIcon(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return icon, nil
+}
+
+// SetVolume sets the volume (between 0 and 1) of every session matching a target, which can be anything
+// slider_mapping accepts. It returns the keys of the sessions that were adjusted.
+func (e *Engine) SetVolume(target string, volume float32) ([]string, error) {
+	return adjusted(e.deej.SetVolume(target, volume))
+}
+
+// SetMute mutes or unmutes every session matching a target, returning the keys of the sessions that were adjusted
+func (e *Engine) SetMute(target string, mute bool) ([]string, error) {
+	return adjusted(e.deej.SetMute(target, mute))
+}
+
+// ReloadConfig re-reads config.yaml, as if it had changed on disk
+func (e *Engine) ReloadConfig() error {
+	return e.deej.ReloadConfig()
+}
+
+// SliderMoves returns a channel that receives slider moves until ctx is canceled, after which it's closed.
+// Receivers that fall too far behind miss their oldest moves.
+func (e *Engine) SliderMoves(ctx context.Context) <-chan SliderMove {
+	events := e.deej.SubscribeToSliderMoveEvents()
+	moves := make(chan SliderMove)
+
+	e.deej.Go(func() {
+		defer close(moves)
+		defer e.deej.UnsubscribeFromSliderMoveEvents(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				select {
+				case moves <- SliderMove{Slider: event.SliderID, Value: event.PercentValue}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+
+	return moves
+}
+
+func adjusted(keys []string, err error) ([]string, error) {
+	if err != nil {
+		return keys, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return keys, nil
+}